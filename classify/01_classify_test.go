@@ -0,0 +1,57 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/classify/01_classify_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-10 16:21:37 krylon>
+
+package classify
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestTokens(t *testing.T) {
+	var tokens = Tokens("sshd", "Accepted publickey for root from 192.168.0.23 port 51234 ssh2")
+
+	if !slices.Equal(tokens, []string{"source:sshd", "accepted", "publickey", "for", "root", "from", "port", "ssh"}) {
+		t.Errorf("Unexpected tokens: %v", tokens)
+	}
+} // func TestTokens(t *testing.T)
+
+func TestScore(t *testing.T) {
+	var (
+		m      *Model
+		labels = []model.Label{
+			{Source: "CRON", Message: "(root) CMD (run-parts /etc/cron.hourly)"},
+			{Source: "CRON", Message: "(root) CMD (/usr/lib/sa/sa1 1 1)"},
+			{Source: "systemd", Message: "Started Session 42 of User krylon."},
+			{Source: "kernel", Message: "EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0", Interesting: true},
+			{Source: "sshd", Message: "Failed password for root from 10.0.0.1 port 4711 ssh2", Interesting: true},
+		}
+		noise = model.Record{Source: "CRON", Message: "(root) CMD (run-parts /etc/cron.daily)"}
+		alarm = model.Record{Source: "sshd", Message: "Failed password for admin from 10.0.0.2 port 815 ssh2"}
+	)
+
+	if m = Train(nil); m.Ready() {
+		t.Error("Model without examples claims to be ready")
+	} else if s := m.Score(&alarm); s != 0.5 {
+		t.Errorf("Model without examples has an opinion: %f", s)
+	}
+
+	if m = Train(labels); !m.Ready() {
+		t.Fatal("Model is not ready")
+	} else if m.Examples() != int64(len(labels)) {
+		t.Errorf("Unexpected number of examples: %d", m.Examples())
+	}
+
+	if s := m.Score(&noise); s >= 0.5 {
+		t.Errorf("Noise scored %f", s)
+	}
+
+	if s := m.Score(&alarm); s <= 0.5 {
+		t.Errorf("Failed login scored %f", s)
+	}
+} // func TestScore(t *testing.T)
@@ -0,0 +1,132 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/classify/classify.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-10 16:05:44 krylon>
+
+// Package classify learns from the Labels the user put on Records which
+// Records are interesting, and which ones are noise.
+//
+// It is a plain multinomial naive Bayes classifier. The features are the
+// words of a message, after the parameters have been stripped from it,
+// plus the source, so "sshd" and "sshd: Accepted publickey for <*>" are
+// what it learns, not the IP address of each login.
+package classify
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// The classes the classifier tells apart.
+const (
+	boring = iota
+	interesting
+)
+
+// Model is a trained classifier. It is not modified after it has been
+// trained, so it is safe for concurrent use.
+type Model struct {
+	docs   [2]float64
+	total  [2]float64
+	counts [2]map[string]float64
+	vocab  float64
+}
+
+// Train builds a Model from the given Labels.
+func Train(labels []model.Label) *Model {
+	var (
+		m     = new(Model)
+		vocab = make(map[string]bool)
+	)
+
+	m.counts[boring] = make(map[string]float64)
+	m.counts[interesting] = make(map[string]float64)
+
+	for i := range labels {
+		var class = boring
+
+		if labels[i].Interesting {
+			class = interesting
+		}
+
+		m.docs[class]++
+
+		for _, t := range Tokens(labels[i].Source, labels[i].Message) {
+			m.counts[class][t]++
+			m.total[class]++
+			vocab[t] = true
+		}
+	}
+
+	m.vocab = float64(len(vocab))
+
+	return m
+} // func Train(labels []model.Label) *Model
+
+// Ready returns true if the Model has seen examples of both classes.
+// Before that, it cannot tell them apart.
+func (m *Model) Ready() bool {
+	return m != nil && m.docs[boring] > 0 && m.docs[interesting] > 0
+} // func (m *Model) Ready() bool
+
+// Examples returns the number of Labels the Model was trained on.
+func (m *Model) Examples() int64 {
+	if m == nil {
+		return 0
+	}
+
+	return int64(m.docs[boring] + m.docs[interesting])
+} // func (m *Model) Examples() int64
+
+// Score returns the probability of the Record being interesting. If the
+// Model is not Ready, it returns 0.5.
+func (m *Model) Score(r *model.Record) float64 {
+	if !m.Ready() {
+		return 0.5
+	}
+
+	var (
+		n      = m.docs[boring] + m.docs[interesting]
+		logp   [2]float64
+		tokens = Tokens(r.Source, r.Message)
+	)
+
+	for c := range logp {
+		logp[c] = math.Log(m.docs[c] / n)
+
+		// Laplace smoothing, so words the Model has never seen in a class
+		// do not rule it out entirely.
+		for _, t := range tokens {
+			logp[c] += math.Log((m.counts[c][t] + 1) / (m.total[c] + m.vocab))
+		}
+	}
+
+	// P(interesting) = 1 / (1 + exp(log P(boring) - log P(interesting)))
+	return 1 / (1 + math.Exp(logp[boring]-logp[interesting]))
+} // func (m *Model) Score(r *model.Record) float64
+
+// Tokens returns the features of a message: The source, and the words of
+// the message without its parameters, in lower case.
+func Tokens(source, msg string) []string {
+	var (
+		tmpl, _ = model.SplitMessage(msg)
+		words   = strings.FieldsFunc(strings.ToLower(tmpl), func(c rune) bool {
+			return !unicode.IsLetter(c) && c != '_' && c != '-'
+		})
+		tokens = make([]string, 0, len(words)+1)
+	)
+
+	tokens = append(tokens, "source:"+strings.ToLower(source))
+
+	for _, w := range words {
+		if w = strings.Trim(w, "_-"); len(w) > 1 {
+			tokens = append(tokens, w)
+		}
+	}
+
+	return tokens
+} // func Tokens(source, msg string) []string
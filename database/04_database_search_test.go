@@ -2,11 +2,12 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 09. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 19:04:49 krylon>
+// Time-stamp: <2024-10-13 11:06:31 krylon>
 
 package database
 
 import (
+	"context"
 	"slices"
 	"testing"
 	"time"
@@ -35,6 +36,31 @@ func TestSearchExecute(t *testing.T) {
 			},
 			cnt: recordCnt,
 		},
+		{
+			q: model.SearchQuery{
+				Query: "host:" + hosts[1].Name,
+			},
+			cnt: recordCnt,
+		},
+		{
+			q: model.SearchQuery{
+				Query: `source:test "message #00"`,
+			},
+			cnt: int64(len(hosts) * 9),
+		},
+		{
+			q: model.SearchQuery{
+				Hosts: []int64{hosts[1].ID},
+				Query: `-/#0\d\d$/ since:2d`,
+			},
+			cnt: 1,
+		},
+		{
+			q: model.SearchQuery{
+				Query: "source:nosuchsource",
+			},
+			cnt: 0,
+		},
 	}
 
 	for _, c := range testCases {
@@ -43,7 +69,7 @@ func TestSearchExecute(t *testing.T) {
 			cnt int64
 		)
 
-		go tdb.RecordSearch(&c.q, q)
+		go tdb.RecordSearch(context.Background(), &c.q, q, nil)
 
 		for range q {
 			cnt++
@@ -57,6 +83,103 @@ func TestSearchExecute(t *testing.T) {
 	}
 } // func TestSearchExecute(t *testing.T)
 
+func TestSearchProgress(t *testing.T) {
+	if tdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		prog SearchProgress
+		q    = make(chan model.Record)
+		sq   = model.SearchQuery{
+			Hosts: []int64{hosts[1].ID},
+			Query: `"message #00"`,
+		}
+		cnt int64
+	)
+
+	go tdb.RecordSearch(context.Background(), &sq, q, &prog)
+
+	for range q {
+		cnt++
+	}
+
+	if prog.Total.Load() != recordCnt {
+		t.Errorf("Unexpected total: %d (expected %d)",
+			prog.Total.Load(),
+			recordCnt)
+	} else if prog.Scanned.Load() != recordCnt {
+		t.Errorf("Unexpected number of scanned Records: %d (expected %d)",
+			prog.Scanned.Load(),
+			recordCnt)
+	} else if prog.Matched.Load() != cnt {
+		t.Errorf("Unexpected number of matches: %d (expected %d)",
+			prog.Matched.Load(),
+			cnt)
+	} else if prog.Err() != nil {
+		t.Errorf("Search failed: %s", prog.Err().Error())
+	}
+} // func TestSearchProgress(t *testing.T)
+
+func TestSearchCancel(t *testing.T) {
+	if tdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		prog        SearchProgress
+		ctx, cancel = context.WithCancel(context.Background())
+		q           = make(chan model.Record)
+		sq          model.SearchQuery
+		cnt         int64
+	)
+
+	defer cancel()
+
+	go tdb.RecordSearch(ctx, &sq, q, &prog)
+
+	// We take a few Records, then we lose interest. RecordSearch must
+	// close the channel nonetheless.
+	for range q {
+		if cnt++; cnt == 10 {
+			cancel()
+		}
+	}
+
+	if prog.Matched.Load() >= prog.Total.Load() {
+		t.Errorf("Search was not cancelled: %d of %d Records matched",
+			prog.Matched.Load(),
+			prog.Total.Load())
+	} else if prog.Err() != nil {
+		t.Errorf("Cancelling a search is not an error: %s", prog.Err().Error())
+	}
+} // func TestSearchCancel(t *testing.T)
+
+func TestSearchFail(t *testing.T) {
+	if tdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		prog SearchProgress
+		q    = make(chan model.Record)
+		sq   = model.SearchQuery{Query: "since:yesteryear"}
+		cnt  int64
+	)
+
+	go tdb.RecordSearch(context.Background(), &sq, q, &prog)
+
+	for range q {
+		cnt++
+	}
+
+	if prog.Err() == nil {
+		t.Errorf("Search with an invalid query did not fail")
+	} else if cnt != 0 {
+		t.Errorf("Search with an invalid query returned %d Records", cnt)
+	}
+} // func TestSearchFail(t *testing.T)
+
 func TestSearchAdd(t *testing.T) {
 	if tdb == nil {
 		t.SkipNow()
@@ -71,7 +194,7 @@ func TestSearchAdd(t *testing.T) {
 	}
 	var q = make(chan model.Record)
 
-	go tdb.RecordSearch(&s.Query, q)
+	go tdb.RecordSearch(context.Background(), &s.Query, q, nil)
 
 	for r := range q {
 		s.Results = append(s.Results, r.ID)
@@ -0,0 +1,506 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/05_database_partition_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 18. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-11 16:27:40 krylon>
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/model"
+)
+
+const partRecordCnt = 20
+
+var (
+	pdb       *Database
+	partBegin = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func TestPartitionQueryPrepare(t *testing.T) {
+	if tdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err error
+		p   *partition
+	)
+
+	if p, err = tdb.partitionForTime(time.Now(), true); err != nil {
+		t.Fatalf("Cannot get partition for current time: %s", err.Error())
+	} else if p == nil {
+		t.Fatal("partitionForTime did not return an error, but no partition, either")
+	}
+
+	for qid := range qpart {
+		if _, err = tdb.partitionStmt(p, qid); err != nil {
+			t.Errorf("Failed to prepare query %s: %s",
+				qid,
+				err.Error())
+		}
+	}
+} // func TestPartitionQueryPrepare(t *testing.T)
+
+func TestPartitionCreate(t *testing.T) {
+	var (
+		err    error
+		dbPath = filepath.Join(filepath.Dir(common.Path(path.Database)), "partition_test", "test.db")
+	)
+
+	if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Cannot create folder for test database: %s", err.Error())
+	} else if pdb, err = Open(dbPath); err != nil {
+		pdb = nil
+		t.Fatalf("Error opening database: %s", err.Error())
+	}
+
+	// Three months worth of Records, one per day.
+	for m := 0; m < 3; m++ {
+		for i := 0; i < partRecordCnt; i++ {
+			var rec = model.Record{
+				HostID:  1,
+				Time:    partBegin.AddDate(0, m, i),
+				Source:  "test",
+				Message: fmt.Sprintf("Message %d/%d", m, i),
+			}
+
+			if err = pdb.RecordAdd(&rec); err != nil {
+				t.Fatalf("Cannot add Record %s: %s",
+					rec.Message,
+					err.Error())
+			} else if partitionOfRecord(rec.ID) == 0 {
+				t.Fatalf("ID of Record %s does not contain a partition ID: %d",
+					rec.Message,
+					rec.ID)
+			}
+		}
+	}
+
+	var parts []Partition
+
+	if parts, err = pdb.PartitionGetAll(); err != nil {
+		t.Fatalf("Cannot get partitions: %s", err.Error())
+	} else if len(parts) != 3 {
+		t.Fatalf("Unexpected number of partitions: %d (expected 3)",
+			len(parts))
+	}
+
+	for _, p := range parts {
+		if _, err = os.Stat(p.Path); err != nil {
+			t.Errorf("Cannot stat partition file %s: %s",
+				p.Path,
+				err.Error())
+		}
+	}
+} // func TestPartitionCreate(t *testing.T)
+
+func TestPartitionQuery(t *testing.T) {
+	if pdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		exist   bool
+		records []model.Record
+		begin   = partBegin.AddDate(0, 1, 0)
+		end     = begin.AddDate(0, 0, partRecordCnt)
+	)
+
+	if records, err = pdb.RecordGetByPeriod(begin, end); err != nil {
+		t.Fatalf("Cannot get Records by period: %s", err.Error())
+	} else if len(records) != partRecordCnt {
+		t.Errorf("Unexpected number of Records for %s - %s: %d (expected %d)",
+			begin.Format(common.TimestampFormat),
+			end.Format(common.TimestampFormat),
+			len(records),
+			partRecordCnt)
+	} else if records[0].HostID != 1 {
+		t.Errorf("Unexpected Host ID in Record: %d (expected 1)",
+			records[0].HostID)
+	}
+
+	// The checksum is computed before the Record gets its ID.
+	var dup = model.Record{
+		HostID:  records[0].HostID,
+		Time:    records[0].Time,
+		Source:  records[0].Source,
+		Message: records[0].Message,
+	}
+
+	if exist, err = pdb.RecordCheckExist(&dup); err != nil {
+		t.Errorf("Cannot check if Record %d exists: %s",
+			records[0].ID,
+			err.Error())
+	} else if !exist {
+		t.Errorf("Record %d exists, but RecordCheckExist says it doesn't",
+			records[0].ID)
+	}
+
+	var ids = []int64{records[0].ID, records[len(records)-1].ID}
+
+	if records, err = pdb.RecordGetRecent(partRecordCnt * 2); err != nil {
+		t.Fatalf("Cannot get recent Records: %s", err.Error())
+	} else if len(records) != partRecordCnt*2 {
+		t.Errorf("Unexpected number of recent Records: %d (expected %d)",
+			len(records),
+			partRecordCnt*2)
+	} else if records[0].Time.Before(records[len(records)-1].Time) {
+		t.Error("Recent Records are not ordered from newest to oldest")
+	}
+
+	ids = append(ids, records[0].ID)
+
+	if records, err = pdb.RecordGetByIDList(ids); err != nil {
+		t.Fatalf("Cannot get Records by ID: %s", err.Error())
+	} else if len(records) != len(ids) {
+		t.Errorf("Unexpected number of Records: %d (expected %d)",
+			len(records),
+			len(ids))
+	}
+
+	var (
+		q   = make(chan model.Record)
+		cnt int
+		sq  = model.SearchQuery{
+			Period: []time.Time{begin, end},
+		}
+	)
+
+	go pdb.RecordSearch(context.Background(), &sq, q, nil)
+
+	for range q {
+		cnt++
+	}
+
+	if cnt != partRecordCnt {
+		t.Errorf("Unexpected number of search results: %d (expected %d)",
+			cnt,
+			partRecordCnt)
+	}
+} // func TestPartitionQuery(t *testing.T)
+
+func TestPartitionTransaction(t *testing.T) {
+	if pdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err   error
+		parts []Partition
+		rec   = model.Record{
+			HostID:  1,
+			Time:    partBegin.AddDate(1, 0, 0),
+			Source:  "test",
+			Message: "Rolled back",
+		}
+	)
+
+	if err = pdb.Begin(); err != nil {
+		t.Fatalf("Cannot begin transaction: %s", err.Error())
+	} else if err = pdb.RecordAdd(&rec); err != nil {
+		pdb.Rollback() // nolint: errcheck
+		t.Fatalf("Cannot add Record: %s", err.Error())
+	} else if err = pdb.Rollback(); err != nil {
+		t.Fatalf("Cannot roll back transaction: %s", err.Error())
+	} else if parts, err = pdb.PartitionGetAll(); err != nil {
+		t.Fatalf("Cannot get partitions: %s", err.Error())
+	} else if len(parts) != 3 {
+		t.Errorf("Unexpected number of partitions after rollback: %d (expected 3)",
+			len(parts))
+	}
+} // func TestPartitionTransaction(t *testing.T)
+
+func TestPartitionDrop(t *testing.T) {
+	if pdb == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		cnt     int
+		parts   []Partition
+		records []model.Record
+		ids     []int64
+		found   []model.Detection
+		scores  []model.Score
+		notes   map[int64][]model.Annotation
+		tagged  map[string][]int64
+		allIDs  []int64
+		pat     = &model.Pattern{
+			Template:  "Dropped <*>",
+			FirstSeen: partBegin,
+			LastSeen:  partBegin,
+		}
+		sig = &model.Signature{
+			Name:     "Dropped",
+			Category: "test",
+			Severity: model.SevInfo,
+			Query:    model.SearchQuery{Query: "Dropped"},
+			Active:   true,
+		}
+	)
+
+	// The Records of a dropped partition no longer match any Pattern or
+	// Signature, and they have no Score, Annotations, or Tags.
+	if records, err = pdb.RecordGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get Records: %s", err.Error())
+	} else if err = pdb.PatternAdd(pat); err != nil {
+		t.Fatalf("Cannot add Pattern: %s", err.Error())
+	} else if err = pdb.PatternAddRecords(pat, records); err != nil {
+		t.Fatalf("Cannot add Records to Pattern: %s", err.Error())
+	} else if err = pdb.SignatureAdd(sig); err != nil {
+		t.Fatalf("Cannot add Signature: %s", err.Error())
+	}
+
+	var list = make([]model.Detection, len(records))
+	for i, r := range records {
+		list[i] = model.Detection{RecordID: r.ID, SignatureID: sig.ID, HostID: r.HostID, Time: r.Time}
+	}
+
+	var scoreList = make([]model.Score, len(records))
+	for i, r := range records {
+		scoreList[i] = model.Score{RecordID: r.ID, HostID: r.HostID, Time: r.Time, Value: 0.5}
+	}
+
+	if err = pdb.DetectionAdd(list); err != nil {
+		t.Fatalf("Cannot add Detections: %s", err.Error())
+	} else if err = pdb.ScoreAdd(scoreList); err != nil {
+		t.Fatalf("Cannot add Scores: %s", err.Error())
+	}
+
+	for _, r := range records {
+		allIDs = append(allIDs, r.ID)
+
+		if err = pdb.AnnotationAdd(&model.Annotation{RecordID: r.ID, HostID: r.HostID, Time: r.Time, Text: "Note"}); err != nil {
+			t.Fatalf("Cannot add Annotation: %s", err.Error())
+		} else if err = pdb.TagAdd(&model.Tag{RecordID: r.ID, HostID: r.HostID, Name: "dropped", Time: r.Time}); err != nil {
+			t.Fatalf("Cannot add Tag: %s", err.Error())
+		}
+	}
+
+	if parts, err = pdb.PartitionGetAll(); err != nil {
+		t.Fatalf("Cannot get partitions: %s", err.Error())
+	} else if cnt, err = pdb.PartitionDropBefore(parts[0].End); err != nil {
+		t.Fatalf("Cannot drop partitions: %s", err.Error())
+	} else if cnt != 1 {
+		t.Errorf("Unexpected number of dropped partitions: %d (expected 1)",
+			cnt)
+	} else if _, err = os.Stat(parts[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Partition file %s still exists after dropping the partition",
+			parts[0].Path)
+	}
+
+	if records, err = pdb.RecordGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get Records: %s", err.Error())
+	} else if len(records) != partRecordCnt*2 {
+		t.Errorf("Unexpected number of Records after dropping partition: %d (expected %d)",
+			len(records),
+			partRecordCnt*2)
+	}
+
+	if ids, err = pdb.PatternGetRecordIDs(pat.ID, -1); err != nil {
+		t.Fatalf("Cannot get Records of Pattern: %s", err.Error())
+	} else if len(ids) != partRecordCnt*2 {
+		t.Errorf("Pattern matches %d Records after dropping partition, expected %d",
+			len(ids),
+			partRecordCnt*2)
+	}
+
+	if found, err = pdb.DetectionGetRecent(partBegin.AddDate(-1, 0, 0), -1); err != nil {
+		t.Fatalf("Cannot get Detections: %s", err.Error())
+	} else if len(found) != partRecordCnt*2 {
+		t.Errorf("There are %d Detections after dropping partition, expected %d",
+			len(found),
+			partRecordCnt*2)
+	}
+
+	if scores, err = pdb.ScoreGetTop(partBegin.AddDate(-1, 0, 0), -1); err != nil {
+		t.Fatalf("Cannot get Scores: %s", err.Error())
+	} else if len(scores) != partRecordCnt*2 {
+		t.Errorf("There are %d Scores after dropping partition, expected %d",
+			len(scores),
+			partRecordCnt*2)
+	}
+
+	if notes, err = pdb.AnnotationGetByRecords(allIDs); err != nil {
+		t.Fatalf("Cannot get Annotations: %s", err.Error())
+	} else if len(notes) != partRecordCnt*2 {
+		t.Errorf("There are %d annotated Records after dropping partition, expected %d",
+			len(notes),
+			partRecordCnt*2)
+	} else if tagged, err = pdb.TagGetAll(); err != nil {
+		t.Fatalf("Cannot get Tags: %s", err.Error())
+	} else if len(tagged["dropped"]) != partRecordCnt*2 {
+		t.Errorf("There are %d tagged Records after dropping partition, expected %d",
+			len(tagged["dropped"]),
+			partRecordCnt*2)
+	}
+} // func TestPartitionDrop(t *testing.T)
+
+// TestPartitionLegacy checks that the Records of a database created before
+// Records were partitioned remain accessible.
+func TestPartitionLegacy(t *testing.T) {
+	var (
+		err     error
+		raw     *sql.DB
+		ldb     *Database
+		records []model.Record
+		dbPath  = filepath.Join(filepath.Dir(common.Path(path.Database)), "legacy_test", "legacy.db")
+		qLegacy = []string{
+			`
+CREATE TABLE record (
+	id		INTEGER PRIMARY KEY,
+        host_id		INTEGER NOT NULL,
+        stamp           INTEGER NOT NULL DEFAULT 0,
+        source          TEXT NOT NULL,
+        message         TEXT NOT NULL,
+        checksum        TEXT UNIQUE NOT NULL
+) STRICT`,
+			"INSERT INTO record (host_id, stamp, source, message, checksum) VALUES (1, 1000, 'old', 'Old message', 'abc')",
+		}
+	)
+
+	if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Cannot create folder for test database: %s", err.Error())
+	} else if raw, err = sql.Open("sqlite3", dbPath); err != nil {
+		t.Fatalf("Cannot create legacy database: %s", err.Error())
+	}
+
+	// A database of version 0 has everything in qInit that is not added
+	// by one of the migrations.
+	for _, q := range append(qInit, qLegacy...) {
+		if slices.ContainsFunc(qMigrate, func(m []string) bool { return slices.Contains(m, q) }) {
+			continue
+		} else if _, err = raw.Exec(q); err != nil {
+			raw.Close() // nolint: errcheck
+			t.Fatalf("Cannot initialize legacy database: %s\n%s", err.Error(), q)
+		}
+	}
+
+	raw.Close() // nolint: errcheck
+
+	if ldb, err = Open(dbPath); err != nil {
+		t.Fatalf("Cannot open legacy database: %s", err.Error())
+	}
+
+	defer ldb.Close() // nolint: errcheck
+
+	var rec = model.Record{
+		HostID:  1,
+		Time:    time.Now(),
+		Source:  "new",
+		Message: "New message",
+	}
+
+	if err = ldb.RecordAdd(&rec); err != nil {
+		t.Fatalf("Cannot add Record to legacy database: %s", err.Error())
+	} else if records, err = ldb.RecordGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get Records from legacy database: %s", err.Error())
+	} else if len(records) != 2 {
+		t.Fatalf("Unexpected number of Records: %d (expected 2)",
+			len(records))
+	} else if records[1].Message != "Old message" {
+		t.Errorf("Unexpected message in legacy Record: %q",
+			records[1].Message)
+	}
+} // func TestPartitionLegacy(t *testing.T)
+
+// TestPartitionMigrate checks that a partition created before sources and
+// messages were normalized is upgraded when it is opened.
+func TestPartitionMigrate(t *testing.T) {
+	var (
+		err        error
+		raw        *sql.DB
+		mdb        *Database
+		p          *partition
+		cnt        int
+		records    []model.Record
+		stamp      = partBegin.AddDate(0, 0, 3)
+		begin, end = partitionBounds(stamp, PartitionSize)
+		dbPath     = filepath.Join(filepath.Dir(common.Path(path.Database)), "migrate_test", "test.db")
+		messages   = []string{
+			"Accepted publickey for root from 192.168.0.10 port 50022",
+			"Accepted publickey for root from 192.168.0.11 port 50512",
+			"Started Daily Cleanup of Temporary Directories.",
+		}
+	)
+
+	if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Cannot create folder for test database: %s", err.Error())
+	} else if mdb, err = Open(dbPath); err != nil {
+		t.Fatalf("Error opening database: %s", err.Error())
+	}
+
+	defer mdb.Close() // nolint: errcheck
+
+	if err = os.MkdirAll(mdb.partDir, 0755); err != nil {
+		t.Fatalf("Cannot create partition folder: %s", err.Error())
+	} else if raw, err = sql.Open("sqlite3", mdb.partitionPath(partitionName(begin, end))); err != nil {
+		t.Fatalf("Cannot create old partition: %s", err.Error())
+	} else if _, err = raw.Exec(`
+CREATE TABLE record (
+	id		INTEGER PRIMARY KEY,
+        host_id		INTEGER NOT NULL,
+        stamp           INTEGER NOT NULL DEFAULT 0,
+        source          TEXT NOT NULL,
+        message         TEXT NOT NULL,
+        checksum        TEXT UNIQUE NOT NULL
+) STRICT`); err != nil {
+		raw.Close() // nolint: errcheck
+		t.Fatalf("Cannot create old record table: %s", err.Error())
+	}
+
+	for i, msg := range messages {
+		if _, err = raw.Exec(
+			"INSERT INTO record (id, host_id, stamp, source, message, checksum) VALUES (?, 1, ?, 'sshd', ?, ?)",
+			(1<<partitionIDShift)+int64(i)+1,
+			stamp.Unix()+int64(i),
+			msg,
+			fmt.Sprintf("ck%d", i)); err != nil {
+			raw.Close() // nolint: errcheck
+			t.Fatalf("Cannot add Record to old partition: %s", err.Error())
+		}
+	}
+
+	raw.Close() // nolint: errcheck
+
+	if p, err = mdb.partitionForTime(stamp, true); err != nil {
+		t.Fatalf("Cannot open old partition: %s", err.Error())
+	} else if err = p.db.QueryRow("SELECT COUNT(*) FROM template").Scan(&cnt); err != nil {
+		t.Fatalf("Cannot count templates: %s", err.Error())
+	} else if cnt != 2 {
+		t.Errorf("Unexpected number of templates: %d (expected 2)", cnt)
+	}
+
+	if records, err = mdb.RecordGetByPeriod(begin, end); err != nil {
+		t.Fatalf("Cannot get Records: %s", err.Error())
+	} else if len(records) != len(messages) {
+		t.Fatalf("Unexpected number of Records: %d (expected %d)",
+			len(records),
+			len(messages))
+	}
+
+	for i, r := range records {
+		if r.Message != messages[i] {
+			t.Errorf("Unexpected message in Record %d: %q (expected %q)",
+				r.ID,
+				r.Message,
+				messages[i])
+		} else if r.Source != "sshd" {
+			t.Errorf("Unexpected source in Record %d: %q", r.ID, r.Source)
+		}
+	}
+} // func TestPartitionMigrate(t *testing.T)
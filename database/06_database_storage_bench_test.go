@@ -0,0 +1,283 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/06_database_storage_bench_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 20. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-26 19:20:31 krylon>
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// The storage benchmarks compare the flat record table we used to have
+// (including its indices),
+// where every row carries its source and message as text, to the
+// partitions, where sources and message templates are stored only once.
+//
+// Besides the time per query, they report the size of the database per
+// Record. Run them with
+//
+//	go test -run XXX -bench Storage ./database/
+
+const benchRecordCnt = 20000
+
+var benchBegin = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+const qBenchFlat = `
+CREATE TABLE record (
+	id		INTEGER PRIMARY KEY,
+        host_id		INTEGER NOT NULL,
+        stamp           INTEGER NOT NULL DEFAULT 0,
+        source          TEXT NOT NULL,
+        message         TEXT NOT NULL,
+        checksum        TEXT UNIQUE NOT NULL
+) STRICT`
+
+var qBenchFlatIndex = []string{
+	"CREATE INDEX record_host_idx ON record (host_id)",
+	"CREATE INDEX record_stamp_idx ON record (stamp)",
+	"CREATE INDEX record_source_idx ON record (source)",
+	"CREATE UNIQUE INDEX record_ck_idx ON record (checksum)",
+}
+
+// benchRecords generates Records that look roughly like what journald
+// produces on a busy server: a handful of sources, and lots of messages
+// that only differ in PIDs, addresses, ports, and such.
+func benchRecords(cnt int) []model.Record {
+	var (
+		rng       = rand.New(rand.NewSource(42))
+		records   = make([]model.Record, cnt)
+		templates = []struct {
+			source string
+			format func() string
+		}{
+			{"sshd", func() string {
+				return fmt.Sprintf("Accepted publickey for root from 10.0.%d.%d port %d ssh2: ED25519 SHA256:4f%x",
+					rng.Intn(256), rng.Intn(256), 1024+rng.Intn(60000), rng.Int63())
+			}},
+			{"sshd", func() string {
+				return fmt.Sprintf("pam_unix(sshd:session): session closed for user root (pid %d)",
+					rng.Intn(1<<22))
+			}},
+			{"systemd", func() string {
+				return fmt.Sprintf("Started Session %d of User root.", rng.Intn(100000))
+			}},
+			{"systemd", func() string {
+				return "Starting Daily Cleanup of Temporary Directories..."
+			}},
+			{"CRON", func() string {
+				return fmt.Sprintf("(root) CMD (command -v debian-sa1 > /dev/null && debian-sa1 1 1) [%d]",
+					rng.Intn(1<<22))
+			}},
+			{"kernel", func() string {
+				return fmt.Sprintf("[UFW BLOCK] IN=eth0 OUT= SRC=192.168.%d.%d DST=10.0.0.1 LEN=%d TTL=%d ID=%d PROTO=TCP SPT=%d DPT=22",
+					rng.Intn(256), rng.Intn(256), 40+rng.Intn(1400), 32+rng.Intn(96), rng.Intn(65536), 1024+rng.Intn(60000))
+			}},
+			{"postfix/smtpd", func() string {
+				return fmt.Sprintf("connect from unknown[203.0.113.%d]", rng.Intn(256))
+			}},
+		}
+	)
+
+	for i := range records {
+		var tmpl = templates[rng.Intn(len(templates))]
+
+		records[i] = model.Record{
+			HostID:  int64(1 + i%4),
+			Time:    benchBegin.Add(time.Duration(i) * 4 * time.Second),
+			Source:  tmpl.source,
+			Message: tmpl.format(),
+		}
+	}
+
+	return records
+} // func benchRecords(cnt int) []model.Record
+
+// dbSize returns the size of the database behind conn in bytes, including
+// whatever is still in the write-ahead log.
+func dbSize(conn *sql.DB) (int64, error) {
+	var size int64
+	var err = conn.QueryRow("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+} // func dbSize(conn *sql.DB) (int64, error)
+
+// benchOpenFlat creates a database with the flat record table and fills it
+// with the given Records.
+func benchOpenFlat(b *testing.B, records []model.Record) (*Database, int64) {
+	var (
+		err    error
+		raw    *sql.DB
+		tx     *sql.Tx
+		db     *Database
+		size   int64
+		dbPath = filepath.Join(filepath.Dir(common.Path(path.Database)), "bench_flat", "flat.db")
+	)
+
+	if err = os.RemoveAll(filepath.Dir(dbPath)); err != nil {
+		b.Fatalf("Cannot remove old benchmark database: %s", err.Error())
+	} else if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		b.Fatalf("Cannot create folder for benchmark database: %s", err.Error())
+	} else if raw, err = sql.Open("sqlite3", dbPath); err != nil {
+		b.Fatalf("Cannot create flat database: %s", err.Error())
+	}
+
+	defer raw.Close() // nolint: errcheck
+
+	for _, q := range append(append(qInit, qBenchFlat), qBenchFlatIndex...) {
+		if q == qMigrate[0][0] || q == qMigrate[0][1] {
+			continue
+		} else if _, err = raw.Exec(q); err != nil {
+			b.Fatalf("Cannot initialize flat database: %s\n%s", err.Error(), q)
+		}
+	}
+
+	if tx, err = raw.Begin(); err != nil {
+		b.Fatalf("Cannot begin transaction: %s", err.Error())
+	}
+
+	for i := range records {
+		var r = &records[i]
+		if _, err = tx.Exec(
+			"INSERT INTO record (host_id, stamp, source, message, checksum) VALUES (?, ?, ?, ?, ?)",
+			r.HostID,
+			r.Time.Unix(),
+			r.Source,
+			r.Message,
+			r.Checksum()); err != nil {
+			tx.Rollback() // nolint: errcheck
+			b.Fatalf("Cannot add Record: %s", err.Error())
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		b.Fatalf("Cannot commit transaction: %s", err.Error())
+	} else if size, err = dbSize(raw); err != nil {
+		b.Fatalf("Cannot get size of flat database: %s", err.Error())
+	} else if db, err = Open(dbPath); err != nil {
+		b.Fatalf("Cannot open flat database: %s", err.Error())
+	}
+
+	return db, size
+} // func benchOpenFlat(b *testing.B, records []model.Record) (*Database, int64)
+
+// benchOpenNormalized creates a database with partitions and fills it
+// with the given Records.
+func benchOpenNormalized(b *testing.B, records []model.Record) (*Database, int64) {
+	var (
+		err    error
+		db     *Database
+		parts  []Partition
+		size   int64
+		dbPath = filepath.Join(filepath.Dir(common.Path(path.Database)), "bench_normalized", "normalized.db")
+	)
+
+	if err = os.RemoveAll(filepath.Dir(dbPath)); err != nil {
+		b.Fatalf("Cannot remove old benchmark database: %s", err.Error())
+	} else if err = os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		b.Fatalf("Cannot create folder for benchmark database: %s", err.Error())
+	} else if db, err = Open(dbPath); err != nil {
+		b.Fatalf("Cannot open normalized database: %s", err.Error())
+	} else if err = db.Begin(); err != nil {
+		b.Fatalf("Cannot begin transaction: %s", err.Error())
+	}
+
+	for i := range records {
+		var r = records[i]
+		if err = db.RecordAdd(&r); err != nil {
+			db.Rollback() // nolint: errcheck
+			b.Fatalf("Cannot add Record: %s", err.Error())
+		}
+	}
+
+	if err = db.Commit(); err != nil {
+		b.Fatalf("Cannot commit transaction: %s", err.Error())
+	} else if parts, err = db.PartitionGetAll(); err != nil {
+		b.Fatalf("Cannot get partitions: %s", err.Error())
+	}
+
+	for _, meta := range parts {
+		var (
+			p     *partition
+			psize int64
+		)
+
+		if p, err = db.partitionOpen(meta); err != nil {
+			b.Fatalf("Cannot open partition %s: %s", meta.Name, err.Error())
+		} else if psize, err = dbSize(p.db); err != nil {
+			b.Fatalf("Cannot get size of partition %s: %s", meta.Name, err.Error())
+		}
+
+		size += psize
+	}
+
+	return db, size
+} // func benchOpenNormalized(b *testing.B, records []model.Record) (*Database, int64)
+
+func BenchmarkStorage(b *testing.B) {
+	var (
+		records  = benchRecords(benchRecordCnt)
+		backends = []struct {
+			name string
+			open func(*testing.B, []model.Record) (*Database, int64)
+		}{
+			{"flat", benchOpenFlat},
+			{"normalized", benchOpenNormalized},
+		}
+	)
+
+	for _, be := range backends {
+		var (
+			db   *Database
+			size int64
+		)
+
+		db, size = be.open(b, records)
+
+		b.Run(be.name+"/GetByPeriod", func(b *testing.B) {
+			var (
+				begin = benchBegin.Add(time.Hour * 6)
+				end   = begin.Add(time.Hour)
+			)
+
+			b.ReportMetric(float64(size)/benchRecordCnt, "bytes/record")
+
+			for i := 0; i < b.N; i++ {
+				if _, err := db.RecordGetByPeriod(begin, end); err != nil {
+					b.Fatalf("Cannot get Records: %s", err.Error())
+				}
+			}
+		})
+
+		b.Run(be.name+"/Search", func(b *testing.B) {
+			var sq = model.SearchQuery{
+				Terms: []*regexp.Regexp{regexp.MustCompile(`UFW BLOCK.*DPT=22`)},
+			}
+
+			b.ReportMetric(float64(size)/benchRecordCnt, "bytes/record")
+
+			for i := 0; i < b.N; i++ {
+				var q = make(chan model.Record)
+
+				go db.RecordSearch(context.Background(), &sq, q, nil)
+
+				for range q { // nolint: revive
+				}
+			}
+		})
+
+		db.Close() // nolint: errcheck
+	}
+} // func BenchmarkStorage(b *testing.B)
@@ -0,0 +1,142 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/07_database_backup_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 21. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-21 18:40:33 krylon>
+
+package database
+
+import (
+	"archive/tar"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%t", compress), func(t *testing.T) {
+			testBackupRestore(t, compress)
+		})
+	}
+} // func TestBackupRestore(t *testing.T)
+
+func testBackupRestore(t *testing.T, compress bool) {
+	var (
+		err     error
+		src     *Database
+		dst     *Database
+		buf     bytes.Buffer
+		records []model.Record
+		folder  = fmt.Sprintf("backup_test_%t", compress)
+		srcPath = filepath.Join(filepath.Dir(common.Path(path.Database)), folder, "src", "test.db")
+		dstPath = filepath.Join(filepath.Dir(common.Path(path.Database)), folder, "dst", "test.db")
+	)
+
+	for _, p := range []string{srcPath, dstPath} {
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Cannot create folder for test database: %s", err.Error())
+		}
+	}
+
+	if src, err = Open(srcPath); err != nil {
+		t.Fatalf("Cannot open database: %s", err.Error())
+	}
+
+	defer src.Close() // nolint: errcheck
+
+	// Two partitions worth of Records
+	for i := 0; i < partRecordCnt; i++ {
+		var rec = model.Record{
+			HostID:  1,
+			Time:    partBegin.AddDate(0, i%2, i),
+			Source:  "test",
+			Message: fmt.Sprintf("Message %d", i),
+		}
+
+		if err = src.RecordAdd(&rec); err != nil {
+			t.Fatalf("Cannot add Record: %s", err.Error())
+		}
+	}
+
+	if err = src.Backup(&buf, compress); err != nil {
+		t.Fatalf("Cannot create snapshot: %s", err.Error())
+	} else if err = Restore(&buf, dstPath); err != nil {
+		t.Fatalf("Cannot restore snapshot: %s", err.Error())
+	} else if dst, err = Open(dstPath); err != nil {
+		t.Fatalf("Cannot open restored database: %s", err.Error())
+	}
+
+	defer dst.Close() // nolint: errcheck
+
+	if records, err = dst.RecordGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get Records from restored database: %s", err.Error())
+	} else if len(records) != partRecordCnt {
+		t.Errorf("Unexpected number of Records in restored database: %d (expected %d)",
+			len(records),
+			partRecordCnt)
+	}
+} // func testBackupRestore(t *testing.T, compress bool)
+
+// TestRestoreVersion checks that Restore rejects a snapshot from a newer
+// version, and leaves the existing database alone.
+func TestRestoreVersion(t *testing.T) {
+	var (
+		err     error
+		raw     *sql.DB
+		content []byte
+		buf     bytes.Buffer
+		tw      = tar.NewWriter(&buf)
+		dir     = filepath.Join(filepath.Dir(common.Path(path.Database)), "restore_version_test")
+		dbPath  = filepath.Join(dir, "test.db")
+		snap    = filepath.Join(dir, "snapshot.db")
+	)
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Cannot create folder for test database: %s", err.Error())
+	} else if err = os.WriteFile(dbPath, []byte("Do not touch"), 0644); err != nil {
+		t.Fatalf("Cannot create dummy database: %s", err.Error())
+	} else if raw, err = sql.Open("sqlite3", snap); err != nil {
+		t.Fatalf("Cannot create snapshot database: %s", err.Error())
+	} else if _, err = raw.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion+1)); err != nil {
+		raw.Close() // nolint: errcheck
+		t.Fatalf("Cannot set schema version: %s", err.Error())
+	}
+
+	raw.Close() // nolint: errcheck
+
+	if content, err = os.ReadFile(snap); err != nil {
+		t.Fatalf("Cannot read snapshot database: %s", err.Error())
+	} else if err = tw.WriteHeader(&tar.Header{
+		Name:     snapshotMain,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(content)),
+	}); err != nil {
+		t.Fatalf("Cannot write tar header: %s", err.Error())
+	} else if _, err = tw.Write(content); err != nil {
+		t.Fatalf("Cannot write snapshot: %s", err.Error())
+	} else if err = tw.Close(); err != nil {
+		t.Fatalf("Cannot close tar archive: %s", err.Error())
+	}
+
+	if err = Restore(&buf, dbPath); err == nil {
+		t.Fatal("Restore accepted a snapshot with a newer schema version")
+	} else if content, err = os.ReadFile(dbPath); err != nil {
+		t.Fatalf("Cannot read dummy database: %s", err.Error())
+	} else if string(content) != "Do not touch" {
+		t.Errorf("Restore modified the existing database, even though it failed")
+	}
+
+	if err = Restore(bytes.NewReader([]byte("This is not a tar archive")), dbPath); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("Restore of garbage should return ErrInvalidSnapshot, not %v", err)
+	}
+} // func TestRestoreVersion(t *testing.T)
@@ -0,0 +1,354 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/alert.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 03. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-05 17:31:18 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// AlertRuleParams returns the parameters for the AlertRuleAdd and
+// AlertRuleUpdate queries, except for the ID.
+func AlertRuleParams(r *model.AlertRule) ([]any, error) {
+	var (
+		err error
+		buf []byte
+	)
+
+	if err = r.Validate(); err != nil {
+		return nil, err
+	} else if buf, err = json.Marshal(&r.Query); err != nil {
+		return nil, fmt.Errorf("Cannot serialize Query of alert rule %q: %w",
+			r.Name,
+			err)
+	}
+
+	return []any{
+		r.Name,
+		r.Description,
+		string(buf),
+		r.Threshold,
+		int64(r.Window / time.Second),
+		r.PerHost,
+		r.Active,
+		r.SilencedUntil.Unix(),
+		r.Kind,
+	}, nil
+} // func AlertRuleParams(r *model.AlertRule) ([]any, error)
+
+// ScanAlertRule reads an AlertRule from the current row of the result of
+// one of the queries that return alert rules.
+func ScanAlertRule(rows *sql.Rows) (*model.AlertRule, error) {
+	var (
+		err             error
+		qstr            []byte
+		period, silence int64
+		r               = new(model.AlertRule)
+	)
+
+	if err = rows.Scan(
+		&r.ID,
+		&r.Name,
+		&r.Description,
+		&qstr,
+		&r.Threshold,
+		&period,
+		&r.PerHost,
+		&r.Active,
+		&silence,
+		&r.Kind); err != nil {
+		return nil, fmt.Errorf("Cannot scan alert rule: %w", err)
+	} else if err = json.Unmarshal(qstr, &r.Query); err != nil {
+		return nil, fmt.Errorf("Cannot parse Query of alert rule %d: %w",
+			r.ID,
+			err)
+	}
+
+	r.Window = time.Duration(period) * time.Second
+	r.SilencedUntil = time.Unix(silence, 0)
+
+	return r, nil
+} // func ScanAlertRule(rows *sql.Rows) (*model.AlertRule, error)
+
+// ScanAlert reads an Alert from the current row of the result of one of
+// the queries that return Alerts.
+func ScanAlert(rows *sql.Rows) (*model.Alert, error) {
+	var (
+		err             error
+		fired, lastSeen int64
+		resolved        sql.NullInt64
+		a               = new(model.Alert)
+	)
+
+	if err = rows.Scan(
+		&a.ID,
+		&a.RuleID,
+		&a.HostID,
+		&fired,
+		&lastSeen,
+		&resolved,
+		&a.Count,
+		&a.Silenced); err != nil {
+		return nil, fmt.Errorf("Cannot scan Alert: %w", err)
+	}
+
+	a.Fired = time.Unix(fired, 0)
+	a.LastSeen = time.Unix(lastSeen, 0)
+	if resolved.Valid {
+		a.Resolved = time.Unix(resolved.Int64, 0)
+	}
+
+	return a, nil
+} // func ScanAlert(rows *sql.Rows) (*model.Alert, error)
+
+// AlertRuleAdd adds an alert rule to the database.
+func (db *Database) AlertRuleAdd(r *model.AlertRule) error {
+	var (
+		err  error
+		args []any
+	)
+
+	if args, err = AlertRuleParams(r); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.AlertRuleAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(args...).Scan(&r.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add alert rule %q: %w", r.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertRuleAdd(r *model.AlertRule) error
+
+// AlertRuleUpdate saves the changes to an existing alert rule.
+func (db *Database) AlertRuleUpdate(r *model.AlertRule) error {
+	var (
+		err  error
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = AlertRuleParams(r); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.AlertRuleUpdate, func(stmt *sql.Stmt) error {
+		res, err = stmt.Exec(append(args, r.ID)...)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update alert rule %d: %w", r.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		err = fmt.Errorf("No alert rule with ID %d was found in the database", r.ID)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertRuleUpdate(r *model.AlertRule) error
+
+// AlertRuleDelete removes an alert rule from the database, along with all
+// the Alerts it has raised.
+func (db *Database) AlertRuleDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.AlertRuleDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot delete alert rule %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertRuleDelete(id int64) error
+
+// AlertRuleSilence silences an alert rule until the given time. Passing a
+// time in the past ends the silence.
+func (db *Database) AlertRuleSilence(id int64, until time.Time) error {
+	var err error
+
+	if err = db.adHoc(query.AlertRuleSilence, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(until.Unix(), id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot silence alert rule %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertRuleSilence(id int64, until time.Time) error
+
+// AlertRuleGetAll returns all alert rules, ordered by name.
+func (db *Database) AlertRuleGetAll() ([]model.AlertRule, error) {
+	var (
+		err   error
+		rows  *sql.Rows
+		rules = make([]model.AlertRule, 0)
+	)
+
+	if rows, err = db.queryRows(query.AlertRuleGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query alert rules: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var r *model.AlertRule
+
+		if r, err = ScanAlertRule(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		rules = append(rules, *r)
+	}
+
+	return rules, rows.Err()
+} // func (db *Database) AlertRuleGetAll() ([]model.AlertRule, error)
+
+// AlertRuleGetByID looks up an alert rule by its ID. If there is no such
+// rule, it returns nil.
+func (db *Database) AlertRuleGetByID(id int64) (*model.AlertRule, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		r    *model.AlertRule
+	)
+
+	if rows, err = db.queryRows(query.AlertRuleGetByID, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query alert rule %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	} else if r, err = ScanAlertRule(rows); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	return r, nil
+} // func (db *Database) AlertRuleGetByID(id int64) (*model.AlertRule, error)
+
+// AlertAdd records a new Alert. It fails if the same rule already has an
+// open Alert for the same Host.
+func (db *Database) AlertAdd(a *model.Alert) error {
+	var err error
+
+	if err = db.adHoc(query.AlertAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(
+			a.RuleID,
+			a.HostID,
+			a.Fired.Unix(),
+			a.LastSeen.Unix(),
+			a.Count,
+			a.Silenced).Scan(&a.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add Alert for rule %d: %w", a.RuleID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertAdd(a *model.Alert) error
+
+// AlertUpdate saves the LastSeen and Count of an Alert that is still
+// firing.
+func (db *Database) AlertUpdate(a *model.Alert) error {
+	var err error
+
+	if err = db.adHoc(query.AlertUpdate, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(a.LastSeen.Unix(), a.Count, a.ID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Alert %d: %w", a.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertUpdate(a *model.Alert) error
+
+// AlertResolve marks an Alert as resolved at the given time.
+func (db *Database) AlertResolve(a *model.Alert, t time.Time) error {
+	var err error
+
+	if err = db.adHoc(query.AlertResolve, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(t.Unix(), a.ID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot resolve Alert %d: %w", a.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	a.Resolved = t
+	return nil
+} // func (db *Database) AlertResolve(a *model.Alert, t time.Time) error
+
+// AlertGetOpen returns all Alerts that are still firing, most recent
+// first.
+func (db *Database) AlertGetOpen() ([]model.Alert, error) {
+	return db.alertQuery(query.AlertGetOpen)
+} // func (db *Database) AlertGetOpen() ([]model.Alert, error)
+
+// AlertGetHistory returns up to <max> Alerts, most recent first.
+func (db *Database) AlertGetHistory(max int64) ([]model.Alert, error) {
+	return db.alertQuery(query.AlertGetHistory, max)
+} // func (db *Database) AlertGetHistory(max int64) ([]model.Alert, error)
+
+func (db *Database) alertQuery(qid query.ID, args ...any) ([]model.Alert, error) {
+	var (
+		err    error
+		rows   *sql.Rows
+		alerts = make([]model.Alert, 0)
+	)
+
+	if rows, err = db.queryRows(qid, args...); err != nil {
+		db.log.Printf("[ERROR] Cannot query Alerts: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var a *model.Alert
+
+		if a, err = ScanAlert(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		alerts = append(alerts, *a)
+	}
+
+	return alerts, rows.Err()
+} // func (db *Database) alertQuery(qid query.ID, args ...any) ([]model.Alert, error)
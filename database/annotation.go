@@ -0,0 +1,234 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/annotation.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 11. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-11 16:02:14 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// ScanAnnotation reads an Annotation from the current row of the result of
+// the AnnotationGetByRecords query.
+func ScanAnnotation(rows *sql.Rows) (*model.Annotation, error) {
+	var (
+		err   error
+		stamp int64
+		a     = new(model.Annotation)
+	)
+
+	if err = rows.Scan(&a.ID, &a.RecordID, &a.HostID, &stamp, &a.Text); err != nil {
+		return nil, fmt.Errorf("Cannot scan Annotation: %w", err)
+	}
+
+	a.Time = time.Unix(stamp, 0)
+
+	return a, nil
+} // func ScanAnnotation(rows *sql.Rows) (*model.Annotation, error)
+
+// ScanTag reads a Tag from the current row of the result of the
+// TagGetByRecords query.
+func ScanTag(rows *sql.Rows) (*model.Tag, error) {
+	var (
+		err   error
+		stamp int64
+		t     = new(model.Tag)
+	)
+
+	if err = rows.Scan(&t.RecordID, &t.Name, &t.HostID, &stamp); err != nil {
+		return nil, fmt.Errorf("Cannot scan Tag: %w", err)
+	}
+
+	t.Time = time.Unix(stamp, 0)
+
+	return t, nil
+} // func ScanTag(rows *sql.Rows) (*model.Tag, error)
+
+// AnnotationAdd attaches an Annotation to a Record.
+func (db *Database) AnnotationAdd(a *model.Annotation) error {
+	var err error
+
+	if err = db.adHoc(query.AnnotationAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(
+			a.RecordID,
+			a.HostID,
+			a.Time.Unix(),
+			a.Text).Scan(&a.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot annotate Record %d: %w", a.RecordID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AnnotationAdd(a *model.Annotation) error
+
+// AnnotationDelete removes an Annotation.
+func (db *Database) AnnotationDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.AnnotationDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot delete Annotation %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AnnotationDelete(id int64) error
+
+// AnnotationGetByRecords returns the Annotations of the given Records,
+// oldest first, keyed by the ID of their Record.
+func (db *Database) AnnotationGetByRecords(ids []int64) (map[int64][]model.Annotation, error) {
+	var (
+		err  error
+		raw  []byte
+		rows *sql.Rows
+		res  = make(map[int64][]model.Annotation)
+	)
+
+	if len(ids) == 0 {
+		return res, nil
+	} else if raw, err = json.Marshal(ids); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize list of IDs: %s\n",
+			err.Error())
+		return nil, err
+	} else if rows, err = db.queryRows(query.AnnotationGetByRecords, string(raw)); err != nil {
+		db.log.Printf("[ERROR] Cannot query Annotations: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var a *model.Annotation
+
+		if a, err = ScanAnnotation(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		res[a.RecordID] = append(res[a.RecordID], *a)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) AnnotationGetByRecords(ids []int64) (map[int64][]model.Annotation, error)
+
+// TagAdd puts a Tag on a Record. If the Record already carries the Tag,
+// nothing happens.
+func (db *Database) TagAdd(t *model.Tag) error {
+	var err error
+
+	if err = db.adHoc(query.TagAdd, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(t.RecordID, t.Name, t.HostID, t.Time.Unix())
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot tag Record %d with %q: %w",
+			t.RecordID,
+			t.Name,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) TagAdd(t *model.Tag) error
+
+// TagDelete removes a Tag from a Record.
+func (db *Database) TagDelete(recordID int64, name string) error {
+	var err error
+
+	if err = db.adHoc(query.TagDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(recordID, name)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot remove Tag %q from Record %d: %w",
+			name,
+			recordID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) TagDelete(recordID int64, name string) error
+
+// TagGetByRecords returns the Tags of the given Records, keyed by the ID
+// of their Record.
+func (db *Database) TagGetByRecords(ids []int64) (map[int64][]model.Tag, error) {
+	var (
+		err  error
+		raw  []byte
+		rows *sql.Rows
+		res  = make(map[int64][]model.Tag)
+	)
+
+	if len(ids) == 0 {
+		return res, nil
+	} else if raw, err = json.Marshal(ids); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize list of IDs: %s\n",
+			err.Error())
+		return nil, err
+	} else if rows, err = db.queryRows(query.TagGetByRecords, string(raw)); err != nil {
+		db.log.Printf("[ERROR] Cannot query Tags: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var t *model.Tag
+
+		if t, err = ScanTag(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		res[t.RecordID] = append(res[t.RecordID], *t)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) TagGetByRecords(ids []int64) (map[int64][]model.Tag, error)
+
+// TagGetAll returns the IDs of all tagged Records, keyed by the name of the
+// Tag.
+func (db *Database) TagGetAll() (map[string][]int64, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		res  = make(map[string][]int64)
+	)
+
+	if rows, err = db.queryRows(query.TagGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query Tags: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var (
+			name string
+			id   int64
+		)
+
+		if err = rows.Scan(&name, &id); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Tag: %s\n", err.Error())
+			return nil, err
+		}
+
+		res[name] = append(res[name], id)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) TagGetAll() (map[string][]int64, error)
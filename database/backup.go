@@ -0,0 +1,528 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/backup.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 21. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 10:31:18 krylon>
+
+package database
+
+// A snapshot is a tar archive, optionally compressed with gzip, that
+// contains a copy of the main database file as snapshotMain, and a copy of
+// each partition file in the folder snapshotPartDir.
+//
+// Each file is copied using SQLite's online backup API, so each copy is
+// consistent in itself even while the server keeps writing to the
+// database. The files are not copied at the same instant, though: The
+// partitions are copied first, and the main database last, so every Record
+// in the snapshot has its Host and so on in the main database. Records
+// written while the backup is running may be missing from the snapshot,
+// even though Annotations or Tags referring to them are included. Only the
+// partitions the copy of the main database knows about are included in
+// the snapshot, the ones created during the backup are restored empty.
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blicero/krylib"
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	snapshotMain    = "main.db"
+	snapshotPartDir = "partitions"
+)
+
+// snapshotPartPat matches the names of partition files in a snapshot.
+var snapshotPartPat = regexp.MustCompile(`^partitions/records_[-0-9]+[.]db$`)
+
+// ErrInvalidSnapshot indicates that a file passed to Restore is not a
+// snapshot created by Backup, or that it is damaged.
+var ErrInvalidSnapshot = errors.New("not a valid database snapshot")
+
+// backupFile copies the SQLite database src to a new file at path dst
+// using SQLite's online backup API.
+func backupFile(src *sql.DB, dst string) error {
+	var (
+		err            error
+		dstDB          *sql.DB
+		srcConn, dConn *sql.Conn
+		ctx            = context.Background()
+	)
+
+	if dstDB, err = sql.Open("sqlite3", dst); err != nil {
+		return err
+	}
+
+	defer dstDB.Close() // nolint: errcheck
+
+	if srcConn, err = src.Conn(ctx); err != nil {
+		return err
+	}
+
+	defer srcConn.Close() // nolint: errcheck
+
+	if dConn, err = dstDB.Conn(ctx); err != nil {
+		return err
+	}
+
+	defer dConn.Close() // nolint: errcheck
+
+	return dConn.Raw(func(dc any) error {
+		return srcConn.Raw(func(sc any) error {
+			var (
+				err      error
+				done     bool
+				bak      *sqlite3.SQLiteBackup
+				dstConn  = dc.(*sqlite3.SQLiteConn)
+				srcSConn = sc.(*sqlite3.SQLiteConn)
+			)
+
+			if bak, err = dstConn.Backup("main", srcSConn, "main"); err != nil {
+				return err
+			}
+
+			for !done {
+				if done, err = bak.Step(-1); err != nil {
+					bak.Finish() // nolint: errcheck
+					return err
+				} else if !done {
+					waitForRetry()
+				}
+			}
+
+			return bak.Finish()
+		})
+	})
+} // func backupFile(src *sql.DB, dst string) error
+
+// Backup writes a snapshot of the database, including all partitions, to
+// w. If compress is true, the snapshot is compressed with gzip. See the
+// comment at the top of this file for how consistent the snapshot is.
+//
+// Backup cannot be called while a transaction is in progress.
+func (db *Database) Backup(w io.Writer, compress bool) error {
+	var (
+		err     error
+		tmpDir  string
+		snap    *sql.DB
+		names   []string
+		copied  = make(map[string]string)
+		started = time.Now()
+	)
+
+	if db.tx != nil {
+		return ErrTxInProgress
+	} else if tmpDir, err = os.MkdirTemp(filepath.Dir(db.path), ".backup_"); err != nil {
+		db.log.Printf("[ERROR] Cannot create folder for backup: %s\n",
+			err.Error())
+		return err
+	}
+
+	defer os.RemoveAll(tmpDir) // nolint: errcheck
+
+	if err = os.Mkdir(filepath.Join(tmpDir, snapshotPartDir), 0755); err != nil {
+		db.log.Printf("[ERROR] Cannot create folder for backup: %s\n",
+			err.Error())
+		return err
+	} else if names, err = partitionNames(db.db); err != nil {
+		db.log.Printf("[ERROR] Cannot get partitions of database: %s\n",
+			err.Error())
+		return err
+	}
+
+	for _, name := range names {
+		var (
+			src   *sql.DB
+			fpath = db.partitionPath(name)
+			dst   = filepath.Join(snapshotPartDir, filepath.Base(fpath))
+		)
+
+		if _, err = os.Stat(fpath); os.IsNotExist(err) {
+			// The partition was dropped, or it has not received any
+			// Records, yet.
+			db.log.Printf("[INFO] Partition file %s does not exist, skipping it\n",
+				fpath)
+			continue
+		} else if src, err = sql.Open("sqlite3", fpath); err != nil {
+			db.log.Printf("[ERROR] Cannot open partition %s: %s\n",
+				name,
+				err.Error())
+			return err
+		}
+
+		err = backupFile(src, filepath.Join(tmpDir, dst))
+		src.Close() // nolint: errcheck
+
+		if err != nil {
+			db.log.Printf("[ERROR] Cannot copy partition %s: %s\n",
+				name,
+				err.Error())
+			return err
+		}
+
+		copied[name] = dst
+	}
+
+	// The main database is copied last, so it knows about everything the
+	// partitions refer to.
+	if err = backupFile(db.db, filepath.Join(tmpDir, snapshotMain)); err != nil {
+		db.log.Printf("[ERROR] Cannot copy database %s: %s\n",
+			db.path,
+			err.Error())
+		return err
+	} else if snap, err = sql.Open("sqlite3", filepath.Join(tmpDir, snapshotMain)); err != nil {
+		db.log.Printf("[ERROR] Cannot open copy of database: %s\n",
+			err.Error())
+		return err
+	}
+
+	defer snap.Close() // nolint: errcheck
+
+	if names, err = partitionNames(snap); err != nil {
+		db.log.Printf("[ERROR] Cannot get partitions from copy of database: %s\n",
+			err.Error())
+		return err
+	}
+
+	// Partitions dropped while we were copying are left out, as they
+	// are unknown to the copy of the main database.
+	var files = []string{snapshotMain}
+
+	for _, name := range names {
+		if dst, ok := copied[name]; ok {
+			files = append(files, dst)
+		}
+	}
+
+	if err = writeSnapshot(w, tmpDir, files, compress); err != nil {
+		db.log.Printf("[ERROR] Cannot write snapshot: %s\n",
+			err.Error())
+		return err
+	}
+
+	db.log.Printf("[INFO] Created snapshot of %s with %d partitions in %s\n",
+		db.path,
+		len(files)-1,
+		time.Since(started))
+
+	return nil
+} // func (db *Database) Backup(w io.Writer, compress bool) error
+
+// partitionNames returns the names of the partitions in the main database
+// db, oldest first.
+func partitionNames(db *sql.DB) ([]string, error) {
+	var (
+		err   error
+		rows  *sql.Rows
+		names []string
+	)
+
+	if rows, err = db.Query("SELECT name FROM partition ORDER BY begin_stamp"); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+} // func partitionNames(db *sql.DB) ([]string, error)
+
+// writeSnapshot writes the given files, relative to dir, to a tar archive.
+func writeSnapshot(w io.Writer, dir string, files []string, compress bool) error {
+	var (
+		err error
+		zw  *gzip.Writer
+		tw  *tar.Writer
+	)
+
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+
+	tw = tar.NewWriter(w)
+
+	for _, name := range files {
+		var (
+			fh   *os.File
+			info os.FileInfo
+			hdr  *tar.Header
+		)
+
+		if fh, err = os.Open(filepath.Join(dir, name)); err != nil {
+			return err
+		} else if info, err = fh.Stat(); err != nil {
+			fh.Close() // nolint: errcheck
+			return err
+		} else if hdr, err = tar.FileInfoHeader(info, ""); err != nil {
+			fh.Close() // nolint: errcheck
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(name)
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			fh.Close() // nolint: errcheck
+			return err
+		}
+
+		_, err = io.Copy(tw, fh)
+		fh.Close() // nolint: errcheck
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	} else if zw != nil {
+		return zw.Close()
+	}
+
+	return nil
+} // func writeSnapshot(w io.Writer, dir string, files []string, compress bool) error
+
+// readSnapshot extracts a snapshot to dir. It detects by itself if the
+// snapshot is compressed.
+func readSnapshot(r io.Reader, dir string) error {
+	var (
+		err   error
+		magic []byte
+		tr    *tar.Reader
+		main  bool
+		br    = bufio.NewReader(r)
+	)
+
+	if magic, err = br.Peek(2); err != nil {
+		return ErrInvalidSnapshot
+	} else if magic[0] == 0x1f && magic[1] == 0x8b {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(br); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+		}
+		defer zr.Close() // nolint: errcheck
+		tr = tar.NewReader(zr)
+	} else {
+		tr = tar.NewReader(br)
+	}
+
+	for {
+		var (
+			hdr *tar.Header
+			fh  *os.File
+		)
+
+		if hdr, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSnapshot, err.Error())
+		} else if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%w: unexpected entry %q", ErrInvalidSnapshot, hdr.Name)
+		} else if hdr.Name == snapshotMain {
+			main = true
+		} else if !snapshotPartPat.MatchString(hdr.Name) {
+			return fmt.Errorf("%w: unexpected file %q", ErrInvalidSnapshot, hdr.Name)
+		}
+
+		var fpath = filepath.Join(dir, filepath.FromSlash(hdr.Name))
+
+		if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return err
+		} else if fh, err = os.Create(fpath); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(fh, tr)
+		fh.Close() // nolint: errcheck
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !main {
+		return fmt.Errorf("%w: %s is missing", ErrInvalidSnapshot, snapshotMain)
+	}
+
+	return nil
+} // func readSnapshot(r io.Reader, dir string) error
+
+// snapshotVersion returns the schema version of the SQLite database at path.
+func snapshotVersion(path string) (int, error) {
+	var (
+		err     error
+		db      *sql.DB
+		version int
+	)
+
+	if db, err = sql.Open("sqlite3", path+"?mode=ro"); err != nil {
+		return 0, err
+	}
+
+	defer db.Close() // nolint: errcheck
+
+	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("%w: cannot read schema version of %s: %s",
+			ErrInvalidSnapshot,
+			filepath.Base(path),
+			err.Error())
+	}
+
+	return version, nil
+} // func snapshotVersion(path string) (int, error)
+
+// Restore replaces the database at dbPath, including its partitions, with
+// the snapshot read from r. Snapshots with a newer schema version than we
+// support are rejected, older ones are upgraded when the database is
+// opened the next time.
+//
+// The current database is not deleted, but moved to a folder next to it,
+// so a restore can be undone by hand.
+//
+// Restore must not be called while the database is in use, i.e. while
+// the server is running.
+func Restore(r io.Reader, dbPath string) error {
+	var (
+		err              error
+		version          int
+		dir, tmpDir, old string
+		parts            []os.DirEntry
+		exists           bool
+		l                *log.Logger
+		partDir          = filepath.Join(filepath.Dir(dbPath), snapshotPartDir)
+	)
+
+	dir = filepath.Dir(dbPath)
+
+	if l, err = common.GetLogger(logdomain.Database); err != nil {
+		return err
+	} else if tmpDir, err = os.MkdirTemp(dir, ".restore_"); err != nil {
+		l.Printf("[ERROR] Cannot create folder for restore: %s\n",
+			err.Error())
+		return err
+	}
+
+	defer os.RemoveAll(tmpDir) // nolint: errcheck
+
+	if err = readSnapshot(r, tmpDir); err != nil {
+		l.Printf("[ERROR] Cannot read snapshot: %s\n",
+			err.Error())
+		return err
+	} else if version, err = snapshotVersion(filepath.Join(tmpDir, snapshotMain)); err != nil {
+		l.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if version > schemaVersion {
+		err = fmt.Errorf("Snapshot has schema version %d, but we only support up to %d",
+			version,
+			schemaVersion)
+		l.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if parts, err = os.ReadDir(filepath.Join(tmpDir, snapshotPartDir)); err != nil && !os.IsNotExist(err) {
+		l.Printf("[ERROR] Cannot list partitions in snapshot: %s\n",
+			err.Error())
+		return err
+	}
+
+	for _, p := range parts {
+		if version, err = snapshotVersion(filepath.Join(tmpDir, snapshotPartDir, p.Name())); err != nil {
+			l.Printf("[ERROR] %s\n", err.Error())
+			return err
+		} else if version > partSchemaVersion {
+			err = fmt.Errorf("Partition %s in snapshot has schema version %d, but we only support up to %d",
+				p.Name(),
+				version,
+				partSchemaVersion)
+			l.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	// The snapshot looks good, so we move the current database out of
+	// the way.
+	old = filepath.Join(dir, "pre_restore_"+time.Now().Format("20060102_150405"))
+
+	if err = os.Mkdir(old, 0755); err != nil {
+		l.Printf("[ERROR] Cannot create folder for the current database: %s\n",
+			err.Error())
+		return err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if exists, err = krylib.Fexists(dbPath + suffix); err != nil {
+			return err
+		} else if exists {
+			if err = os.Rename(dbPath+suffix, filepath.Join(old, filepath.Base(dbPath)+suffix)); err != nil {
+				l.Printf("[ERROR] Cannot move %s out of the way: %s\n",
+					dbPath+suffix,
+					err.Error())
+				return err
+			}
+		}
+	}
+
+	if exists, err = krylib.Fexists(partDir); err != nil {
+		return err
+	} else if exists {
+		if err = os.Rename(partDir, filepath.Join(old, snapshotPartDir)); err != nil {
+			l.Printf("[ERROR] Cannot move %s out of the way: %s\n",
+				partDir,
+				err.Error())
+			return err
+		}
+	}
+
+	if err = os.Rename(filepath.Join(tmpDir, snapshotMain), dbPath); err != nil {
+		l.Printf("[ERROR] Cannot move restored database to %s: %s\n",
+			dbPath,
+			err.Error())
+		return err
+	} else if len(parts) > 0 {
+		if err = os.Rename(filepath.Join(tmpDir, snapshotPartDir), partDir); err != nil {
+			l.Printf("[ERROR] Cannot move restored partitions to %s: %s\n",
+				partDir,
+				err.Error())
+			return err
+		}
+	}
+
+	l.Printf("[INFO] Restored database %s with %d partitions. The previous database was moved to %s\n",
+		dbPath,
+		len(parts),
+		old)
+
+	return nil
+} // func Restore(r io.Reader, dbPath string) error
+
+// SnapshotName returns a file name for a snapshot taken at the given time.
+func SnapshotName(t time.Time, compress bool) string {
+	var name = strings.ToLower(common.AppName) + "_" + t.Format("20060102_150405") + ".tar"
+
+	if compress {
+		name += ".gz"
+	}
+
+	return name
+} // func SnapshotName(t time.Time, compress bool) string
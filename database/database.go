@@ -2,18 +2,23 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-13 18:09:09 krylon>
+// Time-stamp: <2024-10-13 10:48:27 krylon>
 
 package database
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -81,6 +86,10 @@ type Database struct {
 	spNameCounter int
 	spNameCache   map[string]string
 	queries       map[query.ID]*sql.Stmt
+	partDir       string
+	parts         map[int64]*partition
+	txParts       []int64
+	legacy        *partition
 }
 
 // Open opens a Database. If the database specified by the path does not exist,
@@ -94,6 +103,8 @@ func Open(path string) (*Database, error) {
 			spNameCounter: 1,
 			spNameCache:   make(map[string]string),
 			queries:       make(map[query.ID]*sql.Stmt),
+			partDir:       filepath.Join(filepath.Dir(path), "partitions"),
+			parts:         make(map[int64]*partition),
 		}
 	)
 
@@ -139,6 +150,12 @@ func Open(path string) (*Database, error) {
 		}
 		db.log.Printf("[INFO] Database at %s has been initialized\n",
 			path)
+	} else if err = db.migrate(); err != nil {
+		db.db.Close() // nolint: errcheck
+		return nil, err
+	} else if err = db.legacyCheck(); err != nil {
+		db.db.Close() // nolint: errcheck
+		return nil, err
 	}
 
 	return db, nil
@@ -159,7 +176,7 @@ func (db *Database) initialize() error {
 		return err
 	}
 
-	for _, q := range qInit {
+	for _, q := range append(qInit, fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)) {
 		db.log.Printf("[TRACE] Execute init query:\n%s\n",
 			q)
 		if _, err = tx.Exec(q); err != nil {
@@ -184,6 +201,107 @@ func (db *Database) initialize() error {
 	return nil
 } // func (db *Database) initialize() error
 
+// migrate upgrades the schema of an existing database to the current
+// version, if necessary.
+func (db *Database) migrate() error {
+	var (
+		err     error
+		tx      *sql.Tx
+		version int
+	)
+
+	if err = db.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.log.Printf("[ERROR] Cannot query schema version of %s: %s\n",
+			db.path,
+			err.Error())
+		return err
+	} else if version == schemaVersion {
+		return nil
+	} else if version > schemaVersion {
+		err = fmt.Errorf("Database %s has schema version %d, but we only support up to %d",
+			db.path,
+			version,
+			schemaVersion)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	db.log.Printf("[INFO] Upgrade database %s from schema version %d to %d\n",
+		db.path,
+		version,
+		schemaVersion)
+
+	if tx, err = db.db.Begin(); err != nil {
+		db.log.Printf("[ERROR] Cannot begin transaction: %s\n",
+			err.Error())
+		return err
+	}
+
+	for v := version; v < schemaVersion; v++ {
+		for _, q := range qMigrate[v] {
+			if _, err = tx.Exec(q); err != nil {
+				db.log.Printf("[ERROR] Cannot execute migration query (%d -> %d): %s\n%s\n",
+					v,
+					v+1,
+					err.Error(),
+					q)
+				if rbErr := tx.Rollback(); rbErr != nil {
+					db.log.Printf("[CANTHAPPEN] Cannot rollback transaction: %s\n",
+						rbErr.Error())
+					return rbErr
+				}
+				return err
+			}
+		}
+	}
+
+	if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		db.log.Printf("[ERROR] Cannot set schema version: %s\n",
+			err.Error())
+		tx.Rollback() // nolint: errcheck
+		return err
+	} else if err = tx.Commit(); err != nil {
+		db.log.Printf("[CANTHAPPEN] Failed to commit migration transaction: %s\n",
+			err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) migrate() error
+
+// legacyCheck looks for a record table in the main database file, left over
+// from before Records were stored in partitions. If there is one, it is
+// treated as a partition that covers all of time.
+func (db *Database) legacyCheck() error {
+	var (
+		err error
+		cnt int64
+	)
+
+	if err = db.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'record'").Scan(&cnt); err != nil {
+		db.log.Printf("[ERROR] Cannot check for legacy record table: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		return nil
+	}
+
+	db.legacy = &partition{
+		Partition: Partition{
+			Name:  "legacy",
+			Begin: periodMin,
+			End:   periodMax,
+			Path:  db.path,
+		},
+		legacy:  true,
+		db:      db.db,
+		queries: make(map[query.ID]*sql.Stmt),
+		lastUse: time.Now(),
+	}
+
+	return nil
+} // func (db *Database) legacyCheck() error
+
 // Close closes the database.
 // If there is a pending transaction, it is rolled back.
 func (db *Database) Close() error {
@@ -200,6 +318,16 @@ func (db *Database) Close() error {
 		db.tx = nil
 	}
 
+	db.partitionFinishTx(false) // nolint: errcheck
+
+	for _, p := range db.parts {
+		db.partitionClose(p)
+	}
+
+	if db.legacy != nil {
+		db.partitionClose(db.legacy)
+	}
+
 	for key, stmt := range db.queries {
 		if err = stmt.Close(); err != nil {
 			db.log.Printf("[CRITICAL] Cannot close statement handle %s: %s\n",
@@ -253,6 +381,98 @@ PREPARE_QUERY:
 	return stmt, nil
 } // func (db *Database) getQuery(query.ID) (*sql.Stmt, error)
 
+// adHoc runs fn with the statement for the given query. If no transaction
+// is in progress, it runs in a transaction of its own, which is committed
+// if fn returns nil. If fn fails with an error that is worth a retry, it is
+// run again.
+func (db *Database) adHoc(qid query.ID, fn func(stmt *sql.Stmt) error) error {
+	var (
+		err    error
+		stmt   *sql.Stmt
+		tx     *sql.Tx
+		status bool
+	)
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid.String(),
+			err.Error())
+		return err
+	} else if db.tx != nil {
+		tx = db.tx
+	} else {
+	BEGIN_AD_HOC:
+		if tx, err = db.db.Begin(); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto BEGIN_AD_HOC
+			}
+
+			err = fmt.Errorf("Error starting transaction: %w", err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = tx.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+						err2.Error())
+				}
+			} else if err2 = tx.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+					err2.Error())
+			}
+		}()
+	}
+
+	stmt = tx.Stmt(stmt)
+
+EXEC_QUERY:
+	if err = fn(stmt); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		return err
+	}
+
+	status = true
+	return nil
+} // func (db *Database) adHoc(qid query.ID, fn func(stmt *sql.Stmt) error) error
+
+// queryRows runs a query that only reads from the database.
+func (db *Database) queryRows(qid query.ID, args ...any) (*sql.Rows, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+EXEC_QUERY:
+	if rows, err = stmt.Query(args...); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		return nil, err
+	}
+
+	return rows, nil
+} // func (db *Database) queryRows(qid query.ID, args ...any) (*sql.Rows, error)
+
 func (db *Database) resetSPNamespace() {
 	db.spNameCounter = 1
 	db.spNameCache = make(map[string]string)
@@ -515,6 +735,11 @@ func (db *Database) Rollback() error {
 
 	if db.tx == nil {
 		return ErrNoTxInProgress
+	} else if err = db.partitionFinishTx(false); err != nil {
+		db.tx.Rollback() // nolint: errcheck
+		db.tx = nil
+		return fmt.Errorf("Cannot roll back partition transaction: %s",
+			err.Error())
 	} else if err = db.tx.Rollback(); err != nil {
 		return fmt.Errorf("Cannot roll back database transaction: %s",
 			err.Error())
@@ -537,6 +762,13 @@ func (db *Database) Commit() error {
 
 	if db.tx == nil {
 		return ErrNoTxInProgress
+	} else if err = db.partitionFinishTx(true); err != nil {
+		// Whatever has been committed to the partitions is beyond our
+		// reach now, but at least the main database stays consistent.
+		db.tx.Rollback() // nolint: errcheck
+		db.tx = nil
+		return fmt.Errorf("Cannot commit partition transaction: %s",
+			err.Error())
 	} else if err = db.tx.Commit(); err != nil {
 		return fmt.Errorf("Cannot commit transaction: %s",
 			err.Error())
@@ -669,11 +901,11 @@ EXEC_QUERY:
 
 	if rows.Next() {
 		var (
-			timestamp int64
-			h         = &model.Host{Name: name}
+			timestamp, lastRecord, threshold int64
+			h                                = &model.Host{Name: name}
 		)
 
-		if err = rows.Scan(&h.ID, &timestamp); err != nil {
+		if err = rows.Scan(&h.ID, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
 			msg = fmt.Sprintf("Error scanning row for Host %s: %s",
 				name,
 				err.Error())
@@ -681,7 +913,7 @@ EXEC_QUERY:
 			return nil, errors.New(msg)
 		}
 
-		h.LastSeen = time.Unix(timestamp, 0)
+		SetHostStamps(h, timestamp, lastRecord, threshold)
 		return h, nil
 	}
 
@@ -723,11 +955,11 @@ EXEC_QUERY:
 
 	if rows.Next() {
 		var (
-			timestamp int64
-			h         = &model.Host{ID: id}
+			timestamp, lastRecord, threshold int64
+			h                                = &model.Host{ID: id}
 		)
 
-		if err = rows.Scan(&h.Name, &timestamp); err != nil {
+		if err = rows.Scan(&h.Name, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
 			msg = fmt.Sprintf("Error scanning row for Host %d: %s",
 				id,
 				err.Error())
@@ -735,7 +967,7 @@ EXEC_QUERY:
 			return nil, errors.New(msg)
 		}
 
-		h.LastSeen = time.Unix(timestamp, 0)
+		SetHostStamps(h, timestamp, lastRecord, threshold)
 		return h, nil
 	}
 
@@ -779,17 +1011,17 @@ EXEC_QUERY:
 
 	for rows.Next() {
 		var (
-			h         model.Host
-			timestamp int64
+			h                                model.Host
+			timestamp, lastRecord, threshold int64
 		)
 
-		if err = rows.Scan(&h.ID, &h.Name, &timestamp); err != nil {
+		if err = rows.Scan(&h.ID, &h.Name, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
 			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
 			db.log.Printf("[ERROR] %s\n", msg)
 			return nil, errors.New(msg)
 		}
 
-		h.LastSeen = time.Unix(timestamp, 0)
+		SetHostStamps(&h, timestamp, lastRecord, threshold)
 		hosts = append(hosts, h)
 	}
 
@@ -867,27 +1099,37 @@ EXEC_QUERY:
 } // func (db *Database) HostUpdateLastSeen(h *model.Host, timestamp time.Time) error
 
 // RecordAdd adds a new Record to the Database.
+// The Record is stored in the partition that covers its timestamp, which
+// is created if it does not exist, yet.
 func (db *Database) RecordAdd(r *model.Record) error {
 	const qid query.ID = query.RecordAdd
 	var (
 		err    error
 		msg    string
+		p      *partition
 		stmt   *sql.Stmt
 		tx     *sql.Tx
 		status bool
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
+	if p, err = db.partitionForTime(r.Time, true); err != nil {
+		db.log.Printf("[ERROR] Cannot get partition for %s: %s\n",
+			r.Time.Format(common.TimestampFormat),
+			err.Error())
+		return err
+	} else if stmt, err = db.partitionStmt(p, qid); err != nil {
 		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
 			qid.String(),
 			err.Error())
 		return err
 	} else if db.tx != nil {
-		tx = db.tx
+		if tx, err = db.partitionTx(p); err != nil {
+			return err
+		}
 	} else {
 		db.log.Println("[INFO] Start ad-hoc transaction for adding Record.")
 	BEGIN_AD_HOC:
-		if tx, err = db.db.Begin(); err != nil {
+		if tx, err = p.db.Begin(); err != nil {
 			if worthARetry(err) {
 				waitForRetry()
 				goto BEGIN_AD_HOC
@@ -906,19 +1148,49 @@ func (db *Database) RecordAdd(r *model.Record) error {
 						db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
 							err2.Error())
 					}
-				} else if err2 = tx.Rollback(); err2 != nil {
-					db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
-						err2.Error())
+				} else {
+					if err2 = tx.Rollback(); err2 != nil {
+						db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+							err2.Error())
+					}
+					p.clearCache()
 				}
 			}()
 		}
 	}
 
+	var (
+		srcID, tmplID     int64
+		srcStmt, tmplStmt *sql.Stmt
+		params            sql.NullString
+		tmpl, plist       = model.SplitMessage(r.Message)
+	)
+
+	if len(plist) > 0 {
+		var buf []byte
+		if buf, err = json.Marshal(plist); err != nil {
+			db.log.Printf("[ERROR] Cannot serialize parameters of Record: %s\n",
+				err.Error())
+			return err
+		}
+		params = sql.NullString{String: string(buf), Valid: true}
+	}
+
+	if srcStmt, err = db.partitionStmt(p, query.SourceGetOrAdd); err != nil {
+		return err
+	} else if tmplStmt, err = db.partitionStmt(p, query.TemplateGetOrAdd); err != nil {
+		return err
+	} else if srcID, err = db.partitionLookupID(p, query.SourceGetOrAdd, tx.Stmt(srcStmt), r.Source); err != nil {
+		return err
+	} else if tmplID, err = db.partitionLookupID(p, query.TemplateGetOrAdd, tx.Stmt(tmplStmt), tmpl); err != nil {
+		return err
+	}
+
 	stmt = tx.Stmt(stmt)
 	var rows *sql.Rows
 
 EXEC_QUERY:
-	if rows, err = stmt.Query(r.HostID, r.Time.Unix(), r.Source, r.Message, r.Checksum()); err != nil {
+	if rows, err = stmt.Query(p.ID<<partitionIDShift, r.HostID, r.Time.Unix(), srcID, tmplID, params, r.Checksum()); err != nil {
 		if worthARetry(err) {
 			waitForRetry()
 			goto EXEC_QUERY
@@ -954,52 +1226,36 @@ EXEC_QUERY:
 
 // RecordGetByHost fetches the <max> most recent records for a given Host.
 func (db *Database) RecordGetByHost(h *model.Host, max int64) ([]model.Record, error) {
-	const qid query.ID = query.RecordGetByHost
 	var (
-		err  error
-		msg  string
-		stmt *sql.Stmt
+		err     error
+		parts   []Partition
+		records = make([]model.Record, 0)
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
-		return nil, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
-	}
-
-	var rows *sql.Rows
-
-EXEC_QUERY:
-	if rows, err = stmt.Query(h.ID, max); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
-		}
-
+	if parts, err = db.partitionsAll(); err != nil {
 		return nil, err
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
-
-	var records = make([]model.Record, 0)
-
-	for rows.Next() {
+	// Start with the most recent partition and stop as soon as we have
+	// enough Records.
+	for i := len(parts) - 1; i >= 0 && (max < 0 || int64(len(records)) < max); i-- {
 		var (
-			r         = model.Record{HostID: h.ID}
-			timestamp int64
+			p    *partition
+			recs []model.Record
+			lim  = max
 		)
 
-		if err = rows.Scan(&r.ID, &timestamp, &r.Source, &r.Message); err != nil {
-			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
-			db.log.Printf("[ERROR] %s\n", msg)
-			return nil, errors.New(msg)
+		if max >= 0 {
+			lim = max - int64(len(records))
+		}
+
+		if p, err = db.partitionOpen(parts[i]); err != nil {
+			return nil, err
+		} else if recs, err = db.partitionRecords(p, query.RecordGetByHost, h.ID, lim); err != nil {
+			return nil, err
 		}
 
-		r.Time = time.Unix(timestamp, 0)
-		records = append(records, r)
+		records = append(records, recs...)
 	}
 
 	//slices.Reverse(records)
@@ -1009,54 +1265,34 @@ EXEC_QUERY:
 
 // RecordGetByPeriod fetches all records for the given period, ordered by their timestamps.
 func (db *Database) RecordGetByPeriod(begin, end time.Time) ([]model.Record, error) {
-	const qid query.ID = query.RecordGetByPeriod
 	var (
-		err  error
-		msg  string
-		stmt *sql.Stmt
+		err     error
+		parts   []Partition
+		records = make([]model.Record, 0)
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
-		return nil, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
-	}
-
-	var rows *sql.Rows
-
-EXEC_QUERY:
-	if rows, err = stmt.Query(begin.Unix(), end.Unix()); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
-		}
-
+	if parts, err = db.partitionsForPeriod(begin, end); err != nil {
 		return nil, err
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
-
-	var records = make([]model.Record, 0)
-
-	for rows.Next() {
+	for _, meta := range parts {
 		var (
-			r         model.Record
-			timestamp int64
+			p    *partition
+			recs []model.Record
 		)
 
-		if err = rows.Scan(&r.ID, &timestamp, &r.Source, &r.Message); err != nil {
-			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
-			db.log.Printf("[ERROR] %s\n", msg)
-			return nil, errors.New(msg)
+		if p, err = db.partitionOpen(meta); err != nil {
+			return nil, err
+		} else if recs, err = db.partitionRecords(p, query.RecordGetByPeriod, begin.Unix(), end.Unix()); err != nil {
+			return nil, err
 		}
 
-		r.Time = time.Unix(timestamp, 0)
-		records = append(records, r)
+		records = append(records, recs...)
 	}
 
+	// The legacy record table may overlap with the other partitions.
+	sort.Stable(model.RecordSlice(records))
+
 	return records, nil
 } // func (db *Database) RecordGetByPeriod(begin, end time.Time) ([]model.Record, error)
 
@@ -1066,154 +1302,137 @@ func (db *Database) RecordGetMostRecent(hostID int64) (time.Time, error) {
 	var (
 		err   error
 		msg   string
-		stmt  *sql.Stmt
+		parts []Partition
 		stamp time.Time
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
+	if parts, err = db.partitionsAll(); err != nil {
 		return stamp, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
 	}
 
-	var rows *sql.Rows
+	for i := len(parts) - 1; i >= 0; i-- {
+		var (
+			p       *partition
+			stmt    *sql.Stmt
+			seconds int64
+		)
 
-EXEC_QUERY:
-	if rows, err = stmt.Query(hostID); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
+		if p, err = db.partitionOpen(parts[i]); err != nil {
+			return stamp, err
+		} else if stmt, err = db.partitionGetStmt(p, qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid,
+				err.Error())
+			return stamp, err
 		}
 
-		return stamp, err
-	}
-
-	defer rows.Close() // nolint: errcheck
-
-	if !rows.Next() {
-		msg = fmt.Sprintf("No records for Host %d", hostID)
-		db.log.Printf("[INFO] %s\n", msg)
-		return stamp, errors.New(msg)
-	}
-
-	var seconds int64
+	EXEC_QUERY:
+		if err = stmt.QueryRow(hostID).Scan(&seconds); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			}
 
-	if err = rows.Scan(&seconds); err != nil {
-		msg = fmt.Sprintf("Failed to extract timestamp (INTEGER) from database: %s",
-			err.Error())
-		db.log.Printf("[ERROR] %s\n", msg)
-		return stamp, errors.New(msg)
+			msg = fmt.Sprintf("Failed to extract timestamp (INTEGER) from database: %s",
+				err.Error())
+			db.log.Printf("[ERROR] %s\n", msg)
+			return stamp, errors.New(msg)
+		} else if seconds != 0 {
+			stamp = time.Unix(seconds, 0)
+			break
+		}
 	}
 
-	stamp = time.Unix(seconds, 0)
 	return stamp, nil
 } // func (db *Database) RecordGetMostRecent(hostID int64) (time.Time, error)
 
-// RecordCheckExist returns true if a record with the given checksum exists in the database
-func (db *Database) RecordCheckExist(cksum string) (bool, error) {
+// RecordCheckExist returns true if the given Record already exists in the database.
+// Since the checksum of a Record includes its timestamp, we only need to
+// look at the partition that covers the Record's timestamp.
+func (db *Database) RecordCheckExist(r *model.Record) (bool, error) {
 	const qid query.ID = query.RecordCheckExist
 	var (
 		err   error
 		msg   string
-		stmt  *sql.Stmt
-		exist bool
+		p     *partition
+		cksum = r.Checksum()
+		parts = make([]*partition, 0, 2)
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
-		return exist, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
+	if p, err = db.partitionForTime(r.Time, false); err != nil {
+		return false, err
+	} else if p != nil {
+		parts = append(parts, p)
 	}
 
-	var rows *sql.Rows
+	if db.legacy != nil {
+		parts = append(parts, db.legacy)
+	}
 
-EXEC_QUERY:
-	if rows, err = stmt.Query(cksum); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
-		}
-
-		return exist, err
-	}
-
-	defer rows.Close() // nolint: errcheck
+	for _, p = range parts {
+		var (
+			stmt *sql.Stmt
+			cnt  int64
+		)
 
-	if !rows.Next() {
-		// CANTHAPPEN
-		msg = fmt.Sprintf("No records for Checksum %s", cksum)
-		db.log.Printf("[CANTHAPPEN] %s\n", msg)
-		return false, errors.New(msg)
-	}
+		if stmt, err = db.partitionGetStmt(p, qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid,
+				err.Error())
+			return false, err
+		}
 
-	var cnt int64
+	EXEC_QUERY:
+		if err = stmt.QueryRow(cksum).Scan(&cnt); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			}
 
-	if err = rows.Scan(&cnt); err != nil {
-		msg = fmt.Sprintf("Failed to extract timestamp (INTEGER) from database: %s",
-			err.Error())
-		db.log.Printf("[ERROR] %s\n", msg)
-		return exist, errors.New(msg)
+			msg = fmt.Sprintf("Failed to check for Record with checksum %s: %s",
+				cksum,
+				err.Error())
+			db.log.Printf("[ERROR] %s\n", msg)
+			return false, errors.New(msg)
+		} else if cnt > 0 {
+			return true, nil
+		}
 	}
 
-	exist = cnt > 0
-	return exist, nil
-} // func (db *Database) RecordCheckExist(cksum string) (bool, error)
+	return false, nil
+} // func (db *Database) RecordCheckExist(r *model.Record) (bool, error)
 
 // RecordGetRecent fetches the <max> most recent Records from the database.
 // A negative number returns ALL records, which should probably be avoided.
 func (db *Database) RecordGetRecent(max int64) ([]model.Record, error) {
-	const qid query.ID = query.RecordGetRecent
 	var (
-		err  error
-		msg  string
-		stmt *sql.Stmt
+		err     error
+		parts   []Partition
+		records = make([]model.Record, 0)
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
-		return nil, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
-	}
-
-	var rows *sql.Rows
-
-EXEC_QUERY:
-	if rows, err = stmt.Query(max); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
-		}
-
+	if parts, err = db.partitionsAll(); err != nil {
 		return nil, err
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
-
-	var records = make([]model.Record, 0)
-
-	for rows.Next() {
+	for i := len(parts) - 1; i >= 0 && (max < 0 || int64(len(records)) < max); i-- {
 		var (
-			r         model.Record
-			timestamp int64
+			p    *partition
+			recs []model.Record
+			lim  = max
 		)
 
-		if err = rows.Scan(&r.ID, &r.HostID, &timestamp, &r.Source, &r.Message); err != nil {
-			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
-			db.log.Printf("[ERROR] %s\n", msg)
-			return nil, errors.New(msg)
+		if max >= 0 {
+			lim = max - int64(len(records))
 		}
 
-		r.Time = time.Unix(timestamp, 0)
-		records = append(records, r)
+		if p, err = db.partitionOpen(parts[i]); err != nil {
+			return nil, err
+		} else if recs, err = db.partitionRecords(p, query.RecordGetRecent, lim); err != nil {
+			return nil, err
+		}
+
+		records = append(records, recs...)
 	}
 
 	return records, nil
@@ -1224,106 +1443,481 @@ EXEC_QUERY:
 func (db *Database) RecordGetSources() (map[string]int64, error) {
 	const qid query.ID = query.RecordGetSources
 	var (
-		err  error
-		msg  string
-		stmt *sql.Stmt
+		err     error
+		msg     string
+		parts   []Partition
+		sources = make(map[string]int64)
 	)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
-			err.Error())
+	if parts, err = db.partitionsAll(); err != nil {
 		return nil, err
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
 	}
 
-	var rows *sql.Rows
+	for _, meta := range parts {
+		var (
+			p    *partition
+			stmt *sql.Stmt
+			rows *sql.Rows
+		)
 
-EXEC_QUERY:
-	if rows, err = stmt.Query(); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
+		if p, err = db.partitionOpen(meta); err != nil {
+			return nil, err
+		} else if stmt, err = db.partitionGetStmt(p, qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid,
+				err.Error())
+			return nil, err
 		}
 
-		return nil, err
+	EXEC_QUERY:
+		if rows, err = stmt.Query(); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			}
+
+			return nil, err
+		}
+
+		for rows.Next() {
+			var (
+				src string
+				cnt int64
+			)
+
+			if err = rows.Scan(&src, &cnt); err != nil {
+				rows.Close() // nolint: errcheck,gosec
+				msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
+				db.log.Printf("[ERROR] %s\n", msg)
+				return nil, errors.New(msg)
+			}
+
+			sources[src] += cnt
+		}
+
+		rows.Close() // nolint: errcheck,gosec
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
+	return sources, nil
+} // func (db *Database) RecordGetSources() (map[string]int64, error)
+
+type rateKey struct {
+	host   int64
+	source string
+	period int64
+}
 
-	var sources = make(map[string]int64)
+// RecordGetRates returns the number of Records each Host logged from each
+// source per period of the given width between begin and end. The periods
+// start at begin.
+func (db *Database) RecordGetRates(begin, end time.Time, width time.Duration) ([]model.RateCount, error) {
+	const qid query.ID = query.RecordGetRates
+	var (
+		err    error
+		parts  []Partition
+		counts = make(map[rateKey]int64)
+		secs   = int64(width / time.Second)
+	)
 
-	for rows.Next() {
+	if secs < 1 {
+		return nil, fmt.Errorf("Invalid width for counting Records: %s", width)
+	} else if parts, err = db.partitionsForPeriod(begin, end); err != nil {
+		return nil, err
+	}
+
+	// A period may span two partitions, so we add up the counts before
+	// returning them.
+	for _, meta := range parts {
 		var (
-			src string
-			cnt int64
+			p    *partition
+			stmt *sql.Stmt
+			rows *sql.Rows
 		)
 
-		if err = rows.Scan(&src, &cnt); err != nil {
-			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
-			db.log.Printf("[ERROR] %s\n", msg)
-			return nil, errors.New(msg)
+		if p, err = db.partitionOpen(meta); err != nil {
+			return nil, err
+		} else if stmt, err = db.partitionGetStmt(p, qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid,
+				err.Error())
+			return nil, err
+		}
+
+	EXEC_QUERY:
+		if rows, err = stmt.Query(begin.Unix(), end.Unix(), secs); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			}
+
+			return nil, err
 		}
 
-		sources[src] = cnt
+		for rows.Next() {
+			var (
+				key rateKey
+				cnt int64
+			)
+
+			if err = rows.Scan(&key.host, &key.source, &key.period, &cnt); err != nil {
+				rows.Close() // nolint: errcheck,gosec
+				err = fmt.Errorf("Failed to scan row: %w", err)
+				db.log.Printf("[ERROR] %s\n", err.Error())
+				return nil, err
+			}
+
+			counts[key] += cnt
+		}
+
+		rows.Close() // nolint: errcheck,gosec
 	}
 
-	return sources, nil
-} // func (db *Database) RecordGetSources() (map[string]int64, error)
+	var list = make([]model.RateCount, 0, len(counts))
+
+	for key, cnt := range counts {
+		list = append(list, model.RateCount{
+			HostID: key.host,
+			Source: key.source,
+			Begin:  time.Unix(key.period, 0),
+			Count:  cnt,
+		})
+	}
+
+	return list, nil
+} // func (db *Database) RecordGetRates(begin, end time.Time, width time.Duration) ([]model.RateCount, error)
 
-// RecordSearch searches ALL Records in the database according to the query.
-func (db *Database) RecordSearch(search *model.SearchQuery, q chan<- model.Record) {
-	const qid query.ID = query.RecordGetRecent
+// RecordSearch searches the Records in the database according to the query.
+// If the query specifies a Period, only the partitions overlapping that
+// Period are searched, otherwise ALL Records are.
+// Matching Records are sent to the channel, most recent first. If the
+// search fails, the error is recorded in prog.
+func (db *Database) RecordSearch(ctx context.Context, search *model.SearchQuery, q chan<- model.Record, prog *SearchProgress) {
+	const qid query.ID = query.RecordScan
 	var (
-		err  error
-		msg  string
-		stmt *sql.Stmt
+		err            error
+		msg            string
+		parts          []Partition
+		open           []*partition
+		begin, end     int64
+		hosts, sources sql.NullString
 	)
 
 	defer close(q)
 
-	if stmt, err = db.getQuery(qid); err != nil {
-		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
-			qid,
+	if prog == nil {
+		prog = new(SearchProgress)
+	}
+
+	// If the search fails, the caller needs to know, or it would take the
+	// Records it got so far for all there is.
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			prog.Fail(err)
+		}
+	}()
+
+	if err = CompileSearch(db, search); err != nil {
+		db.log.Printf("[ERROR] Cannot compile search query %q: %s\n",
+			search.Query,
 			err.Error())
 		return
-	} else if db.tx != nil {
-		stmt = db.tx.Stmt(stmt)
 	}
 
-	var rows *sql.Rows
-
-EXEC_QUERY:
-	if rows, err = stmt.Query(-1); err != nil {
-		if worthARetry(err) {
-			waitForRetry()
-			goto EXEC_QUERY
-		}
+	// Restrictions on the time, Hosts, and sources are handled by the
+	// database, the rest is up to SearchQuery.Match.
+	begin, end, hosts, sources = ScanParams(search)
 
+	if parts, err = db.partitionsForPeriod(time.Unix(begin, 0), time.Unix(end, 0)); err != nil {
+		db.log.Printf("[ERROR] Cannot look up partitions for search: %s\n",
+			err.Error())
 		return
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
+	open = make([]*partition, len(parts))
 
-	for rows.Next() {
+	// Counting the candidates first is a lot cheaper than the scan itself,
+	// because it only needs the indices, and it lets us tell the user
+	// how long the search is going to take.
+	for i := range parts {
 		var (
-			r         model.Record
-			timestamp int64
+			p    *partition
+			stmt *sql.Stmt
+			cnt  int64
 		)
 
-		if err = rows.Scan(&r.ID, &r.HostID, &timestamp, &r.Source, &r.Message); err != nil {
-			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
-			db.log.Printf("[ERROR] %s\n", msg)
+		if p, err = db.partitionOpen(parts[i]); err != nil {
+			return
+		} else if stmt, err = db.partitionGetStmt(p, query.RecordScanCount); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				query.RecordScanCount,
+				err.Error())
+			return
+		} else if err = stmt.QueryRowContext(ctx, begin, end, hosts, sources).Scan(&cnt); err != nil {
+			db.log.Printf("[ERROR] Cannot count Records in partition %s: %s\n",
+				parts[i].Name,
+				err.Error())
+			return
+		}
+
+		open[i] = p
+		prog.Total.Add(cnt)
+	}
+
+	// The legacy record table comes first, so we search it last. Its
+	// Records may be out of order relative to the other partitions, but
+	// there is nothing we can do about that without buffering everything.
+	for i := len(open) - 1; i >= 0; i-- {
+		var (
+			stmt *sql.Stmt
+			rows *sql.Rows
+		)
+
+		if stmt, err = db.partitionGetStmt(open[i], qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid,
+				err.Error())
+			return
+		}
+
+	EXEC_QUERY:
+		if rows, err = stmt.QueryContext(ctx, begin, end, hosts, sources); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			} else if ctx.Err() == nil {
+				db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+					qid,
+					err.Error())
+			}
+
+			return
+		}
+
+		for rows.Next() {
+			var r model.Record
+
+			if err = scanRecord(rows, &r); err != nil {
+				rows.Close() // nolint: errcheck,gosec
+				msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
+				db.log.Printf("[ERROR] %s\n", msg)
+				return
+			}
+
+			prog.Scanned.Add(1)
+
+			if search.Match(&r) {
+				prog.Matched.Add(1)
+
+				select {
+				case q <- r:
+				case <-ctx.Done():
+					rows.Close() // nolint: errcheck,gosec
+					return
+				}
+			}
+		}
+
+		if err = rows.Err(); err != nil && ctx.Err() == nil {
+			rows.Close() // nolint: errcheck,gosec
+			db.log.Printf("[ERROR] Failed to read Records from partition %s: %s\n",
+				open[i].Name,
+				err.Error())
+			return
+		}
+
+		rows.Close() // nolint: errcheck,gosec
+
+		if ctx.Err() != nil {
+			db.log.Printf("[INFO] Search was cancelled after %d of %d Records\n",
+				prog.Scanned.Load(),
+				prog.Total.Load())
 			return
 		}
+	}
+} // func (db *Database) RecordSearch(ctx context.Context, search *model.SearchQuery, q chan<- model.Record, prog *SearchProgress)
+
+// RecordGetByIDList fetches the Records with the given IDs, most recent first.
+// IDs that do not exist (e.g. because their partition was dropped) are
+// silently ignored.
+func (db *Database) RecordGetByIDList(ids []int64) ([]model.Record, error) {
+	var (
+		err     error
+		byPart  = make(map[int64][]int64)
+		records = make([]model.Record, 0, len(ids))
+	)
+
+	for _, id := range ids {
+		var pid = partitionOfRecord(id)
+		byPart[pid] = append(byPart[pid], id)
+	}
+
+	for pid, list := range byPart {
+		var (
+			p    *partition
+			recs []model.Record
+			raw  []byte
+		)
+
+		if p, err = db.partitionByID(pid); err != nil {
+			return nil, err
+		} else if p == nil {
+			db.log.Printf("[INFO] Partition %d does not exist (anymore), skipping %d Records\n",
+				pid,
+				len(list))
+			continue
+		} else if raw, err = json.Marshal(list); err != nil {
+			db.log.Printf("[ERROR] Cannot serialize list of IDs: %s\n",
+				err.Error())
+			return nil, err
+		} else if recs, err = db.partitionRecords(p, query.RecordGetByIDList, string(raw)); err != nil {
+			return nil, err
+		}
+
+		records = append(records, recs...)
+	}
+
+	sort.Stable(sort.Reverse(model.RecordSlice(records)))
+
+	return records, nil
+} // func (db *Database) RecordGetByIDList(ids []int64) ([]model.Record, error)
+
+// RecordGetContext returns the Record with the given ID, along with up to
+// <before> Records its Host logged before it and up to <after> Records it
+// logged after it, in chronological order. If sameSource is true, only
+// Records from the same source are included.
+// If there is no Record with the given ID, it returns nil.
+func (db *Database) RecordGetContext(id, before, after int64, sameSource bool) ([]model.Record, error) {
+	var (
+		err        error
+		list       []model.Record
+		prev, next []model.Record
+		parts      []Partition
+		src        sql.NullString
+		r          *model.Record
+		records    []model.Record
+	)
+
+	if list, err = db.RecordGetByIDList([]int64{id}); err != nil {
+		return nil, err
+	} else if len(list) == 0 {
+		return nil, nil
+	}
+
+	r = &list[0]
+
+	if sameSource {
+		src = sql.NullString{String: r.Source, Valid: true}
+	}
+
+	// Going backwards, we start with the partition the Record is in.
+	if parts, err = db.partitionsForPeriod(periodMin, r.Time); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(parts)
+
+	if prev, err = db.recordNeighbours(parts, query.RecordGetBefore, before, r.HostID, r.Time.Unix(), r.ID, src, before); err != nil {
+		return nil, err
+	} else if parts, err = db.partitionsForPeriod(r.Time, periodMax); err != nil {
+		return nil, err
+	} else if next, err = db.recordNeighbours(parts, query.RecordGetAfter, after, r.HostID, r.Time.Unix(), r.ID, src, after); err != nil {
+		return nil, err
+	}
+
+	if len(prev) > int(before) {
+		prev = prev[len(prev)-int(before):]
+	}
+
+	if len(next) > int(after) {
+		next = next[:after]
+	}
+
+	records = make([]model.Record, 0, len(prev)+len(next)+1)
+	records = append(records, prev...)
+	records = append(records, *r)
+	records = append(records, next...)
+
+	return records, nil
+} // func (db *Database) RecordGetContext(id, before, after int64, sameSource bool) ([]model.Record, error)
+
+// recordNeighbours runs one of the queries that look for the Records next
+// to a position in the log on the given partitions, in order, until it has
+// found <cnt> of them. The result is sorted chronologically, but it may
+// contain more Records than requested.
+func (db *Database) recordNeighbours(parts []Partition, qid query.ID, cnt int64, args ...any) ([]model.Record, error) {
+	var (
+		err     error
+		records = make([]model.Record, 0, cnt)
+	)
+
+	for _, meta := range parts {
+		var (
+			p    *partition
+			recs []model.Record
+		)
+
+		// The legacy record table may overlap with the other
+		// partitions, so we cannot skip it.
+		if int64(len(records)) >= cnt && meta.ID != 0 {
+			continue
+		} else if p, err = db.partitionOpen(meta); err != nil {
+			return nil, err
+		} else if recs, err = db.partitionRecords(p, qid, args...); err != nil {
+			return nil, err
+		}
+
+		records = append(records, recs...)
+	}
 
-		r.Time = time.Unix(timestamp, 0)
-		if search.Match(&r) {
-			q <- r
+	slices.SortStableFunc(records, func(a, b model.Record) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
 		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return records, nil
+} // func (db *Database) recordNeighbours(parts []Partition, qid query.ID, cnt int64, args ...any) ([]model.Record, error)
+
+// RecordGetPage returns a page of Records, most recent first.
+func (db *Database) RecordGetPage(page *RecordPage) ([]model.Record, error) {
+	var (
+		err            error
+		parts          []Partition
+		records        []model.Record
+		qid            = query.RecordPageOlder
+		stamp, id      int64
+		hosts, sources sql.NullString
+		newer          = page.Newer && !page.Stamp.IsZero()
+	)
+
+	stamp, id, hosts, sources = page.Params()
+
+	if newer {
+		qid = query.RecordPageNewer
+		parts, err = db.partitionsForPeriod(page.Stamp, periodMax)
+	} else if parts, err = db.partitionsForPeriod(periodMin, time.Unix(stamp, 0)); err == nil {
+		slices.Reverse(parts)
+	}
+
+	if err != nil {
+		return nil, err
+	} else if records, err = db.recordNeighbours(parts, qid, page.Count, stamp, id, hosts, sources, page.Count); err != nil {
+		return nil, err
 	}
-} // func (db *Database) RecordSearch(search *model.SearchQuery, q chan<- model.Record)
+
+	// records is in chronological order, we want the <Count> Records
+	// closest to the position, most recent first.
+	if newer && len(records) > int(page.Count) {
+		records = records[:page.Count]
+	} else if !newer && len(records) > int(page.Count) {
+		records = records[len(records)-int(page.Count):]
+	}
+
+	slices.Reverse(records)
+
+	return records, nil
+} // func (db *Database) RecordGetPage(page *RecordPage) ([]model.Record, error)
 
 // SearchAdd adds a Search to the database, including both the query and the results.
 func (db *Database) SearchAdd(search *model.Search) error {
@@ -1334,6 +1928,7 @@ func (db *Database) SearchAdd(search *model.Search) error {
 		stmt                 *sql.Stmt
 		tx                   *sql.Tx
 		bufQuery, bufResults []byte
+		aggregates           sql.NullString
 		status               bool
 	)
 
@@ -1344,6 +1939,10 @@ func (db *Database) SearchAdd(search *model.Search) error {
 	} else if bufResults, err = json.Marshal(search.Results); err != nil {
 		db.log.Printf("[ERROR] Cannot serialize Results to JSON: %s\n",
 			err.Error())
+	} else if aggregates, err = EncodeAggregates(search.Aggregates); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Aggregates to JSON: %s\n",
+			err.Error())
+		return err
 	}
 
 	if stmt, err = db.getQuery(qid); err != nil {
@@ -1391,7 +1990,10 @@ EXEC_QUERY:
 		search.Timestamp.Unix(),
 		string(bufQuery),
 		string(bufResults),
-		len(search.Results)); err != nil {
+		len(search.Results),
+		aggregates,
+		search.Title,
+		search.Description); err != nil {
 		if worthARetry(err) {
 			waitForRetry()
 			goto EXEC_QUERY
@@ -1424,6 +2026,111 @@ EXEC_QUERY:
 	return nil
 } // func (db *Database) SearchAdd(search *model.Search) error
 
+// SearchUpdate replaces a Search that is already in the database, to save
+// a new Title or Description, or the results of running it again.
+func (db *Database) SearchUpdate(search *model.Search) error {
+	const qid query.ID = query.SearchUpdate
+	var (
+		err                  error
+		msg                  string
+		stmt                 *sql.Stmt
+		tx                   *sql.Tx
+		bufQuery, bufResults []byte
+		aggregates           sql.NullString
+		res                  sql.Result
+		cnt                  int64
+		status               bool
+	)
+
+	if bufQuery, err = json.Marshal(&search.Query); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Query to JSON: %s\n",
+			err.Error())
+		return err
+	} else if bufResults, err = json.Marshal(search.Results); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Results to JSON: %s\n",
+			err.Error())
+		return err
+	} else if aggregates, err = EncodeAggregates(search.Aggregates); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Aggregates to JSON: %s\n",
+			err.Error())
+		return err
+	}
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid.String(),
+			err.Error())
+		return err
+	} else if db.tx != nil {
+		tx = db.tx
+	} else {
+		db.log.Printf("[INFO] Start ad-hoc transaction for updating Search %d.\n", search.ID)
+	BEGIN_AD_HOC:
+		if tx, err = db.db.Begin(); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto BEGIN_AD_HOC
+			} else {
+				msg = fmt.Sprintf("Error starting transaction: %s\n",
+					err.Error())
+				db.log.Printf("[ERROR] %s\n", msg)
+				return errors.New(msg)
+			}
+
+		} else {
+			defer func() {
+				var err2 error
+				if status {
+					if err2 = tx.Commit(); err2 != nil {
+						db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+							err2.Error())
+					}
+				} else if err2 = tx.Rollback(); err2 != nil {
+					db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+						err2.Error())
+				}
+			}()
+		}
+	}
+
+	stmt = tx.Stmt(stmt)
+
+EXEC_QUERY:
+	if res, err = stmt.Exec(
+		search.Timestamp.Unix(),
+		string(bufQuery),
+		string(bufResults),
+		len(search.Results),
+		aggregates,
+		search.Title,
+		search.Description,
+		search.Expired,
+		search.ID); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		} else {
+			err = fmt.Errorf("Cannot update Search %d: %s",
+				search.ID,
+				err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		err = fmt.Errorf("No Search with ID %d was found in the database", search.ID)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	search.Count = int64(len(search.Results))
+	status = true
+	return nil
+} // func (db *Database) SearchUpdate(search *model.Search) error
+
 // SearchDelete removes a Search from the database.
 func (db *Database) SearchDelete(id int64) error {
 	const qid query.ID = query.SearchDelete
@@ -1493,6 +2200,90 @@ EXEC_QUERY:
 	return nil
 } // func (db *Database) SearchDelete(id int64) error
 
+// SearchExpire drops the results of all Searches that were run before the
+// given time. Anonymous Searches are deleted altogether, named Searches
+// keep their Query, so they can be run again. It returns the number of
+// Searches that were affected.
+func (db *Database) SearchExpire(before time.Time) (int64, error) {
+	var (
+		err    error
+		msg    string
+		tx     *sql.Tx
+		total  int64
+		status bool
+	)
+
+	if db.tx != nil {
+		tx = db.tx
+	} else {
+		db.log.Println("[INFO] Start ad-hoc transaction for expiring Searches.")
+	BEGIN_AD_HOC:
+		if tx, err = db.db.Begin(); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto BEGIN_AD_HOC
+			} else {
+				msg = fmt.Sprintf("Error starting transaction: %s\n",
+					err.Error())
+				db.log.Printf("[ERROR] %s\n", msg)
+				return 0, errors.New(msg)
+			}
+
+		} else {
+			defer func() {
+				var err2 error
+				if status {
+					if err2 = tx.Commit(); err2 != nil {
+						db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+							err2.Error())
+					}
+				} else if err2 = tx.Rollback(); err2 != nil {
+					db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+						err2.Error())
+				}
+			}()
+		}
+	}
+
+	for _, qid := range []query.ID{query.SearchExpireDelete, query.SearchExpireResults} {
+		var (
+			stmt *sql.Stmt
+			res  sql.Result
+			cnt  int64
+		)
+
+		if stmt, err = db.getQuery(qid); err != nil {
+			db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+				qid.String(),
+				err.Error())
+			return 0, err
+		}
+
+		stmt = tx.Stmt(stmt)
+
+	EXEC_QUERY:
+		if res, err = stmt.Exec(before.Unix()); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				goto EXEC_QUERY
+			}
+
+			err = fmt.Errorf("Cannot expire Searches: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return 0, err
+		} else if cnt, err = res.RowsAffected(); err != nil {
+			db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+				err.Error())
+			return 0, err
+		}
+
+		total += cnt
+	}
+
+	status = true
+	return total, nil
+} // func (db *Database) SearchExpire(before time.Time) (int64, error)
+
 // SearchGetByID fetches a Search by its ID
 func (db *Database) SearchGetByID(id int64) (*model.Search, error) {
 	const qid query.ID = query.SearchGetByID
@@ -1529,10 +2320,19 @@ EXEC_QUERY:
 		var (
 			timestamp  int64
 			qstr, rstr string
+			astr       sql.NullString
 			s          = &model.Search{ID: id}
 		)
 
-		if err = rows.Scan(&timestamp, &qstr, &rstr, &s.Count); err != nil {
+		if err = rows.Scan(
+			&timestamp,
+			&qstr,
+			&rstr,
+			&s.Count,
+			&astr,
+			&s.Title,
+			&s.Description,
+			&s.Expired); err != nil {
 			msg = fmt.Sprintf("Error scanning row for Host %d: %s",
 				id,
 				err.Error())
@@ -1550,6 +2350,11 @@ EXEC_QUERY:
 				err.Error(),
 				rstr)
 			return nil, err
+		} else if s.Aggregates, err = DecodeAggregates(astr); err != nil {
+			db.log.Printf("[ERROR] Cannot parse Aggregates: %s\n\n%s\n\n",
+				err.Error(),
+				astr.String)
+			return nil, err
 		}
 
 		s.Timestamp = time.Unix(timestamp, 0)
@@ -1563,7 +2368,7 @@ EXEC_QUERY:
 
 // SearchGetResults fetches the Records that were matched by a Search.
 func (db *Database) SearchGetResults(id, offset, cnt int64) ([]model.Record, error) {
-	const qid query.ID = query.SearchGetResults
+	const qid query.ID = query.SearchGetResultIDs
 	var (
 		err  error
 		msg  string
@@ -1591,27 +2396,26 @@ EXEC_QUERY:
 		return nil, err
 	}
 
-	defer rows.Close() // nolint: errcheck,gosec
-
-	var records = make([]model.Record, 0)
+	var ids = make([]int64, 0)
 
 	for rows.Next() {
-		var (
-			r         model.Record
-			timestamp int64
-		)
+		var rid int64
 
-		if err = rows.Scan(&r.ID, &r.HostID, &timestamp, &r.Source, &r.Message); err != nil {
+		if err = rows.Scan(&rid); err != nil {
+			rows.Close() // nolint: errcheck,gosec
 			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
 			db.log.Printf("[ERROR] %s\n", msg)
 			return nil, errors.New(msg)
 		}
 
-		r.Time = time.Unix(timestamp, 0)
-		records = append(records, r)
+		ids = append(ids, rid)
 	}
 
-	return records, nil
+	// The Records may live in the main database file, so we have to be
+	// done with this query before we look them up.
+	rows.Close() // nolint: errcheck,gosec
+
+	return db.RecordGetByIDList(ids)
 } // func (db *Database) SearchGetResults(id, offset, cnt int64) ([]model.Record, error)
 
 // SearchGetAllID fetches the IDs and the number of results of all searches in the database.
@@ -1665,6 +2469,66 @@ EXEC_QUERY:
 	return idlist, nil
 } // func (db *Database) SearchGetAllID() ([]int64, error)
 
+// SearchGetAll fetches all Searches from the database, most recent first.
+// To keep it cheap, it does not load their Query, Results, or Aggregates.
+func (db *Database) SearchGetAll() ([]model.Search, error) {
+	const qid query.ID = query.SearchGetAll
+	var (
+		err  error
+		msg  string
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+	var rows *sql.Rows
+
+EXEC_QUERY:
+	if rows, err = stmt.Query(); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var searches = make([]model.Search, 0)
+
+	for rows.Next() {
+		var (
+			timestamp int64
+			s         model.Search
+		)
+
+		if err = rows.Scan(
+			&s.ID,
+			&timestamp,
+			&s.Count,
+			&s.Title,
+			&s.Description,
+			&s.Expired); err != nil {
+			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", msg)
+			return nil, errors.New(msg)
+		}
+
+		s.Timestamp = time.Unix(timestamp, 0)
+		searches = append(searches, s)
+	}
+
+	return searches, nil
+} // func (db *Database) SearchGetAll() ([]model.Search, error)
+
 // SearchGetResultCount returns the number of Records returned by the given Search.
 func (db *Database) SearchGetResultCount(id int64) (int64, error) {
 	const qid query.ID = query.SearchGetResultCount
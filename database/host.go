@@ -0,0 +1,61 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/host.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 05. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-05 17:44:27 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// SetHostStamps fills in the timestamps and the SilenceThreshold of a Host
+// from the values stored in the database, which are all in seconds.
+// A LastRecord of 0 means the Host never delivered any Records.
+func SetHostStamps(h *model.Host, lastSeen, lastRecord, threshold int64) {
+	h.LastSeen = time.Unix(lastSeen, 0)
+	if lastRecord != 0 {
+		h.LastRecord = time.Unix(lastRecord, 0)
+	}
+	h.SilenceThreshold = time.Duration(threshold) * time.Second
+} // func SetHostStamps(h *model.Host, lastSeen, lastRecord, threshold int64)
+
+// HostUpdateLastRecord updates the timestamp a Host last delivered new
+// Records.
+func (db *Database) HostUpdateLastRecord(h *model.Host, timestamp time.Time) error {
+	var err error
+
+	if err = db.adHoc(query.HostUpdateLastRecord, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(timestamp.Unix(), h.ID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update LastRecord of Host %s: %w", h.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	h.LastRecord = timestamp
+	return nil
+} // func (db *Database) HostUpdateLastRecord(h *model.Host, timestamp time.Time) error
+
+// HostSetWatch saves the SilenceThreshold and Maintenance flag of a Host.
+func (db *Database) HostSetWatch(h *model.Host) error {
+	var err error
+
+	if err = db.adHoc(query.HostSetWatch, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(int64(h.SilenceThreshold/time.Second), h.Maintenance, h.ID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update watch settings of Host %s: %w", h.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) HostSetWatch(h *model.Host) error
@@ -0,0 +1,385 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/incident.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 15:20:44 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// IncidentParams returns the parameters for the IncidentUpdate query,
+// except for the ID. The IncidentAdd query takes the creation time in
+// addition.
+func IncidentParams(i *model.Incident) ([]any, error) {
+	var (
+		err error
+		end int64
+	)
+
+	if err = i.Validate(); err != nil {
+		return nil, err
+	} else if !i.End.IsZero() {
+		end = i.End.Unix()
+	}
+
+	return []any{
+		i.Title,
+		i.Summary,
+		i.Begin.Unix(),
+		end,
+		i.Status,
+	}, nil
+} // func IncidentParams(i *model.Incident) ([]any, error)
+
+// ScanIncident reads an Incident from the current row of the result of one
+// of the queries that return Incidents.
+func ScanIncident(rows *sql.Rows) (*model.Incident, error) {
+	var (
+		err                 error
+		begin, end, created int64
+		i                   = new(model.Incident)
+	)
+
+	if err = rows.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Summary,
+		&begin,
+		&end,
+		&i.Status,
+		&created); err != nil {
+		return nil, fmt.Errorf("Cannot scan Incident: %w", err)
+	}
+
+	i.Begin = time.Unix(begin, 0)
+	i.Created = time.Unix(created, 0)
+	if end != 0 {
+		i.End = time.Unix(end, 0)
+	}
+
+	return i, nil
+} // func ScanIncident(rows *sql.Rows) (*model.Incident, error)
+
+// ScanPin reads a Pin from the current row of the result of the
+// IncidentGetPins query.
+func ScanPin(rows *sql.Rows) (*model.Pin, error) {
+	var (
+		err           error
+		stamp, pinned int64
+		p             = new(model.Pin)
+	)
+
+	if err = rows.Scan(
+		&p.IncidentID,
+		&p.RecordID,
+		&p.HostID,
+		&stamp,
+		&p.Source,
+		&p.Message,
+		&p.Note,
+		&pinned); err != nil {
+		return nil, fmt.Errorf("Cannot scan Pin: %w", err)
+	}
+
+	p.Time = time.Unix(stamp, 0)
+	p.Pinned = time.Unix(pinned, 0)
+
+	return p, nil
+} // func ScanPin(rows *sql.Rows) (*model.Pin, error)
+
+// IncidentAdd adds a new Incident to the database.
+func (db *Database) IncidentAdd(i *model.Incident) error {
+	var (
+		err  error
+		args []any
+	)
+
+	if i.Created.IsZero() {
+		i.Created = time.Now()
+	}
+
+	if args, err = IncidentParams(i); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.IncidentAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(append(args, i.Created.Unix())...).Scan(&i.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add Incident %q: %w", i.Title, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentAdd(i *model.Incident) error
+
+// IncidentUpdate saves the changes to an existing Incident.
+func (db *Database) IncidentUpdate(i *model.Incident) error {
+	var (
+		err  error
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = IncidentParams(i); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.IncidentUpdate, func(stmt *sql.Stmt) error {
+		res, err = stmt.Exec(append(args, i.ID)...)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Incident %d: %w", i.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		err = fmt.Errorf("No Incident with ID %d was found in the database", i.ID)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentUpdate(i *model.Incident) error
+
+// IncidentDelete removes an Incident from the database, along with its
+// pinned Records and Searches.
+func (db *Database) IncidentDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.IncidentDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot delete Incident %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentDelete(id int64) error
+
+// IncidentGetAll returns all Incidents, most recent first.
+func (db *Database) IncidentGetAll() ([]model.Incident, error) {
+	var (
+		err       error
+		rows      *sql.Rows
+		incidents = make([]model.Incident, 0)
+	)
+
+	if rows, err = db.queryRows(query.IncidentGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query Incidents: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var i *model.Incident
+
+		if i, err = ScanIncident(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		incidents = append(incidents, *i)
+	}
+
+	return incidents, rows.Err()
+} // func (db *Database) IncidentGetAll() ([]model.Incident, error)
+
+// IncidentGetByID returns the Incident with the given ID, or nil if it
+// does not exist.
+func (db *Database) IncidentGetByID(id int64) (*model.Incident, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		i    *model.Incident
+	)
+
+	if rows, err = db.queryRows(query.IncidentGetByID, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Incident %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	} else if i, err = ScanIncident(rows); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	return i, nil
+} // func (db *Database) IncidentGetByID(id int64) (*model.Incident, error)
+
+// IncidentPinRecord pins a Record to an Incident. If the Record is pinned
+// already, only its Note is updated.
+func (db *Database) IncidentPinRecord(p *model.Pin) error {
+	var err error
+
+	if p.Pinned.IsZero() {
+		p.Pinned = time.Now()
+	}
+
+	if err = db.adHoc(query.IncidentPinRecord, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(
+			p.IncidentID,
+			p.RecordID,
+			p.HostID,
+			p.Time.Unix(),
+			p.Source,
+			p.Message,
+			p.Note,
+			p.Pinned.Unix())
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot pin Record %d to Incident %d: %w",
+			p.RecordID,
+			p.IncidentID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentPinRecord(p *model.Pin) error
+
+// IncidentUnpinRecord removes a Record from an Incident.
+func (db *Database) IncidentUnpinRecord(incidentID, recordID int64) error {
+	var err error
+
+	if err = db.adHoc(query.IncidentUnpinRecord, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(incidentID, recordID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot unpin Record %d from Incident %d: %w",
+			recordID,
+			incidentID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentUnpinRecord(incidentID, recordID int64) error
+
+// IncidentGetPins returns the Records pinned to an Incident, oldest first.
+func (db *Database) IncidentGetPins(id int64) ([]model.Pin, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		pins = make([]model.Pin, 0)
+	)
+
+	if rows, err = db.queryRows(query.IncidentGetPins, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Records pinned to Incident %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var p *model.Pin
+
+		if p, err = ScanPin(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		pins = append(pins, *p)
+	}
+
+	return pins, rows.Err()
+} // func (db *Database) IncidentGetPins(id int64) ([]model.Pin, error)
+
+// IncidentPinSearch pins a saved Search to an Incident. If the Search is
+// pinned already, nothing happens.
+func (db *Database) IncidentPinSearch(incidentID, searchID int64) error {
+	var err error
+
+	if err = db.adHoc(query.IncidentPinSearch, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(incidentID, searchID, time.Now().Unix())
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot pin Search %d to Incident %d: %w",
+			searchID,
+			incidentID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentPinSearch(incidentID, searchID int64) error
+
+// IncidentUnpinSearch removes a Search from an Incident. The Search itself
+// is left alone.
+func (db *Database) IncidentUnpinSearch(incidentID, searchID int64) error {
+	var err error
+
+	if err = db.adHoc(query.IncidentUnpinSearch, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(incidentID, searchID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot unpin Search %d from Incident %d: %w",
+			searchID,
+			incidentID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentUnpinSearch(incidentID, searchID int64) error
+
+// IncidentGetSearches returns the IDs of the Searches pinned to an
+// Incident, in the order they were pinned.
+func (db *Database) IncidentGetSearches(id int64) ([]int64, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		ids  = make([]int64, 0)
+	)
+
+	if rows, err = db.queryRows(query.IncidentGetSearches, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Searches pinned to Incident %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var sid int64
+
+		if err = rows.Scan(&sid); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Search ID: %s\n", err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, sid)
+	}
+
+	return ids, rows.Err()
+} // func (db *Database) IncidentGetSearches(id int64) ([]int64, error)
@@ -0,0 +1,231 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/label.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-10 17:02:51 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// ScanLabel reads a Label from the current row of the result of one of
+// the queries that return Labels.
+func ScanLabel(rows *sql.Rows) (*model.Label, error) {
+	var (
+		err   error
+		stamp int64
+		l     = new(model.Label)
+	)
+
+	if err = rows.Scan(
+		&l.RecordID,
+		&l.HostID,
+		&l.Source,
+		&l.Message,
+		&l.Interesting,
+		&stamp); err != nil {
+		return nil, fmt.Errorf("Cannot scan Label: %w", err)
+	}
+
+	l.Time = time.Unix(stamp, 0)
+
+	return l, nil
+} // func ScanLabel(rows *sql.Rows) (*model.Label, error)
+
+// ScanScore reads a Score from the current row of the result of the
+// ScoreGetTop query.
+func ScanScore(rows *sql.Rows) (*model.Score, error) {
+	var (
+		err   error
+		stamp int64
+		s     = new(model.Score)
+	)
+
+	if err = rows.Scan(&s.RecordID, &s.HostID, &stamp, &s.Value); err != nil {
+		return nil, fmt.Errorf("Cannot scan Score: %w", err)
+	}
+
+	s.Time = time.Unix(stamp, 0)
+
+	return s, nil
+} // func ScanScore(rows *sql.Rows) (*model.Score, error)
+
+// LabelSet labels a Record as interesting or not. If the Record already
+// has a Label, it is replaced.
+func (db *Database) LabelSet(l *model.Label) error {
+	var err error
+
+	if err = db.adHoc(query.LabelSet, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(
+			l.RecordID,
+			l.HostID,
+			l.Source,
+			l.Message,
+			l.Interesting,
+			l.Time.Unix())
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot label Record %d: %w", l.RecordID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) LabelSet(l *model.Label) error
+
+// LabelDelete removes the Label of a Record.
+func (db *Database) LabelDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.LabelDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot remove Label of Record %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) LabelDelete(id int64) error
+
+// LabelGetAll returns all Labels, in the order they were set.
+func (db *Database) LabelGetAll() ([]model.Label, error) {
+	var (
+		err    error
+		rows   *sql.Rows
+		labels = make([]model.Label, 0)
+	)
+
+	if rows, err = db.queryRows(query.LabelGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query Labels: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var l *model.Label
+
+		if l, err = ScanLabel(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		labels = append(labels, *l)
+	}
+
+	return labels, rows.Err()
+} // func (db *Database) LabelGetAll() ([]model.Label, error)
+
+// LabelGetByRecord returns the Label of a Record, or nil if it has none.
+func (db *Database) LabelGetByRecord(id int64) (*model.Label, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		l    *model.Label
+	)
+
+	if rows, err = db.queryRows(query.LabelGetByRecord, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Label of Record %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	} else if l, err = ScanLabel(rows); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	return l, nil
+} // func (db *Database) LabelGetByRecord(id int64) (*model.Label, error)
+
+// ScoreAdd saves the Scores the classifier assigned to Records, replacing
+// the previous Scores of the same Records.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) ScoreAdd(list []model.Score) error {
+	var (
+		err    error
+		status bool
+	)
+
+	if len(list) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+						err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+					err2.Error())
+			}
+		}()
+	}
+
+	for _, s := range list {
+		if err = db.adHoc(query.ScoreAdd, func(stmt *sql.Stmt) error {
+			_, err = stmt.Exec(s.RecordID, s.HostID, s.Time.Unix(), s.Value)
+			return err
+		}); err != nil {
+			err = fmt.Errorf("Cannot save Score of Record %d: %w",
+				s.RecordID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	status = true
+	return nil
+} // func (db *Database) ScoreAdd(list []model.Score) error
+
+// ScoreGetTop returns up to <max> Scores of Records since the given time,
+// the highest first.
+func (db *Database) ScoreGetTop(since time.Time, max int64) ([]model.Score, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Score, 0)
+	)
+
+	if rows, err = db.queryRows(query.ScoreGetTop, since.Unix(), max); err != nil {
+		db.log.Printf("[ERROR] Cannot query Scores: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var s *model.Score
+
+		if s, err = ScanScore(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *s)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) ScoreGetTop(since time.Time, max int64) ([]model.Score, error)
@@ -0,0 +1,326 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/notifier.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 17:52:19 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// notifierSettings holds the fields of a Notifier that only some kinds
+// use. They are stored as JSON in the settings column.
+type notifierSettings struct {
+	Args    []string `json:"args,omitempty"`
+	From    string   `json:"from,omitempty"`
+	To      []string `json:"to,omitempty"`
+	Subject string   `json:"subject,omitempty"`
+}
+
+// NotifierParams returns the parameters for the NotifierAdd and
+// NotifierUpdate queries, except for the ID.
+func NotifierParams(n *model.Notifier) ([]any, error) {
+	var (
+		err error
+		buf []byte
+		set = notifierSettings{
+			Args:    n.Args,
+			From:    n.From,
+			To:      n.To,
+			Subject: n.Subject,
+		}
+	)
+
+	if err = n.Validate(); err != nil {
+		return nil, err
+	} else if buf, err = json.Marshal(&set); err != nil {
+		return nil, fmt.Errorf("Cannot serialize settings of Notifier %q: %w",
+			n.Name,
+			err)
+	}
+
+	return []any{
+		n.Name,
+		n.Kind,
+		n.Target,
+		string(buf),
+		n.Template,
+		n.Active,
+	}, nil
+} // func NotifierParams(n *model.Notifier) ([]any, error)
+
+// ScanNotifier reads a Notifier from the current row of the result of one
+// of the queries that return Notifiers.
+func ScanNotifier(rows *sql.Rows) (*model.Notifier, error) {
+	var (
+		err  error
+		sbuf []byte
+		set  notifierSettings
+		n    = new(model.Notifier)
+	)
+
+	if err = rows.Scan(
+		&n.ID,
+		&n.Name,
+		&n.Kind,
+		&n.Target,
+		&sbuf,
+		&n.Template,
+		&n.Active); err != nil {
+		return nil, fmt.Errorf("Cannot scan Notifier: %w", err)
+	} else if err = json.Unmarshal(sbuf, &set); err != nil {
+		return nil, fmt.Errorf("Cannot parse settings of Notifier %d: %w",
+			n.ID,
+			err)
+	}
+
+	n.Args = set.Args
+	n.From = set.From
+	n.To = set.To
+	n.Subject = set.Subject
+
+	return n, nil
+} // func ScanNotifier(rows *sql.Rows) (*model.Notifier, error)
+
+// DeliveryParams returns the parameters for the DeliveryAdd query.
+func DeliveryParams(d *model.Delivery) []any {
+	var (
+		alertID sql.NullInt64
+		errmsg  sql.NullString
+	)
+
+	if d.AlertID != 0 {
+		alertID = sql.NullInt64{Int64: d.AlertID, Valid: true}
+	}
+
+	if d.Error != "" {
+		errmsg = sql.NullString{String: d.Error, Valid: true}
+	}
+
+	return []any{
+		d.NotifierID,
+		alertID,
+		d.State,
+		d.Stamp.Unix(),
+		d.Attempt,
+		errmsg,
+	}
+} // func DeliveryParams(d *model.Delivery) []any
+
+// ScanDelivery reads a Delivery from the current row of the result of the
+// DeliveryGetRecent query.
+func ScanDelivery(rows *sql.Rows) (*model.Delivery, error) {
+	var (
+		err     error
+		stamp   int64
+		alertID sql.NullInt64
+		errmsg  sql.NullString
+		d       = new(model.Delivery)
+	)
+
+	if err = rows.Scan(
+		&d.ID,
+		&d.NotifierID,
+		&alertID,
+		&d.State,
+		&stamp,
+		&d.Attempt,
+		&errmsg); err != nil {
+		return nil, fmt.Errorf("Cannot scan Delivery: %w", err)
+	}
+
+	d.AlertID = alertID.Int64
+	d.Stamp = time.Unix(stamp, 0)
+	d.Error = errmsg.String
+
+	return d, nil
+} // func ScanDelivery(rows *sql.Rows) (*model.Delivery, error)
+
+// NotifierAdd adds a Notifier to the database.
+func (db *Database) NotifierAdd(n *model.Notifier) error {
+	var (
+		err  error
+		args []any
+	)
+
+	if args, err = NotifierParams(n); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.NotifierAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(args...).Scan(&n.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add Notifier %q: %w", n.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) NotifierAdd(n *model.Notifier) error
+
+// NotifierUpdate saves the changes to an existing Notifier.
+func (db *Database) NotifierUpdate(n *model.Notifier) error {
+	var (
+		err  error
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = NotifierParams(n); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.NotifierUpdate, func(stmt *sql.Stmt) error {
+		res, err = stmt.Exec(append(args, n.ID)...)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Notifier %d: %w", n.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		err = fmt.Errorf("No Notifier with ID %d was found in the database", n.ID)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) NotifierUpdate(n *model.Notifier) error
+
+// NotifierDelete removes a Notifier from the database, along with the log
+// of its deliveries.
+func (db *Database) NotifierDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.NotifierDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot delete Notifier %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) NotifierDelete(id int64) error
+
+// NotifierGetAll returns all Notifiers, ordered by name.
+func (db *Database) NotifierGetAll() ([]model.Notifier, error) {
+	var (
+		err   error
+		rows  *sql.Rows
+		notes = make([]model.Notifier, 0)
+	)
+
+	if rows, err = db.queryRows(query.NotifierGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query Notifiers: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var n *model.Notifier
+
+		if n, err = ScanNotifier(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		notes = append(notes, *n)
+	}
+
+	return notes, rows.Err()
+} // func (db *Database) NotifierGetAll() ([]model.Notifier, error)
+
+// NotifierGetByID looks up a Notifier by its ID. If there is no such
+// Notifier, it returns nil.
+func (db *Database) NotifierGetByID(id int64) (*model.Notifier, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		n    *model.Notifier
+	)
+
+	if rows, err = db.queryRows(query.NotifierGetByID, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Notifier %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	} else if n, err = ScanNotifier(rows); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	return n, nil
+} // func (db *Database) NotifierGetByID(id int64) (*model.Notifier, error)
+
+// DeliveryAdd adds an entry to the delivery log.
+func (db *Database) DeliveryAdd(d *model.Delivery) error {
+	var (
+		err  error
+		args = DeliveryParams(d)
+	)
+
+	if err = db.adHoc(query.DeliveryAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(args...).Scan(&d.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot log Delivery for Notifier %d: %w",
+			d.NotifierID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) DeliveryAdd(d *model.Delivery) error
+
+// DeliveryGetRecent returns up to <max> entries from the delivery log,
+// most recent first.
+func (db *Database) DeliveryGetRecent(max int64) ([]model.Delivery, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Delivery, 0)
+	)
+
+	if rows, err = db.queryRows(query.DeliveryGetRecent, max); err != nil {
+		db.log.Printf("[ERROR] Cannot query delivery log: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var d *model.Delivery
+
+		if d, err = ScanDelivery(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *d)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) DeliveryGetRecent(max int64) ([]model.Delivery, error)
@@ -0,0 +1,140 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/novelty.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 08. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 16:31:47 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+type streamKey struct {
+	host   int64
+	source string
+}
+
+// NoveltyFirsts returns the oldest of the given Records for every Host and
+// source among them. PatternAddRecords uses it to keep track of when each
+// Host first logged a message matching a Pattern.
+func NoveltyFirsts(records []model.Record) []model.Record {
+	var (
+		idx    = make(map[streamKey]int)
+		firsts = make([]model.Record, 0)
+	)
+
+	for _, r := range records {
+		var key = streamKey{host: r.HostID, source: r.Source}
+
+		if i, ok := idx[key]; !ok {
+			idx[key] = len(firsts)
+			firsts = append(firsts, r)
+		} else if r.Time.Before(firsts[i].Time) {
+			firsts[i] = r
+		}
+	}
+
+	return firsts
+} // func NoveltyFirsts(records []model.Record) []model.Record
+
+// ScanNovelty reads a Novelty from the current row of the result of the
+// NoveltyGetRecent query.
+func ScanNovelty(rows *sql.Rows) (*model.Novelty, error) {
+	var (
+		err   error
+		stamp int64
+		n     = new(model.Novelty)
+	)
+
+	if err = rows.Scan(
+		&n.ID,
+		&n.PatternID,
+		&n.Template,
+		&n.HostID,
+		&n.Source,
+		&stamp,
+		&n.RecordID,
+		&n.Acknowledged); err != nil {
+		return nil, fmt.Errorf("Cannot scan Novelty: %w", err)
+	}
+
+	n.FirstSeen = time.Unix(stamp, 0)
+
+	return n, nil
+} // func ScanNovelty(rows *sql.Rows) (*model.Novelty, error)
+
+// noveltyAdd records when the Hosts first logged a message matching the
+// Pattern, unless they did so before. It is only called from
+// PatternAddRecords, within its transaction.
+func (db *Database) noveltyAdd(p *model.Pattern, records []model.Record) error {
+	var err error
+
+	for _, r := range NoveltyFirsts(records) {
+		if err = db.adHoc(query.NoveltyAdd, func(stmt *sql.Stmt) error {
+			_, err = stmt.Exec(p.ID, r.HostID, r.Source, r.Time.Unix(), r.ID)
+			return err
+		}); err != nil {
+			err = fmt.Errorf("Cannot record first sighting of Pattern %d on Host %d: %w",
+				p.ID,
+				r.HostID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	return nil
+} // func (db *Database) noveltyAdd(p *model.Pattern, records []model.Record) error
+
+// NoveltyGetRecent returns the Novelties that were first seen since the
+// given time and have not been acknowledged, most recent first.
+func (db *Database) NoveltyGetRecent(since time.Time) ([]model.Novelty, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Novelty, 0)
+	)
+
+	if rows, err = db.queryRows(query.NoveltyGetRecent, since.Unix()); err != nil {
+		db.log.Printf("[ERROR] Cannot query Novelties: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var n *model.Novelty
+
+		if n, err = ScanNovelty(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *n)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) NoveltyGetRecent(since time.Time) ([]model.Novelty, error)
+
+// NoveltyAcknowledge marks a Novelty as acknowledged, so it drops off the
+// feed.
+func (db *Database) NoveltyAcknowledge(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.NoveltyAcknowledge, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot acknowledge Novelty %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) NoveltyAcknowledge(id int64) error
@@ -0,0 +1,48 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/page.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 01. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-01 17:48:06 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// RecordPage describes a page of Records for browsing the log, most recent
+// first. Pages are addressed by the time stamp and ID of a Record, so
+// paging does not get slower the further back one goes.
+type RecordPage struct {
+	// Hosts and Sources restrict the page to Records from the given Hosts
+	// and sources. Empty lists do not restrict it.
+	Hosts   []int64
+	Sources []string
+	// Stamp and ID are the position of the page. If Newer is false, the
+	// page has the Records right before that position, otherwise the ones
+	// right after it. If Stamp is zero, the page has the most recent
+	// Records.
+	Stamp time.Time
+	ID    int64
+	Newer bool
+	// Count is the number of Records on the page.
+	Count int64
+}
+
+// Params returns the parameters for the RecordPageOlder and RecordPageNewer
+// queries, except for the limit.
+func (p *RecordPage) Params() (stamp, id int64, hosts, sources sql.NullString) {
+	var q = model.SearchQuery{Hosts: p.Hosts, Sources: p.Sources}
+
+	_, _, hosts, sources = ScanParams(&q)
+
+	if p.Stamp.IsZero() {
+		return periodMax.Unix(), math.MaxInt64, hosts, sources
+	}
+
+	return p.Stamp.Unix(), p.ID, hosts, sources
+} // func (p *RecordPage) Params() (stamp, id int64, hosts, sources sql.NullString)
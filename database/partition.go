@@ -0,0 +1,1101 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/partition.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 18. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-20 21:40:11 krylon>
+
+package database
+
+// Records are not stored in the main database file, but in partitions.
+// A partition is a separate SQLite file that holds the Records for a fixed
+// period of time, a month or a day. The main database keeps track of which
+// partitions exist and what period each of them covers, so queries for a
+// given period only need to look at the partitions that overlap it.
+// Partition files are opened on demand, and getting rid of old Records is
+// as cheap as deleting a file.
+//
+// Databases created before partitioning was introduced have a record table
+// in the main file. That table is treated as a partition (with ID 0) that
+// covers all of time and never receives new Records.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// PartitionInterval determines the period of time covered by a partition.
+type PartitionInterval uint8
+
+// PartitionMonth and PartitionDay are the supported partition sizes.
+const (
+	PartitionMonth PartitionInterval = iota
+	PartitionDay
+)
+
+// PartitionSize is the interval used when a new partition is created.
+// Changing it does not affect partitions that already exist.
+var PartitionSize = PartitionMonth
+
+// ParsePartitionInterval converts the name of a PartitionInterval, "month"
+// or "day", to its value.
+func ParsePartitionInterval(s string) (PartitionInterval, error) {
+	switch strings.ToLower(s) {
+	case "month", "monthly":
+		return PartitionMonth, nil
+	case "day", "daily":
+		return PartitionDay, nil
+	default:
+		return PartitionMonth, fmt.Errorf("Invalid partition interval %q (must be \"month\" or \"day\")",
+			s)
+	}
+} // func ParsePartitionInterval(s string) (PartitionInterval, error)
+
+// maxOpenPartitions is the number of partition files a Database keeps open
+// at most. When more are needed, the ones used least recently are closed.
+const maxOpenPartitions = 32
+
+// The ID of a Record carries the ID of its partition in its upper bits,
+// so we can find a Record by its ID without asking every partition.
+const partitionIDShift = 32
+
+// partitionOfRecord returns the ID of the partition that holds the Record
+// with the given ID.
+func partitionOfRecord(id int64) int64 {
+	return id >> partitionIDShift
+} // func partitionOfRecord(id int64) int64
+
+var uniquePat = regexp.MustCompile("(?i)unique constraint failed")
+
+// periodMin and periodMax are used as the bounds of a period when a query
+// covers all of time. They are far enough from the limits of time.Time to
+// stay clear of overflows.
+var (
+	periodMin = time.Unix(-1<<62, 0)
+	periodMax = time.Unix(1<<62, 0)
+)
+
+// Partition describes a partition file and the period of time it covers.
+// Begin is inclusive, End is exclusive.
+type Partition struct {
+	ID    int64
+	Name  string
+	Begin time.Time
+	End   time.Time
+	Path  string
+}
+
+// partition is a partition file that has been opened by a Database.
+type partition struct {
+	Partition
+	legacy  bool
+	db      *sql.DB
+	tx      *sql.Tx
+	queries map[query.ID]*sql.Stmt
+	lastUse time.Time
+	// sources and templates cache the IDs of sources and message
+	// templates, so we do not have to look them up for every Record.
+	sources   map[string]int64
+	templates map[string]int64
+}
+
+// maxCachedTemplates is the number of template IDs a partition keeps in
+// its cache at most. When the cache grows larger, it is cleared.
+const maxCachedTemplates = 8192
+
+// clearCache discards the cached IDs of sources and templates. This is
+// necessary when a transaction is rolled back, since the IDs of sources
+// and templates added in that transaction become invalid.
+func (p *partition) clearCache() {
+	p.sources = make(map[string]int64)
+	p.templates = make(map[string]int64)
+} // func (p *partition) clearCache()
+
+// partitionBounds returns the beginning and end of the period a new
+// partition for the given point in time would cover.
+func partitionBounds(t time.Time, size PartitionInterval) (time.Time, time.Time) {
+	var begin time.Time
+
+	t = t.UTC()
+
+	switch size {
+	case PartitionDay:
+		begin = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return begin, begin.AddDate(0, 0, 1)
+	default:
+		begin = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return begin, begin.AddDate(0, 1, 0)
+	}
+} // func partitionBounds(t time.Time, size PartitionInterval) (time.Time, time.Time)
+
+// partitionName derives a name for a partition from the period it covers.
+// Since partitions never overlap, the beginning of the period is unique.
+func partitionName(begin, end time.Time) string {
+	begin = begin.UTC()
+	if begin.Day() == 1 && end.UTC().Equal(begin.AddDate(0, 1, 0)) {
+		return begin.Format("2006-01")
+	}
+
+	return begin.Format(common.TimestampFormatDate)
+} // func partitionName(begin, end time.Time) string
+
+func (db *Database) partitionPath(name string) string {
+	return filepath.Join(db.partDir, "records_"+name+".db")
+} // func (db *Database) partitionPath(name string) string
+
+// partitionOpen returns the open partition described by meta. If the
+// partition file is not open, yet, it is opened and, if needed, created.
+func (db *Database) partitionOpen(meta Partition) (*partition, error) {
+	var (
+		err error
+		p   *partition
+		ok  bool
+	)
+
+	if meta.ID == 0 && db.legacy != nil {
+		db.legacy.lastUse = time.Now()
+		return db.legacy, nil
+	} else if p, ok = db.parts[meta.ID]; ok {
+		p.lastUse = time.Now()
+		return p, nil
+	} else if err = os.MkdirAll(db.partDir, 0755); err != nil {
+		db.log.Printf("[ERROR] Cannot create partition folder %s: %s\n",
+			db.partDir,
+			err.Error())
+		return nil, err
+	}
+
+	p = &partition{
+		Partition: meta,
+		queries:   make(map[query.ID]*sql.Stmt),
+		lastUse:   time.Now(),
+	}
+
+	p.clearCache()
+
+	var connstring = fmt.Sprintf("%s?_locking=NORMAL&_journal=WAL&_fk=true&recursive_triggers=true",
+		p.Path)
+
+	if p.db, err = sql.Open("sqlite3", connstring); err != nil {
+		db.log.Printf("[ERROR] Failed to open partition %s: %s\n",
+			p.Path,
+			err.Error())
+		return nil, err
+	}
+
+	if err = db.partitionInit(p); err != nil {
+		p.db.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	db.parts[p.ID] = p
+	db.partitionTrim()
+
+	return p, nil
+} // func (db *Database) partitionOpen(meta Partition) (*partition, error)
+
+// partitionInit creates the schema of a partition file, or upgrades it if
+// it was created by an older version.
+func (db *Database) partitionInit(p *partition) error {
+	var (
+		err     error
+		conn    *sql.Conn
+		version int
+		cnt     int64
+		status  bool
+		ctx     = context.Background()
+	)
+
+	if conn, err = p.db.Conn(ctx); err != nil {
+		db.log.Printf("[ERROR] Cannot get connection to partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	}
+
+	defer conn.Close() // nolint: errcheck
+
+	// Most of the time, there is nothing to do, so we check before we
+	// lock the partition.
+	if err = conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		db.log.Printf("[ERROR] Cannot query schema version of partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	} else if version == partSchemaVersion {
+		return nil
+	}
+
+BEGIN_TX:
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto BEGIN_TX
+		}
+
+		db.log.Printf("[ERROR] Cannot lock partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	}
+
+	defer func() {
+		if !status {
+			if _, err2 := conn.ExecContext(ctx, "ROLLBACK"); err2 != nil {
+				db.log.Printf("[ERROR] Rollback of partition initialization failed: %s\n",
+					err2.Error())
+			}
+		}
+	}()
+
+	// Another connection may have been faster.
+	if err = conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		db.log.Printf("[ERROR] Cannot query schema version of partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	} else if version > partSchemaVersion {
+		err = fmt.Errorf("Partition %s has schema version %d, but we only support up to %d",
+			p.Name,
+			version,
+			partSchemaVersion)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if version < partSchemaVersion {
+		if err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'record'").Scan(&cnt); err != nil {
+			db.log.Printf("[ERROR] Cannot check for record table in partition %s: %s\n",
+				p.Name,
+				err.Error())
+			return err
+		} else if cnt > 0 {
+			if err = db.partitionMigrate(ctx, conn, p); err != nil {
+				return err
+			}
+		} else {
+			for _, q := range qInitPartition {
+				if _, err = conn.ExecContext(ctx, q); err != nil {
+					db.log.Printf("[ERROR] Cannot initialize partition %s: %s\n%s\n",
+						p.Name,
+						err.Error(),
+						q)
+					return err
+				}
+			}
+		}
+
+		if _, err = conn.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", partSchemaVersion)); err != nil {
+			db.log.Printf("[ERROR] Cannot set schema version of partition %s: %s\n",
+				p.Name,
+				err.Error())
+			return err
+		}
+	}
+
+COMMIT:
+	if _, err = conn.ExecContext(ctx, "COMMIT"); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto COMMIT
+		}
+
+		db.log.Printf("[ERROR] Cannot commit initialization of partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	}
+
+	status = true
+	return nil
+} // func (db *Database) partitionInit(p *partition) error
+
+// partitionMigrate upgrades a partition created before sources and message
+// templates were normalized. It must be called within a transaction on
+// conn.
+func (db *Database) partitionMigrate(ctx context.Context, conn *sql.Conn, p *partition) error {
+	const batchSize = 1024
+	var (
+		err                error
+		cnt                int
+		lastID             int64
+		srcStmt, tmplStmt  *sql.Stmt
+		insStmt            *sql.Stmt
+		sources, templates = make(map[string]int64), make(map[string]int64)
+		qInsert            = "INSERT INTO record (id, host_id, stamp, source_id, template_id, params, checksum) VALUES (?, ?, ?, ?, ?, ?, ?)"
+		qSelect            = "SELECT id, host_id, stamp, source, message, checksum FROM record_old WHERE id > ? ORDER BY id LIMIT ?"
+		lookup             = func(stmt *sql.Stmt, cache map[string]int64, val string) (int64, error) {
+			var id, ok = cache[val]
+			if ok {
+				return id, nil
+			} else if err := stmt.QueryRowContext(ctx, val).Scan(&id); err != nil {
+				return 0, err
+			}
+			cache[val] = id
+			return id, nil
+		}
+	)
+
+	db.log.Printf("[INFO] Upgrade partition %s to schema version %d\n",
+		p.Name,
+		partSchemaVersion)
+
+	for _, q := range append(qMigratePartition, qInitPartition...) {
+		if _, err = conn.ExecContext(ctx, q); err != nil {
+			db.log.Printf("[ERROR] Cannot upgrade partition %s: %s\n%s\n",
+				p.Name,
+				err.Error(),
+				q)
+			return err
+		}
+	}
+
+	if srcStmt, err = conn.PrepareContext(ctx, qpart[query.SourceGetOrAdd]); err != nil {
+		return err
+	}
+	defer srcStmt.Close() // nolint: errcheck
+
+	if tmplStmt, err = conn.PrepareContext(ctx, qpart[query.TemplateGetOrAdd]); err != nil {
+		return err
+	}
+	defer tmplStmt.Close() // nolint: errcheck
+
+	if insStmt, err = conn.PrepareContext(ctx, qInsert); err != nil {
+		return err
+	}
+	defer insStmt.Close() // nolint: errcheck
+
+	for {
+		type oldRecord struct {
+			id, hostID, stamp         int64
+			source, message, checksum string
+		}
+
+		var (
+			rows  *sql.Rows
+			batch = make([]oldRecord, 0, batchSize)
+		)
+
+		if rows, err = conn.QueryContext(ctx, qSelect, lastID, batchSize); err != nil {
+			db.log.Printf("[ERROR] Cannot read Records from partition %s: %s\n",
+				p.Name,
+				err.Error())
+			return err
+		}
+
+		for rows.Next() {
+			var r oldRecord
+			if err = rows.Scan(&r.id, &r.hostID, &r.stamp, &r.source, &r.message, &r.checksum); err != nil {
+				rows.Close() // nolint: errcheck
+				db.log.Printf("[ERROR] Failed to scan row: %s\n", err.Error())
+				return err
+			}
+			batch = append(batch, r)
+		}
+
+		rows.Close() // nolint: errcheck
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, r := range batch {
+			var (
+				srcID, tmplID int64
+				params        any
+				tmpl, plist   = model.SplitMessage(r.message)
+			)
+
+			if len(plist) > 0 {
+				var buf []byte
+				if buf, err = json.Marshal(plist); err != nil {
+					return err
+				}
+				params = string(buf)
+			}
+
+			if srcID, err = lookup(srcStmt, sources, r.source); err != nil {
+				db.log.Printf("[ERROR] Cannot add source %q to partition %s: %s\n",
+					r.source,
+					p.Name,
+					err.Error())
+				return err
+			} else if tmplID, err = lookup(tmplStmt, templates, tmpl); err != nil {
+				db.log.Printf("[ERROR] Cannot add message template to partition %s: %s\n",
+					p.Name,
+					err.Error())
+				return err
+			} else if _, err = insStmt.ExecContext(ctx, r.id, r.hostID, r.stamp, srcID, tmplID, params, r.checksum); err != nil {
+				db.log.Printf("[ERROR] Cannot copy Record %d in partition %s: %s\n",
+					r.id,
+					p.Name,
+					err.Error())
+				return err
+			}
+
+			lastID = r.id
+			cnt++
+		}
+	}
+
+	if _, err = conn.ExecContext(ctx, "DROP TABLE record_old"); err != nil {
+		db.log.Printf("[ERROR] Cannot drop old record table of partition %s: %s\n",
+			p.Name,
+			err.Error())
+		return err
+	}
+
+	db.log.Printf("[INFO] Upgraded %d Records in partition %s\n",
+		cnt,
+		p.Name)
+
+	return nil
+} // func (db *Database) partitionMigrate(ctx context.Context, conn *sql.Conn, p *partition) error
+
+// partitionLookupID returns the ID of a source or message template in the
+// given partition, adding it if it does not exist, yet. qid is either
+// query.SourceGetOrAdd or query.TemplateGetOrAdd, stmt must be the
+// prepared statement for that query, bound to the current transaction.
+func (db *Database) partitionLookupID(p *partition, qid query.ID, stmt *sql.Stmt, val string) (int64, error) {
+	var (
+		err   error
+		id    int64
+		ok    bool
+		cache = p.sources
+	)
+
+	if qid == query.TemplateGetOrAdd {
+		if len(p.templates) >= maxCachedTemplates {
+			p.templates = make(map[string]int64)
+		}
+		cache = p.templates
+	}
+
+	if id, ok = cache[val]; ok {
+		return id, nil
+	}
+
+EXEC_QUERY:
+	if err = stmt.QueryRow(val).Scan(&id); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		db.log.Printf("[ERROR] Failed to execute query %s on partition %s: %s\n",
+			qid,
+			p.Name,
+			err.Error())
+		return 0, err
+	}
+
+	cache[val] = id
+	return id, nil
+} // func (db *Database) partitionLookupID(p *partition, qid query.ID, stmt *sql.Stmt, val string) (int64, error)
+
+// partitionClose closes the partition file, discarding any prepared queries.
+func (db *Database) partitionClose(p *partition) {
+	for key, stmt := range p.queries {
+		stmt.Close() // nolint: errcheck
+		delete(p.queries, key)
+	}
+
+	if p.legacy {
+		return
+	} else if err := p.db.Close(); err != nil {
+		db.log.Printf("[ERROR] Cannot close partition %s: %s\n",
+			p.Path,
+			err.Error())
+	}
+
+	delete(db.parts, p.ID)
+} // func (db *Database) partitionClose(p *partition)
+
+// partitionTrim closes the partitions that were used least recently if
+// the number of open partitions exceeds maxOpenPartitions. Partitions that
+// take part in a transaction are left alone.
+func (db *Database) partitionTrim() {
+	if len(db.parts) <= maxOpenPartitions {
+		return
+	}
+
+	var idle = make([]*partition, 0, len(db.parts))
+
+	for _, p := range db.parts {
+		if p.tx == nil {
+			idle = append(idle, p)
+		}
+	}
+
+	slices.SortFunc(idle, func(a, b *partition) int {
+		return a.lastUse.Compare(b.lastUse)
+	})
+
+	for _, p := range idle {
+		if len(db.parts) <= maxOpenPartitions {
+			break
+		}
+		db.partitionClose(p)
+	}
+} // func (db *Database) partitionTrim()
+
+// partitionStmt returns the prepared statement for the given query on the
+// given partition.
+func (db *Database) partitionStmt(p *partition, id query.ID) (*sql.Stmt, error) {
+	var (
+		stmt  *sql.Stmt
+		found bool
+		err   error
+	)
+
+	var queries = qpart
+
+	if p.legacy {
+		queries = qlegacy
+	}
+
+	if stmt, found = p.queries[id]; found {
+		return stmt, nil
+	} else if _, found = queries[id]; !found {
+		return nil, fmt.Errorf("Unknown partition Query %d",
+			id)
+	}
+
+PREPARE_QUERY:
+	if stmt, err = p.db.Prepare(queries[id]); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto PREPARE_QUERY
+		}
+
+		db.log.Printf("[ERROR] Cannot parse query %s for partition %s: %s\n%s\n",
+			id,
+			p.Name,
+			err.Error(),
+			queries[id])
+		return nil, err
+	}
+
+	p.queries[id] = stmt
+	return stmt, nil
+} // func (db *Database) partitionStmt(p *partition, id query.ID) (*sql.Stmt, error)
+
+// partitionTx returns the transaction queries on the given partition should
+// use. If the Database has a transaction in progress, the partition joins
+// it, otherwise partitionTx returns nil.
+func (db *Database) partitionTx(p *partition) (*sql.Tx, error) {
+	var err error
+
+	if db.tx == nil {
+		return nil, nil
+	} else if p.legacy {
+		return db.tx, nil
+	}
+
+BEGIN_TX:
+	for p.tx == nil {
+		if p.tx, err = p.db.Begin(); err != nil {
+			if worthARetry(err) {
+				waitForRetry()
+				continue BEGIN_TX
+			}
+
+			db.log.Printf("[ERROR] Failed to start transaction on partition %s: %s\n",
+				p.Name,
+				err.Error())
+			return nil, err
+		}
+	}
+
+	return p.tx, nil
+} // func (db *Database) partitionTx(p *partition) (*sql.Tx, error)
+
+// partitionGetStmt returns the prepared statement for the given query on
+// the given partition, bound to the current transaction, if there is one.
+func (db *Database) partitionGetStmt(p *partition, id query.ID) (*sql.Stmt, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		tx   *sql.Tx
+	)
+
+	if stmt, err = db.partitionStmt(p, id); err != nil {
+		return nil, err
+	} else if tx, err = db.partitionTx(p); err != nil {
+		return nil, err
+	} else if tx != nil {
+		stmt = tx.Stmt(stmt)
+	}
+
+	return stmt, nil
+} // func (db *Database) partitionGetStmt(p *partition, id query.ID) (*sql.Stmt, error)
+
+// partitionFinishTx commits or rolls back the transactions on all partitions.
+func (db *Database) partitionFinishTx(commit bool) error {
+	var err error
+
+	for _, p := range db.parts {
+		if p.tx == nil {
+			continue
+		}
+
+		var e error
+
+		if commit {
+			e = p.tx.Commit()
+		} else {
+			e = p.tx.Rollback()
+		}
+
+		if !commit {
+			p.clearCache()
+		}
+
+		if e != nil {
+			db.log.Printf("[ERROR] Failed to finish transaction on partition %s: %s\n",
+				p.Name,
+				e.Error())
+			err = e
+		}
+
+		p.tx = nil
+	}
+
+	if !commit {
+		// The rows for partitions created during the transaction are gone,
+		// and their IDs may be handed out again.
+		for _, id := range db.txParts {
+			if p, ok := db.parts[id]; ok {
+				db.partitionClose(p)
+			}
+		}
+	}
+
+	db.txParts = db.txParts[:0]
+	db.partitionTrim()
+
+	return err
+} // func (db *Database) partitionFinishTx(commit bool) error
+
+// partitionRecords runs a query that returns a list of Records on the given
+// partition.
+func (db *Database) partitionRecords(p *partition, qid query.ID, args ...any) ([]model.Record, error) {
+	var (
+		err  error
+		msg  string
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.partitionGetStmt(p, qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	}
+
+EXEC_QUERY:
+	if rows, err = stmt.Query(args...); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var records = make([]model.Record, 0)
+
+	for rows.Next() {
+		var r model.Record
+
+		if err = scanRecord(rows, &r); err != nil {
+			msg = fmt.Sprintf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", msg)
+			return nil, errors.New(msg)
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+} // func (db *Database) partitionRecords(p *partition, qid query.ID, args ...any) ([]model.Record, error)
+
+// scanRecord scans a row returned by one of the partition queries that
+// return Records into r, putting the message back together from its
+// template and parameters.
+func scanRecord(rows *sql.Rows, r *model.Record) error {
+	var (
+		err       error
+		timestamp int64
+		pattern   string
+		params    sql.NullString
+		plist     []string
+	)
+
+	if err = rows.Scan(&r.ID, &r.HostID, &timestamp, &r.Source, &pattern, &params); err != nil {
+		return err
+	} else if params.Valid {
+		if err = json.Unmarshal([]byte(params.String), &plist); err != nil {
+			return fmt.Errorf("Cannot parse parameters of Record %d: %s",
+				r.ID,
+				err.Error())
+		}
+	}
+
+	r.Time = time.Unix(timestamp, 0)
+	r.Message = model.JoinMessage(pattern, plist)
+	return nil
+} // func scanRecord(rows *sql.Rows, r *model.Record) error
+
+// partitionScan runs a query on the main database that returns a list of
+// partitions.
+func (db *Database) partitionScan(qid query.ID, args ...any) ([]Partition, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+EXEC_QUERY:
+	if rows, err = stmt.Query(args...); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var parts = make([]Partition, 0)
+
+	for rows.Next() {
+		var (
+			p          Partition
+			begin, end int64
+		)
+
+		if err = rows.Scan(&p.ID, &p.Name, &begin, &end); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		p.Begin = time.Unix(begin, 0)
+		p.End = time.Unix(end, 0)
+		p.Path = db.partitionPath(p.Name)
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+} // func (db *Database) partitionScan(qid query.ID, args ...any) ([]Partition, error)
+
+// partitionGetInt runs a query on the main database that returns a single
+// integer.
+func (db *Database) partitionGetInt(qid query.ID, args ...any) (int64, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		val  int64
+	)
+
+	if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return 0, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+EXEC_QUERY:
+	if err = stmt.QueryRow(args...).Scan(&val); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+			qid,
+			err.Error())
+		return 0, err
+	}
+
+	return val, nil
+} // func (db *Database) partitionGetInt(qid query.ID, args ...any) (int64, error)
+
+// partitionForTime returns the partition that holds the Records for the
+// given point in time. If there is no such partition and create is true,
+// a new one is created, otherwise partitionForTime returns nil.
+func (db *Database) partitionForTime(t time.Time, create bool) (*partition, error) {
+	var (
+		err              error
+		parts            []Partition
+		begin, end       time.Time
+		prevEnd, nxBegin int64
+		stamp            = t.Unix()
+	)
+
+LOOKUP:
+	if parts, err = db.partitionScan(query.PartitionGetByTime, stamp, stamp); err != nil {
+		return nil, err
+	} else if len(parts) > 0 {
+		return db.partitionOpen(parts[0])
+	} else if !create {
+		return nil, nil
+	}
+
+	// Partitions must not overlap, so if a neighbouring partition was
+	// created with a different PartitionSize, we make the new one smaller.
+	begin, end = partitionBounds(t, PartitionSize)
+
+	if prevEnd, err = db.partitionGetInt(query.PartitionGetPrevEnd, stamp); err != nil {
+		return nil, err
+	} else if nxBegin, err = db.partitionGetInt(query.PartitionGetNextBegin, stamp); err != nil {
+		return nil, err
+	}
+
+	if prevEnd > begin.Unix() {
+		begin = time.Unix(prevEnd, 0).UTC()
+	}
+
+	if nxBegin != -1 && nxBegin < end.Unix() {
+		end = time.Unix(nxBegin, 0).UTC()
+	}
+
+	var (
+		stmt *sql.Stmt
+		meta = Partition{
+			Name:  partitionName(begin, end),
+			Begin: begin,
+			End:   end,
+		}
+	)
+
+	meta.Path = db.partitionPath(meta.Name)
+
+	if stmt, err = db.getQuery(query.PartitionAdd); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			query.PartitionAdd,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+EXEC_QUERY:
+	if err = stmt.QueryRow(meta.Name, begin.Unix(), end.Unix()).Scan(&meta.ID); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		} else if uniquePat.MatchString(err.Error()) {
+			// Another connection was faster.
+			goto LOOKUP
+		}
+
+		err = fmt.Errorf("Cannot add partition %s to database: %s",
+			meta.Name,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	db.log.Printf("[INFO] Created partition %s (%d) for %s - %s\n",
+		meta.Name,
+		meta.ID,
+		begin.Format(common.TimestampFormat),
+		end.Format(common.TimestampFormat))
+
+	if db.tx != nil {
+		db.txParts = append(db.txParts, meta.ID)
+	}
+
+	return db.partitionOpen(meta)
+} // func (db *Database) partitionForTime(t time.Time, create bool) (*partition, error)
+
+// partitionsForPeriod returns the partitions that overlap the given period,
+// ordered by time.
+func (db *Database) partitionsForPeriod(begin, end time.Time) ([]Partition, error) {
+	var (
+		err   error
+		parts []Partition
+	)
+
+	if parts, err = db.partitionScan(query.PartitionGetByPeriod, begin.Unix(), end.Unix()); err != nil {
+		return nil, err
+	} else if db.legacy != nil {
+		parts = slices.Insert(parts, 0, db.legacy.Partition)
+	}
+
+	return parts, nil
+} // func (db *Database) partitionsForPeriod(begin, end time.Time) ([]Partition, error)
+
+// partitionsAll returns all partitions, ordered by time.
+func (db *Database) partitionsAll() ([]Partition, error) {
+	return db.partitionsForPeriod(periodMin, periodMax)
+} // func (db *Database) partitionsAll() ([]Partition, error)
+
+// partitionByID returns the partition with the given ID, or nil if there is
+// no such partition.
+func (db *Database) partitionByID(id int64) (*partition, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		meta = Partition{ID: id}
+	)
+
+	if id == 0 {
+		if db.legacy == nil {
+			return nil, nil
+		}
+		return db.legacy, nil
+	} else if p, ok := db.parts[id]; ok {
+		p.lastUse = time.Now()
+		return p, nil
+	} else if stmt, err = db.getQuery(query.PartitionGetByID); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			query.PartitionGetByID,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+	var begin, end int64
+
+EXEC_QUERY:
+	if err = stmt.QueryRow(id).Scan(&meta.Name, &begin, &end); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		} else if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		db.log.Printf("[ERROR] Cannot look up partition %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	meta.Begin = time.Unix(begin, 0)
+	meta.End = time.Unix(end, 0)
+	meta.Path = db.partitionPath(meta.Name)
+
+	return db.partitionOpen(meta)
+} // func (db *Database) partitionByID(id int64) (*partition, error)
+
+// PartitionGetAll returns all partitions, ordered by time.
+// The record table of databases created before partitioning is not
+// included.
+func (db *Database) PartitionGetAll() ([]Partition, error) {
+	return db.partitionScan(query.PartitionGetAll)
+} // func (db *Database) PartitionGetAll() ([]Partition, error)
+
+// PartitionDrop removes the partition with the given ID, including all
+// Records in it, by deleting its file.
+// It cannot be called while a transaction is in progress.
+func (db *Database) PartitionDrop(id int64) error {
+	const qid query.ID = query.PartitionDelete
+	var (
+		err  error
+		p    *partition
+		stmt *sql.Stmt
+	)
+
+	if db.tx != nil {
+		return ErrTxInProgress
+	} else if id == 0 {
+		db.log.Println("[ERROR] The legacy record table cannot be dropped")
+		return ErrInvalidValue
+	} else if p, err = db.partitionByID(id); err != nil {
+		return err
+	} else if p == nil {
+		return ErrObjectNotFound
+	} else if stmt, err = db.getQuery(qid); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			qid,
+			err.Error())
+		return err
+	}
+
+EXEC_QUERY:
+	if _, err = stmt.Exec(id); err != nil {
+		if worthARetry(err) {
+			waitForRetry()
+			goto EXEC_QUERY
+		}
+
+		err = fmt.Errorf("Cannot delete partition %s from database: %s",
+			p.Name,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	db.partitionClose(p)
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		var path = p.Path + suffix
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			db.log.Printf("[ERROR] Cannot remove partition file %s: %s\n",
+				path,
+				err.Error())
+			return err
+		}
+	}
+
+	db.log.Printf("[INFO] Dropped partition %s (%d)\n",
+		p.Name,
+		p.ID)
+
+	return nil
+} // func (db *Database) PartitionDrop(id int64) error
+
+// PartitionDropBefore drops all partitions that end before the given point
+// in time. It returns the number of partitions that were dropped.
+func (db *Database) PartitionDropBefore(t time.Time) (int, error) {
+	var (
+		err   error
+		cnt   int
+		parts []Partition
+	)
+
+	if parts, err = db.PartitionGetAll(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range parts {
+		if p.End.After(t) {
+			break
+		} else if err = db.PartitionDrop(p.ID); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+
+	return cnt, nil
+} // func (db *Database) PartitionDropBefore(t time.Time) (int, error)
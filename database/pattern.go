@@ -0,0 +1,334 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/pattern.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 16:34:05 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// PatternStats returns the number of Records per model.PatternBucket,
+// keyed by the beginning of the bucket in seconds, along with the
+// timestamps of the oldest and the most recent Record.
+func PatternStats(records []model.Record) (map[int64]int64, time.Time, time.Time) {
+	var (
+		counts      = make(map[int64]int64)
+		first, last time.Time
+	)
+
+	for i, r := range records {
+		counts[r.Time.Truncate(model.PatternBucket).Unix()]++
+
+		if i == 0 || r.Time.Before(first) {
+			first = r.Time
+		}
+		if i == 0 || r.Time.After(last) {
+			last = r.Time
+		}
+	}
+
+	return counts, first, last
+} // func PatternStats(records []model.Record) (map[int64]int64, time.Time, time.Time)
+
+// ScanPattern reads a Pattern from the current row of the result of one of
+// the queries that return Patterns.
+func ScanPattern(rows *sql.Rows) (*model.Pattern, error) {
+	var (
+		err         error
+		first, last int64
+		p           = new(model.Pattern)
+	)
+
+	if err = rows.Scan(
+		&p.ID,
+		&p.Template,
+		&first,
+		&last,
+		&p.Count,
+		&p.Recent); err != nil {
+		return nil, fmt.Errorf("Cannot scan Pattern: %w", err)
+	}
+
+	p.FirstSeen = time.Unix(first, 0)
+	p.LastSeen = time.Unix(last, 0)
+
+	return p, nil
+} // func ScanPattern(rows *sql.Rows) (*model.Pattern, error)
+
+// ScanBucket reads a model.Bucket from the current row of the result of
+// the PatternGetCounts query.
+func ScanBucket(rows *sql.Rows) (*model.Bucket, error) {
+	var (
+		err   error
+		stamp int64
+		b     = new(model.Bucket)
+	)
+
+	if err = rows.Scan(&stamp, &b.Count); err != nil {
+		return nil, fmt.Errorf("Cannot scan Bucket: %w", err)
+	}
+
+	b.Begin = time.Unix(stamp, 0)
+
+	return b, nil
+} // func ScanBucket(rows *sql.Rows) (*model.Bucket, error)
+
+// PatternAdd adds a new Pattern to the database. Its FirstSeen and LastSeen
+// must be set, its Count starts at 0.
+func (db *Database) PatternAdd(p *model.Pattern) error {
+	var err error
+
+	if err = db.adHoc(query.PatternAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(
+			p.Template,
+			p.FirstSeen.Unix(),
+			p.LastSeen.Unix()).Scan(&p.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add Pattern %q: %w", p.Template, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	p.Count = 0
+	return nil
+} // func (db *Database) PatternAdd(p *model.Pattern) error
+
+// PatternUpdate saves the Template of a Pattern after it has changed.
+func (db *Database) PatternUpdate(p *model.Pattern) error {
+	var err error
+
+	if err = db.adHoc(query.PatternUpdate, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(p.Template, p.ID)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Pattern %d: %w", p.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) PatternUpdate(p *model.Pattern) error
+
+// PatternAddRecords records that the given Records match the Pattern. It
+// updates the counts of the Pattern along with its FirstSeen and
+// LastSeen, both in the database and in p. Records that were already
+// assigned a Pattern are not counted again. It also keeps track of when
+// each Host first logged a message matching the Pattern.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) PatternAddRecords(p *model.Pattern, records []model.Record) error {
+	var (
+		err         error
+		counts      map[int64]int64
+		first, last time.Time
+		seen        [2]int64
+		fresh       = make([]model.Record, 0, len(records))
+		status      bool
+	)
+
+	if len(records) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+						err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+					err2.Error())
+			}
+		}()
+	}
+
+	for i := range records {
+		var res sql.Result
+
+		if err = db.adHoc(query.PatternRecordAdd, func(stmt *sql.Stmt) error {
+			res, err = stmt.Exec(records[i].ID, p.ID)
+			return err
+		}); err != nil {
+			err = fmt.Errorf("Cannot add Record %d to Pattern %d: %w",
+				records[i].ID,
+				p.ID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			fresh = append(fresh, records[i])
+		}
+	}
+
+	if len(fresh) == 0 {
+		status = true
+		return nil
+	}
+
+	counts, first, last = PatternStats(fresh)
+
+	for stamp, cnt := range counts {
+		if err = db.adHoc(query.PatternCountAdd, func(stmt *sql.Stmt) error {
+			_, err = stmt.Exec(p.ID, stamp, cnt)
+			return err
+		}); err != nil {
+			err = fmt.Errorf("Cannot update counts of Pattern %d: %w", p.ID, err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	if err = db.noveltyAdd(p, fresh); err != nil {
+		return err
+	} else if err = db.adHoc(query.PatternSeen, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(first.Unix(), last.Unix(), len(fresh), p.ID).
+			Scan(&seen[0], &seen[1], &p.Count)
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Pattern %d: %w", p.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	p.FirstSeen = time.Unix(seen[0], 0)
+	p.LastSeen = time.Unix(seen[1], 0)
+	status = true
+
+	return nil
+} // func (db *Database) PatternAddRecords(p *model.Pattern, records []model.Record) error
+
+// PatternGetAll returns all Patterns, the ones matching the most Records
+// first. Their Recent field holds the number of Records since the given
+// time.
+func (db *Database) PatternGetAll(since time.Time) ([]model.Pattern, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Pattern, 0)
+	)
+
+	if rows, err = db.queryRows(query.PatternGetAll, since.Truncate(model.PatternBucket).Unix()); err != nil {
+		db.log.Printf("[ERROR] Cannot query Patterns: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var p *model.Pattern
+
+		if p, err = ScanPattern(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *p)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) PatternGetAll(since time.Time) ([]model.Pattern, error)
+
+// PatternGetByID looks up a Pattern by its ID. If there is no such
+// Pattern, it returns nil.
+func (db *Database) PatternGetByID(id int64) (*model.Pattern, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		p    *model.Pattern
+	)
+
+	if rows, err = db.queryRows(query.PatternGetByID, id); err != nil {
+		db.log.Printf("[ERROR] Cannot query Pattern %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	} else if p, err = ScanPattern(rows); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	return p, nil
+} // func (db *Database) PatternGetByID(id int64) (*model.Pattern, error)
+
+// PatternGetCounts returns the number of Records matching a Pattern per
+// model.PatternBucket since the given time. Buckets without any Records
+// are left out.
+func (db *Database) PatternGetCounts(id int64, begin time.Time) ([]model.Bucket, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Bucket, 0)
+	)
+
+	if rows, err = db.queryRows(query.PatternGetCounts, id, begin.Truncate(model.PatternBucket).Unix()); err != nil {
+		db.log.Printf("[ERROR] Cannot query counts of Pattern %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var b *model.Bucket
+
+		if b, err = ScanBucket(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *b)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) PatternGetCounts(id int64, begin time.Time) ([]model.Bucket, error)
+
+// PatternGetRecordIDs returns the IDs of up to <max> Records matching a
+// Pattern, most recent first.
+func (db *Database) PatternGetRecordIDs(id, max int64) ([]int64, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		ids  = make([]int64, 0)
+	)
+
+	if rows, err = db.queryRows(query.PatternGetRecordIDs, id, max); err != nil {
+		db.log.Printf("[ERROR] Cannot query Records of Pattern %d: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var rid int64
+
+		if err = rows.Scan(&rid); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Record ID: %s\n", err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, rid)
+	}
+
+	return ids, rows.Err()
+} // func (db *Database) PatternGetRecordIDs(id, max int64) ([]int64, error)
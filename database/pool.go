@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 07. 06. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-08-22 18:01:58 krylon>
+// Time-stamp: <2024-10-13 11:40:12 krylon>
 
 package database
 
@@ -12,18 +12,18 @@ import (
 	"sync"
 
 	"github.com/blicero/scrollmaster/common"
-	"github.com/blicero/scrollmaster/common/path"
 	"github.com/blicero/scrollmaster/logdomain"
 )
 
 type dblink struct {
-	db   *Database
+	db   Storage
 	next *dblink
 }
 
 // Pool is a pool of database connections
 type Pool struct {
 	cnt   int
+	open  Opener
 	log   *log.Logger
 	link  *dblink
 	lock  sync.RWMutex
@@ -32,11 +32,17 @@ type Pool struct {
 
 // NewPool creates a Pool of database connections.
 // The number of connections to use is given by the
-// parameter cnt.
+// parameter cnt. Connections are opened using DefaultOpener.
 func NewPool(cnt int) (*Pool, error) {
+	return NewPoolWithOpener(cnt, DefaultOpener)
+} // func NewPool(cnt int) (*Pool, error)
+
+// NewPoolWithOpener creates a Pool of cnt database connections, which are
+// opened using the given Opener.
+func NewPoolWithOpener(cnt int, open Opener) (*Pool, error) {
 	var (
 		err  error
-		pool = &Pool{cnt: cnt}
+		pool = &Pool{cnt: cnt, open: open}
 	)
 
 	pool.empty = sync.NewCond(&pool.lock)
@@ -52,7 +58,7 @@ func NewPool(cnt int) (*Pool, error) {
 	for i := 0; i < cnt; i++ {
 		var link = &dblink{next: pool.link}
 
-		if link.db, err = Open(common.Path(path.Database)); err != nil {
+		if link.db, err = pool.open(); err != nil {
 			pool.log.Printf("[ERROR] Cannot open database: %s\n",
 				err.Error())
 			return nil, err
@@ -62,7 +68,7 @@ func NewPool(cnt int) (*Pool, error) {
 	}
 
 	return pool, nil
-} // func NewPool(cnt int) (*Pool, error)
+} // func NewPoolWithOpener(cnt int, open Opener) (*Pool, error)
 
 // Close closes all open database connections currently in the pool and empties
 // the pool. Any connections retrieved from the pool that are in use at the
@@ -85,7 +91,10 @@ func (pool *Pool) Close() error {
 
 // Get returns a DB connection from the pool.
 // If the pool is empty, it waits for a connection to be returned.
-func (pool *Pool) Get() *Database {
+// Code that already holds a connection must not call Get again, but pass
+// the one it holds along: Once enough goroutines do that at the same
+// time, the pool runs dry and all of them wait for each other.
+func (pool *Pool) Get() Storage {
 	var link *dblink
 
 	pool.lock.Lock()
@@ -108,8 +117,8 @@ WAIT_FOR_LINK:
 
 // GetNoWait returns a DB connection from the pool.
 // If the pool is empty, it creates a new one.
-func (pool *Pool) GetNoWait() (*Database, error) {
-	var db *Database
+func (pool *Pool) GetNoWait() (Storage, error) {
+	var db Storage
 	var err error
 
 	pool.lock.Lock()
@@ -120,22 +129,22 @@ func (pool *Pool) GetNoWait() (*Database, error) {
 		pool.link = link.next
 		pool.cnt--
 		return link.db, nil
-	} else if db, err = Open(common.Path(path.Database)); err != nil {
+	} else if db, err = pool.open(); err != nil {
 		pool.log.Printf("[ERROR] Error opening new database connection: %s",
 			err.Error())
 		return nil, err
 	}
 
 	return db, nil
-} // func (pool *Pool) GetNoWait() *Database
+} // func (pool *Pool) GetNoWait() (Storage, error)
 
 // Put returns a DB connection to the pool.
-func (pool *Pool) Put(db *Database) {
+func (pool *Pool) Put(db Storage) {
 	link := &dblink{
 		db: db,
 	}
 
-	if db.tx != nil {
+	if db.InTransaction() {
 		pool.log.Println("[INFO] DB has pending transaction, rolling back.")
 		if err := db.Rollback(); err != nil {
 			pool.log.Printf("[ERROR] Cannot roll back transaction: %s\n",
@@ -149,7 +158,7 @@ func (pool *Pool) Put(db *Database) {
 	pool.cnt++
 	pool.lock.Unlock()
 	pool.empty.Signal()
-} // func (pool *Pool) Put(db *Database)
+} // func (pool *Pool) Put(db Storage)
 
 // IsEmpty returns true if the pool is currently empty.
 func (pool *Pool) IsEmpty() bool {
@@ -0,0 +1,239 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/alert.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 03. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-03 17:52:36 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// AlertRuleAdd adds an alert rule to the database.
+func (db *Database) AlertRuleAdd(r *model.AlertRule) error {
+	const qid query.ID = query.AlertRuleAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+	)
+
+	if args, err = database.AlertRuleParams(r); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(args...).Scan(&r.ID); err != nil {
+		err = fmt.Errorf("Cannot add alert rule %q: %w", r.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertRuleAdd(r *model.AlertRule) error
+
+// AlertRuleUpdate saves the changes to an existing alert rule.
+func (db *Database) AlertRuleUpdate(r *model.AlertRule) error {
+	const qid query.ID = query.AlertRuleUpdate
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = database.AlertRuleParams(r); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if res, err = stmt.Exec(append(args, r.ID)...); err != nil {
+		err = fmt.Errorf("Cannot update alert rule %d: %w", r.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return fmt.Errorf("No alert rule with ID %d was found in the database", r.ID)
+	}
+
+	return nil
+} // func (db *Database) AlertRuleUpdate(r *model.AlertRule) error
+
+// AlertRuleDelete removes an alert rule from the database, along with all
+// the Alerts it has raised.
+func (db *Database) AlertRuleDelete(id int64) error {
+	return db.exec(query.AlertRuleDelete, id)
+} // func (db *Database) AlertRuleDelete(id int64) error
+
+// AlertRuleSilence silences an alert rule until the given time. Passing a
+// time in the past ends the silence.
+func (db *Database) AlertRuleSilence(id int64, until time.Time) error {
+	return db.exec(query.AlertRuleSilence, until.Unix(), id)
+} // func (db *Database) AlertRuleSilence(id int64, until time.Time) error
+
+// AlertRuleGetAll returns all alert rules, ordered by name.
+func (db *Database) AlertRuleGetAll() ([]model.AlertRule, error) {
+	const qid query.ID = query.AlertRuleGetAll
+	var (
+		err   error
+		stmt  *sql.Stmt
+		rows  *sql.Rows
+		rules = make([]model.AlertRule, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var r *model.AlertRule
+
+		if r, err = database.ScanAlertRule(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		rules = append(rules, *r)
+	}
+
+	return rules, rows.Err()
+} // func (db *Database) AlertRuleGetAll() ([]model.AlertRule, error)
+
+// AlertRuleGetByID looks up an alert rule by its ID. If there is no such
+// rule, it returns nil.
+func (db *Database) AlertRuleGetByID(id int64) (*model.AlertRule, error) {
+	const qid query.ID = query.AlertRuleGetByID
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	return database.ScanAlertRule(rows)
+} // func (db *Database) AlertRuleGetByID(id int64) (*model.AlertRule, error)
+
+// AlertAdd records a new Alert. It fails if the same rule already has an
+// open Alert for the same Host.
+func (db *Database) AlertAdd(a *model.Alert) error {
+	const qid query.ID = query.AlertAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(
+		a.RuleID,
+		a.HostID,
+		a.Fired.Unix(),
+		a.LastSeen.Unix(),
+		a.Count,
+		a.Silenced).Scan(&a.ID); err != nil {
+		err = fmt.Errorf("Cannot add Alert for rule %d: %w", a.RuleID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AlertAdd(a *model.Alert) error
+
+// AlertUpdate saves the LastSeen and Count of an Alert that is still
+// firing.
+func (db *Database) AlertUpdate(a *model.Alert) error {
+	return db.exec(query.AlertUpdate, a.LastSeen.Unix(), a.Count, a.ID)
+} // func (db *Database) AlertUpdate(a *model.Alert) error
+
+// AlertResolve marks an Alert as resolved at the given time.
+func (db *Database) AlertResolve(a *model.Alert, t time.Time) error {
+	var err error
+
+	if err = db.exec(query.AlertResolve, t.Unix(), a.ID); err != nil {
+		return err
+	}
+
+	a.Resolved = t
+	return nil
+} // func (db *Database) AlertResolve(a *model.Alert, t time.Time) error
+
+// AlertGetOpen returns all Alerts that are still firing, most recent
+// first.
+func (db *Database) AlertGetOpen() ([]model.Alert, error) {
+	return db.alertQuery(query.AlertGetOpen)
+} // func (db *Database) AlertGetOpen() ([]model.Alert, error)
+
+// AlertGetHistory returns up to <max> Alerts, most recent first.
+func (db *Database) AlertGetHistory(max int64) ([]model.Alert, error) {
+	return db.alertQuery(query.AlertGetHistory, limit(max))
+} // func (db *Database) AlertGetHistory(max int64) ([]model.Alert, error)
+
+func (db *Database) alertQuery(qid query.ID, args ...any) ([]model.Alert, error) {
+	var (
+		err    error
+		stmt   *sql.Stmt
+		rows   *sql.Rows
+		alerts = make([]model.Alert, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(args...); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var a *model.Alert
+
+		if a, err = database.ScanAlert(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		alerts = append(alerts, *a)
+	}
+
+	return alerts, rows.Err()
+} // func (db *Database) alertQuery(qid query.ID, args ...any) ([]model.Alert, error)
+
+// exec runs a query that does not return any rows.
+func (db *Database) exec(qid query.ID, args ...any) error {
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if _, err = stmt.Exec(args...); err != nil {
+		err = fmt.Errorf("Cannot execute query %s: %w", qid, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) exec(qid query.ID, args ...any) error
@@ -0,0 +1,171 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/annotation.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 11. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-11 16:10:37 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/lib/pq"
+)
+
+// AnnotationAdd attaches an Annotation to a Record.
+func (db *Database) AnnotationAdd(a *model.Annotation) error {
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(query.AnnotationAdd); err != nil {
+		return err
+	} else if err = stmt.QueryRow(
+		a.RecordID,
+		a.HostID,
+		a.Time.Unix(),
+		a.Text).Scan(&a.ID); err != nil {
+		err = fmt.Errorf("Cannot annotate Record %d: %w", a.RecordID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) AnnotationAdd(a *model.Annotation) error
+
+// AnnotationDelete removes an Annotation.
+func (db *Database) AnnotationDelete(id int64) error {
+	return db.exec(query.AnnotationDelete, id)
+} // func (db *Database) AnnotationDelete(id int64) error
+
+// AnnotationGetByRecords returns the Annotations of the given Records,
+// oldest first, keyed by the ID of their Record.
+func (db *Database) AnnotationGetByRecords(ids []int64) (map[int64][]model.Annotation, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		res  = make(map[int64][]model.Annotation)
+	)
+
+	if len(ids) == 0 {
+		return res, nil
+	} else if stmt, err = db.getStmt(query.AnnotationGetByRecords); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var a *model.Annotation
+
+		if a, err = database.ScanAnnotation(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		res[a.RecordID] = append(res[a.RecordID], *a)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) AnnotationGetByRecords(ids []int64) (map[int64][]model.Annotation, error)
+
+// TagAdd puts a Tag on a Record. If the Record already carries the Tag,
+// nothing happens.
+func (db *Database) TagAdd(t *model.Tag) error {
+	var err error
+
+	if err = db.exec(query.TagAdd,
+		t.RecordID,
+		t.Name,
+		t.HostID,
+		t.Time.Unix()); err != nil {
+		return fmt.Errorf("Cannot tag Record %d with %q: %w",
+			t.RecordID,
+			t.Name,
+			err)
+	}
+
+	return nil
+} // func (db *Database) TagAdd(t *model.Tag) error
+
+// TagDelete removes a Tag from a Record.
+func (db *Database) TagDelete(recordID int64, name string) error {
+	return db.exec(query.TagDelete, recordID, name)
+} // func (db *Database) TagDelete(recordID int64, name string) error
+
+// TagGetByRecords returns the Tags of the given Records, keyed by the ID
+// of their Record.
+func (db *Database) TagGetByRecords(ids []int64) (map[int64][]model.Tag, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		res  = make(map[int64][]model.Tag)
+	)
+
+	if len(ids) == 0 {
+		return res, nil
+	} else if stmt, err = db.getStmt(query.TagGetByRecords); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var t *model.Tag
+
+		if t, err = database.ScanTag(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		res[t.RecordID] = append(res[t.RecordID], *t)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) TagGetByRecords(ids []int64) (map[int64][]model.Tag, error)
+
+// TagGetAll returns the IDs of all tagged Records, keyed by the name of the
+// Tag.
+func (db *Database) TagGetAll() (map[string][]int64, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		res  = make(map[string][]int64)
+	)
+
+	if stmt, err = db.getStmt(query.TagGetAll); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var (
+			name string
+			id   int64
+		)
+
+		if err = rows.Scan(&name, &id); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Tag: %s\n", err.Error())
+			return nil, err
+		}
+
+		res[name] = append(res[name], id)
+	}
+
+	return res, rows.Err()
+} // func (db *Database) TagGetAll() (map[string][]int64, error)
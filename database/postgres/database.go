@@ -0,0 +1,1248 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/database.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 10:48:27 krylon>
+
+// Package postgres implements the database.Storage interface on top of
+// PostgreSQL.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/lib/pq"
+)
+
+// EnvDSN is the name of the environment variable that the tests look at for
+// the connection string of a PostgreSQL database to run against.
+const EnvDSN = "SCROLLMASTER_PG_DSN"
+
+var (
+	openLock sync.Mutex
+	idCnt    int64
+)
+
+// Database wraps a connection to a PostgreSQL database.
+type Database struct {
+	id      int64
+	db      *sql.DB
+	tx      *sql.Tx
+	log     *log.Logger
+	queries map[query.ID]*sql.Stmt
+}
+
+// Open connects to the PostgreSQL database specified by the connection
+// string dsn. If the schema does not exist, yet, or is outdated, it is
+// created or upgraded.
+func Open(dsn string) (*Database, error) {
+	var (
+		err error
+		db  = &Database{
+			queries: make(map[query.ID]*sql.Stmt),
+		}
+	)
+
+	openLock.Lock()
+	defer openLock.Unlock()
+	idCnt++
+	db.id = idCnt
+
+	if db.log, err = common.GetLogger(logdomain.Database); err != nil {
+		return nil, err
+	} else if db.db, err = sql.Open("postgres", dsn); err != nil {
+		db.log.Printf("[ERROR] Failed to open PostgreSQL database: %s\n",
+			err.Error())
+		return nil, err
+	} else if err = db.db.Ping(); err != nil {
+		db.log.Printf("[ERROR] Cannot connect to PostgreSQL database: %s\n",
+			err.Error())
+		db.db.Close() // nolint: errcheck
+		return nil, err
+	} else if err = db.migrate(); err != nil {
+		db.db.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return db, nil
+} // func Open(dsn string) (*Database, error)
+
+// Opener returns a database.Opener that connects to the given PostgreSQL
+// database.
+func Opener(dsn string) database.Opener {
+	return func() (database.Storage, error) {
+		var (
+			err error
+			db  *Database
+		)
+
+		if db, err = Open(dsn); err != nil {
+			return nil, err
+		}
+
+		return db, nil
+	}
+} // func Opener(dsn string) database.Opener
+
+// migrate creates or upgrades the database schema.
+// Since several connections may be opened at once, the schema_version table
+// is locked for the duration of the migration. If the migration cannot be
+// committed, that error is returned, too.
+func (db *Database) migrate() (err error) {
+	var (
+		tx      *sql.Tx
+		version int
+		status  bool
+	)
+
+	if _, err = db.db.Exec(qSchemaVersionInit); err != nil {
+		db.log.Printf("[ERROR] Cannot create schema_version table: %s\n",
+			err.Error())
+		return err
+	} else if tx, err = db.db.Begin(); err != nil {
+		db.log.Printf("[ERROR] Cannot begin transaction: %s\n",
+			err.Error())
+		return err
+	}
+
+	defer func() {
+		var err2 error
+		if status {
+			if err2 = tx.Commit(); err2 != nil {
+				db.log.Printf("[ERROR] Failed to commit migration: %s\n",
+					err2.Error())
+				err = err2
+			}
+		} else if err2 = tx.Rollback(); err2 != nil {
+			db.log.Printf("[ERROR] Rollback of migration failed: %s\n",
+				err2.Error())
+		}
+	}()
+
+	if _, err = tx.Exec("LOCK TABLE schema_version IN EXCLUSIVE MODE"); err != nil {
+		db.log.Printf("[ERROR] Cannot lock schema_version table: %s\n",
+			err.Error())
+		return err
+	} else if err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		db.log.Printf("[ERROR] Cannot query schema version: %s\n",
+			err.Error())
+		return err
+	} else if version > schemaVersion {
+		err = fmt.Errorf("Database has schema version %d, but we only support up to %d",
+			version,
+			schemaVersion)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if version == schemaVersion {
+		status = true
+		return nil
+	}
+
+	db.log.Printf("[INFO] Upgrade PostgreSQL schema from version %d to %d\n",
+		version,
+		schemaVersion)
+
+	for v := version; v < schemaVersion; v++ {
+		for _, q := range qMigrate[v] {
+			if _, err = tx.Exec(q); err != nil {
+				db.log.Printf("[ERROR] Cannot execute migration query (%d -> %d): %s\n%s\n",
+					v,
+					v+1,
+					err.Error(),
+					q)
+				return err
+			}
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM schema_version"); err != nil {
+		db.log.Printf("[ERROR] Cannot clear schema version: %s\n",
+			err.Error())
+		return err
+	} else if _, err = tx.Exec("INSERT INTO schema_version (version) VALUES ($1)", schemaVersion); err != nil {
+		db.log.Printf("[ERROR] Cannot set schema version: %s\n",
+			err.Error())
+		return err
+	}
+
+	status = true
+	return nil
+} // func (db *Database) migrate() (err error)
+
+// Close closes the database.
+// If there is a pending transaction, it is rolled back.
+func (db *Database) Close() error {
+	var err error
+
+	if db.tx != nil {
+		if err = db.tx.Rollback(); err != nil {
+			db.log.Printf("[CRITICAL] Cannot roll back pending transaction: %s\n",
+				err.Error())
+			return err
+		}
+		db.tx = nil
+	}
+
+	for key, stmt := range db.queries {
+		if err = stmt.Close(); err != nil {
+			db.log.Printf("[CRITICAL] Cannot close statement handle %s: %s\n",
+				key,
+				err.Error())
+			return err
+		}
+		delete(db.queries, key)
+	}
+
+	if err = db.db.Close(); err != nil {
+		db.log.Printf("[CRITICAL] Cannot close database: %s\n",
+			err.Error())
+	}
+
+	db.db = nil
+	return nil
+} // func (db *Database) Close() error
+
+func (db *Database) getQuery(id query.ID) (*sql.Stmt, error) {
+	var (
+		stmt  *sql.Stmt
+		found bool
+		err   error
+	)
+
+	if stmt, found = db.queries[id]; found {
+		return stmt, nil
+	} else if _, found = qdb[id]; !found {
+		return nil, fmt.Errorf("Unknown Query %d",
+			id)
+	}
+
+	db.log.Printf("[TRACE] Prepare query %s\n", id)
+
+	if stmt, err = db.db.Prepare(qdb[id]); err != nil {
+		db.log.Printf("[ERROR] Cannot parse query %s: %s\n%s\n",
+			id,
+			err.Error(),
+			qdb[id])
+		return nil, err
+	}
+
+	db.queries[id] = stmt
+	return stmt, nil
+} // func (db *Database) getQuery(query.ID) (*sql.Stmt, error)
+
+// getStmt returns the prepared statement for the given query, bound to the
+// current transaction, if there is one.
+func (db *Database) getStmt(id query.ID) (*sql.Stmt, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getQuery(id); err != nil {
+		db.log.Printf("[ERROR] Cannot prepare query %s: %s\n",
+			id,
+			err.Error())
+		return nil, err
+	} else if db.tx != nil {
+		stmt = db.tx.Stmt(stmt)
+	}
+
+	return stmt, nil
+} // func (db *Database) getStmt(id query.ID) (*sql.Stmt, error)
+
+// limit converts a maximum number of rows to a value for a LIMIT clause.
+// Unlike SQLite, PostgreSQL does not accept negative numbers to mean "no
+// limit", but it does accept NULL.
+func limit(max int64) any {
+	if max < 0 {
+		return nil
+	}
+
+	return max
+} // func limit(max int64) any
+
+// PerformMaintenance performs some maintenance operations on the database.
+// It cannot be called while a transaction is in progress.
+func (db *Database) PerformMaintenance() error {
+	var err error
+
+	if db.tx != nil {
+		return database.ErrTxInProgress
+	} else if _, err = db.db.Exec("VACUUM ANALYZE"); err != nil {
+		db.log.Printf("[ERROR] Failed to execute VACUUM ANALYZE: %s\n",
+			err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) PerformMaintenance() error
+
+// Begin begins an explicit database transaction.
+// Only one transaction can be in progress at once, attempting to start one,
+// while another transaction is already in progress will yield
+// database.ErrTxInProgress.
+func (db *Database) Begin() error {
+	var err error
+
+	db.log.Printf("[DEBUG] PostgreSQL#%d Begin Transaction\n",
+		db.id)
+
+	if db.tx != nil {
+		return database.ErrTxInProgress
+	} else if db.tx, err = db.db.Begin(); err != nil {
+		db.log.Printf("[ERROR] Failed to start transaction: %s\n",
+			err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) Begin() error
+
+// Rollback terminates a pending transaction, undoing any changes to the
+// database made during that transaction.
+// If no transaction is active, it returns database.ErrNoTxInProgress
+func (db *Database) Rollback() error {
+	var err error
+
+	db.log.Printf("[DEBUG] PostgreSQL#%d Roll back Transaction\n",
+		db.id)
+
+	if db.tx == nil {
+		return database.ErrNoTxInProgress
+	} else if err = db.tx.Rollback(); err != nil {
+		return fmt.Errorf("Cannot roll back database transaction: %s",
+			err.Error())
+	}
+
+	db.tx = nil
+	return nil
+} // func (db *Database) Rollback() error
+
+// Commit ends the active transaction, making any changes made during that
+// transaction permanent and visible to other connections.
+// If no transaction is active, it returns database.ErrNoTxInProgress
+func (db *Database) Commit() error {
+	var err error
+
+	db.log.Printf("[DEBUG] PostgreSQL#%d Commit Transaction\n",
+		db.id)
+
+	if db.tx == nil {
+		return database.ErrNoTxInProgress
+	} else if err = db.tx.Commit(); err != nil {
+		return fmt.Errorf("Cannot commit transaction: %s",
+			err.Error())
+	}
+
+	db.tx = nil
+	return nil
+} // func (db *Database) Commit() error
+
+// InTransaction returns true if a transaction is in progress.
+func (db *Database) InTransaction() bool {
+	return db.tx != nil
+} // func (db *Database) InTransaction() bool
+
+// HostAdd adds a new Host to the database.
+func (db *Database) HostAdd(h *model.Host) error {
+	const qid query.ID = query.HostAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+		id   int64
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(h.Name, h.LastSeen.Unix()).Scan(&id); err != nil {
+		err = fmt.Errorf("Cannot add Host %s to database: %s",
+			h.Name,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	h.ID = id
+	return nil
+} // func (db *Database) HostAdd(h *model.Host) error
+
+// HostGetByName looks up a Host by its name.
+func (db *Database) HostGetByName(name string) (*model.Host, error) {
+	const qid query.ID = query.HostGetByName
+	var (
+		err                              error
+		stmt                             *sql.Stmt
+		timestamp, lastRecord, threshold int64
+		h                                = &model.Host{Name: name}
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if err = stmt.QueryRow(name).Scan(&h.ID, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			db.log.Printf("[INFO] Host %s was not found in database\n", name)
+			return nil, nil
+		}
+
+		err = fmt.Errorf("Error scanning row for Host %s: %s",
+			name,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	database.SetHostStamps(h, timestamp, lastRecord, threshold)
+	return h, nil
+} // func (db *Database) HostGetByName(name string) (*model.Host, error)
+
+// HostGetByID fetches a Host by its ID.
+func (db *Database) HostGetByID(id int64) (*model.Host, error) {
+	const qid query.ID = query.HostGetByID
+	var (
+		err                              error
+		stmt                             *sql.Stmt
+		timestamp, lastRecord, threshold int64
+		h                                = &model.Host{ID: id}
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if err = stmt.QueryRow(id).Scan(&h.Name, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			db.log.Printf("[INFO] Host %d was not found in database\n", id)
+			return nil, nil
+		}
+
+		err = fmt.Errorf("Error scanning row for Host %d: %s",
+			id,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	}
+
+	database.SetHostStamps(h, timestamp, lastRecord, threshold)
+	return h, nil
+} // func (db *Database) HostGetByID(id int64) (*model.Host, error)
+
+// HostGetAll fetches all Hosts
+func (db *Database) HostGetAll() ([]model.Host, error) {
+	const qid query.ID = query.HostGetAll
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var hosts = make([]model.Host, 0)
+
+	for rows.Next() {
+		var (
+			h                                model.Host
+			timestamp, lastRecord, threshold int64
+		)
+
+		if err = rows.Scan(&h.ID, &h.Name, &timestamp, &lastRecord, &threshold, &h.Maintenance); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		database.SetHostStamps(&h, timestamp, lastRecord, threshold)
+		hosts = append(hosts, h)
+	}
+
+	return hosts, rows.Err()
+} // func (db *Database) HostGetAll() ([]model.Host, error)
+
+// HostUpdateLastSeen updates the timestamp a Host was last seen by the Server.
+func (db *Database) HostUpdateLastSeen(h *model.Host, timestamp time.Time) error {
+	const qid query.ID = query.HostUpdateLastSeen
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if _, err = stmt.Exec(timestamp.Unix(), h.ID); err != nil {
+		err = fmt.Errorf("Cannot update LastSeen of Host %s: %s",
+			h.Name,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	h.LastSeen = timestamp
+	return nil
+} // func (db *Database) HostUpdateLastSeen(h *model.Host, timestamp time.Time) error
+
+// HostUpdateLastRecord updates the timestamp a Host last delivered new
+// Records.
+func (db *Database) HostUpdateLastRecord(h *model.Host, timestamp time.Time) error {
+	if err := db.exec(query.HostUpdateLastRecord, timestamp.Unix(), h.ID); err != nil {
+		return err
+	}
+
+	h.LastRecord = timestamp
+	return nil
+} // func (db *Database) HostUpdateLastRecord(h *model.Host, timestamp time.Time) error
+
+// HostSetWatch saves the SilenceThreshold and Maintenance flag of a Host.
+func (db *Database) HostSetWatch(h *model.Host) error {
+	return db.exec(query.HostSetWatch,
+		int64(h.SilenceThreshold/time.Second),
+		h.Maintenance,
+		h.ID)
+} // func (db *Database) HostSetWatch(h *model.Host) error
+
+// RecordAdd adds a new Record to the Database.
+func (db *Database) RecordAdd(r *model.Record) error {
+	const qid query.ID = query.RecordAdd
+	var (
+		err         error
+		stmt        *sql.Stmt
+		id          int64
+		params      sql.NullString
+		tmpl, plist = model.SplitMessage(r.Message)
+	)
+
+	if len(plist) > 0 {
+		var buf []byte
+		if buf, err = json.Marshal(plist); err != nil {
+			db.log.Printf("[ERROR] Cannot serialize parameters of Record: %s\n",
+				err.Error())
+			return err
+		}
+		params = sql.NullString{String: string(buf), Valid: true}
+	}
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(r.HostID, r.Time.Unix(), r.Source, tmpl, params, r.Checksum()).Scan(&id); err != nil {
+		err = fmt.Errorf("Cannot add Record to database: %s",
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	r.ID = id
+	return nil
+} // func (db *Database) RecordAdd(r *model.Record) error
+
+// queryRecords runs a query that returns a list of Records.
+func (db *Database) queryRecords(qid query.ID, args ...any) ([]model.Record, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(args...); err != nil {
+		db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var records = make([]model.Record, 0)
+
+	for rows.Next() {
+		var r model.Record
+
+		if err = scanRecord(rows, &r); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+} // func (db *Database) queryRecords(qid query.ID, args ...any) ([]model.Record, error)
+
+// scanRecord scans a row returned by one of the Record queries. The message
+// is reassembled from its template and parameters.
+func scanRecord(rows *sql.Rows, r *model.Record) error {
+	var (
+		err       error
+		timestamp int64
+		pattern   string
+		params    sql.NullString
+		plist     []string
+	)
+
+	if err = rows.Scan(&r.ID, &r.HostID, &timestamp, &r.Source, &pattern, &params); err != nil {
+		return err
+	} else if params.Valid {
+		if err = json.Unmarshal([]byte(params.String), &plist); err != nil {
+			return fmt.Errorf("Cannot parse parameters of Record %d: %s",
+				r.ID,
+				err.Error())
+		}
+	}
+
+	r.Time = time.Unix(timestamp, 0)
+	r.Message = model.JoinMessage(pattern, plist)
+	return nil
+} // func scanRecord(rows *sql.Rows, r *model.Record) error
+
+// RecordGetByHost fetches the <max> most recent records for a given Host.
+func (db *Database) RecordGetByHost(h *model.Host, max int64) ([]model.Record, error) {
+	return db.queryRecords(query.RecordGetByHost, h.ID, limit(max))
+} // func (db *Database) RecordGetByHost(h *model.Host, max int64) ([]model.Record, error)
+
+// RecordGetByPeriod fetches all records for the given period, ordered by their timestamps.
+func (db *Database) RecordGetByPeriod(begin, end time.Time) ([]model.Record, error) {
+	return db.queryRecords(query.RecordGetByPeriod, begin.Unix(), end.Unix())
+} // func (db *Database) RecordGetByPeriod(begin, end time.Time) ([]model.Record, error)
+
+// RecordGetRecent fetches the <max> most recent Records from the database.
+// A negative number returns ALL records, which should probably be avoided.
+func (db *Database) RecordGetRecent(max int64) ([]model.Record, error) {
+	return db.queryRecords(query.RecordGetRecent, limit(max))
+} // func (db *Database) RecordGetRecent(max int64) ([]model.Record, error)
+
+// RecordGetPage returns a page of Records, most recent first.
+func (db *Database) RecordGetPage(page *database.RecordPage) ([]model.Record, error) {
+	var (
+		err            error
+		records        []model.Record
+		stamp, id      int64
+		hosts, sources sql.NullString
+	)
+
+	stamp, id, hosts, sources = page.Params()
+
+	if !page.Newer || page.Stamp.IsZero() {
+		return db.queryRecords(query.RecordPageOlder, stamp, id, hosts, sources, limit(page.Count))
+	} else if records, err = db.queryRecords(query.RecordPageNewer, stamp, id, hosts, sources, limit(page.Count)); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(records)
+	return records, nil
+} // func (db *Database) RecordGetPage(page *database.RecordPage) ([]model.Record, error)
+
+// RecordGetByIDList fetches the Records with the given IDs, most recent first.
+func (db *Database) RecordGetByIDList(ids []int64) ([]model.Record, error) {
+	return db.queryRecords(query.RecordGetByIDList, pq.Array(ids))
+} // func (db *Database) RecordGetByIDList(ids []int64) ([]model.Record, error)
+
+// RecordGetContext returns the Record with the given ID, along with up to
+// <before> Records its Host logged before it and up to <after> Records it
+// logged after it, in chronological order. If sameSource is true, only
+// Records from the same source are included.
+// If there is no Record with the given ID, it returns nil.
+func (db *Database) RecordGetContext(id, before, after int64, sameSource bool) ([]model.Record, error) {
+	var (
+		err        error
+		list       []model.Record
+		prev, next []model.Record
+		src        sql.NullString
+		r          *model.Record
+		records    []model.Record
+	)
+
+	if list, err = db.RecordGetByIDList([]int64{id}); err != nil {
+		return nil, err
+	} else if len(list) == 0 {
+		return nil, nil
+	}
+
+	r = &list[0]
+
+	if sameSource {
+		src = sql.NullString{String: r.Source, Valid: true}
+	}
+
+	if prev, err = db.queryRecords(query.RecordGetBefore, r.HostID, r.Time.Unix(), r.ID, src, before); err != nil {
+		return nil, err
+	} else if next, err = db.queryRecords(query.RecordGetAfter, r.HostID, r.Time.Unix(), r.ID, src, after); err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(prev)
+
+	records = make([]model.Record, 0, len(prev)+len(next)+1)
+	records = append(records, prev...)
+	records = append(records, *r)
+	records = append(records, next...)
+
+	return records, nil
+} // func (db *Database) RecordGetContext(id, before, after int64, sameSource bool) ([]model.Record, error)
+
+// RecordGetMostRecent returns the timestamp of the youngest record for a given host.
+func (db *Database) RecordGetMostRecent(hostID int64) (time.Time, error) {
+	const qid query.ID = query.RecordGetMostRecent
+	var (
+		err     error
+		stmt    *sql.Stmt
+		seconds int64
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return time.Time{}, err
+	} else if err = stmt.QueryRow(hostID).Scan(&seconds); err != nil {
+		err = fmt.Errorf("Failed to extract timestamp (INTEGER) from database: %s",
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return time.Time{}, err
+	}
+
+	return time.Unix(seconds, 0), nil
+} // func (db *Database) RecordGetMostRecent(hostID int64) (time.Time, error)
+
+// RecordCheckExist returns true if the given Record already exists in the database.
+func (db *Database) RecordCheckExist(r *model.Record) (bool, error) {
+	const qid query.ID = query.RecordCheckExist
+	var (
+		err  error
+		stmt *sql.Stmt
+		cnt  int64
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return false, err
+	} else if err = stmt.QueryRow(r.Checksum()).Scan(&cnt); err != nil {
+		err = fmt.Errorf("Failed to check for Record with checksum %s: %s",
+			r.Checksum(),
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return false, err
+	}
+
+	return cnt > 0, nil
+} // func (db *Database) RecordCheckExist(r *model.Record) (bool, error)
+
+// RecordGetSources returns a map of all the distinct sources occurring in the database
+// and their respective frequencies.
+func (db *Database) RecordGetSources() (map[string]int64, error) {
+	const qid query.ID = query.RecordGetSources
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var sources = make(map[string]int64)
+
+	for rows.Next() {
+		var (
+			src string
+			cnt int64
+		)
+
+		if err = rows.Scan(&src, &cnt); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		sources[src] = cnt
+	}
+
+	return sources, rows.Err()
+} // func (db *Database) RecordGetSources() (map[string]int64, error)
+
+// RecordGetRates returns the number of Records each Host logged from each
+// source per period of the given width between begin and end. The periods
+// start at begin.
+func (db *Database) RecordGetRates(begin, end time.Time, width time.Duration) ([]model.RateCount, error) {
+	const qid query.ID = query.RecordGetRates
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		secs = int64(width / time.Second)
+		list = make([]model.RateCount, 0)
+	)
+
+	if secs < 1 {
+		return nil, fmt.Errorf("Invalid width for counting Records: %s", width)
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(begin.Unix(), end.Unix(), secs); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var (
+			c      model.RateCount
+			period int64
+		)
+
+		if err = rows.Scan(&c.HostID, &c.Source, &period, &c.Count); err != nil {
+			err = fmt.Errorf("Failed to scan row: %w", err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		c.Begin = time.Unix(period, 0)
+		list = append(list, c)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) RecordGetRates(begin, end time.Time, width time.Duration) ([]model.RateCount, error)
+
+// RecordSearch searches the Records in the database according to the query.
+// Matching Records are sent to the channel, most recent first. If the
+// search fails, the error is recorded in prog.
+func (db *Database) RecordSearch(ctx context.Context, search *model.SearchQuery, q chan<- model.Record, prog *database.SearchProgress) {
+	const qid query.ID = query.RecordScan
+	var (
+		err            error
+		stmt           *sql.Stmt
+		rows           *sql.Rows
+		cnt            int64
+		begin, end     int64
+		hosts, sources sql.NullString
+	)
+
+	defer close(q)
+
+	if prog == nil {
+		prog = new(database.SearchProgress)
+	}
+
+	// If the search fails, the caller needs to know, or it would take the
+	// Records it got so far for all there is.
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			prog.Fail(err)
+		}
+	}()
+
+	if err = database.CompileSearch(db, search); err != nil {
+		db.log.Printf("[ERROR] Cannot compile search query %q: %s\n",
+			search.Query,
+			err.Error())
+		return
+	}
+
+	begin, end, hosts, sources = database.ScanParams(search)
+
+	if stmt, err = db.getStmt(query.RecordScanCount); err != nil {
+		return
+	} else if err = stmt.QueryRowContext(ctx, begin, end, hosts, sources).Scan(&cnt); err != nil {
+		db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+			query.RecordScanCount,
+			err.Error())
+		return
+	}
+
+	prog.Total.Store(cnt)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return
+	} else if rows, err = stmt.QueryContext(ctx, begin, end, hosts, sources); err != nil {
+		if ctx.Err() == nil {
+			db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+				qid,
+				err.Error())
+		}
+		return
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var r model.Record
+
+		if err = scanRecord(rows, &r); err != nil {
+			db.log.Printf("[ERROR] Failed to scan row: %s\n", err.Error())
+			return
+		}
+
+		prog.Scanned.Add(1)
+
+		if search.Match(&r) {
+			prog.Matched.Add(1)
+
+			select {
+			case q <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil && ctx.Err() == nil {
+		db.log.Printf("[ERROR] Failed to read Records: %s\n", err.Error())
+	}
+} // func (db *Database) RecordSearch(ctx context.Context, search *model.SearchQuery, q chan<- model.Record, prog *database.SearchProgress)
+
+// SearchAdd adds a Search to the database, including both the query and the results.
+func (db *Database) SearchAdd(search *model.Search) error {
+	const qid query.ID = query.SearchAdd
+	var (
+		err                  error
+		stmt                 *sql.Stmt
+		bufQuery, bufResults []byte
+		aggregates           sql.NullString
+		id                   int64
+	)
+
+	if bufQuery, err = json.Marshal(&search.Query); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Query to JSON: %s\n",
+			err.Error())
+		return err
+	} else if bufResults, err = json.Marshal(search.Results); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Results to JSON: %s\n",
+			err.Error())
+		return err
+	} else if aggregates, err = database.EncodeAggregates(search.Aggregates); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Aggregates to JSON: %s\n",
+			err.Error())
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(
+		search.Timestamp.Unix(),
+		string(bufQuery),
+		string(bufResults),
+		len(search.Results),
+		aggregates,
+		search.Title,
+		search.Description).Scan(&id); err != nil {
+		err = fmt.Errorf("Cannot add Search to database: %s",
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	search.ID = id
+	return nil
+} // func (db *Database) SearchAdd(search *model.Search) error
+
+// SearchUpdate saves the Title, Description, Query and results of a Search
+// that is already in the database.
+func (db *Database) SearchUpdate(search *model.Search) error {
+	const qid query.ID = query.SearchUpdate
+	var (
+		err                  error
+		stmt                 *sql.Stmt
+		bufQuery, bufResults []byte
+		aggregates           sql.NullString
+		res                  sql.Result
+		cnt                  int64
+	)
+
+	if bufQuery, err = json.Marshal(&search.Query); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Query to JSON: %s\n",
+			err.Error())
+		return err
+	} else if bufResults, err = json.Marshal(search.Results); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Results to JSON: %s\n",
+			err.Error())
+		return err
+	} else if aggregates, err = database.EncodeAggregates(search.Aggregates); err != nil {
+		db.log.Printf("[ERROR] Cannot serialize Aggregates to JSON: %s\n",
+			err.Error())
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if res, err = stmt.Exec(
+		search.Timestamp.Unix(),
+		string(bufQuery),
+		string(bufResults),
+		len(search.Results),
+		aggregates,
+		search.Title,
+		search.Description,
+		search.Expired,
+		search.ID); err != nil {
+		err = fmt.Errorf("Cannot update Search %d: %s",
+			search.ID,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return fmt.Errorf("No Search with ID %d was found in the database", search.ID)
+	}
+
+	search.Count = int64(len(search.Results))
+	return nil
+} // func (db *Database) SearchUpdate(search *model.Search) error
+
+// SearchDelete removes a Search from the database.
+func (db *Database) SearchDelete(id int64) error {
+	const qid query.ID = query.SearchDelete
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if _, err = stmt.Exec(id); err != nil {
+		err = fmt.Errorf("Cannot delete Search %d from database: %s",
+			id,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) SearchDelete(id int64) error
+
+// SearchExpire drops the results of all Searches that were run before the
+// given time, and deletes the ones that do not have a Title.
+func (db *Database) SearchExpire(before time.Time) (int64, error) {
+	var (
+		err   error
+		total int64
+	)
+
+	for _, qid := range []query.ID{query.SearchExpireDelete, query.SearchExpireResults} {
+		var (
+			stmt *sql.Stmt
+			res  sql.Result
+			cnt  int64
+		)
+
+		if stmt, err = db.getStmt(qid); err != nil {
+			return 0, err
+		} else if res, err = stmt.Exec(before.Unix()); err != nil {
+			err = fmt.Errorf("Cannot expire Searches: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return 0, err
+		} else if cnt, err = res.RowsAffected(); err != nil {
+			return 0, err
+		}
+
+		total += cnt
+	}
+
+	return total, nil
+} // func (db *Database) SearchExpire(before time.Time) (int64, error)
+
+// SearchGetByID fetches a Search by its ID
+func (db *Database) SearchGetByID(id int64) (*model.Search, error) {
+	const qid query.ID = query.SearchGetByID
+	var (
+		err        error
+		stmt       *sql.Stmt
+		timestamp  int64
+		qstr, rstr string
+		astr       sql.NullString
+		s          = &model.Search{ID: id}
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if err = stmt.QueryRow(id).Scan(
+		&timestamp,
+		&qstr,
+		&rstr,
+		&s.Count,
+		&astr,
+		&s.Title,
+		&s.Description,
+		&s.Expired); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			db.log.Printf("[INFO] Search #%d was not found in database\n", id)
+			return nil, nil
+		}
+
+		err = fmt.Errorf("Error scanning row for Search %d: %s",
+			id,
+			err.Error())
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return nil, err
+	} else if err = json.Unmarshal([]byte(qstr), &s.Query); err != nil {
+		db.log.Printf("[ERROR] Cannot parse Query: %s\n\n%s\n\n",
+			err.Error(),
+			qstr)
+		return nil, err
+	} else if err = json.Unmarshal([]byte(rstr), &s.Results); err != nil {
+		db.log.Printf("[ERROR] Cannot parse Results: %s\n\n%s\n\n",
+			err.Error(),
+			rstr)
+		return nil, err
+	} else if s.Aggregates, err = database.DecodeAggregates(astr); err != nil {
+		db.log.Printf("[ERROR] Cannot parse Aggregates: %s\n\n%s\n\n",
+			err.Error(),
+			astr.String)
+		return nil, err
+	}
+
+	s.Timestamp = time.Unix(timestamp, 0)
+	return s, nil
+} // func (db *Database) SearchGetByID(id int64) (*model.Search, error)
+
+// SearchGetResults fetches the Records that were matched by a Search.
+func (db *Database) SearchGetResults(id, offset, cnt int64) ([]model.Record, error) {
+	const qid query.ID = query.SearchGetResultIDs
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		ids  = make([]int64, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id, limit(cnt), offset); err != nil {
+		db.log.Printf("[ERROR] Failed to execute query %s: %s\n",
+			qid,
+			err.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var rid int64
+
+		if err = rows.Scan(&rid); err != nil {
+			rows.Close() // nolint: errcheck,gosec
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, rid)
+	}
+
+	rows.Close() // nolint: errcheck,gosec
+
+	return db.RecordGetByIDList(ids)
+} // func (db *Database) SearchGetResults(id, offset, cnt int64) ([]model.Record, error)
+
+// SearchGetAllID fetches the IDs and the number of results of all searches in the database.
+func (db *Database) SearchGetAllID() ([][2]int64, error) {
+	const qid query.ID = query.SearchGetAllID
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var idlist = make([][2]int64, 0)
+
+	for rows.Next() {
+		var id, cnt int64
+
+		if err = rows.Scan(&id, &cnt); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		idlist = append(idlist, [2]int64{id, cnt})
+	}
+
+	return idlist, rows.Err()
+} // func (db *Database) SearchGetAllID() ([][2]int64, error)
+
+// SearchGetAll fetches all Searches, most recent first, without their
+// Query, Results, or Aggregates.
+func (db *Database) SearchGetAll() ([]model.Search, error) {
+	const qid query.ID = query.SearchGetAll
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	var searches = make([]model.Search, 0)
+
+	for rows.Next() {
+		var (
+			timestamp int64
+			s         model.Search
+		)
+
+		if err = rows.Scan(
+			&s.ID,
+			&timestamp,
+			&s.Count,
+			&s.Title,
+			&s.Description,
+			&s.Expired); err != nil {
+			err = fmt.Errorf("Failed to scan row: %s", err.Error())
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		s.Timestamp = time.Unix(timestamp, 0)
+		searches = append(searches, s)
+	}
+
+	return searches, rows.Err()
+} // func (db *Database) SearchGetAll() ([]model.Search, error)
+
+// SearchGetResultCount returns the number of Records returned by the given Search.
+func (db *Database) SearchGetResultCount(id int64) (int64, error) {
+	const qid query.ID = query.SearchGetResultCount
+	var (
+		err  error
+		stmt *sql.Stmt
+		cnt  int64
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return 0, err
+	} else if err = stmt.QueryRow(id).Scan(&cnt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("No Search with ID %d was found in the database", id)
+		}
+		return 0, err
+	}
+
+	return cnt, nil
+} // func (db *Database) SearchGetResultCount(id int64) (int64, error)
+
+var _ database.Storage = (*Database)(nil)
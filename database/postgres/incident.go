@@ -0,0 +1,234 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/incident.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 15:34:51 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// IncidentAdd adds a new Incident to the database.
+func (db *Database) IncidentAdd(i *model.Incident) error {
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+	)
+
+	if i.Created.IsZero() {
+		i.Created = time.Now()
+	}
+
+	if args, err = database.IncidentParams(i); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(query.IncidentAdd); err != nil {
+		return err
+	} else if err = stmt.QueryRow(append(args, i.Created.Unix())...).Scan(&i.ID); err != nil {
+		err = fmt.Errorf("Cannot add Incident %q: %w", i.Title, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) IncidentAdd(i *model.Incident) error
+
+// IncidentUpdate saves the changes to an existing Incident.
+func (db *Database) IncidentUpdate(i *model.Incident) error {
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = database.IncidentParams(i); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(query.IncidentUpdate); err != nil {
+		return err
+	} else if res, err = stmt.Exec(append(args, i.ID)...); err != nil {
+		err = fmt.Errorf("Cannot update Incident %d: %w", i.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return fmt.Errorf("No Incident with ID %d was found in the database", i.ID)
+	}
+
+	return nil
+} // func (db *Database) IncidentUpdate(i *model.Incident) error
+
+// IncidentDelete removes an Incident from the database, along with its
+// pinned Records and Searches.
+func (db *Database) IncidentDelete(id int64) error {
+	return db.exec(query.IncidentDelete, id)
+} // func (db *Database) IncidentDelete(id int64) error
+
+// IncidentGetAll returns all Incidents, most recent first.
+func (db *Database) IncidentGetAll() ([]model.Incident, error) {
+	return db.incidentQuery(query.IncidentGetAll)
+} // func (db *Database) IncidentGetAll() ([]model.Incident, error)
+
+// IncidentGetByID returns the Incident with the given ID, or nil if it
+// does not exist.
+func (db *Database) IncidentGetByID(id int64) (*model.Incident, error) {
+	var (
+		err       error
+		incidents []model.Incident
+	)
+
+	if incidents, err = db.incidentQuery(query.IncidentGetByID, id); err != nil {
+		return nil, err
+	} else if len(incidents) == 0 {
+		return nil, nil
+	}
+
+	return &incidents[0], nil
+} // func (db *Database) IncidentGetByID(id int64) (*model.Incident, error)
+
+func (db *Database) incidentQuery(qid query.ID, args ...any) ([]model.Incident, error) {
+	var (
+		err       error
+		stmt      *sql.Stmt
+		rows      *sql.Rows
+		incidents = make([]model.Incident, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(args...); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var i *model.Incident
+
+		if i, err = database.ScanIncident(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		incidents = append(incidents, *i)
+	}
+
+	return incidents, rows.Err()
+} // func (db *Database) incidentQuery(qid query.ID, args ...any) ([]model.Incident, error)
+
+// IncidentPinRecord pins a Record to an Incident. If the Record is pinned
+// already, only its Note is updated.
+func (db *Database) IncidentPinRecord(p *model.Pin) error {
+	var err error
+
+	if p.Pinned.IsZero() {
+		p.Pinned = time.Now()
+	}
+
+	if err = db.exec(query.IncidentPinRecord,
+		p.IncidentID,
+		p.RecordID,
+		p.HostID,
+		p.Time.Unix(),
+		p.Source,
+		p.Message,
+		p.Note,
+		p.Pinned.Unix()); err != nil {
+		return fmt.Errorf("Cannot pin Record %d to Incident %d: %w",
+			p.RecordID,
+			p.IncidentID,
+			err)
+	}
+
+	return nil
+} // func (db *Database) IncidentPinRecord(p *model.Pin) error
+
+// IncidentUnpinRecord removes a Record from an Incident.
+func (db *Database) IncidentUnpinRecord(incidentID, recordID int64) error {
+	return db.exec(query.IncidentUnpinRecord, incidentID, recordID)
+} // func (db *Database) IncidentUnpinRecord(incidentID, recordID int64) error
+
+// IncidentGetPins returns the Records pinned to an Incident, oldest first.
+func (db *Database) IncidentGetPins(id int64) ([]model.Pin, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		pins = make([]model.Pin, 0)
+	)
+
+	if stmt, err = db.getStmt(query.IncidentGetPins); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var p *model.Pin
+
+		if p, err = database.ScanPin(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		pins = append(pins, *p)
+	}
+
+	return pins, rows.Err()
+} // func (db *Database) IncidentGetPins(id int64) ([]model.Pin, error)
+
+// IncidentPinSearch pins a saved Search to an Incident. If the Search is
+// pinned already, nothing happens.
+func (db *Database) IncidentPinSearch(incidentID, searchID int64) error {
+	return db.exec(query.IncidentPinSearch, incidentID, searchID, time.Now().Unix())
+} // func (db *Database) IncidentPinSearch(incidentID, searchID int64) error
+
+// IncidentUnpinSearch removes a Search from an Incident. The Search itself
+// is left alone.
+func (db *Database) IncidentUnpinSearch(incidentID, searchID int64) error {
+	return db.exec(query.IncidentUnpinSearch, incidentID, searchID)
+} // func (db *Database) IncidentUnpinSearch(incidentID, searchID int64) error
+
+// IncidentGetSearches returns the IDs of the Searches pinned to an
+// Incident, in the order they were pinned.
+func (db *Database) IncidentGetSearches(id int64) ([]int64, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		ids  = make([]int64, 0)
+	)
+
+	if stmt, err = db.getStmt(query.IncidentGetSearches); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var sid int64
+
+		if err = rows.Scan(&sid); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Search ID: %s\n", err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, sid)
+	}
+
+	return ids, rows.Err()
+} // func (db *Database) IncidentGetSearches(id int64) ([]int64, error)
@@ -0,0 +1,171 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/label.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-10 17:14:08 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// LabelSet labels a Record as interesting or not. If the Record already
+// has a Label, it is replaced.
+func (db *Database) LabelSet(l *model.Label) error {
+	var err error
+
+	if err = db.exec(query.LabelSet,
+		l.RecordID,
+		l.HostID,
+		l.Source,
+		l.Message,
+		l.Interesting,
+		l.Time.Unix()); err != nil {
+		return fmt.Errorf("Cannot label Record %d: %w", l.RecordID, err)
+	}
+
+	return nil
+} // func (db *Database) LabelSet(l *model.Label) error
+
+// LabelDelete removes the Label of a Record.
+func (db *Database) LabelDelete(id int64) error {
+	return db.exec(query.LabelDelete, id)
+} // func (db *Database) LabelDelete(id int64) error
+
+// LabelGetAll returns all Labels, in the order they were set.
+func (db *Database) LabelGetAll() ([]model.Label, error) {
+	return db.labelQuery(query.LabelGetAll)
+} // func (db *Database) LabelGetAll() ([]model.Label, error)
+
+// LabelGetByRecord returns the Label of a Record, or nil if it has none.
+func (db *Database) LabelGetByRecord(id int64) (*model.Label, error) {
+	var (
+		err    error
+		labels []model.Label
+	)
+
+	if labels, err = db.labelQuery(query.LabelGetByRecord, id); err != nil {
+		return nil, err
+	} else if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return &labels[0], nil
+} // func (db *Database) LabelGetByRecord(id int64) (*model.Label, error)
+
+func (db *Database) labelQuery(qid query.ID, args ...any) ([]model.Label, error) {
+	var (
+		err    error
+		stmt   *sql.Stmt
+		rows   *sql.Rows
+		labels = make([]model.Label, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(args...); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var l *model.Label
+
+		if l, err = database.ScanLabel(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		labels = append(labels, *l)
+	}
+
+	return labels, rows.Err()
+} // func (db *Database) labelQuery(qid query.ID, args ...any) ([]model.Label, error)
+
+// ScoreAdd saves the Scores the classifier assigned to Records, replacing
+// the previous Scores of the same Records.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) ScoreAdd(list []model.Score) error {
+	var (
+		err    error
+		stmt   *sql.Stmt
+		status bool
+	)
+
+	if len(list) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] %s\n", err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] %s\n", err2.Error())
+			}
+		}()
+	}
+
+	if stmt, err = db.getStmt(query.ScoreAdd); err != nil {
+		return err
+	}
+
+	for _, s := range list {
+		if _, err = stmt.Exec(s.RecordID, s.HostID, s.Time.Unix(), s.Value); err != nil {
+			err = fmt.Errorf("Cannot save Score of Record %d: %w",
+				s.RecordID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	status = true
+	return nil
+} // func (db *Database) ScoreAdd(list []model.Score) error
+
+// ScoreGetTop returns up to <max> Scores of Records since the given time,
+// the highest first.
+func (db *Database) ScoreGetTop(since time.Time, max int64) ([]model.Score, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Score, 0)
+	)
+
+	if stmt, err = db.getStmt(query.ScoreGetTop); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(since.Unix(), limit(max)); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var s *model.Score
+
+		if s, err = database.ScanScore(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *s)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) ScoreGetTop(since time.Time, max int64) ([]model.Score, error)
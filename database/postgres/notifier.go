@@ -0,0 +1,183 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/notifier.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 17:58:37 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// NotifierAdd adds a Notifier to the database.
+func (db *Database) NotifierAdd(n *model.Notifier) error {
+	const qid query.ID = query.NotifierAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+	)
+
+	if args, err = database.NotifierParams(n); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(args...).Scan(&n.ID); err != nil {
+		err = fmt.Errorf("Cannot add Notifier %q: %w", n.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) NotifierAdd(n *model.Notifier) error
+
+// NotifierUpdate saves the changes to an existing Notifier.
+func (db *Database) NotifierUpdate(n *model.Notifier) error {
+	const qid query.ID = query.NotifierUpdate
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = database.NotifierParams(n); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if res, err = stmt.Exec(append(args, n.ID)...); err != nil {
+		err = fmt.Errorf("Cannot update Notifier %d: %w", n.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return fmt.Errorf("No Notifier with ID %d was found in the database", n.ID)
+	}
+
+	return nil
+} // func (db *Database) NotifierUpdate(n *model.Notifier) error
+
+// NotifierDelete removes a Notifier from the database, along with the log
+// of its deliveries.
+func (db *Database) NotifierDelete(id int64) error {
+	return db.exec(query.NotifierDelete, id)
+} // func (db *Database) NotifierDelete(id int64) error
+
+// NotifierGetAll returns all Notifiers, ordered by name.
+func (db *Database) NotifierGetAll() ([]model.Notifier, error) {
+	const qid query.ID = query.NotifierGetAll
+	var (
+		err   error
+		stmt  *sql.Stmt
+		rows  *sql.Rows
+		notes = make([]model.Notifier, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var n *model.Notifier
+
+		if n, err = database.ScanNotifier(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		notes = append(notes, *n)
+	}
+
+	return notes, rows.Err()
+} // func (db *Database) NotifierGetAll() ([]model.Notifier, error)
+
+// NotifierGetByID looks up a Notifier by its ID. If there is no such
+// Notifier, it returns nil.
+func (db *Database) NotifierGetByID(id int64) (*model.Notifier, error) {
+	const qid query.ID = query.NotifierGetByID
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	return database.ScanNotifier(rows)
+} // func (db *Database) NotifierGetByID(id int64) (*model.Notifier, error)
+
+// DeliveryAdd adds an entry to the delivery log.
+func (db *Database) DeliveryAdd(d *model.Delivery) error {
+	const qid query.ID = query.DeliveryAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(database.DeliveryParams(d)...).Scan(&d.ID); err != nil {
+		err = fmt.Errorf("Cannot log Delivery for Notifier %d: %w",
+			d.NotifierID,
+			err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) DeliveryAdd(d *model.Delivery) error
+
+// DeliveryGetRecent returns up to <max> entries from the delivery log,
+// most recent first.
+func (db *Database) DeliveryGetRecent(max int64) ([]model.Delivery, error) {
+	const qid query.ID = query.DeliveryGetRecent
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Delivery, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(limit(max)); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var d *model.Delivery
+
+		if d, err = database.ScanDelivery(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *d)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) DeliveryGetRecent(max int64) ([]model.Delivery, error)
@@ -0,0 +1,70 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/novelty.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 08. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 16:48:20 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// noveltyAdd records when the Hosts first logged a message matching the
+// Pattern, unless they did so before. It is only called from
+// PatternAddRecords, within its transaction.
+func (db *Database) noveltyAdd(p *model.Pattern, records []model.Record) error {
+	var err error
+
+	for _, r := range database.NoveltyFirsts(records) {
+		if err = db.exec(query.NoveltyAdd, p.ID, r.HostID, r.Source, r.Time.Unix(), r.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+} // func (db *Database) noveltyAdd(p *model.Pattern, records []model.Record) error
+
+// NoveltyGetRecent returns the Novelties that were first seen since the
+// given time and have not been acknowledged, most recent first.
+func (db *Database) NoveltyGetRecent(since time.Time) ([]model.Novelty, error) {
+	const qid query.ID = query.NoveltyGetRecent
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Novelty, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(since.Unix()); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var n *model.Novelty
+
+		if n, err = database.ScanNovelty(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *n)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) NoveltyGetRecent(since time.Time) ([]model.Novelty, error)
+
+// NoveltyAcknowledge marks a Novelty as acknowledged, so it drops off the
+// feed.
+func (db *Database) NoveltyAcknowledge(id int64) error {
+	return db.exec(query.NoveltyAcknowledge, id)
+} // func (db *Database) NoveltyAcknowledge(id int64) error
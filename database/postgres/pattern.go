@@ -0,0 +1,255 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/pattern.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 16:50:12 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// PatternAdd adds a new Pattern to the database. Its FirstSeen and LastSeen
+// must be set, its Count starts at 0.
+func (db *Database) PatternAdd(p *model.Pattern) error {
+	const qid query.ID = query.PatternAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(p.Template, p.FirstSeen.Unix(), p.LastSeen.Unix()).Scan(&p.ID); err != nil {
+		err = fmt.Errorf("Cannot add Pattern %q: %w", p.Template, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	p.Count = 0
+	return nil
+} // func (db *Database) PatternAdd(p *model.Pattern) error
+
+// PatternUpdate saves the Template of a Pattern after it has changed.
+func (db *Database) PatternUpdate(p *model.Pattern) error {
+	return db.exec(query.PatternUpdate, p.Template, p.ID)
+} // func (db *Database) PatternUpdate(p *model.Pattern) error
+
+// PatternAddRecords records that the given Records match the Pattern. It
+// updates the counts of the Pattern along with its FirstSeen and
+// LastSeen, both in the database and in p. Records that were already
+// assigned a Pattern are not counted again. It also keeps track of when
+// each Host first logged a message matching the Pattern.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) PatternAddRecords(p *model.Pattern, records []model.Record) error {
+	var (
+		err         error
+		stmt        *sql.Stmt
+		res         sql.Result
+		n           int64
+		counts      map[int64]int64
+		first, last time.Time
+		seen        [2]int64
+		fresh       = make([]model.Record, 0, len(records))
+		status      bool
+	)
+
+	if len(records) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] %s\n", err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] %s\n", err2.Error())
+			}
+		}()
+	}
+
+	if stmt, err = db.getStmt(query.PatternRecordAdd); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		if res, err = stmt.Exec(r.ID, p.ID); err != nil {
+			err = fmt.Errorf("Cannot add Record %d to Pattern %d: %w",
+				r.ID,
+				p.ID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		} else if n, _ = res.RowsAffected(); n > 0 {
+			fresh = append(fresh, r)
+		}
+	}
+
+	if len(fresh) == 0 {
+		status = true
+		return nil
+	}
+
+	counts, first, last = database.PatternStats(fresh)
+
+	for stamp, cnt := range counts {
+		if err = db.exec(query.PatternCountAdd, p.ID, stamp, cnt); err != nil {
+			return err
+		}
+	}
+
+	if err = db.noveltyAdd(p, fresh); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(query.PatternSeen); err != nil {
+		return err
+	} else if err = stmt.QueryRow(first.Unix(), last.Unix(), len(fresh), p.ID).Scan(&seen[0], &seen[1], &p.Count); err != nil {
+		err = fmt.Errorf("Cannot update Pattern %d: %w", p.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	p.FirstSeen = time.Unix(seen[0], 0)
+	p.LastSeen = time.Unix(seen[1], 0)
+	status = true
+
+	return nil
+} // func (db *Database) PatternAddRecords(p *model.Pattern, records []model.Record) error
+
+// PatternGetAll returns all Patterns, the ones matching the most Records
+// first. Their Recent field holds the number of Records since the given
+// time.
+func (db *Database) PatternGetAll(since time.Time) ([]model.Pattern, error) {
+	const qid query.ID = query.PatternGetAll
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Pattern, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(since.Truncate(model.PatternBucket).Unix()); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var p *model.Pattern
+
+		if p, err = database.ScanPattern(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *p)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) PatternGetAll(since time.Time) ([]model.Pattern, error)
+
+// PatternGetByID looks up a Pattern by its ID. If there is no such
+// Pattern, it returns nil.
+func (db *Database) PatternGetByID(id int64) (*model.Pattern, error) {
+	const qid query.ID = query.PatternGetByID
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	return database.ScanPattern(rows)
+} // func (db *Database) PatternGetByID(id int64) (*model.Pattern, error)
+
+// PatternGetCounts returns the number of Records matching a Pattern per
+// model.PatternBucket since the given time. Buckets without any Records
+// are left out.
+func (db *Database) PatternGetCounts(id int64, begin time.Time) ([]model.Bucket, error) {
+	const qid query.ID = query.PatternGetCounts
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Bucket, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id, begin.Truncate(model.PatternBucket).Unix()); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var b *model.Bucket
+
+		if b, err = database.ScanBucket(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *b)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) PatternGetCounts(id int64, begin time.Time) ([]model.Bucket, error)
+
+// PatternGetRecordIDs returns the IDs of up to <max> Records matching a
+// Pattern, most recent first.
+func (db *Database) PatternGetRecordIDs(id, max int64) ([]int64, error) {
+	const qid query.ID = query.PatternGetRecordIDs
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		ids  = make([]int64, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(id, limit(max)); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var rid int64
+
+		if err = rows.Scan(&rid); err != nil {
+			db.log.Printf("[ERROR] Cannot scan Record ID: %s\n", err.Error())
+			return nil, err
+		}
+
+		ids = append(ids, rid)
+	}
+
+	return ids, rows.Err()
+} // func (db *Database) PatternGetRecordIDs(id, max int64) ([]int64, error)
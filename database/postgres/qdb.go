@@ -0,0 +1,705 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/qdb.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 14:53:40 krylon>
+
+package postgres
+
+import "github.com/blicero/scrollmaster/database/query"
+
+// Queries that return Records all return the same columns: id, host_id,
+// stamp, source, pattern and params.
+var qdb = map[query.ID]string{
+	query.HostAdd:              "INSERT INTO host (name, last_seen) VALUES ($1, $2) RETURNING id",
+	query.HostGetByName:        "SELECT id, last_seen, last_record, silence_threshold, maintenance FROM host WHERE name = $1",
+	query.HostGetByID:          "SELECT name, last_seen, last_record, silence_threshold, maintenance FROM host WHERE id = $1",
+	query.HostGetAll:           "SELECT id, name, last_seen, last_record, silence_threshold, maintenance FROM host ORDER BY name",
+	query.HostUpdateLastSeen:   "UPDATE host SET last_seen = $1 WHERE id = $2",
+	query.HostUpdateLastRecord: "UPDATE host SET last_record = $1 WHERE id = $2",
+	query.HostSetWatch:         "UPDATE host SET silence_threshold = $1, maintenance = $2 WHERE id = $3",
+	query.RecordAdd: `
+WITH src AS (
+    INSERT INTO source (name) VALUES ($3)
+    ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+    RETURNING id
+), tmpl AS (
+    INSERT INTO template (pattern) VALUES ($4)
+    ON CONFLICT ((md5(pattern))) DO UPDATE SET pattern = EXCLUDED.pattern
+    RETURNING id
+)
+INSERT INTO record (host_id, stamp, source_id, template_id, params, checksum)
+SELECT $1, $2, src.id, tmpl.id, $5::JSONB, $6
+FROM src, tmpl
+RETURNING id
+`,
+	query.RecordGetByHost: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = $1
+ORDER BY stamp DESC
+LIMIT $2
+`,
+	query.RecordGetByPeriod: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp BETWEEN $1 AND $2
+ORDER BY stamp
+`,
+	query.RecordGetMostRecent: `
+SELECT COALESCE(MAX(stamp), 0)
+FROM record
+WHERE host_id = $1
+`,
+	query.RecordCheckExist: "SELECT COUNT(id) FROM record WHERE checksum = $1",
+	query.RecordGetRecent: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+ORDER BY stamp DESC
+LIMIT $1
+`,
+	query.RecordGetSources: `
+SELECT
+    s.name,
+    COUNT(r.id) AS cnt
+FROM record r
+INNER JOIN source s ON r.source_id = s.id
+GROUP BY s.name
+ORDER BY s.name`,
+	query.RecordGetByIDList: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE id = ANY($1::BIGINT[])
+ORDER BY stamp DESC
+`,
+	query.RecordScan: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp BETWEEN $1 AND $2
+  AND ($3::JSONB IS NULL OR host_id IN (SELECT jsonb_array_elements_text($3::JSONB)::BIGINT))
+  AND ($4::JSONB IS NULL OR source IN (SELECT jsonb_array_elements_text($4::JSONB)))
+ORDER BY stamp DESC
+`,
+	query.RecordScanCount: `
+SELECT COUNT(*)
+FROM record_full
+WHERE stamp BETWEEN $1 AND $2
+  AND ($3::JSONB IS NULL OR host_id IN (SELECT jsonb_array_elements_text($3::JSONB)::BIGINT))
+  AND ($4::JSONB IS NULL OR source IN (SELECT jsonb_array_elements_text($4::JSONB)))
+`,
+	query.RecordGetBefore: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = $1
+  AND stamp <= $2
+  AND (stamp < $2 OR id < $3)
+  AND ($4::TEXT IS NULL OR source = $4::TEXT)
+ORDER BY stamp DESC, id DESC
+LIMIT $5
+`,
+	query.RecordGetAfter: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = $1
+  AND stamp >= $2
+  AND (stamp > $2 OR id > $3)
+  AND ($4::TEXT IS NULL OR source = $4::TEXT)
+ORDER BY stamp, id
+LIMIT $5
+`,
+	query.RecordPageOlder: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp <= $1 AND (stamp < $1 OR id < $2)
+  AND ($3::JSONB IS NULL OR host_id IN (SELECT jsonb_array_elements_text($3::JSONB)::BIGINT))
+  AND ($4::JSONB IS NULL OR source IN (SELECT jsonb_array_elements_text($4::JSONB)))
+ORDER BY stamp DESC, id DESC
+LIMIT $5
+`,
+	query.RecordPageNewer: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp >= $1 AND (stamp > $1 OR id > $2)
+  AND ($3::JSONB IS NULL OR host_id IN (SELECT jsonb_array_elements_text($3::JSONB)::BIGINT))
+  AND ($4::JSONB IS NULL OR source IN (SELECT jsonb_array_elements_text($4::JSONB)))
+ORDER BY stamp, id
+LIMIT $5
+`,
+	query.RecordGetRates: `
+SELECT
+    host_id,
+    source,
+    stamp - ((stamp - $1) % $3) AS period,
+    COUNT(id) AS cnt
+FROM record_full
+WHERE stamp >= $1 AND stamp < $2
+GROUP BY host_id, source, period
+`,
+	query.SearchAdd: `
+INSERT INTO search (timestamp, query, results, cnt, aggregates, title, description)
+            VALUES (       $1,    $2,      $3,  $4,         $5,    $6,          $7)
+RETURNING id
+`,
+	query.SearchGetByID: `
+SELECT
+    timestamp,
+    query,
+    results,
+    cnt,
+    aggregates,
+    title,
+    description,
+    expired
+FROM search
+WHERE id = $1
+`,
+	query.SearchDelete: "DELETE FROM search WHERE id = $1",
+	query.SearchGetResultIDs: `
+SELECT r.value::BIGINT
+FROM search s,
+     jsonb_array_elements_text(s.results) WITH ORDINALITY AS r(value, idx)
+WHERE s.id = $1
+ORDER BY r.idx
+LIMIT $2
+OFFSET $3
+`,
+	query.SearchGetAllID:       "SELECT id, cnt FROM search",
+	query.SearchGetResultCount: "SELECT cnt FROM search WHERE id = $1",
+	query.SearchGetAll: `
+SELECT
+    id,
+    timestamp,
+    cnt,
+    title,
+    description,
+    expired
+FROM search
+ORDER BY timestamp DESC, id DESC
+`,
+	query.SearchUpdate: `
+UPDATE search
+SET timestamp = $1,
+    query = $2,
+    results = $3,
+    cnt = $4,
+    aggregates = $5,
+    title = $6,
+    description = $7,
+    expired = $8
+WHERE id = $9
+`,
+	query.SearchExpireDelete: "DELETE FROM search WHERE timestamp < $1 AND title = ''",
+	query.SearchExpireResults: `
+UPDATE search
+SET results = '[]',
+    cnt = 0,
+    aggregates = NULL,
+    expired = TRUE
+WHERE timestamp < $1 AND NOT expired
+`,
+	query.AlertRuleAdd: `
+INSERT INTO alert_rule (name, description, query, threshold, period, per_host, active, silenced_until, kind)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id
+`,
+	query.AlertRuleUpdate: `
+UPDATE alert_rule
+SET name = $1,
+    description = $2,
+    query = $3,
+    threshold = $4,
+    period = $5,
+    per_host = $6,
+    active = $7,
+    silenced_until = $8,
+    kind = $9
+WHERE id = $10
+`,
+	query.AlertRuleDelete: "DELETE FROM alert_rule WHERE id = $1",
+	query.AlertRuleGetAll: `
+SELECT
+    id,
+    name,
+    description,
+    query,
+    threshold,
+    period,
+    per_host,
+    active,
+    silenced_until,
+    kind
+FROM alert_rule
+ORDER BY name
+`,
+	query.AlertRuleGetByID: `
+SELECT
+    id,
+    name,
+    description,
+    query,
+    threshold,
+    period,
+    per_host,
+    active,
+    silenced_until,
+    kind
+FROM alert_rule
+WHERE id = $1
+`,
+	query.AlertRuleSilence: "UPDATE alert_rule SET silenced_until = $1 WHERE id = $2",
+	query.AlertAdd: `
+INSERT INTO alert (rule_id, host_id, fired, last_seen, cnt, silenced)
+           VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`,
+	query.AlertUpdate: `
+UPDATE alert
+SET last_seen = $1,
+    cnt = $2
+WHERE id = $3 AND resolved IS NULL
+`,
+	query.AlertResolve: `
+UPDATE alert
+SET resolved = $1
+WHERE id = $2 AND resolved IS NULL
+`,
+	query.AlertGetOpen: `
+SELECT
+    id,
+    rule_id,
+    host_id,
+    fired,
+    last_seen,
+    resolved,
+    cnt,
+    silenced
+FROM alert
+WHERE resolved IS NULL
+ORDER BY fired DESC, id DESC
+`,
+	query.AlertGetHistory: `
+SELECT
+    id,
+    rule_id,
+    host_id,
+    fired,
+    last_seen,
+    resolved,
+    cnt,
+    silenced
+FROM alert
+ORDER BY fired DESC, id DESC
+LIMIT $1
+`,
+	query.NotifierAdd: `
+INSERT INTO notifier (name, kind, target, settings, template, active)
+              VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`,
+	query.NotifierUpdate: `
+UPDATE notifier
+SET name = $1,
+    kind = $2,
+    target = $3,
+    settings = $4,
+    template = $5,
+    active = $6
+WHERE id = $7
+`,
+	query.NotifierDelete: "DELETE FROM notifier WHERE id = $1",
+	query.NotifierGetAll: `
+SELECT
+    id,
+    name,
+    kind,
+    target,
+    settings,
+    template,
+    active
+FROM notifier
+ORDER BY name
+`,
+	query.NotifierGetByID: `
+SELECT
+    id,
+    name,
+    kind,
+    target,
+    settings,
+    template,
+    active
+FROM notifier
+WHERE id = $1
+`,
+	query.DeliveryAdd: `
+INSERT INTO delivery (notifier_id, alert_id, state, stamp, attempt, error)
+              VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`,
+	query.DeliveryGetRecent: `
+SELECT
+    id,
+    notifier_id,
+    alert_id,
+    state,
+    stamp,
+    attempt,
+    error
+FROM delivery
+ORDER BY stamp DESC, id DESC
+LIMIT $1
+`,
+	query.PatternAdd: `
+INSERT INTO pattern (template, first_seen, last_seen)
+             VALUES ($1, $2, $3)
+RETURNING id
+`,
+	query.PatternUpdate: "UPDATE pattern SET template = $1 WHERE id = $2",
+	query.PatternSeen: `
+UPDATE pattern
+SET first_seen = LEAST(first_seen, $1),
+    last_seen = GREATEST(last_seen, $2),
+    cnt = cnt + $3
+WHERE id = $4
+RETURNING first_seen, last_seen, cnt
+`,
+	query.PatternCountAdd: `
+INSERT INTO pattern_count (pattern_id, stamp, cnt)
+                   VALUES ($1, $2, $3)
+ON CONFLICT (pattern_id, stamp) DO UPDATE SET cnt = pattern_count.cnt + excluded.cnt
+`,
+	query.PatternRecordAdd: `
+INSERT INTO pattern_record (record_id, pattern_id) VALUES ($1, $2)
+ON CONFLICT (record_id) DO NOTHING
+`,
+	query.PatternGetAll: `
+SELECT
+    p.id,
+    p.template,
+    p.first_seen,
+    p.last_seen,
+    p.cnt,
+    COALESCE(SUM(c.cnt), 0) AS recent
+FROM pattern p
+LEFT OUTER JOIN pattern_count c ON p.id = c.pattern_id AND c.stamp >= $1
+GROUP BY p.id
+ORDER BY p.cnt DESC, p.id
+`,
+	query.PatternGetByID: `
+SELECT
+    p.id,
+    p.template,
+    p.first_seen,
+    p.last_seen,
+    p.cnt,
+    0 AS recent
+FROM pattern p
+WHERE p.id = $1
+`,
+	query.PatternGetCounts: `
+SELECT
+    stamp,
+    cnt
+FROM pattern_count
+WHERE pattern_id = $1 AND stamp >= $2
+ORDER BY stamp
+`,
+	query.PatternGetRecordIDs: `
+SELECT record_id
+FROM pattern_record
+WHERE pattern_id = $1
+ORDER BY record_id DESC
+LIMIT $2
+`,
+	query.NoveltyAdd: `
+INSERT INTO novelty (pattern_id, host_id, source, first_seen, record_id)
+             VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (pattern_id, host_id, source) DO UPDATE
+SET first_seen = excluded.first_seen,
+    record_id = excluded.record_id
+WHERE excluded.first_seen < novelty.first_seen
+`,
+	query.NoveltyGetRecent: `
+SELECT
+    n.id,
+    n.pattern_id,
+    p.template,
+    n.host_id,
+    n.source,
+    n.first_seen,
+    n.record_id,
+    n.acknowledged
+FROM novelty n
+INNER JOIN pattern p ON n.pattern_id = p.id
+WHERE n.first_seen >= $1 AND NOT n.acknowledged
+ORDER BY n.first_seen DESC, n.id DESC
+`,
+	query.NoveltyAcknowledge: "UPDATE novelty SET acknowledged = TRUE WHERE id = $1",
+	query.SignatureAdd: `
+INSERT INTO signature (name, category, severity, description, query, threshold, period, builtin, active)
+               VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id
+`,
+	query.SignatureUpdate: `
+UPDATE signature
+SET name = $1,
+    category = $2,
+    severity = $3,
+    description = $4,
+    query = $5,
+    threshold = $6,
+    period = $7,
+    builtin = $8,
+    active = $9
+WHERE id = $10
+`,
+	query.SignatureDelete: "DELETE FROM signature WHERE id = $1",
+	query.SignatureGetAll: `
+SELECT
+    id,
+    name,
+    category,
+    severity,
+    description,
+    query,
+    threshold,
+    period,
+    builtin,
+    active
+FROM signature
+ORDER BY category, name
+`,
+	query.DetectionAdd: `
+INSERT INTO detection (record_id, signature_id, host_id, stamp)
+               VALUES ($1, $2, $3, $4)
+ON CONFLICT (record_id, signature_id) DO NOTHING
+`,
+	query.DetectionGetRecent: `
+SELECT
+    record_id,
+    signature_id,
+    host_id,
+    stamp
+FROM detection
+WHERE stamp >= $1
+ORDER BY stamp DESC, record_id DESC
+LIMIT $2
+`,
+	query.DetectionGetByRecord: `
+SELECT
+    record_id,
+    signature_id,
+    host_id,
+    stamp
+FROM detection
+WHERE record_id = $1
+ORDER BY signature_id
+`,
+	query.LabelSet: `
+INSERT INTO label (record_id, host_id, source, message, interesting, stamp)
+           VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (record_id) DO UPDATE
+SET interesting = excluded.interesting,
+    stamp = excluded.stamp
+`,
+	query.LabelDelete: "DELETE FROM label WHERE record_id = $1",
+	query.LabelGetAll: `
+SELECT
+    record_id,
+    host_id,
+    source,
+    message,
+    interesting,
+    stamp
+FROM label
+ORDER BY stamp
+`,
+	query.LabelGetByRecord: `
+SELECT
+    record_id,
+    host_id,
+    source,
+    message,
+    interesting,
+    stamp
+FROM label
+WHERE record_id = $1
+`,
+	query.ScoreAdd: `
+INSERT INTO score (record_id, host_id, stamp, score)
+           VALUES ($1, $2, $3, $4)
+ON CONFLICT (record_id) DO UPDATE
+SET score = excluded.score
+`,
+	query.ScoreGetTop: `
+SELECT
+    record_id,
+    host_id,
+    stamp,
+    score
+FROM score
+WHERE stamp >= $1
+ORDER BY score DESC, stamp DESC
+LIMIT $2
+`,
+	query.AnnotationAdd: `
+INSERT INTO annotation (record_id, host_id, stamp, text)
+                VALUES ($1, $2, $3, $4)
+RETURNING id
+`,
+	query.AnnotationDelete: "DELETE FROM annotation WHERE id = $1",
+	query.AnnotationGetByRecords: `
+SELECT
+    id,
+    record_id,
+    host_id,
+    stamp,
+    text
+FROM annotation
+WHERE record_id = ANY($1::BIGINT[])
+ORDER BY stamp, id
+`,
+	query.TagAdd: `
+INSERT INTO tag (record_id, name, host_id, stamp)
+         VALUES ($1, $2, $3, $4)
+ON CONFLICT (record_id, name) DO NOTHING
+`,
+	query.TagDelete: "DELETE FROM tag WHERE record_id = $1 AND name = $2",
+	query.TagGetByRecords: `
+SELECT
+    record_id,
+    name,
+    host_id,
+    stamp
+FROM tag
+WHERE record_id = ANY($1::BIGINT[])
+ORDER BY name
+`,
+	query.TagGetAll: "SELECT name, record_id FROM tag ORDER BY name, record_id",
+	query.IncidentAdd: `
+INSERT INTO incident (title, summary, begin_stamp, end_stamp, status, created)
+              VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`,
+	query.IncidentUpdate: `
+UPDATE incident
+SET title = $1,
+    summary = $2,
+    begin_stamp = $3,
+    end_stamp = $4,
+    status = $5
+WHERE id = $6
+`,
+	query.IncidentDelete: "DELETE FROM incident WHERE id = $1",
+	query.IncidentGetAll: `
+SELECT
+    id,
+    title,
+    summary,
+    begin_stamp,
+    end_stamp,
+    status,
+    created
+FROM incident
+ORDER BY begin_stamp DESC, id DESC
+`,
+	query.IncidentGetByID: `
+SELECT
+    id,
+    title,
+    summary,
+    begin_stamp,
+    end_stamp,
+    status,
+    created
+FROM incident
+WHERE id = $1
+`,
+	query.IncidentPinRecord: `
+INSERT INTO incident_record (incident_id, record_id, host_id, stamp, source, message, note, pinned)
+                     VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (incident_id, record_id) DO UPDATE
+SET note = excluded.note
+`,
+	query.IncidentUnpinRecord: "DELETE FROM incident_record WHERE incident_id = $1 AND record_id = $2",
+	query.IncidentGetPins: `
+SELECT
+    incident_id,
+    record_id,
+    host_id,
+    stamp,
+    source,
+    message,
+    note,
+    pinned
+FROM incident_record
+WHERE incident_id = $1
+ORDER BY stamp, record_id
+`,
+	query.IncidentPinSearch: `
+INSERT INTO incident_search (incident_id, search_id, pinned)
+                     VALUES ($1, $2, $3)
+ON CONFLICT (incident_id, search_id) DO NOTHING
+`,
+	query.IncidentUnpinSearch: "DELETE FROM incident_search WHERE incident_id = $1 AND search_id = $2",
+	query.IncidentGetSearches: `
+SELECT search_id
+FROM incident_search
+WHERE incident_id = $1
+ORDER BY pinned, search_id
+`,
+}
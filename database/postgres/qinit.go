@@ -0,0 +1,439 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/qinit.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 15:01:26 krylon>
+
+package postgres
+
+// qMigrate contains the queries to create and upgrade the schema.
+// qMigrate[n] upgrades a database from version n to version n+1, so on an
+// empty database, all of them are run in order. The current version is
+// kept in the schema_version table.
+//
+// Timestamps are stored as seconds since the epoch, like in the SQLite
+// backend, so both backends can share the logic that deals with them.
+var qMigrate = [][]string{
+	// 0 -> 1
+	{
+		`
+CREATE TABLE host (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    last_seen           BIGINT NOT NULL DEFAULT 0
+)
+`,
+		`
+CREATE TABLE record (
+    id                  BIGSERIAL PRIMARY KEY,
+    host_id             BIGINT NOT NULL REFERENCES host (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    stamp               BIGINT NOT NULL DEFAULT 0,
+    source              TEXT NOT NULL,
+    message             TEXT NOT NULL,
+    checksum            TEXT UNIQUE NOT NULL
+)
+`,
+		"CREATE INDEX record_host_idx ON record (host_id, stamp)",
+		"CREATE INDEX record_stamp_idx ON record (stamp)",
+		"CREATE INDEX record_source_idx ON record (source)",
+		`
+CREATE TABLE search (
+    id                  BIGSERIAL PRIMARY KEY,
+    timestamp           BIGINT NOT NULL,
+    query               JSONB NOT NULL,
+    results             JSONB NOT NULL DEFAULT '[]',
+    cnt                 BIGINT NOT NULL DEFAULT 0,
+    CHECK (cnt >= 0)
+)
+`,
+		"CREATE INDEX search_time_idx ON search (timestamp)",
+	},
+	// 1 -> 2
+	//
+	// Sources and message templates are moved into tables of their own.
+	// Splitting the existing messages into templates and parameters would
+	// require the regular expression in model.SplitMessage, so existing
+	// messages become templates without parameters.
+	{
+		`
+CREATE TABLE source (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL
+)
+`,
+		`
+CREATE TABLE template (
+    id                  BIGSERIAL PRIMARY KEY,
+    pattern             TEXT NOT NULL
+)
+`,
+		// Templates can get long, too long for a B-Tree index on the
+		// pattern itself.
+		"CREATE UNIQUE INDEX template_pattern_idx ON template (md5(pattern))",
+		"INSERT INTO source (name) SELECT DISTINCT source FROM record",
+		"INSERT INTO template (pattern) SELECT DISTINCT message FROM record",
+		`
+ALTER TABLE record
+    ADD COLUMN source_id   BIGINT REFERENCES source (id)
+                                  ON UPDATE RESTRICT
+                                  ON DELETE RESTRICT,
+    ADD COLUMN template_id BIGINT REFERENCES template (id)
+                                  ON UPDATE RESTRICT
+                                  ON DELETE RESTRICT,
+    ADD COLUMN params      JSONB
+`,
+		`
+UPDATE record r
+SET source_id = s.id,
+    template_id = t.id
+FROM source s, template t
+WHERE s.name = r.source AND md5(t.pattern) = md5(r.message)
+`,
+		`
+ALTER TABLE record
+    ALTER COLUMN source_id SET NOT NULL,
+    ALTER COLUMN template_id SET NOT NULL,
+    DROP COLUMN source,
+    DROP COLUMN message
+`,
+		"CREATE INDEX record_source_idx ON record (source_id)",
+		"CREATE INDEX record_template_idx ON record (template_id)",
+		`
+CREATE VIEW record_full AS
+SELECT
+    r.id,
+    r.host_id,
+    r.stamp,
+    s.name AS source,
+    t.pattern,
+    r.params,
+    r.checksum
+FROM record r
+INNER JOIN source s ON r.source_id = s.id
+INNER JOIN template t ON r.template_id = t.id
+`,
+	},
+	// 2 -> 3
+	//
+	// Searches store the Aggregates of their results.
+	{
+		"ALTER TABLE search ADD COLUMN aggregates JSONB",
+	},
+	// 3 -> 4
+	//
+	// Searches can be named and described, and their results expire.
+	{
+		"ALTER TABLE search ADD COLUMN title TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE search ADD COLUMN description TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE search ADD COLUMN expired BOOLEAN NOT NULL DEFAULT FALSE",
+	},
+	// 4 -> 5
+	//
+	// Alert rules and the history of the Alerts they raised. There can
+	// only be one open Alert per rule and Host.
+	{
+		`
+CREATE TABLE alert_rule (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    query               JSONB NOT NULL,
+    threshold           BIGINT NOT NULL,
+    period              BIGINT NOT NULL,
+    per_host            BOOLEAN NOT NULL DEFAULT FALSE,
+    active              BOOLEAN NOT NULL DEFAULT TRUE,
+    silenced_until      BIGINT NOT NULL DEFAULT 0,
+    CHECK (threshold >= 0),
+    CHECK (period > 0)
+)
+`,
+		`
+CREATE TABLE alert (
+    id                  BIGSERIAL PRIMARY KEY,
+    rule_id             BIGINT NOT NULL REFERENCES alert_rule (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    host_id             BIGINT NOT NULL DEFAULT 0,
+    fired               BIGINT NOT NULL,
+    last_seen           BIGINT NOT NULL,
+    resolved            BIGINT,
+    cnt                 BIGINT NOT NULL DEFAULT 0,
+    silenced            BOOLEAN NOT NULL DEFAULT FALSE
+)
+`,
+		"CREATE UNIQUE INDEX alert_open_idx ON alert (rule_id, host_id) WHERE resolved IS NULL",
+		"CREATE INDEX alert_fired_idx ON alert (fired)",
+	},
+	// 5 -> 6
+	//
+	// Notifiers and the log of the messages they delivered. Deliveries of
+	// test messages have no alert_id.
+	{
+		`
+CREATE TABLE notifier (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    kind                SMALLINT NOT NULL,
+    target              TEXT NOT NULL,
+    settings            JSONB NOT NULL DEFAULT '{}',
+    template            TEXT NOT NULL DEFAULT '',
+    active              BOOLEAN NOT NULL DEFAULT TRUE
+)
+`,
+		`
+CREATE TABLE delivery (
+    id                  BIGSERIAL PRIMARY KEY,
+    notifier_id         BIGINT NOT NULL REFERENCES notifier (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    alert_id            BIGINT REFERENCES alert (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    state               SMALLINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    attempt             INTEGER NOT NULL,
+    error               TEXT
+)
+`,
+		"CREATE INDEX delivery_stamp_idx ON delivery (stamp)",
+	},
+	// 6 -> 7
+	//
+	// Watching for Hosts that go silent: When a Host last delivered
+	// Records, how long it may stay silent, and if it is down for
+	// maintenance, plus the kind of alert rules and a default rule that
+	// watches for silent Hosts.
+	{
+		`
+ALTER TABLE host
+    ADD COLUMN last_record       BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN silence_threshold BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN maintenance       BOOLEAN NOT NULL DEFAULT FALSE
+`,
+		"ALTER TABLE alert_rule ADD COLUMN kind SMALLINT NOT NULL DEFAULT 0",
+		`
+INSERT INTO alert_rule (name, description, query, threshold, period, per_host, active, kind)
+VALUES ('Host is silent',
+        'A Host has not contacted us or sent new Records for longer than its threshold.',
+        '{}', 0, 900, TRUE, TRUE, 1)
+`,
+	},
+	// 7 -> 8
+	//
+	// Patterns found by clustering the messages of incoming Records, the
+	// number of Records per Pattern and hour, and which Records match
+	// which Pattern.
+	{
+		`
+CREATE TABLE pattern (
+    id                  BIGSERIAL PRIMARY KEY,
+    template            TEXT NOT NULL,
+    first_seen          BIGINT NOT NULL,
+    last_seen           BIGINT NOT NULL,
+    cnt                 BIGINT NOT NULL DEFAULT 0,
+    CHECK (first_seen <= last_seen),
+    CHECK (cnt >= 0)
+)
+`,
+		`
+CREATE TABLE pattern_count (
+    pattern_id          BIGINT NOT NULL REFERENCES pattern (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    stamp               BIGINT NOT NULL,
+    cnt                 BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (pattern_id, stamp)
+)
+`,
+		`
+CREATE TABLE pattern_record (
+    record_id           BIGINT PRIMARY KEY REFERENCES record (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    pattern_id          BIGINT NOT NULL REFERENCES pattern (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE
+)
+`,
+		"CREATE INDEX pattern_record_pattern_idx ON pattern_record (pattern_id, record_id)",
+	},
+	// 8 -> 9
+	//
+	// When each Host first logged a message matching a Pattern from a
+	// given source. The Record may have been deleted since, so there is
+	// no foreign key on record_id.
+	{
+		`
+CREATE TABLE novelty (
+    id                  BIGSERIAL PRIMARY KEY,
+    pattern_id          BIGINT NOT NULL REFERENCES pattern (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    host_id             BIGINT NOT NULL REFERENCES host (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    source              TEXT NOT NULL,
+    first_seen          BIGINT NOT NULL,
+    record_id           BIGINT NOT NULL,
+    acknowledged        BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (pattern_id, host_id, source)
+)
+`,
+		"CREATE INDEX novelty_first_seen_idx ON novelty (first_seen)",
+	},
+	// 9 -> 10
+	//
+	// Signatures of well-known events and the Records that matched them.
+	{
+		`
+CREATE TABLE signature (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    category            TEXT NOT NULL,
+    severity            SMALLINT NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    query               JSONB NOT NULL,
+    threshold           BIGINT NOT NULL DEFAULT 0,
+    period              BIGINT NOT NULL DEFAULT 0,
+    builtin             BOOLEAN NOT NULL DEFAULT FALSE,
+    active              BOOLEAN NOT NULL DEFAULT TRUE,
+    CHECK (severity BETWEEN 0 AND 7),
+    CHECK (threshold >= 0),
+    CHECK (period >= 0)
+)
+`,
+		`
+CREATE TABLE detection (
+    record_id           BIGINT NOT NULL REFERENCES record (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    signature_id        BIGINT NOT NULL REFERENCES signature (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    host_id             BIGINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    PRIMARY KEY (record_id, signature_id)
+)
+`,
+		"CREATE INDEX detection_stamp_idx ON detection (stamp)",
+	},
+	// 10 -> 11
+	//
+	// Labels and the Scores of the classifier. Labels keep the text of
+	// their Record, so the classifier can learn from them after the
+	// Record has expired.
+	{
+		`
+CREATE TABLE label (
+    record_id           BIGINT PRIMARY KEY,
+    host_id             BIGINT NOT NULL,
+    source              TEXT NOT NULL,
+    message             TEXT NOT NULL,
+    interesting         BOOLEAN NOT NULL,
+    stamp               BIGINT NOT NULL
+)
+`,
+		`
+CREATE TABLE score (
+    record_id           BIGINT PRIMARY KEY REFERENCES record (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    host_id             BIGINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    score               DOUBLE PRECISION NOT NULL,
+    CHECK (score BETWEEN 0.0 AND 1.0)
+)
+`,
+		"CREATE INDEX score_stamp_idx ON score (stamp)",
+	},
+	// 11 -> 12
+	//
+	// Annotations and Tags on Records.
+	{
+		`
+CREATE TABLE annotation (
+    id                  BIGSERIAL PRIMARY KEY,
+    record_id           BIGINT NOT NULL REFERENCES record (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    host_id             BIGINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    text                TEXT NOT NULL,
+    CHECK (length(text) > 0)
+)
+`,
+		"CREATE INDEX annotation_record_idx ON annotation (record_id)",
+		`
+CREATE TABLE tag (
+    record_id           BIGINT NOT NULL REFERENCES record (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    name                TEXT NOT NULL,
+    host_id             BIGINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    PRIMARY KEY (record_id, name),
+    CHECK (length(name) > 0)
+)
+`,
+		"CREATE INDEX tag_name_idx ON tag (name)",
+	},
+	// 12 -> 13
+	//
+	// Incidents and the Records and Searches pinned to them. Pinned
+	// Records keep their text, so an Incident can still be written up
+	// after its Records have expired. end_stamp is 0 while the end of an
+	// Incident is not known.
+	{
+		`
+CREATE TABLE incident (
+    id                  BIGSERIAL PRIMARY KEY,
+    title               TEXT NOT NULL,
+    summary             TEXT NOT NULL DEFAULT '',
+    begin_stamp         BIGINT NOT NULL,
+    end_stamp           BIGINT NOT NULL DEFAULT 0,
+    status              SMALLINT NOT NULL DEFAULT 0,
+    created             BIGINT NOT NULL,
+    CHECK (end_stamp = 0 OR end_stamp > begin_stamp),
+    CHECK (status BETWEEN 0 AND 2)
+)
+`,
+		`
+CREATE TABLE incident_record (
+    incident_id         BIGINT NOT NULL REFERENCES incident (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    record_id           BIGINT NOT NULL,
+    host_id             BIGINT NOT NULL,
+    stamp               BIGINT NOT NULL,
+    source              TEXT NOT NULL,
+    message             TEXT NOT NULL,
+    note                TEXT NOT NULL DEFAULT '',
+    pinned              BIGINT NOT NULL,
+    PRIMARY KEY (incident_id, record_id)
+)
+`,
+		`
+CREATE TABLE incident_search (
+    incident_id         BIGINT NOT NULL REFERENCES incident (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    search_id           BIGINT NOT NULL REFERENCES search (id)
+                               ON UPDATE RESTRICT
+                               ON DELETE CASCADE,
+    pinned              BIGINT NOT NULL,
+    PRIMARY KEY (incident_id, search_id)
+)
+`,
+	},
+}
+
+// schemaVersion is the version of the schema created by qMigrate.
+var schemaVersion = len(qMigrate)
+
+const qSchemaVersionInit = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version             INTEGER NOT NULL
+)
+`
@@ -0,0 +1,195 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/postgres/signature.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-09 18:30:27 krylon>
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// SignatureAdd adds a Signature to the database.
+func (db *Database) SignatureAdd(s *model.Signature) error {
+	const qid query.ID = query.SignatureAdd
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+	)
+
+	if args, err = database.SignatureParams(s); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if err = stmt.QueryRow(args...).Scan(&s.ID); err != nil {
+		err = fmt.Errorf("Cannot add Signature %q: %w", s.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) SignatureAdd(s *model.Signature) error
+
+// SignatureUpdate saves the changes to an existing Signature.
+func (db *Database) SignatureUpdate(s *model.Signature) error {
+	const qid query.ID = query.SignatureUpdate
+	var (
+		err  error
+		stmt *sql.Stmt
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = database.SignatureParams(s); err != nil {
+		return err
+	} else if stmt, err = db.getStmt(qid); err != nil {
+		return err
+	} else if res, err = stmt.Exec(append(args, s.ID)...); err != nil {
+		err = fmt.Errorf("Cannot update Signature %d: %w", s.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return fmt.Errorf("No Signature with ID %d was found in the database", s.ID)
+	}
+
+	return nil
+} // func (db *Database) SignatureUpdate(s *model.Signature) error
+
+// SignatureDelete removes a Signature from the database, along with the
+// record of which Records matched it.
+func (db *Database) SignatureDelete(id int64) error {
+	return db.exec(query.SignatureDelete, id)
+} // func (db *Database) SignatureDelete(id int64) error
+
+// SignatureGetAll returns all Signatures, ordered by category and name.
+func (db *Database) SignatureGetAll() ([]model.Signature, error) {
+	const qid query.ID = query.SignatureGetAll
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		sigs = make([]model.Signature, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var s *model.Signature
+
+		if s, err = database.ScanSignature(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		sigs = append(sigs, *s)
+	}
+
+	return sigs, rows.Err()
+} // func (db *Database) SignatureGetAll() ([]model.Signature, error)
+
+// DetectionAdd records that Records matched Signatures. Detections that
+// were recorded before are ignored.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) DetectionAdd(list []model.Detection) error {
+	var (
+		err    error
+		stmt   *sql.Stmt
+		status bool
+	)
+
+	if len(list) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] %s\n", err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] %s\n", err2.Error())
+			}
+		}()
+	}
+
+	if stmt, err = db.getStmt(query.DetectionAdd); err != nil {
+		return err
+	}
+
+	for _, d := range list {
+		if _, err = stmt.Exec(d.RecordID, d.SignatureID, d.HostID, d.Time.Unix()); err != nil {
+			err = fmt.Errorf("Cannot tag Record %d with Signature %d: %w",
+				d.RecordID,
+				d.SignatureID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	status = true
+	return nil
+} // func (db *Database) DetectionAdd(list []model.Detection) error
+
+// DetectionGetRecent returns up to <max> Detections since the given time,
+// most recent first.
+func (db *Database) DetectionGetRecent(since time.Time, max int64) ([]model.Detection, error) {
+	return db.detectionQuery(query.DetectionGetRecent, since.Unix(), limit(max))
+} // func (db *Database) DetectionGetRecent(since time.Time, max int64) ([]model.Detection, error)
+
+// DetectionGetByRecord returns the Detections for the given Record.
+func (db *Database) DetectionGetByRecord(id int64) ([]model.Detection, error) {
+	return db.detectionQuery(query.DetectionGetByRecord, id)
+} // func (db *Database) DetectionGetByRecord(id int64) ([]model.Detection, error)
+
+func (db *Database) detectionQuery(qid query.ID, args ...any) ([]model.Detection, error) {
+	var (
+		err  error
+		stmt *sql.Stmt
+		rows *sql.Rows
+		list = make([]model.Detection, 0)
+	)
+
+	if stmt, err = db.getStmt(qid); err != nil {
+		return nil, err
+	} else if rows, err = stmt.Query(args...); err != nil {
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var d *model.Detection
+
+		if d, err = database.ScanDetection(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *d)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) detectionQuery(qid query.ID, args ...any) ([]model.Detection, error)
@@ -2,29 +2,771 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 19:23:43 krylon>
+// Time-stamp: <2024-10-12 14:52:11 krylon>
 
 package database
 
 import "github.com/blicero/scrollmaster/database/query"
 
+// qdb contains the queries that run against the main database file.
 var qdb = map[query.ID]string{
-	query.HostAdd:            "INSERT INTO host (name, last_seen) VALUES (?, ?) RETURNING id",
-	query.HostGetByName:      "SELECT id, last_seen FROM host WHERE name = ?",
-	query.HostGetByID:        "SELECT name, last_seen FROM host WHERE id = ?",
-	query.HostGetAll:         "SELECT id, name, last_seen FROM host ORDER BY name",
-	query.HostUpdateLastSeen: "UPDATE host SET last_seen = ? WHERE id = ?",
+	query.HostAdd:              "INSERT INTO host (name, last_seen) VALUES (?, ?) RETURNING id",
+	query.HostGetByName:        "SELECT id, last_seen, last_record, silence_threshold, maintenance FROM host WHERE name = ?",
+	query.HostGetByID:          "SELECT name, last_seen, last_record, silence_threshold, maintenance FROM host WHERE id = ?",
+	query.HostGetAll:           "SELECT id, name, last_seen, last_record, silence_threshold, maintenance FROM host ORDER BY name",
+	query.HostUpdateLastSeen:   "UPDATE host SET last_seen = ? WHERE id = ?",
+	query.HostUpdateLastRecord: "UPDATE host SET last_record = ? WHERE id = ?",
+	query.HostSetWatch:         "UPDATE host SET silence_threshold = ?, maintenance = ? WHERE id = ?",
+	query.PartitionAdd: `
+INSERT INTO partition (name, begin_stamp, end_stamp)
+               VALUES (   ?,           ?,         ?)
+RETURNING id
+`,
+	query.PartitionGetByTime: `
+SELECT
+    id,
+    name,
+    begin_stamp,
+    end_stamp
+FROM partition
+WHERE begin_stamp <= ? AND end_stamp > ?
+`,
+	query.PartitionGetByID: `
+SELECT
+    name,
+    begin_stamp,
+    end_stamp
+FROM partition
+WHERE id = ?
+`,
+	query.PartitionGetByPeriod: `
+SELECT
+    id,
+    name,
+    begin_stamp,
+    end_stamp
+FROM partition
+WHERE end_stamp > ? AND begin_stamp <= ?
+ORDER BY begin_stamp
+`,
+	query.PartitionGetAll: `
+SELECT
+    id,
+    name,
+    begin_stamp,
+    end_stamp
+FROM partition
+ORDER BY begin_stamp
+`,
+	query.PartitionGetPrevEnd:   "SELECT COALESCE(MAX(end_stamp), 0) FROM partition WHERE begin_stamp <= ?",
+	query.PartitionGetNextBegin: "SELECT COALESCE(MIN(begin_stamp), -1) FROM partition WHERE begin_stamp > ?",
+	query.PartitionDelete:       "DELETE FROM partition WHERE id = ?",
+	query.SearchAdd: `
+INSERT INTO search (timestamp, query, results, cnt, aggregates, title, description)
+            VALUES (        ?,     ?,       ?,   ?,          ?,     ?,           ?)
+RETURNING id
+`,
+	query.SearchGetByID: `
+SELECT
+    timestamp,
+    query,
+    results,
+    cnt,
+    aggregates,
+    title,
+    description,
+    expired
+FROM search
+WHERE id = ?
+`,
+	query.SearchDelete: "DELETE FROM search WHERE id = ?",
+	query.SearchGetResultIDs: `
+SELECT value
+FROM search s, json_each(s.results)
+WHERE s.id = ?
+LIMIT ?
+OFFSET ?
+`,
+	query.SearchGetAllID:       "SELECT id, cnt FROM search",
+	query.SearchGetResultCount: "SELECT cnt FROM search WHERE id = ?",
+	query.SearchGetAll: `
+SELECT
+    id,
+    timestamp,
+    cnt,
+    title,
+    description,
+    expired
+FROM search
+ORDER BY timestamp DESC, id DESC
+`,
+	query.SearchUpdate: `
+UPDATE search
+SET timestamp = ?,
+    query = ?,
+    results = ?,
+    cnt = ?,
+    aggregates = ?,
+    title = ?,
+    description = ?,
+    expired = ?
+WHERE id = ?
+`,
+	query.SearchExpireDelete: "DELETE FROM search WHERE timestamp < ? AND title = ''",
+	query.SearchExpireResults: `
+UPDATE search
+SET results = '[]',
+    cnt = 0,
+    aggregates = NULL,
+    expired = 1
+WHERE timestamp < ? AND NOT expired
+`,
+	query.AlertRuleAdd: `
+INSERT INTO alert_rule (name, description, query, threshold, period, per_host, active, silenced_until, kind)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.AlertRuleUpdate: `
+UPDATE alert_rule
+SET name = ?,
+    description = ?,
+    query = ?,
+    threshold = ?,
+    period = ?,
+    per_host = ?,
+    active = ?,
+    silenced_until = ?,
+    kind = ?
+WHERE id = ?
+`,
+	query.AlertRuleDelete: "DELETE FROM alert_rule WHERE id = ?",
+	query.AlertRuleGetAll: `
+SELECT
+    id,
+    name,
+    description,
+    query,
+    threshold,
+    period,
+    per_host,
+    active,
+    silenced_until,
+    kind
+FROM alert_rule
+ORDER BY name
+`,
+	query.AlertRuleGetByID: `
+SELECT
+    id,
+    name,
+    description,
+    query,
+    threshold,
+    period,
+    per_host,
+    active,
+    silenced_until,
+    kind
+FROM alert_rule
+WHERE id = ?
+`,
+	query.AlertRuleSilence: "UPDATE alert_rule SET silenced_until = ? WHERE id = ?",
+	query.AlertAdd: `
+INSERT INTO alert (rule_id, host_id, fired, last_seen, cnt, silenced)
+           VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.AlertUpdate: `
+UPDATE alert
+SET last_seen = ?,
+    cnt = ?
+WHERE id = ? AND resolved IS NULL
+`,
+	query.AlertResolve: `
+UPDATE alert
+SET resolved = ?
+WHERE id = ? AND resolved IS NULL
+`,
+	query.AlertGetOpen: `
+SELECT
+    id,
+    rule_id,
+    host_id,
+    fired,
+    last_seen,
+    resolved,
+    cnt,
+    silenced
+FROM alert
+WHERE resolved IS NULL
+ORDER BY fired DESC, id DESC
+`,
+	query.AlertGetHistory: `
+SELECT
+    id,
+    rule_id,
+    host_id,
+    fired,
+    last_seen,
+    resolved,
+    cnt,
+    silenced
+FROM alert
+ORDER BY fired DESC, id DESC
+LIMIT ?
+`,
+	query.NotifierAdd: `
+INSERT INTO notifier (name, kind, target, settings, template, active)
+              VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.NotifierUpdate: `
+UPDATE notifier
+SET name = ?,
+    kind = ?,
+    target = ?,
+    settings = ?,
+    template = ?,
+    active = ?
+WHERE id = ?
+`,
+	query.NotifierDelete: "DELETE FROM notifier WHERE id = ?",
+	query.NotifierGetAll: `
+SELECT
+    id,
+    name,
+    kind,
+    target,
+    settings,
+    template,
+    active
+FROM notifier
+ORDER BY name
+`,
+	query.NotifierGetByID: `
+SELECT
+    id,
+    name,
+    kind,
+    target,
+    settings,
+    template,
+    active
+FROM notifier
+WHERE id = ?
+`,
+	query.DeliveryAdd: `
+INSERT INTO delivery (notifier_id, alert_id, state, stamp, attempt, error)
+              VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.DeliveryGetRecent: `
+SELECT
+    id,
+    notifier_id,
+    alert_id,
+    state,
+    stamp,
+    attempt,
+    error
+FROM delivery
+ORDER BY stamp DESC, id DESC
+LIMIT ?
+`,
+	query.PatternAdd: `
+INSERT INTO pattern (template, first_seen, last_seen)
+             VALUES (?, ?, ?)
+RETURNING id
+`,
+	query.PatternUpdate: "UPDATE pattern SET template = ? WHERE id = ?",
+	query.PatternSeen: `
+UPDATE pattern
+SET first_seen = MIN(first_seen, ?),
+    last_seen = MAX(last_seen, ?),
+    cnt = cnt + ?
+WHERE id = ?
+RETURNING first_seen, last_seen, cnt
+`,
+	query.PatternCountAdd: `
+INSERT INTO pattern_count (pattern_id, stamp, cnt)
+                   VALUES (?, ?, ?)
+ON CONFLICT (pattern_id, stamp) DO UPDATE SET cnt = cnt + excluded.cnt
+`,
+	query.PatternRecordAdd: `
+INSERT INTO pattern_record (record_id, pattern_id) VALUES (?, ?)
+ON CONFLICT (record_id) DO NOTHING
+`,
+	query.PatternGetAll: `
+SELECT
+    p.id,
+    p.template,
+    p.first_seen,
+    p.last_seen,
+    p.cnt,
+    COALESCE(SUM(c.cnt), 0) AS recent
+FROM pattern p
+LEFT OUTER JOIN pattern_count c ON p.id = c.pattern_id AND c.stamp >= ?
+GROUP BY p.id
+ORDER BY p.cnt DESC, p.id
+`,
+	query.PatternGetByID: `
+SELECT
+    p.id,
+    p.template,
+    p.first_seen,
+    p.last_seen,
+    p.cnt,
+    0 AS recent
+FROM pattern p
+WHERE p.id = ?
+`,
+	query.PatternGetCounts: `
+SELECT
+    stamp,
+    cnt
+FROM pattern_count
+WHERE pattern_id = ? AND stamp >= ?
+ORDER BY stamp
+`,
+	query.PatternGetRecordIDs: `
+SELECT record_id
+FROM pattern_record
+WHERE pattern_id = ?
+ORDER BY record_id DESC
+LIMIT ?
+`,
+	query.NoveltyAdd: `
+INSERT INTO novelty (pattern_id, host_id, source, first_seen, record_id)
+             VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (pattern_id, host_id, source) DO UPDATE
+SET first_seen = excluded.first_seen,
+    record_id = excluded.record_id
+WHERE excluded.first_seen < novelty.first_seen
+`,
+	query.NoveltyGetRecent: `
+SELECT
+    n.id,
+    n.pattern_id,
+    p.template,
+    n.host_id,
+    n.source,
+    n.first_seen,
+    n.record_id,
+    n.acknowledged
+FROM novelty n
+INNER JOIN pattern p ON n.pattern_id = p.id
+WHERE n.first_seen >= ? AND n.acknowledged = 0
+ORDER BY n.first_seen DESC, n.id DESC
+`,
+	query.NoveltyAcknowledge: "UPDATE novelty SET acknowledged = 1 WHERE id = ?",
+	query.SignatureAdd: `
+INSERT INTO signature (name, category, severity, description, query, threshold, period, builtin, active)
+               VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.SignatureUpdate: `
+UPDATE signature
+SET name = ?,
+    category = ?,
+    severity = ?,
+    description = ?,
+    query = ?,
+    threshold = ?,
+    period = ?,
+    builtin = ?,
+    active = ?
+WHERE id = ?
+`,
+	query.SignatureDelete: "DELETE FROM signature WHERE id = ?",
+	query.SignatureGetAll: `
+SELECT
+    id,
+    name,
+    category,
+    severity,
+    description,
+    query,
+    threshold,
+    period,
+    builtin,
+    active
+FROM signature
+ORDER BY category, name
+`,
+	query.DetectionAdd: `
+INSERT INTO detection (record_id, signature_id, host_id, stamp)
+               VALUES (?, ?, ?, ?)
+ON CONFLICT (record_id, signature_id) DO NOTHING
+`,
+	query.DetectionGetRecent: `
+SELECT
+    record_id,
+    signature_id,
+    host_id,
+    stamp
+FROM detection
+WHERE stamp >= ?
+ORDER BY stamp DESC, record_id DESC
+LIMIT ?
+`,
+	query.DetectionGetByRecord: `
+SELECT
+    record_id,
+    signature_id,
+    host_id,
+    stamp
+FROM detection
+WHERE record_id = ?
+ORDER BY signature_id
+`,
+	query.LabelSet: `
+INSERT INTO label (record_id, host_id, source, message, interesting, stamp)
+           VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (record_id) DO UPDATE
+SET interesting = excluded.interesting,
+    stamp = excluded.stamp
+`,
+	query.LabelDelete: "DELETE FROM label WHERE record_id = ?",
+	query.LabelGetAll: `
+SELECT
+    record_id,
+    host_id,
+    source,
+    message,
+    interesting,
+    stamp
+FROM label
+ORDER BY stamp
+`,
+	query.LabelGetByRecord: `
+SELECT
+    record_id,
+    host_id,
+    source,
+    message,
+    interesting,
+    stamp
+FROM label
+WHERE record_id = ?
+`,
+	query.ScoreAdd: `
+INSERT INTO score (record_id, host_id, stamp, score)
+           VALUES (?, ?, ?, ?)
+ON CONFLICT (record_id) DO UPDATE
+SET score = excluded.score
+`,
+	query.ScoreGetTop: `
+SELECT
+    record_id,
+    host_id,
+    stamp,
+    score
+FROM score
+WHERE stamp >= ?
+ORDER BY score DESC, stamp DESC
+LIMIT ?
+`,
+	query.AnnotationAdd: `
+INSERT INTO annotation (record_id, host_id, stamp, text)
+                VALUES (?, ?, ?, ?)
+RETURNING id
+`,
+	query.AnnotationDelete: "DELETE FROM annotation WHERE id = ?",
+	query.AnnotationGetByRecords: `
+SELECT
+    id,
+    record_id,
+    host_id,
+    stamp,
+    text
+FROM annotation
+WHERE record_id IN (SELECT value FROM json_each(?))
+ORDER BY stamp, id
+`,
+	query.TagAdd: `
+INSERT INTO tag (record_id, name, host_id, stamp)
+         VALUES (?, ?, ?, ?)
+ON CONFLICT (record_id, name) DO NOTHING
+`,
+	query.TagDelete: "DELETE FROM tag WHERE record_id = ? AND name = ?",
+	query.TagGetByRecords: `
+SELECT
+    record_id,
+    name,
+    host_id,
+    stamp
+FROM tag
+WHERE record_id IN (SELECT value FROM json_each(?))
+ORDER BY name
+`,
+	query.TagGetAll: "SELECT name, record_id FROM tag ORDER BY name, record_id",
+	query.IncidentAdd: `
+INSERT INTO incident (title, summary, begin_stamp, end_stamp, status, created)
+              VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id
+`,
+	query.IncidentUpdate: `
+UPDATE incident
+SET title = ?,
+    summary = ?,
+    begin_stamp = ?,
+    end_stamp = ?,
+    status = ?
+WHERE id = ?
+`,
+	query.IncidentDelete: "DELETE FROM incident WHERE id = ?",
+	query.IncidentGetAll: `
+SELECT
+    id,
+    title,
+    summary,
+    begin_stamp,
+    end_stamp,
+    status,
+    created
+FROM incident
+ORDER BY begin_stamp DESC, id DESC
+`,
+	query.IncidentGetByID: `
+SELECT
+    id,
+    title,
+    summary,
+    begin_stamp,
+    end_stamp,
+    status,
+    created
+FROM incident
+WHERE id = ?
+`,
+	query.IncidentPinRecord: `
+INSERT INTO incident_record (incident_id, record_id, host_id, stamp, source, message, note, pinned)
+                     VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (incident_id, record_id) DO UPDATE
+SET note = excluded.note
+`,
+	query.IncidentUnpinRecord: "DELETE FROM incident_record WHERE incident_id = ? AND record_id = ?",
+	query.IncidentGetPins: `
+SELECT
+    incident_id,
+    record_id,
+    host_id,
+    stamp,
+    source,
+    message,
+    note,
+    pinned
+FROM incident_record
+WHERE incident_id = ?
+ORDER BY stamp, record_id
+`,
+	query.IncidentPinSearch: `
+INSERT INTO incident_search (incident_id, search_id, pinned)
+                     VALUES (?, ?, ?)
+ON CONFLICT (incident_id, search_id) DO NOTHING
+`,
+	query.IncidentUnpinSearch: "DELETE FROM incident_search WHERE incident_id = ? AND search_id = ?",
+	query.IncidentGetSearches: `
+SELECT search_id
+FROM incident_search
+WHERE incident_id = ?
+ORDER BY pinned, search_id
+`,
+}
+
+// qpart contains the queries that run against a single partition.
+// Queries that return Records all return the same columns: id, host_id,
+// stamp, source, pattern and params.
+var qpart = map[query.ID]string{
+	query.SourceGetOrAdd: `
+INSERT INTO source (name) VALUES (?)
+ON CONFLICT (name) DO UPDATE SET name = excluded.name
+RETURNING id
+`,
+	query.TemplateGetOrAdd: `
+INSERT INTO template (pattern) VALUES (?)
+ON CONFLICT (pattern) DO UPDATE SET pattern = excluded.pattern
+RETURNING id
+`,
 	query.RecordAdd: `
-INSERT INTO record (host_id, stamp, source, message, checksum)
-            VALUES (      ?,     ?,      ?,       ?,        ?)
+INSERT INTO record (id, host_id, stamp, source_id, template_id, params, checksum)
+            VALUES ((SELECT COALESCE(MAX(id), ?) + 1 FROM record),
+                          ?,     ?,         ?,           ?,      ?,        ?)
 RETURNING id
 `,
 	query.RecordGetByHost: `
 SELECT
     id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = ?
+ORDER BY stamp DESC
+LIMIT ?
+`,
+	query.RecordGetByPeriod: `
+SELECT
+    id,
+    host_id,
     stamp,
     source,
-    message
+    pattern,
+    params
+FROM record_full
+WHERE stamp BETWEEN ? AND ?
+ORDER BY stamp
+`,
+	query.RecordGetMostRecent: `
+SELECT COALESCE(MAX(stamp), 0)
+FROM record
+WHERE host_id = ?
+`,
+	query.RecordCheckExist: "SELECT COUNT(id) FROM record WHERE checksum = ?",
+	query.RecordGetRecent: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+ORDER BY stamp DESC
+LIMIT ?
+`,
+	query.RecordGetByIDList: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE id IN (SELECT value FROM json_each(?))
+ORDER BY stamp DESC
+`,
+	query.RecordScan: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp BETWEEN ?1 AND ?2
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp DESC
+`,
+	query.RecordScanCount: `
+SELECT COUNT(*)
+FROM record_full
+WHERE stamp BETWEEN ?1 AND ?2
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+`,
+	query.RecordGetBefore: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = ?1
+  AND stamp <= ?2
+  AND (stamp < ?2 OR id < ?3)
+  AND (?4 IS NULL OR source = ?4)
+ORDER BY stamp DESC, id DESC
+LIMIT ?5
+`,
+	query.RecordGetAfter: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE host_id = ?1
+  AND stamp >= ?2
+  AND (stamp > ?2 OR id > ?3)
+  AND (?4 IS NULL OR source = ?4)
+ORDER BY stamp, id
+LIMIT ?5
+`,
+	query.RecordPageOlder: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp <= ?1 AND (stamp < ?1 OR id < ?2)
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp DESC, id DESC
+LIMIT ?5
+`,
+	query.RecordPageNewer: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    pattern,
+    params
+FROM record_full
+WHERE stamp >= ?1 AND (stamp > ?1 OR id > ?2)
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp, id
+LIMIT ?5
+`,
+	query.RecordGetSources: `
+SELECT
+    s.name,
+    COUNT(r.id) AS cnt
+FROM record r
+INNER JOIN source s ON r.source_id = s.id
+GROUP BY s.name
+ORDER BY s.name`,
+
+	query.RecordGetRates: `
+SELECT
+    r.host_id,
+    s.name,
+    r.stamp - ((r.stamp - ?1) % ?3) AS period,
+    COUNT(r.id) AS cnt
+FROM record r
+INNER JOIN source s ON r.source_id = s.id
+WHERE r.stamp >= ?1 AND r.stamp < ?2
+GROUP BY r.host_id, s.name, period
+`,
+}
+
+// qlegacy contains the read queries for the record table of databases
+// created before records were partitioned. That table has the source and
+// message as text, so the message is returned as a pattern without
+// parameters.
+var qlegacy = map[query.ID]string{
+	query.RecordGetByHost: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
 FROM record
 WHERE host_id = ?
 ORDER BY stamp DESC
@@ -36,7 +778,8 @@ SELECT
     host_id,
     stamp,
     source,
-    message
+    message AS pattern,
+    NULL AS params
 FROM record
 WHERE stamp BETWEEN ? AND ?
 ORDER BY stamp
@@ -53,10 +796,106 @@ SELECT
     host_id,
     stamp,
     source,
-    message
+    message AS pattern,
+    NULL AS params
 FROM record
 ORDER BY stamp DESC
 LIMIT ?
+`,
+	query.RecordGetByIDList: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE id IN (SELECT value FROM json_each(?))
+ORDER BY stamp DESC
+`,
+	query.RecordScan: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE stamp BETWEEN ?1 AND ?2
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp DESC
+`,
+	query.RecordScanCount: `
+SELECT COUNT(*)
+FROM record
+WHERE stamp BETWEEN ?1 AND ?2
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+`,
+	query.RecordGetBefore: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE host_id = ?1
+  AND stamp <= ?2
+  AND (stamp < ?2 OR id < ?3)
+  AND (?4 IS NULL OR source = ?4)
+ORDER BY stamp DESC, id DESC
+LIMIT ?5
+`,
+	query.RecordGetAfter: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE host_id = ?1
+  AND stamp >= ?2
+  AND (stamp > ?2 OR id > ?3)
+  AND (?4 IS NULL OR source = ?4)
+ORDER BY stamp, id
+LIMIT ?5
+`,
+	query.RecordPageOlder: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE stamp <= ?1 AND (stamp < ?1 OR id < ?2)
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp DESC, id DESC
+LIMIT ?5
+`,
+	query.RecordPageNewer: `
+SELECT
+    id,
+    host_id,
+    stamp,
+    source,
+    message AS pattern,
+    NULL AS params
+FROM record
+WHERE stamp >= ?1 AND (stamp > ?1 OR id > ?2)
+  AND (?3 IS NULL OR host_id IN (SELECT value FROM json_each(?3)))
+  AND (?4 IS NULL OR source IN (SELECT value FROM json_each(?4)))
+ORDER BY stamp, id
+LIMIT ?5
 `,
 	query.RecordGetSources: `
 SELECT
@@ -65,40 +904,15 @@ SELECT
 FROM record
 GROUP BY source
 ORDER BY source`,
-	query.SearchAdd: `
-INSERT INTO search (timestamp, query, results, cnt)
-            VALUES (        ?,     ?,       ?,   ?)
-RETURNING id
-`,
-	query.SearchGetByID: `
-SELECT
-    timestamp,
-    query,
-    results,
-    cnt
-FROM search
-WHERE id = ?
-`,
-	query.SearchDelete: "DELETE FROM search WHERE id = ?",
-	query.SearchGetResults: `
-WITH idlist (id) AS (
-	SELECT value
-	FROM search s, json_each(s.results)
-	WHERE s.id = ?
-)
 
+	query.RecordGetRates: `
 SELECT
-        i.id,
-	r.host_id,
-	r.stamp,
-	r.source,
-	r.message
-FROM idlist i
-INNER JOIN record r ON i.id = r.id
-ORDER BY r.stamp
-LIMIT ?
-OFFSET ?
+    host_id,
+    source,
+    stamp - ((stamp - ?1) % ?3) AS period,
+    COUNT(id) AS cnt
+FROM record
+WHERE stamp >= ?1 AND stamp < ?2
+GROUP BY host_id, source, period
 `,
-	query.SearchGetAllID:       "SELECT id, cnt FROM search",
-	query.SearchGetResultCount: "SELECT cnt FROM search WHERE id = ?",
 }
@@ -2,10 +2,15 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 11:08:59 krylon>
+// Time-stamp: <2024-10-12 14:58:02 krylon>
 
 package database
 
+// schemaVersion is the version of the database schema created by qInit.
+// Whenever the schema changes, it has to be incremented, and qMigrate needs
+// an entry that upgrades a database from the previous version.
+const schemaVersion = 12
+
 var qInit = []string{
 	`
 CREATE TABLE host (
@@ -17,34 +22,15 @@ CREATE TABLE host (
 	"CREATE UNIQUE INDEX host_name_idx ON host (name)",
 
 	`
-CREATE TABLE record (
-	id		INTEGER PRIMARY KEY,
-        host_id		INTEGER NOT NULL,
-        stamp           INTEGER NOT NULL DEFAULT 0,
-        source          TEXT NOT NULL,
-        message         TEXT NOT NULL,
-        checksum        TEXT UNIQUE NOT NULL,
-        FOREIGN KEY (host_id) REFERENCES host (id)
-            ON UPDATE RESTRICT
-            ON DELETE CASCADE,
-        CHECK (host_id > 0)
+CREATE TABLE partition (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    name                TEXT UNIQUE NOT NULL,
+    begin_stamp         INTEGER NOT NULL,
+    end_stamp           INTEGER NOT NULL,
+    CHECK (begin_stamp < end_stamp)
 ) STRICT
 `,
-	"CREATE INDEX record_host_idx ON record (host_id)",
-	"CREATE INDEX record_stamp_idx ON record (stamp)",
-	"CREATE INDEX record_source_idx ON record (source)",
-	"CREATE UNIQUE INDEX record_ck_idx ON record (checksum)",
-
-	`
-CREATE view readable AS
-SELECT
-    r.id,
-    h.name,
-    datetime(r.stamp, 'unixepoch') AS stamp,
-    r.source,
-    r.message
-FROM record r
-INNER JOIN host h ON r.host_id = h.id`,
+	"CREATE INDEX partition_begin_idx ON partition (begin_stamp)",
 
 	`
 CREATE TABLE search (
@@ -58,4 +44,597 @@ CREATE TABLE search (
 ) STRICT
 `,
 	"CREATE INDEX search_time_idx ON search (timestamp)",
+	qSearchAggregates,
+	qSearchTitle,
+	qSearchDescription,
+	qSearchExpired,
+	qAlertRuleInit,
+	qAlertInit,
+	qAlertOpenIndex,
+	qAlertFiredIndex,
+	qNotifierInit,
+	qDeliveryInit,
+	qDeliveryStampIndex,
+	qHostLastRecord,
+	qHostSilenceThreshold,
+	qHostMaintenance,
+	qAlertRuleKind,
+	qAlertRuleSilenceDefault,
+	qPatternInit,
+	qPatternCountInit,
+	qPatternRecordInit,
+	qPatternRecordIndex,
+	qPatternPartitionTrigger,
+	qNoveltyInit,
+	qNoveltyFirstSeenIndex,
+	qSignatureInit,
+	qDetectionInit,
+	qDetectionStampIndex,
+	qDetectionPartitionTrigger,
+	qLabelInit,
+	qScoreInit,
+	qScoreStampIndex,
+	qScorePartitionTrigger,
+	qAnnotationInit,
+	qAnnotationRecordIndex,
+	qAnnotationPartitionTrigger,
+	qTagInit,
+	qTagNameIndex,
+	qTagPartitionTrigger,
+	qIncidentInit,
+	qIncidentRecordInit,
+	qIncidentSearchInit,
+}
+
+// qSearchAggregates adds the column for the Aggregates of a Search, both to
+// a fresh database and when upgrading from version 1.
+const qSearchAggregates = `
+ALTER TABLE search
+ADD COLUMN aggregates TEXT CHECK (aggregates IS NULL OR json_valid(aggregates) > 0)
+`
+
+// These add the columns for saved Searches, both to a fresh database and
+// when upgrading from version 2.
+const (
+	qSearchTitle       = "ALTER TABLE search ADD COLUMN title TEXT NOT NULL DEFAULT ''"
+	qSearchDescription = "ALTER TABLE search ADD COLUMN description TEXT NOT NULL DEFAULT ''"
+	qSearchExpired     = "ALTER TABLE search ADD COLUMN expired INTEGER NOT NULL DEFAULT 0"
+)
+
+// These create the tables for alert rules and the Alerts they raised, both
+// in a fresh database and when upgrading from version 3. There can only be
+// one open Alert per rule and Host.
+const (
+	qAlertRuleInit = `
+CREATE TABLE alert_rule (
+    id                  INTEGER PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    query               TEXT NOT NULL,
+    threshold           INTEGER NOT NULL,
+    period              INTEGER NOT NULL,
+    per_host            INTEGER NOT NULL DEFAULT 0,
+    active              INTEGER NOT NULL DEFAULT 1,
+    silenced_until      INTEGER NOT NULL DEFAULT 0,
+    CHECK (json_valid(query) > 0),
+    CHECK (threshold >= 0),
+    CHECK (period > 0)
+) STRICT
+`
+	qAlertInit = `
+CREATE TABLE alert (
+    id                  INTEGER PRIMARY KEY,
+    rule_id             INTEGER NOT NULL,
+    host_id             INTEGER NOT NULL DEFAULT 0,
+    fired               INTEGER NOT NULL,
+    last_seen           INTEGER NOT NULL,
+    resolved            INTEGER,
+    cnt                 INTEGER NOT NULL DEFAULT 0,
+    silenced            INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (rule_id) REFERENCES alert_rule (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qAlertOpenIndex  = "CREATE UNIQUE INDEX alert_open_idx ON alert (rule_id, host_id) WHERE resolved IS NULL"
+	qAlertFiredIndex = "CREATE INDEX alert_fired_idx ON alert (fired)"
+)
+
+// These create the tables for Notifiers and the log of their deliveries,
+// both in a fresh database and when upgrading from version 4. Deliveries
+// of test messages have no alert_id.
+const (
+	qNotifierInit = `
+CREATE TABLE notifier (
+    id                  INTEGER PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    kind                INTEGER NOT NULL,
+    target              TEXT NOT NULL,
+    settings            TEXT NOT NULL DEFAULT '{}',
+    template            TEXT NOT NULL DEFAULT '',
+    active              INTEGER NOT NULL DEFAULT 1,
+    CHECK (json_valid(settings) > 0)
+) STRICT
+`
+	qDeliveryInit = `
+CREATE TABLE delivery (
+    id                  INTEGER PRIMARY KEY,
+    notifier_id         INTEGER NOT NULL,
+    alert_id            INTEGER,
+    state               INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    attempt             INTEGER NOT NULL,
+    error               TEXT,
+    FOREIGN KEY (notifier_id) REFERENCES notifier (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE,
+    FOREIGN KEY (alert_id) REFERENCES alert (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qDeliveryStampIndex = "CREATE INDEX delivery_stamp_idx ON delivery (stamp)"
+)
+
+// These add what is needed to watch for Hosts that go silent, both to a
+// fresh database and when upgrading from version 5: When a Host last
+// delivered Records, how long it may stay silent, and if it is down for
+// maintenance, plus the kind of alert rules and a default rule that
+// watches for silent Hosts.
+const (
+	qHostLastRecord          = "ALTER TABLE host ADD COLUMN last_record INTEGER NOT NULL DEFAULT 0"
+	qHostSilenceThreshold    = "ALTER TABLE host ADD COLUMN silence_threshold INTEGER NOT NULL DEFAULT 0"
+	qHostMaintenance         = "ALTER TABLE host ADD COLUMN maintenance INTEGER NOT NULL DEFAULT 0"
+	qAlertRuleKind           = "ALTER TABLE alert_rule ADD COLUMN kind INTEGER NOT NULL DEFAULT 0"
+	qAlertRuleSilenceDefault = `
+INSERT INTO alert_rule (name, description, query, threshold, period, per_host, active, kind)
+VALUES ('Host is silent',
+        'A Host has not contacted us or sent new Records for longer than its threshold.',
+        '{}', 0, 900, 1, 1, 1)
+`
+)
+
+// These create the tables for the Patterns found by clustering the
+// messages of incoming Records, both in a fresh database and when upgrading
+// from version 6. pattern_count holds the number of Records per Pattern
+// and hour, pattern_record maps Records to their Pattern.
+//
+// Since Records live in partition files, there is no foreign key on
+// record_id. Instead, a trigger removes the mappings when a partition is
+// dropped, relying on the partition ID in the upper bits of the Record ID.
+const (
+	qPatternInit = `
+CREATE TABLE pattern (
+    id                  INTEGER PRIMARY KEY,
+    template            TEXT NOT NULL,
+    first_seen          INTEGER NOT NULL,
+    last_seen           INTEGER NOT NULL,
+    cnt                 INTEGER NOT NULL DEFAULT 0,
+    CHECK (first_seen <= last_seen),
+    CHECK (cnt >= 0)
+) STRICT
+`
+	qPatternCountInit = `
+CREATE TABLE pattern_count (
+    pattern_id          INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    cnt                 INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (pattern_id, stamp),
+    FOREIGN KEY (pattern_id) REFERENCES pattern (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qPatternRecordInit = `
+CREATE TABLE pattern_record (
+    record_id           INTEGER PRIMARY KEY,
+    pattern_id          INTEGER NOT NULL,
+    FOREIGN KEY (pattern_id) REFERENCES pattern (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qPatternRecordIndex      = "CREATE INDEX pattern_record_pattern_idx ON pattern_record (pattern_id, record_id)"
+	qPatternPartitionTrigger = `
+CREATE TRIGGER pattern_partition_drop_trg
+AFTER DELETE ON partition
+BEGIN
+    DELETE FROM pattern_record
+    WHERE record_id >= (old.id << 32) AND record_id < ((old.id + 1) << 32);
+END
+`
+)
+
+// These create the table that remembers when a Host first logged a message
+// matching a Pattern from a given source, both in a fresh database and when
+// upgrading from version 7. Like in the partitions, host_id has no foreign
+// key, and neither does record_id, the Record may be gone by the time
+// someone looks at it.
+const (
+	qNoveltyInit = `
+CREATE TABLE novelty (
+    id                  INTEGER PRIMARY KEY,
+    pattern_id          INTEGER NOT NULL,
+    host_id             INTEGER NOT NULL,
+    source              TEXT NOT NULL,
+    first_seen          INTEGER NOT NULL,
+    record_id           INTEGER NOT NULL,
+    acknowledged        INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (pattern_id, host_id, source),
+    FOREIGN KEY (pattern_id) REFERENCES pattern (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qNoveltyFirstSeenIndex = "CREATE INDEX novelty_first_seen_idx ON novelty (first_seen)"
+)
+
+// These create the tables for Signatures and the Records that matched them,
+// both in a fresh database and when upgrading from version 8. Like
+// pattern_record, detection is cleaned up by a trigger when a partition is
+// dropped.
+const (
+	qSignatureInit = `
+CREATE TABLE signature (
+    id                  INTEGER PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL,
+    category            TEXT NOT NULL,
+    severity            INTEGER NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    query               TEXT NOT NULL,
+    threshold           INTEGER NOT NULL DEFAULT 0,
+    period              INTEGER NOT NULL DEFAULT 0,
+    builtin             INTEGER NOT NULL DEFAULT 0,
+    active              INTEGER NOT NULL DEFAULT 1,
+    CHECK (json_valid(query) > 0),
+    CHECK (severity BETWEEN 0 AND 7),
+    CHECK (threshold >= 0),
+    CHECK (period >= 0)
+) STRICT
+`
+	qDetectionInit = `
+CREATE TABLE detection (
+    record_id           INTEGER NOT NULL,
+    signature_id        INTEGER NOT NULL,
+    host_id             INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    PRIMARY KEY (record_id, signature_id),
+    FOREIGN KEY (signature_id) REFERENCES signature (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qDetectionStampIndex       = "CREATE INDEX detection_stamp_idx ON detection (stamp)"
+	qDetectionPartitionTrigger = `
+CREATE TRIGGER detection_partition_drop_trg
+AFTER DELETE ON partition
+BEGIN
+    DELETE FROM detection
+    WHERE record_id >= (old.id << 32) AND record_id < ((old.id + 1) << 32);
+END
+`
+)
+
+// These create the tables for the Labels the user put on Records and the
+// Scores the classifier assigned to them, both in a fresh database and when
+// upgrading from version 9. Labels keep the text of their Record, so they
+// outlive its partition. Scores are cleaned up by a trigger.
+const (
+	qLabelInit = `
+CREATE TABLE label (
+    record_id           INTEGER PRIMARY KEY,
+    host_id             INTEGER NOT NULL,
+    source              TEXT NOT NULL,
+    message             TEXT NOT NULL,
+    interesting         INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL
+) STRICT
+`
+	qScoreInit = `
+CREATE TABLE score (
+    record_id           INTEGER PRIMARY KEY,
+    host_id             INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    score               REAL NOT NULL,
+    CHECK (score BETWEEN 0.0 AND 1.0)
+) STRICT
+`
+	qScoreStampIndex       = "CREATE INDEX score_stamp_idx ON score (stamp)"
+	qScorePartitionTrigger = `
+CREATE TRIGGER score_partition_drop_trg
+AFTER DELETE ON partition
+BEGIN
+    DELETE FROM score
+    WHERE record_id >= (old.id << 32) AND record_id < ((old.id + 1) << 32);
+END
+`
+)
+
+// These create the tables for the Annotations and Tags users put on
+// Records, both in a fresh database and when upgrading from version 10.
+// They are dropped along with the partition of their Record.
+const (
+	qAnnotationInit = `
+CREATE TABLE annotation (
+    id                  INTEGER PRIMARY KEY,
+    record_id           INTEGER NOT NULL,
+    host_id             INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    text                TEXT NOT NULL,
+    CHECK (length(text) > 0)
+) STRICT
+`
+	qAnnotationRecordIndex      = "CREATE INDEX annotation_record_idx ON annotation (record_id)"
+	qAnnotationPartitionTrigger = `
+CREATE TRIGGER annotation_partition_drop_trg
+AFTER DELETE ON partition
+BEGIN
+    DELETE FROM annotation
+    WHERE record_id >= (old.id << 32) AND record_id < ((old.id + 1) << 32);
+END
+`
+	qTagInit = `
+CREATE TABLE tag (
+    record_id           INTEGER NOT NULL,
+    name                TEXT NOT NULL,
+    host_id             INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    PRIMARY KEY (record_id, name),
+    CHECK (length(name) > 0)
+) STRICT
+`
+	qTagNameIndex        = "CREATE INDEX tag_name_idx ON tag (name)"
+	qTagPartitionTrigger = `
+CREATE TRIGGER tag_partition_drop_trg
+AFTER DELETE ON partition
+BEGIN
+    DELETE FROM tag
+    WHERE record_id >= (old.id << 32) AND record_id < ((old.id + 1) << 32);
+END
+`
+)
+
+// These create the tables for Incidents and the Records and Searches
+// pinned to them, both in a fresh database and when upgrading from version
+// 11. Pinned Records keep their text, so an Incident can still be written
+// up after its Records have expired. end_stamp is 0 while the end of an
+// Incident is not known.
+const (
+	qIncidentInit = `
+CREATE TABLE incident (
+    id                  INTEGER PRIMARY KEY,
+    title               TEXT NOT NULL,
+    summary             TEXT NOT NULL DEFAULT '',
+    begin_stamp         INTEGER NOT NULL,
+    end_stamp           INTEGER NOT NULL DEFAULT 0,
+    status              INTEGER NOT NULL DEFAULT 0,
+    created             INTEGER NOT NULL,
+    CHECK (end_stamp = 0 OR end_stamp > begin_stamp),
+    CHECK (status BETWEEN 0 AND 2)
+) STRICT
+`
+	qIncidentRecordInit = `
+CREATE TABLE incident_record (
+    incident_id         INTEGER NOT NULL,
+    record_id           INTEGER NOT NULL,
+    host_id             INTEGER NOT NULL,
+    stamp               INTEGER NOT NULL,
+    source              TEXT NOT NULL,
+    message             TEXT NOT NULL,
+    note                TEXT NOT NULL DEFAULT '',
+    pinned              INTEGER NOT NULL,
+    PRIMARY KEY (incident_id, record_id),
+    FOREIGN KEY (incident_id) REFERENCES incident (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+	qIncidentSearchInit = `
+CREATE TABLE incident_search (
+    incident_id         INTEGER NOT NULL,
+    search_id           INTEGER NOT NULL,
+    pinned              INTEGER NOT NULL,
+    PRIMARY KEY (incident_id, search_id),
+    FOREIGN KEY (incident_id) REFERENCES incident (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE,
+    FOREIGN KEY (search_id) REFERENCES search (id)
+        ON UPDATE RESTRICT
+        ON DELETE CASCADE
+) STRICT
+`
+)
+
+// qMigrate contains the queries to upgrade the schema of an existing
+// database. qMigrate[n] upgrades a database from version n to version n+1.
+//
+// Version 0 is the schema from before there was any versioning, when all
+// records lived in the main database file. That table is left alone and
+// treated as a read-only partition.
+var qMigrate = [][]string{
+	// 0 -> 1
+	{
+		`
+CREATE TABLE partition (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    name                TEXT UNIQUE NOT NULL,
+    begin_stamp         INTEGER NOT NULL,
+    end_stamp           INTEGER NOT NULL,
+    CHECK (begin_stamp < end_stamp)
+) STRICT
+`,
+		"CREATE INDEX partition_begin_idx ON partition (begin_stamp)",
+	},
+	// 1 -> 2
+	//
+	// Searches store the Aggregates of their results.
+	{
+		qSearchAggregates,
+	},
+	// 2 -> 3
+	//
+	// Searches can be named and described, and their results expire.
+	{
+		qSearchTitle,
+		qSearchDescription,
+		qSearchExpired,
+	},
+	// 3 -> 4
+	//
+	// Alert rules and the history of the Alerts they raised.
+	{
+		qAlertRuleInit,
+		qAlertInit,
+		qAlertOpenIndex,
+		qAlertFiredIndex,
+	},
+	// 4 -> 5
+	//
+	// Notifiers and the log of the messages they delivered.
+	{
+		qNotifierInit,
+		qDeliveryInit,
+		qDeliveryStampIndex,
+	},
+	// 5 -> 6
+	//
+	// Watching for Hosts that go silent.
+	{
+		qHostLastRecord,
+		qHostSilenceThreshold,
+		qHostMaintenance,
+		qAlertRuleKind,
+		qAlertRuleSilenceDefault,
+	},
+	// 6 -> 7
+	//
+	// Patterns found by clustering the messages of incoming Records.
+	{
+		qPatternInit,
+		qPatternCountInit,
+		qPatternRecordInit,
+		qPatternRecordIndex,
+		qPatternPartitionTrigger,
+	},
+	// 7 -> 8
+	//
+	// When each Host first logged a message matching a Pattern.
+	{
+		qNoveltyInit,
+		qNoveltyFirstSeenIndex,
+	},
+	// 8 -> 9
+	//
+	// Signatures of well-known events and the Records that matched them.
+	{
+		qSignatureInit,
+		qDetectionInit,
+		qDetectionStampIndex,
+		qDetectionPartitionTrigger,
+	},
+	// 9 -> 10
+	//
+	// Labels and the Scores of the classifier.
+	{
+		qLabelInit,
+		qScoreInit,
+		qScoreStampIndex,
+		qScorePartitionTrigger,
+	},
+	// 10 -> 11
+	//
+	// Annotations and Tags on Records.
+	{
+		qAnnotationInit,
+		qAnnotationRecordIndex,
+		qAnnotationPartitionTrigger,
+		qTagInit,
+		qTagNameIndex,
+		qTagPartitionTrigger,
+	},
+	// 11 -> 12
+	//
+	// Incidents and the Records and Searches pinned to them.
+	{
+		qIncidentInit,
+		qIncidentRecordInit,
+		qIncidentSearchInit,
+	},
+}
+
+// partSchemaVersion is the version of the partition schema created by
+// qInitPartition. It is stored in the user_version of the partition file.
+//
+// Partitions with version 0 were created before sources and messages were
+// normalized. They store the source and message as text in the record
+// table and are upgraded by partitionMigrate when they are opened.
+const partSchemaVersion = 1
+
+// qInitPartition creates the schema of a partition file.
+// Since several connections may try to create the same partition at the
+// same time, all statements must be idempotent.
+//
+// Sources and message templates are stored only once per partition,
+// the parameters of a message are stored as a JSON array.
+var qInitPartition = []string{
+	`
+CREATE TABLE IF NOT EXISTS source (
+    id                  INTEGER PRIMARY KEY,
+    name                TEXT UNIQUE NOT NULL
+) STRICT
+`,
+	`
+CREATE TABLE IF NOT EXISTS template (
+    id                  INTEGER PRIMARY KEY,
+    pattern             TEXT UNIQUE NOT NULL
+) STRICT
+`,
+	`
+CREATE TABLE IF NOT EXISTS record (
+	id		INTEGER PRIMARY KEY,
+        host_id		INTEGER NOT NULL,
+        stamp           INTEGER NOT NULL DEFAULT 0,
+        source_id       INTEGER NOT NULL,
+        template_id     INTEGER NOT NULL,
+        params          TEXT,
+        checksum        TEXT UNIQUE NOT NULL,
+        FOREIGN KEY (source_id) REFERENCES source (id)
+            ON UPDATE RESTRICT
+            ON DELETE RESTRICT,
+        FOREIGN KEY (template_id) REFERENCES template (id)
+            ON UPDATE RESTRICT
+            ON DELETE RESTRICT,
+        CHECK (host_id > 0),
+        CHECK (params IS NULL OR json_valid(params))
+) STRICT
+`,
+	"CREATE INDEX IF NOT EXISTS record_host_idx ON record (host_id)",
+	"CREATE INDEX IF NOT EXISTS record_stamp_idx ON record (stamp)",
+	"CREATE INDEX IF NOT EXISTS record_source_idx ON record (source_id)",
+	"CREATE INDEX IF NOT EXISTS record_template_idx ON record (template_id)",
+	`
+CREATE VIEW IF NOT EXISTS record_full AS
+SELECT
+    r.id,
+    r.host_id,
+    r.stamp,
+    s.name AS source,
+    t.pattern,
+    r.params,
+    r.checksum
+FROM record r
+INNER JOIN source s ON r.source_id = s.id
+INNER JOIN template t ON r.template_id = t.id
+`,
+}
+
+// qMigratePartition contains the statements to upgrade a partition from
+// version 0. The rows are copied over by partitionMigrate, since splitting
+// the messages into templates and parameters cannot be done in SQL.
+var qMigratePartition = []string{
+	"ALTER TABLE record RENAME TO record_old",
+	"DROP INDEX IF EXISTS record_host_idx",
+	"DROP INDEX IF EXISTS record_stamp_idx",
+	"DROP INDEX IF EXISTS record_source_idx",
+	"DROP INDEX IF EXISTS record_ck_idx",
 }
@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 18:44:11 krylon>
+// Time-stamp: <2024-10-12 14:48:30 krylon>
 
 //go:generate stringer -type=ID
 
@@ -18,6 +18,8 @@ const (
 	HostGetByID
 	HostGetAll
 	HostUpdateLastSeen
+	HostUpdateLastRecord
+	HostSetWatch
 	RecordAdd
 	RecordGetByHost
 	RecordGetByPeriod
@@ -25,10 +27,93 @@ const (
 	RecordGetRecent
 	RecordCheckExist
 	RecordGetSources
+	RecordGetByIDList
+	RecordScan
+	RecordScanCount
+	RecordGetBefore
+	RecordGetAfter
+	RecordPageOlder
+	RecordPageNewer
+	RecordGetRates
+	SourceGetOrAdd
+	TemplateGetOrAdd
+	PartitionAdd
+	PartitionGetByTime
+	PartitionGetByID
+	PartitionGetByPeriod
+	PartitionGetAll
+	PartitionGetPrevEnd
+	PartitionGetNextBegin
+	PartitionDelete
 	SearchAdd
 	SearchGetByID
 	SearchGetAllID
 	SearchDelete
-	SearchGetResults
+	SearchGetResultIDs
 	SearchGetResultCount
+	SearchGetAll
+	SearchUpdate
+	SearchExpireDelete
+	SearchExpireResults
+	AlertRuleAdd
+	AlertRuleUpdate
+	AlertRuleDelete
+	AlertRuleGetAll
+	AlertRuleGetByID
+	AlertRuleSilence
+	AlertAdd
+	AlertUpdate
+	AlertResolve
+	AlertGetOpen
+	AlertGetHistory
+	NotifierAdd
+	NotifierUpdate
+	NotifierDelete
+	NotifierGetAll
+	NotifierGetByID
+	DeliveryAdd
+	DeliveryGetRecent
+	PatternAdd
+	PatternUpdate
+	PatternSeen
+	PatternCountAdd
+	PatternRecordAdd
+	PatternGetAll
+	PatternGetByID
+	PatternGetCounts
+	PatternGetRecordIDs
+	NoveltyAdd
+	NoveltyGetRecent
+	NoveltyAcknowledge
+	SignatureAdd
+	SignatureUpdate
+	SignatureDelete
+	SignatureGetAll
+	DetectionAdd
+	DetectionGetRecent
+	DetectionGetByRecord
+	LabelSet
+	LabelDelete
+	LabelGetAll
+	LabelGetByRecord
+	ScoreAdd
+	ScoreGetTop
+	AnnotationAdd
+	AnnotationDelete
+	AnnotationGetByRecords
+	TagAdd
+	TagDelete
+	TagGetByRecords
+	TagGetAll
+	IncidentAdd
+	IncidentUpdate
+	IncidentDelete
+	IncidentGetAll
+	IncidentGetByID
+	IncidentPinRecord
+	IncidentUnpinRecord
+	IncidentGetPins
+	IncidentPinSearch
+	IncidentUnpinSearch
+	IncidentGetSearches
 )
@@ -0,0 +1,136 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/search.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 24. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 10:48:27 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// SearchProgress is updated by RecordSearch while it is running, so other
+// goroutines can keep track of how far along a search is.
+type SearchProgress struct {
+	// Total is the number of Records RecordSearch has to look at. It is
+	// set before the scan begins.
+	Total atomic.Int64
+	// Scanned is the number of Records that have been looked at so far.
+	Scanned atomic.Int64
+	// Matched is the number of Records that matched the query so far.
+	Matched atomic.Int64
+	// err is the error that ended the search early.
+	err atomic.Pointer[error]
+}
+
+// Fail records the error that ended the search early.
+func (p *SearchProgress) Fail(err error) {
+	p.err.Store(&err)
+} // func (p *SearchProgress) Fail(err error)
+
+// Err returns the error that ended the search early, or nil if the search
+// ran to completion or was cancelled. Once the channel RecordSearch sends
+// the Records to is closed, Err has its final value.
+func (p *SearchProgress) Err() error {
+	if err := p.err.Load(); err != nil {
+		return *err
+	}
+
+	return nil
+} // func (p *SearchProgress) Err() error
+
+// CompileSearch compiles the Query of a SearchQuery, if it has one that has
+// not been compiled, yet, using the Hosts from the database. If the
+// SearchQuery looks at Tags, they are resolved, too. Records are tagged
+// all the time, so this happens even if the Query was compiled before.
+func CompileSearch(db Storage, q *model.SearchQuery) error {
+	var (
+		err    error
+		hosts  []model.Host
+		tagged map[string][]int64
+	)
+
+	if q.NeedsCompile() {
+		if hosts, err = db.HostGetAll(); err != nil {
+			return err
+		} else if err = q.Compile(hosts); err != nil {
+			return err
+		}
+	}
+
+	if q.UsesTags() {
+		if tagged, err = db.TagGetAll(); err != nil {
+			return err
+		}
+
+		q.BindTags(tagged)
+	}
+
+	return nil
+} // func CompileSearch(db Storage, q *model.SearchQuery) error
+
+// ScanParams returns the parameters for the RecordScan query: The bounds of
+// the period, and JSON arrays of the Hosts and sources to look at, which
+// are NULL if the search is not limited to specific Hosts or sources.
+func ScanParams(q *model.SearchQuery) (begin, end int64, hosts, sources sql.NullString) {
+	var b = q.Bounds()
+
+	begin, end = periodMin.Unix(), periodMax.Unix()
+
+	if !b.Begin.IsZero() {
+		begin = b.Begin.Unix()
+	}
+
+	if !b.End.IsZero() {
+		end = b.End.Unix()
+	}
+
+	if b.Hosts != nil {
+		var buf, _ = json.Marshal(b.Hosts)
+		hosts = sql.NullString{String: string(buf), Valid: true}
+	}
+
+	if b.Sources != nil {
+		var buf, _ = json.Marshal(b.Sources)
+		sources = sql.NullString{String: string(buf), Valid: true}
+	}
+
+	return
+} // func ScanParams(q *model.SearchQuery) (begin, end int64, hosts, sources sql.NullString)
+
+// EncodeAggregates serializes the Aggregates of a Search for storage in the
+// database. A nil value is stored as NULL.
+func EncodeAggregates(a *model.Aggregates) (sql.NullString, error) {
+	var (
+		err error
+		buf []byte
+	)
+
+	if a == nil {
+		return sql.NullString{}, nil
+	} else if buf, err = json.Marshal(a); err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(buf), Valid: true}, nil
+} // func EncodeAggregates(a *model.Aggregates) (sql.NullString, error)
+
+// DecodeAggregates is the counterpart to EncodeAggregates.
+func DecodeAggregates(s sql.NullString) (*model.Aggregates, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+
+	var a = new(model.Aggregates)
+
+	if err := json.Unmarshal([]byte(s.String), a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+} // func DecodeAggregates(s sql.NullString) (*model.Aggregates, error)
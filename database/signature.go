@@ -0,0 +1,288 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/signature.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-09 18:14:52 krylon>
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/database/query"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// SignatureParams returns the parameters for the SignatureAdd and
+// SignatureUpdate queries, except for the ID.
+func SignatureParams(s *model.Signature) ([]any, error) {
+	var (
+		err error
+		buf []byte
+	)
+
+	if err = s.Validate(); err != nil {
+		return nil, err
+	} else if buf, err = json.Marshal(&s.Query); err != nil {
+		return nil, fmt.Errorf("Cannot serialize Query of Signature %q: %w",
+			s.Name,
+			err)
+	}
+
+	return []any{
+		s.Name,
+		s.Category,
+		s.Severity,
+		s.Description,
+		string(buf),
+		s.Threshold,
+		int64(s.Window / time.Second),
+		s.Builtin,
+		s.Active,
+	}, nil
+} // func SignatureParams(s *model.Signature) ([]any, error)
+
+// ScanSignature reads a Signature from the current row of the result of
+// the SignatureGetAll query.
+func ScanSignature(rows *sql.Rows) (*model.Signature, error) {
+	var (
+		err    error
+		qstr   []byte
+		period int64
+		s      = new(model.Signature)
+	)
+
+	if err = rows.Scan(
+		&s.ID,
+		&s.Name,
+		&s.Category,
+		&s.Severity,
+		&s.Description,
+		&qstr,
+		&s.Threshold,
+		&period,
+		&s.Builtin,
+		&s.Active); err != nil {
+		return nil, fmt.Errorf("Cannot scan Signature: %w", err)
+	} else if err = json.Unmarshal(qstr, &s.Query); err != nil {
+		return nil, fmt.Errorf("Cannot parse Query of Signature %d: %w",
+			s.ID,
+			err)
+	}
+
+	s.Window = time.Duration(period) * time.Second
+
+	return s, nil
+} // func ScanSignature(rows *sql.Rows) (*model.Signature, error)
+
+// ScanDetection reads a Detection from the current row of the result of
+// one of the queries that return Detections.
+func ScanDetection(rows *sql.Rows) (*model.Detection, error) {
+	var (
+		err   error
+		stamp int64
+		d     = new(model.Detection)
+	)
+
+	if err = rows.Scan(&d.RecordID, &d.SignatureID, &d.HostID, &stamp); err != nil {
+		return nil, fmt.Errorf("Cannot scan Detection: %w", err)
+	}
+
+	d.Time = time.Unix(stamp, 0)
+
+	return d, nil
+} // func ScanDetection(rows *sql.Rows) (*model.Detection, error)
+
+// SignatureAdd adds a Signature to the database.
+func (db *Database) SignatureAdd(s *model.Signature) error {
+	var (
+		err  error
+		args []any
+	)
+
+	if args, err = SignatureParams(s); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.SignatureAdd, func(stmt *sql.Stmt) error {
+		return stmt.QueryRow(args...).Scan(&s.ID)
+	}); err != nil {
+		err = fmt.Errorf("Cannot add Signature %q: %w", s.Name, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) SignatureAdd(s *model.Signature) error
+
+// SignatureUpdate saves the changes to an existing Signature.
+func (db *Database) SignatureUpdate(s *model.Signature) error {
+	var (
+		err  error
+		args []any
+		res  sql.Result
+		cnt  int64
+	)
+
+	if args, err = SignatureParams(s); err != nil {
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	if err = db.adHoc(query.SignatureUpdate, func(stmt *sql.Stmt) error {
+		res, err = stmt.Exec(append(args, s.ID)...)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot update Signature %d: %w", s.ID, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	} else if cnt, err = res.RowsAffected(); err != nil {
+		db.log.Printf("[ERROR] Cannot get number of affected rows: %s\n",
+			err.Error())
+		return err
+	} else if cnt == 0 {
+		err = fmt.Errorf("No Signature with ID %d was found in the database", s.ID)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) SignatureUpdate(s *model.Signature) error
+
+// SignatureDelete removes a Signature from the database, along with the
+// record of which Records matched it.
+func (db *Database) SignatureDelete(id int64) error {
+	var err error
+
+	if err = db.adHoc(query.SignatureDelete, func(stmt *sql.Stmt) error {
+		_, err = stmt.Exec(id)
+		return err
+	}); err != nil {
+		err = fmt.Errorf("Cannot delete Signature %d: %w", id, err)
+		db.log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+
+	return nil
+} // func (db *Database) SignatureDelete(id int64) error
+
+// SignatureGetAll returns all Signatures, ordered by category and name.
+func (db *Database) SignatureGetAll() ([]model.Signature, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		sigs = make([]model.Signature, 0)
+	)
+
+	if rows, err = db.queryRows(query.SignatureGetAll); err != nil {
+		db.log.Printf("[ERROR] Cannot query Signatures: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var s *model.Signature
+
+		if s, err = ScanSignature(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		sigs = append(sigs, *s)
+	}
+
+	return sigs, rows.Err()
+} // func (db *Database) SignatureGetAll() ([]model.Signature, error)
+
+// DetectionAdd records that Records matched Signatures. Detections that
+// were recorded before are ignored.
+//
+// If no transaction is in progress, it runs in a transaction of its own.
+func (db *Database) DetectionAdd(list []model.Detection) error {
+	var (
+		err    error
+		status bool
+	)
+
+	if len(list) == 0 {
+		return nil
+	} else if db.tx == nil {
+		if err = db.Begin(); err != nil {
+			return err
+		}
+
+		defer func() {
+			var err2 error
+			if status {
+				if err2 = db.Commit(); err2 != nil {
+					db.log.Printf("[ERROR] Failed to commit ad-hoc transaction: %s\n",
+						err2.Error())
+				}
+			} else if err2 = db.Rollback(); err2 != nil {
+				db.log.Printf("[ERROR] Rollback of ad-hoc transaction failed: %s\n",
+					err2.Error())
+			}
+		}()
+	}
+
+	for _, d := range list {
+		if err = db.adHoc(query.DetectionAdd, func(stmt *sql.Stmt) error {
+			_, err = stmt.Exec(d.RecordID, d.SignatureID, d.HostID, d.Time.Unix())
+			return err
+		}); err != nil {
+			err = fmt.Errorf("Cannot tag Record %d with Signature %d: %w",
+				d.RecordID,
+				d.SignatureID,
+				err)
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return err
+		}
+	}
+
+	status = true
+	return nil
+} // func (db *Database) DetectionAdd(list []model.Detection) error
+
+// DetectionGetRecent returns up to <max> Detections since the given time,
+// most recent first.
+func (db *Database) DetectionGetRecent(since time.Time, max int64) ([]model.Detection, error) {
+	return db.detectionQuery(query.DetectionGetRecent, since.Unix(), max)
+} // func (db *Database) DetectionGetRecent(since time.Time, max int64) ([]model.Detection, error)
+
+// DetectionGetByRecord returns the Detections for the given Record.
+func (db *Database) DetectionGetByRecord(id int64) ([]model.Detection, error) {
+	return db.detectionQuery(query.DetectionGetByRecord, id)
+} // func (db *Database) DetectionGetByRecord(id int64) ([]model.Detection, error)
+
+func (db *Database) detectionQuery(qid query.ID, args ...any) ([]model.Detection, error) {
+	var (
+		err  error
+		rows *sql.Rows
+		list = make([]model.Detection, 0)
+	)
+
+	if rows, err = db.queryRows(qid, args...); err != nil {
+		db.log.Printf("[ERROR] Cannot query Detections: %s\n", err.Error())
+		return nil, err
+	}
+
+	defer rows.Close() // nolint: errcheck,gosec
+
+	for rows.Next() {
+		var d *model.Detection
+
+		if d, err = ScanDetection(rows); err != nil {
+			db.log.Printf("[ERROR] %s\n", err.Error())
+			return nil, err
+		}
+
+		list = append(list, *d)
+	}
+
+	return list, rows.Err()
+} // func (db *Database) detectionQuery(qid query.ID, args ...any) ([]model.Detection, error)
@@ -0,0 +1,245 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/storage.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 10:50:02 krylon>
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Storage is the interface the rest of the application uses to talk to the
+// database. Database implements it on top of SQLite, the postgres package
+// provides an implementation on top of PostgreSQL.
+//
+// A Storage value is not safe for concurrent use, use a Pool to share
+// Storage connections between goroutines.
+type Storage interface {
+	// Close closes the connection. A pending transaction is rolled back.
+	Close() error
+	// PerformMaintenance performs whatever housekeeping the backend
+	// requires. It cannot be called while a transaction is in progress.
+	PerformMaintenance() error
+
+	// Begin starts an explicit transaction. All subsequent operations are
+	// part of that transaction until Commit or Rollback are called.
+	Begin() error
+	// Commit ends the active transaction, making all changes permanent.
+	Commit() error
+	// Rollback ends the active transaction, undoing all changes.
+	Rollback() error
+	// InTransaction returns true if a transaction is in progress.
+	InTransaction() bool
+
+	HostAdd(h *model.Host) error
+	HostGetByName(name string) (*model.Host, error)
+	HostGetByID(id int64) (*model.Host, error)
+	HostGetAll() ([]model.Host, error)
+	HostUpdateLastSeen(h *model.Host, timestamp time.Time) error
+	HostUpdateLastRecord(h *model.Host, timestamp time.Time) error
+	HostSetWatch(h *model.Host) error
+
+	RecordAdd(r *model.Record) error
+	RecordGetByHost(h *model.Host, max int64) ([]model.Record, error)
+	RecordGetByPeriod(begin, end time.Time) ([]model.Record, error)
+	RecordGetMostRecent(hostID int64) (time.Time, error)
+	RecordCheckExist(r *model.Record) (bool, error)
+	RecordGetRecent(max int64) ([]model.Record, error)
+	// RecordGetPage returns a page of Records for browsing the log, most
+	// recent first.
+	RecordGetPage(page *RecordPage) ([]model.Record, error)
+	RecordGetSources() (map[string]int64, error)
+	// RecordGetRates returns the number of Records each Host logged from
+	// each source per period of the given width between begin and end.
+	// The periods start at begin.
+	RecordGetRates(begin, end time.Time, width time.Duration) ([]model.RateCount, error)
+	RecordGetByIDList(ids []int64) ([]model.Record, error)
+	// RecordGetContext returns the Record with the given ID along with up
+	// to <before> and <after> Records its Host logged around it, in
+	// chronological order, or nil if the Record does not exist.
+	RecordGetContext(id, before, after int64, sameSource bool) ([]model.Record, error)
+	// RecordSearch sends all Records matching the query to the channel,
+	// most recent first, and closes the channel when it is done. If the
+	// context is cancelled, it stops early. If prog is not nil, it is
+	// updated as the search progresses, and if the search fails, the
+	// error is available from prog.Err once the channel is closed.
+	RecordSearch(ctx context.Context, search *model.SearchQuery, q chan<- model.Record, prog *SearchProgress)
+
+	SearchAdd(search *model.Search) error
+	// SearchUpdate saves the Title, Description, Query and results of a
+	// Search that already exists, so it keeps its ID.
+	SearchUpdate(search *model.Search) error
+	SearchDelete(id int64) error
+	// SearchExpire drops the results of Searches run before the given
+	// time. Searches without a Title are deleted.
+	SearchExpire(before time.Time) (int64, error)
+	SearchGetByID(id int64) (*model.Search, error)
+	SearchGetResults(id, offset, cnt int64) ([]model.Record, error)
+	SearchGetAllID() ([][2]int64, error)
+	// SearchGetAll returns all Searches, most recent first, without their
+	// Query, Results, or Aggregates.
+	SearchGetAll() ([]model.Search, error)
+	SearchGetResultCount(id int64) (int64, error)
+
+	AlertRuleAdd(r *model.AlertRule) error
+	AlertRuleUpdate(r *model.AlertRule) error
+	// AlertRuleDelete removes an alert rule along with its Alerts.
+	AlertRuleDelete(id int64) error
+	// AlertRuleSilence silences a rule until the given time.
+	AlertRuleSilence(id int64, until time.Time) error
+	AlertRuleGetAll() ([]model.AlertRule, error)
+	AlertRuleGetByID(id int64) (*model.AlertRule, error)
+	// AlertAdd records a new Alert. There can only be one open Alert per
+	// rule and Host.
+	AlertAdd(a *model.Alert) error
+	// AlertUpdate saves the LastSeen and Count of an open Alert.
+	AlertUpdate(a *model.Alert) error
+	AlertResolve(a *model.Alert, t time.Time) error
+	// AlertGetOpen returns the Alerts that are still firing.
+	AlertGetOpen() ([]model.Alert, error)
+	// AlertGetHistory returns up to <max> Alerts, most recent first.
+	AlertGetHistory(max int64) ([]model.Alert, error)
+
+	NotifierAdd(n *model.Notifier) error
+	NotifierUpdate(n *model.Notifier) error
+	// NotifierDelete removes a Notifier along with its delivery log.
+	NotifierDelete(id int64) error
+	NotifierGetAll() ([]model.Notifier, error)
+	NotifierGetByID(id int64) (*model.Notifier, error)
+	// DeliveryAdd adds an entry to the delivery log.
+	DeliveryAdd(d *model.Delivery) error
+	// DeliveryGetRecent returns up to <max> entries from the delivery
+	// log, most recent first.
+	DeliveryGetRecent(max int64) ([]model.Delivery, error)
+
+	// PatternAdd adds a new Pattern, starting with a Count of 0.
+	PatternAdd(p *model.Pattern) error
+	// PatternUpdate saves the Template of a Pattern.
+	PatternUpdate(p *model.Pattern) error
+	// PatternAddRecords records that the Records match the Pattern and
+	// updates its counts, FirstSeen and LastSeen. If a Host logs a
+	// message matching the Pattern from a source for the first time, a
+	// Novelty is added.
+	PatternAddRecords(p *model.Pattern, records []model.Record) error
+	// PatternGetAll returns all Patterns, the most common first, with
+	// the number of Records since the given time in their Recent field.
+	PatternGetAll(since time.Time) ([]model.Pattern, error)
+	PatternGetByID(id int64) (*model.Pattern, error)
+	// PatternGetCounts returns the number of Records matching a Pattern
+	// per model.PatternBucket since the given time.
+	PatternGetCounts(id int64, begin time.Time) ([]model.Bucket, error)
+	// PatternGetRecordIDs returns the IDs of up to <max> Records matching
+	// a Pattern, most recent first.
+	PatternGetRecordIDs(id, max int64) ([]int64, error)
+
+	// NoveltyGetRecent returns the Novelties first seen since the given
+	// time that have not been acknowledged, most recent first.
+	NoveltyGetRecent(since time.Time) ([]model.Novelty, error)
+	NoveltyAcknowledge(id int64) error
+
+	SignatureAdd(s *model.Signature) error
+	SignatureUpdate(s *model.Signature) error
+	// SignatureDelete removes a Signature along with its Detections.
+	SignatureDelete(id int64) error
+	// SignatureGetAll returns all Signatures, ordered by category and
+	// name.
+	SignatureGetAll() ([]model.Signature, error)
+	// DetectionAdd records that Records matched Signatures, ignoring the
+	// Detections that were recorded before.
+	DetectionAdd(list []model.Detection) error
+	// DetectionGetRecent returns up to <max> Detections since the given
+	// time, most recent first.
+	DetectionGetRecent(since time.Time, max int64) ([]model.Detection, error)
+	DetectionGetByRecord(id int64) ([]model.Detection, error)
+
+	// LabelSet labels a Record as interesting or not, replacing its
+	// previous Label.
+	LabelSet(l *model.Label) error
+	LabelDelete(id int64) error
+	// LabelGetAll returns all Labels, in the order they were set.
+	LabelGetAll() ([]model.Label, error)
+	// LabelGetByRecord returns the Label of a Record, or nil if it has
+	// none.
+	LabelGetByRecord(id int64) (*model.Label, error)
+	// ScoreAdd saves the Scores of Records, replacing their previous
+	// Scores.
+	ScoreAdd(list []model.Score) error
+	// ScoreGetTop returns up to <max> Scores of Records since the given
+	// time, the highest first.
+	ScoreGetTop(since time.Time, max int64) ([]model.Score, error)
+
+	AnnotationAdd(a *model.Annotation) error
+	AnnotationDelete(id int64) error
+	// AnnotationGetByRecords returns the Annotations of the given
+	// Records, oldest first, keyed by the ID of their Record.
+	AnnotationGetByRecords(ids []int64) (map[int64][]model.Annotation, error)
+	// TagAdd puts a Tag on a Record. Adding a Tag the Record already
+	// carries is not an error.
+	TagAdd(t *model.Tag) error
+	TagDelete(recordID int64, name string) error
+	// TagGetByRecords returns the Tags of the given Records, keyed by
+	// the ID of their Record.
+	TagGetByRecords(ids []int64) (map[int64][]model.Tag, error)
+	// TagGetAll returns the IDs of the tagged Records, keyed by the name
+	// of the Tag.
+	TagGetAll() (map[string][]int64, error)
+
+	IncidentAdd(i *model.Incident) error
+	IncidentUpdate(i *model.Incident) error
+	// IncidentDelete removes an Incident, along with its pinned Records
+	// and Searches. The Searches themselves are left alone.
+	IncidentDelete(id int64) error
+	// IncidentGetAll returns all Incidents, most recent first.
+	IncidentGetAll() ([]model.Incident, error)
+	// IncidentGetByID returns the Incident with the given ID, or nil if
+	// it does not exist.
+	IncidentGetByID(id int64) (*model.Incident, error)
+	// IncidentPinRecord pins a Record to an Incident. If it is pinned
+	// already, only its Note is updated.
+	IncidentPinRecord(p *model.Pin) error
+	IncidentUnpinRecord(incidentID, recordID int64) error
+	// IncidentGetPins returns the Records pinned to an Incident, oldest
+	// first.
+	IncidentGetPins(id int64) ([]model.Pin, error)
+	// IncidentPinSearch pins a saved Search to an Incident. Pinning a
+	// Search twice is not an error.
+	IncidentPinSearch(incidentID, searchID int64) error
+	IncidentUnpinSearch(incidentID, searchID int64) error
+	// IncidentGetSearches returns the IDs of the Searches pinned to an
+	// Incident, in the order they were pinned.
+	IncidentGetSearches(id int64) ([]int64, error)
+}
+
+// Opener is a function that opens a new Storage connection.
+type Opener func() (Storage, error)
+
+// DefaultOpener is used by Pool to open connections. By default, it opens
+// the SQLite database in the application's base directory.
+var DefaultOpener Opener = openSQLite
+
+func openSQLite() (Storage, error) {
+	var (
+		err error
+		db  *Database
+	)
+
+	if db, err = Open(common.Path(path.Database)); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+} // func openSQLite() (Storage, error)
+
+// InTransaction returns true if a transaction is in progress.
+func (db *Database) InTransaction() bool {
+	return db.tx != nil
+} // func (db *Database) InTransaction() bool
+
+var _ Storage = (*Database)(nil)
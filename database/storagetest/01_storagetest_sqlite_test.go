@@ -0,0 +1,30 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/storagetest/01_storagetest_sqlite_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-19 22:21:48 krylon>
+
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/database"
+)
+
+func TestSQLite(t *testing.T) {
+	var (
+		err error
+		db  *database.Database
+	)
+
+	if db, err = database.Open(common.Path(path.Database)); err != nil {
+		t.Fatalf("Cannot open SQLite database: %s", err.Error())
+	}
+
+	defer db.Close() // nolint: errcheck
+
+	Run(t, db)
+} // func TestSQLite(t *testing.T)
@@ -0,0 +1,36 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/storagetest/02_storagetest_postgres_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-19 22:24:10 krylon>
+
+package storagetest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blicero/scrollmaster/database/postgres"
+)
+
+// TestPostgres runs the test suite against a PostgreSQL database. Since
+// that requires a running server, the test is skipped unless the
+// environment variable SCROLLMASTER_PG_DSN contains a connection string,
+// e.g. "postgres://scrollmaster@localhost/scrollmaster_test?sslmode=disable"
+func TestPostgres(t *testing.T) {
+	var (
+		err error
+		dsn string
+		db  *postgres.Database
+	)
+
+	if dsn = os.Getenv(postgres.EnvDSN); dsn == "" {
+		t.Skipf("%s is not set", postgres.EnvDSN)
+	} else if db, err = postgres.Open(dsn); err != nil {
+		t.Fatalf("Cannot open PostgreSQL database: %s", err.Error())
+	}
+
+	defer db.Close() // nolint: errcheck
+
+	Run(t, db)
+} // func TestPostgres(t *testing.T)
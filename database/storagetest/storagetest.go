@@ -0,0 +1,1515 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/database/storagetest/storagetest.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 19. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 15:48:20 krylon>
+
+// Package storagetest provides a test suite that every implementation of
+// database.Storage has to pass.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+const (
+	hostCnt   = 3
+	recordCnt = 50
+	step      = time.Minute
+)
+
+type suite struct {
+	db    database.Storage
+	hosts []*model.Host
+	begin time.Time
+}
+
+// Run runs the test suite against the given Storage.
+// The Storage does not need to be empty, but it should not be used for
+// anything else while the suite is running.
+func Run(t *testing.T, db database.Storage) {
+	var s = &suite{
+		db:    db,
+		begin: time.Now().Add(-recordCnt * step).Truncate(time.Second),
+	}
+
+	t.Run("HostAdd", s.testHostAdd)
+	t.Run("RecordAdd", s.testRecordAdd)
+	t.Run("RecordQuery", s.testRecordQuery)
+	t.Run("RecordContext", s.testRecordContext)
+	t.Run("RecordPage", s.testRecordPage)
+	t.Run("RecordRates", s.testRecordRates)
+	t.Run("Transaction", s.testTransaction)
+	t.Run("Search", s.testSearch)
+	t.Run("SearchSaved", s.testSearchSaved)
+	t.Run("Alert", s.testAlert)
+	t.Run("Notifier", s.testNotifier)
+	t.Run("Pattern", s.testPattern)
+	t.Run("Novelty", s.testNovelty)
+	t.Run("Signature", s.testSignature)
+	t.Run("Label", s.testLabel)
+	t.Run("Annotation", s.testAnnotation)
+	t.Run("Incident", s.testIncident)
+} // func Run(t *testing.T, db database.Storage)
+
+func (s *suite) testHostAdd(t *testing.T) {
+	var suffix = time.Now().UnixNano()
+
+	for i := 0; i < hostCnt; i++ {
+		var (
+			err error
+			h   *model.Host
+			ref = &model.Host{
+				Name:     fmt.Sprintf("host%02d.%d.example.com", i+1, suffix),
+				LastSeen: s.begin,
+			}
+		)
+
+		if err = s.db.HostAdd(ref); err != nil {
+			t.Fatalf("Cannot add Host %s: %s", ref.Name, err.Error())
+		} else if ref.ID == 0 {
+			t.Fatalf("Host %s was added, but has no ID", ref.Name)
+		} else if h, err = s.db.HostGetByName(ref.Name); err != nil {
+			t.Fatalf("Cannot look up Host %s: %s", ref.Name, err.Error())
+		} else if h == nil {
+			t.Fatalf("Host %s was not found in database", ref.Name)
+		} else if h.ID != ref.ID {
+			t.Errorf("Host %s has ID %d, expected %d", ref.Name, h.ID, ref.ID)
+		} else if h, err = s.db.HostGetByID(ref.ID); err != nil {
+			t.Fatalf("Cannot look up Host #%d: %s", ref.ID, err.Error())
+		} else if h == nil || h.Name != ref.Name {
+			t.Errorf("Looking up Host #%d did not return %s", ref.ID, ref.Name)
+		}
+
+		s.hosts = append(s.hosts, ref)
+	}
+
+	var (
+		err error
+		h   *model.Host
+	)
+
+	if h, err = s.db.HostGetByName("no.such.host.invalid"); err != nil {
+		t.Errorf("Looking up a non-existent Host returned an error: %s", err.Error())
+	} else if h != nil {
+		t.Errorf("Looking up a non-existent Host returned %#v", h)
+	} else if err = s.db.HostUpdateLastSeen(s.hosts[0], time.Now()); err != nil {
+		t.Errorf("Cannot update LastSeen of Host %s: %s",
+			s.hosts[0].Name,
+			err.Error())
+	}
+
+	var (
+		watched = s.hosts[hostCnt-1]
+		stamp   = time.Now().Truncate(time.Second)
+	)
+
+	watched.SilenceThreshold = time.Hour
+	watched.Maintenance = true
+
+	if err = s.db.HostUpdateLastRecord(watched, stamp); err != nil {
+		t.Fatalf("Cannot update LastRecord of Host %s: %s", watched.Name, err.Error())
+	} else if err = s.db.HostSetWatch(watched); err != nil {
+		t.Fatalf("Cannot set watch of Host %s: %s", watched.Name, err.Error())
+	} else if h, err = s.db.HostGetByID(watched.ID); err != nil {
+		t.Fatalf("Cannot look up Host #%d: %s", watched.ID, err.Error())
+	} else if !h.LastRecord.Equal(stamp) || h.SilenceThreshold != time.Hour || !h.Maintenance {
+		t.Errorf("Watch settings of Host %s were not saved: %#v", watched.Name, h)
+	} else if h, err = s.db.HostGetByID(s.hosts[0].ID); err != nil {
+		t.Fatalf("Cannot look up Host #%d: %s", s.hosts[0].ID, err.Error())
+	} else if !h.LastRecord.IsZero() || h.SilenceThreshold != 0 || h.Maintenance {
+		t.Errorf("Host %s should have default watch settings: %#v", h.Name, h)
+	}
+
+	watched.SilenceThreshold = 0
+	watched.Maintenance = false
+
+	if err = s.db.HostSetWatch(watched); err != nil {
+		t.Errorf("Cannot reset watch of Host %s: %s", watched.Name, err.Error())
+	}
+} // func (s *suite) testHostAdd(t *testing.T)
+
+func (s *suite) testRecordAdd(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	for _, h := range s.hosts {
+		for i := 0; i < recordCnt; i++ {
+			var (
+				err   error
+				exist bool
+				rec   = model.Record{
+					HostID:  h.ID,
+					Time:    s.begin.Add(step * time.Duration(i)),
+					Source:  fmt.Sprintf("source%d", i%2),
+					Message: fmt.Sprintf("Test message #%03d from %s", i, h.Name),
+				}
+			)
+
+			if err = s.db.RecordAdd(&rec); err != nil {
+				t.Fatalf("Cannot add Record %q: %s", rec.Message, err.Error())
+			} else if rec.ID == 0 {
+				t.Fatalf("Record %q was added, but has no ID", rec.Message)
+			}
+
+			var dup = model.Record{
+				HostID:  rec.HostID,
+				Time:    rec.Time,
+				Source:  rec.Source,
+				Message: rec.Message,
+			}
+
+			if exist, err = s.db.RecordCheckExist(&dup); err != nil {
+				t.Fatalf("Cannot check if Record %q exists: %s", rec.Message, err.Error())
+			} else if !exist {
+				t.Fatalf("Record %q was added, but RecordCheckExist does not find it",
+					rec.Message)
+			}
+		}
+	}
+} // func (s *suite) testRecordAdd(t *testing.T)
+
+func (s *suite) testRecordQuery(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		stamp   time.Time
+		records []model.Record
+		sources map[string]int64
+		h       = s.hosts[0]
+		last    = s.begin.Add(step * (recordCnt - 1))
+	)
+
+	if records, err = s.db.RecordGetByHost(h, 10); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 10 {
+		t.Errorf("Unexpected number of Records for Host %s: %d (expected 10)",
+			h.Name,
+			len(records))
+	} else if !records[0].Time.Equal(last) {
+		t.Errorf("Most recent Record for Host %s is from %s, expected %s",
+			h.Name,
+			records[0].Time,
+			last)
+	}
+
+	if records, err = s.db.RecordGetByPeriod(s.begin, s.begin.Add(step*9)); err != nil {
+		t.Fatalf("Cannot get Records by period: %s", err.Error())
+	} else if len(records) != hostCnt*10 {
+		t.Errorf("Unexpected number of Records by period: %d (expected %d)",
+			len(records),
+			hostCnt*10)
+	}
+
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Before(records[i-1].Time) {
+			t.Errorf("Records by period are not in order: %s < %s",
+				records[i].Time,
+				records[i-1].Time)
+			break
+		}
+	}
+
+	if stamp, err = s.db.RecordGetMostRecent(h.ID); err != nil {
+		t.Errorf("Cannot get most recent timestamp for Host %s: %s", h.Name, err.Error())
+	} else if !stamp.Equal(last) {
+		t.Errorf("Most recent timestamp for Host %s is %s, expected %s",
+			h.Name,
+			stamp,
+			last)
+	}
+
+	if records, err = s.db.RecordGetRecent(5); err != nil {
+		t.Errorf("Cannot get recent Records: %s", err.Error())
+	} else if len(records) != 5 {
+		t.Errorf("Unexpected number of recent Records: %d (expected 5)", len(records))
+	} else {
+		var ids = []int64{records[0].ID, records[4].ID}
+
+		if records, err = s.db.RecordGetByIDList(ids); err != nil {
+			t.Errorf("Cannot get Records by ID: %s", err.Error())
+		} else if len(records) != len(ids) {
+			t.Errorf("Unexpected number of Records by ID: %d (expected %d)",
+				len(records),
+				len(ids))
+		}
+	}
+
+	if sources, err = s.db.RecordGetSources(); err != nil {
+		t.Errorf("Cannot get sources: %s", err.Error())
+	} else if sources["source0"] < hostCnt*recordCnt/2 {
+		t.Errorf("Unexpected count for source0: %d (expected at least %d)",
+			sources["source0"],
+			hostCnt*recordCnt/2)
+	}
+} // func (s *suite) testRecordQuery(t *testing.T)
+
+func (s *suite) testRecordContext(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		anchor  model.Record
+		h       = s.hosts[1]
+	)
+
+	if records, err = s.db.RecordGetByPeriod(s.begin.Add(step*10), s.begin.Add(step*10)); err != nil {
+		t.Fatalf("Cannot get Records by period: %s", err.Error())
+	}
+
+	for _, r := range records {
+		if r.HostID == h.ID {
+			anchor = r
+		}
+	}
+
+	if anchor.ID == 0 {
+		t.Fatalf("Cannot find Record #010 of Host %s", h.Name)
+	} else if records, err = s.db.RecordGetContext(anchor.ID, 5, 3, false); err != nil {
+		t.Fatalf("Cannot get context of Record %d: %s", anchor.ID, err.Error())
+	} else if len(records) != 9 {
+		t.Fatalf("Unexpected number of Records in context: %d (expected 9)",
+			len(records))
+	} else if records[5].ID != anchor.ID {
+		t.Errorf("Record %d is not in the middle of its context: %d",
+			anchor.ID,
+			records[5].ID)
+	}
+
+	for i, r := range records {
+		var expected = s.begin.Add(step * time.Duration(5+i))
+
+		if r.HostID != h.ID {
+			t.Errorf("Context of Record %d contains Record %d of Host %d",
+				anchor.ID,
+				r.ID,
+				r.HostID)
+		} else if !r.Time.Equal(expected) {
+			t.Errorf("Record #%d of context is from %s, expected %s",
+				i,
+				r.Time,
+				expected)
+		}
+	}
+
+	// Restricted to the same source, we only get every other Record.
+	if records, err = s.db.RecordGetContext(anchor.ID, 3, 3, true); err != nil {
+		t.Fatalf("Cannot get context of Record %d: %s", anchor.ID, err.Error())
+	} else if len(records) != 7 {
+		t.Fatalf("Unexpected number of Records in context: %d (expected 7)",
+			len(records))
+	} else if !records[0].Time.Equal(s.begin.Add(step*4)) || !records[6].Time.Equal(s.begin.Add(step*16)) {
+		t.Errorf("Context of Record %d covers %s - %s",
+			anchor.ID,
+			records[0].Time,
+			records[6].Time)
+	}
+
+	for _, r := range records {
+		if r.Source != anchor.Source {
+			t.Errorf("Context of Record %d contains Record %d from %s",
+				anchor.ID,
+				r.ID,
+				r.Source)
+		}
+	}
+
+	// Near the edge, we get what there is.
+	if records, err = s.db.RecordGetContext(anchor.ID, 100, 0, false); err != nil {
+		t.Fatalf("Cannot get context of Record %d: %s", anchor.ID, err.Error())
+	} else if len(records) != 11 {
+		t.Errorf("Unexpected number of Records in context: %d (expected 11)",
+			len(records))
+	} else if records, err = s.db.RecordGetContext(1<<62, 5, 5, false); err != nil {
+		t.Errorf("Cannot get context of nonexistent Record: %s", err.Error())
+	} else if records != nil {
+		t.Errorf("Context of nonexistent Record is not nil: %d Records",
+			len(records))
+	}
+} // func (s *suite) testRecordContext(t *testing.T)
+
+func (s *suite) testRecordPage(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		h       = s.hosts[2]
+		page    = &database.RecordPage{
+			Hosts:   []int64{h.ID},
+			Sources: []string{"source1"},
+			Count:   10,
+		}
+	)
+
+	// checkPage verifies that records are the Records of Host h from
+	// source1 numbered first, first-2, ..., most recent first.
+	var checkPage = func(records []model.Record, first, cnt int) {
+		t.Helper()
+		if len(records) != cnt {
+			t.Fatalf("Unexpected number of Records on page: %d (expected %d)",
+				len(records),
+				cnt)
+		}
+
+		for i, r := range records {
+			var expected = s.begin.Add(step * time.Duration(first-2*i))
+
+			if r.HostID != h.ID || r.Source != "source1" {
+				t.Errorf("Page contains Record %d of Host %d from %s",
+					r.ID,
+					r.HostID,
+					r.Source)
+			} else if !r.Time.Equal(expected) {
+				t.Errorf("Record #%d of page is from %s, expected %s",
+					i,
+					r.Time,
+					expected)
+			}
+		}
+	}
+
+	if records, err = s.db.RecordGetPage(page); err != nil {
+		t.Fatalf("Cannot get most recent page: %s", err.Error())
+	}
+
+	checkPage(records, recordCnt-1, 10)
+
+	page.Stamp = records[9].Time
+	page.ID = records[9].ID
+
+	if records, err = s.db.RecordGetPage(page); err != nil {
+		t.Fatalf("Cannot get older page: %s", err.Error())
+	}
+
+	checkPage(records, recordCnt-21, 10)
+
+	page.Stamp = records[0].Time
+	page.ID = records[0].ID
+	page.Newer = true
+	page.Count = 5
+
+	if records, err = s.db.RecordGetPage(page); err != nil {
+		t.Fatalf("Cannot get newer page: %s", err.Error())
+	}
+
+	checkPage(records, recordCnt-11, 5)
+
+	// Beyond the oldest Record, the page is empty.
+	page.Stamp = s.begin
+	page.ID = 0
+	page.Newer = false
+
+	if records, err = s.db.RecordGetPage(page); err != nil {
+		t.Fatalf("Cannot get page before the first Record: %s", err.Error())
+	} else if len(records) != 0 {
+		t.Errorf("Page before the first Record contains %d Records",
+			len(records))
+	}
+} // func (s *suite) testRecordPage(t *testing.T)
+
+func (s *suite) testRecordRates(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	const width = step * 10
+
+	var (
+		err    error
+		counts []model.RateCount
+		h      = s.hosts[0]
+		seen   = make(map[string]int)
+	)
+
+	if counts, err = s.db.RecordGetRates(s.begin, s.begin.Add(step*recordCnt), width); err != nil {
+		t.Fatalf("Cannot count Records: %s", err.Error())
+	}
+
+	// The Records alternate between two sources, so each one has half
+	// of the Records in each period.
+	for _, c := range counts {
+		if c.HostID != h.ID {
+			continue
+		} else if offset := c.Begin.Sub(s.begin); offset%width != 0 {
+			t.Errorf("Period for %s begins at %s, which is not a multiple of %s after %s",
+				c.Source,
+				c.Begin,
+				width,
+				s.begin)
+		} else if c.Count != int64(width/step)/2 {
+			t.Errorf("Unexpected count for %s at %s: %d (expected %d)",
+				c.Source,
+				c.Begin,
+				c.Count,
+				int64(width/step)/2)
+		}
+
+		seen[c.Source]++
+	}
+
+	for _, src := range []string{"source0", "source1"} {
+		if seen[src] != int(recordCnt*step/width) {
+			t.Errorf("Unexpected number of periods for %s: %d (expected %d)",
+				src,
+				seen[src],
+				recordCnt*step/width)
+		}
+	}
+} // func (s *suite) testRecordRates(t *testing.T)
+
+func (s *suite) testTransaction(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err   error
+		exist bool
+		rec   = model.Record{
+			HostID:  s.hosts[1].ID,
+			Time:    s.begin.Add(step / 2),
+			Source:  "source0",
+			Message: "This Record is rolled back",
+		}
+		dup = rec
+	)
+
+	if err = s.db.Begin(); err != nil {
+		t.Fatalf("Cannot begin transaction: %s", err.Error())
+	} else if !s.db.InTransaction() {
+		t.Errorf("InTransaction returned false after Begin")
+	}
+
+	if err = s.db.Begin(); err != database.ErrTxInProgress {
+		t.Errorf("Starting a second transaction should return ErrTxInProgress, not %v", err)
+	}
+
+	if err = s.db.RecordAdd(&rec); err != nil {
+		s.db.Rollback() // nolint: errcheck
+		t.Fatalf("Cannot add Record: %s", err.Error())
+	} else if err = s.db.Rollback(); err != nil {
+		t.Fatalf("Cannot roll back transaction: %s", err.Error())
+	} else if s.db.InTransaction() {
+		t.Errorf("InTransaction returned true after Rollback")
+	} else if exist, err = s.db.RecordCheckExist(&dup); err != nil {
+		t.Errorf("Cannot check if Record exists: %s", err.Error())
+	} else if exist {
+		t.Errorf("Record was added in a transaction that was rolled back, but it exists")
+	}
+
+	if err = s.db.Commit(); err != database.ErrNoTxInProgress {
+		t.Errorf("Commit without a transaction should return ErrNoTxInProgress, not %v", err)
+	}
+} // func (s *suite) testTransaction(t *testing.T)
+
+func (s *suite) testSearch(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		search  *model.Search
+		records []model.Record
+		agg     model.Aggregator
+		q       = make(chan model.Record)
+		res     = &model.Search{
+			Timestamp: time.Now(),
+			Query: model.SearchQuery{
+				Hosts:  []int64{s.hosts[2].ID},
+				Period: []time.Time{s.begin, s.begin.Add(step * (recordCnt - 1))},
+				Terms:  []*regexp.Regexp{regexp.MustCompile(`#0[0-4]\d`)},
+			},
+		}
+	)
+
+	go s.db.RecordSearch(context.Background(), &res.Query, q, nil)
+
+	for r := range q {
+		res.Results = append(res.Results, r.ID)
+		agg.Add(&r)
+	}
+
+	res.Aggregates = agg.Aggregates()
+
+	if len(res.Results) != recordCnt {
+		t.Fatalf("Unexpected number of search results: %d (expected %d)",
+			len(res.Results),
+			recordCnt)
+	} else if err = s.db.SearchAdd(res); err != nil {
+		t.Fatalf("Cannot add Search: %s", err.Error())
+	} else if search, err = s.db.SearchGetByID(res.ID); err != nil {
+		t.Fatalf("Cannot get Search #%d: %s", res.ID, err.Error())
+	} else if search == nil {
+		t.Fatalf("Search #%d was not found", res.ID)
+	} else if len(search.Results) != recordCnt {
+		t.Errorf("Unexpected number of results in stored Search: %d (expected %d)",
+			len(search.Results),
+			recordCnt)
+	} else if search.Aggregates == nil {
+		t.Errorf("Stored Search #%d has no Aggregates", res.ID)
+	} else if len(search.Aggregates.Histogram) != len(res.Aggregates.Histogram) {
+		t.Errorf("Unexpected number of buckets in stored Search: %d (expected %d)",
+			len(search.Aggregates.Histogram),
+			len(res.Aggregates.Histogram))
+	} else if len(search.Aggregates.Hosts) != 1 || search.Aggregates.Hosts[0].ID != s.hosts[2].ID {
+		t.Errorf("Unexpected Hosts in Aggregates of stored Search: %#v",
+			search.Aggregates.Hosts)
+	} else if records, err = s.db.SearchGetResults(res.ID, 10, 20); err != nil {
+		t.Errorf("Cannot get results of Search #%d: %s", res.ID, err.Error())
+	} else if len(records) != 20 {
+		t.Errorf("Unexpected number of results: %d (expected 20)", len(records))
+	}
+
+	var (
+		cnt   int64
+		idcnt [][2]int64
+	)
+
+	if cnt, err = s.db.SearchGetResultCount(res.ID); err != nil {
+		t.Errorf("Cannot get result count of Search #%d: %s", res.ID, err.Error())
+	} else if cnt != recordCnt {
+		t.Errorf("Unexpected result count: %d (expected %d)", cnt, recordCnt)
+	} else if idcnt, err = s.db.SearchGetAllID(); err != nil {
+		t.Errorf("Cannot get IDs of all Searches: %s", err.Error())
+	} else if len(idcnt) == 0 {
+		t.Errorf("SearchGetAllID did not return any Searches")
+	} else if err = s.db.SearchDelete(res.ID); err != nil {
+		t.Errorf("Cannot delete Search #%d: %s", res.ID, err.Error())
+	} else if search, err = s.db.SearchGetByID(res.ID); err != nil {
+		t.Errorf("Cannot look up deleted Search #%d: %s", res.ID, err.Error())
+	} else if search != nil {
+		t.Errorf("Search #%d still exists after it was deleted", res.ID)
+	}
+} // func (s *suite) testSearch(t *testing.T)
+
+func (s *suite) testSearchSaved(t *testing.T) {
+	var (
+		err      error
+		cnt      int64
+		search   *model.Search
+		searches []model.Search
+		stamp    = time.Now().Add(-time.Hour)
+		named    = &model.Search{
+			Timestamp: stamp,
+			Title:     "sshd",
+			Query:     model.SearchQuery{Query: "source:sshd"},
+			Results:   []int64{1, 2, 3},
+		}
+		anon = &model.Search{
+			Timestamp: stamp,
+			Query:     model.SearchQuery{Query: "source:cron"},
+			Results:   []int64{4, 5},
+		}
+	)
+
+	if err = s.db.SearchAdd(named); err != nil {
+		t.Fatalf("Cannot add Search: %s", err.Error())
+	} else if err = s.db.SearchAdd(anon); err != nil {
+		t.Fatalf("Cannot add Search: %s", err.Error())
+	}
+
+	named.Title = "SSH logins"
+	named.Description = "Everything sshd had to say"
+
+	if err = s.db.SearchUpdate(named); err != nil {
+		t.Fatalf("Cannot update Search #%d: %s", named.ID, err.Error())
+	} else if searches, err = s.db.SearchGetAll(); err != nil {
+		t.Fatalf("Cannot get all Searches: %s", err.Error())
+	} else if len(searches) != 2 {
+		t.Fatalf("Unexpected number of Searches: %d (expected 2)", len(searches))
+	} else if searches[0].ID != anon.ID {
+		t.Errorf("Searches are not in the expected order: %d first (expected %d)",
+			searches[0].ID,
+			anon.ID)
+	} else if searches[1].Title != named.Title || searches[1].Description != named.Description {
+		t.Errorf("Unexpected Title/Description: %q / %q",
+			searches[1].Title,
+			searches[1].Description)
+	} else if searches[1].Count != 3 {
+		t.Errorf("Unexpected result count: %d (expected 3)", searches[1].Count)
+	}
+
+	if cnt, err = s.db.SearchExpire(stamp.Add(time.Second)); err != nil {
+		t.Fatalf("Cannot expire Searches: %s", err.Error())
+	} else if cnt != 2 {
+		t.Errorf("Unexpected number of expired Searches: %d (expected 2)", cnt)
+	} else if search, err = s.db.SearchGetByID(anon.ID); err != nil {
+		t.Errorf("Cannot look up expired Search #%d: %s", anon.ID, err.Error())
+	} else if search != nil {
+		t.Errorf("Anonymous Search #%d still exists after it expired", anon.ID)
+	} else if search, err = s.db.SearchGetByID(named.ID); err != nil {
+		t.Fatalf("Cannot look up expired Search #%d: %s", named.ID, err.Error())
+	} else if search == nil {
+		t.Fatalf("Named Search #%d was deleted when it expired", named.ID)
+	} else if !search.Expired || search.Count != 0 || len(search.Results) != 0 {
+		t.Errorf("Results of Search #%d were not dropped: %#v", named.ID, search)
+	} else if search.Query.Query != named.Query.Query {
+		t.Errorf("Query of expired Search was not kept: %q (expected %q)",
+			search.Query.Query,
+			named.Query.Query)
+	}
+
+	// Running the Search again brings it back to life.
+	named.Timestamp = time.Now()
+	named.Results = []int64{6, 7}
+
+	if err = s.db.SearchUpdate(named); err != nil {
+		t.Fatalf("Cannot update Search #%d: %s", named.ID, err.Error())
+	} else if search, err = s.db.SearchGetByID(named.ID); err != nil {
+		t.Fatalf("Cannot get Search #%d: %s", named.ID, err.Error())
+	} else if search.Expired || search.Count != 2 {
+		t.Errorf("Search #%d was not updated: %#v", named.ID, search)
+	} else if cnt, err = s.db.SearchExpire(stamp.Add(time.Second)); err != nil {
+		t.Errorf("Cannot expire Searches: %s", err.Error())
+	} else if cnt != 0 {
+		t.Errorf("Searches expired twice: %d", cnt)
+	} else if err = s.db.SearchDelete(named.ID); err != nil {
+		t.Errorf("Cannot delete Search #%d: %s", named.ID, err.Error())
+	}
+
+	named.ID = 4711
+	if err = s.db.SearchUpdate(named); err == nil {
+		t.Errorf("Updating a nonexistent Search did not fail")
+	}
+} // func (s *suite) testSearchSaved(t *testing.T)
+
+func (s *suite) testAlert(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		r      *model.AlertRule
+		rules  []model.AlertRule
+		alerts []model.Alert
+		now    = time.Now().Truncate(time.Second)
+		rule   = &model.AlertRule{
+			Name:        fmt.Sprintf("Too many errors %d", now.UnixNano()),
+			Description: "Test rule",
+			Query:       model.SearchQuery{Query: `message ~ "error"`},
+			Threshold:   5,
+			Window:      time.Minute * 10,
+			PerHost:     true,
+			Active:      true,
+		}
+	)
+
+	if err = s.db.AlertRuleAdd(&model.AlertRule{Name: "Invalid", Window: 0}); err == nil {
+		t.Error("Adding an alert rule without a Window did not fail")
+	}
+
+	if err = s.db.AlertRuleAdd(rule); err != nil {
+		t.Fatalf("Cannot add alert rule: %s", err.Error())
+	} else if rule.ID == 0 {
+		t.Fatal("Alert rule was added, but has no ID")
+	} else if r, err = s.db.AlertRuleGetByID(rule.ID); err != nil {
+		t.Fatalf("Cannot look up alert rule %d: %s", rule.ID, err.Error())
+	} else if r == nil {
+		t.Fatalf("Alert rule %d was not found", rule.ID)
+	} else if r.Name != rule.Name || r.Query.Query != rule.Query.Query ||
+		r.Threshold != rule.Threshold || r.Window != rule.Window ||
+		r.PerHost != rule.PerHost || !r.Active {
+		t.Errorf("Alert rule differs from the one we added: %#v", r)
+	}
+
+	rule.Threshold = 10
+	rule.Active = false
+
+	if err = s.db.AlertRuleUpdate(rule); err != nil {
+		t.Fatalf("Cannot update alert rule: %s", err.Error())
+	} else if err = s.db.AlertRuleSilence(rule.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Cannot silence alert rule: %s", err.Error())
+	} else if rules, err = s.db.AlertRuleGetAll(); err != nil {
+		t.Fatalf("Cannot get all alert rules: %s", err.Error())
+	}
+
+	r = nil
+	for i := range rules {
+		if rules[i].ID == rule.ID {
+			r = &rules[i]
+		}
+	}
+
+	if !slices.ContainsFunc(rules, func(r model.AlertRule) bool { return r.Kind == model.RuleSilence }) {
+		t.Error("The default rule that watches for silent Hosts is missing")
+	}
+
+	if r == nil {
+		t.Fatalf("Alert rule %d is missing from the list of all rules", rule.ID)
+	} else if r.Threshold != 10 || r.Active {
+		t.Errorf("Alert rule was not updated: %#v", r)
+	} else if !r.Silenced(now) || r.Silenced(now.Add(time.Hour*2)) {
+		t.Errorf("Alert rule should be silenced until %s, but is until %s",
+			now.Add(time.Hour),
+			r.SilencedUntil)
+	}
+
+	var alert = &model.Alert{
+		RuleID:   rule.ID,
+		HostID:   s.hosts[0].ID,
+		Fired:    now,
+		LastSeen: now,
+		Count:    6,
+	}
+
+	if err = s.db.AlertAdd(alert); err != nil {
+		t.Fatalf("Cannot add Alert: %s", err.Error())
+	} else if alert.ID == 0 {
+		t.Fatal("Alert was added, but has no ID")
+	} else if err = s.db.AlertAdd(&model.Alert{RuleID: rule.ID, HostID: s.hosts[0].ID, Fired: now, LastSeen: now}); err == nil {
+		t.Error("Adding a second open Alert for the same rule and Host did not fail")
+	}
+
+	alert.Count = 8
+	alert.LastSeen = now.Add(time.Minute)
+
+	if err = s.db.AlertUpdate(alert); err != nil {
+		t.Fatalf("Cannot update Alert: %s", err.Error())
+	} else if alerts, err = s.db.AlertGetOpen(); err != nil {
+		t.Fatalf("Cannot get open Alerts: %s", err.Error())
+	} else if !slices.ContainsFunc(alerts, func(a model.Alert) bool {
+		return a.ID == alert.ID && a.Count == 8 && a.LastSeen.Equal(alert.LastSeen) && a.State() == model.AlertFiring
+	}) {
+		t.Errorf("Open Alert %d is missing or was not updated: %v", alert.ID, alerts)
+	} else if err = s.db.AlertResolve(alert, now.Add(time.Minute*2)); err != nil {
+		t.Fatalf("Cannot resolve Alert: %s", err.Error())
+	} else if alerts, err = s.db.AlertGetOpen(); err != nil {
+		t.Fatalf("Cannot get open Alerts: %s", err.Error())
+	} else if slices.ContainsFunc(alerts, func(a model.Alert) bool { return a.ID == alert.ID }) {
+		t.Errorf("Alert %d is still open after it was resolved", alert.ID)
+	} else if alerts, err = s.db.AlertGetHistory(10); err != nil {
+		t.Fatalf("Cannot get Alert history: %s", err.Error())
+	} else if !slices.ContainsFunc(alerts, func(a model.Alert) bool {
+		return a.ID == alert.ID && a.State() == model.AlertResolved
+	}) {
+		t.Errorf("Resolved Alert %d is missing from the history", alert.ID)
+	}
+
+	// Once the Alert is resolved, the rule may fire again.
+	if err = s.db.AlertAdd(&model.Alert{RuleID: rule.ID, HostID: s.hosts[0].ID, Fired: now, LastSeen: now}); err != nil {
+		t.Errorf("Cannot add Alert after the previous one was resolved: %s", err.Error())
+	}
+
+	if err = s.db.AlertRuleDelete(rule.ID); err != nil {
+		t.Fatalf("Cannot delete alert rule: %s", err.Error())
+	} else if r, err = s.db.AlertRuleGetByID(rule.ID); err != nil {
+		t.Fatalf("Cannot look up deleted alert rule: %s", err.Error())
+	} else if r != nil {
+		t.Error("Alert rule still exists after it was deleted")
+	} else if alerts, err = s.db.AlertGetHistory(-1); err != nil {
+		t.Fatalf("Cannot get Alert history: %s", err.Error())
+	} else if slices.ContainsFunc(alerts, func(a model.Alert) bool { return a.RuleID == rule.ID }) {
+		t.Errorf("Alerts of rule %d were not deleted along with it", rule.ID)
+	}
+} // func (s *suite) testAlert(t *testing.T)
+
+func (s *suite) testNotifier(t *testing.T) {
+	var (
+		err        error
+		n          *model.Notifier
+		notes      []model.Notifier
+		deliveries []model.Delivery
+		now        = time.Now().Truncate(time.Second)
+		rule       = &model.AlertRule{
+			Name:   fmt.Sprintf("Notifier test %d", now.UnixNano()),
+			Query:  model.SearchQuery{Query: `"notifier test"`},
+			Window: time.Minute,
+			Active: true,
+		}
+		alert    = &model.Alert{Fired: now, LastSeen: now, Count: 1}
+		notifier = &model.Notifier{
+			Name:    fmt.Sprintf("Ops %d", now.UnixNano()),
+			Kind:    model.NotifyMail,
+			Target:  "localhost:25",
+			From:    "scrollmaster@example.com",
+			To:      []string{"ops@example.com", "oncall@example.com"},
+			Subject: "{{ .Rule.Name }}",
+			Active:  true,
+		}
+	)
+
+	if err = s.db.NotifierAdd(&model.Notifier{Name: "Invalid", Kind: model.NotifyMail, Target: "localhost:25"}); err == nil {
+		t.Error("Adding a mail Notifier without recipients did not fail")
+	}
+
+	if err = s.db.NotifierAdd(notifier); err != nil {
+		t.Fatalf("Cannot add Notifier: %s", err.Error())
+	} else if notifier.ID == 0 {
+		t.Fatal("Notifier was added, but has no ID")
+	} else if n, err = s.db.NotifierGetByID(notifier.ID); err != nil {
+		t.Fatalf("Cannot look up Notifier %d: %s", notifier.ID, err.Error())
+	} else if n == nil {
+		t.Fatalf("Notifier %d was not found", notifier.ID)
+	} else if n.Name != notifier.Name || n.Kind != notifier.Kind ||
+		n.Target != notifier.Target || n.From != notifier.From ||
+		!slices.Equal(n.To, notifier.To) || n.Subject != notifier.Subject ||
+		!n.Active {
+		t.Errorf("Notifier differs from the one we added: %#v", n)
+	}
+
+	notifier.Kind = model.NotifyCommand
+	notifier.Target = "/usr/bin/logger"
+	notifier.Args = []string{"-t", "scrollmaster"}
+	notifier.Active = false
+
+	if err = s.db.NotifierUpdate(notifier); err != nil {
+		t.Fatalf("Cannot update Notifier: %s", err.Error())
+	} else if notes, err = s.db.NotifierGetAll(); err != nil {
+		t.Fatalf("Cannot get all Notifiers: %s", err.Error())
+	}
+
+	n = nil
+	for i := range notes {
+		if notes[i].ID == notifier.ID {
+			n = &notes[i]
+		}
+	}
+
+	if n == nil {
+		t.Fatalf("Notifier %d is missing from the list of all Notifiers", notifier.ID)
+	} else if n.Kind != model.NotifyCommand || !slices.Equal(n.Args, notifier.Args) || n.Active {
+		t.Errorf("Notifier was not updated: %#v", n)
+	}
+
+	if err = s.db.AlertRuleAdd(rule); err != nil {
+		t.Fatalf("Cannot add alert rule: %s", err.Error())
+	}
+
+	defer s.db.AlertRuleDelete(rule.ID) // nolint: errcheck
+
+	alert.RuleID = rule.ID
+	if err = s.db.AlertAdd(alert); err != nil {
+		t.Fatalf("Cannot add Alert: %s", err.Error())
+	}
+
+	var (
+		failed = &model.Delivery{
+			NotifierID: notifier.ID,
+			AlertID:    alert.ID,
+			State:      model.AlertFiring,
+			Stamp:      now,
+			Attempt:    1,
+			Error:      "Connection refused",
+		}
+		test = &model.Delivery{
+			NotifierID: notifier.ID,
+			Stamp:      now.Add(time.Second),
+			Attempt:    1,
+		}
+	)
+
+	if err = s.db.DeliveryAdd(failed); err != nil {
+		t.Fatalf("Cannot log failed Delivery: %s", err.Error())
+	} else if err = s.db.DeliveryAdd(test); err != nil {
+		t.Fatalf("Cannot log Delivery of test message: %s", err.Error())
+	} else if deliveries, err = s.db.DeliveryGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get delivery log: %s", err.Error())
+	} else if !slices.ContainsFunc(deliveries, func(d model.Delivery) bool {
+		return d.ID == failed.ID && d.AlertID == alert.ID && !d.OK() &&
+			d.Error == failed.Error && d.Stamp.Equal(now)
+	}) {
+		t.Errorf("Failed Delivery %d is missing from the log: %v", failed.ID, deliveries)
+	} else if !slices.ContainsFunc(deliveries, func(d model.Delivery) bool {
+		return d.ID == test.ID && d.AlertID == 0 && d.OK()
+	}) {
+		t.Errorf("Delivery %d of test message is missing from the log: %v", test.ID, deliveries)
+	}
+
+	if err = s.db.NotifierDelete(notifier.ID); err != nil {
+		t.Fatalf("Cannot delete Notifier: %s", err.Error())
+	} else if n, err = s.db.NotifierGetByID(notifier.ID); err != nil {
+		t.Fatalf("Cannot look up deleted Notifier: %s", err.Error())
+	} else if n != nil {
+		t.Error("Notifier still exists after it was deleted")
+	} else if deliveries, err = s.db.DeliveryGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get delivery log: %s", err.Error())
+	} else if slices.ContainsFunc(deliveries, func(d model.Delivery) bool { return d.NotifierID == notifier.ID }) {
+		t.Errorf("Deliveries of Notifier %d were not deleted along with it", notifier.ID)
+	}
+} // func (s *suite) testNotifier(t *testing.T)
+
+func (s *suite) testPattern(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err      error
+		records  []model.Record
+		patterns []model.Pattern
+		buckets  []model.Bucket
+		ids      []int64
+		p        *model.Pattern
+		total    int64
+		h        = s.hosts[0]
+		pat      = &model.Pattern{
+			Template:  fmt.Sprintf("Test message <*> from %s", h.Name),
+			FirstSeen: time.Now().Truncate(time.Second),
+		}
+	)
+
+	pat.LastSeen = pat.FirstSeen
+
+	if records, err = s.db.RecordGetByHost(h, 10); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 10 {
+		t.Fatalf("Unexpected number of Records for Host %s: %d (expected 10)",
+			h.Name,
+			len(records))
+	} else if err = s.db.PatternAdd(pat); err != nil {
+		t.Fatalf("Cannot add Pattern: %s", err.Error())
+	} else if pat.ID == 0 {
+		t.Fatal("Pattern was added, but has no ID")
+	} else if err = s.db.PatternAddRecords(pat, records); err != nil {
+		t.Fatalf("Cannot add Records to Pattern: %s", err.Error())
+	} else if err = s.db.PatternAddRecords(pat, records[:5]); err != nil {
+		t.Fatalf("Cannot add Records to Pattern again: %s", err.Error())
+	} else if pat.Count != 10 {
+		t.Errorf("Pattern matches %d Records, expected 10", pat.Count)
+	} else if !pat.FirstSeen.Equal(records[9].Time) {
+		t.Errorf("Pattern was first seen at %s, expected %s",
+			pat.FirstSeen,
+			records[9].Time)
+	}
+
+	pat.Template = fmt.Sprintf("Test message <*> from <*> %d", pat.ID)
+
+	if err = s.db.PatternUpdate(pat); err != nil {
+		t.Fatalf("Cannot update Pattern: %s", err.Error())
+	} else if p, err = s.db.PatternGetByID(pat.ID); err != nil {
+		t.Fatalf("Cannot look up Pattern %d: %s", pat.ID, err.Error())
+	} else if p == nil {
+		t.Fatalf("Pattern %d was not found", pat.ID)
+	} else if p.Template != pat.Template || p.Count != 10 ||
+		!p.FirstSeen.Equal(records[9].Time) || !p.LastSeen.Equal(pat.LastSeen) {
+		t.Errorf("Pattern differs from the one we added: %#v", p)
+	}
+
+	if patterns, err = s.db.PatternGetAll(s.begin); err != nil {
+		t.Fatalf("Cannot get all Patterns: %s", err.Error())
+	} else if !slices.ContainsFunc(patterns, func(p model.Pattern) bool {
+		return p.ID == pat.ID && p.Recent == 10
+	}) {
+		t.Errorf("Pattern %d is missing from the list of all Patterns: %v", pat.ID, patterns)
+	}
+
+	if buckets, err = s.db.PatternGetCounts(pat.ID, s.begin); err != nil {
+		t.Fatalf("Cannot get counts of Pattern: %s", err.Error())
+	}
+
+	for _, b := range buckets {
+		total += b.Count
+	}
+
+	if total != 10 {
+		t.Errorf("Counts of Pattern add up to %d, expected 10", total)
+	}
+
+	if ids, err = s.db.PatternGetRecordIDs(pat.ID, 5); err != nil {
+		t.Fatalf("Cannot get Records of Pattern: %s", err.Error())
+	} else if len(ids) != 5 {
+		t.Errorf("Unexpected number of Records for Pattern: %d (expected 5)", len(ids))
+	} else if !slices.IsSortedFunc(ids, func(a, b int64) int { return int(b - a) }) {
+		t.Errorf("Records of Pattern are not sorted, most recent first: %v", ids)
+	}
+} // func (s *suite) testPattern(t *testing.T)
+
+func (s *suite) testNovelty(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		feed    []model.Novelty
+		mine    []model.Novelty
+		h       = s.hosts[1]
+		pat     = &model.Pattern{
+			Template:  fmt.Sprintf("Novel message <*> from %s", h.Name),
+			FirstSeen: time.Now().Truncate(time.Second),
+		}
+	)
+
+	pat.LastSeen = pat.FirstSeen
+
+	if records, err = s.db.RecordGetByHost(h, 10); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 10 {
+		t.Fatalf("Unexpected number of Records for Host %s: %d (expected 10)",
+			h.Name,
+			len(records))
+	} else if err = s.db.PatternAdd(pat); err != nil {
+		t.Fatalf("Cannot add Pattern: %s", err.Error())
+	} else if err = s.db.PatternAddRecords(pat, records[:4]); err != nil {
+		t.Fatalf("Cannot add Records to Pattern: %s", err.Error())
+	} else if err = s.db.PatternAddRecords(pat, records[4:]); err != nil {
+		t.Fatalf("Cannot add older Records to Pattern: %s", err.Error())
+	} else if feed, err = s.db.NoveltyGetRecent(s.begin); err != nil {
+		t.Fatalf("Cannot get recent Novelties: %s", err.Error())
+	}
+
+	for _, n := range feed {
+		if n.PatternID == pat.ID {
+			mine = append(mine, n)
+		}
+	}
+
+	// The Records alternate between two sources, RecordGetByHost returns
+	// them most recent first.
+	if len(mine) != 2 {
+		t.Fatalf("Unexpected number of Novelties for Pattern %d: %d (expected 2)",
+			pat.ID,
+			len(mine))
+	}
+
+	for _, n := range mine {
+		var first = records[8]
+
+		if records[9].Source == n.Source {
+			first = records[9]
+		}
+
+		if n.HostID != h.ID || n.Template != pat.Template || n.Acknowledged {
+			t.Errorf("Novelty differs from what we expected: %#v", n)
+		} else if !n.FirstSeen.Equal(first.Time) || n.RecordID != first.ID {
+			t.Errorf("Novelty for source %s was first seen at %s in Record %d, expected %s in Record %d",
+				n.Source,
+				n.FirstSeen,
+				n.RecordID,
+				first.Time,
+				first.ID)
+		}
+	}
+
+	if err = s.db.NoveltyAcknowledge(mine[0].ID); err != nil {
+		t.Fatalf("Cannot acknowledge Novelty %d: %s", mine[0].ID, err.Error())
+	} else if feed, err = s.db.NoveltyGetRecent(s.begin); err != nil {
+		t.Fatalf("Cannot get recent Novelties: %s", err.Error())
+	} else if slices.ContainsFunc(feed, func(n model.Novelty) bool { return n.ID == mine[0].ID }) {
+		t.Errorf("Acknowledged Novelty %d is still in the feed", mine[0].ID)
+	} else if !slices.ContainsFunc(feed, func(n model.Novelty) bool { return n.ID == mine[1].ID }) {
+		t.Errorf("Novelty %d is missing from the feed", mine[1].ID)
+	}
+} // func (s *suite) testNovelty(t *testing.T)
+
+func (s *suite) testSignature(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		sigs    []model.Signature
+		found   []model.Detection
+		h       = s.hosts[2]
+		sig     = &model.Signature{
+			Name:      "Test signature",
+			Category:  "test",
+			Severity:  model.SevWarning,
+			Query:     model.SearchQuery{Query: `"Test message"`},
+			Threshold: 2,
+			Window:    time.Minute,
+			Active:    true,
+		}
+	)
+
+	if err = s.db.SignatureAdd(&model.Signature{Name: "Broken"}); err == nil {
+		t.Error("Adding an invalid Signature did not fail")
+	} else if err = s.db.SignatureAdd(sig); err != nil {
+		t.Fatalf("Cannot add Signature: %s", err.Error())
+	} else if sig.ID == 0 {
+		t.Fatal("Signature was added, but has no ID")
+	}
+
+	sig.Severity = model.SevError
+	sig.Active = false
+
+	if err = s.db.SignatureUpdate(sig); err != nil {
+		t.Fatalf("Cannot update Signature: %s", err.Error())
+	} else if sigs, err = s.db.SignatureGetAll(); err != nil {
+		t.Fatalf("Cannot get all Signatures: %s", err.Error())
+	} else if !slices.ContainsFunc(sigs, func(x model.Signature) bool {
+		return x.ID == sig.ID &&
+			x.Name == sig.Name &&
+			x.Severity == model.SevError &&
+			x.Query.Query == sig.Query.Query &&
+			x.Window == sig.Window &&
+			!x.Active
+	}) {
+		t.Errorf("Signature %d is missing or differs from the one we saved: %v", sig.ID, sigs)
+	}
+
+	if records, err = s.db.RecordGetByHost(h, 3); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	}
+
+	var list = make([]model.Detection, len(records))
+	for i, r := range records {
+		list[i] = model.Detection{
+			RecordID:    r.ID,
+			SignatureID: sig.ID,
+			HostID:      r.HostID,
+			Time:        r.Time,
+		}
+	}
+
+	if err = s.db.DetectionAdd(list); err != nil {
+		t.Fatalf("Cannot add Detections: %s", err.Error())
+	} else if err = s.db.DetectionAdd(list[:1]); err != nil {
+		t.Fatalf("Cannot add Detection again: %s", err.Error())
+	} else if found, err = s.db.DetectionGetByRecord(records[0].ID); err != nil {
+		t.Fatalf("Cannot get Detections of Record %d: %s", records[0].ID, err.Error())
+	} else if len(found) != 1 || found[0].SignatureID != sig.ID || !found[0].Time.Equal(records[0].Time) {
+		t.Errorf("Unexpected Detections for Record %d: %v", records[0].ID, found)
+	} else if found, err = s.db.DetectionGetRecent(s.begin, 2); err != nil {
+		t.Fatalf("Cannot get recent Detections: %s", err.Error())
+	} else if len(found) != 2 || found[0].RecordID != records[0].ID {
+		t.Errorf("Unexpected recent Detections: %v", found)
+	}
+
+	if err = s.db.SignatureDelete(sig.ID); err != nil {
+		t.Fatalf("Cannot delete Signature: %s", err.Error())
+	} else if found, err = s.db.DetectionGetByRecord(records[0].ID); err != nil {
+		t.Fatalf("Cannot get Detections of Record %d: %s", records[0].ID, err.Error())
+	} else if len(found) != 0 {
+		t.Errorf("Detections of deleted Signature are still there: %v", found)
+	}
+} // func (s *suite) testSignature(t *testing.T)
+
+func (s *suite) testLabel(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		labels  []model.Label
+		label   *model.Label
+		scores  []model.Score
+		h       = s.hosts[1]
+	)
+
+	if records, err = s.db.RecordGetByHost(h, 3); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 3 {
+		t.Fatalf("Expected 3 Records, got %d", len(records))
+	}
+
+	for i, r := range records {
+		var l = model.Label{
+			RecordID:    r.ID,
+			HostID:      r.HostID,
+			Source:      r.Source,
+			Message:     r.Message,
+			Interesting: i == 0,
+			Time:        s.begin,
+		}
+
+		if err = s.db.LabelSet(&l); err != nil {
+			t.Fatalf("Cannot label Record %d: %s", r.ID, err.Error())
+		}
+	}
+
+	// Changing one's mind replaces the Label.
+	if err = s.db.LabelSet(&model.Label{
+		RecordID:    records[1].ID,
+		HostID:      records[1].HostID,
+		Source:      records[1].Source,
+		Message:     records[1].Message,
+		Interesting: true,
+		Time:        s.begin.Add(time.Second),
+	}); err != nil {
+		t.Fatalf("Cannot relabel Record %d: %s", records[1].ID, err.Error())
+	} else if label, err = s.db.LabelGetByRecord(records[1].ID); err != nil {
+		t.Fatalf("Cannot get Label of Record %d: %s", records[1].ID, err.Error())
+	} else if label == nil || !label.Interesting || label.Message != records[1].Message {
+		t.Errorf("Unexpected Label of Record %d: %v", records[1].ID, label)
+	} else if err = s.db.LabelDelete(records[2].ID); err != nil {
+		t.Fatalf("Cannot remove Label of Record %d: %s", records[2].ID, err.Error())
+	} else if label, err = s.db.LabelGetByRecord(records[2].ID); err != nil {
+		t.Fatalf("Cannot get Label of Record %d: %s", records[2].ID, err.Error())
+	} else if label != nil {
+		t.Errorf("Label of Record %d was not removed: %v", records[2].ID, label)
+	} else if labels, err = s.db.LabelGetAll(); err != nil {
+		t.Fatalf("Cannot get all Labels: %s", err.Error())
+	} else if len(labels) != 2 || labels[0].RecordID != records[0].ID {
+		t.Errorf("Unexpected Labels: %v", labels)
+	}
+
+	var list = make([]model.Score, len(records))
+	for i, r := range records {
+		list[i] = model.Score{
+			RecordID: r.ID,
+			HostID:   r.HostID,
+			Time:     r.Time,
+			Value:    0.1 * float64(i+1),
+		}
+	}
+
+	if err = s.db.ScoreAdd(list); err != nil {
+		t.Fatalf("Cannot add Scores: %s", err.Error())
+	}
+
+	// The classifier changed its mind about the first Record.
+	list[0].Value = 0.9
+
+	if err = s.db.ScoreAdd(list[:1]); err != nil {
+		t.Fatalf("Cannot update Score: %s", err.Error())
+	} else if scores, err = s.db.ScoreGetTop(s.begin, 2); err != nil {
+		t.Fatalf("Cannot get Scores: %s", err.Error())
+	} else if len(scores) != 2 ||
+		scores[0].RecordID != records[0].ID ||
+		scores[1].RecordID != records[2].ID ||
+		!scores[0].Time.Equal(records[0].Time) {
+		t.Errorf("Unexpected Scores: %v", scores)
+	}
+} // func (s *suite) testLabel(t *testing.T)
+
+func (s *suite) testAnnotation(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		records []model.Record
+		notes   map[int64][]model.Annotation
+		tags    map[int64][]model.Tag
+		tagged  map[string][]int64
+		found   []int64
+		h       = s.hosts[0]
+		q       = make(chan model.Record)
+		query   = &model.SearchQuery{Query: "tag:disk*"}
+	)
+
+	if records, err = s.db.RecordGetByHost(h, 2); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 2 {
+		t.Fatalf("Expected 2 Records, got %d", len(records))
+	}
+
+	var (
+		first = &model.Annotation{
+			RecordID: records[0].ID,
+			HostID:   records[0].HostID,
+			Time:     s.begin,
+			Text:     "The disk failed here",
+		}
+		second = &model.Annotation{
+			RecordID: records[0].ID,
+			HostID:   records[0].HostID,
+			Time:     s.begin.Add(time.Second),
+			Text:     "Replaced it",
+		}
+	)
+
+	if err = s.db.AnnotationAdd(first); err != nil {
+		t.Fatalf("Cannot add Annotation: %s", err.Error())
+	} else if err = s.db.AnnotationAdd(second); err != nil {
+		t.Fatalf("Cannot add Annotation: %s", err.Error())
+	} else if first.ID == 0 || first.ID == second.ID {
+		t.Errorf("Unexpected IDs of Annotations: %d, %d", first.ID, second.ID)
+	} else if err = s.db.AnnotationDelete(second.ID); err != nil {
+		t.Fatalf("Cannot delete Annotation %d: %s", second.ID, err.Error())
+	} else if notes, err = s.db.AnnotationGetByRecords([]int64{records[0].ID, records[1].ID}); err != nil {
+		t.Fatalf("Cannot get Annotations: %s", err.Error())
+	} else if len(notes) != 1 ||
+		len(notes[records[0].ID]) != 1 ||
+		notes[records[0].ID][0].Text != first.Text {
+		t.Errorf("Unexpected Annotations: %v", notes)
+	}
+
+	for _, tag := range []model.Tag{
+		{RecordID: records[0].ID, HostID: h.ID, Name: "disk-failure", Time: s.begin},
+		{RecordID: records[0].ID, HostID: h.ID, Name: "hardware", Time: s.begin},
+		{RecordID: records[1].ID, HostID: h.ID, Name: "hardware", Time: s.begin},
+		// Adding a Tag twice is not an error.
+		{RecordID: records[1].ID, HostID: h.ID, Name: "hardware", Time: s.begin},
+		{RecordID: records[1].ID, HostID: h.ID, Name: "diskless", Time: s.begin},
+	} {
+		if err = s.db.TagAdd(&tag); err != nil {
+			t.Fatalf("Cannot add Tag %q: %s", tag.Name, err.Error())
+		}
+	}
+
+	if err = s.db.TagDelete(records[1].ID, "diskless"); err != nil {
+		t.Fatalf("Cannot remove Tag: %s", err.Error())
+	} else if tags, err = s.db.TagGetByRecords([]int64{records[0].ID, records[1].ID}); err != nil {
+		t.Fatalf("Cannot get Tags: %s", err.Error())
+	} else if len(tags[records[0].ID]) != 2 || len(tags[records[1].ID]) != 1 {
+		t.Errorf("Unexpected Tags: %v", tags)
+	} else if tagged, err = s.db.TagGetAll(); err != nil {
+		t.Fatalf("Cannot get all Tags: %s", err.Error())
+	} else if len(tagged["hardware"]) != 2 || len(tagged["diskless"]) != 0 {
+		t.Errorf("Unexpected tagged Records: %v", tagged)
+	}
+
+	go s.db.RecordSearch(context.Background(), query, q, nil)
+
+	for r := range q {
+		found = append(found, r.ID)
+	}
+
+	if !slices.Equal(found, []int64{records[0].ID}) {
+		t.Errorf("Unexpected result of searching for %q: %v (expected %d)",
+			query.Query,
+			found,
+			records[0].ID)
+	}
+} // func (s *suite) testAnnotation(t *testing.T)
+
+func (s *suite) testIncident(t *testing.T) {
+	if len(s.hosts) != hostCnt {
+		t.SkipNow()
+	}
+
+	var (
+		err       error
+		records   []model.Record
+		incidents []model.Incident
+		inc       *model.Incident
+		pins      []model.Pin
+		sids      []int64
+		h         = s.hosts[2]
+		search    = &model.Search{
+			Timestamp: time.Now(),
+			Title:     "Incident test",
+			Query:     model.SearchQuery{Hosts: []int64{h.ID}},
+		}
+		outage = &model.Incident{
+			Title:  "Outage",
+			Begin:  s.begin,
+			Status: model.IncidentOpen,
+		}
+	)
+
+	if records, err = s.db.RecordGetByHost(h, 2); err != nil {
+		t.Fatalf("Cannot get Records for Host %s: %s", h.Name, err.Error())
+	} else if len(records) != 2 {
+		t.Fatalf("Expected 2 Records, got %d", len(records))
+	}
+
+	search.Results = []int64{records[0].ID, records[1].ID}
+
+	if err = s.db.IncidentAdd(&model.Incident{Begin: s.begin}); err == nil {
+		t.Errorf("Adding an Incident without a title should fail")
+	} else if err = s.db.IncidentAdd(outage); err != nil {
+		t.Fatalf("Cannot add Incident: %s", err.Error())
+	} else if outage.ID == 0 {
+		t.Fatalf("Incident did not get an ID")
+	} else if err = s.db.SearchAdd(search); err != nil {
+		t.Fatalf("Cannot add Search: %s", err.Error())
+	}
+
+	outage.End = s.begin.Add(time.Hour)
+	outage.Status = model.IncidentResolved
+	outage.Summary = "It was DNS"
+
+	if err = s.db.IncidentUpdate(outage); err != nil {
+		t.Fatalf("Cannot update Incident: %s", err.Error())
+	} else if inc, err = s.db.IncidentGetByID(outage.ID); err != nil {
+		t.Fatalf("Cannot get Incident %d: %s", outage.ID, err.Error())
+	} else if inc == nil {
+		t.Fatalf("Incident %d was not found", outage.ID)
+	} else if inc.Status != model.IncidentResolved ||
+		inc.Summary != outage.Summary ||
+		!inc.End.Equal(outage.End) {
+		t.Errorf("Unexpected Incident: %#v", inc)
+	} else if incidents, err = s.db.IncidentGetAll(); err != nil {
+		t.Fatalf("Cannot get all Incidents: %s", err.Error())
+	} else if !slices.ContainsFunc(incidents, func(i model.Incident) bool { return i.ID == outage.ID }) {
+		t.Errorf("Incident %d is missing from the list", outage.ID)
+	}
+
+	for _, r := range records {
+		var p = model.Pin{
+			IncidentID: outage.ID,
+			RecordID:   r.ID,
+			HostID:     r.HostID,
+			Time:       r.Time,
+			Source:     r.Source,
+			Message:    r.Message,
+		}
+
+		if err = s.db.IncidentPinRecord(&p); err != nil {
+			t.Fatalf("Cannot pin Record %d: %s", r.ID, err.Error())
+		}
+	}
+
+	// Pinning a Record again updates its Note.
+	if err = s.db.IncidentPinRecord(&model.Pin{
+		IncidentID: outage.ID,
+		RecordID:   records[0].ID,
+		HostID:     records[0].HostID,
+		Time:       records[0].Time,
+		Source:     records[0].Source,
+		Message:    records[0].Message,
+		Note:       "First sign of trouble",
+	}); err != nil {
+		t.Fatalf("Cannot pin Record %d again: %s", records[0].ID, err.Error())
+	} else if err = s.db.IncidentUnpinRecord(outage.ID, records[1].ID); err != nil {
+		t.Fatalf("Cannot unpin Record %d: %s", records[1].ID, err.Error())
+	} else if pins, err = s.db.IncidentGetPins(outage.ID); err != nil {
+		t.Fatalf("Cannot get pinned Records: %s", err.Error())
+	} else if len(pins) != 1 ||
+		pins[0].RecordID != records[0].ID ||
+		pins[0].Note != "First sign of trouble" ||
+		pins[0].Message != records[0].Message {
+		t.Errorf("Unexpected pinned Records: %v", pins)
+	}
+
+	if err = s.db.IncidentPinSearch(outage.ID, search.ID); err != nil {
+		t.Fatalf("Cannot pin Search: %s", err.Error())
+	} else if err = s.db.IncidentPinSearch(outage.ID, search.ID); err != nil {
+		t.Fatalf("Cannot pin Search again: %s", err.Error())
+	} else if sids, err = s.db.IncidentGetSearches(outage.ID); err != nil {
+		t.Fatalf("Cannot get pinned Searches: %s", err.Error())
+	} else if !slices.Equal(sids, []int64{search.ID}) {
+		t.Errorf("Unexpected pinned Searches: %v", sids)
+	} else if err = s.db.IncidentUnpinSearch(outage.ID, search.ID); err != nil {
+		t.Fatalf("Cannot unpin Search: %s", err.Error())
+	} else if sids, err = s.db.IncidentGetSearches(outage.ID); err != nil {
+		t.Fatalf("Cannot get pinned Searches: %s", err.Error())
+	} else if len(sids) != 0 {
+		t.Errorf("Search is still pinned: %v", sids)
+	}
+
+	if err = s.db.IncidentPinSearch(outage.ID, search.ID); err != nil {
+		t.Fatalf("Cannot pin Search: %s", err.Error())
+	} else if err = s.db.IncidentDelete(outage.ID); err != nil {
+		t.Fatalf("Cannot delete Incident: %s", err.Error())
+	} else if inc, err = s.db.IncidentGetByID(outage.ID); err != nil {
+		t.Fatalf("Cannot look up deleted Incident: %s", err.Error())
+	} else if inc != nil {
+		t.Errorf("Incident %d still exists after it was deleted", outage.ID)
+	} else if pins, err = s.db.IncidentGetPins(outage.ID); err != nil {
+		t.Fatalf("Cannot get pinned Records: %s", err.Error())
+	} else if len(pins) != 0 {
+		t.Errorf("Records of deleted Incident are still pinned: %v", pins)
+	} else if err = s.db.SearchDelete(search.ID); err != nil {
+		t.Errorf("Cannot delete Search: %s", err.Error())
+	}
+} // func (s *suite) testIncident(t *testing.T)
@@ -0,0 +1,166 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/detect/01_detect_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:26:30 krylon>
+
+package detect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestLibrary(t *testing.T) {
+	type testCase struct {
+		source  string
+		message string
+		sig     string
+	}
+
+	var (
+		err   error
+		m     = NewMatcher()
+		sigs  = Library()
+		names = make(map[int64]string, len(sigs))
+		now   = time.Now()
+		cases = []testCase{
+			{"kernel", "Out of memory: Killed process 4711 (java) total-vm:8123456kB", "OOM kill"},
+			{"kernel", "postgres invoked oom-killer: gfp_mask=0x140cca(GFP_HIGHUSER_MOVABLE|__GFP_COMP)", "OOM kill"},
+			{"kernel", "firefox[2342]: segfault at 0 ip 00007f0d sp 00007ffc error 4 in libxul.so", "Segfault"},
+			{"kernel", "blk_update_request: I/O error, dev sda, sector 123456 op 0x0:(READ)", "Disk I/O error"},
+			{"kernel", "Buffer I/O error on dev sdb1, logical block 0, async page read", "Disk I/O error"},
+			{"kernel", "EXT4-fs (sda2): Remounting filesystem read-only", "Filesystem remounted read-only"},
+			{"kernel", "EXT4-fs error (device sda2): ext4_lookup:1855: inode #2: comm ls: deleted inode referenced", "Filesystem error"},
+			{"systemd", "Failed to start nginx.service - A high performance web server.", "Failed systemd unit"},
+			{"systemd", "backup.service: Failed with result 'exit-code'.", "Failed systemd unit"},
+			{"smartd", "Device: /dev/sda [SAT], 8 Currently unreadable (pending) sectors", "SMART warning"},
+			{"sshd", "Failed password for root from 203.0.113.7 port 52311 ssh2", ""},
+			{"kernel", "usb 1-1: new high-speed USB device number 2 using xhci_hcd", ""},
+			{"systemd", "Started nginx.service - A high performance web server.", ""},
+			{"cron", "Failed to start job, but it's not systemd", ""},
+		}
+	)
+
+	for i := range sigs {
+		sigs[i].ID = int64(i + 1)
+		names[sigs[i].ID] = sigs[i].Name
+
+		if err = sigs[i].Validate(); err != nil {
+			t.Errorf("Signature %q is invalid: %s", sigs[i].Name, err.Error())
+		}
+	}
+
+	if err = m.Load(sigs, nil); err != nil {
+		t.Fatalf("Cannot load library: %s", err.Error())
+	} else if m.Len() != len(sigs) {
+		t.Fatalf("Matcher has %d Signatures, expected %d", m.Len(), len(sigs))
+	}
+
+	for i, c := range cases {
+		var (
+			found []model.Detection
+			rec   = []model.Record{
+				{
+					ID:      int64(i + 1),
+					HostID:  int64(i + 1),
+					Time:    now,
+					Source:  c.source,
+					Message: c.message,
+				},
+			}
+		)
+
+		found = m.Match(rec)
+
+		if c.sig == "" && len(found) != 0 {
+			t.Errorf("Message %q should not match anything, but matched %q",
+				c.message,
+				names[found[0].SignatureID])
+		} else if c.sig != "" && len(found) != 1 {
+			t.Errorf("Message %q should match %q, but got %d Detections",
+				c.message,
+				c.sig,
+				len(found))
+		} else if c.sig != "" && names[found[0].SignatureID] != c.sig {
+			t.Errorf("Message %q should match %q, but matched %q",
+				c.message,
+				c.sig,
+				names[found[0].SignatureID])
+		}
+	}
+} // func TestLibrary(t *testing.T)
+
+func TestBurst(t *testing.T) {
+	var (
+		err   error
+		found []model.Detection
+		m     = NewMatcher()
+		begin = time.Date(2024, time.October, 9, 12, 0, 0, 0, time.UTC)
+		sig   = model.Signature{
+			ID:        1,
+			Name:      "Burst",
+			Category:  "test",
+			Severity:  model.SevWarning,
+			Query:     model.SearchQuery{Query: `"Failed password"`},
+			Threshold: 3,
+			Window:    time.Minute,
+			Active:    true,
+		}
+	)
+
+	var rec = func(id int64, host int64, offset time.Duration) model.Record {
+		return model.Record{
+			ID:      id,
+			HostID:  host,
+			Time:    begin.Add(offset),
+			Source:  "sshd",
+			Message: "Failed password for root from 203.0.113.7",
+		}
+	}
+
+	if err = m.Load([]model.Signature{sig}, nil); err != nil {
+		t.Fatalf("Cannot load Signature: %s", err.Error())
+	}
+
+	// Three failures are not a burst, and neither are four that are too
+	// far apart, or four on different Hosts.
+	if found = m.Match([]model.Record{
+		rec(1, 1, 0),
+		rec(2, 1, time.Second*10),
+		rec(3, 1, time.Second*20),
+		rec(4, 2, time.Second*30),
+	}); len(found) != 0 {
+		t.Errorf("Found %d Detections before the burst, expected none", len(found))
+	}
+
+	// The fourth one within a minute makes it a burst, and all four of
+	// them are tagged.
+	if found = m.Match([]model.Record{rec(5, 1, time.Second*30)}); len(found) != 4 {
+		t.Fatalf("Found %d Detections for the burst, expected 4", len(found))
+	}
+
+	// Reloading the Signatures does not forget about the burst, the next
+	// failure is tagged on its own.
+	if err = m.Load([]model.Signature{sig}, nil); err != nil {
+		t.Fatalf("Cannot reload Signature: %s", err.Error())
+	} else if found = m.Match([]model.Record{rec(6, 1, time.Second*40)}); len(found) != 1 || found[0].RecordID != 6 {
+		t.Errorf("Unexpected Detections during the burst: %v", found)
+	}
+
+	// Once things have calmed down, it takes another burst.
+	if found = m.Match([]model.Record{rec(7, 1, time.Minute*5)}); len(found) != 0 {
+		t.Errorf("Unexpected Detections after the burst: %v", found)
+	} else if len(m.sigs[0].recent) != 1 {
+		t.Errorf("Matcher still remembers %d Hosts, expected 1", len(m.sigs[0].recent))
+	}
+
+	sig.Active = false
+	if err = m.Load([]model.Signature{sig}, nil); err != nil {
+		t.Fatalf("Cannot reload Signature: %s", err.Error())
+	} else if m.Len() != 0 {
+		t.Errorf("Inactive Signature was loaded")
+	}
+} // func TestBurst(t *testing.T)
@@ -0,0 +1,285 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/detect/detect.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:25:48 krylon>
+
+// Package detect matches Records against Signatures of well-known events,
+// such as the kernel killing processes because it ran out of memory, or
+// disks failing. It comes with a library of Signatures for common
+// failures on Linux systems, users can add their own.
+//
+// Signatures are written in the query language of the search, so anything
+// that can be searched for can be detected.
+package detect
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Library returns the Signatures that come with the application.
+func Library() []model.Signature {
+	var sigs = []model.Signature{
+		{
+			Name:        "OOM kill",
+			Category:    "memory",
+			Severity:    model.SevCritical,
+			Description: "The kernel ran out of memory and killed a process.",
+			Query: model.SearchQuery{
+				Query: `/Out of memory: Kill|oom-kill:|invoked oom-killer/`,
+			},
+		},
+		{
+			Name:        "Segfault",
+			Category:    "crash",
+			Severity:    model.SevError,
+			Description: "A process crashed, e.g. because it accessed memory it must not touch.",
+			Query: model.SearchQuery{
+				Query: `/segfault at [0-9a-f]+|general protection fault|traps: .* trap |dumped core/`,
+			},
+		},
+		{
+			Name:        "Disk I/O error",
+			Category:    "disk",
+			Severity:    model.SevError,
+			Description: "Reading from or writing to a block device failed.",
+			Query: model.SearchQuery{
+				Query: `/I\/O error|blk_update_request: .*error|critical medium error|Unrecovered read error/`,
+			},
+		},
+		{
+			Name:        "Filesystem remounted read-only",
+			Category:    "filesystem",
+			Severity:    model.SevCritical,
+			Description: "The kernel remounted a filesystem read-only after it ran into errors.",
+			Query: model.SearchQuery{
+				Query: `/[Rr]emounting filesystem read-only|remounted read-only|forced to read-only|shutting down filesystem/`,
+			},
+		},
+		{
+			Name:        "Filesystem error",
+			Category:    "filesystem",
+			Severity:    model.SevError,
+			Description: "A filesystem reported corruption or an internal error.",
+			Query: model.SearchQuery{
+				Query: `/EXT[234]-fs error|XFS \(.*\): (?:Corruption|Metadata corruption)|BTRFS (?:error|critical)/`,
+			},
+		},
+		{
+			Name:        "Failed systemd unit",
+			Category:    "systemd",
+			Severity:    model.SevError,
+			Description: "A systemd unit failed to start or stopped with an error.",
+			Query: model.SearchQuery{
+				Query: `(source:systemd* OR source:init) /Failed to start |: Failed with result '|entered failed state|Main process exited, code=(?:exited|killed|dumped), status=[1-9]/`,
+			},
+		},
+		{
+			Name:        "SMART warning",
+			Category:    "disk",
+			Severity:    model.SevWarning,
+			Description: "smartd reports that a disk is failing or about to.",
+			Query: model.SearchQuery{
+				Query: `source:smartd /FAILING_NOW|[Pp]refailure|unreadable \(pending\) sectors|[Oo]ffline uncorrectable sectors|SMART (?:overall-health|error|Failure)|failed self-test/`,
+			},
+		},
+		{
+			Name:        "SSH brute force",
+			Category:    "auth",
+			Severity:    model.SevWarning,
+			Description: "Many failed attempts to log in via SSH within a short time.",
+			Query: model.SearchQuery{
+				Query: `source:sshd* /Failed password for|Invalid user|authentication failure|maximum authentication attempts exceeded/`,
+			},
+			Threshold: 10,
+			Window:    time.Minute,
+		},
+	}
+
+	for i := range sigs {
+		sigs[i].Builtin = true
+		sigs[i].Active = true
+	}
+
+	return sigs
+} // func Library() []model.Signature
+
+// hit is a Record that matched a Signature with a Threshold, but that may
+// not be part of a burst.
+type hit struct {
+	id     int64
+	stamp  time.Time
+	tagged bool
+}
+
+type sigState struct {
+	sig    model.Signature
+	recent map[int64][]hit
+}
+
+// Matcher matches Records against a set of Signatures. It keeps track of
+// the recent matches of Signatures with a Threshold, so it must be fed
+// the Records roughly in the order they were logged.
+//
+// A Matcher is not safe for concurrent use.
+type Matcher struct {
+	sigs []*sigState
+}
+
+// NewMatcher returns a Matcher without any Signatures.
+func NewMatcher() *Matcher {
+	return &Matcher{sigs: make([]*sigState, 0)}
+} // func NewMatcher() *Matcher
+
+// Load replaces the Signatures of the Matcher with the active ones among
+// the given Signatures, compiling their Queries. Signatures that were
+// loaded before keep the matches they have seen. Signatures whose Query
+// does not compile or does not work on Records as they come in are left
+// out, the error lists all of them.
+func (m *Matcher) Load(sigs []model.Signature, hosts []model.Host) error {
+	var (
+		errs  []error
+		old   = make(map[int64]*sigState, len(m.sigs))
+		state = make([]*sigState, 0, len(sigs))
+	)
+
+	for _, s := range m.sigs {
+		old[s.sig.ID] = s
+	}
+
+	for _, sig := range sigs {
+		if !sig.Active {
+			continue
+		} else if err := sig.Query.Compile(hosts); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot compile Query of Signature %q: %w",
+				sig.Name,
+				err))
+			continue
+		} else if err = sig.Query.CheckLive(); err != nil {
+			errs = append(errs, fmt.Errorf("Query of Signature %q does not work: %w",
+				sig.Name,
+				err))
+			continue
+		}
+
+		var s = old[sig.ID]
+
+		if s == nil || s.sig.Threshold != sig.Threshold || s.sig.Window != sig.Window {
+			s = &sigState{recent: make(map[int64][]hit)}
+		}
+
+		s.sig = sig
+		state = append(state, s)
+	}
+
+	m.sigs = state
+
+	return errors.Join(errs...)
+} // func (m *Matcher) Load(sigs []model.Signature, hosts []model.Host) error
+
+// Len returns the number of Signatures the Matcher matches Records
+// against.
+func (m *Matcher) Len() int {
+	return len(m.sigs)
+} // func (m *Matcher) Len() int
+
+// Match returns a Detection for every Record and Signature it matches.
+// For Signatures with a Threshold, it also returns Detections for
+// Records from earlier calls once they turn out to be part of a burst.
+func (m *Matcher) Match(records []model.Record) []model.Detection {
+	var (
+		latest time.Time
+		list   = make([]model.Detection, 0)
+	)
+
+	for i := range records {
+		if records[i].Time.After(latest) {
+			latest = records[i].Time
+		}
+	}
+
+	for _, s := range m.sigs {
+		for i := range records {
+			var r = &records[i]
+
+			if !s.sig.Query.Match(r) {
+				continue
+			} else if s.sig.Threshold == 0 {
+				list = append(list, model.Detection{
+					RecordID:    r.ID,
+					SignatureID: s.sig.ID,
+					HostID:      r.HostID,
+					Time:        r.Time,
+				})
+				continue
+			}
+
+			list = append(list, s.burst(r)...)
+		}
+
+		if s.sig.Threshold > 0 {
+			s.prune(latest)
+		}
+	}
+
+	return list
+} // func (m *Matcher) Match(records []model.Record) []model.Detection
+
+// burst remembers that the Record matched the Signature, and returns the
+// Detections for the Records that have not been tagged, yet, if there are
+// more than Threshold of them within Window.
+func (s *sigState) burst(r *model.Record) []model.Detection {
+	var (
+		begin = r.Time.Add(-s.sig.Window)
+		hits  = s.recent[r.HostID]
+		list  []model.Detection
+	)
+
+	hits = slices.DeleteFunc(append(hits, hit{id: r.ID, stamp: r.Time}), func(h hit) bool {
+		return h.stamp.Before(begin)
+	})
+	s.recent[r.HostID] = hits
+
+	if int64(len(hits)) <= s.sig.Threshold {
+		return nil
+	}
+
+	for i := range hits {
+		if hits[i].tagged {
+			continue
+		}
+
+		hits[i].tagged = true
+		list = append(list, model.Detection{
+			RecordID:    hits[i].id,
+			SignatureID: s.sig.ID,
+			HostID:      r.HostID,
+			Time:        hits[i].stamp,
+		})
+	}
+
+	return list
+} // func (s *sigState) burst(r *model.Record) []model.Detection
+
+// prune forgets the hits that are older than Window as of now, so Hosts
+// that have gone quiet do not stick around forever.
+func (s *sigState) prune(now time.Time) {
+	var begin = now.Add(-s.sig.Window)
+
+	for host, hits := range s.recent {
+		hits = slices.DeleteFunc(hits, func(h hit) bool {
+			return h.stamp.Before(begin)
+		})
+
+		if len(hits) == 0 {
+			delete(s.recent, host)
+		} else {
+			s.recent[host] = hits
+		}
+	}
+} // func (s *sigState) prune(now time.Time)
@@ -0,0 +1,160 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/drain/01_drain_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-06 16:10:53 krylon>
+
+package drain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var tokens = Tokenize("Accepted publickey for root from 192.168.0.23 port 51234 ssh2")
+	var expect = []string{"Accepted", "publickey", "for", "root", "from", Wildcard, "port", Wildcard, "ssh2"}
+
+	if len(tokens) != len(expect) {
+		t.Fatalf("Unexpected tokens: %q", tokens)
+	}
+
+	for i, tok := range expect {
+		if tokens[i] != tok {
+			t.Errorf("Token #%d is %q, expected %q", i, tokens[i], tok)
+		}
+	}
+} // func TestTokenize(t *testing.T)
+
+func TestMinerAdd(t *testing.T) {
+	type testCase struct {
+		msg     string
+		cluster int
+		changed bool
+		tmpl    string
+	}
+
+	var (
+		m         = New()
+		clusters  []*Cluster
+		testCases = []testCase{
+			{
+				msg:     "Accepted publickey for root from 192.168.0.23 port 51234 ssh2",
+				cluster: 0,
+				changed: true,
+				tmpl:    "Accepted publickey for root from <*> port <*> ssh2",
+			},
+			{
+				msg:     "Accepted publickey for root from 10.0.0.1 port 4711 ssh2",
+				cluster: 0,
+				tmpl:    "Accepted publickey for root from <*> port <*> ssh2",
+			},
+			{
+				msg:     "Accepted publickey for krylon from 10.0.0.1 port 4711 ssh2",
+				cluster: 0,
+				changed: true,
+				tmpl:    "Accepted publickey for <*> from <*> port <*> ssh2",
+			},
+			{
+				msg:     "Accepted publickey for alice from 10.0.0.1 port 4711 ssh1",
+				cluster: 0,
+				changed: true,
+				tmpl:    "Accepted publickey for <*> from <*> port <*> <*>",
+			},
+			{
+				// Same length, but different leading tokens.
+				msg:     "Accepted password for krylon from 10.0.0.1 port 4711 ssh2",
+				cluster: 1,
+				changed: true,
+				tmpl:    "Accepted password for krylon from <*> port <*> ssh2",
+			},
+			{
+				// Same length and leading tokens, but not similar
+				// enough.
+				msg:     "Accepted publickey from somewhere unexpected, this is not good",
+				cluster: 2,
+				changed: true,
+				tmpl:    "Accepted publickey from somewhere unexpected, this is not good",
+			},
+			{
+				msg:     "Started Session 4711 of User krylon.",
+				cluster: 3,
+				changed: true,
+				tmpl:    "Started Session <*> of User krylon.",
+			},
+			{
+				msg:     "Started Session 23 of User root.",
+				cluster: 3,
+				changed: true,
+				tmpl:    "Started Session <*> of User <*>",
+			},
+		}
+	)
+
+	for i, c := range testCases {
+		var cl, changed = m.Add(c.msg)
+
+		if c.cluster == len(clusters) {
+			clusters = append(clusters, cl)
+		}
+
+		if cl != clusters[c.cluster] {
+			t.Errorf("Message #%d %q was put into the wrong Cluster: %q",
+				i,
+				c.msg,
+				cl.Template())
+		} else if changed != c.changed {
+			t.Errorf("Adding message #%d %q returned changed = %t, expected %t",
+				i,
+				c.msg,
+				changed,
+				c.changed)
+		} else if tmpl := cl.Template(); tmpl != c.tmpl {
+			t.Errorf("Unexpected template after adding message #%d %q: %q (expected %q)",
+				i,
+				c.msg,
+				tmpl,
+				c.tmpl)
+		}
+	}
+
+	if m.Len() != len(clusters) {
+		t.Errorf("Miner has %d Clusters, expected %d", m.Len(), len(clusters))
+	}
+} // func TestMinerAdd(t *testing.T)
+
+func TestMinerInsert(t *testing.T) {
+	var (
+		m        = New()
+		existing = &Cluster{
+			ID:     42,
+			Tokens: Tokenize("Started Session 1 of User root."),
+		}
+	)
+
+	m.Insert(existing)
+
+	if c, changed := m.Add("Started Session 2 of User root."); c != existing {
+		t.Errorf("Message was not put into the existing Cluster: %#v", c)
+	} else if changed {
+		t.Errorf("Template of existing Cluster was changed: %q", c.Template())
+	}
+} // func TestMinerInsert(t *testing.T)
+
+func TestMinerMaxChildren(t *testing.T) {
+	var m = New()
+
+	m.MaxChildren = 3
+
+	for i := 0; i < 10; i++ {
+		m.Add(fmt.Sprintf("word%c says hello to everyone", 'a'+i))
+	}
+
+	// The first two words get a child of their own, the rest share one,
+	// and since their messages are similar enough, they share a Cluster.
+	if n := len(m.root[5].children); n != 3 {
+		t.Errorf("Root node has %d children, expected 3", n)
+	} else if m.Len() != 3 {
+		t.Errorf("Miner has %d Clusters, expected 3", m.Len())
+	}
+} // func TestMinerMaxChildren(t *testing.T)
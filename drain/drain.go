@@ -0,0 +1,208 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/drain/drain.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-06 15:42:19 krylon>
+
+// Package drain clusters log messages into templates as they come in. It
+// implements a variant of Drain, as described by He et al. in "Drain: An
+// Online Log Parsing Approach with Fixed Depth Tree" (ICWS 2017).
+//
+// Messages are split into tokens at whitespace. Messages are only ever
+// compared to messages with the same number of tokens that start with the
+// same few tokens, so finding the Cluster for a message is cheap no
+// matter how many Clusters there are. Among those, the message joins the
+// Cluster whose template is most similar, and the tokens in which they
+// differ become wildcards. If none is similar enough, the message starts
+// a new Cluster.
+package drain
+
+import (
+	"strings"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Wildcard replaces the tokens in which the messages of a Cluster differ.
+const Wildcard = "<*>"
+
+// The defaults for the parameters of a Miner. A Depth of 2 corresponds to
+// a tree depth of 4 in the paper.
+const (
+	DefaultDepth       = 2
+	DefaultSimilarity  = 0.4
+	DefaultMaxChildren = 100
+)
+
+// Cluster is a group of messages that share a template. Tokens are the
+// words of the template, with Wildcard wherever the messages differ.
+type Cluster struct {
+	ID     int64
+	Tokens []string
+}
+
+// Template returns the template of the Cluster.
+func (c *Cluster) Template() string {
+	return strings.Join(c.Tokens, " ")
+} // func (c *Cluster) Template() string
+
+// similarity returns the share of tokens in which the message agrees with
+// the template of the Cluster. Like in the paper, a wildcard in the
+// template only agrees with a wildcard in the message, otherwise a few
+// wildcards would make a template similar to almost anything.
+func (c *Cluster) similarity(tokens []string) float64 {
+	var same int
+
+	if len(tokens) == 0 {
+		return 1
+	}
+
+	for i, t := range c.Tokens {
+		if t == tokens[i] {
+			same++
+		}
+	}
+
+	return float64(same) / float64(len(tokens))
+} // func (c *Cluster) similarity(tokens []string) float64
+
+// merge replaces the tokens in which the message differs from the
+// template with wildcards. It returns true if the template has changed.
+func (c *Cluster) merge(tokens []string) bool {
+	var changed bool
+
+	for i, t := range tokens {
+		if c.Tokens[i] != t && c.Tokens[i] != Wildcard {
+			c.Tokens[i] = Wildcard
+			changed = true
+		}
+	}
+
+	return changed
+} // func (c *Cluster) merge(tokens []string) bool
+
+// Tokenize splits a message into the tokens used for clustering. Things
+// that look like parameters to model.SplitMessage, like numbers and
+// addresses, are replaced with Wildcard beforehand, so messages that only
+// differ in those end up in the same Cluster right away.
+func Tokenize(msg string) []string {
+	var tmpl, _ = model.SplitMessage(msg)
+
+	return strings.Fields(strings.ReplaceAll(tmpl, model.ParamMarker, Wildcard))
+} // func Tokenize(msg string) []string
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+} // func newNode() *node
+
+// Miner sorts messages into Clusters. It is not safe for concurrent use.
+//
+// Depth is the number of leading tokens that decide which Clusters a
+// message is compared to, Similarity is the share of tokens a message
+// must have in common with a template to join its Cluster, MaxChildren
+// limits the number of distinct tokens at each level of the tree. Tokens
+// beyond that are lumped together, as are tokens that contain a Wildcard.
+type Miner struct {
+	Depth       int
+	Similarity  float64
+	MaxChildren int
+	root        map[int]*node
+	cnt         int
+}
+
+// New returns a Miner with the default parameters.
+func New() *Miner {
+	return &Miner{
+		Depth:       DefaultDepth,
+		Similarity:  DefaultSimilarity,
+		MaxChildren: DefaultMaxChildren,
+		root:        make(map[int]*node),
+	}
+} // func New() *Miner
+
+// Len returns the number of Clusters.
+func (m *Miner) Len() int {
+	return m.cnt
+} // func (m *Miner) Len() int
+
+// leaf returns the node that holds the Clusters for the given tokens,
+// creating it and the nodes above it as needed.
+func (m *Miner) leaf(tokens []string) *node {
+	var n = m.root[len(tokens)]
+
+	if n == nil {
+		n = newNode()
+		m.root[len(tokens)] = n
+	}
+
+	for i := 0; i < m.Depth && i < len(tokens); i++ {
+		var (
+			key   = tokens[i]
+			child *node
+		)
+
+		if strings.Contains(key, Wildcard) {
+			key = Wildcard
+		}
+
+		if child = n.children[key]; child == nil {
+			// One child is reserved for the tokens that do not
+			// get one of their own.
+			if key != Wildcard && len(n.children) >= m.MaxChildren-1 {
+				key = Wildcard
+			}
+
+			if child = n.children[key]; child == nil {
+				child = newNode()
+				n.children[key] = child
+			}
+		}
+
+		n = child
+	}
+
+	return n
+} // func (m *Miner) leaf(tokens []string) *node
+
+// Add sorts a message into a Cluster and returns it. If no Cluster is
+// similar enough, a new one with an ID of 0 is created, and it is up to
+// the caller to assign an ID. The second return value is true if the
+// Cluster is new or its template was changed to match the message.
+func (m *Miner) Add(msg string) (*Cluster, bool) {
+	var (
+		tokens = Tokenize(msg)
+		n      = m.leaf(tokens)
+		best   *Cluster
+		maxSim float64
+	)
+
+	for _, c := range n.clusters {
+		if sim := c.similarity(tokens); sim > maxSim {
+			best, maxSim = c, sim
+		}
+	}
+
+	if best != nil && maxSim >= m.Similarity {
+		return best, best.merge(tokens)
+	}
+
+	best = &Cluster{Tokens: tokens}
+	n.clusters = append(n.clusters, best)
+	m.cnt++
+
+	return best, true
+} // func (m *Miner) Add(msg string) (*Cluster, bool)
+
+// Insert adds a Cluster that already exists, e.g. one that was saved to a
+// database earlier.
+func (m *Miner) Insert(c *Cluster) {
+	var n = m.leaf(c.Tokens)
+
+	n.clusters = append(n.clusters, c)
+	m.cnt++
+} // func (m *Miner) Insert(c *Cluster)
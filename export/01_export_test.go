@@ -0,0 +1,169 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/export/01_export_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 22. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-26 21:24:40 krylon>
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+const recordCnt = 30
+
+var (
+	db    *database.Database
+	host  = model.Host{Name: "export.example.com"}
+	begin = time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func TestExportPrepare(t *testing.T) {
+	var err error
+
+	if db, err = database.Open(common.Path(path.Database)); err != nil {
+		db = nil
+		t.Fatalf("Cannot open database: %s", err.Error())
+	} else if err = db.HostAdd(&host); err != nil {
+		t.Fatalf("Cannot add Host: %s", err.Error())
+	}
+
+	for i := 0; i < recordCnt; i++ {
+		var rec = model.Record{
+			HostID: host.ID,
+			Time:   begin.Add(time.Duration(i) * time.Minute),
+			Source: "test",
+			// Commas and quotes to make life hard for CSV
+			Message: fmt.Sprintf("Message #%d, \"quoted\" from pid %d", i, 1000+i),
+		}
+
+		if err = db.RecordAdd(&rec); err != nil {
+			t.Fatalf("Cannot add Record: %s", err.Error())
+		}
+	}
+} // func TestExportPrepare(t *testing.T)
+
+// runExport runs a query against the test database and returns the output,
+// decompressed if necessary.
+func runExport(t *testing.T, f Format, compress bool, q *model.SearchQuery) []byte {
+	var (
+		err   error
+		buf   bytes.Buffer
+		hosts map[int64]string
+		ew    *Writer
+	)
+
+	if hosts, err = HostNames(db); err != nil {
+		t.Fatalf("Cannot get Host names: %s", err.Error())
+	}
+
+	ew = NewWriter(&buf, f, compress, hosts)
+
+	if err = Query(context.Background(), db, q, ew); err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	} else if err = ew.Close(); err != nil {
+		t.Fatalf("Cannot finish export: %s", err.Error())
+	} else if !compress {
+		return buf.Bytes()
+	}
+
+	var (
+		zr  *gzip.Reader
+		raw []byte
+	)
+
+	if zr, err = gzip.NewReader(&buf); err != nil {
+		t.Fatalf("Export is not compressed: %s", err.Error())
+	} else if raw, err = io.ReadAll(zr); err != nil {
+		t.Fatalf("Cannot decompress export: %s", err.Error())
+	}
+
+	return raw
+} // func runExport(t *testing.T, f Format, compress bool, q *model.SearchQuery) []byte
+
+func TestExportNDJSON(t *testing.T) {
+	if db == nil {
+		t.SkipNow()
+	}
+
+	for _, compress := range []bool{false, true} {
+		var (
+			cnt  int
+			data = runExport(t, NDJSON, compress, &model.SearchQuery{})
+			scan = bufio.NewScanner(bytes.NewReader(data))
+		)
+
+		for scan.Scan() {
+			var row Row
+
+			if err := json.Unmarshal(scan.Bytes(), &row); err != nil {
+				t.Fatalf("Cannot parse line %d: %s\n%s",
+					cnt+1,
+					err.Error(),
+					scan.Text())
+			} else if row.Host != host.Name {
+				t.Errorf("Unexpected Host in line %d: %q (expected %q)",
+					cnt+1,
+					row.Host,
+					host.Name)
+			}
+
+			cnt++
+		}
+
+		if cnt != recordCnt {
+			t.Errorf("Unexpected number of Records in export (compress = %t): %d (expected %d)",
+				compress,
+				cnt,
+				recordCnt)
+		}
+	}
+} // func TestExportNDJSON(t *testing.T)
+
+func TestExportCSV(t *testing.T) {
+	if db == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err  error
+		rows [][]string
+		q    = model.SearchQuery{
+			Terms: []*regexp.Regexp{regexp.MustCompile(`#1\d,`)},
+		}
+		data = runExport(t, CSV, true, &q)
+	)
+
+	if rows, err = csv.NewReader(bytes.NewReader(data)).ReadAll(); err != nil {
+		t.Fatalf("Cannot parse CSV: %s\n%s", err.Error(), data)
+	} else if len(rows) != 11 {
+		t.Fatalf("Unexpected number of rows in CSV: %d (expected 11)", len(rows))
+	} else if rows[0][0] != "id" {
+		t.Errorf("First row of CSV is not a header: %v", rows[0])
+	}
+
+	for _, row := range rows[1:] {
+		if len(row) != len(csvHeader) {
+			t.Errorf("Unexpected number of columns: %d (expected %d)",
+				len(row),
+				len(csvHeader))
+		} else if row[2] != host.Name {
+			t.Errorf("Unexpected Host: %q (expected %q)", row[2], host.Name)
+		}
+	}
+} // func TestExportCSV(t *testing.T)
@@ -0,0 +1,126 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/export/02_export_report_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:19:20 krylon>
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestExportReport(t *testing.T) {
+	if db == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		rep     *Report
+		records []model.Record
+		buf     bytes.Buffer
+		inc     = &model.Incident{
+			Title:   "Messages | everywhere",
+			Summary: "Too many *messages*.",
+			Begin:   begin.Add(10 * time.Minute),
+			End:     begin.Add(20 * time.Minute),
+		}
+		search = &model.Search{
+			Timestamp: time.Now(),
+			Title:     "All messages",
+			Query:     model.SearchQuery{Query: "Message"},
+		}
+	)
+
+	if records, err = db.RecordGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get Records: %s", err.Error())
+	} else if len(records) != recordCnt {
+		t.Fatalf("Unexpected number of Records: %d (expected %d)", len(records), recordCnt)
+	}
+
+	for _, r := range records {
+		search.Results = append(search.Results, r.ID)
+	}
+
+	search.Count = int64(len(search.Results))
+
+	if err = db.IncidentAdd(inc); err != nil {
+		t.Fatalf("Cannot add Incident: %s", err.Error())
+	} else if err = db.SearchAdd(search); err != nil {
+		t.Fatalf("Cannot add Search: %s", err.Error())
+	} else if err = db.IncidentPinSearch(inc.ID, search.ID); err != nil {
+		t.Fatalf("Cannot pin Search: %s", err.Error())
+	}
+
+	// The oldest Record is outside the window of the Incident, but since
+	// it is pinned, it shows up anyway.
+	var oldest = records[len(records)-1]
+
+	if err = db.IncidentPinRecord(&model.Pin{
+		IncidentID: inc.ID,
+		RecordID:   oldest.ID,
+		HostID:     oldest.HostID,
+		Time:       oldest.Time,
+		Source:     oldest.Source,
+		Message:    oldest.Message,
+		Note:       "It all began here",
+	}); err != nil {
+		t.Fatalf("Cannot pin Record: %s", err.Error())
+	} else if rep, err = LoadReport(db, inc.ID, 1000); err != nil {
+		t.Fatalf("Cannot load report: %s", err.Error())
+	} else if rep == nil {
+		t.Fatalf("Incident %d was not found", inc.ID)
+	} else if len(rep.Timeline) != 12 {
+		t.Fatalf("Unexpected length of timeline: %d (expected 12)", len(rep.Timeline))
+	} else if rep.Timeline[0].Record.ID != oldest.ID || rep.Timeline[0].Pin == nil {
+		t.Errorf("Pinned Record is not the first on the timeline: %#v", rep.Timeline[0])
+	} else if err = rep.WriteMarkdown(&buf); err != nil {
+		t.Fatalf("Cannot write Markdown: %s", err.Error())
+	}
+
+	var md = buf.String()
+
+	if !strings.HasPrefix(md, `# Incident: Messages \| everywhere`) {
+		t.Errorf("Unexpected title in Markdown:\n%s", md)
+	} else if !strings.Contains(md, inc.Summary) {
+		t.Errorf("Summary is missing from Markdown:\n%s", md)
+	} else if strings.Count(md, "\n| ") != 13 {
+		t.Errorf("Unexpected number of table rows in Markdown:\n%s", md)
+	} else if !strings.Contains(md, "| pinned, All messages | It all began here |") {
+		t.Errorf("Pinned Record is not marked in Markdown:\n%s", md)
+	}
+
+	buf.Reset()
+
+	if err = rep.WriteHTML(&buf); err != nil {
+		t.Fatalf("Cannot write HTML: %s", err.Error())
+	} else if !strings.Contains(buf.String(), "&#34;quoted&#34;") {
+		t.Errorf("Messages are not escaped in HTML:\n%s", buf.String())
+	} else if strings.Count(buf.String(), "<tr") != 13 {
+		t.Errorf("Unexpected number of table rows in HTML:\n%s", buf.String())
+	}
+
+	// The most recent results of the Search are outside the window, they
+	// must not count against the limit.
+	if rep, err = LoadReport(db, inc.ID, 3); err != nil {
+		t.Fatalf("Cannot load truncated report: %s", err.Error())
+	} else if !rep.Truncated {
+		t.Errorf("Report with a limit of 3 results is not truncated")
+	} else if len(rep.Timeline) != 4 {
+		t.Fatalf("Unexpected length of truncated timeline: %d (expected 4)", len(rep.Timeline))
+	}
+
+	for _, e := range rep.Timeline[1:] {
+		if !inc.Contains(e.Record.Time) {
+			t.Errorf("Record %d is outside the window of the Incident: %s",
+				e.Record.ID,
+				e.Record.Time)
+		}
+	}
+} // func TestExportReport(t *testing.T)
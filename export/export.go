@@ -0,0 +1,295 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/export/export.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 22. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:57:40 krylon>
+
+// Package export writes Records to files other programs can process, either
+// as newline-delimited JSON or as CSV, optionally compressed with gzip.
+//
+// Records are written one at a time as they come out of the database, so
+// exports of any size can be streamed without holding them in memory.
+//
+// It also writes up Incidents as reports in Markdown or HTML, for
+// post-mortems.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Format identifies the file format of an export.
+type Format uint8
+
+// These are the supported file formats.
+const (
+	NDJSON Format = iota
+	CSV
+)
+
+func (f Format) String() string {
+	switch f {
+	case NDJSON:
+		return "ndjson"
+	case CSV:
+		return "csv"
+	default:
+		return fmt.Sprintf("Format(%d)", f)
+	}
+} // func (f Format) String() string
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "ndjson", "json", "jsonl":
+		return NDJSON, nil
+	case "csv":
+		return CSV, nil
+	default:
+		return 0, fmt.Errorf("Invalid export format %q (must be ndjson or csv)", s)
+	}
+} // func ParseFormat(s string) (Format, error)
+
+// MimeType returns the MIME type of an export in the given format.
+func (f Format) MimeType(compress bool) string {
+	if compress {
+		return "application/gzip"
+	} else if f == CSV {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+} // func (f Format) MimeType(compress bool) string
+
+// FileName returns a suitable file name for an export.
+func (f Format) FileName(base string, compress bool) string {
+	var name = base + "." + f.String()
+
+	if compress {
+		name += ".gz"
+	}
+
+	return name
+} // func (f Format) FileName(base string, compress bool) string
+
+// Row is what a Record looks like in an export. Unlike in the Record, the
+// Host is identified by its name.
+type Row struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+var csvHeader = []string{"id", "time", "host", "source", "message"}
+
+// Writer writes Records to an underlying io.Writer.
+type Writer struct {
+	hosts map[int64]string
+	zw    *gzip.Writer
+	cw    *csv.Writer
+	enc   *json.Encoder
+	cnt   int64
+}
+
+// NewWriter creates a Writer that writes Records to w. hosts maps Host IDs
+// to their names. After the last Record, Close must be called to flush
+// any buffered data.
+func NewWriter(w io.Writer, f Format, compress bool, hosts map[int64]string) *Writer {
+	var ew = &Writer{hosts: hosts}
+
+	if compress {
+		ew.zw = gzip.NewWriter(w)
+		w = ew.zw
+	}
+
+	switch f {
+	case CSV:
+		ew.cw = csv.NewWriter(w)
+	default:
+		ew.enc = json.NewEncoder(w)
+		ew.enc.SetEscapeHTML(false)
+	}
+
+	return ew
+} // func NewWriter(w io.Writer, f Format, compress bool, hosts map[int64]string) *Writer
+
+// Count returns the number of Records written so far.
+func (ew *Writer) Count() int64 {
+	return ew.cnt
+} // func (ew *Writer) Count() int64
+
+// Write writes a single Record.
+func (ew *Writer) Write(r *model.Record) error {
+	var (
+		err  error
+		host = ew.hosts[r.HostID]
+	)
+
+	if host == "" {
+		host = strconv.FormatInt(r.HostID, 10)
+	}
+
+	if ew.cw != nil {
+		if ew.cnt == 0 {
+			if err = ew.cw.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+
+		err = ew.cw.Write([]string{
+			strconv.FormatInt(r.ID, 10),
+			r.Time.Format(time.RFC3339),
+			host,
+			r.Source,
+			r.Message,
+		})
+	} else {
+		err = ew.enc.Encode(&Row{
+			ID:      r.ID,
+			Time:    r.Time,
+			Host:    host,
+			Source:  r.Source,
+			Message: r.Message,
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ew.cnt++
+	return nil
+} // func (ew *Writer) Write(r *model.Record) error
+
+// Close flushes any buffered data. It does not close the underlying
+// io.Writer.
+func (ew *Writer) Close() error {
+	var err error
+
+	if ew.cw != nil {
+		if ew.cnt == 0 {
+			// Even an empty export should have a header.
+			if err = ew.cw.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+
+		ew.cw.Flush()
+		if err = ew.cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	if ew.zw != nil {
+		return ew.zw.Close()
+	}
+
+	return nil
+} // func (ew *Writer) Close() error
+
+// HostNames returns a map of the IDs of all Hosts to their names.
+func HostNames(db database.Storage) (map[int64]string, error) {
+	var (
+		err   error
+		hosts []model.Host
+	)
+
+	if hosts, err = db.HostGetAll(); err != nil {
+		return nil, err
+	}
+
+	var names = make(map[int64]string, len(hosts))
+
+	for _, h := range hosts {
+		names[h.ID] = h.Name
+	}
+
+	return names, nil
+} // func HostNames(db database.Storage) (map[int64]string, error)
+
+// Query writes all Records matching q to ew, most recent first.
+// If ctx is cancelled, the export stops early. If the search fails
+// midway, its error is returned, so a truncated export is not mistaken
+// for a complete one.
+func Query(ctx context.Context, db database.Storage, q *model.SearchQuery, ew *Writer) error {
+	var (
+		err     error
+		cancel  context.CancelFunc
+		prog    database.SearchProgress
+		records = make(chan model.Record)
+	)
+
+	if err = database.CompileSearch(db, q); err != nil {
+		return err
+	}
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	go db.RecordSearch(ctx, q, records, &prog)
+
+	for r := range records {
+		if err = ew.Write(&r); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		// Tell RecordSearch to stop and wait for it to close the channel.
+		cancel()
+		for range records { // nolint: revive
+		}
+		return err
+	} else if err = prog.Err(); err != nil {
+		return err
+	}
+
+	return ctx.Err()
+} // func Query(ctx context.Context, db database.Storage, q *model.SearchQuery, ew *Writer) error
+
+// searchPageSize is the number of results we fetch at once when exporting
+// the results of a saved Search.
+const searchPageSize = 1000
+
+// Search writes the results of the saved Search with the given ID to ew.
+func Search(db database.Storage, id int64, ew *Writer) error {
+	var (
+		err         error
+		offset, cnt int64
+		records     []model.Record
+	)
+
+	if cnt, err = db.SearchGetResultCount(id); err != nil {
+		return err
+	}
+
+	// A page may contain fewer Records than we asked for, if some of them
+	// were deleted after the Search was performed, so we go by the number
+	// of results instead.
+	for offset = 0; offset < cnt; offset += searchPageSize {
+		if records, err = db.SearchGetResults(id, offset, searchPageSize); err != nil {
+			return err
+		}
+
+		for i := range records {
+			if err = ew.Write(&records[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+} // func Search(db database.Storage, id int64, ew *Writer) error
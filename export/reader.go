@@ -0,0 +1,235 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/export/reader.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 23. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:12:25 krylon>
+
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Reader reads files written by a Writer. It implements the
+// logreader.LogReader interface, so exports can be imported into a
+// database again. We do not import logreader here, though, it pulls in
+// the systemd journal, which the server has no use for.
+//
+// Compressed files are detected by their content, not by their name.
+// Record IDs and Host names from the file are ignored.
+type Reader struct {
+	log    *log.Logger
+	err    error
+	format Format
+	paths  []string
+	files  []*os.File
+}
+
+// CreateReader creates a Reader for files in the given Format.
+func CreateReader(f Format, path ...string) (*Reader, error) {
+	var (
+		err error
+		rdr = &Reader{
+			format: f,
+			paths:  path,
+		}
+	)
+
+	if rdr.log, err = common.GetLogger(logdomain.LogReader); err != nil {
+		return nil, err
+	}
+
+	return rdr, nil
+} // func CreateReader(f Format, path ...string) (*Reader, error)
+
+// Init opens the files.
+func (r *Reader) Init() error {
+	r.files = make([]*os.File, len(r.paths))
+
+	for idx, path := range r.paths {
+		var err error
+
+		if r.files[idx], err = os.Open(path); err != nil {
+			r.log.Printf("[ERROR] Failed to open %s: %s\n",
+				path,
+				err.Error())
+			r.Close() // nolint: errcheck
+			return err
+		}
+	}
+
+	return nil
+} // func (r *Reader) Init() error
+
+// Close closes the files.
+func (r *Reader) Close() error {
+	for idx, fh := range r.files {
+		if fh != nil {
+			fh.Close() // nolint: errcheck
+			r.files[idx] = nil
+		}
+	}
+
+	return nil
+} // func (r *Reader) Close() error
+
+// IsError returns the Reader's error state
+func (r *Reader) IsError() (bool, error) {
+	return r.err != nil, r.err
+} // func (r *Reader) IsError() (bool, error)
+
+// ReadFrom reads Records beginning at the given time stamp.
+// At most max Records are read from each file, unless max is 0.
+// Upon returning, the method will close the channel.
+func (r *Reader) ReadFrom(begin time.Time, max int, queue chan<- model.Record) {
+	defer close(queue)
+
+	for idx, fh := range r.files {
+		var (
+			err  error
+			cnt  int
+			path = r.paths[idx]
+			next func() (model.Record, error)
+		)
+
+		r.log.Printf("[TRACE] Reading from %s\n", path)
+
+		if next, err = r.open(fh); err != nil {
+			r.log.Printf("[ERROR] Cannot read %s: %s\n",
+				path,
+				err.Error())
+			r.err = err
+			continue
+		}
+
+		for {
+			var rec model.Record
+
+			if rec, err = next(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					r.log.Printf("[ERROR] Failed to read from %s: %s\n",
+						path,
+						err.Error())
+					r.err = err
+				}
+				break
+			} else if rec.Time.Before(begin) {
+				continue
+			}
+
+			queue <- rec
+			if cnt++; max > 0 && cnt >= max {
+				break
+			}
+		}
+
+		r.log.Printf("[TRACE] Read %d records from %s\n",
+			cnt,
+			path)
+	}
+} // func (r *Reader) ReadFrom(begin time.Time, max int, queue chan<- model.Record)
+
+// open returns a function that returns the next Record from fh each time
+// it is called, and io.EOF at the end of the file.
+func (r *Reader) open(fh *os.File) (func() (model.Record, error), error) {
+	var (
+		err   error
+		magic []byte
+		input io.Reader
+		br    = bufio.NewReader(fh)
+	)
+
+	input = br
+
+	if magic, err = br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		if input, err = gzip.NewReader(br); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.format == CSV {
+		return csvRecords(input)
+	}
+
+	var dec = json.NewDecoder(input)
+
+	return func() (model.Record, error) {
+		var row Row
+
+		if err := dec.Decode(&row); err != nil {
+			return model.Record{}, err
+		}
+
+		return row.record(), nil
+	}, nil
+} // func (r *Reader) open(fh *os.File) (func() (model.Record, error), error)
+
+// csvRecords returns a function that reads Records from a CSV file, which
+// must have the same columns a Writer creates.
+func csvRecords(input io.Reader) (func() (model.Record, error), error) {
+	var (
+		err    error
+		header []string
+		cr     = csv.NewReader(input)
+	)
+
+	cr.FieldsPerRecord = len(csvHeader)
+	cr.ReuseRecord = true
+
+	if header, err = cr.Read(); err != nil {
+		return nil, err
+	}
+
+	for idx, col := range csvHeader {
+		if header[idx] != col {
+			return nil, fmt.Errorf("Unexpected column %q in CSV header (expected %q)",
+				header[idx],
+				col)
+		}
+	}
+
+	return func() (model.Record, error) {
+		var (
+			err   error
+			stamp time.Time
+			line  []string
+		)
+
+		if line, err = cr.Read(); err != nil {
+			return model.Record{}, err
+		} else if stamp, err = time.Parse(time.RFC3339, line[1]); err != nil {
+			return model.Record{}, err
+		}
+
+		var row = Row{
+			Time:    stamp,
+			Host:    line[2],
+			Source:  line[3],
+			Message: line[4],
+		}
+
+		return row.record(), nil
+	}, nil
+} // func csvRecords(input io.Reader) (func() (model.Record, error), error)
+
+// record converts a Row back into a Record.
+func (row *Row) record() model.Record {
+	return model.Record{
+		Time:    row.Time,
+		Source:  row.Source,
+		Message: row.Message,
+	}
+} // func (row *Row) record() model.Record
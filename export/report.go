@@ -0,0 +1,368 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/export/report.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:38:05 krylon>
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// ReportFormat identifies the file format of an Incident report.
+type ReportFormat uint8
+
+// These are the supported formats for Incident reports.
+const (
+	Markdown ReportFormat = iota
+	HTML
+)
+
+func (f ReportFormat) String() string {
+	switch f {
+	case Markdown:
+		return "md"
+	case HTML:
+		return "html"
+	default:
+		return fmt.Sprintf("ReportFormat(%d)", f)
+	}
+} // func (f ReportFormat) String() string
+
+// ParseReportFormat returns the ReportFormat with the given name.
+func ParseReportFormat(s string) (ReportFormat, error) {
+	switch strings.ToLower(s) {
+	case "md", "markdown":
+		return Markdown, nil
+	case "html":
+		return HTML, nil
+	default:
+		return 0, fmt.Errorf("Invalid report format %q (must be markdown or html)", s)
+	}
+} // func ParseReportFormat(s string) (ReportFormat, error)
+
+// MimeType returns the MIME type of a report in the given format.
+func (f ReportFormat) MimeType() string {
+	if f == HTML {
+		return "text/html; charset=utf-8"
+	}
+
+	return "text/markdown; charset=utf-8"
+} // func (f ReportFormat) MimeType() string
+
+// FileName returns a suitable file name for a report.
+func (f ReportFormat) FileName(base string) string {
+	return base + "." + f.String()
+} // func (f ReportFormat) FileName(base string) string
+
+// Report is everything there is to know about an Incident, ready to be
+// written up for a post-mortem. Truncated is true if some of the pinned
+// Searches had more results within the window of the Incident than were
+// loaded.
+type Report struct {
+	Incident  *model.Incident
+	Searches  []model.Search
+	Timeline  []model.TimelineEntry
+	Hosts     map[int64]string
+	Truncated bool
+}
+
+// LoadReport loads the Incident with the given ID, along with its pinned
+// Records and Searches, and merges them into a timeline. At most max
+// results within the window of the Incident are loaded from each Search.
+// If the Incident does not exist, LoadReport returns nil.
+func LoadReport(db database.Storage, id, max int64) (*Report, error) {
+	var (
+		err     error
+		pins    []model.Pin
+		sids    []int64
+		pinned  = make(map[int64]bool)
+		results = make(map[int64][]model.Record)
+		rep     = new(Report)
+	)
+
+	if rep.Incident, err = db.IncidentGetByID(id); err != nil {
+		return nil, err
+	} else if rep.Incident == nil {
+		return nil, nil
+	} else if pins, err = db.IncidentGetPins(id); err != nil {
+		return nil, err
+	} else if sids, err = db.IncidentGetSearches(id); err != nil {
+		return nil, err
+	} else if rep.Hosts, err = HostNames(db); err != nil {
+		return nil, err
+	}
+
+	// Pinned Records are marked with the Searches that found them, too,
+	// even if they are outside the window.
+	for _, p := range pins {
+		pinned[p.RecordID] = true
+	}
+
+	for _, sid := range sids {
+		var (
+			search *model.Search
+			cnt    int64
+		)
+
+		if search, err = db.SearchGetByID(sid); err != nil {
+			return nil, err
+		} else if search == nil {
+			continue
+		}
+
+		rep.Searches = append(rep.Searches, *search)
+
+		// Search results are mostly in chronological order, but Records
+		// from the legacy table may be mixed in anywhere, so we have to
+		// look at all of them.
+		for offset := int64(0); offset < search.Count; offset += searchPageSize {
+			var records []model.Record
+
+			if records, err = db.SearchGetResults(sid, offset, searchPageSize); err != nil {
+				return nil, err
+			}
+
+			for _, r := range records {
+				if pinned[r.ID] {
+					results[sid] = append(results[sid], r)
+				} else if !rep.Incident.Contains(r.Time) {
+					continue
+				} else if cnt == max {
+					rep.Truncated = true
+				} else {
+					results[sid] = append(results[sid], r)
+					cnt++
+				}
+			}
+		}
+	}
+
+	rep.Timeline = model.MergeTimeline(rep.Incident, pins, results)
+
+	return rep, nil
+} // func LoadReport(db database.Storage, id, max int64) (*Report, error)
+
+// Host returns the name of the Host with the given ID.
+func (rep *Report) Host(id int64) string {
+	if name := rep.Hosts[id]; name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("#%d", id)
+} // func (rep *Report) Host(id int64) string
+
+// SearchName returns the name of the pinned Search with the given ID.
+func (rep *Report) SearchName(id int64) string {
+	for i := range rep.Searches {
+		if rep.Searches[i].ID == id {
+			return rep.Searches[i].Name()
+		}
+	}
+
+	return fmt.Sprintf("Search #%d", id)
+} // func (rep *Report) SearchName(id int64) string
+
+// Origin describes how a Record got onto the timeline: It was pinned, found
+// by one or more of the pinned Searches, or both.
+func (rep *Report) Origin(e model.TimelineEntry) string {
+	var names = make([]string, 0, len(e.Searches)+1)
+
+	if e.Pin != nil {
+		names = append(names, "pinned")
+	}
+
+	for _, sid := range e.Searches {
+		names = append(names, rep.SearchName(sid))
+	}
+
+	return strings.Join(names, ", ")
+} // func (rep *Report) Origin(e model.TimelineEntry) string
+
+// Window returns the time window of the Incident in a human-readable form.
+func (rep *Report) Window() string {
+	var (
+		inc = rep.Incident
+		end = "ongoing"
+	)
+
+	if !inc.End.IsZero() {
+		end = inc.End.Format(common.TimestampFormat)
+	}
+
+	return inc.Begin.Format(common.TimestampFormat) + " - " + end
+} // func (rep *Report) Window() string
+
+// Write writes the report in the given format.
+func (rep *Report) Write(w io.Writer, f ReportFormat) error {
+	switch f {
+	case HTML:
+		return rep.WriteHTML(w)
+	default:
+		return rep.WriteMarkdown(w)
+	}
+} // func (rep *Report) Write(w io.Writer, f ReportFormat) error
+
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", "&lt;",
+	">", "&gt;",
+	"|", `\|`,
+	"#", `\#`,
+	"\r", " ",
+	"\n", " ",
+)
+
+// WriteMarkdown writes the report as a Markdown document. The Summary of
+// the Incident is copied verbatim, everything else is escaped.
+func (rep *Report) WriteMarkdown(w io.Writer) error {
+	var (
+		inc = rep.Incident
+		bw  = bufio.NewWriter(w)
+	)
+
+	fmt.Fprintf(bw, "# Incident: %s\n\n", mdEscaper.Replace(inc.Title))
+	fmt.Fprintf(bw, "- **Status:** %s\n", inc.Status)
+	fmt.Fprintf(bw, "- **Window:** %s\n", rep.Window())
+	fmt.Fprintf(bw, "- **Created:** %s\n", inc.Created.Format(common.TimestampFormat))
+
+	if inc.Summary != "" {
+		fmt.Fprintf(bw, "\n## Summary\n\n%s\n", strings.TrimSpace(inc.Summary))
+	}
+
+	if len(rep.Searches) > 0 {
+		fmt.Fprint(bw, "\n## Searches\n\n")
+
+		for _, s := range rep.Searches {
+			fmt.Fprintf(bw, "- %s: `%s`, %d results",
+				mdEscaper.Replace(s.Name()),
+				strings.ReplaceAll(s.Query.Query, "`", "'"),
+				s.Count)
+
+			if s.Expired {
+				fmt.Fprint(bw, " (expired)")
+			}
+
+			fmt.Fprint(bw, "\n")
+		}
+	}
+
+	fmt.Fprintf(bw, "\n## Timeline\n\n%d Records", len(rep.Timeline))
+
+	if rep.Truncated {
+		fmt.Fprint(bw, " (some Searches had more results than are shown)")
+	}
+
+	fmt.Fprint(bw, "\n\n| Time | Host | Source | Message | Origin | Note |\n")
+	fmt.Fprint(bw, "|------|------|--------|---------|--------|------|\n")
+
+	for i := range rep.Timeline {
+		var (
+			e    = &rep.Timeline[i]
+			note string
+		)
+
+		if e.Pin != nil {
+			note = e.Pin.Note
+		}
+
+		fmt.Fprintf(bw, "| %s | %s | %s | %s | %s | %s |\n",
+			e.Record.Time.Format(common.TimestampFormat),
+			mdEscaper.Replace(rep.Host(e.Record.HostID)),
+			mdEscaper.Replace(e.Record.Source),
+			mdEscaper.Replace(e.Record.Message),
+			mdEscaper.Replace(rep.Origin(*e)),
+			mdEscaper.Replace(note))
+	}
+
+	return bw.Flush()
+} // func (rep *Report) WriteMarkdown(w io.Writer) error
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"fmt_time": func(t time.Time) string {
+		return t.Format(common.TimestampFormat)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <title>Incident: {{ .Incident.Title }}</title>
+    <style>
+      body { font-family: sans-serif; }
+      table { border-collapse: collapse; }
+      th, td { border: 1px solid #CCCCCC; padding: 0.2em 0.5em; vertical-align: top; }
+      tr.pinned { background-color: #FFF3CD; }
+      td.message { font-family: monospace; }
+    </style>
+  </head>
+  <body>
+    <h1>Incident: {{ .Incident.Title }}</h1>
+    <ul>
+      <li><b>Status:</b> {{ .Incident.Status }}</li>
+      <li><b>Window:</b> {{ .Window }}</li>
+      <li><b>Created:</b> {{ fmt_time .Incident.Created }}</li>
+    </ul>
+    {{ with .Incident.Summary }}
+    <h2>Summary</h2>
+    <pre>{{ . }}</pre>
+    {{ end }}
+    {{ if .Searches }}
+    <h2>Searches</h2>
+    <ul>
+      {{ range .Searches }}
+      <li>{{ .Name }}: <code>{{ .Query.Query }}</code>, {{ .Count }} results{{ if .Expired }} (expired){{ end }}</li>
+      {{ end }}
+    </ul>
+    {{ end }}
+    <h2>Timeline</h2>
+    <p>
+      {{ len .Timeline }} Records{{ if .Truncated }} (some Searches had more results than are shown){{ end }}
+    </p>
+    <table>
+      <thead>
+        <tr>
+          <th>Time</th>
+          <th>Host</th>
+          <th>Source</th>
+          <th>Message</th>
+          <th>Origin</th>
+          <th>Note</th>
+        </tr>
+      </thead>
+      <tbody>
+        {{ $rep := . }}
+        {{ range .Timeline }}
+        <tr{{ if .Pin }} class="pinned"{{ end }}>
+          <td>{{ fmt_time .Record.Time }}</td>
+          <td>{{ $rep.Host .Record.HostID }}</td>
+          <td>{{ .Record.Source }}</td>
+          <td class="message">{{ .Record.Message }}</td>
+          <td>{{ $rep.Origin . }}</td>
+          <td>{{ with .Pin }}{{ .Note }}{{ end }}</td>
+        </tr>
+        {{ end }}
+      </tbody>
+    </table>
+  </body>
+</html>
+`))
+
+// WriteHTML writes the report as a self-contained HTML document.
+func (rep *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, rep)
+} // func (rep *Report) WriteHTML(w io.Writer) error
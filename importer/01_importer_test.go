@@ -0,0 +1,174 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/importer/01_importer_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 23. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-26 19:20:31 krylon>
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/export"
+	"github.com/blicero/scrollmaster/model"
+)
+
+const (
+	testHost  = "import.example.com"
+	lineCnt   = 25
+	batchSize = 7
+)
+
+var (
+	db  *database.Database
+	imp *Importer
+)
+
+func TestDetectType(t *testing.T) {
+	var cases = map[string]Type{
+		"/var/log/messages":          Syslog,
+		"/var/log/messages.0.gz":     Syslog,
+		"daemon.log.1":               Syslog,
+		"host.export":                Journal,
+		"host.journal.gz":            Journal,
+		"search_42.ndjson":           NDJSON,
+		"export_20240922.NDJSON.gz":  NDJSON,
+		"export_20240922_120000.csv": CSV,
+	}
+
+	for name, expected := range cases {
+		if typ := DetectType(name); typ != expected {
+			t.Errorf("DetectType(%q) = %s (expected %s)",
+				name,
+				typ,
+				expected)
+		}
+	}
+} // func TestDetectType(t *testing.T)
+
+func TestImporterCreate(t *testing.T) {
+	var (
+		err  error
+		host *model.Host
+	)
+
+	if db, err = database.Open(common.Path(path.Database)); err != nil {
+		db = nil
+		t.Fatalf("Cannot open database: %s", err.Error())
+	} else if imp, err = New(db, testHost); err != nil {
+		imp = nil
+		t.Fatalf("Cannot create Importer: %s", err.Error())
+	} else if host, err = db.HostGetByName(testHost); err != nil {
+		t.Fatalf("Cannot look up Host %s: %s", testHost, err.Error())
+	} else if host == nil || host.ID != imp.Host().ID {
+		t.Fatalf("Importer did not add Host %s", testHost)
+	}
+
+	imp.BatchSize = batchSize
+} // func TestImporterCreate(t *testing.T)
+
+func TestImportSyslog(t *testing.T) {
+	if imp == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		stats   Stats
+		reports int
+		sb      strings.Builder
+		file    = filepath.Join(common.BaseDir, "messages")
+		begin   = time.Now().Add(-time.Hour).Truncate(time.Second)
+	)
+
+	for i := 0; i < lineCnt; i++ {
+		fmt.Fprintf(&sb, "%s wintermute sshd[%d]: Connection #%d closed\n",
+			begin.Add(time.Duration(i)*time.Second).Format(time.Stamp),
+			1000+i,
+			i)
+	}
+
+	// The last line once more, which should be skipped.
+	fmt.Fprintf(&sb, "%s wintermute sshd[%d]: Connection #%d closed\n",
+		begin.Add(time.Duration(lineCnt-1)*time.Second).Format(time.Stamp),
+		1000+lineCnt-1,
+		lineCnt-1)
+
+	if err = os.WriteFile(file, []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("Cannot write %s: %s", file, err.Error())
+	}
+
+	imp.Progress = func(string, Stats) { reports++ }
+	defer func() { imp.Progress = nil }()
+
+	if stats, err = imp.ImportFile(file, Auto); err != nil {
+		t.Fatalf("Import of %s failed: %s", file, err.Error())
+	} else if stats.Read != lineCnt+1 || stats.Added != lineCnt || stats.Duplicates != 1 {
+		t.Errorf("Unexpected stats for first import: %+v", stats)
+	} else if reports != (lineCnt+1)/batchSize+1 {
+		t.Errorf("Unexpected number of progress reports: %d (expected %d)",
+			reports,
+			(lineCnt+1)/batchSize+1)
+	}
+
+	// The second time around, everything is a duplicate.
+	if stats, err = imp.ImportFile(file, Syslog); err != nil {
+		t.Fatalf("Second import of %s failed: %s", file, err.Error())
+	} else if stats.Added != 0 || stats.Duplicates != lineCnt+1 {
+		t.Errorf("Unexpected stats for second import: %+v", stats)
+	}
+} // func TestImportSyslog(t *testing.T)
+
+// TestImportExport exports the Records we imported from the syslog file and
+// imports them again, which should not add anything.
+func TestImportExport(t *testing.T) {
+	if imp == nil {
+		t.SkipNow()
+	}
+
+	for _, f := range []export.Format{export.NDJSON, export.CSV} {
+		var (
+			err   error
+			fh    *os.File
+			stats Stats
+			hosts map[int64]string
+			ew    *export.Writer
+			file  = filepath.Join(common.BaseDir, f.FileName("export", true))
+		)
+
+		if hosts, err = export.HostNames(db); err != nil {
+			t.Fatalf("Cannot get Host names: %s", err.Error())
+		} else if fh, err = os.Create(file); err != nil {
+			t.Fatalf("Cannot create %s: %s", file, err.Error())
+		}
+
+		ew = export.NewWriter(fh, f, true, hosts)
+
+		if err = export.Query(context.Background(), db, &model.SearchQuery{}, ew); err != nil {
+			fh.Close() // nolint: errcheck
+			t.Fatalf("Cannot export Records: %s", err.Error())
+		} else if err = ew.Close(); err != nil {
+			fh.Close() // nolint: errcheck
+			t.Fatalf("Cannot finish export: %s", err.Error())
+		} else if err = fh.Close(); err != nil {
+			t.Fatalf("Cannot close %s: %s", file, err.Error())
+		}
+
+		if stats, err = imp.ImportFile(file, Auto); err != nil {
+			t.Fatalf("Import of %s failed: %s", file, err.Error())
+		} else if stats.Read != lineCnt || stats.Duplicates != lineCnt {
+			t.Errorf("Unexpected stats for import of %s: %+v",
+				file,
+				stats)
+		}
+	}
+} // func TestImportExport(t *testing.T)
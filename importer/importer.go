@@ -0,0 +1,326 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/importer/importer.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 23. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:12:40 krylon>
+
+// Package importer loads historical log files into the database, e.g. to
+// add logs from before the Agent was installed on a machine.
+package importer
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/export"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/logreader"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// Type identifies the format of a file to import.
+type Type uint8
+
+// These are the file formats we can import.
+const (
+	Auto Type = iota
+	Syslog
+	Journal
+	NDJSON
+	CSV
+)
+
+func (t Type) String() string {
+	switch t {
+	case Auto:
+		return "auto"
+	case Syslog:
+		return "syslog"
+	case Journal:
+		return "journal"
+	case NDJSON:
+		return "ndjson"
+	case CSV:
+		return "csv"
+	default:
+		return fmt.Sprintf("Type(%d)", t)
+	}
+} // func (t Type) String() string
+
+// ParseType returns the Type with the given name.
+func ParseType(s string) (Type, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return Auto, nil
+	case "syslog":
+		return Syslog, nil
+	case "journal", "export":
+		return Journal, nil
+	case "ndjson", "json", "jsonl":
+		return NDJSON, nil
+	case "csv":
+		return CSV, nil
+	default:
+		return 0, fmt.Errorf("Invalid file type %q (must be one of auto, syslog, journal, ndjson, or csv)", s)
+	}
+} // func ParseType(s string) (Type, error)
+
+// DetectType guesses the Type of a file from its name. Anything we do not
+// recognize is assumed to be a syslog file, since those usually have no
+// suffix at all, or a number if they have been rotated.
+func DetectType(path string) Type {
+	var name = strings.ToLower(filepath.Base(path))
+
+	name = strings.TrimSuffix(name, ".gz")
+
+	switch filepath.Ext(name) {
+	case ".ndjson", ".jsonl", ".json":
+		return NDJSON
+	case ".csv":
+		return CSV
+	case ".export", ".journal":
+		return Journal
+	default:
+		return Syslog
+	}
+} // func DetectType(path string) Type
+
+// Opener returns the function to open files of the given Type.
+func (t Type) Opener() logreader.ReaderOpener {
+	switch t {
+	case Journal:
+		return logreader.CreateJournalExportReader
+	case NDJSON:
+		return exportOpener(export.NDJSON)
+	case CSV:
+		return exportOpener(export.CSV)
+	default:
+		return logreader.CreateSyslogReader
+	}
+} // func (t Type) Opener() logreader.ReaderOpener
+
+// exportOpener returns a logreader.ReaderOpener for exports in the given
+// Format.
+func exportOpener(f export.Format) logreader.ReaderOpener {
+	return func(path ...string) (logreader.LogReader, error) {
+		return export.CreateReader(f, path...)
+	}
+} // func exportOpener(f export.Format) logreader.ReaderOpener
+
+// DefaultBatchSize is the number of Records inserted per transaction, unless
+// specified otherwise.
+const DefaultBatchSize = 1000
+
+// Stats contains the numbers of an import.
+type Stats struct {
+	Read       int64
+	Added      int64
+	Duplicates int64
+}
+
+// Progress is called by the Importer after every batch of Records and at
+// the end of each file.
+type Progress func(path string, s Stats)
+
+// Importer adds Records from log files to the database, skipping the ones
+// that are already there.
+type Importer struct {
+	log       *log.Logger
+	db        database.Storage
+	host      *model.Host
+	BatchSize int
+	Progress  Progress
+}
+
+// New creates an Importer that adds Records to db, attributing them to the
+// Host with the given name. If there is no such Host, it is created.
+func New(db database.Storage, hostname string) (*Importer, error) {
+	var (
+		err error
+		imp = &Importer{
+			db:        db,
+			BatchSize: DefaultBatchSize,
+		}
+	)
+
+	if imp.log, err = common.GetLogger(logdomain.Importer); err != nil {
+		return nil, err
+	} else if hostname == "" {
+		return nil, fmt.Errorf("No host name was given")
+	} else if imp.host, err = db.HostGetByName(hostname); err != nil {
+		imp.log.Printf("[ERROR] Cannot look up Host %s: %s\n",
+			hostname,
+			err.Error())
+		return nil, err
+	} else if imp.host == nil {
+		imp.host = &model.Host{
+			Name:     hostname,
+			LastSeen: time.Now(),
+		}
+
+		if err = db.HostAdd(imp.host); err != nil {
+			imp.log.Printf("[ERROR] Cannot add Host %s: %s\n",
+				hostname,
+				err.Error())
+			return nil, err
+		}
+
+		imp.log.Printf("[INFO] Added Host %s (%d)\n",
+			hostname,
+			imp.host.ID)
+	}
+
+	return imp, nil
+} // func New(db database.Storage, hostname string) (*Importer, error)
+
+// Host returns the Host the imported Records are attributed to.
+func (imp *Importer) Host() *model.Host {
+	return imp.host
+} // func (imp *Importer) Host() *model.Host
+
+// ImportFile imports a single file. If t is Auto, the Type is guessed from
+// the name of the file.
+func (imp *Importer) ImportFile(path string, t Type) (Stats, error) {
+	var (
+		err error
+		rdr logreader.LogReader
+	)
+
+	if t == Auto {
+		t = DetectType(path)
+	}
+
+	imp.log.Printf("[INFO] Import %s as %s\n",
+		path,
+		t)
+
+	if rdr, err = t.Opener()(path); err != nil {
+		return Stats{}, err
+	} else if err = rdr.Init(); err != nil {
+		return Stats{}, err
+	}
+
+	defer rdr.Close() // nolint: errcheck
+
+	return imp.Import(path, rdr)
+} // func (imp *Importer) ImportFile(path string, t Type) (Stats, error)
+
+// Import adds all Records from rdr to the database. rdr must already be
+// initialized. name is only used for progress reports and logging.
+func (imp *Importer) Import(name string, rdr logreader.LogReader) (Stats, error) {
+	var (
+		err   error
+		stats Stats
+		inTx  bool
+		cnt   int   // Records processed in the current transaction
+		added int64 // Records added in the current transaction
+		queue = make(chan model.Record)
+		// Records added in the current transaction might not be
+		// visible to RecordCheckExist yet, so we remember their
+		// checksums ourselves. This also catches duplicates within
+		// the same batch.
+		seen = make(map[string]bool)
+	)
+
+	if imp.BatchSize <= 0 {
+		imp.BatchSize = DefaultBatchSize
+	}
+
+	go rdr.ReadFrom(time.Time{}, 0, queue)
+
+	for rec := range queue {
+		var exist bool
+
+		stats.Read++
+		rec.HostID = imp.host.ID
+
+		if !inTx {
+			if err = imp.db.Begin(); err != nil {
+				imp.log.Printf("[ERROR] Cannot start transaction: %s\n",
+					err.Error())
+				break
+			}
+			inTx = true
+		}
+
+		if seen[rec.Checksum()] {
+			stats.Duplicates++
+		} else if exist, err = imp.db.RecordCheckExist(&rec); err != nil {
+			imp.log.Printf("[ERROR] Failed to check if Record %s exists: %s\n",
+				rec.Checksum(),
+				err.Error())
+			break
+		} else if exist {
+			stats.Duplicates++
+		} else if err = imp.db.RecordAdd(&rec); err != nil {
+			imp.log.Printf("[ERROR] Failed to add Record from %s: %s\n",
+				name,
+				err.Error())
+			break
+		} else {
+			seen[rec.Checksum()] = true
+			stats.Added++
+			added++
+		}
+
+		if cnt++; cnt >= imp.BatchSize {
+			if err = imp.db.Commit(); err != nil {
+				imp.log.Printf("[ERROR] Cannot commit transaction: %s\n",
+					err.Error())
+				break
+			}
+
+			inTx = false
+			cnt = 0
+			added = 0
+			clear(seen)
+			imp.report(name, stats)
+		}
+	}
+
+	if err == nil && inTx {
+		if err = imp.db.Commit(); err != nil {
+			imp.log.Printf("[ERROR] Cannot commit transaction: %s\n",
+				err.Error())
+		}
+	}
+
+	if err != nil {
+		// ReadFrom does not stop until it is done with the file, so
+		// we have to drain the queue.
+		for range queue { // nolint: revive
+		}
+
+		if inTx {
+			imp.db.Rollback() // nolint: errcheck
+		}
+
+		stats.Added -= added
+		return stats, err
+	}
+
+	imp.report(name, stats)
+
+	if isErr, rerr := rdr.IsError(); isErr {
+		return stats, rerr
+	}
+
+	imp.log.Printf("[INFO] Imported %d of %d Records from %s (%d duplicates)\n",
+		stats.Added,
+		stats.Read,
+		name,
+		stats.Duplicates)
+
+	return stats, nil
+} // func (imp *Importer) Import(name string, rdr logreader.LogReader) (Stats, error)
+
+func (imp *Importer) report(name string, s Stats) {
+	if imp.Progress != nil {
+		imp.Progress(name, s)
+	}
+} // func (imp *Importer) report(name string, s Stats)
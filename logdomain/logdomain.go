@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-08-31 14:34:18 krylon>
+// Time-stamp: <2024-10-04 17:02:31 krylon>
 
 // Package logdomain provides symbolic constants to identify the various
 // pieces of the application that need to do logging.
@@ -22,6 +22,8 @@ const (
 	LogReader
 	Server
 	Agent
+	Importer
+	Notify
 )
 
 // AllDomains returns a slice of all the valid values for ID.
@@ -34,5 +36,7 @@ func AllDomains() []ID {
 		LogReader,
 		Server,
 		Agent,
+		Importer,
+		Notify,
 	}
 } // func AllDomains() []ID
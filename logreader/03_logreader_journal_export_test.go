@@ -0,0 +1,126 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/logreader/03_logreader_journal_export_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 23. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-23 18:10:45 krylon>
+
+package logreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestJournalExportRead(t *testing.T) {
+	var (
+		err     error
+		buf     bytes.Buffer
+		reader  LogReader
+		records []model.Record
+		queue   = make(chan model.Record)
+		path    = filepath.Join(common.BaseDir, "journal.export")
+		multi   = "first line\nsecond line"
+	)
+
+	buf.WriteString("__CURSOR=s=1\n__REALTIME_TIMESTAMP=1727100000123456\n_COMM=sshd\nSYSLOG_IDENTIFIER=sshd\nMESSAGE=Accepted publickey for krylon\n\n")
+	// An entry without a message should be skipped.
+	buf.WriteString("__REALTIME_TIMESTAMP=1727100001000000\n_COMM=kernel\n\n")
+	buf.WriteString("__REALTIME_TIMESTAMP=1727100002000000\nSYSLOG_IDENTIFIER=backup\nMESSAGE\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(multi))) // nolint: errcheck
+	buf.WriteString(multi + "\n\n")
+
+	if err = os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Cannot write %s: %s", path, err.Error())
+	} else if reader, err = CreateJournalExportReader(path); err != nil {
+		t.Fatalf("Cannot create JournalExportReader: %s", err.Error())
+	} else if err = reader.Init(); err != nil {
+		t.Fatalf("Cannot open %s: %s", path, err.Error())
+	}
+
+	defer reader.Close() // nolint: errcheck
+
+	go reader.ReadFrom(time.Time{}, 0, queue)
+
+	for rec := range queue {
+		records = append(records, rec)
+	}
+
+	if isErr, err := reader.IsError(); isErr {
+		t.Errorf("JournalExportReader reported an error: %s", err.Error())
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of Records: %d (expected 2)", len(records))
+	} else if records[0].Source != "sshd" || records[0].Message != "Accepted publickey for krylon" {
+		t.Errorf("Unexpected first Record: %s / %s", records[0].Source, records[0].Message)
+	} else if !records[0].Time.Equal(time.Unix(1727100000, 0)) {
+		t.Errorf("Unexpected timestamp of first Record: %s",
+			records[0].Time.Format(common.TimestampFormatSubSecond))
+	} else if records[1].Source != "backup" || records[1].Message != multi {
+		t.Errorf("Unexpected second Record: %s / %q", records[1].Source, records[1].Message)
+	}
+} // func TestJournalExportRead(t *testing.T)
+
+func TestParseSyslogLine(t *testing.T) {
+	var ref = time.Date(2024, 1, 3, 12, 0, 0, 0, time.Local)
+
+	type testCase struct {
+		line   string
+		stamp  time.Time
+		source string
+		err    bool
+	}
+
+	var cases = []testCase{
+		{
+			line:   "Jan  2 08:15:00 wintermute sshd[1234]: Connection closed",
+			stamp:  time.Date(2024, 1, 2, 8, 15, 0, 0, time.Local),
+			source: "sshd",
+		},
+		{
+			// Records from the end of the previous year.
+			line:   "Dec 31 23:59:59 wintermute cron[99]: Happy new year",
+			stamp:  time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local),
+			source: "cron",
+		},
+		{
+			line:   "2024-08-26T18:00:02.035Z lucas kernel: Something happened",
+			stamp:  time.Date(2024, 8, 26, 18, 0, 2, 35_000_000, time.UTC),
+			source: "kernel",
+		},
+		{
+			line: "This is not a syslog line",
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		var rec, err = parseSyslogLine(c.line, ref)
+
+		if c.err {
+			if err == nil {
+				t.Errorf("parseSyslogLine should have failed on %q", c.line)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to parse %q: %s", c.line, err.Error())
+		} else if !rec.Time.Equal(c.stamp) {
+			t.Errorf("Unexpected timestamp for %q: %s (expected %s)",
+				c.line,
+				rec.Time,
+				c.stamp)
+		} else if rec.Source != c.source {
+			t.Errorf("Unexpected source for %q: %q (expected %q)",
+				c.line,
+				rec.Source,
+				c.source)
+		}
+	}
+} // func TestParseSyslogLine(t *testing.T)
@@ -2,16 +2,20 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 15. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-16 21:05:04 krylon>
+// Time-stamp: <2024-09-23 17:20:41 krylon>
 
 package logreader
 
 import (
 	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/blicero/scrollmaster/common"
@@ -22,8 +26,55 @@ import (
 type logfile struct {
 	path string
 	fh   *os.File
+	rd   io.Reader
+	// Traditional syslog timestamps do not include the year, so we
+	// assume a Record is from the last year before the file was modified
+	// the last time.
+	ref time.Time
 }
 
+// open opens the logfile. If the file name ends in .gz, the file is
+// decompressed on the fly, so rotated logfiles can be read, too.
+func (lf *logfile) open() error {
+	var (
+		err  error
+		info os.FileInfo
+	)
+
+	if lf.fh, err = os.Open(lf.path); err != nil {
+		return err
+	} else if info, err = lf.fh.Stat(); err != nil {
+		lf.fh.Close() // nolint: errcheck
+		lf.fh = nil
+		return err
+	}
+
+	lf.ref = info.ModTime()
+	lf.rd = lf.fh
+
+	if strings.HasSuffix(lf.path, ".gz") {
+		if lf.rd, err = gzip.NewReader(lf.fh); err != nil {
+			lf.fh.Close() // nolint: errcheck
+			lf.fh = nil
+			return err
+		}
+	}
+
+	return nil
+} // func (lf *logfile) open() error
+
+// close closes the logfile.
+func (lf *logfile) close() error {
+	if lf.fh == nil {
+		return nil
+	}
+
+	var err = lf.fh.Close()
+	lf.fh = nil
+	lf.rd = nil
+	return err
+} // func (lf *logfile) close() error
+
 // SyslogReader is a LogReader that reads files created by the syslog daemon
 // commonly used on *BSD (and some Linux distros, I suppose).
 type SyslogReader struct {
@@ -34,9 +85,50 @@ type SyslogReader struct {
 
 var (
 	mpat = regexp.MustCompile(`^(\w{3}\s+\d+\s+\d+:\d+:\d+)\s+(\S+)\s+(.*)$`)
-	spat = regexp.MustCompile(`^(\w+)\[\d+\]:\s+(.*)$`)
+	// Some syslog daemons can be told to use RFC 3339 timestamps.
+	ipat = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:[.]\d+)?(?:Z|[-+]\d\d:\d\d))\s+(\S+)\s+(.*)$`)
+	spat = regexp.MustCompile(`^([^\s\[:]+)(?:\[\d+\])?:\s+(.*)$`)
 )
 
+// parseSyslogLine parses a line from a syslog file. ref is used to guess
+// the year for timestamps that do not have one: The Record is assumed to be
+// from within the year before ref.
+func parseSyslogLine(line string, ref time.Time) (model.Record, error) {
+	var (
+		err error
+		rec model.Record
+		m   []string
+	)
+
+	if m = mpat.FindStringSubmatch(line); m != nil {
+		if rec.Time, err = time.ParseInLocation("Jan _2 15:04:05", m[1], ref.Location()); err != nil {
+			return rec, err
+		}
+
+		rec.Time = rec.Time.AddDate(ref.Year(), 0, 0)
+		if rec.Time.After(ref.Add(time.Hour * 24)) {
+			rec.Time = rec.Time.AddDate(-1, 0, 0)
+		}
+	} else if m = ipat.FindStringSubmatch(line); m != nil {
+		if rec.Time, err = time.Parse(time.RFC3339Nano, m[1]); err != nil {
+			return rec, err
+		}
+	} else {
+		return rec, fmt.Errorf("Failed to parse line: %s", line)
+	}
+
+	var source = spat.FindStringSubmatch(m[3])
+	if source == nil {
+		rec.Source = m[2]
+		rec.Message = m[3]
+	} else {
+		rec.Source = source[1]
+		rec.Message = source[2]
+	}
+
+	return rec, nil
+} // func parseSyslogLine(line string, ref time.Time) (model.Record, error)
+
 func init() {
 	if runtime.GOOS != "linux" {
 		DefaultOpener = CreateSyslogReader
@@ -71,13 +163,12 @@ func (r *SyslogReader) Init() error {
 	)
 
 	for idx := range r.files {
-		if r.files[idx].fh, err = os.Open(r.files[idx].path); err != nil {
+		if err = r.files[idx].open(); err != nil {
 			r.log.Printf("[ERROR] Failed to open %s: %s\n",
 				r.files[idx].path,
 				err.Error())
 			for i := 0; i < idx; i++ {
-				r.files[idx].fh.Close() // nolint: errcheck
-				r.files[idx].fh = nil
+				r.files[i].close() // nolint: errcheck
 			}
 			return err
 		}
@@ -89,8 +180,7 @@ func (r *SyslogReader) Init() error {
 // Close closes all the opened logfiles.
 func (r *SyslogReader) Close() error {
 	for idx := range r.files {
-		r.files[idx].fh.Close() // nolint: errcheck
-		r.files[idx].fh = nil
+		r.files[idx].close() // nolint: errcheck
 	}
 
 	return nil
@@ -101,8 +191,9 @@ func (r *SyslogReader) IsError() (bool, error) {
 	return (r.err != nil), r.err
 } // func (r *JournaldReader) IsError() (bool, error)
 
-// ReadFrom reads Journal entries beginning a the given time stamp.
+// ReadFrom reads log entries beginning a the given time stamp.
 // Records are fed to the channel passed as the second argument.
+// At most max Records are read from each file, unless max is 0.
 // Upon returning, the method will close the channel.
 func (r *SyslogReader) ReadFrom(begin time.Time, max int, queue chan<- model.Record) {
 	defer close(queue)
@@ -119,48 +210,37 @@ func (r *SyslogReader) ReadFrom(begin time.Time, max int, queue chan<- model.Rec
 
 		r.log.Printf("[TRACE] Reading from %s\n", lf.path)
 
-		sc = bufio.NewScanner(lf.fh)
+		sc = bufio.NewScanner(lf.rd)
 
 		for sc.Scan() {
 			var (
 				line = sc.Text()
 				rec  model.Record
-				m    []string
 			)
 
-			if m = mpat.FindStringSubmatch(line); m != nil {
-				// parse timestamp
-				if rec.Time, err = time.Parse("Jan  2 15:04:05", m[1]); err != nil {
-					r.log.Printf("[ERROR] Cannot parse timestamp %q: %s\n",
-						m[1],
-						err.Error())
-					continue
-				} else if rec.Time.Before(begin) {
-					r.log.Printf("[TRACE] Record timestamp is too old: %s < %s\n",
-						rec.Time.Format(common.TimestampFormat),
-						begin.Format(common.TimestampFormat))
-					continue
-				}
-
-				var source = spat.FindStringSubmatch(m[3])
-				if source == nil {
-					rec.Source = m[2]
-					rec.Message = m[3]
-				} else {
-					rec.Source = source[1]
-					rec.Message = source[2]
-				}
-
-				queue <- rec
-				if cnt++; cnt >= max {
-					break
-				}
-			} else {
-				r.log.Printf("[TRACE] Failed to parse line: %s\n",
-					line)
+			if rec, err = parseSyslogLine(line, lf.ref); err != nil {
+				r.log.Printf("[TRACE] %s\n", err.Error())
+				continue
+			} else if rec.Time.Before(begin) {
+				r.log.Printf("[TRACE] Record timestamp is too old: %s < %s\n",
+					rec.Time.Format(common.TimestampFormat),
+					begin.Format(common.TimestampFormat))
+				continue
+			}
+
+			queue <- rec
+			if cnt++; max > 0 && cnt >= max {
+				break
 			}
 		}
 
+		if err = sc.Err(); err != nil {
+			r.log.Printf("[ERROR] Failed to read from %s: %s\n",
+				lf.path,
+				err.Error())
+			r.err = err
+		}
+
 		r.log.Printf("[TRACE] Read %d records from %s\n",
 			cnt,
 			lf.path)
@@ -0,0 +1,225 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/logreader/reader_journal_export.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 23. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-23 18:02:17 krylon>
+
+package logreader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// maxJournalFieldSize is the largest binary field we are willing to read.
+// journald itself limits entries to a lot less than that by default.
+const maxJournalFieldSize = 64 * 1024 * 1024
+
+// JournalExportReader reads files in the Journal Export Format, as produced
+// by "journalctl -o export". Unlike the JournaldReader, it does not need
+// access to the journal itself, so it works on any platform, and it can
+// read logs copied from other machines.
+type JournalExportReader struct {
+	log   *log.Logger
+	err   error
+	files []logfile
+}
+
+// CreateJournalExportReader creates a JournalExportReader that reads the
+// given files.
+func CreateJournalExportReader(path ...string) (LogReader, error) {
+	var (
+		err error
+		rdr = &JournalExportReader{}
+	)
+
+	if rdr.log, err = common.GetLogger(logdomain.LogReader); err != nil {
+		return nil, err
+	}
+
+	rdr.files = make([]logfile, len(path))
+
+	for idx, logpath := range path {
+		rdr.files[idx].path = logpath
+	}
+
+	return rdr, nil
+} // func CreateJournalExportReader(path ...string) (LogReader, error)
+
+// Init opens the files.
+func (r *JournalExportReader) Init() error {
+	var err error
+
+	for idx := range r.files {
+		if err = r.files[idx].open(); err != nil {
+			r.log.Printf("[ERROR] Failed to open %s: %s\n",
+				r.files[idx].path,
+				err.Error())
+			for i := 0; i < idx; i++ {
+				r.files[i].close() // nolint: errcheck
+			}
+			return err
+		}
+	}
+
+	return nil
+} // func (r *JournalExportReader) Init() error
+
+// Close closes the files.
+func (r *JournalExportReader) Close() error {
+	for idx := range r.files {
+		r.files[idx].close() // nolint: errcheck
+	}
+
+	return nil
+} // func (r *JournalExportReader) Close() error
+
+// IsError returns the Reader's error state
+func (r *JournalExportReader) IsError() (bool, error) {
+	return r.err != nil, r.err
+} // func (r *JournalExportReader) IsError() (bool, error)
+
+// ReadFrom reads journal entries beginning at the given time stamp.
+// Records are fed to the channel passed as the second argument.
+// At most max Records are read from each file, unless max is 0.
+// Upon returning, the method will close the channel.
+func (r *JournalExportReader) ReadFrom(begin time.Time, max int, queue chan<- model.Record) {
+	defer close(queue)
+
+	for _, lf := range r.files {
+		var (
+			err   error
+			cnt   int
+			rec   model.Record
+			ok    bool
+			input = bufio.NewReader(lf.rd)
+		)
+
+		r.log.Printf("[TRACE] Reading from %s\n", lf.path)
+
+		for {
+			if rec, ok, err = readJournalEntry(input); err != nil {
+				if !errors.Is(err, io.EOF) {
+					r.log.Printf("[ERROR] Failed to read from %s: %s\n",
+						lf.path,
+						err.Error())
+					r.err = err
+				}
+				break
+			} else if !ok || rec.Time.Before(begin) {
+				continue
+			}
+
+			queue <- rec
+			if cnt++; max > 0 && cnt >= max {
+				break
+			}
+		}
+
+		r.log.Printf("[TRACE] Read %d records from %s\n",
+			cnt,
+			lf.path)
+	}
+} // func (r *JournalExportReader) ReadFrom(begin time.Time, max int, queue chan<- model.Record)
+
+// readJournalEntry reads the next entry from the input. If the entry lacks
+// a timestamp or a message, ok is false. At the end of the input, the
+// error is io.EOF.
+//
+// Most fields are of the form NAME=value, terminated by a newline. Fields
+// containing binary data or newlines consist of the name and a newline,
+// followed by the length of the value as a 64-bit little endian integer,
+// the value itself, and a newline. Entries are separated by an empty line.
+func readJournalEntry(input *bufio.Reader) (rec model.Record, ok bool, err error) {
+	var (
+		line   []byte
+		fields = make(map[string]string)
+	)
+
+	for {
+		if line, err = input.ReadBytes('\n'); err != nil {
+			if errors.Is(err, io.EOF) && len(fields) > 0 {
+				// Be lenient if the last entry is not terminated
+				// properly.
+				err = nil
+				break
+			}
+			return rec, false, err
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+
+		if len(line) == 0 {
+			if len(fields) == 0 {
+				continue
+			}
+			break
+		} else if idx := bytes.IndexByte(line, '='); idx >= 0 {
+			fields[string(line[:idx])] = string(line[idx+1:])
+			continue
+		}
+
+		var (
+			size  uint64
+			value []byte
+		)
+
+		if err = binary.Read(input, binary.LittleEndian, &size); err != nil {
+			return rec, false, fmt.Errorf("Failed to read size of field %s: %w",
+				line,
+				err)
+		} else if size > maxJournalFieldSize {
+			return rec, false, fmt.Errorf("Field %s is too large: %d bytes",
+				line,
+				size)
+		}
+
+		value = make([]byte, size+1)
+
+		if _, err = io.ReadFull(input, value); err != nil {
+			return rec, false, fmt.Errorf("Failed to read value of field %s: %w",
+				line,
+				err)
+		}
+
+		fields[string(line)] = string(value[:size])
+	}
+
+	var (
+		usec  int64
+		stamp = fields["__REALTIME_TIMESTAMP"]
+	)
+
+	if stamp == "" || fields["MESSAGE"] == "" {
+		return rec, false, nil
+	} else if usec, err = strconv.ParseInt(stamp, 10, 64); err != nil {
+		return rec, false, fmt.Errorf("Invalid timestamp %q: %w",
+			stamp,
+			err)
+	}
+
+	// The JournaldReader uses _COMM as the source, so we do the same, to
+	// make Records from an export look the same as those sent by the Agent.
+	rec = model.Record{
+		Time:    time.Unix(usec/1_000_000, 0),
+		Source:  fields["_COMM"],
+		Message: fields["MESSAGE"],
+	}
+
+	if rec.Source == "" {
+		rec.Source = fields["SYSLOG_IDENTIFIER"]
+	}
+
+	return rec, true, nil
+} // func readJournalEntry(input *bufio.Reader) (rec model.Record, ok bool, err error)
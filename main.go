@@ -2,23 +2,35 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 15. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 20:19:43 krylon>
+// Time-stamp: <2024-09-29 18:10:44 krylon>
 
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/blicero/scrollmaster/agent"
 	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/common/path"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/database/postgres"
+	"github.com/blicero/scrollmaster/export"
+	"github.com/blicero/scrollmaster/importer"
+	"github.com/blicero/scrollmaster/model"
 	"github.com/blicero/scrollmaster/server"
 )
 
 func main() {
-	fmt.Printf("%s %s, built on %s\n",
+	// The banner goes to stderr, so it does not end up in exports written
+	// to stdout.
+	fmt.Fprintf(os.Stderr,
+		"%s %s, built on %s\n",
 		common.AppName,
 		common.Version,
 		common.BuildStamp.Format(common.TimestampFormat))
@@ -30,7 +42,15 @@ func main() {
 		addr     string
 		mode     string
 		basePath string
+		partSize string
+		pgDSN    string
 		port     int
+		compress bool
+		format   string
+		query    string
+		searchID int64
+		hostname string
+		fileType string
 	)
 
 	flag.StringVar(
@@ -54,9 +74,61 @@ func main() {
 		common.BaseDir,
 		"The base directory to store application-specific files",
 	)
+	flag.StringVar(
+		&partSize,
+		"partition",
+		"month",
+		"The period of time covered by one partition of the log database (month or day)")
+	flag.StringVar(
+		&pgDSN,
+		"postgres",
+		"",
+		"Connection string of a PostgreSQL database to use instead of SQLite")
+	flag.BoolVar(
+		&compress,
+		"compress",
+		false,
+		"Compress backups and exports with gzip")
+	flag.StringVar(
+		&format,
+		"format",
+		"ndjson",
+		"The file format of exports (ndjson or csv)")
+	flag.StringVar(
+		&query,
+		"query",
+		"{}",
+		"The search query selecting the Records to export, either in the query language or as JSON")
+	flag.Int64Var(
+		&searchID,
+		"search",
+		0,
+		"Export the results of the saved search with this ID instead of a query")
+	flag.StringVar(
+		&hostname,
+		"host",
+		"",
+		"The host imported log files come from")
+	flag.StringVar(
+		&fileType,
+		"type",
+		"auto",
+		"The type of imported log files (auto, syslog, journal, ndjson, or csv)")
+	flag.DurationVar(
+		&server.SearchKeep,
+		"keepsearches",
+		server.SearchKeep,
+		"How long the server keeps the results of searches; unnamed searches are deleted after that")
 
 	flag.Parse()
 
+	if database.PartitionSize, err = database.ParsePartitionInterval(partSize); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	} else if pgDSN != "" {
+		database.DefaultOpener = postgres.Opener(pgDSN)
+	}
+
 	if basePath != common.BaseDir {
 		if err = common.SetBaseDir(basePath); err != nil {
 			fmt.Fprintf(
@@ -85,10 +157,22 @@ func main() {
 	case "agent":
 		// Show some agency
 		runAgent(addr, port)
+	case "admin":
+		if pgDSN != "" {
+			fmt.Fprintln(
+				os.Stderr,
+				"Backup and restore of PostgreSQL databases are not supported, use pg_dump and pg_restore instead")
+			os.Exit(1)
+		}
+		runAdmin(flag.Args(), compress)
+	case "export":
+		runExport(flag.Args(), format, compress, query, searchID)
+	case "import":
+		runImport(flag.Args(), hostname, fileType)
 	default:
 		fmt.Fprintf(
 			os.Stderr,
-			"Invalid mode %q (must be either \"agent\" or \"server\")\n",
+			"Invalid mode %q (must be one of \"agent\", \"server\", \"admin\", \"export\", or \"import\")\n",
 			mode)
 		os.Exit(1)
 	}
@@ -137,3 +221,269 @@ func runAgent(addr string, port int) {
 
 	ag.Run()
 } // func runAgent(addr string, port int)
+
+// runAdmin performs administrative tasks on the database:
+//
+//	backup [FILE]	Write a snapshot of the database to FILE, or to stdout if FILE is "-"
+//	restore FILE	Replace the database with the snapshot in FILE
+//
+// Backups can be made while the server is running, restore requires the
+// server to be stopped.
+func runAdmin(args []string, compress bool) {
+	if len(args) == 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"Admin mode requires a command: backup [FILE] or restore FILE")
+		os.Exit(1)
+	}
+
+	var (
+		err    error
+		dbPath = common.Path(path.Database)
+	)
+
+	switch args[0] {
+	case "backup":
+		var (
+			db    *database.Database
+			fh    *os.File
+			fname = database.SnapshotName(time.Now(), compress)
+		)
+
+		if len(args) > 1 {
+			fname = args[1]
+		}
+
+		if db, err = database.Open(dbPath); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Cannot open database %s: %s\n",
+				dbPath,
+				err.Error())
+			os.Exit(2)
+		}
+
+		defer db.Close() // nolint: errcheck
+
+		if fname == "-" {
+			fh = os.Stdout
+		} else if fh, err = os.Create(fname); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Cannot create %s: %s\n",
+				fname,
+				err.Error())
+			os.Exit(2)
+		} else {
+			defer fh.Close() // nolint: errcheck
+		}
+
+		if err = db.Backup(fh, compress); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Failed to create backup: %s\n",
+				err.Error())
+			os.Exit(2)
+		} else if fh != os.Stdout {
+			fmt.Printf("Wrote backup to %s\n", fname)
+		}
+	case "restore":
+		var fh *os.File
+
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "restore requires the path of a snapshot")
+			os.Exit(1)
+		} else if fh, err = os.Open(args[1]); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Cannot open %s: %s\n",
+				args[1],
+				err.Error())
+			os.Exit(2)
+		}
+
+		defer fh.Close() // nolint: errcheck
+
+		if err = database.Restore(fh, dbPath); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Failed to restore database from %s: %s\n",
+				args[1],
+				err.Error())
+			os.Exit(2)
+		}
+
+		fmt.Printf("Restored database from %s\n", args[1])
+	default:
+		fmt.Fprintf(
+			os.Stderr,
+			"Unknown admin command %q\n",
+			args[0])
+		os.Exit(1)
+	}
+} // func runAdmin(args []string, compress bool)
+
+// runExport writes Records to the file given in args, or to stdout if there
+// is none. The Records are either the results of a saved Search, if
+// searchID is not 0, or the Records matching query.
+func runExport(args []string, format string, compress bool, query string, searchID int64) {
+	var (
+		err   error
+		f     export.Format
+		q     model.SearchQuery
+		db    database.Storage
+		hosts map[int64]string
+		ew    *export.Writer
+		out   = os.Stdout
+	)
+
+	if !strings.HasPrefix(strings.TrimSpace(query), "{") {
+		// Not JSON, so it must be the query language.
+		q.Query = query
+		query = "{}"
+	}
+
+	if f, err = export.ParseFormat(format); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	} else if err = json.Unmarshal([]byte(query), &q); err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Cannot parse query %q: %s\n",
+			query,
+			err.Error())
+		os.Exit(1)
+	} else if db, err = database.DefaultOpener(); err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Cannot open database: %s\n",
+			err.Error())
+		os.Exit(2)
+	}
+
+	defer db.Close() // nolint: errcheck
+
+	if len(args) > 0 && args[0] != "-" {
+		if out, err = os.Create(args[0]); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Cannot create %s: %s\n",
+				args[0],
+				err.Error())
+			os.Exit(2)
+		}
+
+		defer out.Close() // nolint: errcheck
+	}
+
+	if hosts, err = export.HostNames(db); err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Cannot load Hosts: %s\n",
+			err.Error())
+		os.Exit(2)
+	}
+
+	ew = export.NewWriter(out, f, compress, hosts)
+
+	if searchID != 0 {
+		err = export.Search(db, searchID, ew)
+	} else {
+		err = export.Query(context.Background(), db, &q, ew)
+	}
+
+	if err == nil {
+		err = ew.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Export failed after %d Records: %s\n",
+			ew.Count(),
+			err.Error())
+		os.Exit(2)
+	} else if out != os.Stdout {
+		fmt.Printf("Exported %d Records to %s\n",
+			ew.Count(),
+			args[0])
+	}
+} // func runExport(args []string, format string, compress bool, query string, searchID int64)
+
+func runImport(args []string, hostname, fileType string) {
+	var (
+		err   error
+		typ   importer.Type
+		db    database.Storage
+		imp   *importer.Importer
+		total importer.Stats
+	)
+
+	if len(args) == 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"Import mode requires at least one file to import")
+		os.Exit(1)
+	} else if hostname == "" {
+		fmt.Fprintln(
+			os.Stderr,
+			"Import mode requires the name of the host the files come from (-host)")
+		os.Exit(1)
+	} else if typ, err = importer.ParseType(fileType); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	} else if db, err = database.DefaultOpener(); err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Cannot open database: %s\n",
+			err.Error())
+		os.Exit(2)
+	}
+
+	defer db.Close() // nolint: errcheck
+
+	if imp, err = importer.New(db, hostname); err != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Cannot prepare import for %s: %s\n",
+			hostname,
+			err.Error())
+		os.Exit(2)
+	}
+
+	imp.Progress = func(path string, s importer.Stats) {
+		fmt.Fprintf(os.Stderr,
+			"\r%s: %d read, %d added, %d duplicates",
+			path,
+			s.Read,
+			s.Added,
+			s.Duplicates)
+	}
+
+	for _, path := range args {
+		var stats importer.Stats
+
+		stats, err = imp.ImportFile(path, typ)
+		fmt.Fprintln(os.Stderr)
+
+		total.Read += stats.Read
+		total.Added += stats.Added
+		total.Duplicates += stats.Duplicates
+
+		if err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"Import of %s failed: %s\n",
+				path,
+				err.Error())
+			os.Exit(2)
+		}
+	}
+
+	fmt.Printf("Imported %d of %d Records from %d files for %s (%d duplicates)\n",
+		total.Added,
+		total.Read,
+		len(args),
+		hostname,
+		total.Duplicates)
+} // func runImport(args []string, hostname, fileType string)
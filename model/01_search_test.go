@@ -2,17 +2,24 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 09. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-10 19:21:17 krylon>
+// Time-stamp: <2024-09-25 19:30:08 krylon>
 
 package model
 
 import (
 	"encoding/json"
+	"regexp"
 	"slices"
 	"testing"
 	"time"
 )
 
+func termsEqual(t1, t2 []*regexp.Regexp) bool {
+	return slices.EqualFunc(t1, t2, func(a, b *regexp.Regexp) bool {
+		return a.String() == b.String()
+	})
+} // func termsEqual(t1, t2 []*regexp.Regexp) bool
+
 func qEqual(q1, q2 SearchQuery) bool {
 	if !slices.Equal(q1.Hosts, q2.Hosts) {
 		return false
@@ -22,9 +29,13 @@ func qEqual(q1, q2 SearchQuery) bool {
 		return false
 	} else if len(q1.Period) == 2 && (!q1.Period[0].Equal(q2.Period[0]) || !q1.Period[1].Equal(q2.Period[1])) {
 		return false
+	} else if !termsEqual(q1.Terms, q2.Terms) ||
+		!termsEqual(q1.TermsAll, q2.TermsAll) ||
+		!termsEqual(q1.TermsExclude, q2.TermsExclude) {
+		return false
 	}
 
-	return true
+	return q1.Query == q2.Query
 } // func qEqual(q1, q2 model.SearchQuery) bool
 
 func TestSearchSerialize(t *testing.T) {
@@ -44,6 +55,14 @@ func TestSearchSerialize(t *testing.T) {
 				},
 			},
 		},
+		{
+			q: SearchQuery{
+				Terms:        []*regexp.Regexp{regexp.MustCompile("(?i)sshd")},
+				TermsAll:     []*regexp.Regexp{regexp.MustCompile("fail"), regexp.MustCompile(`\broot\b`)},
+				TermsExclude: []*regexp.Regexp{regexp.MustCompile("^Accepted")},
+				Query:        "host:web*",
+			},
+		},
 	}
 
 	for _, c := range testCases {
@@ -72,3 +91,75 @@ func TestSearchSerialize(t *testing.T) {
 		}
 	}
 } // func TestSearchSerialize(t *testing.T)
+
+// TestSearchLegacy checks that queries saved before there were TermsAll and
+// TermsExclude can still be loaded.
+func TestSearchLegacy(t *testing.T) {
+	const legacy = `{"hosts":[1],"sources":[],"period":[],"terms":["(?i)error"]}`
+	var (
+		err error
+		q   SearchQuery
+	)
+
+	if err = json.Unmarshal([]byte(legacy), &q); err != nil {
+		t.Fatalf("Cannot parse legacy query: %s", err.Error())
+	} else if len(q.Terms) != 1 || q.Terms[0].String() != "(?i)error" {
+		t.Errorf("Unexpected Terms in legacy query: %v", q.Terms)
+	} else if q.TermsAll != nil || q.TermsExclude != nil {
+		t.Errorf("Legacy query should not have TermsAll or TermsExclude: %v / %v",
+			q.TermsAll,
+			q.TermsExclude)
+	}
+} // func TestSearchLegacy(t *testing.T)
+
+func TestSearchMatchTerms(t *testing.T) {
+	var (
+		records = []Record{
+			{ID: 1, Message: "Failed password for root from 10.0.0.1"},
+			{ID: 2, Message: "Failed password for krylon from 10.0.0.1"},
+			{ID: 3, Message: "Accepted password for root from 10.0.0.1"},
+			{ID: 4, Message: "Connection closed by 10.0.0.2"},
+		}
+		re = func(pat ...string) []*regexp.Regexp {
+			var list = make([]*regexp.Regexp, len(pat))
+			for i, p := range pat {
+				list[i] = regexp.MustCompile(p)
+			}
+			return list
+		}
+	)
+
+	type testCase struct {
+		q        SearchQuery
+		expected []int64
+	}
+
+	var cases = []testCase{
+		{SearchQuery{}, []int64{1, 2, 3, 4}},
+		{SearchQuery{Terms: re("root", "closed")}, []int64{1, 3, 4}},
+		{SearchQuery{TermsAll: re("password", "root")}, []int64{1, 3}},
+		{SearchQuery{TermsExclude: re("^Accepted", "krylon")}, []int64{1, 4}},
+		{
+			SearchQuery{
+				Terms:        re("10\\.0\\.0\\.1"),
+				TermsAll:     re("password"),
+				TermsExclude: re("^Failed"),
+			},
+			[]int64{3},
+		},
+	}
+
+	for _, c := range cases {
+		var matches []int64
+
+		for i := range records {
+			if c.q.Match(&records[i]) {
+				matches = append(matches, records[i].ID)
+			}
+		}
+
+		if !slices.Equal(matches, c.expected) {
+			t.Errorf("Query matched %v, expected %v", matches, c.expected)
+		}
+	}
+} // func TestSearchMatchTerms(t *testing.T)
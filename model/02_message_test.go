@@ -0,0 +1,67 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/02_message_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 20. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-20 17:55:09 krylon>
+
+package model
+
+import "testing"
+
+func TestMessageSplit(t *testing.T) {
+	type testCase struct {
+		msg    string
+		tmpl   string
+		params int
+	}
+
+	var testCases = []testCase{
+		{
+			msg:    "Accepted publickey for root from 192.168.0.23 port 51234 ssh2",
+			tmpl:   "Accepted publickey for root from \x1f port \x1f ssh2",
+			params: 2,
+		},
+		{
+			msg:    "Started Session 4711 of User krylon.",
+			tmpl:   "Started Session \x1f of User krylon.",
+			params: 1,
+		},
+		{
+			msg:  "Reached target Multi-User System.",
+			tmpl: "Reached target Multi-User System.",
+		},
+		{
+			msg:    "usb 1-1.4: new device 0xdeadbeef uuid 123e4567-e89b-12d3-a456-426614174000",
+			tmpl:   "usb \x1f-\x1f: new device \x1f uuid \x1f",
+			params: 4,
+		},
+		{
+			msg:  "Weird \x1f message 42",
+			tmpl: "Weird \x1f message 42",
+		},
+		{
+			msg: "",
+		},
+	}
+
+	for _, c := range testCases {
+		var tmpl, params = SplitMessage(c.msg)
+
+		if tmpl != c.tmpl {
+			t.Errorf("Unexpected template for %q: %q (expected %q)",
+				c.msg,
+				tmpl,
+				c.tmpl)
+		} else if len(params) != c.params {
+			t.Errorf("Unexpected number of parameters for %q: %d (expected %d) - %v",
+				c.msg,
+				len(params),
+				c.params,
+				params)
+		} else if msg := JoinMessage(tmpl, params); msg != c.msg {
+			t.Errorf("Joining template and parameters did not restore the message: %q (expected %q)",
+				msg,
+				c.msg)
+		}
+	}
+} // func TestMessageSplit(t *testing.T)
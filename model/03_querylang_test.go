@@ -0,0 +1,233 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/03_querylang_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 24. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:06:30 krylon>
+
+package model
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	qlNow   = time.Date(2024, 9, 24, 12, 0, 0, 0, time.UTC)
+	qlHosts = []Host{
+		{ID: 1, Name: "web01.example.com"},
+		{ID: 2, Name: "web02.example.com"},
+		{ID: 3, Name: "db01.example.com"},
+	}
+	qlRecords = []Record{
+		{ID: 1, HostID: 1, Time: qlNow.Add(-30 * time.Minute), Source: "sshd", Message: "Accepted publickey for krylon"},
+		{ID: 2, HostID: 1, Time: qlNow.Add(-60 * time.Minute), Source: "sshd", Message: "Failed password for root"},
+		{ID: 3, HostID: 2, Time: qlNow.Add(-5 * time.Hour), Source: "sshd", Message: "Connection closed by 10.0.0.1"},
+		{ID: 4, HostID: 3, Time: qlNow.Add(-10 * time.Minute), Source: "postgres", Message: "checkpoint starting: time"},
+		{ID: 5, HostID: 3, Time: qlNow.Add(-3 * 24 * time.Hour), Source: "kernel", Message: "Out of memory: Killed process 4711"},
+		{ID: 6, HostID: 2, Time: qlNow.Add(-20 * time.Minute), Source: "nginx", Message: "upstream timed out while reading response"},
+	}
+	qlTagged = map[string][]int64{
+		"intrusion":  {2},
+		"disk-full":  {4},
+		"disk-error": {5},
+		"oom":        {5},
+	}
+)
+
+func TestQueryMatch(t *testing.T) {
+	type testCase struct {
+		query    string
+		expected []int64
+	}
+
+	var cases = []testCase{
+		{`sshd AND NOT "Accepted" host:web* since:2h`, []int64{2}},
+		{`sshd -accepted`, []int64{2, 3}},
+		{`sshd`, []int64{1, 2, 3}},
+		{`host:db01`, []int64{4, 5}},
+		{`host:WEB02.example.com`, []int64{3, 6}},
+		{`source:ssh*`, []int64{1, 2, 3}},
+		{`source:kernel OR source:nginx`, []int64{5, 6}},
+		{`severity>=warning`, []int64{2, 5, 6}},
+		{`severity>=error`, []int64{2, 5}},
+		{`sev:critical`, []int64{5}},
+		{`severity<info`, nil},
+		{`since:1h`, []int64{1, 2, 4, 6}},
+		{`until:1d`, []int64{5}},
+		{`since:2024-09-21 until:2024-09-22`, []int64{5}},
+		{`/\d+\.\d+\.\d+\.\d+/`, []int64{3}},
+		{`message:/^check/`, []int64{4}},
+		{`message:sshd`, nil},
+		{`(sshd OR nginx) AND (password OR upstream)`, []int64{2, 6}},
+		{`NOT (sshd OR nginx)`, []int64{4, 5}},
+		{`"timed out"`, []int64{6}},
+		{`checkpoint starting:`, []int64{4}},
+		{`xyzzy OR sshd AND password`, []int64{2}},
+		{`tag:oom`, []int64{5}},
+		{`tag:disk*`, []int64{4, 5}},
+		{`tag:Intrusion OR tag:oom`, []int64{2, 5}},
+		{`sshd -tag:intrusion`, []int64{1, 3}},
+		{`tag:unknown`, nil},
+	}
+
+	for _, c := range cases {
+		var (
+			err     error
+			expr    QueryExpr
+			matches []int64
+		)
+
+		if expr, err = ParseQuery(c.query, qlNow); err != nil {
+			t.Errorf("Cannot parse query %q: %s", c.query, err.Error())
+			continue
+		}
+
+		BindHosts(expr, qlHosts)
+		BindTags(expr, qlTagged)
+
+		for i := range qlRecords {
+			if expr.Match(&qlRecords[i]) {
+				matches = append(matches, qlRecords[i].ID)
+			}
+		}
+
+		if !slices.Equal(matches, c.expected) {
+			t.Errorf("Query %q (%s) matched %v, expected %v",
+				c.query,
+				expr,
+				matches,
+				c.expected)
+		}
+	}
+} // func TestQueryMatch(t *testing.T)
+
+func TestQuerySyntaxError(t *testing.T) {
+	var queries = []string{
+		`"unterminated`,
+		`/unterminated`,
+		`(sshd OR nginx`,
+		`sshd)`,
+		`sshd AND`,
+		`OR sshd`,
+		`NOT`,
+		`severity>=bogus`,
+		`since:yesteryear`,
+		`color>=red`,
+		`host>=web`,
+		`/[/`,
+		`source:`,
+		`tag:`,
+	}
+
+	for _, q := range queries {
+		var (
+			err  error
+			serr *QuerySyntaxError
+		)
+
+		if _, err = ParseQuery(q, qlNow); err == nil {
+			t.Errorf("Query %q should not parse", q)
+		} else if !errors.As(err, &serr) {
+			t.Errorf("Error for query %q is not a QuerySyntaxError: %T",
+				q,
+				err)
+		} else if serr.Pos < 0 || serr.Pos > len(q) {
+			t.Errorf("Invalid position %d in error for query %q",
+				serr.Pos,
+				q)
+		}
+	}
+} // func TestQuerySyntaxError(t *testing.T)
+
+func TestQueryBounds(t *testing.T) {
+	var (
+		err error
+		b   SearchBounds
+		q   = SearchQuery{
+			Hosts: []int64{1, 3},
+			Query: `host:web* source:sshd since:2h (source:nginx OR until:1h)`,
+		}
+	)
+
+	if err = q.Compile(qlHosts); err != nil {
+		t.Fatalf("Cannot compile query %q: %s", q.Query, err.Error())
+	}
+
+	b = q.Bounds()
+
+	if !slices.Equal(b.Hosts, []int64{1}) {
+		t.Errorf("Unexpected Hosts in bounds: %v", b.Hosts)
+	} else if !slices.Equal(b.Sources, []string{"sshd"}) {
+		t.Errorf("Unexpected sources in bounds: %v", b.Sources)
+	} else if b.Begin.IsZero() || !b.End.IsZero() {
+		t.Errorf("Unexpected period in bounds: %s - %s", b.Begin, b.End)
+	}
+} // func TestQueryBounds(t *testing.T)
+
+func TestQueryTags(t *testing.T) {
+	var (
+		err     error
+		matches []int64
+		q       = SearchQuery{
+			Tags:  []string{"oom", "intrusion"},
+			Query: `NOT tag:disk*`,
+		}
+	)
+
+	if err = q.Compile(qlHosts); err != nil {
+		t.Fatalf("Cannot compile query %q: %s", q.Query, err.Error())
+	} else if !q.UsesTags() {
+		t.Fatalf("SearchQuery with Tags claims not to use them")
+	}
+
+	q.BindTags(qlTagged)
+
+	for i := range qlRecords {
+		if q.Match(&qlRecords[i]) {
+			matches = append(matches, qlRecords[i].ID)
+		}
+	}
+
+	if !slices.Equal(matches, []int64{2}) {
+		t.Errorf("SearchQuery matched %v, expected [2]", matches)
+	}
+
+	for name, valid := range map[string]bool{
+		" Disk-Full ":  true,
+		"needs.review": true,
+		"":             false,
+		"two words":    false,
+		"disk*":        false,
+		`"quoted"`:     false,
+	} {
+		if _, err = NormalizeTag(name); (err == nil) != valid {
+			t.Errorf("NormalizeTag(%q) returned error %v", name, err)
+		}
+	}
+} // func TestQueryTags(t *testing.T)
+
+func TestQueryLive(t *testing.T) {
+	for query, live := range map[string]bool{
+		"sshd host:web*":          true,
+		"severity>=err OR /oom/i": true,
+		"sshd since:2h":           false,
+		"NOT until:2024-09-01":    false,
+		"error OR tag:disk*":      false,
+	} {
+		var q = SearchQuery{Query: query}
+
+		if err := q.Compile(qlHosts); err != nil {
+			t.Fatalf("Cannot compile query %q: %s", query, err.Error())
+		} else if err = q.CheckLive(); (err == nil) != live {
+			t.Errorf("CheckLive(%q) returned error %v", query, err)
+		}
+	}
+
+	var q = SearchQuery{Tags: []string{"oom"}}
+
+	if err := q.CheckLive(); err == nil {
+		t.Errorf("CheckLive accepted a SearchQuery with Tags")
+	}
+} // func TestQueryLive(t *testing.T)
@@ -0,0 +1,93 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/04_aggregate_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 28. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-28 18:15:50 krylon>
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAggregates(t *testing.T) {
+	var (
+		agg Aggregator
+		a   *Aggregates
+	)
+
+	for i := range qlRecords {
+		agg.Add(&qlRecords[i])
+	}
+
+	a = agg.Aggregates()
+
+	// The Records span three days, so we expect buckets of three hours.
+	if a.BucketSize != 3*3600 {
+		t.Errorf("Unexpected bucket size: %d", a.BucketSize)
+	} else if len(a.Histogram) > MaxBuckets {
+		t.Errorf("Too many buckets: %d", len(a.Histogram))
+	}
+
+	var total int64
+
+	for i, b := range a.Histogram {
+		total += b.Count
+
+		if i > 0 && !b.Begin.Equal(a.BucketEnd(a.Histogram[i-1])) {
+			t.Errorf("Bucket %d begins at %s, expected %s",
+				i,
+				b.Begin,
+				a.BucketEnd(a.Histogram[i-1]))
+		}
+	}
+
+	if total != int64(len(qlRecords)) {
+		t.Errorf("Histogram counts %d Records, expected %d",
+			total,
+			len(qlRecords))
+	}
+
+	if len(a.Sources) != 4 || a.Sources[0].Key != "sshd" || a.Sources[0].Count != 3 {
+		t.Errorf("Unexpected source facets: %#v", a.Sources)
+	} else if len(a.Hosts) != 3 || a.Hosts[0].Count != 2 {
+		t.Errorf("Unexpected host facets: %#v", a.Hosts)
+	} else if a.Severities[0].Key != SevCritical.String() {
+		t.Errorf("Unexpected severity facets: %#v", a.Severities)
+	}
+} // func TestAggregates(t *testing.T)
+
+func TestAggregatesLimits(t *testing.T) {
+	var (
+		agg   Aggregator
+		a     *Aggregates
+		begin = time.Date(2024, 9, 28, 12, 0, 0, 0, time.UTC)
+	)
+
+	if a = agg.Aggregates(); len(a.Histogram) != 0 || len(a.Hosts) != 0 {
+		t.Errorf("Aggregates of nothing are not empty: %#v", a)
+	}
+
+	for i := 0; i < 1000; i++ {
+		agg.Add(&Record{
+			HostID:  int64(i%20 + 1),
+			Time:    begin.Add(time.Duration(i) * time.Minute),
+			Source:  fmt.Sprintf("source%02d", i%15),
+			Message: "Nothing to see here",
+		})
+	}
+
+	a = agg.Aggregates()
+
+	if len(a.Histogram) > MaxBuckets {
+		t.Errorf("Too many buckets: %d", len(a.Histogram))
+	} else if len(a.Hosts) != MaxFacets || len(a.Sources) != MaxFacets {
+		t.Errorf("Facets were not cut off: %d Hosts, %d sources",
+			len(a.Hosts),
+			len(a.Sources))
+	} else if a.MaxBucket() == 0 {
+		t.Error("All buckets are empty")
+	}
+} // func TestAggregatesLimits(t *testing.T)
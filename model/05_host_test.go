@@ -0,0 +1,76 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/05_host_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 05. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-05 19:31:44 krylon>
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostSilent(t *testing.T) {
+	type testCase struct {
+		name   string
+		host   Host
+		silent bool
+	}
+
+	const def = time.Minute * 15
+
+	var (
+		now       = time.Now()
+		testCases = []testCase{
+			{
+				name: "recent contact, never sent Records",
+				host: Host{LastSeen: now.Add(-time.Minute)},
+			},
+			{
+				name:   "no contact",
+				host:   Host{LastSeen: now.Add(-time.Hour)},
+				silent: true,
+			},
+			{
+				name: "recent contact and Records",
+				host: Host{
+					LastSeen:   now.Add(-time.Minute),
+					LastRecord: now.Add(-time.Minute * 5),
+				},
+			},
+			{
+				name: "contact, but no new Records",
+				host: Host{
+					LastSeen:   now.Add(-time.Minute),
+					LastRecord: now.Add(-time.Hour),
+				},
+				silent: true,
+			},
+			{
+				name: "own threshold",
+				host: Host{
+					LastSeen:         now.Add(-time.Minute),
+					LastRecord:       now.Add(-time.Hour),
+					SilenceThreshold: time.Hour * 2,
+				},
+			},
+			{
+				name: "maintenance",
+				host: Host{
+					LastSeen:    now.Add(-time.Hour * 24),
+					Maintenance: true,
+				},
+			},
+		}
+	)
+
+	for _, c := range testCases {
+		if s := c.host.Silent(now, def); s != c.silent {
+			t.Errorf("Host with %s: Silent returned %t, expected %t",
+				c.name,
+				s,
+				c.silent)
+		}
+	}
+} // func TestHostSilent(t *testing.T)
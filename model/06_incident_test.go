@@ -0,0 +1,71 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/06_incident_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 14:40:18 krylon>
+
+package model
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIncidentValidate(t *testing.T) {
+	var cases = []struct {
+		inc   Incident
+		valid bool
+	}{
+		{Incident{Title: "Outage", Begin: qlNow}, true},
+		{Incident{Title: "Outage", Begin: qlNow, End: qlNow.Add(time.Hour), Status: IncidentResolved}, true},
+		{Incident{Begin: qlNow}, false},
+		{Incident{Title: "Outage"}, false},
+		{Incident{Title: "Outage", Begin: qlNow, End: qlNow.Add(-time.Hour)}, false},
+		{Incident{Title: "Outage", Begin: qlNow, Status: IncidentStatus(42)}, false},
+	}
+
+	for i, c := range cases {
+		if err := c.inc.Validate(); (err == nil) != c.valid {
+			t.Errorf("Validate returned %v for Incident #%d", err, i)
+		}
+	}
+} // func TestIncidentValidate(t *testing.T)
+
+func TestMergeTimeline(t *testing.T) {
+	var (
+		timeline []TimelineEntry
+		ids      []int64
+		inc      = &Incident{
+			Title: "Memory pressure",
+			Begin: qlNow.Add(-6 * time.Hour),
+		}
+		// The OOM kill happened before the Incident, but it was pinned,
+		// so it is on the timeline anyway.
+		pins = []Pin{
+			{RecordID: 5, HostID: 3, Time: qlRecords[4].Time, Message: qlRecords[4].Message, Note: "Started here"},
+			{RecordID: 2, HostID: 1, Time: qlRecords[1].Time, Message: qlRecords[1].Message},
+		}
+		results = map[int64][]Record{
+			7: {qlRecords[1], qlRecords[2], qlRecords[4]},
+			9: {qlRecords[0], qlRecords[1]},
+		}
+	)
+
+	timeline = MergeTimeline(inc, pins, results)
+
+	for _, e := range timeline {
+		ids = append(ids, e.Record.ID)
+	}
+
+	if !slices.Equal(ids, []int64{5, 3, 2, 1}) {
+		t.Fatalf("Unexpected timeline: %v", ids)
+	} else if timeline[0].Pin == nil || timeline[0].Pin.Note != "Started here" {
+		t.Errorf("Pinned Record lost its Note: %#v", timeline[0].Pin)
+	} else if timeline[1].Pin != nil {
+		t.Errorf("Record 3 was not pinned, but has a Pin: %#v", timeline[1].Pin)
+	} else if !slices.Equal(timeline[2].Searches, []int64{7, 9}) {
+		t.Errorf("Record 2 was found by Searches %v, expected [7 9]",
+			timeline[2].Searches)
+	}
+} // func TestMergeTimeline(t *testing.T)
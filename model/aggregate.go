@@ -0,0 +1,193 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/aggregate.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 28. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-28 16:12:40 krylon>
+
+package model
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// MaxBuckets is the largest number of buckets a histogram has.
+const MaxBuckets = 60
+
+// MaxFacets is the largest number of values a Facet list holds. The rest
+// are left out.
+const MaxFacets = 10
+
+// bucketSizes are the sizes a histogram bucket can have. We pick the
+// smallest one that gets us at most MaxBuckets buckets.
+var bucketSizes = []time.Duration{
+	time.Second,
+	time.Second * 5,
+	time.Second * 10,
+	time.Second * 30,
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 10,
+	time.Minute * 30,
+	time.Hour,
+	time.Hour * 3,
+	time.Hour * 6,
+	time.Hour * 12,
+	time.Hour * 24,
+	time.Hour * 24 * 7,
+	time.Hour * 24 * 30,
+	time.Hour * 24 * 365,
+}
+
+// Bucket is one bar in a histogram: The number of Records in the period
+// beginning at Begin.
+type Bucket struct {
+	Begin time.Time `json:"begin"`
+	Count int64     `json:"count"`
+}
+
+// Facet is a value of some attribute of Records and the number of Records
+// that have it. For Hosts, the Key is empty and ID is the ID of the Host.
+type Facet struct {
+	ID    int64  `json:"id,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// Aggregates summarize the results of a Search.
+type Aggregates struct {
+	// BucketSize is the size of the histogram buckets in seconds.
+	BucketSize int64    `json:"bucket_size"`
+	Histogram  []Bucket `json:"histogram"`
+	Hosts      []Facet  `json:"hosts"`
+	Sources    []Facet  `json:"sources"`
+	Severities []Facet  `json:"severities"`
+}
+
+// MaxBucket returns the largest count of any bucket in the histogram.
+func (a *Aggregates) MaxBucket() int64 {
+	var max int64
+
+	for _, b := range a.Histogram {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+
+	return max
+} // func (a *Aggregates) MaxBucket() int64
+
+// BucketEnd returns the end of the given bucket.
+func (a *Aggregates) BucketEnd(b Bucket) time.Time {
+	return b.Begin.Add(time.Duration(a.BucketSize) * time.Second)
+} // func (a *Aggregates) BucketEnd(b Bucket) time.Time
+
+// Aggregator collects Records to compute Aggregates from them.
+// The zero value is ready to use.
+type Aggregator struct {
+	stamps  []int64
+	hosts   map[int64]int64
+	sources map[string]int64
+	sev     [SevDebug + 1]int64
+}
+
+// Add adds a Record to the Aggregator.
+func (a *Aggregator) Add(r *Record) {
+	if a.hosts == nil {
+		a.hosts = make(map[int64]int64)
+		a.sources = make(map[string]int64)
+	}
+
+	a.stamps = append(a.stamps, r.Time.Unix())
+	a.hosts[r.HostID]++
+	a.sources[r.Source]++
+	a.sev[r.Severity()]++
+} // func (a *Aggregator) Add(r *Record)
+
+// Aggregates returns the Aggregates of the Records added so far.
+func (a *Aggregator) Aggregates() *Aggregates {
+	var agg = &Aggregates{
+		Histogram:  make([]Bucket, 0),
+		Hosts:      make([]Facet, 0, len(a.hosts)),
+		Sources:    make([]Facet, 0, len(a.sources)),
+		Severities: make([]Facet, 0, len(a.sev)),
+	}
+
+	for id, cnt := range a.hosts {
+		agg.Hosts = append(agg.Hosts, Facet{ID: id, Count: cnt})
+	}
+
+	for src, cnt := range a.sources {
+		agg.Sources = append(agg.Sources, Facet{Key: src, Count: cnt})
+	}
+
+	agg.Hosts = topFacets(agg.Hosts)
+	agg.Sources = topFacets(agg.Sources)
+
+	// Severities are not sorted by count, they have a natural order.
+	for sev, cnt := range a.sev {
+		if cnt > 0 {
+			agg.Severities = append(agg.Severities, Facet{
+				Key:   Severity(sev).String(),
+				Count: cnt,
+			})
+		}
+	}
+
+	if len(a.stamps) == 0 {
+		return agg
+	}
+
+	var (
+		min, max = slices.Min(a.stamps), slices.Max(a.stamps)
+		size     = bucketSizes[len(bucketSizes)-1]
+	)
+
+	// Aligning the first bucket to the bucket size may cost us one
+	// bucket at the end.
+	for _, s := range bucketSizes {
+		if (max-min)/int64(s.Seconds()) < MaxBuckets-1 {
+			size = s
+			break
+		}
+	}
+
+	var (
+		step  = int64(size.Seconds())
+		begin = min - min%step
+		cnt   = (max-begin)/step + 1
+	)
+
+	agg.BucketSize = step
+	agg.Histogram = make([]Bucket, cnt)
+
+	for i := range agg.Histogram {
+		agg.Histogram[i].Begin = time.Unix(begin+int64(i)*step, 0)
+	}
+
+	for _, s := range a.stamps {
+		agg.Histogram[(s-begin)/step].Count++
+	}
+
+	return agg
+} // func (a *Aggregator) Aggregates() *Aggregates
+
+// topFacets sorts a list of Facets by their count, most frequent first, and
+// cuts it off after MaxFacets.
+func topFacets(facets []Facet) []Facet {
+	slices.SortFunc(facets, func(a, b Facet) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		} else if c = cmp.Compare(a.Key, b.Key); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	if len(facets) > MaxFacets {
+		facets = facets[:MaxFacets]
+	}
+
+	return facets
+} // func topFacets(facets []Facet) []Facet
@@ -0,0 +1,167 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/alert.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 03. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:05:11 krylon>
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AlertRuleKind determines what an AlertRule watches.
+type AlertRuleKind uint8
+
+// RuleMatch rules count the Records that match their Query, RuleSilence
+// rules watch for Hosts that go silent, RuleAnomaly rules watch for Hosts
+// that log from some source at an unusual rate.
+const (
+	RuleMatch AlertRuleKind = iota
+	RuleSilence
+	RuleAnomaly
+)
+
+var alertRuleKindNames = []string{
+	"match",
+	"silence",
+	"anomaly",
+}
+
+func (k AlertRuleKind) String() string {
+	if int(k) < len(alertRuleKindNames) {
+		return alertRuleKindNames[k]
+	}
+
+	return fmt.Sprintf("AlertRuleKind(%d)", k)
+} // func (k AlertRuleKind) String() string
+
+// ParseAlertRuleKind returns the AlertRuleKind with the given name. The
+// empty string means RuleMatch.
+func ParseAlertRuleKind(s string) (AlertRuleKind, error) {
+	switch strings.ToLower(s) {
+	case "", "match":
+		return RuleMatch, nil
+	case "silence":
+		return RuleSilence, nil
+	case "anomaly":
+		return RuleAnomaly, nil
+	default:
+		return 0, fmt.Errorf("Invalid alert rule kind %q (must be match, silence, or anomaly)", s)
+	}
+} // func ParseAlertRuleKind(s string) (AlertRuleKind, error)
+
+// AlertRule describes a condition that deserves attention: More than
+// Threshold Records matching the Query within Window. If PerHost is true,
+// the Records are counted for each Host separately, otherwise for all
+// Hosts together.
+//
+// The Period of the Query is ignored, rules only ever look at Records as
+// they come in.
+//
+// Rules of the kind RuleSilence instead raise an Alert for every Host
+// that is Silent. Their Window is the threshold for Hosts that have none
+// of their own, Query, Threshold, and PerHost are ignored.
+//
+// Rules of the kind RuleAnomaly raise an Alert if more than Threshold
+// sources log at an unusual rate, as flagged by the rate package. Their
+// Query and Window are ignored.
+type AlertRule struct {
+	ID          int64
+	Name        string
+	Description string
+	Kind        AlertRuleKind
+	Query       SearchQuery
+	Threshold   int64
+	Window      time.Duration
+	PerHost     bool
+	Active      bool
+	// While a rule is silenced, Alerts are still recorded, but marked as
+	// silenced, so nobody gets bothered with them.
+	SilencedUntil time.Time
+}
+
+// Silenced returns true if the rule is silenced at the given time.
+func (r *AlertRule) Silenced(t time.Time) bool {
+	return t.Before(r.SilencedUntil)
+} // func (r *AlertRule) Silenced(t time.Time) bool
+
+// Validate checks if the rule makes sense. If the Query has been compiled,
+// it is checked to work on Records as they come in, too.
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("Alert rule has no name")
+	} else if r.Threshold < 0 {
+		return fmt.Errorf("Threshold of alert rule %q is negative: %d",
+			r.Name,
+			r.Threshold)
+	} else if r.Window < time.Second {
+		return fmt.Errorf("Window of alert rule %q is too short: %s",
+			r.Name,
+			r.Window)
+	} else if int(r.Kind) >= len(alertRuleKindNames) {
+		return fmt.Errorf("Alert rule %q has an invalid kind: %s",
+			r.Name,
+			r.Kind)
+	} else if r.Kind != RuleMatch {
+		return nil
+	} else if err := r.Query.CheckLive(); err != nil {
+		return fmt.Errorf("Query of alert rule %q does not work: %w",
+			r.Name,
+			err)
+	}
+
+	return nil
+} // func (r *AlertRule) Validate() error
+
+// AlertState is the state of an Alert.
+type AlertState uint8
+
+// An Alert is firing as long as its rule's condition holds, afterwards it
+// is resolved.
+const (
+	AlertFiring AlertState = iota
+	AlertResolved
+)
+
+var alertStateNames = []string{
+	"firing",
+	"resolved",
+}
+
+func (s AlertState) String() string {
+	if int(s) < len(alertStateNames) {
+		return alertStateNames[s]
+	}
+
+	return fmt.Sprintf("AlertState(%d)", s)
+} // func (s AlertState) String() string
+
+// Alert is raised when the condition of an AlertRule is met. As long as the
+// condition holds, no further Alerts are raised for the same rule and Host,
+// instead Count and LastSeen are updated.
+type Alert struct {
+	ID     int64
+	RuleID int64
+	// HostID is 0 if the rule counts Records from all Hosts together.
+	HostID   int64
+	Fired    time.Time
+	LastSeen time.Time
+	// Resolved is zero while the Alert is firing.
+	Resolved time.Time
+	// Count is the highest number of matching Records within the rule's
+	// Window while the Alert was firing.
+	Count    int64
+	Silenced bool
+}
+
+// State returns the state of the Alert.
+func (a *Alert) State() AlertState {
+	if a.Resolved.IsZero() {
+		return AlertFiring
+	}
+
+	return AlertResolved
+} // func (a *Alert) State() AlertState
@@ -0,0 +1,51 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/annotation.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 11. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-11 15:12:40 krylon>
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Annotation is a note the user attached to a Record, like "this is where
+// the disk failed". Time is when the note was written.
+type Annotation struct {
+	ID       int64
+	RecordID int64
+	HostID   int64
+	Time     time.Time
+	Text     string
+}
+
+// Tag is a free-form tag the user attached to a Record. Records can be
+// searched for by their Tags.
+type Tag struct {
+	RecordID int64
+	HostID   int64
+	Name     string
+	Time     time.Time
+}
+
+// NormalizeTag returns the canonical form of a tag name, which is in lower
+// case. Tag names must not contain whitespace or any of the characters the
+// query language uses for phrases, regular expressions, and grouping, so
+// they can be written as tag:NAME.
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if name == "" {
+		return "", fmt.Errorf("Tag name is empty")
+	} else if strings.IndexFunc(name, func(c rune) bool {
+		return unicode.IsSpace(c) || strings.ContainsRune(`"/()*?[]\`, c)
+	}) >= 0 {
+		return "", fmt.Errorf("Invalid tag name %q", name)
+	}
+
+	return name, nil
+} // func NormalizeTag(name string) (string, error)
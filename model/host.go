@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-09 20:34:58 krylon>
+// Time-stamp: <2024-10-05 16:40:12 krylon>
 
 package model
 
@@ -18,6 +18,16 @@ type Host struct {
 	ID       int64
 	Name     string
 	LastSeen time.Time
+	// LastRecord is when the Host last delivered new Records. It is zero
+	// if it never did.
+	LastRecord time.Time
+	// SilenceThreshold is how long the Host may go without contact or new
+	// Records before it is considered silent. If it is 0, the Window of
+	// the host silence rule applies.
+	SilenceThreshold time.Duration
+	// Maintenance is true while the Host is down for maintenance, so
+	// nobody is bothered when it goes silent.
+	Maintenance bool
 }
 
 // NameShort returns the Host's name without any domain name.
@@ -29,3 +39,23 @@ func (h *Host) NameShort() string {
 
 	return h.Name
 } // func (h *Host) NameShort() string
+
+// Silent returns true if, at the given time, the Host has had no contact
+// or delivered no new Records for longer than its SilenceThreshold, or
+// the given default if it has none. Hosts in Maintenance are never
+// silent.
+func (h *Host) Silent(now time.Time, def time.Duration) bool {
+	var threshold = h.SilenceThreshold
+
+	if h.Maintenance {
+		return false
+	} else if threshold == 0 {
+		threshold = def
+	}
+
+	if now.Sub(h.LastSeen) > threshold {
+		return true
+	}
+
+	return !h.LastRecord.IsZero() && now.Sub(h.LastRecord) > threshold
+} // func (h *Host) Silent(now time.Time, def time.Duration) bool
@@ -0,0 +1,180 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/incident.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 14:21:07 krylon>
+
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// IncidentStatus is how far the investigation of an Incident has come.
+type IncidentStatus uint8
+
+// An Incident is open while it is being investigated, mitigated once the
+// damage is contained, and resolved when it is over.
+const (
+	IncidentOpen IncidentStatus = iota
+	IncidentMitigated
+	IncidentResolved
+)
+
+var incidentStatusNames = []string{
+	"open",
+	"mitigated",
+	"resolved",
+}
+
+func (s IncidentStatus) String() string {
+	if int(s) < len(incidentStatusNames) {
+		return incidentStatusNames[s]
+	}
+
+	return fmt.Sprintf("IncidentStatus(%d)", s)
+} // func (s IncidentStatus) String() string
+
+// ParseIncidentStatus returns the IncidentStatus with the given name. The
+// empty string means IncidentOpen.
+func ParseIncidentStatus(s string) (IncidentStatus, error) {
+	switch strings.ToLower(s) {
+	case "", "open":
+		return IncidentOpen, nil
+	case "mitigated":
+		return IncidentMitigated, nil
+	case "resolved":
+		return IncidentResolved, nil
+	default:
+		return 0, fmt.Errorf("Invalid incident status %q (must be open, mitigated, or resolved)", s)
+	}
+} // func ParseIncidentStatus(s string) (IncidentStatus, error)
+
+// Incident is a workspace for investigating an outage. It collects the
+// Records and saved Searches related to it, so they can be viewed on a
+// single timeline and written up afterwards.
+//
+// Begin and End are the time window of the Incident. End is zero while
+// the end is not known, yet.
+type Incident struct {
+	ID      int64
+	Title   string
+	Summary string
+	Begin   time.Time
+	End     time.Time
+	Status  IncidentStatus
+	Created time.Time
+}
+
+// Validate checks if the Incident makes sense.
+func (i *Incident) Validate() error {
+	if i.Title == "" {
+		return fmt.Errorf("Incident has no title")
+	} else if i.Begin.IsZero() {
+		return fmt.Errorf("Incident %q has no beginning", i.Title)
+	} else if !i.End.IsZero() && !i.End.After(i.Begin) {
+		return fmt.Errorf("Incident %q ends before it begins", i.Title)
+	} else if int(i.Status) >= len(incidentStatusNames) {
+		return fmt.Errorf("Incident %q has an invalid status: %s",
+			i.Title,
+			i.Status)
+	}
+
+	return nil
+} // func (i *Incident) Validate() error
+
+// Contains returns true if the given time lies within the time window of
+// the Incident.
+func (i *Incident) Contains(t time.Time) bool {
+	return !t.Before(i.Begin) && (i.End.IsZero() || !t.After(i.End))
+} // func (i *Incident) Contains(t time.Time) bool
+
+// Pin is a Record pinned to an Incident, along with an optional Note on
+// why it matters. Source and Message are copied from the Record, so the
+// Incident can still be written up once the Record itself has expired.
+type Pin struct {
+	IncidentID int64
+	RecordID   int64
+	HostID     int64
+	Time       time.Time
+	Source     string
+	Message    string
+	Note       string
+	Pinned     time.Time
+}
+
+// Record returns the Record the Pin refers to.
+func (p *Pin) Record() Record {
+	return Record{
+		ID:      p.RecordID,
+		HostID:  p.HostID,
+		Time:    p.Time,
+		Source:  p.Source,
+		Message: p.Message,
+	}
+} // func (p *Pin) Record() Record
+
+// TimelineEntry is a Record on the timeline of an Incident. Pin is nil if
+// the Record was not pinned itself, Searches are the IDs of the pinned
+// Searches that found it.
+type TimelineEntry struct {
+	Record   Record
+	Pin      *Pin
+	Searches []int64
+}
+
+// MergeTimeline merges the pinned Records and the results of the pinned
+// Searches of an Incident into a single timeline, oldest first. Every
+// Record shows up only once. Search results outside the time window of the
+// Incident are left out, pinned Records are always included.
+func MergeTimeline(inc *Incident, pins []Pin, results map[int64][]Record) []TimelineEntry {
+	var (
+		timeline = make([]TimelineEntry, 0, len(pins))
+		index    = make(map[int64]int, len(pins))
+		sids     = make([]int64, 0, len(results))
+	)
+
+	for i := range pins {
+		index[pins[i].RecordID] = len(timeline)
+		timeline = append(timeline, TimelineEntry{
+			Record: pins[i].Record(),
+			Pin:    &pins[i],
+		})
+	}
+
+	for sid := range results {
+		sids = append(sids, sid)
+	}
+
+	slices.Sort(sids)
+
+	for _, sid := range sids {
+		for _, r := range results[sid] {
+			if idx, ok := index[r.ID]; ok {
+				if !slices.Contains(timeline[idx].Searches, sid) {
+					timeline[idx].Searches = append(timeline[idx].Searches, sid)
+				}
+			} else if inc.Contains(r.Time) {
+				index[r.ID] = len(timeline)
+				timeline = append(timeline, TimelineEntry{
+					Record:   r,
+					Searches: []int64{sid},
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(timeline, func(a, b TimelineEntry) int {
+		if c := a.Record.Time.Compare(b.Record.Time); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Record.ID, b.Record.ID)
+	})
+
+	return timeline
+} // func MergeTimeline(inc *Incident, pins []Pin, results map[int64][]Record) []TimelineEntry
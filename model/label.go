@@ -0,0 +1,33 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/label.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-10 15:32:18 krylon>
+
+package model
+
+import "time"
+
+// Label is what the user thinks of a Record: Either it is interesting, or
+// it is noise. The classifier learns from the Labels which Records are
+// likely to be interesting.
+//
+// Source and Message are copied from the Record, so the classifier can
+// still learn from a Label once the Record itself has expired.
+type Label struct {
+	RecordID    int64
+	HostID      int64
+	Source      string
+	Message     string
+	Interesting bool
+	Time        time.Time
+}
+
+// Score is the probability the classifier assigned to a Record being
+// interesting, between 0 and 1. Time is the time of the Record.
+type Score struct {
+	RecordID int64
+	HostID   int64
+	Time     time.Time
+	Value    float64
+}
@@ -0,0 +1,72 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/message.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 20. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-20 17:48:22 krylon>
+
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A lot of log messages differ only in things like PIDs, IP addresses,
+// port numbers and the like. To save space, the database stores such
+// messages as a template, which is shared by all messages that only differ
+// in these variable parts, and a list of parameters.
+
+// ParamMarker marks the place of a parameter in a message template.
+const ParamMarker = "\x1f"
+
+var paramPat = regexp.MustCompile(
+	`\b(?:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|0x[0-9a-fA-F]+|[0-9a-fA-F]*\d[0-9a-fA-F]*(?:[.:][0-9a-fA-F]+)*)\b`)
+
+// SplitMessage splits a log message into a template and the list of
+// parameters that need to be inserted into the template to get the
+// original message back. If the message contains nothing that looks like a
+// parameter, the template is the message itself.
+func SplitMessage(msg string) (string, []string) {
+	if strings.Contains(msg, ParamMarker) {
+		// We cannot tell the marker apart from the message, so we don't
+		// even try.
+		return msg, nil
+	}
+
+	var params = paramPat.FindAllString(msg, -1)
+
+	if len(params) == 0 {
+		return msg, nil
+	}
+
+	return paramPat.ReplaceAllLiteralString(msg, ParamMarker), params
+} // func SplitMessage(msg string) (string, []string)
+
+// JoinMessage is the inverse of SplitMessage, it inserts the parameters
+// into the template. If there are no parameters, the template is returned
+// unchanged.
+func JoinMessage(tmpl string, params []string) string {
+	if len(params) == 0 {
+		return tmpl
+	}
+
+	var (
+		b     strings.Builder
+		parts = strings.Split(tmpl, ParamMarker)
+	)
+
+	b.Grow(len(tmpl) + 8*len(params))
+
+	for i, p := range parts {
+		b.WriteString(p)
+		if i < len(parts)-1 {
+			if i < len(params) {
+				b.WriteString(params[i])
+			} else {
+				b.WriteString(ParamMarker)
+			}
+		}
+	}
+
+	return b.String()
+} // func JoinMessage(tmpl string, params []string) string
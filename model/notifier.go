@@ -0,0 +1,143 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/notifier.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 17:10:44 krylon>
+
+package model
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NotifierKind identifies the channel a Notifier delivers its messages
+// through.
+type NotifierKind uint8
+
+// These are the channels we can deliver notifications through.
+const (
+	NotifyWebhook NotifierKind = iota
+	NotifyMail
+	NotifyCommand
+)
+
+var notifierKindNames = []string{
+	"webhook",
+	"mail",
+	"command",
+}
+
+func (k NotifierKind) String() string {
+	if int(k) < len(notifierKindNames) {
+		return notifierKindNames[k]
+	}
+
+	return fmt.Sprintf("NotifierKind(%d)", k)
+} // func (k NotifierKind) String() string
+
+// AllNotifierKinds returns all the kinds of Notifiers.
+func AllNotifierKinds() []NotifierKind {
+	return []NotifierKind{
+		NotifyWebhook,
+		NotifyMail,
+		NotifyCommand,
+	}
+} // func AllNotifierKinds() []NotifierKind
+
+// ParseNotifierKind returns the NotifierKind with the given name.
+func ParseNotifierKind(s string) (NotifierKind, error) {
+	switch strings.ToLower(s) {
+	case "webhook", "http":
+		return NotifyWebhook, nil
+	case "mail", "smtp", "email":
+		return NotifyMail, nil
+	case "command", "exec":
+		return NotifyCommand, nil
+	default:
+		return 0, fmt.Errorf("Invalid notifier kind %q (must be one of webhook, mail, or command)", s)
+	}
+} // func ParseNotifierKind(s string) (NotifierKind, error)
+
+// Notifier tells someone when an Alert fires or is resolved.
+//
+// What Target means depends on the Kind: It is the URL a webhook POSTs to,
+// the address (host:port) of the SMTP server mails are sent through, or the
+// path of the command to run.
+//
+// Subject and Template are text/template templates for the subject and
+// body of the message, if they are empty, a default is used. Webhooks send
+// the Alert as JSON unless there is a Template, commands always get the
+// Alert as JSON on stdin and the message in their environment.
+type Notifier struct {
+	ID       int64
+	Name     string
+	Kind     NotifierKind
+	Target   string
+	Args     []string
+	From     string
+	To       []string
+	Subject  string
+	Template string
+	Active   bool
+}
+
+// Validate checks if the Notifier has everything it needs to deliver a
+// message. It does not check if the templates are valid.
+func (n *Notifier) Validate() error {
+	if n.Name == "" {
+		return fmt.Errorf("Notifier has no name")
+	} else if n.Target == "" {
+		return fmt.Errorf("Notifier %q has no target", n.Name)
+	}
+
+	switch n.Kind {
+	case NotifyWebhook:
+		if u, err := url.Parse(n.Target); err != nil {
+			return fmt.Errorf("Invalid URL for Notifier %q: %w", n.Name, err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("URL of Notifier %q is not http(s): %s", n.Name, n.Target)
+		}
+	case NotifyMail:
+		if len(n.To) == 0 {
+			return fmt.Errorf("Notifier %q has no recipients", n.Name)
+		} else if _, err := mail.ParseAddress(n.From); err != nil {
+			return fmt.Errorf("Invalid sender address for Notifier %q: %w", n.Name, err)
+		}
+
+		for _, addr := range n.To {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("Invalid recipient address %q for Notifier %q: %w",
+					addr,
+					n.Name,
+					err)
+			}
+		}
+	case NotifyCommand:
+	default:
+		return fmt.Errorf("Notifier %q has an invalid kind: %s", n.Name, n.Kind)
+	}
+
+	return nil
+} // func (n *Notifier) Validate() error
+
+// Delivery records an attempt to deliver a message through a Notifier.
+type Delivery struct {
+	ID         int64
+	NotifierID int64
+	// AlertID is 0 for test messages.
+	AlertID int64
+	State   AlertState
+	Stamp   time.Time
+	Attempt int
+	// Error is empty if the attempt was successful.
+	Error string
+}
+
+// OK returns true if the message was delivered.
+func (d *Delivery) OK() bool {
+	return d.Error == ""
+} // func (d *Delivery) OK() bool
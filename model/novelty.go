@@ -0,0 +1,27 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/novelty.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 08. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 16:15:02 krylon>
+
+package model
+
+import "time"
+
+// Novelty is the first time a Host logged a message matching a Pattern from
+// a given source. A message that has never been seen on a Host before is
+// often more interesting than a thousand familiar ones.
+type Novelty struct {
+	ID        int64
+	PatternID int64
+	Template  string
+	HostID    int64
+	Source    string
+	FirstSeen time.Time
+	// RecordID is the ID of the first Record. It may have been deleted
+	// since, along with its partition.
+	RecordID int64
+	// Acknowledged Novelties have been looked at and do not show up in
+	// the feed anymore.
+	Acknowledged bool
+}
@@ -0,0 +1,29 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/pattern.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-06 16:31:08 krylon>
+
+package model
+
+import "time"
+
+// PatternBucket is the period for which the Records matching a Pattern
+// are counted.
+const PatternBucket = time.Hour
+
+// Pattern is a template that the messages of many Records share, as found
+// by clustering the messages as they come in. The parts in which the
+// messages differ are replaced with wildcards.
+type Pattern struct {
+	ID       int64
+	Template string
+	// FirstSeen and LastSeen are the timestamps of the oldest and the
+	// most recent Record matching the Pattern.
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Count     int64
+	// Recent is the number of Records matching the Pattern within a
+	// period the caller asked for, usually the last day.
+	Recent int64
+}
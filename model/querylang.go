@@ -0,0 +1,920 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/querylang.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 24. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:03:18 krylon>
+
+package model
+
+// This file implements a small query language for searching the log, e.g.
+//
+//	sshd AND NOT "Accepted" host:web* since:2h
+//
+// A query consists of terms, which are combined with AND (the default if no
+// operator is given), OR, and NOT (or a leading "-"). Parentheses can be
+// used for grouping. The keywords have to be upper case, lower case "and",
+// "or", and "not" are just words.
+//
+// A term is one of
+//   - a word or a "quoted phrase", which matches Records whose source or
+//     message contains it, ignoring case,
+//   - a /regular expression/, which is matched against the message,
+//   - host:PATTERN, source:PATTERN, which match the Host name or the source
+//     against a shell-style pattern (see path.Match), e.g. host:web*,
+//   - severity>=LEVEL (or >, <=, <, :, =), which compares the (guessed)
+//     Severity of a Record to one of the syslog levels. "More" means "more
+//     severe", so severity>=warning matches warnings, errors, and worse,
+//   - since:TIME, until:TIME, which limit the period of time. TIME is either
+//     relative to now, like 30m, 2h, 7d, or 1w, or an absolute date (and
+//     time), like 2024-09-01 or 2024-09-01T12:00. last:2h is the same as
+//     since:2h. today and yesterday work, too.
+//   - message:VALUE, which is the same as the value on its own, except it
+//     only looks at the message.
+//   - tag:PATTERN, which matches Records the user tagged with a tag that
+//     matches the pattern. Like host names, tags have to be resolved by
+//     BindTags.
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QuerySyntaxError is returned if a query cannot be parsed. Pos is the
+// offset in bytes into the query at which the problem was detected.
+type QuerySyntaxError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	var near = e.Query[e.Pos:]
+
+	if near == "" {
+		return fmt.Sprintf("Syntax error at end of query: %s", e.Msg)
+	} else if len(near) > 20 {
+		near = near[:20] + "..."
+	}
+
+	return fmt.Sprintf("Syntax error at position %d (near %q): %s",
+		e.Pos+1,
+		near,
+		e.Msg)
+} // func (e *QuerySyntaxError) Error() string
+
+// QueryExpr is a compiled query.
+type QueryExpr interface {
+	// Match returns true if the Record matches the expression.
+	Match(r *Record) bool
+	// String returns a normalized representation of the expression,
+	// mostly for debugging.
+	String() string
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Tokens /////////////////////////////////////////////////////////////////
+///////////////////////////////////////////////////////////////////////////
+
+type tokenKind uint8
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokRegex
+	tokField
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	pos   int
+	text  string // the word, phrase, regex, or value of a field
+	field string
+	op    string
+	quote bool // the value of a field was a phrase
+	regex bool // the value of a field was a regex
+}
+
+var fieldPat = regexp.MustCompile(`^([A-Za-z]+)(:|>=|<=|>|<|=)`)
+
+// Field names and their aliases.
+var queryFields = map[string]string{
+	"host":     "host",
+	"source":   "source",
+	"src":      "source",
+	"severity": "severity",
+	"sev":      "severity",
+	"since":    "since",
+	"last":     "since",
+	"until":    "until",
+	"message":  "message",
+	"msg":      "message",
+	"tag":      "tag",
+}
+
+type lexer struct {
+	query string
+	pos   int
+}
+
+func (l *lexer) errorf(pos int, format string, args ...any) error {
+	return &QuerySyntaxError{
+		Query: l.query,
+		Pos:   pos,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+} // func (l *lexer) errorf(pos int, format string, args ...any) error
+
+// delimited reads a phrase or regex, beginning at the opening delimiter.
+// A backslash escapes the delimiter. In phrases, it also escapes itself,
+// in regexes it is left alone, so "\d" still works.
+func (l *lexer) delimited(delim byte, what string) (string, error) {
+	var (
+		sb    strings.Builder
+		start = l.pos
+	)
+
+	for l.pos++; l.pos < len(l.query); l.pos++ {
+		var c = l.query[l.pos]
+
+		if c == delim {
+			l.pos++
+			return sb.String(), nil
+		} else if c == '\\' && l.pos+1 < len(l.query) {
+			var n = l.query[l.pos+1]
+			if n == delim || (delim == '"' && n == '\\') {
+				sb.WriteByte(n)
+				l.pos++
+				continue
+			}
+		}
+
+		sb.WriteByte(c)
+	}
+
+	return "", l.errorf(start, "Unterminated %s", what)
+} // func (l *lexer) delimited(delim byte, what string) (string, error)
+
+func isDelim(c byte) bool {
+	return c == '(' || c == ')' || c == '"' || unicode.IsSpace(rune(c))
+} // func isDelim(c byte) bool
+
+func (l *lexer) tokens() ([]token, error) {
+	var (
+		err  error
+		toks []token
+	)
+
+	for l.pos < len(l.query) {
+		var (
+			c   = l.query[l.pos]
+			tok = token{pos: l.pos}
+		)
+
+		switch {
+		case unicode.IsSpace(rune(c)):
+			l.pos++
+			continue
+		case c == '(':
+			tok.kind = tokLParen
+			tok.text = "("
+			l.pos++
+		case c == ')':
+			tok.kind = tokRParen
+			tok.text = ")"
+			l.pos++
+		case c == '"':
+			tok.kind = tokPhrase
+			if tok.text, err = l.delimited('"', "phrase"); err != nil {
+				return nil, err
+			}
+		case c == '/':
+			tok.kind = tokRegex
+			if tok.text, err = l.delimited('/', "regular expression"); err != nil {
+				return nil, err
+			}
+		case c == '-' && l.pos+1 < len(l.query) && !unicode.IsSpace(rune(l.query[l.pos+1])) && l.query[l.pos+1] != ')':
+			tok.kind = tokNot
+			tok.text = "-"
+			l.pos++
+		default:
+			if err = l.word(&tok); err != nil {
+				return nil, err
+			}
+		}
+
+		toks = append(toks, tok)
+	}
+
+	return toks, nil
+} // func (l *lexer) tokens() ([]token, error)
+
+// word reads a bare word, which may be a keyword or a field predicate.
+func (l *lexer) word(tok *token) error {
+	var (
+		err   error
+		start = l.pos
+	)
+
+	for l.pos < len(l.query) && !isDelim(l.query[l.pos]) {
+		l.pos++
+	}
+
+	tok.text = l.query[start:l.pos]
+
+	switch tok.text {
+	case "AND", "&&":
+		tok.kind = tokAnd
+		return nil
+	case "OR", "||":
+		tok.kind = tokOr
+		return nil
+	case "NOT":
+		tok.kind = tokNot
+		return nil
+	}
+
+	var m = fieldPat.FindStringSubmatch(tok.text)
+
+	if m == nil {
+		tok.kind = tokWord
+		return nil
+	} else if tok.field = queryFields[strings.ToLower(m[1])]; tok.field == "" {
+		if m[2] == ":" {
+			// Words like "error:" are common in log messages, so
+			// we treat this as a plain word.
+			tok.kind = tokWord
+			return nil
+		}
+
+		return l.errorf(start, "Unknown field %q", m[1])
+	}
+
+	tok.kind = tokField
+	tok.op = m[2]
+	tok.text = tok.text[len(m[0]):]
+
+	if tok.text == "" && l.pos < len(l.query) && l.query[l.pos] == '"' {
+		tok.quote = true
+		if tok.text, err = l.delimited('"', "phrase"); err != nil {
+			return err
+		}
+	} else if strings.HasPrefix(tok.text, "/") && len(tok.text) > 1 {
+		// A regex without whitespace, e.g. message:/fo+/ was read
+		// as part of the word.
+		l.pos = start + len(m[0])
+		tok.regex = true
+		if tok.text, err = l.delimited('/', "regular expression"); err != nil {
+			return err
+		}
+	}
+
+	if tok.text == "" && !tok.quote {
+		return l.errorf(start, "Missing value for %s", m[1])
+	}
+
+	return nil
+} // func (l *lexer) word(tok *token) error
+
+///////////////////////////////////////////////////////////////////////////
+// Parser /////////////////////////////////////////////////////////////////
+///////////////////////////////////////////////////////////////////////////
+
+type parser struct {
+	lexer
+	toks []token
+	idx  int
+	now  time.Time
+}
+
+// ParseQuery parses a query. Relative times are relative to now. Host
+// predicates only match after the expression has been bound to the list of
+// Hosts with BindHosts. An empty query returns nil.
+func ParseQuery(query string, now time.Time) (QueryExpr, error) {
+	var (
+		err  error
+		expr QueryExpr
+		p    = &parser{
+			lexer: lexer{query: query},
+			now:   now,
+		}
+	)
+
+	if p.toks, err = p.tokens(); err != nil {
+		return nil, err
+	} else if len(p.toks) == 0 {
+		return nil, nil
+	} else if expr, err = p.parseOr(); err != nil {
+		return nil, err
+	} else if p.idx < len(p.toks) {
+		var tok = p.toks[p.idx]
+		if tok.kind == tokRParen {
+			return nil, p.errorf(tok.pos, "Unbalanced closing parenthesis")
+		}
+		return nil, p.errorf(tok.pos, "Unexpected %s", tok.text)
+	}
+
+	return expr, nil
+} // func ParseQuery(query string, now time.Time) (QueryExpr, error)
+
+func (p *parser) peek() *token {
+	if p.idx < len(p.toks) {
+		return &p.toks[p.idx]
+	}
+
+	return nil
+} // func (p *parser) peek() *token
+
+// errorEnd returns an error for a query that ended prematurely.
+func (p *parser) errorEnd(format string, args ...any) error {
+	return p.errorf(len(p.query), format, args...)
+} // func (p *parser) errorEnd(format string, args ...any) error
+
+func (p *parser) parseOr() (QueryExpr, error) {
+	var (
+		err  error
+		expr QueryExpr
+		list []QueryExpr
+	)
+
+	if expr, err = p.parseAnd(); err != nil {
+		return nil, err
+	}
+
+	list = append(list, expr)
+
+	for tok := p.peek(); tok != nil && tok.kind == tokOr; tok = p.peek() {
+		p.idx++
+		if expr, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+	}
+
+	if len(list) == 1 {
+		return list[0], nil
+	}
+
+	return exprOr(list), nil
+} // func (p *parser) parseOr() (QueryExpr, error)
+
+func (p *parser) parseAnd() (QueryExpr, error) {
+	var (
+		err  error
+		expr QueryExpr
+		list []QueryExpr
+	)
+
+	if expr, err = p.parseUnary(); err != nil {
+		return nil, err
+	}
+
+	list = append(list, expr)
+
+	for tok := p.peek(); tok != nil; tok = p.peek() {
+		if tok.kind == tokAnd {
+			p.idx++
+		} else if tok.kind == tokOr || tok.kind == tokRParen {
+			break
+		}
+
+		if expr, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+	}
+
+	if len(list) == 1 {
+		return list[0], nil
+	}
+
+	return exprAnd(list), nil
+} // func (p *parser) parseAnd() (QueryExpr, error)
+
+func (p *parser) parseUnary() (QueryExpr, error) {
+	var (
+		err  error
+		expr QueryExpr
+		tok  = p.peek()
+	)
+
+	if tok == nil {
+		if p.idx == 0 {
+			return nil, p.errorEnd("Empty query")
+		}
+		var prev = p.toks[p.idx-1]
+		return nil, p.errorEnd("Expected a term after %s", prev.text)
+	}
+
+	p.idx++
+
+	switch tok.kind {
+	case tokNot:
+		if expr, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		return exprNot{expr}, nil
+	case tokLParen:
+		if expr, err = p.parseOr(); err != nil {
+			return nil, err
+		} else if next := p.peek(); next == nil || next.kind != tokRParen {
+			return nil, p.errorf(tok.pos, "Missing closing parenthesis")
+		}
+		p.idx++
+		return expr, nil
+	case tokWord, tokPhrase:
+		return &exprText{text: strings.ToLower(tok.text), source: true}, nil
+	case tokRegex:
+		return p.regex(tok)
+	case tokField:
+		return p.field(tok)
+	case tokRParen:
+		return nil, p.errorf(tok.pos, "Unexpected closing parenthesis")
+	default:
+		return nil, p.errorf(tok.pos, "Expected a term before %s", tok.text)
+	}
+} // func (p *parser) parseUnary() (QueryExpr, error)
+
+func (p *parser) regex(tok *token) (QueryExpr, error) {
+	var (
+		err error
+		re  *regexp.Regexp
+	)
+
+	if re, err = regexp.Compile(tok.text); err != nil {
+		return nil, p.errorf(tok.pos, "Invalid regular expression: %s", err.Error())
+	}
+
+	return &exprRegex{re}, nil
+} // func (p *parser) regex(tok *token) (QueryExpr, error)
+
+func (p *parser) field(tok *token) (QueryExpr, error) {
+	if tok.field != "severity" && tok.op != ":" && tok.op != "=" {
+		return nil, p.errorf(tok.pos, "Operator %s is only allowed with severity", tok.op)
+	}
+
+	switch tok.field {
+	case "message":
+		if tok.regex {
+			return p.regex(tok)
+		}
+		return &exprText{text: strings.ToLower(tok.text)}, nil
+	case "host", "source", "tag":
+		if tok.regex {
+			return nil, p.errorf(tok.pos, "%s takes a pattern, not a regular expression", tok.field)
+		} else if _, err := path.Match(tok.text, ""); err != nil {
+			return nil, p.errorf(tok.pos, "Invalid pattern %q", tok.text)
+		} else if tok.field == "host" {
+			return &exprHost{pattern: strings.ToLower(tok.text)}, nil
+		} else if tok.field == "tag" {
+			return &exprTag{pattern: strings.ToLower(tok.text)}, nil
+		}
+		return &exprSource{pattern: tok.text}, nil
+	case "severity":
+		var sev, err = ParseSeverity(tok.text)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "Invalid severity %q (must be one of %s)",
+				tok.text,
+				strings.Join(sevNames, ", "))
+		}
+		return &exprSeverity{op: tok.op, sev: sev}, nil
+	case "since", "until":
+		var stamp, err = parseQueryTime(tok.text, p.now)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "%s", err.Error())
+		}
+		return &exprTime{since: tok.field == "since", stamp: stamp}, nil
+	default:
+		return nil, p.errorf(tok.pos, "CANTHAPPEN: Unknown field %q", tok.field)
+	}
+} // func (p *parser) field(tok *token) (QueryExpr, error)
+
+var relTimePat = regexp.MustCompile(`^-?(\d+)([smhdw])$`)
+
+var absTimeFormats = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// parseQueryTime parses a relative or absolute time.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		var y, m, d = now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		var y, m, d = now.Date()
+		return time.Date(y, m, d-1, 0, 0, 0, 0, now.Location()), nil
+	}
+
+	if m := relTimePat.FindStringSubmatch(s); m != nil {
+		var n, err = strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return now, fmt.Errorf("Invalid time %q: %s", s, err.Error())
+		}
+
+		switch m[2] {
+		case "s":
+			return now.Add(-time.Duration(n) * time.Second), nil
+		case "m":
+			return now.Add(-time.Duration(n) * time.Minute), nil
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -int(n)), nil
+		default:
+			return now.AddDate(0, 0, -7*int(n)), nil
+		}
+	}
+
+	for _, f := range absTimeFormats {
+		if t, err := time.ParseInLocation(f, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	return now, fmt.Errorf("Invalid time %q (use e.g. 30m, 2h, 7d, 2024-09-01, or 2024-09-01T12:00)", s)
+} // func parseQueryTime(s string, now time.Time) (time.Time, error)
+
+///////////////////////////////////////////////////////////////////////////
+// Expressions ////////////////////////////////////////////////////////////
+///////////////////////////////////////////////////////////////////////////
+
+type exprAnd []QueryExpr
+
+func (e exprAnd) Match(r *Record) bool {
+	for _, sub := range e {
+		if !sub.Match(r) {
+			return false
+		}
+	}
+
+	return true
+} // func (e exprAnd) Match(r *Record) bool
+
+func (e exprAnd) String() string {
+	return joinExprs(e, " AND ")
+} // func (e exprAnd) String() string
+
+type exprOr []QueryExpr
+
+func (e exprOr) Match(r *Record) bool {
+	for _, sub := range e {
+		if sub.Match(r) {
+			return true
+		}
+	}
+
+	return false
+} // func (e exprOr) Match(r *Record) bool
+
+func (e exprOr) String() string {
+	return joinExprs(e, " OR ")
+} // func (e exprOr) String() string
+
+func joinExprs(list []QueryExpr, op string) string {
+	var parts = make([]string, len(list))
+
+	for i, sub := range list {
+		parts[i] = sub.String()
+	}
+
+	return "(" + strings.Join(parts, op) + ")"
+} // func joinExprs(list []QueryExpr, op string) string
+
+type exprNot struct {
+	e QueryExpr
+}
+
+func (e exprNot) Match(r *Record) bool {
+	return !e.e.Match(r)
+} // func (e exprNot) Match(r *Record) bool
+
+func (e exprNot) String() string {
+	return "NOT " + e.e.String()
+} // func (e exprNot) String() string
+
+// exprText matches a word or phrase, ignoring case.
+type exprText struct {
+	text   string
+	source bool // look at the source, too
+}
+
+func (e *exprText) Match(r *Record) bool {
+	return strings.Contains(strings.ToLower(r.Message), e.text) ||
+		(e.source && strings.Contains(strings.ToLower(r.Source), e.text))
+} // func (e *exprText) Match(r *Record) bool
+
+func (e *exprText) String() string {
+	if e.source {
+		return strconv.Quote(e.text)
+	}
+
+	return "message:" + strconv.Quote(e.text)
+} // func (e *exprText) String() string
+
+type exprRegex struct {
+	re *regexp.Regexp
+}
+
+func (e *exprRegex) Match(r *Record) bool {
+	return e.re.MatchString(r.Message)
+} // func (e *exprRegex) Match(r *Record) bool
+
+func (e *exprRegex) String() string {
+	return "/" + e.re.String() + "/"
+} // func (e *exprRegex) String() string
+
+// exprHost matches the name of a Host. Since Records only contain the ID
+// of their Host, the pattern has to be resolved to a list of IDs by
+// BindHosts before it can match anything.
+type exprHost struct {
+	pattern string
+	ids     map[int64]bool
+}
+
+func (e *exprHost) Match(r *Record) bool {
+	return e.ids[r.HostID]
+} // func (e *exprHost) Match(r *Record) bool
+
+func (e *exprHost) String() string {
+	return "host:" + e.pattern
+} // func (e *exprHost) String() string
+
+func (e *exprHost) bind(hosts []Host) {
+	e.ids = make(map[int64]bool)
+
+	for i := range hosts {
+		var (
+			name  = strings.ToLower(hosts[i].Name)
+			short = strings.ToLower(hosts[i].NameShort())
+		)
+
+		if ok, _ := path.Match(e.pattern, name); ok {
+			e.ids[hosts[i].ID] = true
+		} else if ok, _ = path.Match(e.pattern, short); ok {
+			e.ids[hosts[i].ID] = true
+		}
+	}
+} // func (e *exprHost) bind(hosts []Host)
+
+// exprTag matches the Tags of a Record. Records do not know their Tags,
+// so the pattern has to be resolved to a list of Record IDs by BindTags
+// before it can match anything.
+type exprTag struct {
+	pattern string
+	ids     map[int64]bool
+}
+
+func (e *exprTag) Match(r *Record) bool {
+	return e.ids[r.ID]
+} // func (e *exprTag) Match(r *Record) bool
+
+func (e *exprTag) String() string {
+	return "tag:" + e.pattern
+} // func (e *exprTag) String() string
+
+func (e *exprTag) bind(tagged map[string][]int64) {
+	e.ids = make(map[int64]bool)
+
+	for name, ids := range tagged {
+		if ok, _ := path.Match(e.pattern, name); ok {
+			for _, id := range ids {
+				e.ids[id] = true
+			}
+		}
+	}
+} // func (e *exprTag) bind(tagged map[string][]int64)
+
+type exprSource struct {
+	pattern string
+}
+
+func (e *exprSource) Match(r *Record) bool {
+	var ok, _ = path.Match(e.pattern, r.Source)
+	return ok
+} // func (e *exprSource) Match(r *Record) bool
+
+func (e *exprSource) String() string {
+	return "source:" + e.pattern
+} // func (e *exprSource) String() string
+
+// exact returns true if the pattern contains no wildcards.
+func (e *exprSource) exact() bool {
+	return !strings.ContainsAny(e.pattern, `*?[\`)
+} // func (e *exprSource) exact() bool
+
+type exprSeverity struct {
+	op  string
+	sev Severity
+}
+
+func (e *exprSeverity) Match(r *Record) bool {
+	var sev = r.Severity()
+
+	// Lower values are more severe.
+	switch e.op {
+	case ">=":
+		return sev <= e.sev
+	case ">":
+		return sev < e.sev
+	case "<=":
+		return sev >= e.sev
+	case "<":
+		return sev > e.sev
+	default:
+		return sev == e.sev
+	}
+} // func (e *exprSeverity) Match(r *Record) bool
+
+func (e *exprSeverity) String() string {
+	return "severity" + e.op + e.sev.String()
+} // func (e *exprSeverity) String() string
+
+type exprTime struct {
+	since bool
+	stamp time.Time
+}
+
+func (e *exprTime) Match(r *Record) bool {
+	if e.since {
+		return !r.Time.Before(e.stamp)
+	}
+
+	return !r.Time.After(e.stamp)
+} // func (e *exprTime) Match(r *Record) bool
+
+func (e *exprTime) String() string {
+	if e.since {
+		return "since:" + e.stamp.Format(time.RFC3339)
+	}
+
+	return "until:" + e.stamp.Format(time.RFC3339)
+} // func (e *exprTime) String() string
+
+///////////////////////////////////////////////////////////////////////////
+// Binding and pushdown ///////////////////////////////////////////////////
+///////////////////////////////////////////////////////////////////////////
+
+// walkExpr calls fn for every node of the expression.
+func walkExpr(e QueryExpr, fn func(QueryExpr)) {
+	fn(e)
+
+	switch x := e.(type) {
+	case exprAnd:
+		for _, sub := range x {
+			walkExpr(sub, fn)
+		}
+	case exprOr:
+		for _, sub := range x {
+			walkExpr(sub, fn)
+		}
+	case exprNot:
+		walkExpr(x.e, fn)
+	}
+} // func walkExpr(e QueryExpr, fn func(QueryExpr))
+
+// BindHosts resolves the host patterns in the expression to the given Hosts.
+func BindHosts(e QueryExpr, hosts []Host) {
+	if e == nil {
+		return
+	}
+
+	walkExpr(e, func(x QueryExpr) {
+		if h, ok := x.(*exprHost); ok {
+			h.bind(hosts)
+		}
+	})
+} // func BindHosts(e QueryExpr, hosts []Host)
+
+// BindTags resolves the tag patterns in the expression. tagged maps the
+// name of each Tag to the IDs of the Records carrying it.
+func BindTags(e QueryExpr, tagged map[string][]int64) {
+	if e == nil {
+		return
+	}
+
+	walkExpr(e, func(x QueryExpr) {
+		if t, ok := x.(*exprTag); ok {
+			t.bind(tagged)
+		}
+	})
+} // func BindTags(e QueryExpr, tagged map[string][]int64)
+
+// usesTime returns true if the expression limits the period of time.
+func usesTime(e QueryExpr) bool {
+	var found bool
+
+	if e == nil {
+		return false
+	}
+
+	walkExpr(e, func(x QueryExpr) {
+		if _, ok := x.(*exprTime); ok {
+			found = true
+		}
+	})
+
+	return found
+} // func usesTime(e QueryExpr) bool
+
+// usesTags returns true if the expression contains a tag pattern.
+func usesTags(e QueryExpr) bool {
+	var found bool
+
+	if e == nil {
+		return false
+	}
+
+	walkExpr(e, func(x QueryExpr) {
+		if _, ok := x.(*exprTag); ok {
+			found = true
+		}
+	})
+
+	return found
+} // func usesTags(e QueryExpr) bool
+
+// SearchBounds are the restrictions of a SearchQuery that a database can
+// apply before looking at the Records themselves. A zero Begin or End means
+// the period is not limited in that direction. A nil list of Hosts or
+// Sources means "any", an empty list means that no Record can match.
+type SearchBounds struct {
+	Begin   time.Time
+	End     time.Time
+	Hosts   []int64
+	Sources []string
+}
+
+// restrict narrows down the bounds by the terms of the expression that
+// apply to all Records, i.e. the ones at the top level joined by AND.
+func (b *SearchBounds) restrict(e QueryExpr) {
+	var terms []QueryExpr
+
+	switch x := e.(type) {
+	case nil:
+		return
+	case exprAnd:
+		terms = x
+	default:
+		terms = []QueryExpr{e}
+	}
+
+	for _, t := range terms {
+		switch x := t.(type) {
+		case *exprTime:
+			if x.since && (b.Begin.IsZero() || x.stamp.After(b.Begin)) {
+				b.Begin = x.stamp
+			} else if !x.since && (b.End.IsZero() || x.stamp.Before(b.End)) {
+				b.End = x.stamp
+			}
+		case *exprHost:
+			var ids = make([]int64, 0, len(x.ids))
+			for id := range x.ids {
+				ids = append(ids, id)
+			}
+			b.Hosts = intersect(b.Hosts, ids)
+		case *exprSource:
+			if x.exact() {
+				b.Sources = intersect(b.Sources, []string{x.pattern})
+			}
+		case exprAnd:
+			// Can only happen if someone used parentheses around
+			// a conjunction.
+			b.restrict(x)
+		}
+	}
+} // func (b *SearchBounds) restrict(e QueryExpr)
+
+// intersect returns the elements of b that are also in a, or b if a is nil.
+func intersect[T comparable](a, b []T) []T {
+	if a == nil {
+		return b
+	}
+
+	var res = make([]T, 0, len(a))
+
+	for _, x := range b {
+		for _, y := range a {
+			if x == y {
+				res = append(res, x)
+				break
+			}
+		}
+	}
+
+	return res
+} // func intersect[T comparable](a, b []T) []T
@@ -0,0 +1,55 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/rate.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 07. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-07 15:12:40 krylon>
+
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// RateCount is the number of Records a Host logged from one source within
+// a period that begins at Begin.
+type RateCount struct {
+	HostID int64
+	Source string
+	Begin  time.Time
+	Count  int64
+}
+
+// RateStat compares the number of Records a Host logged from one source
+// within the most recent period to what it usually logs at that time.
+type RateStat struct {
+	HostID int64
+	Source string
+	// Count is the number of Records within the most recent period.
+	Count int64
+	// Expected and StdDev describe the baseline, Samples is the number of
+	// periods it was computed from. Without enough Samples, there is no
+	// baseline yet.
+	Expected float64
+	StdDev   float64
+	Samples  int
+	// Score is how many standard deviations Count is away from Expected.
+	// It is positive if the Host logged more than usual.
+	Score     float64
+	Anomalous bool
+}
+
+// Spike returns true if the Host logged more Records than usual.
+func (s *RateStat) Spike() bool {
+	return s.Score > 0
+} // func (s *RateStat) Spike() bool
+
+// Factor returns how many times the expected number of Records the Host
+// logged. If nothing was expected, it returns +Inf.
+func (s *RateStat) Factor() float64 {
+	if s.Expected == 0 {
+		return math.Inf(1)
+	}
+
+	return float64(s.Count) / s.Expected
+} // func (s *RateStat) Factor() float64
@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 13. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-09 20:35:33 krylon>
+// Time-stamp: <2024-09-24 18:14:02 krylon>
 
 package model
 
@@ -49,6 +49,12 @@ func (r *Record) Checksum() string {
 	return result
 } // func (r *Record) Checksum() string
 
+// Severity returns the Severity of the Record. Since we do not store the
+// priority of messages, it is guessed from the Message.
+func (r *Record) Severity() Severity {
+	return GuessSeverity(r.Message)
+} // func (r *Record) Severity() Severity
+
 // RecordSlice is a slice of Records that can be sorted.
 type RecordSlice []Record
 
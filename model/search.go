@@ -2,56 +2,192 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 09. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 11:11:11 krylon>
+// Time-stamp: <2024-10-13 12:03:40 krylon>
 
 package model
 
 import (
+	"fmt"
 	"regexp"
 	"slices"
 	"time"
 )
 
 // SearchQuery wraps the parameters for searching the log.
+//
+// There are three lists of regular expressions the message of a Record is
+// matched against: At least one of Terms, all of TermsAll, and none of
+// TermsExclude have to match. An empty list does not restrict the search.
+// Terms is called that (and not TermsAny) for compatibility with Searches
+// that were saved before the other two lists existed.
+//
+// Query is an expression in the query language (see querylang.go). It has
+// to be compiled before the SearchQuery is used, and its conditions are
+// combined with the other fields using AND.
+//
+// If Tags is not empty, only Records carrying at least one of the Tags
+// match. Like tag patterns in the Query, they have to be resolved by
+// BindTags.
 type SearchQuery struct {
-	Hosts   []int64          `json:"hosts"`
-	Sources []string         `json:"sources"`
-	Period  []time.Time      `json:"period"`
-	Terms   []*regexp.Regexp `json:"terms"`
+	Hosts        []int64          `json:"hosts"`
+	Sources      []string         `json:"sources"`
+	Period       []time.Time      `json:"period"`
+	Terms        []*regexp.Regexp `json:"terms"`
+	TermsAll     []*regexp.Regexp `json:"terms_all,omitempty"`
+	TermsExclude []*regexp.Regexp `json:"terms_exclude,omitempty"`
+	Query        string           `json:"query,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	expr         QueryExpr
+	ready        bool
+	tagged       map[int64]bool
 }
 
+// Compile parses the Query and resolves the host names in it to the given
+// Hosts. Relative times in the Query are relative to the time Compile is
+// called. If the Query cannot be parsed, the error is a *QuerySyntaxError.
+func (q *SearchQuery) Compile(hosts []Host) error {
+	var (
+		err  error
+		expr QueryExpr
+	)
+
+	if expr, err = ParseQuery(q.Query, time.Now()); err != nil {
+		return err
+	}
+
+	BindHosts(expr, hosts)
+	q.expr = expr
+	q.ready = true
+
+	return nil
+} // func (q *SearchQuery) Compile(hosts []Host) error
+
+// NeedsCompile returns true if the SearchQuery has a Query that has not
+// been compiled, yet.
+func (q *SearchQuery) NeedsCompile() bool {
+	return q.Query != "" && !q.ready
+} // func (q *SearchQuery) NeedsCompile() bool
+
+// UsesTags returns true if the SearchQuery looks at the Tags of Records,
+// so BindTags has to be called before it is used.
+func (q *SearchQuery) UsesTags() bool {
+	return len(q.Tags) > 0 || usesTags(q.expr)
+} // func (q *SearchQuery) UsesTags() bool
+
+// BindTags resolves the Tags and the tag patterns in the compiled Query.
+// tagged maps the name of each Tag to the IDs of the Records carrying it.
+func (q *SearchQuery) BindTags(tagged map[string][]int64) {
+	q.tagged = make(map[int64]bool)
+
+	for _, name := range q.Tags {
+		for _, id := range tagged[name] {
+			q.tagged[id] = true
+		}
+	}
+
+	BindTags(q.expr, tagged)
+} // func (q *SearchQuery) BindTags(tagged map[string][]int64)
+
+// CheckLive returns an error if the SearchQuery cannot be matched against
+// Records as they come in, like alert rules and the live tail do. Relative
+// times would be frozen at the time the Query was compiled, and new Records
+// do not carry any Tags, yet. The Query has to be compiled.
+func (q *SearchQuery) CheckLive() error {
+	if usesTime(q.expr) {
+		return fmt.Errorf("since: and until: cannot be used on live Records")
+	} else if q.UsesTags() {
+		return fmt.Errorf("Tags cannot be used on live Records, they are added later")
+	}
+
+	return nil
+} // func (q *SearchQuery) CheckLive() error
+
+// Bounds returns the restrictions of the SearchQuery that a database can use
+// to avoid looking at Records that cannot match.
+func (q *SearchQuery) Bounds() SearchBounds {
+	var b SearchBounds
+
+	if len(q.Period) == 2 {
+		b.Begin, b.End = q.Period[0], q.Period[1]
+	}
+
+	if len(q.Hosts) > 0 {
+		b.Hosts = slices.Clone(q.Hosts)
+	}
+
+	if len(q.Sources) > 0 {
+		b.Sources = slices.Clone(q.Sources)
+	}
+
+	b.restrict(q.expr)
+
+	return b
+} // func (q *SearchQuery) Bounds() SearchBounds
+
 // Match checks if a given Record r matches the criteria of the SearchQuery.
 func (q *SearchQuery) Match(r *Record) bool {
-	if len(q.Period) == 2 && (r.Time.Before(q.Period[0]) || r.Time.After(q.Period[1])) {
+	if q.expr != nil && !q.expr.Match(r) {
+		return false
+	} else if len(q.Period) == 2 && (r.Time.Before(q.Period[0]) || r.Time.After(q.Period[1])) {
 		return false
 	} else if len(q.Sources) > 0 && !slices.Contains(q.Sources, r.Source) {
 		return false
 	} else if len(q.Hosts) > 0 && !slices.Contains(q.Hosts, r.HostID) {
 		return false
+	} else if len(q.Tags) > 0 && !q.tagged[r.ID] {
+		return false
 	}
 
-	var match bool
-
-	for _, pat := range q.Terms {
+	for _, pat := range q.TermsExclude {
 		if pat.MatchString(r.Message) {
-			match = true
-			break
+			return false
 		}
 	}
 
-	if len(q.Terms) > 0 && !match {
-		return false
+	for _, pat := range q.TermsAll {
+		if !pat.MatchString(r.Message) {
+			return false
+		}
 	}
 
-	return true
+	if len(q.Terms) == 0 {
+		return true
+	}
+
+	for _, pat := range q.Terms {
+		if pat.MatchString(r.Message) {
+			return true
+		}
+	}
+
+	return false
 } // func (q *SearchQuery) Match(r *Record) bool
 
 // Search represents a search, including the Query and the list of IDs
-// it returned.
+// it returned. Searches saved before Aggregates were computed do not
+// have any.
+//
+// A Search without a Title is an anonymous snapshot, it is deleted once
+// its results expire. A named Search survives that, but its Results are
+// dropped, and Expired is set until it is run again.
 type Search struct {
-	ID        int64
-	Timestamp time.Time
-	Query     SearchQuery
-	Results   []int64
-	Count     int64
+	ID          int64
+	Timestamp   time.Time
+	Title       string
+	Description string
+	Query       SearchQuery
+	Results     []int64
+	Count       int64
+	Aggregates  *Aggregates
+	Expired     bool
 }
+
+// Name returns the Title of the Search, or a name made up from its ID if
+// it does not have one.
+func (s *Search) Name() string {
+	if s.Title != "" {
+		return s.Title
+	}
+
+	return fmt.Sprintf("Search #%d", s.ID)
+} // func (s *Search) Name() string
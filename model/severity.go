@@ -0,0 +1,119 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/severity.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 24. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-24 18:12:40 krylon>
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity is the severity of a Record, using the levels of syslog.
+// Lower values are more severe.
+type Severity uint8
+
+// These are the severity levels defined by syslog.
+const (
+	SevEmergency Severity = iota
+	SevAlert
+	SevCritical
+	SevError
+	SevWarning
+	SevNotice
+	SevInfo
+	SevDebug
+)
+
+var sevNames = []string{
+	"emergency",
+	"alert",
+	"critical",
+	"error",
+	"warning",
+	"notice",
+	"info",
+	"debug",
+}
+
+func (s Severity) String() string {
+	if int(s) < len(sevNames) {
+		return sevNames[s]
+	}
+
+	return fmt.Sprintf("Severity(%d)", s)
+} // func (s Severity) String() string
+
+// AllSeverities returns all Severity levels, from most to least severe.
+func AllSeverities() []Severity {
+	return []Severity{
+		SevEmergency,
+		SevAlert,
+		SevCritical,
+		SevError,
+		SevWarning,
+		SevNotice,
+		SevInfo,
+		SevDebug,
+	}
+} // func AllSeverities() []Severity
+
+// ParseSeverity returns the Severity with the given name. It accepts the
+// abbreviations used by syslog, too, as well as the numeric levels.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "emerg", "emergency", "panic":
+		return SevEmergency, nil
+	case "alert":
+		return SevAlert, nil
+	case "crit", "critical":
+		return SevCritical, nil
+	case "err", "error":
+		return SevError, nil
+	case "warn", "warning":
+		return SevWarning, nil
+	case "notice":
+		return SevNotice, nil
+	case "info":
+		return SevInfo, nil
+	case "debug":
+		return SevDebug, nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= int(SevDebug) {
+		return Severity(n), nil
+	}
+
+	return 0, fmt.Errorf("Invalid severity %q", s)
+} // func ParseSeverity(s string) (Severity, error)
+
+// Neither syslog files nor the Agent preserve the priority of a message, so
+// we have to guess it from the text. The patterns are checked in order, the
+// first match wins.
+var sevPatterns = []struct {
+	sev Severity
+	pat *regexp.Regexp
+}{
+	{SevEmergency, regexp.MustCompile(`(?i)\b(?:emerg(?:ency)?|kernel panic)\b`)},
+	{SevAlert, regexp.MustCompile(`(?i)\balert\b`)},
+	{SevCritical, regexp.MustCompile(`(?i)\b(?:crit(?:ical)?|fatal|panic|segfault|out of memory)\b`)},
+	{SevError, regexp.MustCompile(`(?i)\b(?:err(?:or|ors)?|fail(?:ed|ure|s)?|denied|refused|invalid)\b`)},
+	{SevWarning, regexp.MustCompile(`(?i)\b(?:warn(?:ing)?|deprecated|timed? ?out|retry(?:ing)?)\b`)},
+	{SevNotice, regexp.MustCompile(`(?i)\bnotice\b`)},
+	{SevDebug, regexp.MustCompile(`(?i)\bdebug\b`)},
+}
+
+// GuessSeverity guesses the Severity of a log message from its text.
+func GuessSeverity(msg string) Severity {
+	for _, p := range sevPatterns {
+		if p.pat.MatchString(msg) {
+			return p.sev
+		}
+	}
+
+	return SevInfo
+} // func GuessSeverity(msg string) Severity
@@ -0,0 +1,70 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/model/signature.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-09 16:12:37 krylon>
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Signature describes a well-known kind of event, like the kernel killing
+// a process because it ran out of memory. Records matching the Query are
+// tagged with the Signature's Category and Severity.
+//
+// If Threshold is greater than 0, a Record is only tagged once more than
+// Threshold Records from the same Host matched within Window, so a single
+// mistyped password does not look like a brute-force attack. The Records
+// that made up the burst are tagged, too.
+//
+// Builtin Signatures come with the application. They can be deactivated,
+// but they are restored when the server starts, so they cannot be edited
+// or deleted.
+type Signature struct {
+	ID          int64
+	Name        string
+	Category    string
+	Severity    Severity
+	Description string
+	Query       SearchQuery
+	Threshold   int64
+	Window      time.Duration
+	Builtin     bool
+	Active      bool
+}
+
+// Validate checks if the Signature makes sense.
+func (s *Signature) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("Signature has no name")
+	} else if s.Category == "" {
+		return fmt.Errorf("Signature %q has no category", s.Name)
+	} else if s.Severity > SevDebug {
+		return fmt.Errorf("Signature %q has an invalid severity: %s",
+			s.Name,
+			s.Severity)
+	} else if s.Query.Query == "" {
+		return fmt.Errorf("Signature %q has no query", s.Name)
+	} else if s.Threshold < 0 {
+		return fmt.Errorf("Threshold of Signature %q is negative: %d",
+			s.Name,
+			s.Threshold)
+	} else if s.Threshold > 0 && s.Window < time.Second {
+		return fmt.Errorf("Window of Signature %q is too short: %s",
+			s.Name,
+			s.Window)
+	}
+
+	return nil
+} // func (s *Signature) Validate() error
+
+// Detection is a Record that matched a Signature.
+type Detection struct {
+	RecordID    int64
+	SignatureID int64
+	HostID      int64
+	Time        time.Time
+}
@@ -0,0 +1,304 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/01_notify_channel_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-07 18:27:30 krylon>
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func testAlertEvent() *Event {
+	var now = time.Now()
+
+	return &Event{
+		Rule: model.AlertRule{
+			Name:      "Disk full",
+			Threshold: 3,
+			Window:    time.Minute * 5,
+		},
+		Alert: model.Alert{
+			ID:       42,
+			Fired:    now,
+			LastSeen: now,
+			Count:    7,
+		},
+		Host: "schwarzgeraet",
+	}
+} // func testAlertEvent() *Event
+
+func send(n *model.Notifier, ev *Event) error {
+	var (
+		err         error
+		msg         *Message
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	)
+
+	defer cancel()
+
+	if msg, err = render(n, ev); err != nil {
+		return err
+	}
+
+	return channels[n.Kind].Send(ctx, n, ev, msg)
+} // func send(n *model.Notifier, ev *Event) error
+
+func TestRender(t *testing.T) {
+	var (
+		err error
+		msg *Message
+		ev  = testAlertEvent()
+		n   = &model.Notifier{Name: "Test"}
+	)
+
+	if msg, err = render(n, ev); err != nil {
+		t.Fatalf("Cannot render default templates: %s", err.Error())
+	} else if msg.Subject != "[firing] Disk full on schwarzgeraet" {
+		t.Errorf("Unexpected subject: %q", msg.Subject)
+	} else if !strings.Contains(msg.Body, "7 at most") {
+		t.Errorf("Unexpected body: %q", msg.Body)
+	}
+
+	ev.Rule.Kind = model.RuleSilence
+	if msg, err = render(n, ev); err != nil {
+		t.Fatalf("Cannot render default templates: %s", err.Error())
+	} else if !strings.Contains(msg.Body, "longer than its threshold") {
+		t.Errorf("Unexpected body for silent Host: %q", msg.Body)
+	}
+
+	ev.Rule.Kind = model.RuleAnomaly
+	if msg, err = render(n, ev); err != nil {
+		t.Fatalf("Cannot render default templates: %s", err.Error())
+	} else if !strings.Contains(msg.Body, "sources logged at an unusual rate, 7 at most") {
+		t.Errorf("Unexpected body for unusual rates: %q", msg.Body)
+	}
+
+	ev.Rule.Kind = model.RuleMatch
+	n.Subject = "{{ .Rule.Name | printf \"%q\" }}"
+	n.Template = "{{ .Alert.Count }} on {{ .Host }}"
+
+	if msg, err = render(n, ev); err != nil {
+		t.Fatalf("Cannot render custom templates: %s", err.Error())
+	} else if msg.Subject != `"Disk full"` || msg.Body != "7 on schwarzgeraet" {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+
+	n.Template = "{{ .NoSuchField }}"
+	if err = CheckTemplates(n); err == nil {
+		t.Error("Rendering a template with an invalid field did not fail")
+	}
+
+	n.Template = "{{ if }}"
+	if err = CheckTemplates(n); err == nil {
+		t.Error("Parsing an invalid template did not fail")
+	}
+} // func TestRender(t *testing.T)
+
+func TestWebhook(t *testing.T) {
+	var (
+		err  error
+		body = make(chan []byte, 2)
+		srv  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var buf, _ = io.ReadAll(r.Body)
+			body <- buf
+		}))
+		n = &model.Notifier{
+			Name:   "Webhook",
+			Kind:   model.NotifyWebhook,
+			Target: srv.URL,
+		}
+		p payload
+	)
+
+	defer srv.Close()
+
+	if err = send(n, testAlertEvent()); err != nil {
+		t.Fatalf("Cannot send Event to webhook: %s", err.Error())
+	} else if err = json.Unmarshal(<-body, &p); err != nil {
+		t.Fatalf("Cannot parse payload: %s", err.Error())
+	} else if p.AlertID != 42 || p.Rule != "Disk full" || p.State != "firing" ||
+		p.Host != "schwarzgeraet" || p.Count != 7 || p.Resolved != nil {
+		t.Errorf("Unexpected payload: %#v", p)
+	}
+
+	n.Template = `{"text": "{{ .Rule.Name }} is {{ .State }}"}`
+
+	if err = send(n, testAlertEvent()); err != nil {
+		t.Fatalf("Cannot send Event to webhook: %s", err.Error())
+	} else if s := string(<-body); s != `{"text": "Disk full is firing"}` {
+		t.Errorf("Unexpected body: %s", s)
+	}
+
+	var broken = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Go away", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	n.Target = broken.URL
+	if err = send(n, testAlertEvent()); err == nil {
+		t.Error("Sending to a webhook that fails did not fail")
+	} else if !strings.Contains(err.Error(), "Go away") {
+		t.Errorf("Error does not contain the reply: %s", err.Error())
+	}
+} // func TestWebhook(t *testing.T)
+
+// smtpStandIn accepts a single mail on the given listener and sends what
+// it received on the channel.
+func smtpStandIn(l net.Listener, mails chan<- string) {
+	var conn, err = l.Accept()
+	if err != nil {
+		close(mails)
+		return
+	}
+
+	defer conn.Close() // nolint: errcheck
+
+	var (
+		in   = bufio.NewReader(conn)
+		data strings.Builder
+		env  []string
+	)
+
+	fmt.Fprint(conn, "220 localhost ESMTP stand-in\r\n")
+
+	for {
+		var line, err = in.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var cmd = strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			fmt.Fprint(conn, "250 localhost\r\n")
+		case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+			env = append(env, strings.TrimSpace(line))
+			fmt.Fprint(conn, "250 OK\r\n")
+		case cmd == "DATA":
+			fmt.Fprint(conn, "354 Go ahead\r\n")
+			for {
+				if line, err = in.ReadString('\n'); err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			fmt.Fprint(conn, "250 OK\r\n")
+		case cmd == "QUIT":
+			fmt.Fprint(conn, "221 Bye\r\n")
+			mails <- strings.Join(env, "\n") + "\n\n" + data.String()
+			return
+		default:
+			fmt.Fprint(conn, "502 Not implemented\r\n")
+		}
+	}
+} // func smtpStandIn(l net.Listener, mails chan<- string)
+
+func TestMail(t *testing.T) {
+	var (
+		err   error
+		l     net.Listener
+		mails = make(chan string, 1)
+	)
+
+	if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Cannot listen on loopback: %s", err.Error())
+	}
+
+	defer l.Close() // nolint: errcheck
+
+	go smtpStandIn(l, mails)
+
+	var n = &model.Notifier{
+		Name:    "Mail",
+		Kind:    model.NotifyMail,
+		Target:  l.Addr().String(),
+		From:    "Scrollmaster <scrollmaster@example.com>",
+		To:      []string{"ops@example.com", "Bob <bob@example.com>"},
+		Subject: "Ärger mit {{ .Rule.Name }}",
+	}
+
+	if err = n.Validate(); err != nil {
+		t.Fatalf("Notifier is not valid: %s", err.Error())
+	} else if err = send(n, testAlertEvent()); err != nil {
+		t.Fatalf("Cannot send mail: %s", err.Error())
+	}
+
+	var mail = <-mails
+
+	for _, s := range []string{
+		"MAIL FROM:<scrollmaster@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<bob@example.com>",
+		"Subject: =?utf-8?q?=C3=84rger_mit_Disk_full?=",
+		"is firing on schwarzgeraet",
+	} {
+		if !strings.Contains(mail, s) {
+			t.Errorf("Mail does not contain %q:\n%s", s, mail)
+		}
+	}
+} // func TestMail(t *testing.T)
+
+func TestCommand(t *testing.T) {
+	var (
+		err   error
+		buf   []byte
+		p     payload
+		out   = filepath.Join(t.TempDir(), "event.json")
+		state = filepath.Join(t.TempDir(), "state")
+		n     = &model.Notifier{
+			Name:   "Command",
+			Kind:   model.NotifyCommand,
+			Target: "/bin/sh",
+			Args: []string{
+				"-c",
+				`cat > "$1" && echo "$SCROLLMASTER_STATE" > "$2"`,
+				"notify",
+				out,
+				state,
+			},
+		}
+	)
+
+	if _, err = os.Stat(n.Target); err != nil {
+		t.Skipf("Cannot find %s: %s", n.Target, err.Error())
+	}
+
+	if err = send(n, testAlertEvent()); err != nil {
+		t.Fatalf("Cannot run command: %s", err.Error())
+	} else if buf, err = os.ReadFile(out); err != nil {
+		t.Fatalf("Cannot read output of command: %s", err.Error())
+	} else if err = json.Unmarshal(buf, &p); err != nil {
+		t.Fatalf("Cannot parse payload: %s", err.Error())
+	} else if p.AlertID != 42 || p.Host != "schwarzgeraet" {
+		t.Errorf("Unexpected payload: %#v", p)
+	} else if buf, err = os.ReadFile(state); err != nil {
+		t.Fatalf("Cannot read state written by command: %s", err.Error())
+	} else if s := strings.TrimSpace(string(buf)); s != "firing" {
+		t.Errorf("Unexpected state in environment: %q", s)
+	}
+
+	n.Args = []string{"-c", "echo Nope >&2; exit 3"}
+
+	if err = send(n, testAlertEvent()); err == nil {
+		t.Error("Running a command that fails did not fail")
+	} else if !strings.Contains(err.Error(), "Nope") {
+		t.Errorf("Error does not contain the output of the command: %s", err.Error())
+	}
+} // func TestCommand(t *testing.T)
@@ -0,0 +1,129 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/02_notify_dispatch_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 20:05:51 krylon>
+
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestDispatcher(t *testing.T) {
+	const failures = 2
+
+	var (
+		err        error
+		pool       *database.Pool
+		d          *Dispatcher
+		db         database.Storage
+		deliveries []model.Delivery
+		calls      atomic.Int32
+		srv        = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				http.Error(w, "Not yet", http.StatusInternalServerError)
+			}
+		}))
+		rule = &model.AlertRule{
+			Name:   "Dispatcher test",
+			Query:  model.SearchQuery{Query: `"dispatcher test"`},
+			Window: time.Minute,
+			Active: true,
+		}
+		ev = testAlertEvent()
+		n  = &model.Notifier{
+			Name:   "Flaky webhook",
+			Kind:   model.NotifyWebhook,
+			Target: srv.URL,
+			Active: true,
+		}
+		inactive = &model.Notifier{
+			Name:   "Inactive webhook",
+			Kind:   model.NotifyWebhook,
+			Target: srv.URL,
+		}
+	)
+
+	defer srv.Close()
+
+	defer func(a int, b time.Duration) {
+		Attempts, Backoff = a, b
+	}(Attempts, Backoff)
+
+	Attempts = failures + 1
+	Backoff = time.Millisecond * 10
+
+	if pool, err = database.NewPool(2); err != nil {
+		t.Fatalf("Cannot open database pool: %s", err.Error())
+	}
+
+	defer pool.Close() // nolint: errcheck
+
+	db = pool.Get()
+	defer pool.Put(db)
+
+	if err = db.NotifierAdd(n); err != nil {
+		t.Fatalf("Cannot add Notifier: %s", err.Error())
+	} else if err = db.NotifierAdd(inactive); err != nil {
+		t.Fatalf("Cannot add Notifier: %s", err.Error())
+	} else if err = db.AlertRuleAdd(rule); err != nil {
+		t.Fatalf("Cannot add alert rule: %s", err.Error())
+	}
+
+	ev.Rule = *rule
+	ev.Alert.ID = 0
+	ev.Alert.RuleID = rule.ID
+
+	if err = db.AlertAdd(&ev.Alert); err != nil {
+		t.Fatalf("Cannot add Alert: %s", err.Error())
+	} else if d, err = New(pool); err != nil {
+		t.Fatalf("Cannot create Dispatcher: %s", err.Error())
+	}
+
+	d.Notify(*ev)
+	d.Wait()
+
+	if n := calls.Load(); n != failures+1 {
+		t.Errorf("Unexpected number of calls to the webhook: %d (expected %d)",
+			n,
+			failures+1)
+	} else if deliveries, err = db.DeliveryGetRecent(-1); err != nil {
+		t.Fatalf("Cannot get delivery log: %s", err.Error())
+	} else if len(deliveries) != failures+1 {
+		t.Fatalf("Unexpected number of Deliveries: %d (expected %d)",
+			len(deliveries),
+			failures+1)
+	}
+
+	// The delivery log is most recent first.
+	for i, rec := range deliveries {
+		var attempt = failures + 1 - i
+
+		if rec.NotifierID != n.ID || rec.AlertID != ev.Alert.ID {
+			t.Errorf("Delivery %d is for the wrong Notifier or Alert: %#v", rec.ID, rec)
+		} else if rec.Attempt != attempt {
+			t.Errorf("Delivery %d is attempt #%d, expected #%d", rec.ID, rec.Attempt, attempt)
+		} else if rec.OK() != (attempt > failures) {
+			t.Errorf("Attempt #%d should have %s: %#v",
+				attempt,
+				map[bool]string{true: "succeeded", false: "failed"}[attempt > failures],
+				rec)
+		}
+	}
+
+	if err = d.Test(n); err != nil {
+		t.Errorf("Cannot send test message: %s", err.Error())
+	} else if deliveries, err = db.DeliveryGetRecent(1); err != nil {
+		t.Fatalf("Cannot get delivery log: %s", err.Error())
+	} else if len(deliveries) != 1 || deliveries[0].AlertID != 0 || !deliveries[0].OK() {
+		t.Errorf("Delivery of test message was not logged: %v", deliveries)
+	}
+} // func TestDispatcher(t *testing.T)
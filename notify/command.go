@@ -0,0 +1,60 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/command.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 19:01:17 krylon>
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// commandErrLen is how much of the output of a failed command we put into
+// the error message.
+const commandErrLen = 256
+
+// command runs the Notifier's Target with its Args. The command gets the
+// Event as JSON on stdin, and the rendered message in the environment
+// variables SCROLLMASTER_SUBJECT and SCROLLMASTER_MESSAGE.
+type command struct{}
+
+func (command) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error {
+	var (
+		err  error
+		body []byte
+		out  []byte
+		cmd  *exec.Cmd
+	)
+
+	if body, err = ev.JSON(); err != nil {
+		return fmt.Errorf("Cannot serialize Event: %w", err)
+	}
+
+	cmd = exec.CommandContext(ctx, n.Target, n.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"SCROLLMASTER_STATE="+ev.State().String(),
+		"SCROLLMASTER_SUBJECT="+msg.Subject,
+		"SCROLLMASTER_MESSAGE="+msg.Body)
+
+	if out, err = cmd.CombinedOutput(); err != nil {
+		if len(out) > commandErrLen {
+			out = out[:commandErrLen]
+		}
+
+		return fmt.Errorf("%s failed: %w: %s",
+			n.Target,
+			err,
+			strings.TrimSpace(string(out)))
+	}
+
+	return nil
+} // func (command) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error
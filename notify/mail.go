@@ -0,0 +1,129 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/mail.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 18:55:08 krylon>
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// mailer sends mail through the SMTP server at the Notifier's Target. It
+// does not authenticate, so the server has to be a relay that accepts
+// mail from us, usually the local MTA. If the server supports STARTTLS,
+// it is used.
+type mailer struct{}
+
+func (mailer) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error {
+	var (
+		err      error
+		host     string
+		conn     net.Conn
+		client   *smtp.Client
+		w        io.WriteCloser
+		from     *mail.Address
+		to       []*mail.Address
+		dialer   net.Dialer
+		deadline time.Time
+		ok       bool
+	)
+
+	if host, _, err = net.SplitHostPort(n.Target); err != nil {
+		return fmt.Errorf("Invalid address of SMTP server %q: %w", n.Target, err)
+	} else if from, err = mail.ParseAddress(n.From); err != nil {
+		return fmt.Errorf("Invalid sender address %q: %w", n.From, err)
+	}
+
+	for _, s := range n.To {
+		var addr *mail.Address
+
+		if addr, err = mail.ParseAddress(s); err != nil {
+			return fmt.Errorf("Invalid recipient address %q: %w", s, err)
+		}
+
+		to = append(to, addr)
+	}
+
+	if conn, err = dialer.DialContext(ctx, "tcp", n.Target); err != nil {
+		return err
+	} else if deadline, ok = ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) // nolint: errcheck
+	}
+
+	if client, err = smtp.NewClient(conn, host); err != nil {
+		conn.Close() // nolint: errcheck,gosec
+		return err
+	}
+
+	defer client.Close() // nolint: errcheck
+
+	if ok, _ = client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err = client.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+
+	if w, err = client.Data(); err != nil {
+		return err
+	} else if _, err = w.Write(formatMail(from, to, msg)); err != nil {
+		return err
+	} else if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+} // func (mailer) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error
+
+// formatMail renders the header and body of a mail.
+func formatMail(from *mail.Address, to []*mail.Address, msg *Message) []byte {
+	var (
+		buf   bytes.Buffer
+		rcpts = make([]string, len(to))
+	)
+
+	for i, addr := range to {
+		rcpts[i] = addr.String()
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(rcpts, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "X-Mailer: %s %s\r\n", common.AppName, common.Version)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	for _, line := range strings.Split(strings.TrimRight(msg.Body, "\n"), "\n") {
+		buf.WriteString(strings.TrimRight(line, "\r"))
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+} // func formatMail(from *mail.Address, to []*mail.Address, msg *Message) []byte
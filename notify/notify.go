@@ -0,0 +1,345 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/notify.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:46:52 krylon>
+
+// Package notify tells people when an Alert fires or is resolved, through
+// the Notifiers they have configured.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/model"
+)
+
+var (
+	// Attempts is how often we try to deliver a message before we give up.
+	Attempts = 5
+	// Backoff is how long we wait before we try again after the first
+	// failed attempt. It doubles with every attempt after that.
+	Backoff = time.Second * 15
+	// Timeout is how long a single attempt may take.
+	Timeout = time.Second * 30
+)
+
+// Event is what a message is about: An Alert that fired or was resolved.
+type Event struct {
+	Rule  model.AlertRule
+	Alert model.Alert
+	// Host is the name of the Host the Alert was raised for. It is empty
+	// if the rule counts the Records of all Hosts together.
+	Host string
+	// Test is true for the messages sent to check if a Notifier works.
+	Test bool
+}
+
+// State returns the state of the Event's Alert.
+func (ev *Event) State() model.AlertState {
+	return ev.Alert.State()
+} // func (ev *Event) State() model.AlertState
+
+// payload is the JSON representation of an Event that webhooks and
+// commands receive.
+type payload struct {
+	AlertID     int64      `json:"alert_id"`
+	Rule        string     `json:"rule"`
+	Kind        string     `json:"kind"`
+	Description string     `json:"description,omitempty"`
+	Threshold   int64      `json:"threshold"`
+	Window      string     `json:"window"`
+	State       string     `json:"state"`
+	Host        string     `json:"host,omitempty"`
+	Fired       time.Time  `json:"fired"`
+	Resolved    *time.Time `json:"resolved,omitempty"`
+	Count       int64      `json:"count"`
+	Test        bool       `json:"test,omitempty"`
+}
+
+// JSON returns the Event serialized as JSON.
+func (ev *Event) JSON() ([]byte, error) {
+	var p = payload{
+		AlertID:     ev.Alert.ID,
+		Rule:        ev.Rule.Name,
+		Kind:        ev.Rule.Kind.String(),
+		Description: ev.Rule.Description,
+		Threshold:   ev.Rule.Threshold,
+		Window:      ev.Rule.Window.String(),
+		State:       ev.State().String(),
+		Host:        ev.Host,
+		Fired:       ev.Alert.Fired,
+		Count:       ev.Alert.Count,
+		Test:        ev.Test,
+	}
+
+	if !ev.Alert.Resolved.IsZero() {
+		p.Resolved = &ev.Alert.Resolved
+	}
+
+	return json.Marshal(&p)
+} // func (ev *Event) JSON() ([]byte, error)
+
+// testEvent returns the Event used for test messages.
+func testEvent() *Event {
+	var now = time.Now()
+
+	return &Event{
+		Rule: model.AlertRule{
+			Name:        "Test",
+			Description: "This is a test message from " + common.AppName,
+			Window:      time.Minute,
+		},
+		Alert: model.Alert{
+			Fired:    now,
+			LastSeen: now,
+			Count:    1,
+		},
+		Test: true,
+	}
+} // func testEvent() *Event
+
+// These are the templates used if a Notifier does not have its own.
+const (
+	defaultSubject = `[{{ .State }}] {{ .Rule.Name }}{{ if .Host }} on {{ .Host }}{{ end }}`
+	defaultBody    = `{{ if .Test }}This is a test message, please ignore it.
+
+{{ end }}Alert rule "{{ .Rule.Name }}" is {{ .State }}{{ if .Host }} on {{ .Host }}{{ end }}.
+{{ with .Rule.Description }}
+{{ . }}
+{{ end }}
+{{ if eq .Rule.Kind.String "silence" }}It fired at {{ fmt_time .Alert.Fired }}, when the Host had gone without contact or new Records for longer than its threshold.
+{{ else if eq .Rule.Kind.String "anomaly" }}It fired at {{ fmt_time .Alert.Fired }}, when more than {{ .Rule.Threshold }} sources logged at an unusual rate, {{ .Alert.Count }} at most.
+{{ else }}It fired at {{ fmt_time .Alert.Fired }}, when there were more than {{ .Rule.Threshold }} matching Records within {{ .Rule.Window }}, {{ .Alert.Count }} at most.
+{{ end }}{{ if not .Alert.Resolved.IsZero }}It was resolved at {{ fmt_time .Alert.Resolved }}.
+{{ end }}`
+)
+
+var funcmap = template.FuncMap{
+	"fmt_time": func(t time.Time) string {
+		return t.Format(common.TimestampFormat)
+	},
+}
+
+// Message is the text of a notification, rendered from the templates of
+// a Notifier.
+type Message struct {
+	Subject string
+	Body    string
+}
+
+// CheckTemplates returns an error if the templates of the Notifier cannot
+// be parsed or rendered.
+func CheckTemplates(n *model.Notifier) error {
+	var _, err = render(n, testEvent())
+	return err
+} // func CheckTemplates(n *model.Notifier) error
+
+func render(n *model.Notifier, ev *Event) (*Message, error) {
+	var (
+		err error
+		msg Message
+		src = [2]string{n.Subject, n.Template}
+		dst = [2]*string{&msg.Subject, &msg.Body}
+	)
+
+	if src[0] == "" {
+		src[0] = defaultSubject
+	}
+	if src[1] == "" {
+		src[1] = defaultBody
+	}
+
+	for i, s := range src {
+		var (
+			tmpl *template.Template
+			buf  bytes.Buffer
+		)
+
+		if tmpl, err = template.New(n.Name).Funcs(funcmap).Parse(s); err != nil {
+			return nil, fmt.Errorf("Cannot parse template of Notifier %q: %w",
+				n.Name,
+				err)
+		} else if err = tmpl.Execute(&buf, ev); err != nil {
+			return nil, fmt.Errorf("Cannot render template of Notifier %q: %w",
+				n.Name,
+				err)
+		}
+
+		*dst[i] = buf.String()
+	}
+
+	return &msg, nil
+} // func render(n *model.Notifier, ev *Event) (*Message, error)
+
+// Channel delivers messages for one kind of Notifier.
+type Channel interface {
+	Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error
+}
+
+var channels = map[model.NotifierKind]Channel{
+	model.NotifyWebhook: webhook{},
+	model.NotifyMail:    mailer{},
+	model.NotifyCommand: command{},
+}
+
+// Dispatcher sends out the messages for Events through all active
+// Notifiers. Failed deliveries are retried in the background, and every
+// attempt is recorded in the delivery log.
+type Dispatcher struct {
+	log       *log.Logger
+	pool      *database.Pool
+	lock      sync.RWMutex
+	notifiers []model.Notifier
+	pending   sync.WaitGroup
+}
+
+// New creates a Dispatcher and loads the Notifiers from the database.
+func New(pool *database.Pool) (*Dispatcher, error) {
+	var (
+		err error
+		d   = &Dispatcher{pool: pool}
+	)
+
+	if d.log, err = common.GetLogger(logdomain.Notify); err != nil {
+		return nil, err
+	}
+
+	var db = pool.Get()
+	defer pool.Put(db)
+
+	if err = d.Load(db); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+} // func New(pool *database.Pool) (*Dispatcher, error)
+
+// Load (re-)loads the Notifiers from the database. It has to be called
+// whenever they are changed.
+func (d *Dispatcher) Load(db database.Storage) error {
+	var (
+		err   error
+		notes []model.Notifier
+	)
+
+	if notes, err = db.NotifierGetAll(); err != nil {
+		d.log.Printf("[ERROR] Cannot load Notifiers: %s\n", err.Error())
+		return err
+	}
+
+	d.lock.Lock()
+	d.notifiers = notes
+	d.lock.Unlock()
+
+	return nil
+} // func (d *Dispatcher) Load(db database.Storage) error
+
+// Notify sends a message about the Event through all active Notifiers.
+// It does not wait for the messages to be delivered.
+func (d *Dispatcher) Notify(ev Event) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for _, n := range d.notifiers {
+		if !n.Active {
+			continue
+		}
+
+		d.pending.Add(1)
+		go d.deliver(n, ev)
+	}
+} // func (d *Dispatcher) Notify(ev Event)
+
+// Test sends a test message through the Notifier and waits for the
+// result. It only tries once. The attempt is logged with a connection
+// from the pool, so the caller must not hold one.
+func (d *Dispatcher) Test(n *model.Notifier) error {
+	return d.attempt(n, testEvent(), 1)
+} // func (d *Dispatcher) Test(n *model.Notifier) error
+
+// Wait waits until all pending messages have been delivered or given up
+// on.
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+} // func (d *Dispatcher) Wait()
+
+func (d *Dispatcher) deliver(n model.Notifier, ev Event) {
+	defer d.pending.Done()
+
+	var delay = Backoff
+
+	for i := 1; i <= Attempts; i++ {
+		if err := d.attempt(&n, &ev, i); err == nil {
+			return
+		} else if i < Attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	d.log.Printf("[ERROR] Giving up on delivering Alert %d through Notifier %q after %d attempts\n",
+		ev.Alert.ID,
+		n.Name,
+		Attempts)
+} // func (d *Dispatcher) deliver(n model.Notifier, ev Event)
+
+// attempt tries once to deliver a message and records the result in the
+// delivery log.
+func (d *Dispatcher) attempt(n *model.Notifier, ev *Event, cnt int) error {
+	var (
+		err         error
+		msg         *Message
+		ch          Channel
+		ctx, cancel = context.WithTimeout(context.Background(), Timeout)
+		rec         = model.Delivery{
+			NotifierID: n.ID,
+			AlertID:    ev.Alert.ID,
+			State:      ev.State(),
+			Attempt:    cnt,
+		}
+	)
+
+	defer cancel()
+
+	if ch = channels[n.Kind]; ch == nil {
+		err = fmt.Errorf("Notifier %q has an invalid kind: %s", n.Name, n.Kind)
+	} else if msg, err = render(n, ev); err == nil {
+		err = ch.Send(ctx, n, ev, msg)
+	}
+
+	rec.Stamp = time.Now()
+	if err != nil {
+		rec.Error = err.Error()
+		d.log.Printf("[ERROR] Attempt #%d to deliver Alert %d through Notifier %q failed: %s\n",
+			cnt,
+			ev.Alert.ID,
+			n.Name,
+			err.Error())
+	} else {
+		d.log.Printf("[DEBUG] Delivered Alert %d through Notifier %q\n",
+			ev.Alert.ID,
+			n.Name)
+	}
+
+	var db = d.pool.Get()
+	defer d.pool.Put(db)
+
+	if lerr := db.DeliveryAdd(&rec); lerr != nil {
+		d.log.Printf("[ERROR] Cannot log Delivery through Notifier %q: %s\n",
+			n.Name,
+			lerr.Error())
+	}
+
+	return err
+} // func (d *Dispatcher) attempt(n *model.Notifier, ev *Event, cnt int) error
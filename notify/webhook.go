@@ -0,0 +1,68 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/notify/webhook.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 04. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-04 18:47:30 krylon>
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// webhookErrLen is how much of the response body of a failed webhook we
+// put into the error message.
+const webhookErrLen = 256
+
+// webhook POSTs the Event as JSON to the Notifier's Target, or the
+// rendered Template, if the Notifier has one.
+type webhook struct{}
+
+func (webhook) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error {
+	var (
+		err  error
+		body []byte
+		req  *http.Request
+		res  *http.Response
+		buf  bytes.Buffer
+	)
+
+	if n.Template != "" {
+		body = []byte(msg.Body)
+	} else if body, err = ev.JSON(); err != nil {
+		return fmt.Errorf("Cannot serialize Event: %w", err)
+	}
+
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, n.Target, bytes.NewReader(body)); err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", common.AppName+"/"+common.Version)
+
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		return err
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, res.Body) // nolint: errcheck
+		return nil
+	}
+
+	io.CopyN(&buf, res.Body, webhookErrLen) // nolint: errcheck
+
+	return fmt.Errorf("%s replied with %s: %s",
+		n.Target,
+		res.Status,
+		strings.TrimSpace(buf.String()))
+} // func (webhook) Send(ctx context.Context, n *model.Notifier, ev *Event, msg *Message) error
@@ -0,0 +1,91 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/rate/01_rate_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 07. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-07 16:05:29 krylon>
+
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestAnalyze(t *testing.T) {
+	type expect struct {
+		count     int64
+		samples   int
+		anomalous bool
+		spike     bool
+	}
+
+	var (
+		d      = New()
+		now    = time.Date(2024, time.October, 7, 14, 23, 0, 0, time.UTC)
+		begin  = d.Begin(now)
+		counts []model.RateCount
+		stats  []model.RateStat
+	)
+
+	// add sets the count of the period that begins <ago> before the most
+	// recent one.
+	var add = func(host int64, src string, ago time.Duration, cnt int64) {
+		counts = append(counts, model.RateCount{
+			HostID: host,
+			Source: src,
+			Begin:  begin.Add(day*time.Duration(d.Days) - ago),
+			Count:  cnt,
+		})
+	}
+
+	for i := 1; i <= d.Days; i++ {
+		var ago = day * time.Duration(i)
+
+		// sshd logs about 20 Records per hour, and suddenly ten times
+		// as many.
+		add(1, "sshd", ago, int64(18+i%4))
+		// cron is usually chatty, but has gone quiet.
+		add(1, "cron", ago, 50)
+		// kernel logs a few Records, sometimes more.
+		add(2, "kernel", ago, int64(i%3))
+		// Lots of Records during the rest of the day do not matter.
+		add(2, "nginx", ago, 100)
+		add(2, "nginx", ago+time.Hour, 1000)
+	}
+
+	add(1, "sshd", 0, 200)
+	add(2, "kernel", 0, 6)
+	add(2, "nginx", 0, 104)
+	// A new source has no baseline yet.
+	add(2, "backup", day, 500)
+	add(2, "backup", 0, 5000)
+
+	stats = d.Analyze(counts, now)
+
+	var expected = map[string]expect{
+		"sshd":   {count: 200, samples: 7, anomalous: true, spike: true},
+		"cron":   {count: 0, samples: 7, anomalous: true},
+		"kernel": {count: 6, samples: 7, spike: true},
+		"nginx":  {count: 104, samples: 7, spike: true},
+		"backup": {count: 5000, samples: 1, spike: false},
+	}
+
+	if len(stats) != len(expected) {
+		t.Fatalf("Analyze returned %d streams, expected %d", len(stats), len(expected))
+	} else if stats[0].Source != "sshd" || stats[1].Source != "cron" {
+		t.Errorf("Anomalous streams do not come first, most severe first: %s, %s",
+			stats[0].Source,
+			stats[1].Source)
+	}
+
+	for _, s := range stats {
+		var e = expected[s.Source]
+
+		if s.Count != e.count || s.Samples != e.samples ||
+			s.Anomalous != e.anomalous || s.Spike() != e.spike {
+			t.Errorf("Unexpected stats for %s: %#v", s.Source, s)
+		}
+	}
+} // func TestAnalyze(t *testing.T)
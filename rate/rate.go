@@ -0,0 +1,171 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/rate/rate.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 07. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-07 15:48:03 krylon>
+
+// Package rate learns how many Records each Host usually logs from each
+// source, and flags the streams that deviate significantly from that.
+//
+// Most logs follow a daily rhythm, backups run at night, users log in
+// during the day. So the baseline is seasonal: The number of Records
+// within the most recent period is compared to the number of Records
+// within the same period of the day on each of the previous days.
+package rate
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// The defaults for the parameters of a Detector.
+const (
+	DefaultWidth      = time.Hour
+	DefaultDays       = 7
+	DefaultMinSamples = 3
+	DefaultThreshold  = 4.0
+	DefaultMinVolume  = 10
+)
+
+const day = time.Hour * 24
+
+// Detector computes the baselines and flags deviations.
+//
+// Width is the length of the periods Records are counted in, it must
+// divide a day. Days is how many days of history make up the baseline, at
+// least MinSamples of them must be there. A stream is flagged if its
+// count is at least Threshold standard deviations away from the baseline,
+// and either the count or the baseline is at least MinVolume, so quiet
+// streams do not raise false alarms over a handful of Records.
+type Detector struct {
+	Width      time.Duration
+	Days       int
+	MinSamples int
+	Threshold  float64
+	MinVolume  int64
+}
+
+// New returns a Detector with the default parameters.
+func New() *Detector {
+	return &Detector{
+		Width:      DefaultWidth,
+		Days:       DefaultDays,
+		MinSamples: DefaultMinSamples,
+		Threshold:  DefaultThreshold,
+		MinVolume:  DefaultMinVolume,
+	}
+} // func New() *Detector
+
+// Begin returns the beginning of the history needed to analyze the rates
+// at the given time. The counts passed to Analyze must be for periods of
+// Width that start at Begin.
+func (d *Detector) Begin(now time.Time) time.Time {
+	return now.Add(-(day*time.Duration(d.Days) + d.Width))
+} // func (d *Detector) Begin(now time.Time) time.Time
+
+type stream struct {
+	host   int64
+	source string
+}
+
+// Analyze compares the counts of the most recent period to the baseline
+// of each stream. The anomalous streams come first, the most severe first,
+// followed by the others ordered by Host and source.
+func (d *Detector) Analyze(counts []model.RateCount, now time.Time) []model.RateStat {
+	var (
+		begin   = d.Begin(now)
+		perDay  = int(day / d.Width)
+		last    = d.Days * perDay
+		series  = make(map[stream][]int64)
+		results = make([]model.RateStat, 0)
+	)
+
+	for _, c := range counts {
+		var (
+			key = stream{host: c.HostID, source: c.Source}
+			idx = int(c.Begin.Sub(begin) / d.Width)
+		)
+
+		if idx < 0 || idx > last {
+			continue
+		} else if series[key] == nil {
+			series[key] = make([]int64, last+1)
+		}
+
+		series[key][idx] += c.Count
+	}
+
+	for key, s := range series {
+		var (
+			stat = model.RateStat{
+				HostID: key.host,
+				Source: key.source,
+				Count:  s[last],
+			}
+			first   = slices.IndexFunc(s, func(n int64) bool { return n > 0 })
+			samples []float64
+		)
+
+		// Before its first Record, the stream did not exist, so those
+		// periods say nothing about its rate.
+		for idx := last - perDay; idx >= first; idx -= perDay {
+			samples = append(samples, float64(s[idx]))
+		}
+
+		stat.Samples = len(samples)
+		if stat.Samples < d.MinSamples {
+			results = append(results, stat)
+			continue
+		}
+
+		stat.Expected, stat.StdDev = meanStdDev(samples)
+
+		// The counts of Records behave roughly like a Poisson
+		// process, so the deviation is at least the square root of
+		// the mean, even if the samples happen to be very similar.
+		var sigma = max(stat.StdDev, math.Sqrt(stat.Expected), 1)
+
+		stat.Score = (float64(stat.Count) - stat.Expected) / sigma
+		stat.Anomalous = math.Abs(stat.Score) >= d.Threshold &&
+			max(float64(stat.Count), stat.Expected) >= float64(d.MinVolume)
+
+		results = append(results, stat)
+	}
+
+	slices.SortFunc(results, func(a, b model.RateStat) int {
+		if a.Anomalous != b.Anomalous {
+			if a.Anomalous {
+				return -1
+			}
+			return 1
+		} else if a.Anomalous {
+			return cmp.Compare(math.Abs(b.Score), math.Abs(a.Score))
+		} else if a.HostID != b.HostID {
+			return cmp.Compare(a.HostID, b.HostID)
+		}
+
+		return cmp.Compare(a.Source, b.Source)
+	})
+
+	return results
+} // func (d *Detector) Analyze(counts []model.RateCount, now time.Time) []model.RateStat
+
+func meanStdDev(samples []float64) (float64, float64) {
+	var mean, variance float64
+
+	for _, x := range samples {
+		mean += x
+	}
+	mean /= float64(len(samples))
+
+	for _, x := range samples {
+		variance += (x - mean) * (x - mean)
+	}
+	variance /= float64(len(samples))
+
+	return mean, math.Sqrt(variance)
+} // func meanStdDev(samples []float64) (float64, float64)
@@ -0,0 +1,217 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/02_server_search_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 26. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-09-29 18:34:12 krylon>
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// getReply sends a request to the Server and decodes the reply. If body is
+// nil, it sends a GET request, otherwise a POST.
+func getReply(uri string, body io.Reader) (*model.Response, int, error) {
+	var (
+		err   error
+		res   *http.Response
+		buf   bytes.Buffer
+		reply model.Response
+	)
+
+	if body == nil {
+		res, err = client.Get(uri)
+	} else {
+		res, err = client.Post(uri, "application/json", body)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if _, err = io.Copy(&buf, res.Body); err != nil {
+		return nil, res.StatusCode, err
+	} else if err = json.Unmarshal(buf.Bytes(), &reply); err != nil {
+		return nil, res.StatusCode, fmt.Errorf("Cannot decode reply: %w\n\n%s",
+			err,
+			buf.String())
+	}
+
+	return &reply, res.StatusCode, nil
+} // func getReply(uri string, body io.Reader) (*model.Response, int, error)
+
+// waitJob waits for a search job to finish and returns the last status
+// reply.
+func waitJob(t *testing.T, job string) *model.Response {
+	var (
+		err    error
+		reply  *model.Response
+		status int
+		uri    = fmt.Sprintf("http://%s/ajax/search/job/%s", addr, job)
+	)
+
+	for i := 0; i < 100; i++ {
+		if reply, status, err = getReply(uri, nil); err != nil {
+			t.Fatalf("Cannot get status of search job %s: %s", job, err.Error())
+		} else if status != 200 {
+			t.Fatalf("Cannot get status of search job %s: %03d %s",
+				job,
+				status,
+				reply.Message)
+		} else if reply.Payload["status"] != "running" {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	return reply
+} // func waitJob(t *testing.T, job string) *model.Response
+
+func TestServerSearchJob(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		reply  *model.Response
+		status int
+		job    string
+		uri    = fmt.Sprintf("http://%s/ajax/search/create", addr)
+		query  = fmt.Sprintf(`{"hosts": [%d], "query": "\"happened - 00\""}`,
+			testHost.ID)
+	)
+
+	if reply, status, err = getReply(uri, strings.NewReader(query)); err != nil {
+		t.Fatalf("Cannot create search: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot create search: %03d %s", status, reply.Message)
+	} else if job = reply.Payload["job"]; job == "" {
+		t.Fatalf("Reply does not contain a job ID: %#v", reply.Payload)
+	}
+
+	reply = waitJob(t, job)
+
+	// The Agent test submitted Records numbered 0000 through 0199.
+	if reply.Payload["status"] != "done" {
+		t.Fatalf("Search job %s did not finish: %#v", job, reply.Payload)
+	} else if reply.Payload["cnt"] != "100" || reply.Payload["matched"] != "100" {
+		t.Errorf("Unexpected number of results: %#v", reply.Payload)
+	} else if reply.Payload["id"] == "" {
+		t.Errorf("Reply does not contain the Search ID: %#v", reply.Payload)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/search/job/%d", addr, 4711)
+
+	if _, status, err = getReply(uri, nil); err != nil {
+		t.Fatalf("Cannot get status of search job 4711: %s", err.Error())
+	} else if status != 404 {
+		t.Errorf("Unexpected status for nonexistent job: %03d", status)
+	}
+} // func TestServerSearchJob(t *testing.T)
+
+func TestServerSearchSaved(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		reply  *model.Response
+		res    *http.Response
+		status int
+		id     string
+		search *model.Search
+		db     = srv.pool.Get()
+		uri    = fmt.Sprintf("http://%s/ajax/search/create", addr)
+		query  = fmt.Sprintf(`{"hosts": [%d], "query": "\"happened - 01\""}`,
+			testHost.ID)
+	)
+
+	defer srv.pool.Put(db)
+
+	if reply, status, err = getReply(uri, strings.NewReader(query)); err != nil {
+		t.Fatalf("Cannot create search: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot create search: %03d %s", status, reply.Message)
+	} else if reply = waitJob(t, reply.Payload["job"]); reply.Payload["status"] != "done" {
+		t.Fatalf("Search job did not finish: %#v", reply.Payload)
+	}
+
+	id = reply.Payload["id"]
+	uri = fmt.Sprintf("http://%s/ajax/search/save/%s", addr, id)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"title": "Happenings", "description": "Things that happened"}`)); err != nil {
+		t.Fatalf("Cannot save Search %s: %s", id, err.Error())
+	} else if status != 200 || reply.Payload["title"] != "Happenings" {
+		t.Fatalf("Cannot save Search %s: %03d %s", id, status, reply.Message)
+	}
+
+	// Running the Search again with new parameters keeps its ID and Title.
+	uri = fmt.Sprintf("http://%s/ajax/search/rerun/%s", addr, id)
+	query = fmt.Sprintf(`{"hosts": [%d], "query": "\"happened - 010\""}`,
+		testHost.ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader(query)); err != nil {
+		t.Fatalf("Cannot run Search %s again: %s", id, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot run Search %s again: %03d %s", id, status, reply.Message)
+	} else if reply = waitJob(t, reply.Payload["job"]); reply.Payload["status"] != "done" {
+		t.Fatalf("Search job did not finish: %#v", reply.Payload)
+	} else if reply.Payload["id"] != id || reply.Payload["title"] != "Happenings" {
+		t.Errorf("Search was not updated in place: %#v", reply.Payload)
+	} else if reply.Payload["cnt"] != "10" {
+		t.Errorf("Unexpected number of results: %#v", reply.Payload)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/search/duplicate/%s", addr, id)
+
+	if reply, status, err = getReply(uri, strings.NewReader("")); err != nil {
+		t.Fatalf("Cannot copy Search %s: %s", id, err.Error())
+	} else if status != 200 || reply.Payload["id"] == id {
+		t.Fatalf("Cannot copy Search %s: %03d %#v", id, status, reply.Payload)
+	} else if reply.Payload["title"] != "Copy of Happenings" || reply.Payload["cnt"] != "10" {
+		t.Errorf("Unexpected copy of Search %s: %#v", id, reply.Payload)
+	}
+
+	var sid, _ = strconv.ParseInt(id, 10, 64)
+
+	if search, err = db.SearchGetByID(sid); err != nil {
+		t.Fatalf("Cannot load Search %s: %s", id, err.Error())
+	} else if search.Description != "Things that happened" || search.Query.Query != `"happened - 010"` {
+		t.Errorf("Search %s was not saved correctly: %#v", id, search)
+	}
+
+	for path, expect := range map[string]int{
+		"/search/" + id: 200,
+		"/search/4711":  404,
+	} {
+		if res, err = client.Get(fmt.Sprintf("http://%s%s", addr, path)); err != nil {
+			t.Errorf("Cannot GET %s: %s", path, err.Error())
+			continue
+		}
+
+		res.Body.Close() // nolint: errcheck
+
+		if res.StatusCode != expect {
+			t.Errorf("Unexpected status for %s: %03d (expected %03d)",
+				path,
+				res.StatusCode,
+				expect)
+		}
+	}
+} // func TestServerSearchSaved(t *testing.T)
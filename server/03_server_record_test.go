@@ -0,0 +1,243 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/03_server_record_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 27. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-02 18:37:12 krylon>
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerRecordContext(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		res     *http.Response
+		buf     bytes.Buffer
+		records []model.Record
+		uri     string
+		db      database.Storage
+	)
+
+	db = srv.pool.Get()
+	records, err = db.RecordGetRecent(1)
+	srv.pool.Put(db)
+
+	if err != nil {
+		t.Fatalf("Cannot get most recent Record: %s", err.Error())
+	} else if len(records) == 0 {
+		t.Fatal("There are no Records in the database")
+	}
+
+	uri = fmt.Sprintf("http://%s/record/%d/context?before=5&after=5&source=1",
+		addr,
+		records[0].ID)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), `id="anchor"`) {
+		t.Errorf("Record %d is not marked in its context", records[0].ID)
+	}
+
+	uri = fmt.Sprintf("http://%s/record/%d/context", addr, int64(1)<<62)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 404 {
+		t.Errorf("Unexpected HTTP status for nonexistent Record: %03d",
+			res.StatusCode)
+	}
+} // func TestServerRecordContext(t *testing.T)
+
+var olderRe = regexp.MustCompile(`href="([^"]*before=[^"]*)">Older`)
+
+func TestServerLogRecent(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		res     *http.Response
+		buf     bytes.Buffer
+		records []model.Record
+		uri     string
+		m       []string
+		db      database.Storage
+		page    = &database.RecordPage{Sources: []string{"QA"}, Count: 10}
+	)
+
+	db = srv.pool.Get()
+	records, err = db.RecordGetPage(page)
+	srv.pool.Put(db)
+
+	if err != nil {
+		t.Fatalf("Cannot get most recent page: %s", err.Error())
+	} else if len(records) != 10 {
+		t.Fatalf("Unexpected number of Records from QA: %d", len(records))
+	}
+
+	uri = fmt.Sprintf("http://%s/log/recent/10?source=QA", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), fmt.Sprintf("/record/%d/context", records[9].ID)) {
+		t.Fatalf("Record %d is missing from the page", records[9].ID)
+	} else if m = olderRe.FindStringSubmatch(buf.String()); m == nil {
+		t.Fatal("Page has no link to older Records")
+	}
+
+	uri = fmt.Sprintf("http://%s%s", addr, html.UnescapeString(m[1]))
+	buf.Reset()
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	} else if strings.Contains(buf.String(), fmt.Sprintf("/record/%d/context", records[9].ID)) {
+		t.Errorf("Record %d is on the older page, too", records[9].ID)
+	}
+
+	uri = fmt.Sprintf("http://%s/log/recent/10?before=yesterday", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 400 {
+		t.Errorf("Unexpected HTTP status for invalid position: %03d",
+			res.StatusCode)
+	}
+} // func TestServerLogRecent(t *testing.T)
+
+func TestServerRecord(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		res     *http.Response
+		buf     bytes.Buffer
+		records []model.Record
+		uri     string
+		db      database.Storage
+		reply   model.Response
+		detail  recordDetail
+	)
+
+	db = srv.pool.Get()
+	records, err = db.RecordGetRecent(1)
+	srv.pool.Put(db)
+
+	if err != nil {
+		t.Fatalf("Cannot get most recent Record: %s", err.Error())
+	} else if len(records) == 0 {
+		t.Fatal("There are no Records in the database")
+	}
+
+	uri = fmt.Sprintf("http://%s/record/%d", addr, records[0].ID)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), records[0].Checksum()) {
+		t.Errorf("Page of Record %d does not show its checksum", records[0].ID)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/record/%d", addr, records[0].ID)
+	buf.Reset()
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	} else if err = json.Unmarshal(buf.Bytes(), &reply); err != nil {
+		t.Fatalf("Cannot parse response: %s", err.Error())
+	} else if !reply.Status {
+		t.Fatalf("Server did not find Record %d: %s", records[0].ID, reply.Message)
+	} else if err = json.Unmarshal([]byte(reply.Payload["record"]), &detail); err != nil {
+		t.Fatalf("Cannot parse Record: %s", err.Error())
+	} else if detail.ID != records[0].ID || detail.Message != records[0].Message {
+		t.Errorf("Server sent the wrong Record: %d %q", detail.ID, detail.Message)
+	} else if detail.Checksum != records[0].Checksum() {
+		t.Errorf("Unexpected checksum %s, expected %s",
+			detail.Checksum,
+			records[0].Checksum())
+	} else if detail.Host == "" {
+		t.Error("Record has no Host name")
+	}
+
+	for _, path := range []string{"/record/%d", "/ajax/record/%d"} {
+		uri = fmt.Sprintf("http://%s"+path, addr, int64(1)<<62)
+
+		if res, err = client.Get(uri); err != nil {
+			t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+		}
+
+		res.Body.Close() // nolint: errcheck,gosec
+
+		if res.StatusCode != 404 {
+			t.Errorf("Unexpected HTTP status for nonexistent Record at %s: %03d",
+				uri,
+				res.StatusCode)
+		}
+	}
+} // func TestServerRecord(t *testing.T)
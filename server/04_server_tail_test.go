@@ -0,0 +1,196 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/04_server_tail_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 30. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:55:40 krylon>
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestTailHubDrop(t *testing.T) {
+	var (
+		hub   = newTailHub(log.Default(), nil)
+		query = &model.SearchQuery{}
+		recs  = make([]model.Record, tailBufSize+10)
+		// The Records are all from Host 0, so the hub never has to
+		// look up Hosts it does not know.
+		sub = hub.subscribe(query, []model.Host{{ID: 0}})
+	)
+
+	hub.dispatch(recs)
+
+	if len(sub.q) != tailBufSize {
+		t.Errorf("Unexpected number of queued Records: %d (expected %d)",
+			len(sub.q),
+			tailBufSize)
+	} else if n := sub.dropped.Load(); n != 10 {
+		t.Errorf("Unexpected number of dropped Records: %d (expected 10)", n)
+	}
+
+	hub.unsubscribe(sub)
+
+	// Without subscribers, nothing is queued at all.
+	hub.publish(recs)
+
+	if len(hub.in) != 0 {
+		t.Errorf("Records were queued without any subscribers")
+	}
+} // func TestTailHubDrop(t *testing.T)
+
+func TestTailHubNewHost(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err   error
+		hosts []model.Host
+		query *model.SearchQuery
+		sub   *tailSub
+		db    = srv.pool.Get()
+		hub   = newTailHub(log.Default(), srv.pool)
+		host  = model.Host{Name: "tailnew01.example.com", LastSeen: time.Now()}
+	)
+
+	if hosts, err = db.HostGetAll(); err != nil {
+		srv.pool.Put(db)
+		t.Fatalf("Cannot get Hosts: %s", err.Error())
+	} else if query, err = parseQuery("host:tailnew*", hosts); err != nil {
+		srv.pool.Put(db)
+		t.Fatalf("Cannot parse query: %s", err.Error())
+	}
+
+	sub = hub.subscribe(query, hosts)
+	defer hub.unsubscribe(sub)
+
+	// The Host registers after the client started listening.
+	err = db.HostAdd(&host)
+	srv.pool.Put(db)
+
+	if err != nil {
+		t.Fatalf("Cannot add Host: %s", err.Error())
+	}
+
+	hub.dispatch([]model.Record{
+		{ID: 1, HostID: host.ID, Time: time.Now(), Source: "QA", Message: "Hello"},
+	})
+
+	if len(sub.q) != 1 {
+		t.Errorf("Record from new Host was not matched by %q", query.Query)
+	}
+} // func TestTailHubNewHost(t *testing.T)
+
+func TestServerTail(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	const (
+		matchCnt = 3
+		otherCnt = 2
+	)
+
+	var (
+		err         error
+		res         *http.Response
+		jdata       []byte
+		records     []model.Record
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+		events      = make(chan tailEvent)
+		uri         = fmt.Sprintf("http://%s/log/tail/stream?q=%s",
+			addr,
+			url.QueryEscape(`"tail test"`))
+	)
+
+	defer cancel()
+
+	var req, _ = http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+
+	if res, err = client.Do(req); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	go func() {
+		var scanner = bufio.NewScanner(res.Body)
+
+		defer close(events)
+
+		for scanner.Scan() {
+			var (
+				ev   tailEvent
+				line = scanner.Text()
+			)
+
+			if !strings.HasPrefix(line, "data: {") {
+				continue
+			} else if err := json.Unmarshal([]byte(line[6:]), &ev); err == nil {
+				events <- ev
+			}
+		}
+	}()
+
+	for i := 0; i < matchCnt+otherCnt; i++ {
+		var msg = fmt.Sprintf("Tail test %d", i)
+
+		if i >= matchCnt {
+			msg = fmt.Sprintf("Something else %d", i)
+		}
+
+		records = append(records, model.Record{
+			HostID:  testHost.ID,
+			Time:    time.Now().Add(time.Duration(i) * time.Millisecond),
+			Source:  "QA",
+			Message: msg,
+		})
+	}
+
+	if jdata, err = json.Marshal(records); err != nil {
+		t.Fatalf("Failed to serialize data: %s", err.Error())
+	}
+
+	uri = fmt.Sprintf("http://%s/ws/submit_records", addr)
+
+	var sres *http.Response
+
+	if sres, err = client.Post(uri, "application/json", bytes.NewReader(jdata)); err != nil {
+		t.Fatalf("Error POSTing to %s: %s", uri, err.Error())
+	}
+
+	sres.Body.Close() // nolint: errcheck
+
+	for i := 0; i < matchCnt; i++ {
+		select {
+		case ev := <-events:
+			if ev.Message != records[i].Message || ev.Host != testHost.NameShort() || ev.ID == 0 {
+				t.Errorf("Unexpected event %d: %#v", i, ev)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Received only %d of %d Records", i, matchCnt)
+		}
+	}
+
+	select {
+	case ev := <-events:
+		t.Errorf("Received Record that does not match the query: %#v", ev)
+	case <-time.After(time.Millisecond * 250):
+	}
+} // func TestServerTail(t *testing.T)
@@ -0,0 +1,423 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/05_server_alert_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 03. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:54:12 krylon>
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerAlert(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	const window = time.Minute
+
+	var (
+		err     error
+		id      int64
+		reply   *model.Response
+		status  int
+		body    []byte
+		res     *http.Response
+		buf     bytes.Buffer
+		db      database.Storage
+		alerts  []model.Alert
+		records []model.Record
+		mine    []model.Alert
+		rule    *model.AlertRule
+		now     = time.Now()
+		data    = alertRuleData{
+			Name:      "Alert test",
+			Query:     `"alert test"`,
+			Threshold: 2,
+			Window:    window.String(),
+			PerHost:   true,
+			Active:    true,
+		}
+	)
+
+	body, _ = json.Marshal(&alertRuleData{Name: "Broken", Query: `"x"`, Window: "forever"})
+	if _, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save invalid alert rule: %s", err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for invalid alert rule: %03d", status)
+	}
+
+	body, _ = json.Marshal(&data)
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save alert rule: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving alert rule failed (%03d): %s", status, reply.Message)
+	} else if id, err = strconv.ParseInt(reply.Payload["id"], 10, 64); err != nil {
+		t.Fatalf("Cannot parse ID of alert rule %q: %s",
+			reply.Payload["id"],
+			err.Error())
+	}
+
+	for i := 0; i < 3; i++ {
+		records = append(records, model.Record{
+			HostID:  testHost.ID,
+			Time:    now.Add(time.Duration(i-3) * time.Second),
+			Source:  "QA",
+			Message: fmt.Sprintf("Alert test %d", i),
+		})
+	}
+
+	// The first two Records do not exceed the threshold, the third one
+	// does. Evaluating them again must not raise another Alert.
+	srv.alerts.evaluate(records[:2], now)
+	srv.alerts.evaluate(records[2:], now)
+	srv.alerts.evaluate(records[2:], now)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if alerts, err = db.AlertGetOpen(); err != nil {
+		t.Fatalf("Cannot load open Alerts: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.RuleID == id {
+			mine = append(mine, a)
+		}
+	}
+
+	if len(mine) != 1 {
+		t.Fatalf("Unexpected number of open Alerts: %d (expected 1)", len(mine))
+	} else if mine[0].HostID != testHost.ID {
+		t.Errorf("Alert was raised for Host %d instead of %d",
+			mine[0].HostID,
+			testHost.ID)
+	} else if mine[0].Count != 4 {
+		t.Errorf("Unexpected Count of Alert: %d (expected 4)", mine[0].Count)
+	}
+
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/silence/%d", addr, id),
+		strings.NewReader(`{"duration": "1h"}`)); err != nil {
+		t.Fatalf("Cannot silence alert rule: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Silencing alert rule failed (%03d): %s", status, reply.Message)
+	} else if rule, err = db.AlertRuleGetByID(id); err != nil {
+		t.Fatalf("Cannot load alert rule %d: %s", id, err.Error())
+	} else if !rule.Silenced(now) {
+		t.Errorf("Alert rule %d is not silenced", id)
+	}
+
+	if res, err = client.Get(fmt.Sprintf("http://%s/alerts", addr)); err != nil {
+		t.Fatalf("Cannot GET /alerts: %s", err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Errorf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Errorf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), data.Name) {
+		t.Errorf("Alert rule %q is not listed", data.Name)
+	}
+
+	srv.alerts.check(now.Add(window * 2))
+
+	if alerts, err = db.AlertGetHistory(-1); err != nil {
+		t.Fatalf("Cannot load Alert history: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.ID == mine[0].ID && a.State() != model.AlertResolved {
+			t.Errorf("Alert %d was not resolved", a.ID)
+		}
+	}
+
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/delete/%d", addr, id),
+		strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot delete alert rule: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Errorf("Deleting alert rule failed (%03d): %s", status, reply.Message)
+	} else if rule, err = db.AlertRuleGetByID(id); err != nil {
+		t.Fatalf("Cannot load alert rule %d: %s", id, err.Error())
+	} else if rule != nil {
+		t.Errorf("Alert rule %d still exists after it was deleted", id)
+	}
+} // func TestServerAlert(t *testing.T)
+
+func TestServerNotifier(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err      error
+		id, rid  int64
+		reply    *model.Response
+		status   int
+		body     []byte
+		res      *http.Response
+		buf      bytes.Buffer
+		payloads = make(chan map[string]any, 4)
+		hook     = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p map[string]any
+			json.NewDecoder(r.Body).Decode(&p) // nolint: errcheck
+			// Hosts may go silent while the test is running, we are
+			// only interested in our own rule.
+			if p["test"] == true || p["rule"] == "Notifier test" {
+				payloads <- p
+			}
+		}))
+		data = notifierData{
+			Name:   "Notifier test",
+			Kind:   "webhook",
+			Target: hook.URL,
+			Active: true,
+		}
+		rule = alertRuleData{
+			Name:      "Notifier test",
+			Query:     `"notifier test"`,
+			Threshold: 0,
+			Window:    "1m",
+			Active:    true,
+		}
+		now = time.Now()
+	)
+
+	defer hook.Close()
+
+	body, _ = json.Marshal(&notifierData{Name: "Broken", Kind: "webhook", Target: hook.URL, Template: "{{ .Nope }}"})
+	if _, status, err = getReply(fmt.Sprintf("http://%s/ajax/notifier/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save invalid Notifier: %s", err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for Notifier with broken template: %03d", status)
+	}
+
+	body, _ = json.Marshal(&data)
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/notifier/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save Notifier: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving Notifier failed (%03d): %s", status, reply.Message)
+	} else if id, err = strconv.ParseInt(reply.Payload["id"], 10, 64); err != nil {
+		t.Fatalf("Cannot parse ID of Notifier %q: %s",
+			reply.Payload["id"],
+			err.Error())
+	}
+
+	if _, status, err = getReply(fmt.Sprintf("http://%s/ajax/notifier/test/%d", addr, id),
+		nil); err != nil {
+		t.Fatalf("Cannot GET test message: %s", err.Error())
+	} else if status != 405 {
+		t.Errorf("Unexpected HTTP status for GET of test message: %03d", status)
+	}
+
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/notifier/test/%d", addr, id),
+		strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot send test message: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Errorf("Sending test message failed (%03d): %s", status, reply.Message)
+	} else if p := <-payloads; p["test"] != true {
+		t.Errorf("Webhook did not receive a test message: %v", p)
+	}
+
+	body, _ = json.Marshal(&rule)
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save alert rule: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving alert rule failed (%03d): %s", status, reply.Message)
+	} else if rid, err = strconv.ParseInt(reply.Payload["id"], 10, 64); err != nil {
+		t.Fatalf("Cannot parse ID of alert rule %q: %s",
+			reply.Payload["id"],
+			err.Error())
+	}
+
+	srv.alerts.evaluate([]model.Record{{
+		HostID:  testHost.ID,
+		Time:    now,
+		Source:  "QA",
+		Message: "Notifier test",
+	}}, now)
+	srv.alerts.check(now.Add(time.Minute * 2))
+	srv.notify.Wait()
+
+	// Messages are delivered concurrently, so they may arrive in any order.
+	var states = make(map[string]bool)
+
+	for len(payloads) > 0 {
+		var p = <-payloads
+
+		if p["rule"] != rule.Name {
+			t.Errorf("Unexpected payload: %v", p)
+		} else if s, ok := p["state"].(string); ok {
+			states[s] = true
+		}
+	}
+
+	if !states["firing"] || !states["resolved"] {
+		t.Errorf("Webhook was not told that the rule fired and was resolved: %v",
+			states)
+	}
+
+	if res, err = client.Get(fmt.Sprintf("http://%s/notifiers", addr)); err != nil {
+		t.Fatalf("Cannot GET /notifiers: %s", err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Errorf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Errorf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), data.Name) {
+		t.Errorf("Notifier %q is not listed", data.Name)
+	} else if !strings.Contains(buf.String(), "test message") {
+		t.Error("Delivery of the test message is not listed")
+	}
+
+	for _, uri := range []string{
+		fmt.Sprintf("http://%s/ajax/notifier/delete/%d", addr, id),
+		fmt.Sprintf("http://%s/ajax/alert/rule/delete/%d", addr, rid),
+	} {
+		if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+			t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+		} else if status != 200 || !reply.Status {
+			t.Errorf("POST %s failed (%03d): %s", uri, status, reply.Message)
+		}
+	}
+} // func TestServerNotifier(t *testing.T)
+
+func TestServerHostWatch(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		reply  *model.Response
+		status int
+		res    *http.Response
+		buf    bytes.Buffer
+		db     database.Storage
+		rules  []model.AlertRule
+		alerts []model.Alert
+		host   *model.Host
+		rule   *model.AlertRule
+		fired  int64
+		uri    = fmt.Sprintf("http://%s/ajax/host/watch/%d", addr, testHost.ID)
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if rules, err = db.AlertRuleGetAll(); err != nil {
+		t.Fatalf("Cannot load alert rules: %s", err.Error())
+	}
+
+	for i := range rules {
+		if rules[i].Kind == model.RuleSilence {
+			rule = &rules[i]
+		}
+	}
+
+	if rule == nil {
+		t.Fatal("There is no rule that watches for silent Hosts")
+	}
+
+	if _, status, err = getReply(uri, strings.NewReader(`{"threshold": "soon"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for invalid threshold: %03d", status)
+	}
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"threshold": "1m"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Setting threshold failed (%03d): %s", status, reply.Message)
+	} else if host, err = db.HostGetByID(testHost.ID); err != nil {
+		t.Fatalf("Cannot load Host %d: %s", testHost.ID, err.Error())
+	} else if host.SilenceThreshold != time.Minute {
+		t.Errorf("Threshold of Host %s was not saved: %s",
+			host.Name,
+			host.SilenceThreshold)
+	}
+
+	// Two minutes from now, the Host has been silent for too long.
+	srv.alerts.check(time.Now().Add(time.Minute * 2))
+
+	if !srv.alerts.silentHosts()[testHost.ID] {
+		t.Fatalf("Host %s was not flagged as silent", testHost.Name)
+	} else if alerts, err = db.AlertGetOpen(); err != nil {
+		t.Fatalf("Cannot load open Alerts: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.RuleID == rule.ID && a.HostID == testHost.ID {
+			fired = a.ID
+		}
+	}
+
+	if fired == 0 {
+		t.Errorf("No Alert was raised for silent Host %s", testHost.Name)
+	}
+
+	if res, err = client.Get(fmt.Sprintf("http://%s/main", addr)); err != nil {
+		t.Fatalf("Cannot GET /main: %s", err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Errorf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Errorf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), "<td>silent</td>") {
+		t.Error("Silent Host is not shown as silent")
+	}
+
+	// Going into maintenance resolves the Alert right away.
+	if reply, status, err = getReply(uri, strings.NewReader(`{"threshold": "1m", "maintenance": true}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Setting maintenance failed (%03d): %s", status, reply.Message)
+	} else if reply.Payload["silent"] != "false" {
+		t.Errorf("Host %s in maintenance is still silent", testHost.Name)
+	}
+
+	srv.alerts.check(time.Now().Add(time.Minute * 2))
+
+	if srv.alerts.silentHosts()[testHost.ID] {
+		t.Errorf("Host %s in maintenance was flagged as silent", testHost.Name)
+	} else if alerts, err = db.AlertGetHistory(-1); err != nil {
+		t.Fatalf("Cannot load Alert history: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.ID == fired && a.State() != model.AlertResolved {
+			t.Errorf("Alert %d was not resolved when Host went into maintenance", a.ID)
+		}
+	}
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"threshold": ""}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Errorf("Resetting watch settings failed (%03d): %s", status, reply.Message)
+	}
+} // func TestServerHostWatch(t *testing.T)
@@ -0,0 +1,166 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/06_server_pattern_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-06 19:55:18 krylon>
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerPattern(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	const tmpl = "Pattern test: user <*> logged in from <*>"
+
+	var (
+		err      error
+		res      *http.Response
+		buf      bytes.Buffer
+		db       database.Storage
+		patterns []model.Pattern
+		pat      *model.Pattern
+		uri      string
+		now      = time.Now()
+		users    = []string{"alice", "bob", "carol"}
+		records  = make([]model.Record, len(users))
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	for i, u := range users {
+		records[i] = model.Record{
+			HostID:  testHost.ID,
+			Time:    now.Add(time.Duration(i-len(users)) * time.Second),
+			Source:  "QA",
+			Message: fmt.Sprintf("Pattern test: user %s logged in from 10.0.0.%d", u, i+1),
+		}
+
+		if err = db.RecordAdd(&records[i]); err != nil {
+			t.Fatalf("Cannot add Record %q: %s", records[i].Message, err.Error())
+		}
+	}
+
+	// The miner must pick up where it left off after a restart, so we
+	// reload it between the batches.
+	if err = srv.patterns.ingest(records[:2]); err != nil {
+		t.Fatalf("Cannot mine Patterns: %s", err.Error())
+	} else if err = srv.patterns.load(); err != nil {
+		t.Fatalf("Cannot reload Patterns: %s", err.Error())
+	} else if err = srv.patterns.ingest(records[2:]); err != nil {
+		t.Fatalf("Cannot mine Patterns after reload: %s", err.Error())
+	} else if patterns, err = db.PatternGetAll(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Cannot load Patterns: %s", err.Error())
+	}
+
+	for i := range patterns {
+		if patterns[i].Template == tmpl {
+			if pat != nil {
+				t.Errorf("There is more than one Pattern %q", tmpl)
+			}
+			pat = &patterns[i]
+		}
+	}
+
+	if pat == nil {
+		t.Fatalf("Pattern %q was not found among %d Patterns", tmpl, len(patterns))
+	} else if pat.Count != int64(len(users)) || pat.Recent != int64(len(users)) {
+		t.Errorf("Pattern %q matches %d Records (%d recently), expected %d",
+			tmpl,
+			pat.Count,
+			pat.Recent,
+			len(users))
+	}
+
+	uri = fmt.Sprintf("http://%s/patterns", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(buf.String(), html.EscapeString(tmpl)) {
+		t.Errorf("Pattern %q is missing from the patterns page", tmpl)
+	}
+
+	buf.Reset()
+	uri = fmt.Sprintf("http://%s/pattern/%d", addr, pat.ID)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	}
+
+	for _, r := range records {
+		if !strings.Contains(buf.String(), fmt.Sprintf(`href="/record/%d"`, r.ID)) {
+			t.Errorf("Record %d is missing from the page of Pattern %d", r.ID, pat.ID)
+		}
+	}
+
+	uri = fmt.Sprintf("http://%s/pattern/%d", addr, pat.ID+1000000)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 404 {
+		t.Errorf("Unexpected HTTP status for nonexistent Pattern: %03d",
+			res.StatusCode)
+	}
+} // func TestServerPattern(t *testing.T)
+
+func TestPatternHistogram(t *testing.T) {
+	var (
+		begin = time.Date(2024, time.October, 6, 10, 30, 0, 0, time.UTC)
+		end   = begin.Add(time.Hour * 3)
+		hist  []model.Bucket
+		maxc  int64
+	)
+
+	hist, maxc = patternHistogram([]model.Bucket{
+		{Begin: begin.Truncate(time.Hour).Add(-time.Hour), Count: 99},
+		{Begin: begin.Truncate(time.Hour).Add(time.Hour), Count: 3},
+		{Begin: begin.Truncate(time.Hour).Add(time.Hour * 3), Count: 5},
+	}, begin, end)
+
+	if len(hist) != 4 {
+		t.Fatalf("Histogram has %d buckets, expected 4", len(hist))
+	} else if maxc != 5 {
+		t.Errorf("Largest bucket holds %d, expected 5", maxc)
+	}
+
+	for i, cnt := range []int64{0, 3, 0, 5} {
+		if hist[i].Count != cnt {
+			t.Errorf("Bucket #%d holds %d, expected %d", i, hist[i].Count, cnt)
+		}
+	}
+} // func TestPatternHistogram(t *testing.T)
@@ -0,0 +1,143 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/07_server_rate_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 07. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-07 18:40:19 krylon>
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerRate(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		id     int64
+		reply  *model.Response
+		status int
+		body   []byte
+		res    *http.Response
+		buf    bytes.Buffer
+		db     database.Storage
+		alerts []model.Alert
+		fired  int64
+		now    = time.Now()
+		data   = alertRuleData{
+			Name:      "Rate test",
+			Kind:      "anomaly",
+			Threshold: 0,
+			Window:    "10m",
+			PerHost:   true,
+			Active:    true,
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	// Computing the rates from the Records we have would not give us
+	// anything unusual, so we tell the monitor what it found.
+	srv.rates.lock.Lock()
+	srv.rates.stats = []model.RateStat{
+		{
+			HostID:    testHost.ID,
+			Source:    "QA",
+			Count:     500,
+			Expected:  20,
+			StdDev:    5,
+			Samples:   7,
+			Score:     96,
+			Anomalous: true,
+		},
+	}
+	srv.rates.stamp = now
+	srv.rates.lock.Unlock()
+
+	if res, err = client.Get(fmt.Sprintf("http://%s/rates", addr)); err != nil {
+		t.Fatalf("Cannot GET /rates: %s", err.Error())
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != 200 {
+		t.Errorf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Errorf("Error reading response body: %s", err.Error())
+	} else if !strings.Contains(buf.String(), "Spike") {
+		t.Error("Unusual rate is not shown as a spike")
+	}
+
+	body, _ = json.Marshal(&data)
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/save", addr),
+		bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot save alert rule: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving alert rule failed (%03d): %s", status, reply.Message)
+	} else if id, err = strconv.ParseInt(reply.Payload["id"], 10, 64); err != nil {
+		t.Fatalf("Cannot parse ID of alert rule %q: %s",
+			reply.Payload["id"],
+			err.Error())
+	}
+
+	srv.alerts.check(now)
+
+	if alerts, err = db.AlertGetOpen(); err != nil {
+		t.Fatalf("Cannot load open Alerts: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.RuleID == id && a.HostID == testHost.ID {
+			fired = a.ID
+			if a.Count != 1 {
+				t.Errorf("Unexpected count of Alert %d: %d", a.ID, a.Count)
+			}
+		}
+	}
+
+	if fired == 0 {
+		t.Fatalf("No Alert was raised for the unusual rate on Host %s",
+			testHost.Name)
+	}
+
+	// Once things are back to normal, the Alert is resolved.
+	srv.rates.lock.Lock()
+	srv.rates.stats[0].Count = 22
+	srv.rates.stats[0].Score = 0.4
+	srv.rates.stats[0].Anomalous = false
+	srv.rates.lock.Unlock()
+
+	srv.alerts.check(now)
+
+	if alerts, err = db.AlertGetHistory(-1); err != nil {
+		t.Fatalf("Cannot load Alert history: %s", err.Error())
+	}
+
+	for _, a := range alerts {
+		if a.ID == fired && a.State() != model.AlertResolved {
+			t.Errorf("Alert %d was not resolved after the rate went back to normal", a.ID)
+		}
+	}
+
+	if reply, status, err = getReply(fmt.Sprintf("http://%s/ajax/alert/rule/delete/%d", addr, id),
+		nil); err != nil {
+		t.Fatalf("Cannot delete alert rule %d: %s", id, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Errorf("Deleting alert rule %d failed (%03d): %s", id, status, reply.Message)
+	}
+} // func TestServerRate(t *testing.T)
@@ -0,0 +1,131 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/08_server_novelty_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 08. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-08 17:58:26 krylon>
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerNovelty(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		reply   *model.Response
+		status  int
+		res     *http.Response
+		buf     bytes.Buffer
+		db      database.Storage
+		feed    []model.Novelty
+		novel   []model.Novelty
+		uri     string
+		now     = time.Now()
+		records = []model.Record{
+			{
+				HostID:  testHost.ID,
+				Time:    now.Add(-time.Second * 2),
+				Source:  "kernel",
+				Message: "Novelty test: disk sda is on fire",
+			},
+			{
+				HostID:  testHost.ID,
+				Time:    now.Add(-time.Second),
+				Source:  "kernel",
+				Message: "Novelty test: disk sdb is on fire",
+			},
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	for i := range records {
+		if err = db.RecordAdd(&records[i]); err != nil {
+			t.Fatalf("Cannot add Record %q: %s", records[i].Message, err.Error())
+		}
+	}
+
+	// The second message is merely the first one with a different disk,
+	// there is nothing new about it.
+	if err = srv.patterns.ingest(records[:1]); err != nil {
+		t.Fatalf("Cannot mine Patterns: %s", err.Error())
+	} else if err = srv.patterns.ingest(records[1:]); err != nil {
+		t.Fatalf("Cannot mine Patterns: %s", err.Error())
+	} else if feed, err = db.NoveltyGetRecent(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Cannot load novel messages: %s", err.Error())
+	}
+
+	for _, n := range feed {
+		if strings.HasPrefix(n.Template, "Novelty test:") {
+			novel = append(novel, n)
+		}
+	}
+
+	if len(novel) != 1 {
+		t.Fatalf("Unexpected number of novel messages: %d (expected 1)", len(novel))
+	} else if novel[0].RecordID != records[0].ID || novel[0].Source != "kernel" {
+		t.Errorf("Unexpected novel message: %#v", novel[0])
+	}
+
+	uri = fmt.Sprintf("http://%s/novel/", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(buf.String(), fmt.Sprintf(`id="novelty_%d"`, novel[0].ID)) {
+		t.Errorf("Novelty %d is missing from the feed", novel[0].ID)
+	}
+
+	uri = fmt.Sprintf("http://%s/novel/0", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 400 {
+		t.Errorf("Unexpected HTTP status for an empty period: %03d", res.StatusCode)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/novelty/ack/%d", addr, novel[0].ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Acknowledging Novelty %d failed (%03d): %s",
+			novel[0].ID,
+			status,
+			reply.Message)
+	} else if feed, err = db.NoveltyGetRecent(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Cannot load novel messages: %s", err.Error())
+	}
+
+	for _, n := range feed {
+		if n.ID == novel[0].ID {
+			t.Errorf("Acknowledged Novelty %d is still in the feed", n.ID)
+		}
+	}
+} // func TestServerNovelty(t *testing.T)
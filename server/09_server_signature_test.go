@@ -0,0 +1,149 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/09_server_signature_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-09 20:38:51 krylon>
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/detect"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerSignature(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err    error
+		reply  *model.Response
+		status int
+		res    *http.Response
+		buf    bytes.Buffer
+		db     database.Storage
+		sigs   []model.Signature
+		found  []model.Detection
+		oom    *model.Signature
+		uri    string
+		sigID  string
+		names  = make(map[string]*model.Signature)
+		rec    = model.Record{
+			HostID:  testHost.ID,
+			Time:    time.Now(),
+			Source:  "kernel",
+			Message: "Out of memory: Killed process 4711 (java) total-vm:8123456kB",
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = srv.detector.load(db); err != nil {
+		t.Fatalf("Cannot load Signatures: %s", err.Error())
+	} else if sigs, err = db.SignatureGetAll(); err != nil {
+		t.Fatalf("Cannot query Signatures: %s", err.Error())
+	}
+
+	for i := range sigs {
+		names[sigs[i].Name] = &sigs[i]
+	}
+
+	for _, lib := range detect.Library() {
+		if s := names[lib.Name]; s == nil || !s.Builtin {
+			t.Errorf("Built-in Signature %q is missing", lib.Name)
+		}
+	}
+
+	if oom = names["OOM kill"]; oom == nil {
+		t.FailNow()
+	} else if err = db.RecordAdd(&rec); err != nil {
+		t.Fatalf("Cannot add Record: %s", err.Error())
+	} else if err = srv.detector.scan([]model.Record{rec}); err != nil {
+		t.Fatalf("Cannot scan Record: %s", err.Error())
+	} else if found, err = db.DetectionGetByRecord(rec.ID); err != nil {
+		t.Fatalf("Cannot query Detections: %s", err.Error())
+	} else if len(found) != 1 || found[0].SignatureID != oom.ID {
+		t.Fatalf("Unexpected Detections for Record %d: %#v", rec.ID, found)
+	}
+
+	uri = fmt.Sprintf("http://%s/record/%d", addr, rec.ID)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(buf.String(), "memory/critical: OOM kill") {
+		t.Errorf("Record %d is not tagged", rec.ID)
+	}
+
+	buf.Reset()
+	uri = fmt.Sprintf("http://%s/signatures", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(buf.String(), fmt.Sprintf(`href="/record/%d"`, rec.ID)) {
+		t.Errorf("Detection of Record %d is missing", rec.ID)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/signature/save", addr)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{
+"name": "Coffee",
+"category": "kitchen",
+"severity": "warning",
+"query": "/coffee machine is empty/",
+"active": true
+}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving Signature failed (%03d): %s", status, reply.Message)
+	}
+
+	sigID = reply.Payload["id"]
+
+	uri = fmt.Sprintf("http://%s/ajax/signature/delete/%d", addr, oom.ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Deleting a built-in Signature should fail (%03d): %s",
+			status,
+			reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/signature/delete/%s", addr, sigID)
+
+	if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Errorf("Deleting Signature %s failed (%03d): %s",
+			sigID,
+			status,
+			reply.Message)
+	}
+} // func TestServerSignature(t *testing.T)
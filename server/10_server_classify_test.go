@@ -0,0 +1,130 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/10_server_classify_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 12:28:10 krylon>
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerClassify(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		reply   *model.Response
+		status  int
+		res     *http.Response
+		buf     bytes.Buffer
+		db      database.Storage
+		scores  []model.Score
+		uri     string
+		now     = time.Now()
+		values  = make(map[int64]float64)
+		labeled = []model.Record{
+			{Source: "CRON", Message: "(root) CMD (run-parts /etc/cron.hourly)"},
+			{Source: "CRON", Message: "(root) CMD (/usr/lib/sa/sa1 1 1)"},
+			{Source: "kernel", Message: "EXT4-fs error (device sda1): reading directory lblock 0"},
+		}
+		fresh = []model.Record{
+			{Source: "CRON", Message: "(root) CMD (run-parts /etc/cron.daily)"},
+			{Source: "kernel", Message: "EXT4-fs error (device sdb2): reading directory lblock 0"},
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	for i, rec := range append(labeled, fresh...) {
+		rec.HostID = testHost.ID
+		rec.Time = now.Add(time.Duration(i-10) * time.Second)
+
+		if err = db.RecordAdd(&rec); err != nil {
+			t.Fatalf("Cannot add Record %q: %s", rec.Message, err.Error())
+		} else if i < len(labeled) {
+			labeled[i] = rec
+		} else {
+			fresh[i-len(labeled)] = rec
+		}
+	}
+
+	for i, rec := range labeled {
+		var label = "boring"
+
+		if i == len(labeled)-1 {
+			label = "interesting"
+		}
+
+		uri = fmt.Sprintf("http://%s/ajax/record/label/%d", addr, rec.ID)
+
+		if reply, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"label": %q}`, label))); err != nil {
+			t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+		} else if status != 200 || !reply.Status {
+			t.Fatalf("Labeling Record %d failed (%03d): %s", rec.ID, status, reply.Message)
+		}
+	}
+
+	if _, status, err = getReply(uri, strings.NewReader(`{"label": "meh"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for an invalid label: %03d", status)
+	}
+
+	if err = srv.classifier.fit(); err != nil {
+		t.Fatalf("Cannot train classifier: %s", err.Error())
+	} else if !srv.classifier.current().Ready() {
+		t.Fatal("Classifier is not ready after training")
+	} else if err = srv.classifier.score(fresh); err != nil {
+		t.Fatalf("Cannot score Records: %s", err.Error())
+	} else if scores, err = db.ScoreGetTop(now.Add(-time.Hour), -1); err != nil {
+		t.Fatalf("Cannot get Scores: %s", err.Error())
+	}
+
+	for _, s := range scores {
+		values[s.RecordID] = s.Value
+	}
+
+	// The labeled Records were never published, so their Scores come
+	// from rescoring the recent Records after training.
+	for _, rec := range labeled {
+		if _, ok := values[rec.ID]; !ok {
+			t.Errorf("Record %d was not scored again after training", rec.ID)
+		}
+	}
+
+	if values[fresh[1].ID] <= values[fresh[0].ID] {
+		t.Errorf("File system error scored %f, cron job scored %f",
+			values[fresh[1].ID],
+			values[fresh[0].ID])
+	}
+
+	uri = fmt.Sprintf("http://%s/interesting", addr)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(buf.String(), fmt.Sprintf(`id="record_%d"`, fresh[1].ID)) {
+		t.Errorf("Record %d is missing from the list", fresh[1].ID)
+	}
+} // func TestServerClassify(t *testing.T)
@@ -0,0 +1,158 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/11_server_annotation_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 11. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-11 17:55:03 krylon>
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+func TestServerAnnotation(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		reply   *model.Response
+		status  int
+		res     *http.Response
+		buf     bytes.Buffer
+		db      database.Storage
+		uri     string
+		job     string
+		noteID  string
+		now     = time.Now()
+		note    = "Replaced the disk afterwards"
+		records = []model.Record{
+			{Source: "kernel", Message: "EXT4-fs warning (device sdc1): ext4_end_bio: I/O error"},
+			{Source: "kernel", Message: "EXT4-fs warning (device sdc1): ext4_end_bio: I/O retry"},
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	for i := range records {
+		records[i].HostID = testHost.ID
+		records[i].Time = now.Add(time.Duration(i-5) * time.Second)
+
+		if err = db.RecordAdd(&records[i]); err != nil {
+			t.Fatalf("Cannot add Record %q: %s", records[i].Message, err.Error())
+		}
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/record/tag/%d", addr, records[0].ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"tag": " Disk-Failure "}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Tagging Record %d failed (%03d): %s", records[0].ID, status, reply.Message)
+	} else if reply.Payload["tag"] != "disk-failure" {
+		t.Errorf("Tag was not normalized: %q", reply.Payload["tag"])
+	} else if _, status, err = getReply(uri, strings.NewReader(`{"tag": "two words"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for an invalid tag: %03d", status)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/record/tag/%d", addr, records[1].ID+4711)
+
+	if _, status, err = getReply(uri, strings.NewReader(`{"tag": "nowhere"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 404 {
+		t.Errorf("Unexpected HTTP status for tagging a missing Record: %03d", status)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/record/annotate/%d", addr, records[0].ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"text": %q}`, note))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Annotating Record %d failed (%03d): %s", records[0].ID, status, reply.Message)
+	} else if noteID = reply.Payload["id"]; noteID == "" {
+		t.Errorf("Reply does not contain the ID of the Annotation: %#v", reply.Payload)
+	} else if _, status, err = getReply(uri, strings.NewReader(`{"text": "  "}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for an empty Annotation: %03d", status)
+	}
+
+	// Only the tagged Record shows up when searching for the Tag, and the
+	// results display its Tag and Annotation.
+	uri = fmt.Sprintf("http://%s/ajax/search/create", addr)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"query": "ext4_end_bio tag:disk-*"}`)); err != nil {
+		t.Fatalf("Cannot create search: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot create search: %03d %s", status, reply.Message)
+	} else if job = reply.Payload["job"]; job == "" {
+		t.Fatalf("Reply does not contain a job ID: %#v", reply.Payload)
+	}
+
+	reply = waitJob(t, job)
+
+	if reply.Payload["status"] != "done" {
+		t.Fatalf("Search job %s did not finish: %#v", job, reply.Payload)
+	} else if reply.Payload["matched"] != "1" {
+		t.Fatalf("Unexpected number of results: %#v", reply.Payload)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/search/load/%s/1", addr, reply.Payload["id"])
+
+	if reply, status, err = getReply(uri, nil); err != nil {
+		t.Fatalf("Cannot load search results: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot load search results: %03d %s", status, reply.Message)
+	} else if !strings.Contains(reply.Payload["results"], "disk-failure") {
+		t.Errorf("Search results do not show the Tag")
+	} else if !strings.Contains(reply.Payload["results"], note) {
+		t.Errorf("Search results do not show the Annotation")
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/record/untag/%d", addr, records[0].ID)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"tag": "disk-failure"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Removing Tag failed (%03d): %s", status, reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/annotation/delete/%s", addr, noteID)
+
+	if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Deleting Annotation failed (%03d): %s", status, reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/record/%d", addr, records[0].ID)
+
+	if res, err = client.Get(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if _, err = io.Copy(&buf, res.Body); err != nil {
+		t.Fatalf("Error reading response body: %s", err.Error())
+	}
+
+	res.Body.Close() // nolint: errcheck,gosec
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if strings.Contains(buf.String(), "disk-failure") {
+		t.Errorf("Record page still shows the removed Tag")
+	} else if strings.Contains(buf.String(), note) {
+		t.Errorf("Record page still shows the deleted Annotation")
+	}
+} // func TestServerAnnotation(t *testing.T)
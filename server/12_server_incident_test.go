@@ -0,0 +1,227 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/12_server_incident_test.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 12. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-12 18:09:12 krylon>
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// getPage fetches a page and returns its body along with the HTTP status.
+func getPage(uri string) (string, *http.Response, error) {
+	var (
+		err error
+		res *http.Response
+		buf bytes.Buffer
+	)
+
+	if res, err = client.Get(uri); err != nil {
+		return "", nil, err
+	}
+
+	defer res.Body.Close() // nolint: errcheck
+
+	if _, err = io.Copy(&buf, res.Body); err != nil {
+		return "", res, err
+	}
+
+	return buf.String(), res, nil
+} // func getPage(uri string) (string, *http.Response, error)
+
+func TestServerIncident(t *testing.T) {
+	if srv == nil {
+		t.SkipNow()
+	}
+
+	var (
+		err     error
+		reply   *model.Response
+		status  int
+		res     *http.Response
+		db      database.Storage
+		uri     string
+		job     string
+		sid     string
+		iid     string
+		page    string
+		body    []byte
+		now     = time.Now()
+		note    = "Pager went off here"
+		records = []model.Record{
+			{Source: "nginx", Message: "upstream timed out (110: Connection timed out) while reading response header"},
+			{Source: "nginx", Message: "upstream timed out (110: Connection timed out) while connecting to upstream"},
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	for i := range records {
+		records[i].HostID = testHost.ID
+		records[i].Time = now.Add(time.Duration(i-10) * time.Second)
+
+		if err = db.RecordAdd(&records[i]); err != nil {
+			t.Fatalf("Cannot add Record %q: %s", records[i].Message, err.Error())
+		}
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/incident/save", addr)
+
+	if body, err = json.Marshal(&incidentData{Summary: "No title"}); err != nil {
+		t.Fatalf("Cannot serialize Incident: %s", err.Error())
+	} else if _, status, err = getReply(uri, bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for an Incident without a title: %03d", status)
+	} else if body, err = json.Marshal(&incidentData{
+		Title: "Upstream timeouts",
+		Begin: now.Add(-time.Hour),
+	}); err != nil {
+		t.Fatalf("Cannot serialize Incident: %s", err.Error())
+	} else if reply, status, err = getReply(uri, bytes.NewReader(body)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Creating Incident failed (%03d): %s", status, reply.Message)
+	} else if iid = reply.Payload["id"]; iid == "" {
+		t.Fatalf("Reply does not contain the ID of the Incident: %#v", reply.Payload)
+	}
+
+	uri = fmt.Sprintf("http://%s/incidents", addr)
+
+	if page, res, err = getPage(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(page, "/incident/"+iid) {
+		t.Errorf("Incident %s is not listed", iid)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/search/create", addr)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"query": "source:nginx upstream timed out"}`)); err != nil {
+		t.Fatalf("Cannot create search: %s", err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Cannot create search: %03d %s", status, reply.Message)
+	} else if job = reply.Payload["job"]; job == "" {
+		t.Fatalf("Reply does not contain a job ID: %#v", reply.Payload)
+	}
+
+	reply = waitJob(t, job)
+
+	if reply.Payload["status"] != "done" {
+		t.Fatalf("Search job %s did not finish: %#v", job, reply.Payload)
+	}
+
+	sid = reply.Payload["id"]
+
+	// Searches have to be saved before they can be pinned.
+	uri = fmt.Sprintf("http://%s/ajax/incident/pin/%s", addr, iid)
+
+	if _, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"search": %s}`, sid))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for pinning an unsaved Search: %03d", status)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/search/save/%s", addr, sid)
+
+	if reply, status, err = getReply(uri, strings.NewReader(`{"title": "Timeouts"}`)); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Saving Search %s failed (%03d): %s", sid, status, reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/incident/pin/%s", addr, iid)
+
+	if reply, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"search": %s}`, sid))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Pinning Search %s failed (%03d): %s", sid, status, reply.Message)
+	} else if reply, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"record": %d, "note": %q}`, records[0].ID, note))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Pinning Record %d failed (%03d): %s", records[0].ID, status, reply.Message)
+	} else if _, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"record": %d}`, records[1].ID+4711))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 404 {
+		t.Errorf("Unexpected HTTP status for pinning a missing Record: %03d", status)
+	} else if _, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 400 {
+		t.Errorf("Unexpected HTTP status for pinning nothing: %03d", status)
+	}
+
+	// The timeline shows both Records, only the first one is pinned.
+	uri = fmt.Sprintf("http://%s/incident/%s", addr, iid)
+
+	if page, res, err = getPage(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.Contains(page, note) {
+		t.Errorf("Incident page does not show the note on the pinned Record")
+	} else if !strings.Contains(page, "while connecting to upstream") {
+		t.Errorf("Incident page does not show the results of the pinned Search")
+	} else if !strings.Contains(page, "pinned, Timeouts") {
+		t.Errorf("Incident page does not show where the pinned Record came from")
+	}
+
+	uri = fmt.Sprintf("http://%s/incident/%s/export?format=markdown", addr, iid)
+
+	if page, res, err = getPage(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 200 {
+		t.Fatalf("Unexpected HTTP status %03d", res.StatusCode)
+	} else if !strings.HasPrefix(page, "# Incident: Upstream timeouts") {
+		t.Errorf("Unexpected report:\n%s", page)
+	} else if !strings.Contains(res.Header.Get("Content-Disposition"), "incident_"+iid+".md") {
+		t.Errorf("Unexpected Content-Disposition: %q", res.Header.Get("Content-Disposition"))
+	} else if strings.Count(page, "(110: Connection timed out)") != 2 {
+		t.Errorf("Report does not contain both Records:\n%s", page)
+	}
+
+	uri = fmt.Sprintf("http://%s/incident/%s/export?format=pdf", addr, iid)
+
+	if _, res, err = getPage(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 400 {
+		t.Errorf("Unexpected HTTP status for an invalid report format: %03d", res.StatusCode)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/incident/unpin/%s", addr, iid)
+
+	if reply, status, err = getReply(uri, strings.NewReader(fmt.Sprintf(`{"record": %d}`, records[0].ID))); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Unpinning Record %d failed (%03d): %s", records[0].ID, status, reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/ajax/incident/delete/%s", addr, iid)
+
+	if reply, status, err = getReply(uri, strings.NewReader("{}")); err != nil {
+		t.Fatalf("Cannot POST %s: %s", uri, err.Error())
+	} else if status != 200 || !reply.Status {
+		t.Fatalf("Deleting Incident %s failed (%03d): %s", iid, status, reply.Message)
+	}
+
+	uri = fmt.Sprintf("http://%s/incident/%s", addr, iid)
+
+	if _, res, err = getPage(uri); err != nil {
+		t.Fatalf("Cannot GET %s: %s", uri, err.Error())
+	} else if res.StatusCode != 404 {
+		t.Errorf("Unexpected HTTP status for a deleted Incident: %03d", res.StatusCode)
+	}
+} // func TestServerIncident(t *testing.T)
@@ -0,0 +1,112 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/admin.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 21. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:52:07 krylon>
+//
+// This file contains handlers for administrative tasks.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+)
+
+// isLocal returns true if the request comes from the loopback interface.
+// There is no authentication, yet, so administrative handlers only accept
+// requests from the local machine.
+func isLocal(r *http.Request) bool {
+	var (
+		err  error
+		host string
+		addr net.IP
+	)
+
+	if host, _, err = net.SplitHostPort(r.RemoteAddr); err != nil {
+		return false
+	} else if addr = net.ParseIP(host); addr == nil {
+		return false
+	}
+
+	return addr.IsLoopback()
+} // func isLocal(r *http.Request) bool
+
+// notifierAccess checks if r may change or trigger Notifiers. Notifiers run
+// commands and send requests on behalf of the server, so like the
+// administrative handlers, we only accept POST requests from the local
+// machine. If r is refused, we return the HTTP status and the reason.
+func notifierAccess(r *http.Request) (int, string) {
+	if !isLocal(r) {
+		return http.StatusForbidden, "Notifiers can only be managed from localhost"
+	} else if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, "Notifier requests must be POSTed"
+	}
+
+	return http.StatusOK, ""
+} // func notifierAccess(r *http.Request) (int, string)
+
+// handleAdminBackup sends a snapshot of the database to the client.
+// If the query parameter compress is true, the snapshot is compressed.
+func (srv *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err      error
+		msg      string
+		compress bool
+		db       database.Storage
+		sdb      *database.Database
+		ok       bool
+		mimeType = "application/x-tar"
+	)
+
+	if !isLocal(r) {
+		srv.log.Printf("[INFO] Refuse backup request from %s\n",
+			r.RemoteAddr)
+		http.Error(w, "Backups can only be requested from localhost", http.StatusForbidden)
+		return
+	}
+
+	if cstr := r.URL.Query().Get("compress"); cstr != "" {
+		if compress, err = strconv.ParseBool(cstr); err != nil {
+			msg = fmt.Sprintf("Invalid value for compress: %q", cstr)
+			srv.log.Printf("[ERROR] %s\n", msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sdb, ok = db.(*database.Database); !ok {
+		msg = fmt.Sprintf("Backups are not supported for %T, use the tools of the database instead",
+			db)
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusNotImplemented)
+		return
+	} else if compress {
+		mimeType = "application/gzip"
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", database.SnapshotName(time.Now(), compress)))
+	w.WriteHeader(200)
+
+	if err = sdb.Backup(w, compress); err != nil {
+		// At this point, we have already sent the header, so all we can
+		// do is log the error and cut the response short.
+		srv.log.Printf("[ERROR] Failed to create backup: %s\n",
+			err.Error())
+	}
+} // func (srv *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request)
@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 20. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-05 20:28:43 krylon>
+// Time-stamp: <2024-10-10 17:58:55 krylon>
 
 package server
 
@@ -32,7 +32,7 @@ func (srv *Server) handleAgentInit(w http.ResponseWriter, r *http.Request) {
 
 	var (
 		err         error
-		db          *database.Database
+		db          database.Storage
 		buf         bytes.Buffer
 		hostname    string
 		host        *model.Host
@@ -155,7 +155,7 @@ func (srv *Server) handleGetMostRecent(w http.ResponseWriter, r *http.Request) {
 	var (
 		err         error
 		hstatus     int = 200
-		db          *database.Database
+		db          database.Storage
 		hostID      int64
 		msg, status string
 		raw         any
@@ -252,13 +252,14 @@ func (srv *Server) handleSubmitRecords(w http.ResponseWriter, r *http.Request) {
 	var (
 		err          error
 		hstatus      int = 200
-		db           *database.Database
+		db           database.Storage
 		buf          bytes.Buffer
 		body         []byte
 		hostID       int64
 		host         *model.Host
 		msg, status  string
 		data         model.RecordSlice
+		added        []model.Record
 		raw          any
 		res          model.Response
 		sess         *sessions.Session
@@ -320,6 +321,12 @@ func (srv *Server) handleSubmitRecords(w http.ResponseWriter, r *http.Request) {
 		if txStatus {
 			if e = db.Commit(); e != nil {
 				srv.log.Printf("[ERROR] Error committing transaction: %s\n", e.Error())
+			} else {
+				srv.tail.publish(added)
+				srv.alerts.publish(added)
+				srv.patterns.publish(added)
+				srv.detector.publish(added)
+				srv.classifier.publish(added)
 			}
 		} else {
 			if e = db.Rollback(); e != nil {
@@ -368,7 +375,7 @@ func (srv *Server) handleSubmitRecords(w http.ResponseWriter, r *http.Request) {
 		rec.HostID = host.ID
 		var exist bool
 
-		if exist, err = db.RecordCheckExist(rec.Checksum()); err != nil {
+		if exist, err = db.RecordCheckExist(&rec); err != nil {
 			srv.log.Printf("[ERROR] Failed to check if record with checksum %q exists: %s\n",
 				rec.Checksum(),
 				err.Error())
@@ -387,6 +394,17 @@ func (srv *Server) handleSubmitRecords(w http.ResponseWriter, r *http.Request) {
 				err.Error())
 			goto SEND_RESPONSE
 		}
+
+		added = append(added, rec)
+	}
+
+	if len(added) > 0 {
+		if err = db.HostUpdateLastRecord(host, time.Now()); err != nil {
+			srv.log.Printf("[ERROR] Cannot update LastRecord timestamp on Host %s (%d): %s\n",
+				host.Name,
+				host.ID,
+				err.Error())
+		}
 	}
 
 	txStatus = true
@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 07. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-13 20:20:55 krylon>
+// Time-stamp: <2024-10-13 11:52:30 krylon>
 
 // This file has handlers for Ajax calls
 
@@ -16,11 +16,13 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/blicero/scrollmaster/common"
 	"github.com/blicero/scrollmaster/database"
 	"github.com/blicero/scrollmaster/model"
+	"github.com/blicero/scrollmaster/notify"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 )
@@ -36,15 +38,14 @@ func (srv *Server) handleAjaxSearchCreate(w http.ResponseWriter, r *http.Request
 		err    error
 		msg    string
 		sess   *sessions.Session
-		db     *database.Database
+		db     database.Storage
 		buf    bytes.Buffer
 		search model.Search
 		res    = model.Response{
 			Payload: make(map[string]string),
 		}
 		hstatus int = 200
-		q       chan model.Record
-		data    tmplDataSearchResults
+		jobID   int64
 		hosts   []model.Host
 	)
 
@@ -93,35 +94,22 @@ func (srv *Server) handleAjaxSearchCreate(w http.ResponseWriter, r *http.Request
 		srv.log.Printf("[ERROR] %s\n", res.Message)
 		hstatus = 500
 		goto SEND_RESPONSE
-	}
-
-	data.Hostnames = make(map[int64]string, len(hosts))
-	for _, h := range hosts {
-		data.Hostnames[h.ID] = h.Name
-	}
-
-	q = make(chan model.Record)
-	go db.RecordSearch(&search.Query, q)
-	search.Results = make([]int64, 0, 32)
-
-	for r := range q {
-		search.Results = append(search.Results, r.ID)
-	}
-
-	search.Timestamp = time.Now()
-
-	if err = db.SearchAdd(&search); err != nil {
-		res.Message = fmt.Sprintf("Failed to create Search: %s",
-			err.Error())
-		hstatus = 500
+	} else if err = search.Query.Compile(hosts); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid search query %q: %s\n",
+			search.Query.Query,
+			res.Message)
+		hstatus = 400
 		goto SEND_RESPONSE
 	}
 
-	res.Message = fmt.Sprintf("Search was performed and persisted successfully, yielding %d records",
-		len(search.Results))
+	// The search itself may take a while, so it runs in the background,
+	// and the frontend polls its status.
+	jobID = srv.searchStart(&search)
+
+	res.Message = fmt.Sprintf("Search job %d was started", jobID)
 	res.Status = true
-	res.Payload["id"] = strconv.FormatInt(search.ID, 10)
-	res.Payload["cnt"] = strconv.FormatInt(int64(len(search.Results)), 10)
+	res.Payload["job"] = strconv.FormatInt(jobID, 10)
 
 SEND_RESPONSE:
 	if sess != nil {
@@ -159,7 +147,7 @@ func (srv *Server) handleAjaxSearchLoad(w http.ResponseWriter, r *http.Request)
 		msg               string
 		sess              *sessions.Session
 		sid, page, offset int64
-		db                *database.Database
+		db                database.Storage
 		buf               bytes.Buffer
 		rbuf              []byte
 		tmpl              *template.Template
@@ -233,6 +221,10 @@ func (srv *Server) handleAjaxSearchLoad(w http.ResponseWriter, r *http.Request)
 		srv.log.Printf("[ERROR] %s\n", res.Message)
 		hstatus = 500
 		goto SEND_RESPONSE
+	} else if data.Search == nil {
+		res.Message = fmt.Sprintf("Search #%d does not exist", sid)
+		hstatus = 404
+		goto SEND_RESPONSE
 	}
 
 	data.ResultCountTotal = data.Search.Count
@@ -253,6 +245,13 @@ func (srv *Server) handleAjaxSearchLoad(w http.ResponseWriter, r *http.Request)
 		srv.log.Printf("[ERROR] %s\n", res.Message)
 		hstatus = 500
 		goto SEND_RESPONSE
+	} else if data.Annotations, data.Tags, err = recordNotes(db, data.Records); err != nil {
+		res.Message = fmt.Sprintf("Error fetching Annotations and Tags for Search #%d: %s",
+			sid,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
 	} else if err = tmpl.Execute(&buf, &data); err != nil {
 		res.Message = fmt.Sprintf("Error rendering results: %s",
 			err.Error())
@@ -307,7 +306,7 @@ func (srv *Server) handleAjaxSearchDelete(w http.ResponseWriter, r *http.Request
 		msg  string
 		sess *sessions.Session
 		id   int64
-		db   *database.Database
+		db   database.Storage
 		rbuf []byte
 		res  = model.Response{
 			Payload: make(map[string]string),
@@ -376,3 +375,2365 @@ SEND_RESPONSE:
 		srv.log.Println("[ERROR] " + msg)
 	}
 } // func (srv *Server) handleAjaxSearchDelete(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxSearchSave(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err    error
+		msg    string
+		id     int64
+		db     database.Storage
+		buf    bytes.Buffer
+		rbuf   []byte
+		meta   searchMeta
+		search *model.Search
+		res    = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Search ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &meta); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if search, err = db.SearchGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Search #%d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if search == nil {
+		res.Message = fmt.Sprintf("Search #%d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	search.Title = strings.TrimSpace(meta.Title)
+	search.Description = strings.TrimSpace(meta.Description)
+
+	if err = db.SearchUpdate(search); err != nil {
+		res.Message = fmt.Sprintf("Failed to save Search #%d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Search %d was saved", id)
+	res.Payload["title"] = search.Name()
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSearchSave(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxSearchRerun runs a saved Search again against the current data.
+// If the request has a body, it is the new SearchQuery, so the parameters
+// of a Search can be edited.
+func (srv *Server) handleAjaxSearchRerun(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err    error
+		msg    string
+		id     int64
+		jobID  int64
+		db     database.Storage
+		buf    bytes.Buffer
+		rbuf   []byte
+		search *model.Search
+		hosts  []model.Host
+		res    = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Search ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if search, err = db.SearchGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Search #%d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if search == nil {
+		res.Message = fmt.Sprintf("Search #%d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if buf.Len() > 0 {
+		search.Query = model.SearchQuery{}
+		if err = json.Unmarshal(buf.Bytes(), &search.Query); err != nil {
+			res.Message = fmt.Sprintf("Failed to parse search query: %s", err.Error())
+			srv.log.Printf("[ERROR] %s\n\n%s\n",
+				res.Message,
+				buf.String())
+			hstatus = 400
+			goto SEND_RESPONSE
+		}
+	}
+
+	if hosts, err = db.HostGetAll(); err != nil {
+		res.Message = fmt.Sprintf("Failed to query all Hosts from database: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = search.Query.Compile(hosts); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid search query %q: %s\n",
+			search.Query.Query,
+			res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	jobID = srv.searchStart(search)
+
+	res.Message = fmt.Sprintf("Search job %d was started", jobID)
+	res.Status = true
+	res.Payload["job"] = strconv.FormatInt(jobID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSearchRerun(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxSearchDuplicate saves a copy of a Search, including its
+// results, so it can be edited without losing the original.
+func (srv *Server) handleAjaxSearchDuplicate(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err    error
+		msg    string
+		id     int64
+		db     database.Storage
+		rbuf   []byte
+		search *model.Search
+		res    = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Search ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if search, err = db.SearchGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Search #%d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if search == nil {
+		res.Message = fmt.Sprintf("Search #%d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	search.Title = "Copy of " + search.Name()
+	search.ID = 0
+
+	if err = db.SearchAdd(search); err != nil {
+		res.Message = fmt.Sprintf("Failed to save copy of Search #%d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Search %d was copied to %d", id, search.ID)
+	res.Payload["id"] = strconv.FormatInt(search.ID, 10)
+	res.Payload["title"] = search.Name()
+	res.Payload["cnt"] = strconv.FormatInt(int64(len(search.Results)), 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSearchDuplicate(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxSearchJobStatus(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		job  *searchJob
+		ok   bool
+		eta  time.Duration
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse job ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	srv.jobLock.Lock()
+	if job, ok = srv.jobs[id]; !ok {
+		srv.jobLock.Unlock()
+		res.Message = fmt.Sprintf("Search job %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	res.Payload["status"] = job.status.String()
+	res.Payload["scanned"] = strconv.FormatInt(job.prog.Scanned.Load(), 10)
+	res.Payload["matched"] = strconv.FormatInt(job.prog.Matched.Load(), 10)
+	res.Payload["total"] = strconv.FormatInt(job.prog.Total.Load(), 10)
+
+	switch job.status {
+	case jobRunning:
+		if eta = job.eta(time.Now()); eta >= 0 {
+			res.Payload["eta"] = strconv.FormatInt(int64(eta.Seconds()), 10)
+		}
+		res.Message = fmt.Sprintf("Search job %d is running", id)
+	case jobDone:
+		res.Payload["id"] = strconv.FormatInt(job.search.ID, 10)
+		res.Payload["title"] = job.search.Name()
+		res.Payload["cnt"] = strconv.FormatInt(int64(len(job.search.Results)), 10)
+		res.Message = fmt.Sprintf("Search was performed and persisted successfully, yielding %d records",
+			len(job.search.Results))
+	case jobCancelled:
+		res.Message = fmt.Sprintf("Search job %d was cancelled", id)
+	case jobFailed:
+		res.Message = job.err
+	}
+
+	// The request itself worked, but the frontend should be able to tell
+	// a failed search from one that is merely not finished, yet.
+	res.Status = job.status != jobFailed
+	srv.jobLock.Unlock()
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSearchJobStatus(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxSearchJobCancel(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		job  *searchJob
+		ok   bool
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse job ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	srv.jobLock.Lock()
+	job, ok = srv.jobs[id]
+	srv.jobLock.Unlock()
+
+	if !ok {
+		res.Message = fmt.Sprintf("Search job %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	// Cancelling a job that has already finished does no harm.
+	job.cancel()
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Search job %d was cancelled", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSearchJobCancel(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxRecord sends the details of a single Record as JSON, in the
+// payload field "record".
+func (srv *Server) handleAjaxRecord(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err     error
+		msg     string
+		id      int64
+		db      database.Storage
+		rbuf    []byte
+		records []model.Record
+		host    *model.Host
+		name    string
+		res     = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars    map[string]string
+	)
+
+	vars = mux.Vars(r)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if records, err = db.RecordGetByIDList([]int64{id}); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if len(records) == 0 {
+		res.Message = fmt.Sprintf("Record %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if host, err = db.HostGetByID(records[0].HostID); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Host %d: %s",
+			records[0].HostID,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if host != nil {
+		name = host.NameShort()
+	}
+
+	if rbuf, err = json.Marshal(newRecordDetail(&records[0], name)); err != nil {
+		res.Message = fmt.Sprintf("Failed to serialize Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Payload["record"] = string(rbuf)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxRecord(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxAlertRuleSave creates a new alert rule or saves the changes to
+// an existing one.
+func (srv *Server) handleAjaxAlertRuleSave(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err   error
+		msg   string
+		db    database.Storage
+		buf   bytes.Buffer
+		rbuf  []byte
+		data  alertRuleData
+		hosts []model.Host
+		query *model.SearchQuery
+		old   *model.AlertRule
+		rule  model.AlertRule
+		res   = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+	)
+
+	if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	rule = model.AlertRule{
+		ID:          data.ID,
+		Name:        strings.TrimSpace(data.Name),
+		Description: strings.TrimSpace(data.Description),
+		Threshold:   data.Threshold,
+		PerHost:     data.PerHost,
+		Active:      data.Active,
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	// Rules that watch for silent Hosts do not have a query.
+	if rule.Kind, err = model.ParseAlertRuleKind(data.Kind); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		res.Message = fmt.Sprintf("Failed to query all Hosts from database: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if rule.Window, err = time.ParseDuration(data.Window); err != nil {
+		res.Message = fmt.Sprintf("Invalid window %q: %s", data.Window, err.Error())
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if rule.Kind == model.RuleSilence || rule.Kind == model.RuleAnomaly {
+		query = new(model.SearchQuery)
+	} else if query, err = parseQuery(data.Query, hosts); err != nil {
+		res.Message = fmt.Sprintf("Invalid query: %s", err.Error())
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	rule.Query = *query
+
+	if err = rule.Validate(); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid alert rule: %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if rule.ID == 0 {
+		if err = db.AlertRuleAdd(&rule); err != nil {
+			res.Message = fmt.Sprintf("Failed to add alert rule: %s",
+				err.Error())
+			hstatus = 500
+			goto SEND_RESPONSE
+		}
+	} else if old, err = db.AlertRuleGetByID(rule.ID); err != nil {
+		res.Message = fmt.Sprintf("Failed to load alert rule %d: %s",
+			rule.ID,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if old == nil {
+		res.Message = fmt.Sprintf("Alert rule %d does not exist", rule.ID)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else {
+		rule.SilencedUntil = old.SilencedUntil
+
+		if err = db.AlertRuleUpdate(&rule); err != nil {
+			res.Message = fmt.Sprintf("Failed to save alert rule %d: %s",
+				rule.ID,
+				err.Error())
+			hstatus = 500
+			goto SEND_RESPONSE
+		}
+	}
+
+	srv.alerts.load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Alert rule %q was saved", rule.Name)
+	res.Payload["id"] = strconv.FormatInt(rule.ID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxAlertRuleSave(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxAlertRuleDelete(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse alert rule ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.AlertRuleDelete(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to delete alert rule %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.alerts.load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Alert rule %d was deleted", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxAlertRuleDelete(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxAlertRuleSilence silences an alert rule for a while. Alerts it
+// raises in the meantime are marked as silenced.
+func (srv *Server) handleAjaxAlertRuleSilence(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err   error
+		msg   string
+		id    int64
+		db    database.Storage
+		buf   bytes.Buffer
+		rbuf  []byte
+		data  alertSilence
+		dur   time.Duration
+		rule  *model.AlertRule
+		until time.Time
+		res   = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse alert rule ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if dur, err = time.ParseDuration(data.Duration); err != nil || dur < 0 {
+		res.Message = fmt.Sprintf("Invalid duration %q", data.Duration)
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	until = time.Now().Add(dur)
+
+	if rule, err = db.AlertRuleGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load alert rule %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if rule == nil {
+		res.Message = fmt.Sprintf("Alert rule %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if err = db.AlertRuleSilence(id, until); err != nil {
+		res.Message = fmt.Sprintf("Failed to silence alert rule %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.alerts.load(db) // nolint: errcheck
+
+	res.Status = true
+	if dur > 0 {
+		res.Message = fmt.Sprintf("Alert rule %q is silenced until %s",
+			rule.Name,
+			until.Format(common.TimestampFormat))
+	} else {
+		res.Message = fmt.Sprintf("Alert rule %q is no longer silenced", rule.Name)
+	}
+	res.Payload["until"] = until.Format(common.TimestampFormat)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxAlertRuleSilence(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxHostWatch(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		buf  bytes.Buffer
+		rbuf []byte
+		data hostWatch
+		host *model.Host
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Host ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if host, err = db.HostGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Host %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if host == nil {
+		res.Message = fmt.Sprintf("Host %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	host.SilenceThreshold = 0
+	host.Maintenance = data.Maintenance
+
+	if data.Threshold = strings.TrimSpace(data.Threshold); data.Threshold != "" {
+		if host.SilenceThreshold, err = time.ParseDuration(data.Threshold); err != nil || host.SilenceThreshold < time.Second {
+			res.Message = fmt.Sprintf("Invalid threshold %q", data.Threshold)
+			srv.log.Printf("[INFO] %s\n", res.Message)
+			hstatus = 400
+			goto SEND_RESPONSE
+		}
+	}
+
+	if err = db.HostSetWatch(host); err != nil {
+		res.Message = fmt.Sprintf("Failed to save watch settings of Host %s: %s",
+			host.Name,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	// Going into maintenance or raising the threshold may resolve an
+	// Alert, so we do not want to wait for the next tick.
+	srv.alerts.check(time.Now())
+
+	res.Status = true
+	if host.Maintenance {
+		res.Message = fmt.Sprintf("Host %s is in maintenance", host.Name)
+	} else {
+		res.Message = fmt.Sprintf("Watch settings of Host %s were saved", host.Name)
+	}
+	res.Payload["silent"] = strconv.FormatBool(srv.alerts.silentHosts()[host.ID])
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxHostWatch(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxNotifierSave(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		db   database.Storage
+		buf  bytes.Buffer
+		rbuf []byte
+		data notifierData
+		old  *model.Notifier
+		n    model.Notifier
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+	)
+
+	if hstatus, res.Message = notifierAccess(r); hstatus != http.StatusOK {
+		srv.log.Printf("[INFO] Refuse request for %s from %s: %s\n",
+			r.URL.EscapedPath(),
+			r.RemoteAddr,
+			res.Message)
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	n = model.Notifier{
+		ID:       data.ID,
+		Name:     strings.TrimSpace(data.Name),
+		Target:   strings.TrimSpace(data.Target),
+		Args:     data.Args,
+		From:     strings.TrimSpace(data.From),
+		Subject:  data.Subject,
+		Template: data.Template,
+		Active:   data.Active,
+	}
+
+	for _, addr := range data.To {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			n.To = append(n.To, addr)
+		}
+	}
+
+	if n.Kind, err = model.ParseNotifierKind(data.Kind); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if err = n.Validate(); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid Notifier: %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if err = notify.CheckTemplates(&n); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid Notifier: %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if n.ID == 0 {
+		if err = db.NotifierAdd(&n); err != nil {
+			res.Message = fmt.Sprintf("Failed to add Notifier: %s",
+				err.Error())
+			hstatus = 500
+			goto SEND_RESPONSE
+		}
+	} else if old, err = db.NotifierGetByID(n.ID); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Notifier %d: %s",
+			n.ID,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if old == nil {
+		res.Message = fmt.Sprintf("Notifier %d does not exist", n.ID)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if err = db.NotifierUpdate(&n); err != nil {
+		res.Message = fmt.Sprintf("Failed to save Notifier %d: %s",
+			n.ID,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.notify.Load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Notifier %q was saved", n.Name)
+	res.Payload["id"] = strconv.FormatInt(n.ID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxNotifierSave(w http.ResponseWriter, r *http.Request)
+
+func (srv *Server) handleAjaxNotifierDelete(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if hstatus, res.Message = notifierAccess(r); hstatus != http.StatusOK {
+		srv.log.Printf("[INFO] Refuse request for %s from %s: %s\n",
+			r.URL.EscapedPath(),
+			r.RemoteAddr,
+			res.Message)
+		goto SEND_RESPONSE
+	} else if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Notifier ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.NotifierDelete(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to delete Notifier %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.notify.Load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Notifier %d was deleted", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxNotifierDelete(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxNotifierTest sends a test message through a Notifier, so the
+// user can check if it works. If the message cannot be delivered, we reply
+// with 502 Bad Gateway.
+func (srv *Server) handleAjaxNotifierTest(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		n    *model.Notifier
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if hstatus, res.Message = notifierAccess(r); hstatus != http.StatusOK {
+		srv.log.Printf("[INFO] Refuse request for %s from %s: %s\n",
+			r.URL.EscapedPath(),
+			r.RemoteAddr,
+			res.Message)
+		goto SEND_RESPONSE
+	} else if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Notifier ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	// The Dispatcher logs the delivery with a connection of its own, so
+	// we must not hold on to ours while it sends the message.
+	db = srv.pool.Get()
+	n, err = db.NotifierGetByID(id)
+	srv.pool.Put(db)
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to load Notifier %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if n == nil {
+		res.Message = fmt.Sprintf("Notifier %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if err = srv.notify.Test(n); err != nil {
+		res.Message = fmt.Sprintf("Test message could not be delivered: %s",
+			err.Error())
+		hstatus = 502
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Test message was delivered through %q", n.Name)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxNotifierTest(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxNoveltyAcknowledge acknowledges a novel message, so it drops
+// off the feed.
+func (srv *Server) handleAjaxNoveltyAcknowledge(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Novelty ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.NoveltyAcknowledge(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to acknowledge Novelty %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Novelty %d was acknowledged", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxNoveltyAcknowledge(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxSignatureSave creates a new Signature or saves the changes to
+// an existing one. Built-in Signatures can only be switched on and off.
+func (srv *Server) handleAjaxSignatureSave(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err   error
+		msg   string
+		db    database.Storage
+		buf   bytes.Buffer
+		rbuf  []byte
+		data  signatureData
+		hosts []model.Host
+		sigs  []model.Signature
+		query *model.SearchQuery
+		old   *model.Signature
+		sig   model.Signature
+		res   = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+	)
+
+	if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	sig = model.Signature{
+		ID:          data.ID,
+		Name:        strings.TrimSpace(data.Name),
+		Category:    strings.ToLower(strings.TrimSpace(data.Category)),
+		Description: strings.TrimSpace(data.Description),
+		Threshold:   data.Threshold,
+		Active:      data.Active,
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sigs, err = db.SignatureGetAll(); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Signatures: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	for i := range sigs {
+		if sigs[i].ID == sig.ID {
+			old = &sigs[i]
+		} else if sigs[i].Name == sig.Name {
+			res.Message = fmt.Sprintf("There already is a Signature named %q",
+				sig.Name)
+			hstatus = 400
+			goto SEND_RESPONSE
+		}
+	}
+
+	if sig.ID != 0 && old == nil {
+		res.Message = fmt.Sprintf("Signature %d does not exist", sig.ID)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if old != nil && old.Builtin {
+		sig = *old
+		sig.Active = data.Active
+		goto SAVE
+	}
+
+	if sig.Severity, err = model.ParseSeverity(data.Severity); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		res.Message = fmt.Sprintf("Failed to query all Hosts from database: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if query, err = parseQuery(data.Query, hosts); err != nil {
+		res.Message = fmt.Sprintf("Invalid query: %s", err.Error())
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	sig.Query = *query
+
+	// Signatures without a threshold do not need a window.
+	if data.Window != "" {
+		if sig.Window, err = time.ParseDuration(data.Window); err != nil {
+			res.Message = fmt.Sprintf("Invalid window %q: %s", data.Window, err.Error())
+			srv.log.Printf("[INFO] %s\n", res.Message)
+			hstatus = 400
+			goto SEND_RESPONSE
+		}
+	}
+
+	if err = sig.Validate(); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid Signature: %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+SAVE:
+	if sig.ID == 0 {
+		err = db.SignatureAdd(&sig)
+	} else {
+		err = db.SignatureUpdate(&sig)
+	}
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to save Signature %q: %s",
+			sig.Name,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.detector.load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Signature %q was saved", sig.Name)
+	res.Payload["id"] = strconv.FormatInt(sig.ID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSignatureSave(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxSignatureDelete deletes a user-defined Signature along with
+// its Detections. Built-in Signatures would be back when the server
+// restarts, so they can only be deactivated.
+func (srv *Server) handleAjaxSignatureDelete(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		sigs []model.Signature
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Signature ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sigs, err = db.SignatureGetAll(); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Signatures: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	for i := range sigs {
+		if sigs[i].ID == id && sigs[i].Builtin {
+			res.Message = fmt.Sprintf("Signature %q is built in, it can only be deactivated",
+				sigs[i].Name)
+			hstatus = 400
+			goto SEND_RESPONSE
+		}
+	}
+
+	if err = db.SignatureDelete(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to delete Signature %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.detector.load(db) // nolint: errcheck
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Signature %d was deleted", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxSignatureDelete(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxRecordLabel labels a Record as interesting or boring, or
+// removes its Label, and has the classifier learn from it.
+func (srv *Server) handleAjaxRecordLabel(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err     error
+		msg     string
+		id      int64
+		db      database.Storage
+		buf     bytes.Buffer
+		rbuf    []byte
+		data    recordLabel
+		records []model.Record
+		res     = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	switch data.Label {
+	case "":
+		err = db.LabelDelete(id)
+	case "interesting", "boring":
+		if records, err = db.RecordGetByIDList([]int64{id}); err != nil {
+			break
+		} else if len(records) == 0 {
+			res.Message = fmt.Sprintf("Record %d does not exist", id)
+			hstatus = 404
+			goto SEND_RESPONSE
+		}
+
+		err = db.LabelSet(&model.Label{
+			RecordID:    records[0].ID,
+			HostID:      records[0].HostID,
+			Source:      records[0].Source,
+			Message:     records[0].Message,
+			Interesting: data.Label == "interesting",
+			Time:        time.Now(),
+		})
+	default:
+		res.Message = fmt.Sprintf("Invalid label %q", data.Label)
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to label Record %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	srv.classifier.train()
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Record %d was labeled %q", id, data.Label)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxRecordLabel(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxRecordAnnotate attaches a note to a Record.
+func (srv *Server) handleAjaxRecordAnnotate(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err     error
+		msg     string
+		id      int64
+		db      database.Storage
+		buf     bytes.Buffer
+		rbuf    []byte
+		data    recordAnnotation
+		records []model.Record
+		note    model.Annotation
+		res     = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if data.Text = strings.TrimSpace(data.Text); data.Text == "" {
+		res.Message = "Annotation is empty"
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if records, err = db.RecordGetByIDList([]int64{id}); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Record %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if len(records) == 0 {
+		res.Message = fmt.Sprintf("Record %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	}
+
+	note = model.Annotation{
+		RecordID: records[0].ID,
+		HostID:   records[0].HostID,
+		Time:     time.Now(),
+		Text:     data.Text,
+	}
+
+	if err = db.AnnotationAdd(&note); err != nil {
+		res.Message = fmt.Sprintf("Failed to annotate Record %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Record %d was annotated", id)
+	res.Payload["id"] = strconv.FormatInt(note.ID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxRecordAnnotate(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxAnnotationDelete removes an Annotation.
+func (srv *Server) handleAjaxAnnotationDelete(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Annotation ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.AnnotationDelete(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to delete Annotation %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Annotation %d was deleted", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxAnnotationDelete(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxRecordTag puts a Tag on a Record.
+func (srv *Server) handleAjaxRecordTag(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err     error
+		msg     string
+		id      int64
+		db      database.Storage
+		buf     bytes.Buffer
+		rbuf    []byte
+		data    recordTag
+		records []model.Record
+		res     = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if data.Tag, err = model.NormalizeTag(data.Tag); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if records, err = db.RecordGetByIDList([]int64{id}); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Record %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if len(records) == 0 {
+		res.Message = fmt.Sprintf("Record %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if err = db.TagAdd(&model.Tag{
+		RecordID: records[0].ID,
+		HostID:   records[0].HostID,
+		Name:     data.Tag,
+		Time:     time.Now(),
+	}); err != nil {
+		res.Message = fmt.Sprintf("Failed to tag Record %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Record %d was tagged %q", id, data.Tag)
+	res.Payload["tag"] = data.Tag
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxRecordTag(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxRecordUntag removes a Tag from a Record.
+func (srv *Server) handleAjaxRecordUntag(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		buf  bytes.Buffer
+		rbuf []byte
+		data recordTag
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if data.Tag, err = model.NormalizeTag(data.Tag); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.TagDelete(id, data.Tag); err != nil {
+		res.Message = fmt.Sprintf("Failed to remove Tag %q from Record %d: %s",
+			data.Tag,
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Tag %q was removed from Record %d", data.Tag, id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxRecordUntag(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxIncidentSave creates a new Incident or saves the changes to an
+// existing one.
+func (srv *Server) handleAjaxIncidentSave(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		db   database.Storage
+		buf  bytes.Buffer
+		rbuf []byte
+		data incidentData
+		old  *model.Incident
+		inc  model.Incident
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+	)
+
+	if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	inc = model.Incident{
+		ID:      data.ID,
+		Title:   strings.TrimSpace(data.Title),
+		Summary: strings.TrimSpace(data.Summary),
+		Begin:   data.Begin,
+		End:     data.End,
+	}
+
+	if inc.Status, err = model.ParseIncidentStatus(data.Status); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if err = inc.Validate(); err != nil {
+		res.Message = err.Error()
+		srv.log.Printf("[INFO] Invalid Incident: %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if inc.ID == 0 {
+		err = db.IncidentAdd(&inc)
+	} else if old, err = db.IncidentGetByID(inc.ID); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Incident %d: %s",
+			inc.ID,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if old == nil {
+		res.Message = fmt.Sprintf("Incident %d does not exist", inc.ID)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else {
+		inc.Created = old.Created
+		err = db.IncidentUpdate(&inc)
+	}
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to save Incident %q: %s",
+			inc.Title,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Incident %q was saved", inc.Title)
+	res.Payload["id"] = strconv.FormatInt(inc.ID, 10)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxIncidentSave(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxIncidentDelete deletes an Incident. The Records and Searches
+// pinned to it are left alone.
+func (srv *Server) handleAjaxIncidentDelete(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		rbuf []byte
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Incident ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = db.IncidentDelete(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to delete Incident %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Incident %d was deleted", id)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxIncidentDelete(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxIncidentPin pins a Record or a saved Search to an Incident.
+// Pinning a Record again changes its note.
+func (srv *Server) handleAjaxIncidentPin(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err     error
+		msg     string
+		id      int64
+		db      database.Storage
+		buf     bytes.Buffer
+		rbuf    []byte
+		data    incidentPin
+		inc     *model.Incident
+		records []model.Record
+		search  *model.Search
+		res     = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Incident ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if (data.Record == 0) == (data.Search == 0) {
+		res.Message = "Either a Record or a Search must be given"
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if inc, err = db.IncidentGetByID(id); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Incident %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if inc == nil {
+		res.Message = fmt.Sprintf("Incident %d does not exist", id)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if data.Search != 0 {
+		goto PIN_SEARCH
+	}
+
+	if records, err = db.RecordGetByIDList([]int64{data.Record}); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Record %d: %s",
+			data.Record,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if len(records) == 0 {
+		res.Message = fmt.Sprintf("Record %d does not exist", data.Record)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if err = db.IncidentPinRecord(&model.Pin{
+		IncidentID: id,
+		RecordID:   records[0].ID,
+		HostID:     records[0].HostID,
+		Time:       records[0].Time,
+		Source:     records[0].Source,
+		Message:    records[0].Message,
+		Note:       strings.TrimSpace(data.Note),
+	}); err != nil {
+		res.Message = fmt.Sprintf("Failed to pin Record %d to Incident %d: %s",
+			data.Record,
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Record %d was pinned to Incident %q",
+		data.Record,
+		inc.Title)
+	goto SEND_RESPONSE
+
+PIN_SEARCH:
+	if search, err = db.SearchGetByID(data.Search); err != nil {
+		res.Message = fmt.Sprintf("Failed to load Search %d: %s",
+			data.Search,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if search == nil {
+		res.Message = fmt.Sprintf("Search %d does not exist", data.Search)
+		hstatus = 404
+		goto SEND_RESPONSE
+	} else if search.Title == "" {
+		res.Message = fmt.Sprintf("Search %d must be saved before it can be pinned",
+			data.Search)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if err = db.IncidentPinSearch(id, search.ID); err != nil {
+		res.Message = fmt.Sprintf("Failed to pin Search %d to Incident %d: %s",
+			data.Search,
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+	res.Message = fmt.Sprintf("Search %q was pinned to Incident %q",
+		search.Title,
+		inc.Title)
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxIncidentPin(w http.ResponseWriter, r *http.Request)
+
+// handleAjaxIncidentUnpin removes a Record or a Search from an Incident.
+func (srv *Server) handleAjaxIncidentUnpin(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err  error
+		msg  string
+		id   int64
+		db   database.Storage
+		buf  bytes.Buffer
+		rbuf []byte
+		data incidentPin
+		res  = model.Response{
+			Payload: make(map[string]string),
+		}
+		hstatus int = 200
+		vars        = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		res.Message = fmt.Sprintf("Cannot parse Incident ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if _, err = io.Copy(&buf, r.Body); err != nil {
+		res.Message = fmt.Sprintf("Failed to copy Request body: %s",
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", res.Message)
+		hstatus = 500
+		goto SEND_RESPONSE
+	} else if err = json.Unmarshal(buf.Bytes(), &data); err != nil {
+		res.Message = fmt.Sprintf("Failed to parse request: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n\n%s\n",
+			res.Message,
+			buf.String())
+		hstatus = 400
+		goto SEND_RESPONSE
+	} else if (data.Record == 0) == (data.Search == 0) {
+		res.Message = "Either a Record or a Search must be given"
+		hstatus = 400
+		goto SEND_RESPONSE
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if data.Record != 0 {
+		err = db.IncidentUnpinRecord(id, data.Record)
+		res.Message = fmt.Sprintf("Record %d was unpinned from Incident %d",
+			data.Record,
+			id)
+	} else {
+		err = db.IncidentUnpinSearch(id, data.Search)
+		res.Message = fmt.Sprintf("Search %d was unpinned from Incident %d",
+			data.Search,
+			id)
+	}
+
+	if err != nil {
+		res.Message = fmt.Sprintf("Failed to unpin from Incident %d: %s",
+			id,
+			err.Error())
+		hstatus = 500
+		goto SEND_RESPONSE
+	}
+
+	res.Status = true
+
+SEND_RESPONSE:
+	res.Timestamp = time.Now()
+	if rbuf, err = json.Marshal(&res); err != nil {
+		srv.log.Printf("[ERROR] Error serializing response: %s\n",
+			err.Error())
+		rbuf = errJSON(err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(hstatus)
+	if _, err = w.Write(rbuf); err != nil {
+		msg = fmt.Sprintf("Failed to send result: %s",
+			err.Error())
+		srv.log.Println("[ERROR] " + msg)
+	}
+} // func (srv *Server) handleAjaxIncidentUnpin(w http.ResponseWriter, r *http.Request)
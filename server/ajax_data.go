@@ -2,6 +2,160 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 10. 06. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-06-12 19:28:06 krylon>
+// Time-stamp: <2024-10-12 17:02:18 krylon>
 
 package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// searchMeta is what the frontend sends to name and describe a Search.
+type searchMeta struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// alertRuleData is what the frontend sends to create or edit an alert
+// rule. Kind is the name of an AlertRuleKind, Query is parsed like the
+// query of the live tail, Window is a duration like "10m". If ID is 0, a
+// new rule is created.
+type alertRuleData struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	Query       string `json:"query"`
+	Threshold   int64  `json:"threshold"`
+	Window      string `json:"window"`
+	PerHost     bool   `json:"per_host"`
+	Active      bool   `json:"active"`
+}
+
+// alertSilence is what the frontend sends to silence an alert rule for
+// the given Duration, like "2h". A Duration of "0" ends the silence.
+type alertSilence struct {
+	Duration string `json:"duration"`
+}
+
+// hostWatch is what the frontend sends to change how a Host is watched
+// for silence. Threshold is a duration like "30m", or empty to use the
+// Window of the rule.
+type hostWatch struct {
+	Threshold   string `json:"threshold"`
+	Maintenance bool   `json:"maintenance"`
+}
+
+// notifierData is what the frontend sends to create or edit a Notifier.
+// Kind is the name of a NotifierKind. If ID is 0, a new Notifier is
+// created.
+type notifierData struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Target   string   `json:"target"`
+	Args     []string `json:"args"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Subject  string   `json:"subject"`
+	Template string   `json:"template"`
+	Active   bool     `json:"active"`
+}
+
+// signatureData is what the frontend sends to create or edit a Signature.
+// Severity is the name of a Severity, Query is parsed like the query of the
+// live tail, Window is a duration like "1m". If ID is 0, a new Signature
+// is created. Of a built-in Signature, only Active can be changed.
+type signatureData struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	Query       string `json:"query"`
+	Threshold   int64  `json:"threshold"`
+	Window      string `json:"window"`
+	Active      bool   `json:"active"`
+}
+
+// recordLabel is what the frontend sends to label a Record. Label is
+// either "interesting", "boring", or empty to remove the Label.
+type recordLabel struct {
+	Label string `json:"label"`
+}
+
+// recordAnnotation is what the frontend sends to annotate a Record.
+type recordAnnotation struct {
+	Text string `json:"text"`
+}
+
+// recordTag is what the frontend sends to put a Tag on a Record or remove
+// it. The name is normalized by model.NormalizeTag.
+type recordTag struct {
+	Tag string `json:"tag"`
+}
+
+// incidentData is what the frontend sends to create or edit an Incident.
+// Status is the name of an IncidentStatus, a null End means the Incident
+// is still ongoing. If ID is 0, a new Incident is created.
+type incidentData struct {
+	ID      int64     `json:"id"`
+	Title   string    `json:"title"`
+	Summary string    `json:"summary"`
+	Begin   time.Time `json:"begin"`
+	End     time.Time `json:"end"`
+	Status  string    `json:"status"`
+}
+
+// incidentPin is what the frontend sends to pin a Record or a saved Search
+// to an Incident, or to unpin it. Exactly one of Record and Search must be
+// set. Note only applies to Records.
+type incidentPin struct {
+	Record int64  `json:"record"`
+	Search int64  `json:"search"`
+	Note   string `json:"note"`
+}
+
+// recordDetail is everything we know about a single Record. It is shown on
+// the Record's page and sent as JSON to clients that ask for it.
+type recordDetail struct {
+	ID       int64     `json:"id"`
+	HostID   int64     `json:"host_id"`
+	Host     string    `json:"host"`
+	Time     time.Time `json:"time"`
+	Stamp    int64     `json:"stamp"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+	Severity string    `json:"severity"`
+	Template string    `json:"template"`
+	Params   []string  `json:"params"`
+	Checksum string    `json:"checksum"`
+	URL      string    `json:"url"`
+	Context  string    `json:"context"`
+}
+
+func newRecordDetail(rec *model.Record, hostname string) *recordDetail {
+	var d = &recordDetail{
+		ID:       rec.ID,
+		HostID:   rec.HostID,
+		Host:     hostname,
+		Time:     rec.Time,
+		Stamp:    rec.Time.Unix(),
+		Source:   rec.Source,
+		Message:  rec.Message,
+		Severity: rec.Severity().String(),
+		Checksum: rec.Checksum(),
+		URL:      fmt.Sprintf("/record/%d", rec.ID),
+		Context:  fmt.Sprintf("/record/%d/context", rec.ID),
+	}
+
+	d.Template, d.Params = model.SplitMessage(rec.Message)
+	if d.Params == nil {
+		d.Params = []string{}
+	}
+
+	return d
+} // func newRecordDetail(rec *model.Record, hostname string) *recordDetail
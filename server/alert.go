@@ -0,0 +1,438 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/alert.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 03. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:15:02 krylon>
+
+// This file implements the evaluation of alert rules. Records are counted
+// against the rules as the Agents submit them, so we do not have to search
+// the log over and over again. Rules that watch for silent Hosts or for
+// unusual rates are checked periodically instead.
+
+package server
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/blicero/scrollmaster/notify"
+)
+
+// alertTick is how often we check if Alerts have been resolved and if
+// Hosts have gone silent.
+const alertTick = time.Second * 30
+
+// alertRuleState is an AlertRule along with the matching Records it has
+// seen recently and the Alerts it has open. Both are kept per Host, or
+// under the key 0 if the rule does not count Hosts separately.
+type alertRuleState struct {
+	rule    model.AlertRule
+	matches map[int64][]time.Time
+	open    map[int64]*model.Alert
+}
+
+func (s *alertRuleState) key(r *model.Record) int64 {
+	if s.rule.PerHost {
+		return r.HostID
+	}
+
+	return 0
+} // func (s *alertRuleState) key(r *model.Record) int64
+
+// prune forgets the matches for the given key that happened before the
+// beginning of the Window and returns how many are left.
+func (s *alertRuleState) prune(key int64, now time.Time) int64 {
+	var begin = now.Add(-s.rule.Window)
+
+	s.matches[key] = slices.DeleteFunc(s.matches[key], func(t time.Time) bool {
+		return t.Before(begin)
+	})
+
+	return int64(len(s.matches[key]))
+} // func (s *alertRuleState) prune(key int64, now time.Time) int64
+
+// alertEngine evaluates the alert rules against the Records the Agents
+// submit. Like the live tail, it never makes the Agents wait: If it falls
+// behind, batches of Records are dropped.
+//
+// Whenever an Alert fires or is resolved, the engine tells the Notifiers,
+// unless the rule is silenced.
+type alertEngine struct {
+	*ingestQueue
+	log    *log.Logger
+	pool   *database.Pool
+	notify *notify.Dispatcher
+	rates  *rateMonitor
+	lock   sync.Mutex
+	rules  map[int64]*alertRuleState
+	hosts  map[int64]string
+}
+
+func newAlertEngine(l *log.Logger, pool *database.Pool, d *notify.Dispatcher, rates *rateMonitor) *alertEngine {
+	return &alertEngine{
+		ingestQueue: newIngestQueue(l, "Alert engine"),
+		log:         l,
+		pool:        pool,
+		notify:      d,
+		rates:       rates,
+		rules:       make(map[int64]*alertRuleState),
+		hosts:       make(map[int64]string),
+	}
+} // func newAlertEngine(l *log.Logger, pool *database.Pool, d *notify.Dispatcher, rates *rateMonitor) *alertEngine
+
+// load (re-)loads the alert rules and open Alerts from the database.
+// Rules that were loaded before keep the matches they have seen.
+func (e *alertEngine) load(db database.Storage) error {
+	var (
+		err    error
+		rules  []model.AlertRule
+		alerts []model.Alert
+		hosts  []model.Host
+	)
+
+	if rules, err = db.AlertRuleGetAll(); err != nil {
+		e.log.Printf("[ERROR] Cannot load alert rules: %s\n", err.Error())
+		return err
+	} else if alerts, err = db.AlertGetOpen(); err != nil {
+		e.log.Printf("[ERROR] Cannot load open Alerts: %s\n", err.Error())
+		return err
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		e.log.Printf("[ERROR] Cannot load Hosts: %s\n", err.Error())
+		return err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	var states = make(map[int64]*alertRuleState, len(rules))
+
+	for _, r := range rules {
+		var s = e.rules[r.ID]
+
+		if s == nil || s.rule.PerHost != r.PerHost {
+			s = &alertRuleState{matches: make(map[int64][]time.Time)}
+		}
+
+		s.rule = r
+		s.open = make(map[int64]*model.Alert)
+
+		if r.Kind != model.RuleMatch {
+			states[r.ID] = s
+			continue
+		} else if err = s.rule.Query.Compile(hosts); err != nil {
+			e.log.Printf("[ERROR] Cannot compile Query of alert rule %q: %s\n",
+				r.Name,
+				err.Error())
+			continue
+		} else if err = s.rule.Query.CheckLive(); err != nil {
+			e.log.Printf("[ERROR] Alert rule %q is ignored: %s\n",
+				r.Name,
+				err.Error())
+			continue
+		}
+
+		states[r.ID] = s
+	}
+
+	for i := range alerts {
+		var a = &alerts[i]
+
+		if s := states[a.RuleID]; s != nil {
+			s.open[a.HostID] = a
+		}
+	}
+
+	e.rules = states
+	e.hosts = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		e.hosts[h.ID] = h.Name
+	}
+
+	return nil
+} // func (e *alertEngine) load(db database.Storage) error
+
+// reload gets a connection from the pool and (re-)loads the alert rules.
+func (e *alertEngine) reload() error {
+	var db = e.pool.Get()
+	defer e.pool.Put(db)
+
+	return e.load(db)
+} // func (e *alertEngine) reload() error
+
+// run is the engine's main loop.
+func (e *alertEngine) run() {
+	var ticker = time.NewTicker(alertTick)
+	defer ticker.Stop()
+
+	if err := e.reload(); err != nil {
+		e.log.Printf("[ERROR] Alert rules could not be loaded, they will be evaluated once they are edited: %s\n",
+			err.Error())
+	}
+
+	for {
+		select {
+		case records := <-e.in:
+			e.evaluate(records, time.Now())
+		case <-ticker.C:
+			e.check(time.Now())
+		}
+	}
+} // func (e *alertEngine) run()
+
+// evaluate counts the Records against the alert rules. Records that are
+// older than a rule's Window, e.g. because an Agent was catching up after
+// it had been offline, are not counted.
+func (e *alertEngine) evaluate(records []model.Record, now time.Time) {
+	e.lock.Lock()
+	var unknown = unknownHost(e.hosts, records)
+	e.lock.Unlock()
+
+	if unknown {
+		e.reload() // nolint: errcheck
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	var db = e.pool.Get()
+	defer e.pool.Put(db)
+
+	for _, s := range e.rules {
+		if !s.rule.Active || s.rule.Kind != model.RuleMatch {
+			continue
+		}
+
+		var touched = make(map[int64]bool)
+
+		for i := range records {
+			var r = &records[i]
+
+			if r.Time.Before(now.Add(-s.rule.Window)) || !s.rule.Query.Match(r) {
+				continue
+			}
+
+			var key = s.key(r)
+			s.matches[key] = append(s.matches[key], r.Time)
+			touched[key] = true
+		}
+
+		for key := range touched {
+			if cnt := s.prune(key, now); cnt > s.rule.Threshold {
+				e.fire(db, s, key, cnt, now)
+			}
+		}
+	}
+} // func (e *alertEngine) evaluate(records []model.Record, now time.Time)
+
+// fire raises an Alert for the given rule and key, or updates the Alert
+// that is already open.
+func (e *alertEngine) fire(db database.Storage, s *alertRuleState, key, cnt int64, now time.Time) {
+	var (
+		err error
+		a   *model.Alert
+	)
+
+	if a = s.open[key]; a != nil {
+		a.LastSeen = now
+		a.Count = max(a.Count, cnt)
+		if err = db.AlertUpdate(a); err != nil {
+			e.log.Printf("[ERROR] Cannot update Alert %d of rule %q: %s\n",
+				a.ID,
+				s.rule.Name,
+				err.Error())
+		}
+		return
+	}
+
+	a = &model.Alert{
+		RuleID:   s.rule.ID,
+		HostID:   key,
+		Fired:    now,
+		LastSeen: now,
+		Count:    cnt,
+		Silenced: s.rule.Silenced(now),
+	}
+
+	if err = db.AlertAdd(a); err != nil {
+		e.log.Printf("[ERROR] Cannot add Alert for rule %q: %s\n",
+			s.rule.Name,
+			err.Error())
+		return
+	}
+
+	s.open[key] = a
+	e.log.Printf("[INFO] Alert rule %q fired for Host %d: %d matches in %s\n",
+		s.rule.Name,
+		key,
+		cnt,
+		s.rule.Window)
+
+	if !a.Silenced {
+		e.notify.Notify(notify.Event{Rule: s.rule, Alert: *a, Host: e.hosts[key]})
+	}
+} // func (e *alertEngine) fire(db database.Storage, s *alertRuleState, key, cnt int64, now time.Time)
+
+// resolve resolves an open Alert of the given rule.
+func (e *alertEngine) resolve(db database.Storage, s *alertRuleState, key int64, now time.Time) {
+	var a = s.open[key]
+
+	if err := db.AlertResolve(a, now); err != nil {
+		e.log.Printf("[ERROR] Cannot resolve Alert %d of rule %q: %s\n",
+			a.ID,
+			s.rule.Name,
+			err.Error())
+		return
+	}
+
+	delete(s.open, key)
+	e.log.Printf("[INFO] Alert %d of rule %q was resolved\n",
+		a.ID,
+		s.rule.Name)
+
+	if !a.Silenced {
+		e.notify.Notify(notify.Event{Rule: s.rule, Alert: *a, Host: e.hosts[key]})
+	}
+} // func (e *alertEngine) resolve(db database.Storage, s *alertRuleState, key int64, now time.Time)
+
+// check resolves the open Alerts whose rule's condition does not hold
+// anymore, forgets about matches that are too old to matter, and looks
+// for Hosts that have gone silent or log at an unusual rate.
+func (e *alertEngine) check(now time.Time) {
+	var (
+		err, rerr error
+		hosts     []model.Host
+		stats     []model.RateStat
+		db        = e.pool.Get()
+	)
+
+	defer e.pool.Put(db)
+
+	if hosts, err = db.HostGetAll(); err != nil {
+		e.log.Printf("[ERROR] Cannot load Hosts, not checking for silent ones: %s\n",
+			err.Error())
+	}
+
+	// Computing the rates takes a while, so we only do it if anyone is
+	// interested, and we do it before we make the engine wait.
+	if e.watchingRates() {
+		if stats, _, rerr = e.rates.get(db, now); rerr != nil {
+			e.log.Printf("[ERROR] Cannot compute rates, not checking for unusual ones: %s\n",
+				rerr.Error())
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, s := range e.rules {
+		if s.rule.Kind == model.RuleSilence {
+			if err == nil {
+				e.watch(db, s, hosts, now)
+			}
+			continue
+		} else if s.rule.Kind == model.RuleAnomaly {
+			if rerr == nil {
+				e.watchRates(db, s, stats, now)
+			}
+			continue
+		}
+
+		for key := range s.matches {
+			if s.prune(key, now) == 0 {
+				delete(s.matches, key)
+			}
+		}
+
+		for key := range s.open {
+			if int64(len(s.matches[key])) <= s.rule.Threshold || !s.rule.Active {
+				e.resolve(db, s, key, now)
+			}
+		}
+	}
+} // func (e *alertEngine) check(now time.Time)
+
+// watch raises an Alert for every Host that has gone silent, and resolves
+// the Alerts of Hosts that are back or have gone into maintenance.
+func (e *alertEngine) watch(db database.Storage, s *alertRuleState, hosts []model.Host, now time.Time) {
+	for i := range hosts {
+		var h = &hosts[i]
+
+		e.hosts[h.ID] = h.Name
+
+		if s.rule.Active && h.Silent(now, s.rule.Window) {
+			e.fire(db, s, h.ID, 0, now)
+		} else if s.open[h.ID] != nil {
+			e.resolve(db, s, h.ID, now)
+		}
+	}
+} // func (e *alertEngine) watch(db database.Storage, s *alertRuleState, hosts []model.Host, now time.Time)
+
+// watchingRates returns true if any active rule watches for unusual rates.
+func (e *alertEngine) watchingRates() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, s := range e.rules {
+		if s.rule.Active && s.rule.Kind == model.RuleAnomaly {
+			return true
+		}
+	}
+
+	return false
+} // func (e *alertEngine) watchingRates() bool
+
+// watchRates counts the streams that log at an unusual rate, per Host if
+// the rule says so, raises an Alert if there are more than the rule's
+// Threshold, and resolves the Alerts whose streams have calmed down.
+func (e *alertEngine) watchRates(db database.Storage, s *alertRuleState, stats []model.RateStat, now time.Time) {
+	var counts = make(map[int64]int64)
+
+	if s.rule.Active {
+		for i := range stats {
+			if !stats[i].Anomalous {
+				continue
+			} else if s.rule.PerHost {
+				counts[stats[i].HostID]++
+			} else {
+				counts[0]++
+			}
+		}
+	}
+
+	for key, cnt := range counts {
+		if cnt > s.rule.Threshold {
+			e.fire(db, s, key, cnt, now)
+		}
+	}
+
+	for key := range s.open {
+		if counts[key] <= s.rule.Threshold {
+			e.resolve(db, s, key, now)
+		}
+	}
+} // func (e *alertEngine) watchRates(db database.Storage, s *alertRuleState, stats []model.RateStat, now time.Time)
+
+// silentHosts returns the IDs of the Hosts that have an open Alert for
+// going silent.
+func (e *alertEngine) silentHosts() map[int64]bool {
+	var silent = make(map[int64]bool)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, s := range e.rules {
+		if s.rule.Kind != model.RuleSilence {
+			continue
+		}
+
+		for key := range s.open {
+			silent[key] = true
+		}
+	}
+
+	return silent
+} // func (e *alertEngine) silentHosts() map[int64]bool
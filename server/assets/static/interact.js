@@ -1,4 +1,4 @@
-// Time-stamp: <2024-09-13 19:42:14 krylon>
+// Time-stamp: <2024-10-12 17:38:27 krylon>
 // -*- mode: javascript; coding: utf-8; -*-
 // Copyright 2015-2020 Benjamin Walkenhorst <krylon@gmx.net>
 //
@@ -139,46 +139,6 @@ function db_maintenance () {
     })
 } // function db_maintenance()
 
-function toggle_visibility(hostID) {
-    const query = `tr.Host${hostID}`
-    const visible = !$(`#show_${hostID}`)[0].checked
-    $(query).each(function () {
-        if (visible) {
-            $(this).hide()
-        } else {
-            $(this).show()
-        }
-    })
-} // function toggle_visibility(hostID)
-
-function filter_source(src) {
-    const query = `tr.src_${src}`
-    const visible = !$(`#filter_src_${src}`)[0].checked
-    $(query).each(function () {
-        if (visible) {
-            $(this).hide()
-        } else {
-            $(this).show()
-        }
-    })
-} // function filter_source(src)
-
-function toggle_visibility_all() {
-    const visible = !$("#filter_toggle_all")[0].checked
-
-    const boxes = jQuery("#sources_list input.filter_src_check")
-
-    for (let i = 0; i < boxes.length; i++) {
-        boxes[i].checked = !visible
-    }
-
-    const rows = jQuery("#records > tr")
-
-    for (let i = 0; i < rows.length; i++) {
-        rows[i].hide()
-    }
-} // function toggle_visibility_all()
-
 function search_load_results(sid, page) {
     const addr = `/ajax/search/load/${sid}/${page}`
 
@@ -208,16 +168,33 @@ function search_load_results(sid, page) {
                                     jQuery("#filter_by_period_p")[0].checked = true
                                 }
 
-                                if (_.all(params.Query.terms, (x) => { return x.indexOf("(?i)") >= 0 })) {
-                                    params.Query.terms =
-                                        _.map(params.Query.terms, (x) => { return x.substring(4) })
-                                    jQuery("#case_insensitive")[0].checked = true
-                                } else {
-                                    jQuery("#case_insensitive")[0].checked = false
+                                // Searches saved before there were lists of
+                                // terms to match all of or to exclude do not
+                                // have them.
+                                const lists = {
+                                    "#search_terms": params.Query.terms,
+                                    "#search_terms_all": defined(params.Query.terms_all) ? params.Query.terms_all : [],
+                                    "#search_terms_exclude": defined(params.Query.terms_exclude) ? params.Query.terms_exclude : [],
                                 }
+                                const all_terms = _.flatten(_.values(lists))
+                                const ci = _.all(all_terms, (x) => { return x.indexOf("(?i)") == 0 })
+
+                                jQuery("#case_insensitive")[0].checked = ci
 
-                                jQuery("#search_terms")[0].value = params.Query.terms.join("\n")
+                                for (const [id, terms] of Object.entries(lists)) {
+                                    jQuery(id)[0].value = _.map(terms, (x) => {
+                                        return ci ? x.substring(4) : x
+                                    }).join("\n")
+                                }
+                                jQuery("#search_query")[0].value = defined(params.Query.query) ? params.Query.query : ""
+                                jQuery("#search_query_error")[0].innerText = ""
                                 jQuery("#search_id")[0].value = sid
+                                jQuery("#search_title")[0].value = params.Title
+                                jQuery("#search_description")[0].value = params.Description
+
+                                const link = jQuery("#search_link")[0]
+                                link.href = `/search/${sid}`
+                                link.innerText = `${window.location.origin}/search/${sid}`
                             } else {
                                 const msg = `Error loading search results: ${res.Message}`
                                 console.log(msg)
@@ -246,6 +223,8 @@ function search_delete(id) {
                                     clear_results()
                                     clear_filters()
                                     jQuery("#search_id")[0].value = ""
+                                    jQuery("#search_title")[0].value = ""
+                                    jQuery("#search_description")[0].value = ""
                                 }
                             } else {
                                 console.log(res.Message)
@@ -258,3 +237,168 @@ function search_delete(id) {
                            console.log(`Error searching: ${status_text} ${reply} ${xhr}`)
                        })
 } // function search_delete(id)
+
+function search_download(id) {
+    const format = jQuery("#export_format")[0].value
+    const compress = jQuery("#export_compress")[0].checked
+
+    window.location.href = `/export/search/${id}?format=${format}&compress=${compress}`
+} // function search_download(id)
+
+// record_label labels a Record as "interesting" or "boring", or removes
+// its label if label is the empty string.
+function record_label(id, label) {
+    const addr = `/ajax/record/label/${id}`
+    const req = $.post(addr,
+                       JSON.stringify({ "label": label }),
+                       (res) => {
+                           if (res.Status) {
+                               jQuery(`#label_${id}`)[0].innerText = label
+                           } else {
+                               console.log(res.Message)
+                               alert(res.Message)
+                           }
+                       },
+                       'json')
+
+    req.fail((reply, status_text, xhr) => {
+        const msg = defined(reply.responseJSON) ? reply.responseJSON.Message : status_text
+        console.log(`Error posting to ${addr}: ${msg}`)
+        alert(msg)
+    })
+} // function record_label(id, label)
+
+// record_post sends data to one of the handlers that change the
+// Annotations or Tags of a Record and reloads the page if it succeeded.
+function record_post(addr, data) {
+    const req = $.post(addr,
+                       JSON.stringify(data),
+                       (res) => {
+                           if (res.Status) {
+                               window.location.reload()
+                           } else {
+                               console.log(res.Message)
+                               alert(res.Message)
+                           }
+                       },
+                       'json')
+
+    req.fail((reply, status_text, xhr) => {
+        const msg = defined(reply.responseJSON) ? reply.responseJSON.Message : status_text
+        console.log(`Error posting to ${addr}: ${msg}`)
+        alert(msg)
+    })
+} // function record_post(addr, data)
+
+function record_tag(id) {
+    const tag = jQuery(`#tag_${id}`)[0].value
+
+    record_post(`/ajax/record/tag/${id}`, { "tag": tag })
+} // function record_tag(id)
+
+function record_untag(id, tag) {
+    record_post(`/ajax/record/untag/${id}`, { "tag": tag })
+} // function record_untag(id, tag)
+
+function record_annotate(id) {
+    const text = jQuery(`#annotation_text_${id}`)[0].value
+
+    record_post(`/ajax/record/annotate/${id}`, { "text": text })
+} // function record_annotate(id)
+
+function annotation_delete(id) {
+    if (!confirm("Delete this annotation?")) {
+        return
+    }
+
+    record_post(`/ajax/annotation/delete/${id}`, {})
+} // function annotation_delete(id)
+
+// incident_time returns the value of a datetime-local input as a Date, or
+// null if it is empty.
+function incident_time(sel) {
+    const val = jQuery(sel)[0].value
+
+    return val == "" ? null : new Date(val)
+} // function incident_time(sel)
+
+function incident_save() {
+    const inc = {
+        "id": Number.parseInt(jQuery("#incident_id")[0].value),
+        "title": jQuery("#incident_title")[0].value,
+        "summary": jQuery("#incident_summary")[0].value,
+        "begin": incident_time("#incident_begin"),
+        "end": incident_time("#incident_end"),
+        "status": jQuery("#incident_status")[0].value,
+    }
+
+    const req = $.post("/ajax/incident/save",
+                       JSON.stringify(inc),
+                       (res) => {
+                           if (res.Status) {
+                               window.location.href = `/incident/${res.Payload.id}`
+                           } else {
+                               console.log(res.Message)
+                               alert(res.Message)
+                           }
+                       },
+                       'json')
+
+    req.fail((reply, status_text, xhr) => {
+        const msg = defined(reply.responseJSON) ? reply.responseJSON.Message : status_text
+        console.log(`Error saving Incident: ${msg}`)
+        alert(msg)
+    })
+} // function incident_save()
+
+function incident_delete(id, title) {
+    if (!confirm(`Delete Incident ${title}? Pinned Records and Searches are kept.`)) {
+        return
+    }
+
+    const req = $.post(`/ajax/incident/delete/${id}`,
+                       "{}",
+                       (res) => {
+                           if (res.Status) {
+                               window.location.href = "/incidents"
+                           } else {
+                               console.log(res.Message)
+                               alert(res.Message)
+                           }
+                       },
+                       'json')
+
+    req.fail((reply, status_text, xhr) => {
+        const msg = defined(reply.responseJSON) ? reply.responseJSON.Message : status_text
+        console.log(`Error deleting Incident ${id}: ${msg}`)
+        alert(msg)
+    })
+} // function incident_delete(id, title)
+
+// incident_pin_record pins the Record with the given ID to the Incident
+// selected on the Record's page.
+function incident_pin_record(id) {
+    const inc = jQuery("#pin_incident")[0].value
+    const note = jQuery("#pin_note")[0].value
+
+    if (inc == "") {
+        alert("No Incident was selected")
+        return
+    }
+
+    record_post(`/ajax/incident/pin/${inc}`, { "record": id, "note": note })
+} // function incident_pin_record(id)
+
+function incident_pin_search(id) {
+    const sid = Number.parseInt(jQuery("#pin_search")[0].value)
+
+    record_post(`/ajax/incident/pin/${id}`, { "search": sid })
+} // function incident_pin_search(id)
+
+function incident_unpin_record(id, rec_id) {
+    record_post(`/ajax/incident/unpin/${id}`, { "record": rec_id })
+} // function incident_unpin_record(id, rec_id)
+
+function incident_unpin_search(id, sid) {
+    record_post(`/ajax/incident/unpin/${id}`, { "search": sid })
+} // function incident_unpin_search(id, sid)
@@ -0,0 +1,214 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/classify.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 10. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:31:15 krylon>
+
+// This file implements the scoring of Records: The user labels Records as
+// interesting or boring, the classifier learns from the Labels, and the
+// Records the Agents submit are scored as they come in.
+
+package server
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/blicero/scrollmaster/classify"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// rescoreWindow is how far back Records are scored again when the
+// classifier has been retrained. Older Records keep their Scores.
+const rescoreWindow = time.Hour * 24
+
+// rescorePageSize is the number of Records that are scored again at once.
+const rescorePageSize = 1000
+
+// trainDelay is how long we wait before retraining the classifier. Users
+// tend to label several Records in a row, this way we train once for all
+// of them.
+const trainDelay = time.Second * 5
+
+// classifier scores incoming Records with a Model trained on the Labels.
+// Training happens in a goroutine of its own, so incoming Records are
+// scored with the previous Model in the meantime.
+type classifier struct {
+	*ingestQueue
+	log     *log.Logger
+	pool    *database.Pool
+	lock    sync.Mutex
+	model   *classify.Model
+	retrain chan struct{}
+}
+
+func newClassifier(l *log.Logger, pool *database.Pool) *classifier {
+	return &classifier{
+		ingestQueue: newIngestQueue(l, "Classifier"),
+		log:         l,
+		pool:        pool,
+		retrain:     make(chan struct{}, 1),
+	}
+} // func newClassifier(l *log.Logger, pool *database.Pool) *classifier
+
+// current returns the Model currently used for scoring, which may be nil.
+func (c *classifier) current() *classify.Model {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.model
+} // func (c *classifier) current() *classify.Model
+
+// train asks for the Model to be retrained. It never blocks, requests
+// that come in while the Model is being trained are merged into one.
+func (c *classifier) train() {
+	select {
+	case c.retrain <- struct{}{}:
+	default:
+	}
+} // func (c *classifier) train()
+
+// run is the classifier's main loop.
+func (c *classifier) run() {
+	go c.trainLoop()
+	c.train()
+
+	for records := range c.in {
+		c.score(records) // nolint: errcheck
+	}
+} // func (c *classifier) run()
+
+func (c *classifier) trainLoop() {
+	for range c.retrain {
+		time.Sleep(trainDelay)
+
+		// Requests that came in while we were waiting are covered by
+		// this round.
+		select {
+		case <-c.retrain:
+		default:
+		}
+
+		c.fit() // nolint: errcheck
+	}
+} // func (c *classifier) trainLoop()
+
+// fit trains a new Model on the Labels and scores the recent Records
+// again.
+func (c *classifier) fit() error {
+	var (
+		err    error
+		labels []model.Label
+		m      *classify.Model
+		db     = c.pool.Get()
+	)
+
+	defer c.pool.Put(db)
+
+	if labels, err = db.LabelGetAll(); err != nil {
+		c.log.Printf("[ERROR] Cannot load Labels: %s\n", err.Error())
+		return err
+	}
+
+	m = classify.Train(labels)
+
+	c.lock.Lock()
+	c.model = m
+	c.lock.Unlock()
+
+	c.log.Printf("[DEBUG] Classifier was trained on %d Labels\n",
+		m.Examples())
+
+	if !m.Ready() {
+		return nil
+	}
+
+	return c.rescore(db, m, time.Now().Add(-rescoreWindow))
+} // func (c *classifier) fit() error
+
+// rescore scores the Records since the given time again, one page at a
+// time, so we never hold all of them in memory at once.
+func (c *classifier) rescore(db database.Storage, m *classify.Model, since time.Time) error {
+	var (
+		err     error
+		records []model.Record
+		page    = database.RecordPage{Count: rescorePageSize}
+	)
+
+	for {
+		if records, err = db.RecordGetPage(&page); err != nil {
+			c.log.Printf("[ERROR] Cannot load recent Records: %s\n", err.Error())
+			return err
+		} else if len(records) == 0 {
+			return nil
+		}
+
+		var (
+			last = records[len(records)-1]
+			idx  = slices.IndexFunc(records, func(r model.Record) bool {
+				return r.Time.Before(since)
+			})
+		)
+
+		// Pages are ordered most recent first, so once we reach a
+		// Record that is too old, we are done.
+		if idx >= 0 {
+			records = records[:idx]
+		}
+
+		if len(records) > 0 {
+			if err = c.save(db, m, records); err != nil {
+				return err
+			}
+		}
+
+		if idx >= 0 || int64(len(records)) < page.Count {
+			return nil
+		}
+
+		page.Stamp, page.ID = last.Time, last.ID
+	}
+} // func (c *classifier) rescore(db database.Storage, m *classify.Model, since time.Time) error
+
+// score scores the Records with the current Model. Until the Model has
+// seen both interesting and boring Records, nothing is scored.
+func (c *classifier) score(records []model.Record) error {
+	var m = c.current()
+
+	if !m.Ready() {
+		return nil
+	}
+
+	var db = c.pool.Get()
+	defer c.pool.Put(db)
+
+	return c.save(db, m, records)
+} // func (c *classifier) score(records []model.Record) error
+
+func (c *classifier) save(db database.Storage, m *classify.Model, records []model.Record) error {
+	var (
+		err  error
+		list = make([]model.Score, len(records))
+	)
+
+	for i := range records {
+		list[i] = model.Score{
+			RecordID: records[i].ID,
+			HostID:   records[i].HostID,
+			Time:     records[i].Time,
+			Value:    m.Score(&records[i]),
+		}
+	}
+
+	if err = db.ScoreAdd(list); err != nil {
+		c.log.Printf("[ERROR] Cannot save %d Scores: %s\n",
+			len(list),
+			err.Error())
+		return err
+	}
+
+	return nil
+} // func (c *classifier) save(db database.Storage, m *classify.Model, records []model.Record) error
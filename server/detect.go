@@ -0,0 +1,188 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/detect.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 09. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:16:40 krylon>
+
+// This file implements the detection of well-known events: The Records the
+// Agents submit are matched against the Signatures as they come in, and
+// the matching Records are tagged with the Signature's category and
+// severity.
+
+package server
+
+import (
+	"log"
+	"sync"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/detect"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// detector matches incoming Records against the Signatures. Like the
+// pattern miner, it has a queue of its own, because Records it drops are
+// never tagged.
+type detector struct {
+	*ingestQueue
+	log     *log.Logger
+	pool    *database.Pool
+	lock    sync.Mutex
+	matcher *detect.Matcher
+	hosts   map[int64]bool
+}
+
+func newDetector(l *log.Logger, pool *database.Pool) *detector {
+	return &detector{
+		ingestQueue: newIngestQueue(l, "Detector"),
+		log:         l,
+		pool:        pool,
+		matcher:     detect.NewMatcher(),
+		hosts:       make(map[int64]bool),
+	}
+} // func newDetector(l *log.Logger, pool *database.Pool) *detector
+
+// load makes sure the database has the current version of the built-in
+// Signatures, and (re-)loads the active Signatures.
+func (d *detector) load(db database.Storage) error {
+	var (
+		err   error
+		sigs  []model.Signature
+		hosts []model.Host
+	)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err = d.sync(db); err != nil {
+		return err
+	} else if sigs, err = db.SignatureGetAll(); err != nil {
+		d.log.Printf("[ERROR] Cannot load Signatures: %s\n", err.Error())
+		return err
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		d.log.Printf("[ERROR] Cannot load Hosts: %s\n", err.Error())
+		return err
+	}
+
+	d.hosts = make(map[int64]bool, len(hosts))
+	for _, h := range hosts {
+		d.hosts[h.ID] = true
+	}
+
+	if err = d.matcher.Load(sigs, hosts); err != nil {
+		// The other Signatures still work, so this is not fatal.
+		d.log.Printf("[ERROR] %s\n", err.Error())
+	}
+
+	return nil
+} // func (d *detector) load(db database.Storage) error
+
+// reload gets a connection from the pool and (re-)loads the Signatures.
+func (d *detector) reload() error {
+	var db = d.pool.Get()
+	defer d.pool.Put(db)
+
+	return d.load(db)
+} // func (d *detector) reload() error
+
+// sync adds the built-in Signatures that are missing from the database and
+// updates the ones that have changed. Whether they are active is up to the
+// user. The caller must hold the lock.
+func (d *detector) sync(db database.Storage) error {
+	var (
+		err    error
+		sigs   []model.Signature
+		byName map[string]*model.Signature
+	)
+
+	if sigs, err = db.SignatureGetAll(); err != nil {
+		d.log.Printf("[ERROR] Cannot load Signatures: %s\n", err.Error())
+		return err
+	}
+
+	byName = make(map[string]*model.Signature, len(sigs))
+	for i := range sigs {
+		byName[sigs[i].Name] = &sigs[i]
+	}
+
+	for _, lib := range detect.Library() {
+		var cur = byName[lib.Name]
+
+		if cur == nil {
+			if err = db.SignatureAdd(&lib); err != nil {
+				return err
+			}
+			continue
+		} else if !cur.Builtin {
+			d.log.Printf("[INFO] Signature %q shadows the built-in Signature of the same name\n",
+				cur.Name)
+			continue
+		} else if cur.Category == lib.Category &&
+			cur.Severity == lib.Severity &&
+			cur.Description == lib.Description &&
+			cur.Query.Query == lib.Query.Query &&
+			cur.Threshold == lib.Threshold &&
+			cur.Window == lib.Window {
+			continue
+		}
+
+		lib.ID = cur.ID
+		lib.Active = cur.Active
+
+		if err = db.SignatureUpdate(&lib); err != nil {
+			return err
+		}
+	}
+
+	return nil
+} // func (d *detector) sync(db database.Storage) error
+
+// run is the detector's main loop.
+func (d *detector) run() {
+	if err := d.reload(); err != nil {
+		d.log.Printf("[ERROR] Signatures could not be loaded, they will be matched once they are edited: %s\n",
+			err.Error())
+	}
+
+	for records := range d.in {
+		d.scan(records) // nolint: errcheck
+	}
+} // func (d *detector) run()
+
+// scan matches the Records against the Signatures and saves the
+// Detections.
+func (d *detector) scan(records []model.Record) error {
+	var (
+		err     error
+		unknown bool
+		found   []model.Detection
+	)
+
+	d.lock.Lock()
+	unknown = unknownHost(d.hosts, records)
+	d.lock.Unlock()
+
+	if unknown {
+		d.reload() // nolint: errcheck
+	}
+
+	d.lock.Lock()
+	found = d.matcher.Match(records)
+	d.lock.Unlock()
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	var db = d.pool.Get()
+	defer d.pool.Put(db)
+
+	if err = db.DetectionAdd(found); err != nil {
+		d.log.Printf("[ERROR] Cannot save %d Detections: %s\n",
+			len(found),
+			err.Error())
+		return err
+	}
+
+	return nil
+} // func (d *detector) scan(records []model.Record) error
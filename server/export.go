@@ -0,0 +1,260 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/export.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 22. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:26:12 krylon>
+//
+// This file contains the handlers for exporting Records and Incident reports.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/export"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/gorilla/mux"
+)
+
+// exportParams extracts the format and compression of an export from the
+// query parameters of a request. The default is uncompressed NDJSON.
+func exportParams(r *http.Request) (export.Format, bool, error) {
+	var (
+		err      error
+		format   = export.NDJSON
+		compress bool
+		params   = r.URL.Query()
+	)
+
+	if fstr := params.Get("format"); fstr != "" {
+		if format, err = export.ParseFormat(fstr); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if cstr := params.Get("compress"); cstr != "" {
+		if compress, err = strconv.ParseBool(cstr); err != nil {
+			return 0, false, fmt.Errorf("Invalid value for compress: %q", cstr)
+		}
+	}
+
+	return format, compress, nil
+} // func exportParams(r *http.Request) (export.Format, bool, error)
+
+// sendExport streams an export to the client. run does the actual work of
+// writing the Records.
+func (srv *Server) sendExport(w http.ResponseWriter, db database.Storage, name string, format export.Format, compress bool, run func(*export.Writer) error) {
+	var (
+		err   error
+		hosts map[int64]string
+		ew    *export.Writer
+	)
+
+	if hosts, err = export.HostNames(db); err != nil {
+		srv.sendErrorMessage(w,
+			fmt.Sprintf("Failed to query all Hosts from database: %s",
+				err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.MimeType(compress))
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", format.FileName(name, compress)))
+	w.WriteHeader(200)
+
+	ew = export.NewWriter(w, format, compress, hosts)
+
+	// Once we started sending the export, we cannot send an error message
+	// anymore, so all we can do is log the error.
+	if err = run(ew); err != nil {
+		srv.log.Printf("[ERROR] Export %s failed after %d Records: %s\n",
+			name,
+			ew.Count(),
+			err.Error())
+	} else if err = ew.Close(); err != nil {
+		srv.log.Printf("[ERROR] Failed to finish export %s: %s\n",
+			name,
+			err.Error())
+	} else {
+		srv.log.Printf("[DEBUG] Exported %d Records to %s\n",
+			ew.Count(),
+			format.FileName(name, compress))
+	}
+} // func (srv *Server) sendExport(...)
+
+// handleExportQuery exports all Records matching the query in the body of
+// the request, which is a SearchQuery in JSON.
+func (srv *Server) handleExportQuery(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err      error
+		msg      string
+		format   export.Format
+		compress bool
+		query    model.SearchQuery
+		db       database.Storage
+	)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Export requires a query to be POSTed", http.StatusMethodNotAllowed)
+		return
+	} else if format, compress, err = exportParams(r); err != nil {
+		srv.log.Printf("[ERROR] %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err = json.NewDecoder(r.Body).Decode(&query); err != nil {
+		msg = fmt.Sprintf("Failed to parse search query: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	} else if !srv.searchAcquire(r.Context()) {
+		return
+	}
+
+	// Exporting a query scans the database just like a search does.
+	defer srv.searchRelease()
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if err = database.CompileSearch(db, &query); err != nil {
+		srv.log.Printf("[INFO] Invalid search query %q: %s\n",
+			query.Query,
+			err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	srv.sendExport(
+		w,
+		db,
+		"export_"+time.Now().Format("20060102_150405"),
+		format,
+		compress,
+		func(ew *export.Writer) error { return export.Query(r.Context(), db, &query, ew) })
+} // func (srv *Server) handleExportQuery(w http.ResponseWriter, r *http.Request)
+
+// handleExportSearch exports the results of a saved Search.
+func (srv *Server) handleExportSearch(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err      error
+		msg      string
+		id       int64
+		format   export.Format
+		compress bool
+		search   *model.Search
+		db       database.Storage
+		vars     = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Search ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	} else if format, compress, err = exportParams(r); err != nil {
+		srv.log.Printf("[ERROR] %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if search, err = db.SearchGetByID(id); err != nil {
+		srv.sendErrorMessage(w,
+			fmt.Sprintf("Failed to load Search #%d: %s",
+				id,
+				err.Error()))
+		return
+	} else if search == nil {
+		http.Error(w, fmt.Sprintf("Search #%d does not exist", id), http.StatusNotFound)
+		return
+	}
+
+	srv.sendExport(
+		w,
+		db,
+		fmt.Sprintf("search_%d", id),
+		format,
+		compress,
+		func(ew *export.Writer) error { return export.Search(db, id, ew) })
+} // func (srv *Server) handleExportSearch(w http.ResponseWriter, r *http.Request)
+
+// incidentReportMax is the maximum number of results of each pinned Search
+// that go into an Incident report.
+const incidentReportMax = 5000
+
+// handleExportIncident writes up an Incident for a post-mortem. The query
+// parameter format is either markdown (the default) or html.
+func (srv *Server) handleExportIncident(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err    error
+		msg    string
+		id     int64
+		format = export.Markdown
+		rep    *export.Report
+		db     database.Storage
+		vars   = mux.Vars(r)
+	)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Incident ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	} else if fstr := r.URL.Query().Get("format"); fstr != "" {
+		if format, err = export.ParseReportFormat(fstr); err != nil {
+			srv.log.Printf("[ERROR] %s\n", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if rep, err = export.LoadReport(db, id, incidentReportMax); err != nil {
+		srv.sendErrorMessage(w,
+			fmt.Sprintf("Failed to load Incident #%d: %s",
+				id,
+				err.Error()))
+		return
+	} else if rep == nil {
+		http.Error(w, fmt.Sprintf("Incident #%d does not exist", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.MimeType())
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", format.FileName(fmt.Sprintf("incident_%d", id))))
+	w.WriteHeader(200)
+
+	if err = rep.Write(w, format); err != nil {
+		srv.log.Printf("[ERROR] Failed to write report on Incident %d: %s\n",
+			id,
+			err.Error())
+	}
+} // func (srv *Server) handleExportIncident(w http.ResponseWriter, r *http.Request)
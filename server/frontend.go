@@ -2,21 +2,26 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 05. 09. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-11 20:12:22 krylon>
+// Time-stamp: <2024-10-13 11:43:20 krylon>
 //
 // This file contains handlers etc. having to do with the web-based frontend.
 
 package server
 
 import (
+	"cmp"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/export"
+	"github.com/blicero/scrollmaster/model"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 )
@@ -30,7 +35,7 @@ func (srv *Server) handleMain(w http.ResponseWriter, r *http.Request) {
 		err  error
 		msg  string
 		tmpl *template.Template
-		db   *database.Database
+		db   database.Storage
 		sess *sessions.Session
 		data = tmplDataIndex{
 			tmplDataBase: tmplDataBase{
@@ -61,6 +66,8 @@ func (srv *Server) handleMain(w http.ResponseWriter, r *http.Request) {
 		srv.sendErrorMessage(w, msg)
 	}
 
+	data.Silent = srv.alerts.silentHosts()
+
 	if err = sess.Save(r, w); err != nil {
 		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
 			err.Error())
@@ -76,6 +83,11 @@ func (srv *Server) handleMain(w http.ResponseWriter, r *http.Request) {
 	}
 } // func (srv *Server) handleMain(w http.ResponseWriter, r *http.Request)
 
+// handleLogRecent displays a page of Records, most recent first.
+// The query parameters host and source (both may be given more than once)
+// restrict the Records to the given Hosts and sources, before and after
+// select the page right before or after the position of a Record, as
+// created by logCursor.
 func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
 		r.URL.EscapedPath(),
@@ -86,10 +98,11 @@ func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 		err       error
 		msg, nstr string
 		tmpl      *template.Template
-		db        *database.Database
-		cnt       int64
+		db        database.Storage
 		sess      *sessions.Session
 		vars      map[string]string
+		sources   map[string]int64
+		page      *database.RecordPage
 		data      = tmplDataLog{
 			tmplDataBase: tmplDataBase{
 				Title: "Main",
@@ -108,12 +121,15 @@ func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 		nstr = "500"
 	}
 
-	if cnt, err = strconv.ParseInt(nstr, 10, 64); err != nil {
-		msg = fmt.Sprintf("Failed to parse number of records to display (%q): %s",
-			nstr,
-			err.Error())
+	if data.Count, err = strconv.ParseInt(nstr, 10, 64); err != nil || data.Count <= 0 {
+		msg = fmt.Sprintf("Invalid number of records to display: %q", nstr)
 		srv.log.Printf("[ERROR] %s\n", msg)
-		srv.sendErrorMessage(w, msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	} else if page, err = logPage(r.URL.Query(), data.Count); err != nil {
+		msg = fmt.Sprintf("Invalid query parameters: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusBadRequest)
 		return
 	} else if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
 		msg = fmt.Sprintf("Error getting client session from session store: %s",
@@ -131,9 +147,36 @@ func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 		srv.log.Printf("[ERROR] %s\n", msg)
 		srv.sendErrorMessage(w, msg)
 		return
-	} else if data.Records, err = db.RecordGetRecent(cnt); err != nil {
-		msg = fmt.Sprintf("Failed to get query %d most recent records from database: %s",
-			cnt,
+	} else if sources, err = db.RecordGetSources(); err != nil {
+		msg = fmt.Sprintf("Failed to query sources from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records, err = db.RecordGetPage(page); err != nil {
+		msg = fmt.Sprintf("Failed to query %d records from database: %s",
+			data.Count,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if page.Newer && int64(len(data.Records)) < data.Count {
+		// We paged past the most recent Records, so we show the most
+		// recent page instead of a short one.
+		page.Stamp = time.Time{}
+		page.Newer = false
+
+		if data.Records, err = db.RecordGetPage(page); err != nil {
+			msg = fmt.Sprintf("Failed to query %d most recent records from database: %s",
+				data.Count,
+				err.Error())
+			srv.log.Printf("[ERROR] %s\n", msg)
+			srv.sendErrorMessage(w, msg)
+			return
+		}
+	}
+
+	if data.Annotations, data.Tags, err = recordNotes(db, data.Records); err != nil {
+		msg = fmt.Sprintf("Failed to query Annotations and Tags: %s",
 			err.Error())
 		srv.log.Printf("[ERROR] %s\n", msg)
 		srv.sendErrorMessage(w, msg)
@@ -145,19 +188,41 @@ func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 		data.Hostnames[h.ID] = h.NameShort()
 	}
 
-	data.Sources = make([]string, 0, 16)
-	var srcMap = make(map[string]bool)
-
-	for _, r := range data.Records {
-		var ok bool
-		if _, ok = srcMap[r.Source]; !ok {
-			srcMap[r.Source] = true
-			data.Sources = append(data.Sources, r.Source)
-		}
+	data.Sources = make([]string, 0, len(sources))
+	for src := range sources {
+		data.Sources = append(data.Sources, src)
 	}
 
 	slices.Sort(data.Sources)
 
+	data.FilterHosts = make(map[int64]bool, len(page.Hosts))
+	for _, id := range page.Hosts {
+		data.FilterHosts[id] = true
+	}
+
+	data.FilterSources = make(map[string]bool, len(page.Sources))
+	for _, src := range page.Sources {
+		data.FilterSources[src] = true
+	}
+
+	if len(data.Records) > 0 {
+		var (
+			first = &data.Records[0]
+			last  = &data.Records[len(data.Records)-1]
+		)
+
+		// The permalink must still show the same page when more
+		// Records have come in, so it points right after the first
+		// Record on the page.
+		data.Permalink = logPageURL(data.Count, page, "before", logCursor(first.Time, first.ID+1))
+		if !page.Stamp.IsZero() {
+			data.Newer = logPageURL(data.Count, page, "after", logCursor(first.Time, first.ID))
+		}
+		if int64(len(data.Records)) == data.Count {
+			data.Older = logPageURL(data.Count, page, "before", logCursor(last.Time, last.ID))
+		}
+	}
+
 	if err = sess.Save(r, w); err != nil {
 		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
 			err.Error())
@@ -173,6 +238,92 @@ func (srv *Server) handleLogRecent(w http.ResponseWriter, r *http.Request) {
 	}
 } // func (srv *Server)  handleLogRecent(w http.ResponseWriter, r *http.Request)
 
+// logPage builds a RecordPage from the query parameters of the recent-log
+// page.
+func logPage(q url.Values, cnt int64) (*database.RecordPage, error) {
+	var (
+		err  error
+		page = &database.RecordPage{Count: cnt}
+	)
+
+	for _, s := range q["host"] {
+		var id int64
+
+		if id, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid Host ID %q: %w", s, err)
+		}
+
+		page.Hosts = append(page.Hosts, id)
+	}
+
+	for _, src := range q["source"] {
+		if src != "" {
+			page.Sources = append(page.Sources, src)
+		}
+	}
+
+	if s := q.Get("before"); s != "" {
+		if page.Stamp, page.ID, err = parseLogCursor(s); err != nil {
+			return nil, err
+		}
+	} else if s = q.Get("after"); s != "" {
+		if page.Stamp, page.ID, err = parseLogCursor(s); err != nil {
+			return nil, err
+		}
+		page.Newer = true
+	}
+
+	return page, nil
+} // func logPage(q url.Values, cnt int64) (*database.RecordPage, error)
+
+// logCursor formats the position of a Record for the before and after
+// parameters of the recent-log page.
+func logCursor(stamp time.Time, id int64) string {
+	return fmt.Sprintf("%d.%d", stamp.Unix(), id)
+} // func logCursor(stamp time.Time, id int64) string
+
+func parseLogCursor(s string) (time.Time, int64, error) {
+	var (
+		err       error
+		stamp, id int64
+		pieces    = strings.Split(s, ".")
+	)
+
+	if len(pieces) != 2 {
+		return time.Time{}, 0, fmt.Errorf("Invalid position %q", s)
+	} else if stamp, err = strconv.ParseInt(pieces[0], 10, 64); err != nil {
+		return time.Time{}, 0, fmt.Errorf("Invalid time stamp in position %q: %w", s, err)
+	} else if id, err = strconv.ParseInt(pieces[1], 10, 64); err != nil {
+		return time.Time{}, 0, fmt.Errorf("Invalid ID in position %q: %w", s, err)
+	}
+
+	return time.Unix(stamp, 0), id, nil
+} // func parseLogCursor(s string) (time.Time, int64, error)
+
+// logPageURL returns the URL of a page of the recent-log with the same
+// filters as the given page. If key is not empty, it is set to cursor.
+func logPageURL(cnt int64, page *database.RecordPage, key, cursor string) string {
+	var q = make(url.Values)
+
+	for _, id := range page.Hosts {
+		q.Add("host", strconv.FormatInt(id, 10))
+	}
+
+	for _, src := range page.Sources {
+		q.Add("source", src)
+	}
+
+	if key != "" {
+		q.Set(key, cursor)
+	}
+
+	if len(q) == 0 {
+		return fmt.Sprintf("/log/recent/%d", cnt)
+	}
+
+	return fmt.Sprintf("/log/recent/%d?%s", cnt, q.Encode())
+} // func logPageURL(cnt int64, page *database.RecordPage, key, cursor string) string
+
 func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
 		r.URL.EscapedPath(),
@@ -182,8 +333,9 @@ func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		err  error
 		msg  string
 		tmpl *template.Template
-		db   *database.Database
+		db   database.Storage
 		sess *sessions.Session
+		vars = mux.Vars(r)
 		data = tmplDataSearch{
 			tmplDataBase: tmplDataBase{
 				Title: "Main",
@@ -219,14 +371,41 @@ func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		srv.log.Printf("[ERROR] %s\n", msg)
 		srv.sendErrorMessage(w, msg)
 		return
-	} else if data.Searches, err = db.SearchGetAllID(); err != nil {
-		msg = fmt.Sprintf("Failed to query all search IDs: %s", err.Error())
+	} else if data.Searches, err = db.SearchGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Searches: %s", err.Error())
 		srv.log.Printf("[ERROR] %s\n",
 			msg)
 		srv.sendErrorMessage(w, msg)
 		return
 	}
 
+	// /search/{id} is the permanent address of a saved Search, the page
+	// loads it right away.
+	if vars["id"] != "" {
+		var id int64
+
+		if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+			msg = fmt.Sprintf("Cannot parse Search ID %q: %s",
+				vars["id"],
+				err.Error())
+			srv.log.Printf("[ERROR] %s\n", msg)
+			srv.sendErrorMessage(w, msg)
+			return
+		} else if data.Current, err = db.SearchGetByID(id); err != nil {
+			msg = fmt.Sprintf("Failed to load Search #%d: %s", id, err.Error())
+			srv.log.Printf("[ERROR] %s\n", msg)
+			srv.sendErrorMessage(w, msg)
+			return
+		} else if data.Current == nil {
+			msg = fmt.Sprintf("Search #%d does not exist", id)
+			srv.log.Printf("[INFO] %s\n", msg)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		data.Title = data.Current.Name()
+	}
+
 	if err = sess.Save(r, w); err != nil {
 		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
 			err.Error())
@@ -241,3 +420,1247 @@ func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		srv.sendErrorMessage(w, msg)
 	}
 } // func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request)
+
+// contextDefault is the number of Records the context view shows before and
+// after a Record unless asked otherwise, contextMax is the most it shows.
+const (
+	contextDefault = 25
+	contextMax     = 1000
+)
+
+// contextParam parses the query parameter with the given name as the number
+// of Records to show in the context view.
+func contextParam(r *http.Request, name string) (int64, error) {
+	var (
+		err error
+		n   int64
+		str = r.URL.Query().Get(name)
+	)
+
+	if str == "" {
+		return contextDefault, nil
+	} else if n, err = strconv.ParseInt(str, 10, 64); err != nil {
+		return 0, fmt.Errorf("Cannot parse parameter %s (%q): %w",
+			name,
+			str,
+			err)
+	} else if n < 0 {
+		return 0, fmt.Errorf("Parameter %s must not be negative: %d",
+			name,
+			n)
+	} else if n > contextMax {
+		n = contextMax
+	}
+
+	return n, nil
+} // func contextParam(r *http.Request, name string) (int64, error)
+
+// alertHistoryCnt is the default number of Alerts shown on the alerts
+// page.
+const alertHistoryCnt = 250
+
+// handleAlerts displays the alert rules, the Alerts that are firing, and
+// the history of Alerts. The query parameter max is the number of Alerts
+// from the history to show.
+func (srv *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "alerts"
+	var (
+		err   error
+		msg   string
+		cnt   int64 = alertHistoryCnt
+		tmpl  *template.Template
+		db    database.Storage
+		sess  *sessions.Session
+		hosts []model.Host
+		data  = tmplDataAlerts{
+			tmplDataBase: tmplDataBase{
+				Title: "Alerts",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Now: time.Now(),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if s := r.URL.Query().Get("max"); s != "" {
+		if cnt, err = strconv.ParseInt(s, 10, 64); err != nil {
+			msg = fmt.Sprintf("Invalid number of Alerts to display: %q", s)
+			srv.log.Printf("[ERROR] %s\n", msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Rules, err = db.AlertRuleGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query alert rules from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Open, err = db.AlertGetOpen(); err != nil {
+		msg = fmt.Sprintf("Failed to query open Alerts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.History, err = db.AlertGetHistory(cnt); err != nil {
+		msg = fmt.Sprintf("Failed to query Alert history from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Hostnames = make(map[int64]string, len(hosts)+1)
+	data.Hostnames[0] = "any Host"
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	data.RuleNames = make(map[int64]string, len(data.Rules))
+	data.RuleQueries = make(map[int64]string, len(data.Rules))
+	for i := range data.Rules {
+		var rule = &data.Rules[i]
+		data.RuleNames[rule.ID] = rule.Name
+		data.RuleQueries[rule.ID] = queryString(&rule.Query)
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleAlerts(w http.ResponseWriter, r *http.Request)
+
+// deliveryCnt is the number of entries of the delivery log shown on the
+// notifiers page.
+const deliveryCnt = 100
+
+// handleNotifiers displays the Notifiers and the most recent entries of
+// the delivery log.
+func (srv *Server) handleNotifiers(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "notifiers"
+	var (
+		err  error
+		msg  string
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		data = tmplDataNotifiers{
+			tmplDataBase: tmplDataBase{
+				Title: "Notifiers",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Kinds: model.AllNotifierKinds(),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Notifiers, err = db.NotifierGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query Notifiers from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Deliveries, err = db.DeliveryGetRecent(deliveryCnt); err != nil {
+		msg = fmt.Sprintf("Failed to query delivery log from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.NotifierNames = make(map[int64]string, len(data.Notifiers))
+	for _, n := range data.Notifiers {
+		data.NotifierNames[n.ID] = n.Name
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleNotifiers(w http.ResponseWriter, r *http.Request)
+
+// recordNeighbourCnt is the number of Records before and after a Record
+// that are shown on its page.
+const recordNeighbourCnt = 5
+
+// handleRecord displays a single Record, with all the details we know, and
+// a few Records around it.
+func (srv *Server) handleRecord(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "record"
+	var (
+		err         error
+		msg         string
+		id          int64
+		tmpl        *template.Template
+		db          database.Storage
+		sess        *sessions.Session
+		hosts       []model.Host
+		vars        map[string]string
+		annotations map[int64][]model.Annotation
+		tags        map[int64][]model.Tag
+		data        = tmplDataRecord{
+			tmplDataBase: tmplDataBase{
+				Title: "Record",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+		}
+	)
+
+	vars = mux.Vars(r)
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records, err = db.RecordGetContext(id, recordNeighbourCnt, recordNeighbourCnt, false); err != nil {
+		msg = fmt.Sprintf("Failed to get context of Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records == nil {
+		msg = fmt.Sprintf("Record %d does not exist", id)
+		srv.log.Printf("[INFO] %s\n", msg)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	} else if data.Signatures, err = recordSignatures(db, id); err != nil {
+		msg = fmt.Sprintf("Failed to query Detections of Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Label, err = db.LabelGetByRecord(id); err != nil {
+		msg = fmt.Sprintf("Failed to query Label of Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if annotations, tags, err = recordNotes(db, []model.Record{{ID: id}}); err != nil {
+		msg = fmt.Sprintf("Failed to query Annotations and Tags of Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Incidents, err = db.IncidentGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query Incidents from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Annotations = annotations[id]
+	data.Tags = tags[id]
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	for i := range data.Records {
+		if data.Records[i].ID == id {
+			data.Detail = newRecordDetail(&data.Records[i], data.Hostnames[data.Records[i].HostID])
+			break
+		}
+	}
+
+	data.Title = fmt.Sprintf("Record %d on %s", id, data.Detail.Host)
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleRecord(w http.ResponseWriter, r *http.Request)
+
+// recordSignatures returns the Signatures the Record with the given ID
+// matched.
+func recordSignatures(db database.Storage, id int64) ([]model.Signature, error) {
+	var (
+		err   error
+		found []model.Detection
+		sigs  []model.Signature
+		tags  []model.Signature
+	)
+
+	if found, err = db.DetectionGetByRecord(id); err != nil {
+		return nil, err
+	} else if len(found) == 0 {
+		return nil, nil
+	} else if sigs, err = db.SignatureGetAll(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range found {
+		for _, s := range sigs {
+			if s.ID == d.SignatureID {
+				tags = append(tags, s)
+				break
+			}
+		}
+	}
+
+	return tags, nil
+} // func recordSignatures(db database.Storage, id int64) ([]model.Signature, error)
+
+// recordNotes returns the Annotations and Tags of the given Records, keyed
+// by the ID of their Record.
+func recordNotes(db database.Storage, records []model.Record) (map[int64][]model.Annotation, map[int64][]model.Tag, error) {
+	var (
+		err         error
+		annotations map[int64][]model.Annotation
+		tags        map[int64][]model.Tag
+		ids         = make([]int64, len(records))
+	)
+
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+
+	if annotations, err = db.AnnotationGetByRecords(ids); err != nil {
+		return nil, nil, err
+	} else if tags, err = db.TagGetByRecords(ids); err != nil {
+		return nil, nil, err
+	}
+
+	return annotations, tags, nil
+} // func recordNotes(db database.Storage, records []model.Record) (map[int64][]model.Annotation, map[int64][]model.Tag, error)
+
+func (srv *Server) handleRecordContext(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "context"
+	var (
+		err  error
+		msg  string
+		id   int64
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		vars map[string]string
+		data = tmplDataContext{
+			tmplDataBase: tmplDataBase{
+				Title: "Context",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			SameSource: r.URL.Query().Get("source") != "",
+		}
+	)
+
+	vars = mux.Vars(r)
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Record ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Before, err = contextParam(r, "before"); err != nil {
+		srv.log.Printf("[ERROR] %s\n", err.Error())
+		srv.sendErrorMessage(w, err.Error())
+		return
+	} else if data.After, err = contextParam(r, "after"); err != nil {
+		srv.log.Printf("[ERROR] %s\n", err.Error())
+		srv.sendErrorMessage(w, err.Error())
+		return
+	} else if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records, err = db.RecordGetContext(id, data.Before, data.After, data.SameSource); err != nil {
+		msg = fmt.Sprintf("Failed to get context of Record %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records == nil {
+		msg = fmt.Sprintf("Record %d does not exist", id)
+		srv.log.Printf("[INFO] %s\n", msg)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+
+	for _, rec := range data.Records {
+		if rec.ID == id {
+			data.Record = rec
+			break
+		}
+	}
+
+	data.Hostnames = make(map[int64]string, len(data.Hosts))
+	for _, h := range data.Hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	data.Title = fmt.Sprintf("Context of Record %d on %s",
+		id,
+		data.Hostnames[data.Record.HostID])
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleRecordContext(w http.ResponseWriter, r *http.Request)
+
+const (
+	// patternRecentPeriod is the period for which the patterns page shows
+	// how many Records matched each Pattern.
+	patternRecentPeriod = time.Hour * 24
+	// patternHistoryPeriod is the period the histogram on the page of a
+	// Pattern covers.
+	patternHistoryPeriod = time.Hour * 24 * 7
+	// patternRecordCnt is the number of matching Records shown on the page
+	// of a Pattern.
+	patternRecordCnt = 100
+)
+
+// handlePatterns displays the Patterns found in the messages of the
+// Records, the most common first.
+func (srv *Server) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "patterns"
+	var (
+		err  error
+		msg  string
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		data = tmplDataPatterns{
+			tmplDataBase: tmplDataBase{
+				Title: "Patterns",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Since: time.Now().Add(-patternRecentPeriod),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Patterns, err = db.PatternGetAll(data.Since); err != nil {
+		msg = fmt.Sprintf("Failed to query Patterns from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handlePatterns(w http.ResponseWriter, r *http.Request)
+
+// handlePattern displays a single Pattern, how many Records matched it
+// recently, and the most recent of those Records.
+func (srv *Server) handlePattern(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "pattern"
+	var (
+		err    error
+		msg    string
+		id     int64
+		tmpl   *template.Template
+		db     database.Storage
+		sess   *sessions.Session
+		hosts  []model.Host
+		counts []model.Bucket
+		ids    []int64
+		vars   map[string]string
+		now    = time.Now()
+		data   = tmplDataPattern{
+			tmplDataBase: tmplDataBase{
+				Title: "Pattern",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+		}
+	)
+
+	vars = mux.Vars(r)
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Pattern ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Pattern, err = db.PatternGetByID(id); err != nil {
+		msg = fmt.Sprintf("Failed to query Pattern %d from database: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Pattern == nil {
+		msg = fmt.Sprintf("Pattern %d does not exist", id)
+		srv.log.Printf("[INFO] %s\n", msg)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if counts, err = db.PatternGetCounts(id, now.Add(-patternHistoryPeriod)); err != nil {
+		msg = fmt.Sprintf("Failed to query counts of Pattern %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if ids, err = db.PatternGetRecordIDs(id, patternRecordCnt); err != nil {
+		msg = fmt.Sprintf("Failed to query Records of Pattern %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Records, err = db.RecordGetByIDList(ids); err != nil {
+		msg = fmt.Sprintf("Failed to load Records of Pattern %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Title = fmt.Sprintf("Pattern %d", id)
+	data.Histogram, data.MaxBucket = patternHistogram(counts, now.Add(-patternHistoryPeriod), now)
+
+	slices.SortFunc(data.Records, func(a, b model.Record) int {
+		return b.Time.Compare(a.Time)
+	})
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handlePattern(w http.ResponseWriter, r *http.Request)
+
+// patternHistogram turns the counts of a Pattern into one Bucket per
+// model.PatternBucket between begin and end, including the empty ones. It
+// also returns the largest count.
+func patternHistogram(counts []model.Bucket, begin, end time.Time) ([]model.Bucket, int64) {
+	var (
+		maxCnt int64
+		hist   []model.Bucket
+		idx    int
+	)
+
+	for t := begin.Truncate(model.PatternBucket); !t.After(end); t = t.Add(model.PatternBucket) {
+		var b = model.Bucket{Begin: t}
+
+		for idx < len(counts) && counts[idx].Begin.Before(t.Add(model.PatternBucket)) {
+			if !counts[idx].Begin.Before(t) {
+				b.Count += counts[idx].Count
+			}
+			idx++
+		}
+
+		maxCnt = max(maxCnt, b.Count)
+		hist = append(hist, b)
+	}
+
+	return hist, maxCnt
+} // func patternHistogram(counts []model.Bucket, begin, end time.Time) ([]model.Bucket, int64)
+
+// handleRates displays the streams, i.e. the sources of each Host, that
+// log at an unusual rate compared to the same time on the previous days.
+func (srv *Server) handleRates(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "rates"
+	var (
+		err   error
+		msg   string
+		tmpl  *template.Template
+		db    database.Storage
+		sess  *sessions.Session
+		hosts []model.Host
+		data  = tmplDataRates{
+			tmplDataBase: tmplDataBase{
+				Title: "Rates",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Width:     srv.rates.det.Width,
+			Days:      srv.rates.det.Days,
+			Threshold: srv.rates.det.Threshold,
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Stats, data.Checked, err = srv.rates.get(db, time.Now()); err != nil {
+		msg = fmt.Sprintf("Failed to compute rates: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleRates(w http.ResponseWriter, r *http.Request)
+
+// noveltyDefaultHours is how far back the feed of novel messages goes if
+// the URL does not say otherwise.
+const noveltyDefaultHours = 24
+
+// handleNovelties displays the feed of messages that a Host logged from
+// a source for the first time within the last few hours, and that nobody
+// has acknowledged, yet.
+func (srv *Server) handleNovelties(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "novelties"
+	var (
+		err   error
+		msg   string
+		hstr  string
+		tmpl  *template.Template
+		db    database.Storage
+		sess  *sessions.Session
+		hosts []model.Host
+		vars  map[string]string
+		data  = tmplDataNovelties{
+			tmplDataBase: tmplDataBase{
+				Title: "Novel messages",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+		}
+	)
+
+	vars = mux.Vars(r)
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if hstr = vars["hours"]; hstr == "" {
+		hstr = strconv.Itoa(noveltyDefaultHours)
+	}
+
+	if data.Hours, err = strconv.ParseInt(hstr, 10, 64); err != nil || data.Hours <= 0 {
+		msg = fmt.Sprintf("Invalid number of hours: %q", hstr)
+		srv.log.Printf("[ERROR] %s\n", msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	data.Since = time.Now().Add(-time.Duration(data.Hours) * time.Hour)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Novelties, err = db.NoveltyGetRecent(data.Since); err != nil {
+		msg = fmt.Sprintf("Failed to query novel messages from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleNovelties(w http.ResponseWriter, r *http.Request)
+
+// detectionCnt is the number of Detections shown on the signatures page.
+const detectionCnt = 500
+
+// handleSignatures displays the Signatures of well-known events, and the
+// Records that matched them recently. The query parameter hours is how
+// far back the Detections go.
+func (srv *Server) handleSignatures(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "signatures"
+	var (
+		err   error
+		msg   string
+		tmpl  *template.Template
+		db    database.Storage
+		sess  *sessions.Session
+		hosts []model.Host
+		data  = tmplDataSignatures{
+			tmplDataBase: tmplDataBase{
+				Title: "Signatures",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Hours: noveltyDefaultHours,
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if s := r.URL.Query().Get("hours"); s != "" {
+		if data.Hours, err = strconv.ParseInt(s, 10, 64); err != nil || data.Hours <= 0 {
+			msg = fmt.Sprintf("Invalid number of hours: %q", s)
+			srv.log.Printf("[ERROR] %s\n", msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	data.Since = time.Now().Add(-time.Duration(data.Hours) * time.Hour)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Signatures, err = db.SignatureGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query Signatures from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Detections, err = db.DetectionGetRecent(data.Since, detectionCnt); err != nil {
+		msg = fmt.Sprintf("Failed to query Detections from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	data.SigByID = make(map[int64]*model.Signature, len(data.Signatures))
+	data.Queries = make(map[int64]string, len(data.Signatures))
+	for i := range data.Signatures {
+		var sig = &data.Signatures[i]
+		data.SigByID[sig.ID] = sig
+		data.Queries[sig.ID] = queryString(&sig.Query)
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleSignatures(w http.ResponseWriter, r *http.Request)
+
+// interestingCnt is the number of Records shown in the list of likely
+// interesting Records.
+const interestingCnt = 250
+
+// handleInteresting displays the Records of the last few hours the
+// classifier deems the most likely to be interesting. The query parameter
+// hours is how far back the list goes.
+func (srv *Server) handleInteresting(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "interesting"
+	var (
+		err     error
+		msg     string
+		tmpl    *template.Template
+		db      database.Storage
+		sess    *sessions.Session
+		hosts   []model.Host
+		scores  []model.Score
+		records []model.Record
+		m       = srv.classifier.current()
+		data    = tmplDataInteresting{
+			tmplDataBase: tmplDataBase{
+				Title: "Likely interesting",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Hours:    noveltyDefaultHours,
+			Examples: m.Examples(),
+			Ready:    m.Ready(),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if s := r.URL.Query().Get("hours"); s != "" {
+		if data.Hours, err = strconv.ParseInt(s, 10, 64); err != nil || data.Hours <= 0 {
+			msg = fmt.Sprintf("Invalid number of hours: %q", s)
+			srv.log.Printf("[ERROR] %s\n", msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	data.Since = time.Now().Add(-time.Duration(data.Hours) * time.Hour)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if scores, err = db.ScoreGetTop(data.Since, interestingCnt); err != nil {
+		msg = fmt.Sprintf("Failed to query Scores from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	var ids = make([]int64, len(scores))
+	data.Scores = make(map[int64]float64, len(scores))
+	for i, s := range scores {
+		ids[i] = s.RecordID
+		data.Scores[s.RecordID] = s.Value
+	}
+
+	if records, err = db.RecordGetByIDList(ids); err != nil {
+		msg = fmt.Sprintf("Failed to query Records from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	// The Records come back in whatever order the database likes, we
+	// want the highest Score first.
+	data.Records = records
+	slices.SortStableFunc(data.Records, func(a, b model.Record) int {
+		return cmp.Compare(data.Scores[b.ID], data.Scores[a.ID])
+	})
+
+	data.Hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		data.Hostnames[h.ID] = h.NameShort()
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleInteresting(w http.ResponseWriter, r *http.Request)
+
+// handleIncidents displays all Incidents, and a form to open a new one.
+func (srv *Server) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "incidents"
+	var (
+		err  error
+		msg  string
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		data = tmplDataIncidents{
+			tmplDataBase: tmplDataBase{
+				Title: "Incidents",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Now: time.Now(),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Incidents, err = db.IncidentGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query Incidents from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleIncidents(w http.ResponseWriter, r *http.Request)
+
+// incidentTimelineMax is the maximum number of results of each pinned
+// Search that are shown on the timeline of an Incident.
+const incidentTimelineMax = 1000
+
+// handleIncident displays an Incident, with the Records and Searches
+// pinned to it merged into a single timeline.
+func (srv *Server) handleIncident(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "incident"
+	var (
+		err  error
+		msg  string
+		id   int64
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		vars = mux.Vars(r)
+		data = tmplDataIncident{
+			tmplDataBase: tmplDataBase{
+				Title: "Incident",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if id, err = strconv.ParseInt(vars["id"], 10, 64); err != nil {
+		msg = fmt.Sprintf("Cannot parse Incident ID %q: %s",
+			vars["id"],
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Report, err = export.LoadReport(db, id, incidentTimelineMax); err != nil {
+		msg = fmt.Sprintf("Failed to load Incident %d: %s",
+			id,
+			err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Report == nil {
+		msg = fmt.Sprintf("Incident %d does not exist", id)
+		srv.log.Printf("[INFO] %s\n", msg)
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	} else if data.Searches, err = db.SearchGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query Searches from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	// Only saved Searches can be pinned.
+	data.Searches = slices.DeleteFunc(data.Searches, func(s model.Search) bool {
+		return s.Title == ""
+	})
+
+	data.Title = "Incident: " + data.Report.Incident.Title
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleIncident(w http.ResponseWriter, r *http.Request)
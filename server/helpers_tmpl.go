@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 12. 12. 2018 by Benjamin Walkenhorst
 // (c) 2018 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 19:09:48 krylon>
+// Time-stamp: <2024-10-02 17:48:55 krylon>
 
 package server
 
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/model"
 
 	"github.com/mborgerson/GoTruncateHtml/truncatehtml"
 )
@@ -57,6 +58,9 @@ var funcmap = template.FuncMap{
 	"intRange":         intRange,
 	"inc":              inc,
 	"dec":              dec,
+	"add":              add,
+	"percent":          percent,
+	"fmt_template":     formatTemplate,
 }
 
 type generator struct {
@@ -320,3 +324,21 @@ func inc(n int64) int64 {
 func dec(n int64) int64 {
 	return n - 1
 } // func dec(n int64) int64
+
+func add(a, b int64) int64 {
+	return a + b
+} // func add(a, b int64) int64
+
+// percent returns what percentage of total n is, rounded down.
+func percent(n, total int64) int64 {
+	if total == 0 {
+		return 0
+	}
+
+	return n * 100 / total
+} // func percent(n, total int64) int64
+
+// formatTemplate makes the parameter markers in a message template visible.
+func formatTemplate(tmpl string) string {
+	return strings.ReplaceAll(tmpl, model.ParamMarker, "<*>")
+} // func formatTemplate(tmpl string) string
@@ -0,0 +1,67 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/ingest.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 13. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:12:40 krylon>
+
+// This file implements the queue through which the Records the Agents
+// submit reach the parts of the server that look at them as they come in.
+
+package server
+
+import (
+	"log"
+
+	"github.com/blicero/scrollmaster/model"
+)
+
+// ingestQueueSize is the number of batches of Records that may wait for a
+// consumer. It is larger than that of the live tail, because Records a
+// consumer drops are never counted, clustered, tagged, or scored.
+const ingestQueueSize = 256
+
+// ingestQueue hands batches of Records to a consumer that processes them
+// in a goroutine of its own. It never makes the Agents wait: If the
+// consumer falls behind, batches are dropped.
+type ingestQueue struct {
+	name string
+	log  *log.Logger
+	in   chan []model.Record
+}
+
+func newIngestQueue(l *log.Logger, name string) *ingestQueue {
+	return &ingestQueue{
+		name: name,
+		log:  l,
+		in:   make(chan []model.Record, ingestQueueSize),
+	}
+} // func newIngestQueue(l *log.Logger, name string) *ingestQueue
+
+// publish hands a batch of Records to the consumer. It never blocks.
+func (q *ingestQueue) publish(records []model.Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	select {
+	case q.in <- records:
+	default:
+		q.log.Printf("[ERROR] %s is falling behind, dropped %d Records\n",
+			q.name,
+			len(records))
+	}
+} // func (q *ingestQueue) publish(records []model.Record)
+
+// unknownHost returns true if any of the Records is from a Host that is not
+// in hosts. Queries are compiled against the Hosts known at the time, so
+// they have to be compiled again once a new one shows up. Hosts are only
+// ever added, so this is rare.
+func unknownHost[V any](hosts map[int64]V, records []model.Record) bool {
+	for i := range records {
+		if _, ok := hosts[records[i].HostID]; !ok {
+			return true
+		}
+	}
+
+	return false
+} // func unknownHost[V any](hosts map[int64]V, records []model.Record) bool
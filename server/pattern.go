@@ -0,0 +1,183 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/pattern.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 06. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:17:25 krylon>
+
+// This file implements the mining of Patterns: The messages of the Records
+// the Agents submit are clustered into templates as they come in, and we
+// keep track of which Records match which template.
+
+package server
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/drain"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// patternMiner clusters the messages of incoming Records into Patterns and
+// saves them. The clusters live in memory, so sorting a Record into one
+// is cheap, they are loaded from the database when the server starts.
+type patternMiner struct {
+	*ingestQueue
+	log   *log.Logger
+	pool  *database.Pool
+	lock  sync.Mutex
+	miner *drain.Miner
+	pats  map[int64]*model.Pattern
+}
+
+func newPatternMiner(l *log.Logger, pool *database.Pool) *patternMiner {
+	return &patternMiner{
+		ingestQueue: newIngestQueue(l, "Pattern miner"),
+		log:         l,
+		pool:        pool,
+		miner:       drain.New(),
+		pats:        make(map[int64]*model.Pattern),
+	}
+} // func newPatternMiner(l *log.Logger, pool *database.Pool) *patternMiner
+
+// load (re-)builds the clusters from the Patterns in the database.
+func (m *patternMiner) load() error {
+	var db = m.pool.Get()
+	defer m.pool.Put(db)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.reload(db)
+} // func (m *patternMiner) load() error
+
+// reload does the work for load. The caller must hold the lock.
+func (m *patternMiner) reload(db database.Storage) error {
+	var (
+		err  error
+		list []model.Pattern
+	)
+
+	if list, err = db.PatternGetAll(time.Now()); err != nil {
+		m.log.Printf("[ERROR] Cannot load Patterns: %s\n", err.Error())
+		return err
+	}
+
+	m.miner = drain.New()
+	m.pats = make(map[int64]*model.Pattern, len(list))
+
+	for i := range list {
+		var p = &list[i]
+
+		m.pats[p.ID] = p
+		m.miner.Insert(&drain.Cluster{
+			ID:     p.ID,
+			Tokens: strings.Fields(p.Template),
+		})
+	}
+
+	return nil
+} // func (m *patternMiner) reload(db database.Storage) error
+
+// run is the miner's main loop.
+func (m *patternMiner) run() {
+	if err := m.load(); err != nil {
+		m.log.Printf("[ERROR] Patterns could not be loaded, new ones will be created: %s\n",
+			err.Error())
+	}
+
+	for records := range m.in {
+		m.ingest(records) // nolint: errcheck
+	}
+} // func (m *patternMiner) run()
+
+// ingest sorts the Records into clusters and saves the new and changed
+// Patterns along with the Records that match them. If saving fails, the
+// clusters are loaded from the database again, so they do not drift apart
+// from what is stored.
+func (m *patternMiner) ingest(records []model.Record) error {
+	var (
+		err     error
+		db      database.Storage
+		order   []*drain.Cluster
+		changed = make(map[*drain.Cluster]bool)
+		byClust = make(map[*drain.Cluster][]model.Record)
+	)
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, r := range records {
+		var c, ch = m.miner.Add(r.Message)
+
+		if _, ok := byClust[c]; !ok {
+			order = append(order, c)
+		}
+
+		byClust[c] = append(byClust[c], r)
+		changed[c] = changed[c] || ch
+	}
+
+	db = m.pool.Get()
+	defer m.pool.Put(db)
+
+	if err = db.Begin(); err != nil {
+		m.log.Printf("[ERROR] Cannot start transaction: %s\n", err.Error())
+		goto RELOAD
+	}
+
+	for _, c := range order {
+		var p = m.pats[c.ID]
+
+		if c.ID == 0 {
+			p = &model.Pattern{
+				Template:  c.Template(),
+				FirstSeen: byClust[c][0].Time,
+				LastSeen:  byClust[c][0].Time,
+			}
+
+			if err = db.PatternAdd(p); err != nil {
+				goto ROLLBACK
+			}
+		} else if p == nil {
+			m.log.Printf("[CANTHAPPEN] Cluster %d has no Pattern\n", c.ID)
+			continue
+		} else if changed[c] {
+			p.Template = c.Template()
+			if err = db.PatternUpdate(p); err != nil {
+				goto ROLLBACK
+			}
+		}
+
+		if err = db.PatternAddRecords(p, byClust[c]); err != nil {
+			goto ROLLBACK
+		} else if c.ID == 0 {
+			c.ID = p.ID
+			m.pats[p.ID] = p
+		}
+	}
+
+	if err = db.Commit(); err != nil {
+		m.log.Printf("[ERROR] Cannot commit transaction: %s\n", err.Error())
+		goto RELOAD
+	}
+
+	return nil
+
+ROLLBACK:
+	m.log.Printf("[ERROR] Cannot save Patterns for %d Records: %s\n",
+		len(records),
+		err.Error())
+	db.Rollback() // nolint: errcheck
+
+RELOAD:
+	m.reload(db) // nolint: errcheck
+	return err
+} // func (m *patternMiner) ingest(records []model.Record) error
@@ -0,0 +1,70 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/rate.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 07. 10. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:41:07 krylon>
+
+// This file implements the monitoring of the rates at which the Hosts log
+// from their sources. The baselines are computed from the stored Records,
+// which takes a while, so the results are kept around for a few minutes.
+
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/blicero/scrollmaster/rate"
+)
+
+// rateMaxAge is how long the results of analyzing the rates are used
+// before they are computed again.
+const rateMaxAge = time.Minute * 5
+
+// rateMonitor compares the rates at which the Hosts log from their sources
+// to their baselines.
+type rateMonitor struct {
+	log   *log.Logger
+	det   *rate.Detector
+	lock  sync.Mutex
+	stats []model.RateStat
+	stamp time.Time
+}
+
+func newRateMonitor(l *log.Logger) *rateMonitor {
+	return &rateMonitor{
+		log: l,
+		det: rate.New(),
+	}
+} // func newRateMonitor(l *log.Logger) *rateMonitor
+
+// get returns the rates of all streams as of the given time, anomalous
+// ones first, along with the time they were computed. If the most recent
+// results are older than rateMaxAge, they are computed again.
+func (m *rateMonitor) get(db database.Storage, now time.Time) ([]model.RateStat, time.Time, error) {
+	var (
+		err    error
+		counts []model.RateCount
+	)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if now.Sub(m.stamp) < rateMaxAge && !now.Before(m.stamp) {
+		return m.stats, m.stamp, nil
+	}
+
+	if counts, err = db.RecordGetRates(m.det.Begin(now), now, m.det.Width); err != nil {
+		m.log.Printf("[ERROR] Cannot count Records per Host and source: %s\n",
+			err.Error())
+		return nil, time.Time{}, err
+	}
+
+	m.stats = m.det.Analyze(counts, now)
+	m.stamp = now
+
+	return m.stats, m.stamp, nil
+} // func (m *rateMonitor) get(db database.Storage, now time.Time) ([]model.RateStat, time.Time, error)
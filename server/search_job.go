@@ -0,0 +1,247 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/search_job.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 26. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 11:24:37 krylon>
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+)
+
+// jobKeep is how long we keep finished search jobs around, so the frontend
+// has a chance to pick up the result.
+const jobKeep = time.Minute * 10
+
+// searchExpireInterval is how often we look for Searches whose results
+// have expired.
+const searchExpireInterval = time.Hour
+
+// SearchKeep is how long the results of a Search are kept. After that,
+// anonymous Searches are deleted, and named Searches lose their results
+// until they are run again.
+var SearchKeep = time.Hour * 24 * 30
+
+type jobStatus uint8
+
+const (
+	jobRunning jobStatus = iota
+	jobDone
+	jobCancelled
+	jobFailed
+)
+
+func (s jobStatus) String() string {
+	switch s {
+	case jobRunning:
+		return "running"
+	case jobDone:
+		return "done"
+	case jobCancelled:
+		return "cancelled"
+	case jobFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("jobStatus(%d)", s)
+	}
+} // func (s jobStatus) String() string
+
+// searchJob is a search running in the background.
+// All fields except for prog are protected by the Server's jobLock.
+type searchJob struct {
+	id       int64
+	search   model.Search
+	status   jobStatus
+	err      string
+	prog     database.SearchProgress
+	cancel   context.CancelFunc
+	started  time.Time
+	finished time.Time
+}
+
+// eta estimates how long the job is going to take to finish, based on how
+// fast it has been so far. If there is not enough data for an estimate yet,
+// it returns a negative Duration.
+func (j *searchJob) eta(now time.Time) time.Duration {
+	var (
+		scanned = j.prog.Scanned.Load()
+		total   = j.prog.Total.Load()
+		elapsed = now.Sub(j.started)
+	)
+
+	if scanned == 0 || total < scanned {
+		return -1
+	}
+
+	return time.Duration(float64(elapsed) * float64(total-scanned) / float64(scanned))
+} // func (j *searchJob) eta(now time.Time) time.Duration
+
+// searchStart starts a search job in the background and returns its ID.
+func (srv *Server) searchStart(search *model.Search) int64 {
+	var (
+		ctx context.Context
+		job = &searchJob{
+			search:  *search,
+			status:  jobRunning,
+			started: time.Now(),
+		}
+	)
+
+	ctx, job.cancel = context.WithCancel(context.Background())
+
+	srv.jobLock.Lock()
+	srv.jobReap(job.started)
+	srv.jobCnt++
+	job.id = srv.jobCnt
+	srv.jobs[job.id] = job
+	srv.jobLock.Unlock()
+
+	go srv.searchRun(ctx, job)
+
+	return job.id
+} // func (srv *Server) searchStart(search *model.Search) int64
+
+// searchRun performs the actual search and saves the result.
+func (srv *Server) searchRun(ctx context.Context, job *searchJob) {
+	var (
+		err     error
+		errmsg  string
+		db      database.Storage
+		agg     model.Aggregator
+		results = make([]int64, 0, 32)
+		q       = make(chan model.Record)
+		status  = jobDone
+	)
+
+	defer job.cancel()
+
+	if !srv.searchAcquire(ctx) {
+		status = jobCancelled
+		goto FINISH
+	}
+
+	defer srv.searchRelease()
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	go db.RecordSearch(ctx, &job.search.Query, q, &job.prog)
+
+	for r := range q {
+		results = append(results, r.ID)
+		agg.Add(&r)
+	}
+
+	// The status handler only looks at the Search once the job is done,
+	// so we do not need to hold the lock while we save it.
+	// A Search that was saved before is run again, so it keeps its ID.
+	// If the search failed, we do not save what it found so far, or
+	// it would look like a complete result.
+	if err = job.prog.Err(); err != nil {
+		errmsg = fmt.Sprintf("Search failed: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", errmsg)
+		status = jobFailed
+	} else if ctx.Err() == nil {
+		job.search.Results = results
+		job.search.Aggregates = agg.Aggregates()
+		job.search.Timestamp = time.Now()
+		job.search.Expired = false
+
+		if job.search.ID != 0 {
+			err = db.SearchUpdate(&job.search)
+		} else {
+			err = db.SearchAdd(&job.search)
+		}
+
+		if err != nil {
+			errmsg = fmt.Sprintf("Failed to save Search: %s", err.Error())
+			srv.log.Printf("[ERROR] %s\n", errmsg)
+			status = jobFailed
+		}
+	} else {
+		status = jobCancelled
+	}
+
+FINISH:
+	srv.jobLock.Lock()
+	job.status = status
+	job.err = errmsg
+	job.finished = time.Now()
+	srv.jobLock.Unlock()
+
+	srv.log.Printf("[DEBUG] Search job %d is %s after %s, %d of %d Records matched\n",
+		job.id,
+		status,
+		job.finished.Sub(job.started),
+		job.prog.Matched.Load(),
+		job.prog.Total.Load())
+} // func (srv *Server) searchRun(ctx context.Context, job *searchJob)
+
+// searchAcquire waits for one of the searchSlots to become free and takes
+// it. A search holds a database connection for as long as it runs, so if
+// there were no limit, a handful of searches could starve everything else
+// that needs the pool, including the Agents submitting Records.
+// If the context is cancelled before a slot becomes free, searchAcquire
+// returns false.
+func (srv *Server) searchAcquire(ctx context.Context) bool {
+	select {
+	case srv.searchSlots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+} // func (srv *Server) searchAcquire(ctx context.Context) bool
+
+// searchRelease gives back a slot taken by searchAcquire.
+func (srv *Server) searchRelease() {
+	<-srv.searchSlots
+} // func (srv *Server) searchRelease()
+
+// jobReap removes jobs that have been finished for longer than jobKeep.
+// The caller must hold jobLock.
+func (srv *Server) jobReap(now time.Time) {
+	for id, job := range srv.jobs {
+		if job.status != jobRunning && now.Sub(job.finished) > jobKeep {
+			delete(srv.jobs, id)
+		}
+	}
+} // func (srv *Server) jobReap(now time.Time)
+
+// searchExpireLoop periodically drops the results of Searches that are
+// older than SearchKeep.
+func (srv *Server) searchExpireLoop() {
+	var ticker = time.NewTicker(searchExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		srv.searchExpire(time.Now().Add(-SearchKeep))
+		<-ticker.C
+	}
+} // func (srv *Server) searchExpireLoop()
+
+func (srv *Server) searchExpire(before time.Time) {
+	var (
+		err error
+		cnt int64
+		db  = srv.pool.Get()
+	)
+
+	defer srv.pool.Put(db)
+
+	if cnt, err = db.SearchExpire(before); err != nil {
+		srv.log.Printf("[ERROR] Cannot expire Searches from before %s: %s\n",
+			before.Format(common.TimestampFormat),
+			err.Error())
+	} else if cnt > 0 {
+		srv.log.Printf("[INFO] Results of %d Searches from before %s have expired\n",
+			cnt,
+			before.Format(common.TimestampFormat))
+	}
+} // func (srv *Server) searchExpire(before time.Time)
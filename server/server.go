@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 20. 08. 2024 by Benjamin Walkenhorst
 // (c) 2024 Benjamin Walkenhorst
-// Time-stamp: <2024-09-13 18:12:43 krylon>
+// Time-stamp: <2024-10-13 14:52:30 krylon>
 
 // Package server implements the server side of the application.
 // It handles both talking to the Agents and the frontend.
@@ -28,12 +28,14 @@ import (
 	"github.com/blicero/scrollmaster/common/path"
 	"github.com/blicero/scrollmaster/database"
 	"github.com/blicero/scrollmaster/logdomain"
+	"github.com/blicero/scrollmaster/notify"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 )
 
 const (
 	poolSize            = 4
+	searchSlotCnt       = poolSize / 2
 	bufSize             = 32768
 	keyLength           = 4096
 	sessionKey          = "Wer das liest, ist doof!"
@@ -47,15 +49,29 @@ var assets embed.FS
 
 // Server wraps the state required for the web interface
 type Server struct {
-	Addr      string
-	log       *log.Logger
-	pool      *database.Pool
-	lock      sync.RWMutex // nolint: unused,structcheck
-	router    *mux.Router
-	tmpl      *template.Template
-	web       http.Server
-	mimeTypes map[string]string
-	store     sessions.Store // nolint: unused,structcheck
+	Addr       string
+	log        *log.Logger
+	pool       *database.Pool
+	lock       sync.RWMutex // nolint: unused,structcheck
+	router     *mux.Router
+	tmpl       *template.Template
+	web        http.Server
+	mimeTypes  map[string]string
+	store      sessions.Store // nolint: unused,structcheck
+	jobLock    sync.Mutex
+	jobs       map[int64]*searchJob
+	jobCnt     int64
+	tail       *tailHub
+	alerts     *alertEngine
+	notify     *notify.Dispatcher
+	patterns   *patternMiner
+	rates      *rateMonitor
+	detector   *detector
+	classifier *classifier
+	// searchSlots limits how many searches and exports scan the
+	// database at the same time, so they cannot take up all the
+	// connections in the pool.
+	searchSlots chan struct{}
 }
 
 // Create creates and returns a new Server.
@@ -89,6 +105,8 @@ func Create(addr string) (*Server, error) {
 				key1,
 				key2,
 			),
+			jobs:        make(map[int64]*searchJob),
+			searchSlots: make(chan struct{}, searchSlotCnt),
 		}
 	)
 
@@ -107,8 +125,19 @@ func Create(addr string) (*Server, error) {
 	} else if srv.pool == nil {
 		srv.log.Printf("[CANTHAPPEN] Database pool is nil!\n")
 		return nil, errors.New("Database pool is nil")
+	} else if srv.notify, err = notify.New(srv.pool); err != nil {
+		srv.log.Printf("[ERROR] Cannot create notification dispatcher: %s\n",
+			err.Error())
+		return nil, err
 	}
 
+	srv.tail = newTailHub(srv.log, srv.pool)
+	srv.rates = newRateMonitor(srv.log)
+	srv.alerts = newAlertEngine(srv.log, srv.pool, srv.notify, srv.rates)
+	srv.patterns = newPatternMiner(srv.log, srv.pool)
+	srv.detector = newDetector(srv.log, srv.pool)
+	srv.classifier = newClassifier(srv.log, srv.pool)
+
 	const tmplFolder = "assets/templates"
 	var templates []fs.DirEntry
 	var tmplRe = regexp.MustCompile("[.]tmpl$")
@@ -156,7 +185,25 @@ func Create(addr string) (*Server, error) {
 	srv.router.HandleFunc("/static/{file}", srv.handleStaticFile)
 	srv.router.HandleFunc("/{page:(?:index|main|start)?$}", srv.handleMain)
 	srv.router.HandleFunc("/log/recent/{cnt:(?:\\d+)?$}", srv.handleLogRecent)
+	srv.router.HandleFunc("/log/tail", srv.handleLogTail)
+	srv.router.HandleFunc("/log/tail/stream", srv.handleLogTailStream)
 	srv.router.HandleFunc("/search", srv.handleSearch)
+	srv.router.HandleFunc("/search/{id:(?:\\d+)$}", srv.handleSearch)
+	srv.router.HandleFunc("/record/{id:(?:\\d+)$}", srv.handleRecord)
+	srv.router.HandleFunc("/record/{id:(?:\\d+)}/context", srv.handleRecordContext)
+	srv.router.HandleFunc("/alerts", srv.handleAlerts)
+	srv.router.HandleFunc("/notifiers", srv.handleNotifiers)
+	srv.router.HandleFunc("/patterns", srv.handlePatterns)
+	srv.router.HandleFunc("/pattern/{id:(?:\\d+)$}", srv.handlePattern)
+	srv.router.HandleFunc("/rates", srv.handleRates)
+	srv.router.HandleFunc("/novel/{hours:(?:\\d+)?$}", srv.handleNovelties)
+	srv.router.HandleFunc("/signatures", srv.handleSignatures)
+	srv.router.HandleFunc("/interesting", srv.handleInteresting)
+	srv.router.HandleFunc("/incidents", srv.handleIncidents)
+	srv.router.HandleFunc("/incident/{id:(?:\\d+)$}", srv.handleIncident)
+	srv.router.HandleFunc("/incident/{id:(?:\\d+)}/export", srv.handleExportIncident)
+	srv.router.HandleFunc("/export", srv.handleExportQuery)
+	srv.router.HandleFunc("/export/search/{id:(?:\\d+)$}", srv.handleExportSearch)
 
 	// Agent handlers
 	srv.router.HandleFunc("/ws/init/{hostname:(?:[^/]+$)}", srv.handleAgentInit)
@@ -170,6 +217,34 @@ func Create(addr string) (*Server, error) {
 		"/ajax/search/load/{id:(?:\\d+)}/{page:(?:\\d+)$}",
 		srv.handleAjaxSearchLoad)
 	srv.router.HandleFunc("/ajax/search/delete/{id:(?:\\d+)$}", srv.handleAjaxSearchDelete)
+	srv.router.HandleFunc("/ajax/search/save/{id:(?:\\d+)$}", srv.handleAjaxSearchSave)
+	srv.router.HandleFunc("/ajax/search/rerun/{id:(?:\\d+)$}", srv.handleAjaxSearchRerun)
+	srv.router.HandleFunc("/ajax/search/duplicate/{id:(?:\\d+)$}", srv.handleAjaxSearchDuplicate)
+	srv.router.HandleFunc("/ajax/search/job/{id:(?:\\d+)$}", srv.handleAjaxSearchJobStatus)
+	srv.router.HandleFunc("/ajax/search/job/{id:(?:\\d+)}/cancel", srv.handleAjaxSearchJobCancel)
+	srv.router.HandleFunc("/ajax/record/{id:(?:\\d+)$}", srv.handleAjaxRecord)
+	srv.router.HandleFunc("/ajax/record/label/{id:(?:\\d+)$}", srv.handleAjaxRecordLabel)
+	srv.router.HandleFunc("/ajax/record/annotate/{id:(?:\\d+)$}", srv.handleAjaxRecordAnnotate)
+	srv.router.HandleFunc("/ajax/record/tag/{id:(?:\\d+)$}", srv.handleAjaxRecordTag)
+	srv.router.HandleFunc("/ajax/record/untag/{id:(?:\\d+)$}", srv.handleAjaxRecordUntag)
+	srv.router.HandleFunc("/ajax/annotation/delete/{id:(?:\\d+)$}", srv.handleAjaxAnnotationDelete)
+	srv.router.HandleFunc("/ajax/incident/save", srv.handleAjaxIncidentSave)
+	srv.router.HandleFunc("/ajax/incident/delete/{id:(?:\\d+)$}", srv.handleAjaxIncidentDelete)
+	srv.router.HandleFunc("/ajax/incident/pin/{id:(?:\\d+)$}", srv.handleAjaxIncidentPin)
+	srv.router.HandleFunc("/ajax/incident/unpin/{id:(?:\\d+)$}", srv.handleAjaxIncidentUnpin)
+	srv.router.HandleFunc("/ajax/alert/rule/save", srv.handleAjaxAlertRuleSave)
+	srv.router.HandleFunc("/ajax/alert/rule/delete/{id:(?:\\d+)$}", srv.handleAjaxAlertRuleDelete)
+	srv.router.HandleFunc("/ajax/alert/rule/silence/{id:(?:\\d+)$}", srv.handleAjaxAlertRuleSilence)
+	srv.router.HandleFunc("/ajax/host/watch/{id:(?:\\d+)$}", srv.handleAjaxHostWatch)
+	srv.router.HandleFunc("/ajax/notifier/save", srv.handleAjaxNotifierSave)
+	srv.router.HandleFunc("/ajax/notifier/delete/{id:(?:\\d+)$}", srv.handleAjaxNotifierDelete)
+	srv.router.HandleFunc("/ajax/notifier/test/{id:(?:\\d+)$}", srv.handleAjaxNotifierTest)
+	srv.router.HandleFunc("/ajax/novelty/ack/{id:(?:\\d+)$}", srv.handleAjaxNoveltyAcknowledge)
+	srv.router.HandleFunc("/ajax/signature/save", srv.handleAjaxSignatureSave)
+	srv.router.HandleFunc("/ajax/signature/delete/{id:(?:\\d+)$}", srv.handleAjaxSignatureDelete)
+
+	// Admin handlers
+	srv.router.HandleFunc("/admin/backup", srv.handleAdminBackup)
 
 	return srv, nil
 } // func Create(addr string) (*Server, error)
@@ -178,6 +253,12 @@ func Create(addr string) (*Server, error) {
 func (srv *Server) ListenAndServe() {
 	srv.log.Printf("[DEBUG] Server start listening on %s.\n", srv.Addr)
 	defer srv.log.Println("[DEBUG] Server has quit.")
+	go srv.searchExpireLoop()
+	go srv.tail.run()
+	go srv.alerts.run()
+	go srv.patterns.run()
+	go srv.detector.run()
+	go srv.classifier.run()
 	srv.web.ListenAndServe() // nolint: errcheck
 } // func (srv *Server) ListenAndServe()
 
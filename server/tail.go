@@ -0,0 +1,437 @@
+// /home/krylon/go/src/github.com/blicero/scrollmaster/server/tail.go
+// -*- mode: go; coding: utf-8; -*-
+// Created on 30. 09. 2024 by Benjamin Walkenhorst
+// (c) 2024 Benjamin Walkenhorst
+// Time-stamp: <2024-10-13 14:52:10 krylon>
+
+// This file implements the live tail: Records submitted by the Agents are
+// pushed to the browser as Server-Sent Events.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/database"
+	"github.com/blicero/scrollmaster/model"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// tailQueueSize is the number of batches of Records that may wait
+	// for the dispatcher. If it falls behind further, batches are dropped,
+	// so the Agents never have to wait for live tail clients.
+	tailQueueSize = 64
+	// tailBufSize is the number of Records queued for one client.
+	tailBufSize = 256
+	// tailKeepAlive is how often we send something to an idle client, so
+	// proxies do not close the connection.
+	tailKeepAlive = time.Second * 30
+)
+
+// tailSub is a client following the live tail. hosts are the Hosts its
+// query was compiled against.
+type tailSub struct {
+	query   *model.SearchQuery
+	hosts   map[int64]bool
+	q       chan model.Record
+	dropped atomic.Int64
+}
+
+// tailHub distributes newly added Records to the live tail clients.
+type tailHub struct {
+	log  *log.Logger
+	pool *database.Pool
+	lock sync.RWMutex
+	subs map[*tailSub]struct{}
+	cnt  atomic.Int64
+	in   chan []model.Record
+}
+
+func newTailHub(l *log.Logger, pool *database.Pool) *tailHub {
+	return &tailHub{
+		log:  l,
+		pool: pool,
+		subs: make(map[*tailSub]struct{}),
+		in:   make(chan []model.Record, tailQueueSize),
+	}
+} // func newTailHub(l *log.Logger, pool *database.Pool) *tailHub
+
+// subscribe registers a client that receives all Records matching the
+// query. The query must be compiled against the given Hosts.
+func (h *tailHub) subscribe(query *model.SearchQuery, hosts []model.Host) *tailSub {
+	var sub = &tailSub{
+		query: query,
+		hosts: make(map[int64]bool, len(hosts)),
+		q:     make(chan model.Record, tailBufSize),
+	}
+
+	for _, host := range hosts {
+		sub.hosts[host.ID] = true
+	}
+
+	h.lock.Lock()
+	h.subs[sub] = struct{}{}
+	h.cnt.Store(int64(len(h.subs)))
+	h.lock.Unlock()
+
+	return sub
+} // func (h *tailHub) subscribe(query *model.SearchQuery, hosts []model.Host) *tailSub
+
+func (h *tailHub) unsubscribe(sub *tailSub) {
+	h.lock.Lock()
+	delete(h.subs, sub)
+	h.cnt.Store(int64(len(h.subs)))
+	h.lock.Unlock()
+} // func (h *tailHub) unsubscribe(sub *tailSub)
+
+// publish hands a batch of Records to the dispatcher. It never blocks.
+func (h *tailHub) publish(records []model.Record) {
+	if len(records) == 0 || h.cnt.Load() == 0 {
+		return
+	}
+
+	select {
+	case h.in <- records:
+	default:
+		h.log.Printf("[INFO] Live tail is falling behind, dropped %d Records\n",
+			len(records))
+	}
+} // func (h *tailHub) publish(records []model.Record)
+
+// run is the dispatcher loop.
+func (h *tailHub) run() {
+	for records := range h.in {
+		h.dispatch(records)
+	}
+} // func (h *tailHub) run()
+
+// dispatch sends the Records to every client whose query they match.
+// If a client's queue is full, the Record is dropped for that client.
+func (h *tailHub) dispatch(records []model.Record) {
+	var (
+		hosts  []model.Host
+		loaded bool
+	)
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for sub := range h.subs {
+		if unknownHost(sub.hosts, records) {
+			if !loaded {
+				hosts, loaded = h.loadHosts(), true
+			}
+
+			h.rebind(sub, hosts, records)
+		}
+
+		for _, r := range records {
+			if !sub.query.Match(&r) {
+				continue
+			}
+
+			select {
+			case sub.q <- r:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+} // func (h *tailHub) dispatch(records []model.Record)
+
+// loadHosts returns all Hosts from the database, or nil if they cannot be
+// loaded.
+func (h *tailHub) loadHosts() []model.Host {
+	var (
+		err   error
+		hosts []model.Host
+		db    = h.pool.Get()
+	)
+
+	defer h.pool.Put(db)
+
+	if hosts, err = db.HostGetAll(); err != nil {
+		h.log.Printf("[ERROR] Failed to query all Hosts from database: %s\n",
+			err.Error())
+		return nil
+	}
+
+	return hosts
+} // func (h *tailHub) loadHosts() []model.Host
+
+// rebind compiles the query of a client again, so its host patterns match
+// the Hosts that registered after it started listening. The Hosts of the
+// Records count as known afterwards, even if they could not be loaded, so
+// we do not try again for every batch.
+func (h *tailHub) rebind(sub *tailSub, hosts []model.Host, records []model.Record) {
+	if hosts != nil {
+		if err := sub.query.Compile(hosts); err != nil {
+			h.log.Printf("[ERROR] Cannot compile live tail query %q again: %s\n",
+				sub.query.Query,
+				err.Error())
+		}
+	}
+
+	for _, host := range hosts {
+		sub.hosts[host.ID] = true
+	}
+
+	for i := range records {
+		sub.hosts[records[i].HostID] = true
+	}
+} // func (h *tailHub) rebind(sub *tailSub, hosts []model.Host, records []model.Record)
+
+// tailEvent is what the live tail sends to the browser for each Record.
+type tailEvent struct {
+	ID       int64  `json:"id"`
+	Host     string `json:"host"`
+	Time     string `json:"time"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// parseQuery parses the query of a live tail, an alert rule, or a
+// Signature, which is either a SearchQuery in JSON or an expression in the
+// query language. All of them are matched against Records as they come
+// in, so queries that only work on stored Records are rejected.
+func parseQuery(s string, hosts []model.Host) (*model.SearchQuery, error) {
+	var (
+		err   error
+		query = new(model.SearchQuery)
+	)
+
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		query.Query = s
+	} else if err = json.Unmarshal([]byte(s), query); err != nil {
+		return nil, fmt.Errorf("Cannot parse query %q: %w", s, err)
+	}
+
+	if err = query.Compile(hosts); err != nil {
+		return nil, err
+	} else if err = query.CheckLive(); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+} // func parseQuery(s string, hosts []model.Host) (*model.SearchQuery, error)
+
+// queryString is the inverse of parseQuery: It returns the expression in
+// the query language if that is all there is to the SearchQuery, or the
+// SearchQuery in JSON otherwise.
+func queryString(q *model.SearchQuery) string {
+	var (
+		simple   = model.SearchQuery{Query: q.Query}
+		full, _  = json.Marshal(q)
+		short, _ = json.Marshal(&simple)
+	)
+
+	if string(full) == string(short) {
+		return q.Query
+	}
+
+	return string(full)
+} // func queryString(q *model.SearchQuery) string
+
+func (srv *Server) handleLogTail(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	const tmplName = "tail"
+	var (
+		err  error
+		msg  string
+		tmpl *template.Template
+		db   database.Storage
+		sess *sessions.Session
+		data = tmplDataTail{
+			tmplDataBase: tmplDataBase{
+				Title: "Live Tail",
+				Debug: true,
+				URL:   r.URL.EscapedPath(),
+			},
+			Query: r.URL.Query().Get("q"),
+		}
+	)
+
+	db = srv.pool.Get()
+	defer srv.pool.Put(db)
+
+	if sess, err = srv.store.Get(r, sessionNameFrontend); err != nil {
+		msg = fmt.Sprintf("Error getting client session from session store: %s",
+			err.Error())
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if tmpl = srv.tmpl.Lookup(tmplName); tmpl == nil {
+		msg = fmt.Sprintf("Could not find template %q", tmplName)
+		srv.log.Println("[CRITICAL] " + msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	} else if data.Hosts, err = db.HostGetAll(); err != nil {
+		msg = fmt.Sprintf("Failed to query all Hosts from database: %s", err.Error())
+		srv.log.Printf("[ERROR] %s\n", msg)
+		srv.sendErrorMessage(w, msg)
+		return
+	}
+
+	if err = sess.Save(r, w); err != nil {
+		srv.log.Printf("[ERROR] Failed to set session cookie: %s\n",
+			err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(200)
+	if err = tmpl.Execute(w, &data); err != nil {
+		msg = fmt.Sprintf("Error rendering template %q: %s",
+			tmplName,
+			err.Error())
+		srv.sendErrorMessage(w, msg)
+	}
+} // func (srv *Server) handleLogTail(w http.ResponseWriter, r *http.Request)
+
+// handleLogTailStream sends the Records matching the query in the
+// parameter q as Server-Sent Events as they come in, until the client
+// goes away.
+func (srv *Server) handleLogTailStream(w http.ResponseWriter, r *http.Request) {
+	srv.log.Printf("[TRACE] Handle request for %s from %s\n",
+		r.URL.EscapedPath(),
+		r.RemoteAddr)
+
+	var (
+		err       error
+		ok        bool
+		flusher   http.Flusher
+		hosts     []model.Host
+		query     *model.SearchQuery
+		sub       *tailSub
+		ticker    *time.Ticker
+		hostnames map[int64]string
+		db        = srv.pool.Get()
+	)
+
+	if flusher, ok = w.(http.Flusher); !ok {
+		srv.pool.Put(db)
+		srv.log.Println("[CANTHAPPEN] ResponseWriter does not support flushing")
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	} else if hosts, err = db.HostGetAll(); err != nil {
+		srv.pool.Put(db)
+		srv.log.Printf("[ERROR] Failed to query all Hosts from database: %s\n",
+			err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// We do not want to hog a database connection for as long as the
+	// client keeps watching.
+	srv.pool.Put(db)
+
+	if query, err = parseQuery(r.URL.Query().Get("q"), hosts); err != nil {
+		srv.log.Printf("[INFO] Invalid live tail query: %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hostnames = make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		hostnames[h.ID] = h.NameShort()
+	}
+
+	sub = srv.tail.subscribe(query, hosts)
+	defer srv.tail.unsubscribe(sub)
+
+	ticker = time.NewTicker(tailKeepAlive)
+	defer ticker.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	fmt.Fprint(w, ": live tail\n\n") // nolint: errcheck
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			srv.log.Printf("[DEBUG] Live tail client %s went away\n", r.RemoteAddr)
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case rec := <-sub.q:
+			err = srv.tailSend(w, sub, &rec, hostnames)
+		}
+
+		if err != nil {
+			srv.log.Printf("[INFO] Cannot send to live tail client %s: %s\n",
+				r.RemoteAddr,
+				err.Error())
+			return
+		}
+
+		flusher.Flush()
+	}
+} // func (srv *Server) handleLogTailStream(w http.ResponseWriter, r *http.Request)
+
+// tailSend writes a Record as a Server-Sent Event. If Records were dropped
+// because the client did not keep up, it tells the client first.
+func (srv *Server) tailSend(w http.ResponseWriter, sub *tailSub, rec *model.Record, hostnames map[int64]string) error {
+	var (
+		err  error
+		buf  []byte
+		name string
+		ok   bool
+		cnt  int64
+	)
+
+	if cnt = sub.dropped.Swap(0); cnt > 0 {
+		if _, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", cnt); err != nil {
+			return err
+		}
+	}
+
+	if name, ok = hostnames[rec.HostID]; !ok {
+		// A Host that registered after the client started listening.
+		var (
+			h  *model.Host
+			db = srv.pool.Get()
+		)
+
+		if h, err = db.HostGetByID(rec.HostID); err == nil && h != nil {
+			name = h.NameShort()
+		} else {
+			name = "#" + strconv.FormatInt(rec.HostID, 10)
+		}
+
+		srv.pool.Put(db)
+		hostnames[rec.HostID] = name
+	}
+
+	var ev = tailEvent{
+		ID:       rec.ID,
+		Host:     name,
+		Time:     rec.Time.Format(common.TimestampFormat),
+		Source:   rec.Source,
+		Message:  rec.Message,
+		Severity: rec.Severity().String(),
+	}
+
+	if buf, err = json.Marshal(&ev); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: record\ndata: %s\n\n", buf)
+	return err
+} // func (srv *Server) tailSend(w http.ResponseWriter, sub *tailSub, rec *model.Record, hostnames map[int64]string) error
@@ -2,7 +2,7 @@
 // -*- mode: go; coding: utf-8; -*-
 // Created on 06. 05. 2020 by Benjamin Walkenhorst
 // (c) 2020 Benjamin Walkenhorst
-// Time-stamp: <2024-09-12 21:38:03 krylon>
+// Time-stamp: <2024-10-12 17:23:37 krylon>
 //
 // This file contains data structures to be passed to HTML templates.
 
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/blicero/scrollmaster/common"
+	"github.com/blicero/scrollmaster/export"
 	"github.com/blicero/scrollmaster/model"
 
 	"github.com/hashicorp/logutils"
@@ -54,14 +55,24 @@ type tmplDataBase struct { // nolint: unused
 type tmplDataIndex struct { // nolint: unused,deadcode
 	tmplDataBase
 	Hosts []model.Host
+	// Silent contains the IDs of the Hosts that have gone silent.
+	Silent map[int64]bool
 }
 
 type tmplDataLog struct {
 	tmplDataBase
-	Hosts     []model.Host
-	Hostnames map[int64]string
-	Records   []model.Record
-	Sources   []string
+	Hosts         []model.Host
+	Hostnames     map[int64]string
+	Records       []model.Record
+	Sources       []string
+	Count         int64
+	FilterHosts   map[int64]bool
+	FilterSources map[string]bool
+	Older         string
+	Newer         string
+	Permalink     string
+	Annotations   map[int64][]model.Annotation
+	Tags          map[int64][]model.Tag
 }
 
 type tmplDataSearch struct {
@@ -70,7 +81,8 @@ type tmplDataSearch struct {
 	Sources  map[string]int64
 	Begin    time.Time
 	End      time.Time
-	Searches [][2]int64
+	Searches []model.Search
+	Current  *model.Search
 }
 
 type tmplDataSearchResults struct {
@@ -81,6 +93,123 @@ type tmplDataSearchResults struct {
 	MaxPage          int64
 	ResultCountTotal int64
 	Search           *model.Search
+	Annotations      map[int64][]model.Annotation
+	Tags             map[int64][]model.Tag
+}
+
+type tmplDataTail struct {
+	tmplDataBase
+	Hosts []model.Host
+	Query string
+}
+
+type tmplDataContext struct {
+	tmplDataBase
+	Hosts      []model.Host
+	Hostnames  map[int64]string
+	Record     model.Record
+	Records    []model.Record
+	Before     int64
+	After      int64
+	SameSource bool
+}
+
+type tmplDataRecord struct {
+	tmplDataBase
+	Hostnames   map[int64]string
+	Detail      *recordDetail
+	Records     []model.Record
+	Signatures  []model.Signature
+	Label       *model.Label
+	Annotations []model.Annotation
+	Tags        []model.Tag
+	Incidents   []model.Incident
+}
+
+type tmplDataSignatures struct {
+	tmplDataBase
+	Hostnames  map[int64]string
+	Signatures []model.Signature
+	SigByID    map[int64]*model.Signature
+	Queries    map[int64]string
+	Detections []model.Detection
+	Hours      int64
+	Since      time.Time
+}
+
+type tmplDataInteresting struct {
+	tmplDataBase
+	Hostnames map[int64]string
+	Records   []model.Record
+	Scores    map[int64]float64
+	Examples  int64
+	Ready     bool
+	Hours     int64
+	Since     time.Time
+}
+
+type tmplDataAlerts struct {
+	tmplDataBase
+	Hostnames   map[int64]string
+	Rules       []model.AlertRule
+	RuleNames   map[int64]string
+	RuleQueries map[int64]string
+	Open        []model.Alert
+	History     []model.Alert
+	Now         time.Time
+}
+
+type tmplDataNotifiers struct {
+	tmplDataBase
+	Notifiers     []model.Notifier
+	NotifierNames map[int64]string
+	Kinds         []model.NotifierKind
+	Deliveries    []model.Delivery
+}
+
+type tmplDataPatterns struct {
+	tmplDataBase
+	Patterns []model.Pattern
+	Since    time.Time
+}
+
+type tmplDataPattern struct {
+	tmplDataBase
+	Pattern   *model.Pattern
+	Histogram []model.Bucket
+	MaxBucket int64
+	Hostnames map[int64]string
+	Records   []model.Record
+}
+
+type tmplDataRates struct {
+	tmplDataBase
+	Stats     []model.RateStat
+	Hostnames map[int64]string
+	Checked   time.Time
+	Width     time.Duration
+	Days      int
+	Threshold float64
+}
+
+type tmplDataNovelties struct {
+	tmplDataBase
+	Novelties []model.Novelty
+	Hostnames map[int64]string
+	Hours     int64
+	Since     time.Time
+}
+
+type tmplDataIncidents struct {
+	tmplDataBase
+	Incidents []model.Incident
+	Now       time.Time
+}
+
+type tmplDataIncident struct {
+	tmplDataBase
+	Report   *export.Report
+	Searches []model.Search
 }
 
 // Local Variables:  //